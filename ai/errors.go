@@ -0,0 +1,107 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// Errors ParseClipRequest failures can be matched against with errors.Is,
+// so callers can tell the user what to do about them
+var (
+	// ErrAmbiguousRequest means the model answered but couldn't turn the
+	// description into a clip, e.g. "the good part"
+	ErrAmbiguousRequest = errors.New("AI could not understand the request")
+
+	// ErrProviderUnreachable means the request never got an answer: the
+	// server is down, the address is wrong, it timed out, or it answered
+	// with a 5xx
+	ErrProviderUnreachable = errors.New("AI provider unreachable")
+
+	// ErrInvalidResponse means the provider answered with something that
+	// isn't the clip JSON, even after a repair attempt
+	ErrInvalidResponse = errors.New("invalid AI response")
+)
+
+// ProviderError is a non-2xx answer from the AI provider. Server errors
+// (5xx) also match ErrProviderUnreachable.
+type ProviderError struct {
+	StatusCode int
+	Status     string
+	URL        string
+	Body       string
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("AI request failed: %s\n  URL: %s\n  Response: %s", e.Status, e.URL, e.Body)
+}
+
+// Is makes server errors match ErrProviderUnreachable
+func (e *ProviderError) Is(target error) bool {
+	return target == ErrProviderUnreachable && e.StatusCode >= http.StatusInternalServerError
+}
+
+// classifiedError keeps err's message while also matching kind
+type classifiedError struct {
+	kind error
+	err  error
+}
+
+func (e *classifiedError) Error() string   { return e.err.Error() }
+func (e *classifiedError) Unwrap() []error { return []error{e.kind, e.err} }
+
+// classify marks err as one of the sentinel errors above without changing
+// its message
+func classify(kind, err error) error {
+	return &classifiedError{kind: kind, err: err}
+}
+
+// anthropicRequestError wraps a failed Claude request to the named
+// provider, marking it unreachable unless the API answered with a client
+// error
+func anthropicRequestError(provider string, err error) error {
+	wrapped := fmt.Errorf("%s request failed: %w", provider, err)
+	var apiErr *anthropic.Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode < http.StatusInternalServerError {
+		return wrapped
+	}
+	return classify(ErrProviderUnreachable, wrapped)
+}
+
+// errorStatusCode returns the HTTP status of a provider error, or 0
+func errorStatusCode(err error) int {
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr.StatusCode
+	}
+	var apiErr *anthropic.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// ErrorGuidance returns a one-line hint for a parse failure, or "" when
+// there is nothing more specific to say than the error itself
+func ErrorGuidance(err error) string {
+	status := errorStatusCode(err)
+	switch {
+	case errors.Is(err, ErrAmbiguousRequest):
+		return "Try rephrasing with explicit times, e.g. \"from 1:30 to 2:45\" or \"first 2 minutes\"."
+	case errors.Is(err, context.DeadlineExceeded):
+		return "The AI took too long to answer. Raise AI_TIMEOUT (e.g. AI_TIMEOUT=5m) for slow models."
+	case errors.Is(err, ErrProviderUnreachable):
+		return "Is your AI server running? Check LLM_ENDPOINT, OPENAI_BASE_URL or the Azure endpoint settings."
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return "The provider rejected the credentials. Check the API key."
+	case status == http.StatusNotFound:
+		return "The endpoint or model wasn't found. Check the endpoint URL and model name."
+	case errors.Is(err, ErrInvalidResponse):
+		return "The model didn't answer in the expected format. Try again, or use a larger model."
+	default:
+		return ""
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+
+	"capycut/llm"
 )
 
 // GeminiClient handles interactions with Google's Gemini API for video transcription
@@ -123,10 +125,15 @@ func NewGeminiClient() (*GeminiClient, error) {
 		model = "gemini-2.0-flash" // Default to latest flash model
 	}
 
+	transport, err := llm.TransportFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
 	return &GeminiClient{
 		apiKey:  apiKey,
 		model:   model,
-		client:  &http.Client{Timeout: 300 * time.Second}, // 5 min timeout for video uploads
+		client:  &http.Client{Timeout: 300 * time.Second, Transport: transport}, // 5 min timeout for video uploads
 		baseURL: "https://generativelanguage.googleapis.com",
 	}, nil
 }
@@ -0,0 +1,196 @@
+package ai
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"capycut/video"
+)
+
+// Building blocks of the prompts ParseClipRequestLocal understands
+const (
+	localNumber    = `\d+(?:\.\d+)?`
+	localUnit      = `(?:hours?|hrs?|h|minutes?|mins?|m|seconds?|secs?|s)`
+	localAmount    = localNumber + `\s*` + localUnit
+	localLength    = localAmount + `(?:\s*(?:,|and)?\s*` + localAmount + `)*`
+	localTimestamp = `\d{1,2}:\d{2}(?::\d{2})?(?:\.\d+)?`
+	localPoint     = `(` + localTimestamp + `|` + localLength + `)`
+)
+
+var (
+	localAmountRe = regexp.MustCompile(`(` + localNumber + `)\s*` + `(` + localUnit + `)`)
+
+	// localFillerRe strips polite lead-ins like "give me the"
+	localFillerRe = regexp.MustCompile(`^(?:(?:please|clip|cut|give me|get|keep|extract|just)\s+)*(?:the\s+)?`)
+
+	localFirstRe = regexp.MustCompile(`^first\s+` + localPoint + `$`)
+	localLastRe  = regexp.MustCompile(`^last\s+` + localPoint + `$`)
+	localRangeRe = regexp.MustCompile(`^(?:from\s+|between\s+)?` + localPoint + `\s*(?:to|until|till|and|-|–)\s*` + localPoint + `$`)
+	localStartRe = regexp.MustCompile(`^start(?:ing)?\s+at\s+` + localPoint + `\s*,?\s*(?:and\s+)?end(?:ing)?\s+at\s+` + localPoint + `$`)
+
+	// localShareRe matches a share of the video: "first 10%", "middle 50
+	// percent", "last third", "first half of the video"
+	localShareRe = regexp.MustCompile(`^(first|last|middle)\s+(?:(` + localNumber + `)\s*(?:%|percent)|(half|third|quarter))(?:\s+of\s+(?:the\s+)?(?:video|clip|recording|it))?$`)
+)
+
+// localFractions are the shares "first half" and the like stand for
+var localFractions = map[string]float64{"half": 1.0 / 2, "third": 1.0 / 3, "quarter": 1.0 / 4}
+
+// localJoinVerb matches the verbs that can ask for ranges to be joined
+const localJoinVerb = `(?:stitch(?:ed|ing)?|join(?:ed|ing)?|combin(?:e|ed|ing)|concatenat(?:e|ed|ing)|merg(?:e|ed|ing))`
+
+// localJoinRe matches descriptions that ask for their ranges in one file,
+// such as "into one file", "as a single video" or "highlight reel". A
+// joining verb only counts in a joining phrase, followed by the ranges
+// ("join 1:00-1:10 with ...", "merge them", "combine the clips") or with
+// "together" later on, so "where they join the call" is no request.
+var localJoinRe = regexp.MustCompile(`\b(?:(?:into|in|as)\s+(?:one|a single|a|single)\s+(?:file|clip|video|reel)|` +
+	localJoinVerb + `\s+(?:\d|them\b|these\b|those\b|both\b|all\b|the\s+(?:clips|parts|ranges|segments|pieces|sections|cuts)\b)|` +
+	localJoinVerb + `\b.*\btogether\b|highlight reel|back[- ]to[- ]back)`)
+
+// WantsOneFile reports whether a description of several ranges asks for
+// them joined into one file rather than cut into a file each
+func WantsOneFile(userInput string) bool {
+	return localJoinRe.MatchString(strings.ToLower(userInput))
+}
+
+// localClip is a prompt ParseClipRequestLocal recognized, before it is
+// resolved against the video length
+type localClip struct {
+	first, last bool          // "first X" or "last X", with length or share
+	length      time.Duration // for first and last
+	share       float64       // fraction of the video; "middle X" has neither first nor last
+	start, end  time.Duration // for ranges
+}
+
+// ParseClipRequestLocal parses common clip descriptions without an AI
+// provider: "first 2 minutes", "last 45 seconds", "from 3:00 to 5:30",
+// "1:00:00 - 1:02:30", "between 2 minutes and 3 minutes 10 seconds",
+// "start at 1:23, end at 4:56", "middle 50%" and "last third". Times may be
+// MM:SS, HH:MM:SS or amounts like "90 seconds" or "1m30s"; shares are
+// percentages, "half", "third" or "quarter" of the video. Ends past the
+// video are clamped to its length. It reports false when it can't be sure
+// what was meant, so the caller can ask a provider instead.
+func ParseClipRequestLocal(userInput string, videoDuration time.Duration) (*ClipRequest, bool) {
+	clip, ok := matchLocalClip(userInput)
+	if !ok {
+		return nil, false
+	}
+
+	var start, end time.Duration
+	switch {
+	case clip.share > 0:
+		// Shares need to know how long the video is
+		if videoDuration <= 0 {
+			return nil, false
+		}
+		length := shareOf(clip.share, videoDuration)
+		switch {
+		case clip.first:
+			start, end = 0, length
+		case clip.last:
+			start, end = videoDuration-length, videoDuration
+		default:
+			start = shareOf((1-clip.share)/2, videoDuration)
+			end = start + length
+		}
+	case clip.first:
+		start, end = 0, clip.length
+	case clip.last:
+		// "Last X" needs to know where the end is
+		if videoDuration <= 0 {
+			return nil, false
+		}
+		start, end = max(videoDuration-clip.length, 0), videoDuration
+	default:
+		start, end = clip.start, clip.end
+	}
+
+	if videoDuration > 0 {
+		if start >= videoDuration {
+			return nil, false
+		}
+		end = min(end, videoDuration)
+	}
+	if end <= start {
+		return nil, false
+	}
+	return &ClipRequest{StartTime: formatDuration(start), EndTime: formatDuration(end), Local: true}, true
+}
+
+// CanParseLocally reports whether ParseClipRequestLocal recognizes the
+// description, without needing the video, so an unconfigured provider can
+// be tolerated up front
+func CanParseLocally(userInput string) bool {
+	_, ok := matchLocalClip(userInput)
+	return ok
+}
+
+// matchLocalClip recognizes one of the local prompt forms
+func matchLocalClip(userInput string) (localClip, bool) {
+	s := strings.ToLower(strings.TrimSpace(userInput))
+	s = strings.TrimRight(s, ".!")
+	s = strings.Join(strings.Fields(s), " ")
+	s = localFillerRe.ReplaceAllString(s, "")
+
+	if m := localShareRe.FindStringSubmatch(s); m != nil {
+		share := localFractions[m[3]]
+		if m[2] != "" {
+			pct, err := strconv.ParseFloat(m[2], 64)
+			if err != nil {
+				return localClip{}, false
+			}
+			share = pct / 100
+		}
+		clip := localClip{first: m[1] == "first", last: m[1] == "last", share: share}
+		return clip, share > 0 && share <= 1
+	}
+	if m := localFirstRe.FindStringSubmatch(s); m != nil {
+		length, ok := parseLocalPoint(m[1])
+		return localClip{first: true, length: length}, ok && length > 0
+	}
+	if m := localLastRe.FindStringSubmatch(s); m != nil {
+		length, ok := parseLocalPoint(m[1])
+		return localClip{last: true, length: length}, ok && length > 0
+	}
+	for _, re := range []*regexp.Regexp{localRangeRe, localStartRe} {
+		if m := re.FindStringSubmatch(s); m != nil {
+			start, ok1 := parseLocalPoint(m[1])
+			end, ok2 := parseLocalPoint(m[2])
+			return localClip{start: start, end: end}, ok1 && ok2 && end > start
+		}
+	}
+	return localClip{}, false
+}
+
+// shareOf returns the given fraction of d, to the millisecond
+func shareOf(fraction float64, d time.Duration) time.Duration {
+	return time.Duration(fraction * float64(d)).Round(time.Millisecond)
+}
+
+// parseLocalPoint reads a timestamp or an amount like "2 minutes 30 seconds"
+func parseLocalPoint(s string) (time.Duration, bool) {
+	if strings.Contains(s, ":") {
+		d, err := video.ParseTimestamp(s)
+		return d, err == nil
+	}
+
+	var total time.Duration
+	for _, m := range localAmountRe.FindAllStringSubmatch(s, -1) {
+		n, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			return 0, false
+		}
+		unit := time.Second
+		switch {
+		case strings.HasPrefix(m[2], "h"):
+			unit = time.Hour
+		case strings.HasPrefix(m[2], "m"):
+			unit = time.Minute
+		}
+		total += time.Duration(n * float64(unit))
+	}
+	return total, true
+}
@@ -4,32 +4,134 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"capycut/llm"
+	"capycut/video"
+
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
 )
 
+// DefaultTemperature is the sampling temperature used for timestamp extraction
+const DefaultTemperature = 0.1
+
+// TimeoutEnvVar overrides the per-request HTTP timeout (a Go duration, e.g. "5m")
+const TimeoutEnvVar = "AI_TIMEOUT"
+
+// Sampling overrides for clip parsing; the --temperature and --top-p flags
+// set them, so every parser NewParser creates uses the same settings
+const (
+	TemperatureEnvVar = "AI_TEMPERATURE"
+	TopPEnvVar        = "AI_TOP_P"
+)
+
+// StreamEnvVar set to 1 streams answers from OpenAI-compatible servers,
+// so the text shows in progress updates (and with CAPYCUT_DEBUG, on
+// stdout) as it arrives
+const StreamEnvVar = "CAPYCUT_STREAM"
+
+// streamProgressInterval limits how often a streamed answer is reported,
+// so a fast server doesn't flood the progress callback
+const streamProgressInterval = 100 * time.Millisecond
+
+// Parse deadlines: a base per provider plus time for every started KB of
+// the prompt, so even a one-line request has room to write several clips
+const (
+	parseBaseTimeout      = 20 * time.Second
+	localParseBaseTimeout = 45 * time.Second // Room for a local model to load
+	parseTimeoutPerKB     = 10 * time.Second
+
+	// MaxParseTimeout caps the computed parse deadline for hosted providers
+	MaxParseTimeout = 60 * time.Second
+	// MaxLocalParseTimeout caps it for local models; it matches the local
+	// HTTP client's timeout, so a slow answer isn't cut off before it
+	MaxLocalParseTimeout = localClientTimeout
+
+	localClientTimeout = 120 * time.Second
+)
+
 // Provider type for LLM backend
-type Provider string
+type Provider = llm.Provider
 
 const (
-	ProviderAzure          Provider = "azure"
-	ProviderLocal          Provider = "local"           // OpenAI-compatible (LM Studio, Ollama, etc.)
-	ProviderAzureAnthropic Provider = "azure_anthropic" // Azure Anthropic (Claude via Azure)
+	ProviderAzure          = llm.ProviderAzureOpenAI
+	ProviderLocal          = llm.ProviderLocal          // OpenAI-compatible (LM Studio, Ollama, etc.)
+	ProviderAzureAnthropic = llm.ProviderAzureAnthropic // Azure Anthropic (Claude via Azure)
+	ProviderAnthropic      = llm.ProviderAnthropic      // Anthropic (api.anthropic.com or ANTHROPIC_BASE_URL)
+	ProviderOpenAI         = llm.ProviderOpenAI         // OpenAI (api.openai.com or OPENAI_BASE_URL)
 )
 
 // ClipRequest represents parsed clip parameters from natural language
 type ClipRequest struct {
-	StartTime string `json:"start_time"` // Format: HH:MM:SS
-	EndTime   string `json:"end_time"`   // Format: HH:MM:SS
-	Error     string `json:"error,omitempty"`
+	StartTime string `json:"start_time"`         // Format: HH:MM:SS or HH:MM:SS.mmm
+	EndTime   string `json:"end_time"`           // Format: HH:MM:SS or HH:MM:SS.mmm
+	Duration  string `json:"duration,omitempty"` // Clip length for start + duration requests; resolved into EndTime
+
+	// StartFromEnd and EndFromEnd are offsets back from the end of the video
+	// for requests like "last 2 minutes" or "until 30s before the end";
+	// they are resolved into StartTime and EndTime
+	StartFromEnd string `json:"start_from_end,omitempty"`
+	EndFromEnd   string `json:"end_from_end,omitempty"`
+
+	// StartPercent and EndPercent place either end at a share of the video
+	// (0-100) for requests like "the middle 50%" or "first third"; they are
+	// resolved into StartTime and EndTime
+	StartPercent *float64 `json:"start_percent,omitempty"`
+	EndPercent   *float64 `json:"end_percent,omitempty"`
+
+	Error string `json:"error,omitempty"`
+
+	// Warning notes an adjustment Validate made, such as clamping EndTime
+	// to the video length
+	Warning string `json:"-"`
+
+	// Local reports that ParseClipRequestLocal parsed the clip, without
+	// asking a provider
+	Local bool `json:"-"`
+}
+
+// Validate checks the range before it is cut: both times must parse, the
+// end must come after the start, and the clip must start inside the video.
+// An end past the video is clamped to its length and noted in Warning. A
+// zero duration skips the checks against the video length.
+func (c *ClipRequest) Validate(duration time.Duration) error {
+	start, err := video.ParseTimestamp(c.StartTime)
+	if err != nil || start < 0 {
+		return classify(ErrInvalidResponse, fmt.Errorf("invalid start time %q", c.StartTime))
+	}
+	end, err := video.ParseTimestamp(c.EndTime)
+	if err != nil || end < 0 {
+		return classify(ErrInvalidResponse, fmt.Errorf("invalid end time %q", c.EndTime))
+	}
+
+	if end < start {
+		return classify(ErrAmbiguousRequest, fmt.Errorf("the end time %s is before the start time %s", c.EndTime, c.StartTime))
+	}
+	if end == start {
+		return classify(ErrAmbiguousRequest, fmt.Errorf("the clip from %s to %s has no length", c.StartTime, c.EndTime))
+	}
+	if duration <= 0 {
+		return nil
+	}
+	if start >= duration {
+		return classify(ErrAmbiguousRequest, fmt.Errorf("the clip starts at %s, but the video is only %s long", c.StartTime, formatDuration(duration)))
+	}
+	if end > duration {
+		clamped := formatDuration(duration)
+		c.Warning = fmt.Sprintf("The end time %s is past the end of the video; clipping to %s instead", c.EndTime, clamped)
+		c.EndTime = clamped
+	}
+	return nil
 }
 
 // Parser handles AI-powered natural language parsing
@@ -40,7 +142,14 @@ type Parser struct {
 	model           string
 	apiVersion      string // Only used for Azure
 	client          *http.Client
-	anthropicClient *anthropic.Client // For Azure Anthropic
+	anthropicClient *anthropic.Client // For Anthropic and Azure Anthropic
+
+	// Sampling overrides (nil = default)
+	temperature *float64
+	topP        *float64
+
+	// setupErr is why a parser from NewLocalOnlyParser has no provider
+	setupErr error
 }
 
 // ParserProgressStatus represents the current status of parsing
@@ -98,6 +207,11 @@ type ParserProgressUpdate struct {
 	// Error contains any error that occurred
 	Error error
 
+	// Partial marks a ParserStatusWaitingResponse update from a streamed
+	// answer (see StreamEnvVar); Detail holds the answer received so far,
+	// so each one supersedes the last
+	Partial bool
+
 	// === Transparency fields for AI request/response logging ===
 
 	// RequestInfo contains details about the AI request being made
@@ -139,9 +253,13 @@ type ParserResponseInfo struct {
 	// RawResponse the raw response content (for transparency)
 	RawResponse string
 
-	// ParsedResult the parsed clip request result
+	// ParsedResult the parsed clip request result (the first clip when the
+	// request describes several)
 	ParsedResult *ClipRequest
 
+	// ParsedResults every clip the request describes
+	ParsedResults []*ClipRequest
+
 	// ErrorMessage if any
 	ErrorMessage string
 }
@@ -150,15 +268,9 @@ type ParserResponseInfo struct {
 type ParserProgressCallback func(update ParserProgressUpdate)
 
 // Common message type
-type message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
+type message = llm.TextMessage
 
-type apiError struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
-}
+type apiError = llm.APIError
 
 // ============================================
 // Azure OpenAI Responses API types
@@ -167,6 +279,8 @@ type azureRequest struct {
 	Model           string    `json:"model"`
 	Input           []message `json:"input"`
 	MaxOutputTokens int       `json:"max_output_tokens,omitempty"`
+	Temperature     *float64  `json:"temperature,omitempty"`
+	TopP            *float64  `json:"top_p,omitempty"`
 }
 
 type azureResponse struct {
@@ -195,118 +309,78 @@ type incompleteDetails struct {
 // ============================================
 // OpenAI-compatible API types (LM Studio, Ollama)
 // ============================================
-type openAIRequest struct {
-	Model       string    `json:"model"`
-	Messages    []message `json:"messages"`
-	MaxTokens   int       `json:"max_tokens,omitempty"`
-	Temperature float64   `json:"temperature,omitempty"`
-}
+type openAIRequest = llm.ChatRequest[message]
 
-type openAIResponse struct {
-	ID      string         `json:"id"`
-	Choices []openAIChoice `json:"choices"`
-	Error   *apiError      `json:"error,omitempty"`
-}
+type openAIResponse = llm.ChatResponse
 
-type openAIChoice struct {
-	Message      message `json:"message"`
-	FinishReason string  `json:"finish_reason"`
-}
+type openAIChoice = llm.ChatChoice
 
-// NewParser creates a new AI parser, auto-detecting backend from environment
+// NewParser creates a new AI parser for the provider LLM_PROVIDER names,
+// or else auto-detects the backend from the environment (see llm.RoleClip
+// for the order providers are tried in)
 func NewParser() (*Parser, error) {
-	debug := os.Getenv("CAPYCUT_DEBUG") != ""
-
-	// Check for local LLM first (LM Studio, Ollama)
-	localEndpoint := os.Getenv("LLM_ENDPOINT")
-	localModel := os.Getenv("LLM_MODEL")
-
-	if localEndpoint != "" {
-		// Default model for local LLMs
-		if localModel == "" {
-			localModel = "local-model"
-		}
-
-		localEndpoint = strings.TrimSuffix(localEndpoint, "/")
-
-		if debug {
-			fmt.Println("\n[DEBUG] Local LLM Configuration:")
-			fmt.Printf("  LLM_ENDPOINT: %s\n", localEndpoint)
-			fmt.Printf("  LLM_MODEL:    %s\n", localModel)
-			fmt.Printf("  API URL:      %s/v1/chat/completions\n", localEndpoint)
-			fmt.Println()
-		}
-
-		return &Parser{
-			provider: ProviderLocal,
-			endpoint: localEndpoint,
-			model:    localModel,
-			client:   &http.Client{Timeout: 120 * time.Second}, // Longer timeout for local models
-		}, nil
+	provider, err := llm.RoleClip.Select()
+	if err != nil {
+		return nil, err
 	}
-
-	// Check for Azure Anthropic (Claude via Azure)
-	azureAnthropicEndpoint := os.Getenv("AZURE_ANTHROPIC_ENDPOINT")
-	azureAnthropicAPIKey := os.Getenv("AZURE_ANTHROPIC_API_KEY")
-	azureAnthropicModel := os.Getenv("AZURE_ANTHROPIC_MODEL")
-
-	if azureAnthropicEndpoint != "" {
-		if azureAnthropicAPIKey == "" {
-			return nil, fmt.Errorf("AZURE_ANTHROPIC_API_KEY environment variable not set")
-		}
-		if azureAnthropicModel == "" {
-			azureAnthropicModel = "claude-sonnet-4-20250514" // Default to Claude Sonnet 4
-		}
-
-		azureAnthropicEndpoint = strings.TrimSuffix(azureAnthropicEndpoint, "/")
-
-		if debug {
-			fmt.Println("\n[DEBUG] Azure Anthropic Configuration:")
-			fmt.Printf("  AZURE_ANTHROPIC_ENDPOINT: %s\n", azureAnthropicEndpoint)
-			fmt.Printf("  AZURE_ANTHROPIC_API_KEY:  %s...%s\n", azureAnthropicAPIKey[:4], azureAnthropicAPIKey[len(azureAnthropicAPIKey)-4:])
-			fmt.Printf("  AZURE_ANTHROPIC_MODEL:    %s\n", azureAnthropicModel)
-			fmt.Println()
-		}
-
-		// Create Anthropic client with Azure endpoint
-		anthropicClient := anthropic.NewClient(
-			option.WithAPIKey(azureAnthropicAPIKey),
-			option.WithBaseURL(azureAnthropicEndpoint),
-		)
-
-		return &Parser{
-			provider:        ProviderAzureAnthropic,
-			endpoint:        azureAnthropicEndpoint,
-			apiKey:          azureAnthropicAPIKey,
-			model:           azureAnthropicModel,
-			anthropicClient: &anthropicClient,
-			client:          &http.Client{Timeout: 60 * time.Second},
-		}, nil
+	if provider == "" {
+		return nil, fmt.Errorf("no AI backend configured. Set LLM_ENDPOINT for local LLM, AZURE_ANTHROPIC_ENDPOINT for Azure Anthropic, AZURE_OPENAI_ENDPOINT for Azure OpenAI, OPENAI_API_KEY for OpenAI, or ANTHROPIC_API_KEY for Anthropic")
 	}
+	return NewParserWithProvider(provider)
+}
 
-	// Fall back to Azure OpenAI
-	endpoint := os.Getenv("AZURE_OPENAI_ENDPOINT")
-	apiKey := os.Getenv("AZURE_OPENAI_API_KEY")
-	model := os.Getenv("AZURE_OPENAI_MODEL")
-	apiVersion := os.Getenv("AZURE_OPENAI_API_VERSION")
+// NewLocalOnlyParser returns a parser for when NewParser fails with err. It
+// parses what ParseClipRequestLocal understands and fails with err for
+// descriptions that need a provider.
+func NewLocalOnlyParser(err error) *Parser {
+	return &Parser{setupErr: err}
+}
 
-	if endpoint == "" {
-		return nil, fmt.Errorf("no AI backend configured. Set LLM_ENDPOINT for local LLM, AZURE_ANTHROPIC_ENDPOINT for Azure Anthropic, or AZURE_OPENAI_ENDPOINT for Azure OpenAI")
+// newLocalParser creates a parser for an OpenAI-compatible local server
+func newLocalParser(cfg llm.Config, timeout time.Duration, transport http.RoundTripper, debug bool) *Parser {
+	if debug {
+		fmt.Println("\n[DEBUG] Local LLM Configuration:")
+		fmt.Printf("  LLM_ENDPOINT: %s\n", cfg.Endpoint)
+		fmt.Printf("  LLM_MODEL:    %s\n", cfg.Model)
+		fmt.Printf("  API URL:      %s\n", llm.ChatCompletionsURL(cfg.Endpoint))
+		fmt.Println()
 	}
-	if apiKey == "" {
-		return nil, fmt.Errorf("AZURE_OPENAI_API_KEY environment variable not set")
+
+	return &Parser{
+		provider: ProviderLocal,
+		endpoint: cfg.Endpoint,
+		model:    cfg.Model,
+		client:   newHTTPClient(timeout, localClientTimeout, transport), // Longer timeout for local models
 	}
-	if model == "" {
-		return nil, fmt.Errorf("AZURE_OPENAI_MODEL environment variable not set")
+}
+
+// newAzureAnthropicParser creates a parser for Claude through Azure
+func newAzureAnthropicParser(cfg llm.Config, timeout time.Duration, transport http.RoundTripper, debug bool) *Parser {
+	if debug {
+		fmt.Println("\n[DEBUG] Azure Anthropic Configuration:")
+		fmt.Printf("  AZURE_ANTHROPIC_ENDPOINT: %s\n", cfg.Endpoint)
+		fmt.Printf("  AZURE_ANTHROPIC_API_KEY:  %s...%s\n", cfg.APIKey[:min(4, len(cfg.APIKey))], cfg.APIKey[max(len(cfg.APIKey)-4, 0):])
+		fmt.Printf("  AZURE_ANTHROPIC_MODEL:    %s\n", cfg.Model)
+		fmt.Println()
 	}
 
-	if apiVersion == "" {
-		apiVersion = "2025-04-01-preview"
+	anthropicClient := anthropic.NewClient(anthropicClientOptions(cfg.APIKey, cfg.Endpoint, timeout, transport)...)
+
+	return &Parser{
+		provider:        ProviderAzureAnthropic,
+		endpoint:        cfg.Endpoint,
+		apiKey:          cfg.APIKey,
+		model:           cfg.Model,
+		anthropicClient: &anthropicClient,
+		client:          newHTTPClient(timeout, 60*time.Second, transport),
 	}
+}
 
-	// Parse and normalize endpoint
-	endpoint = strings.TrimSuffix(endpoint, "/")
-	parsedURL, err := url.Parse(endpoint)
+// newAzureParser creates a parser for the Azure OpenAI Responses API. Only
+// the scheme and host of the endpoint are kept, so a full deployment URL
+// copied from the portal works too.
+func newAzureParser(cfg llm.Config, timeout time.Duration, transport http.RoundTripper, debug bool) (*Parser, error) {
+	parsedURL, err := url.Parse(cfg.Endpoint)
 	if err != nil {
 		return nil, fmt.Errorf("invalid AZURE_OPENAI_ENDPOINT URL: %w", err)
 	}
@@ -314,25 +388,140 @@ func NewParser() (*Parser, error) {
 
 	if debug {
 		fmt.Println("\n[DEBUG] Azure OpenAI Configuration:")
-		fmt.Printf("  AZURE_OPENAI_ENDPOINT (raw):  %s\n", os.Getenv("AZURE_OPENAI_ENDPOINT"))
+		fmt.Printf("  AZURE_OPENAI_ENDPOINT (raw):  %s\n", cfg.Endpoint)
 		fmt.Printf("  AZURE_OPENAI_ENDPOINT (base): %s\n", baseURL)
-		fmt.Printf("  AZURE_OPENAI_API_KEY:         %s...%s\n", apiKey[:4], apiKey[len(apiKey)-4:])
-		fmt.Printf("  AZURE_OPENAI_MODEL:           %s\n", model)
-		fmt.Printf("  AZURE_OPENAI_API_VERSION:     %s\n", apiVersion)
-		fmt.Printf("  API URL:                      %s/openai/responses?api-version=%s\n", baseURL, apiVersion)
+		fmt.Printf("  AZURE_OPENAI_API_KEY:         %s...%s\n", cfg.APIKey[:min(4, len(cfg.APIKey))], cfg.APIKey[max(len(cfg.APIKey)-4, 0):])
+		fmt.Printf("  AZURE_OPENAI_MODEL:           %s\n", cfg.Model)
+		fmt.Printf("  AZURE_OPENAI_API_VERSION:     %s\n", cfg.APIVersion)
+		fmt.Printf("  API URL:                      %s/openai/responses?api-version=%s\n", baseURL, cfg.APIVersion)
 		fmt.Println()
 	}
 
 	return &Parser{
 		provider:   ProviderAzure,
 		endpoint:   baseURL,
-		apiKey:     apiKey,
-		model:      model,
-		apiVersion: apiVersion,
-		client:     &http.Client{Timeout: 30 * time.Second},
+		apiKey:     cfg.APIKey,
+		model:      cfg.Model,
+		apiVersion: cfg.APIVersion,
+		client:     newHTTPClient(timeout, 30*time.Second, transport),
 	}, nil
 }
 
+// newOpenAIParser creates a parser for the OpenAI chat completions API
+func newOpenAIParser(cfg llm.Config, timeout time.Duration, transport http.RoundTripper, debug bool) *Parser {
+	if debug {
+		fmt.Println("\n[DEBUG] OpenAI Configuration:")
+		fmt.Printf("  OPENAI_BASE_URL: %s\n", cfg.Endpoint)
+		fmt.Printf("  OPENAI_API_KEY:  %s...%s\n", cfg.APIKey[:min(4, len(cfg.APIKey))], cfg.APIKey[max(len(cfg.APIKey)-4, 0):])
+		fmt.Printf("  OPENAI_MODEL:    %s\n", cfg.Model)
+		fmt.Printf("  API URL:         %s\n", llm.ChatCompletionsURL(cfg.Endpoint))
+		fmt.Println()
+	}
+
+	return &Parser{
+		provider: ProviderOpenAI,
+		endpoint: cfg.Endpoint,
+		apiKey:   cfg.APIKey,
+		model:    cfg.Model,
+		client:   newHTTPClient(timeout, 30*time.Second, transport),
+	}
+}
+
+// newAnthropicParser creates a parser for the Anthropic Messages API
+func newAnthropicParser(cfg llm.Config, timeout time.Duration, transport http.RoundTripper, debug bool) *Parser {
+	if debug {
+		fmt.Println("\n[DEBUG] Anthropic Configuration:")
+		fmt.Printf("  ANTHROPIC_BASE_URL: %s\n", cfg.Endpoint)
+		fmt.Printf("  ANTHROPIC_API_KEY:  %s...%s\n", cfg.APIKey[:min(4, len(cfg.APIKey))], cfg.APIKey[max(len(cfg.APIKey)-4, 0):])
+		fmt.Printf("  ANTHROPIC_MODEL:    %s\n", cfg.Model)
+		fmt.Println()
+	}
+
+	anthropicClient := anthropic.NewClient(anthropicClientOptions(cfg.APIKey, cfg.Endpoint, timeout, transport)...)
+
+	return &Parser{
+		provider:        ProviderAnthropic,
+		endpoint:        cfg.Endpoint,
+		apiKey:          cfg.APIKey,
+		model:           cfg.Model,
+		anthropicClient: &anthropicClient,
+		client:          newHTTPClient(timeout, 60*time.Second, transport),
+	}
+}
+
+// ParseTimeout returns the deadline for parsing userInput: AI_TIMEOUT when
+// set, otherwise the provider's base plus parseTimeoutPerKB for every
+// started KB of the prompt, capped at MaxParseTimeout (MaxLocalParseTimeout
+// for local models)
+func (p *Parser) ParseTimeout(userInput string) time.Duration {
+	if timeout, err := timeoutFromEnv(); err == nil && timeout > 0 {
+		return timeout
+	}
+	base, limit := parseBaseTimeout, MaxParseTimeout
+	if p.provider == ProviderLocal {
+		base, limit = localParseBaseTimeout, MaxLocalParseTimeout
+	}
+	kb := (len(userInput) + 1023) / 1024
+	return min(base+time.Duration(kb)*parseTimeoutPerKB, limit)
+}
+
+// timeoutFromEnv reads AI_TIMEOUT; zero means use the provider default
+func timeoutFromEnv() (time.Duration, error) {
+	value := os.Getenv(TimeoutEnvVar)
+	if value == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: expected a positive duration like 90s or 5m", TimeoutEnvVar, value)
+	}
+	return timeout, nil
+}
+
+// samplingFromEnv reads AI_TEMPERATURE and AI_TOP_P; nil means not set
+func samplingFromEnv() (temperature, topP *float64, err error) {
+	if value := os.Getenv(TemperatureEnvVar); value != "" {
+		t, err := strconv.ParseFloat(value, 64)
+		if err != nil || t < 0 || t > 2 {
+			return nil, nil, fmt.Errorf("invalid %s %q: expected a number from 0 to 2", TemperatureEnvVar, value)
+		}
+		temperature = &t
+	}
+	if value := os.Getenv(TopPEnvVar); value != "" {
+		p, err := strconv.ParseFloat(value, 64)
+		if err != nil || p <= 0 || p > 1 {
+			return nil, nil, fmt.Errorf("invalid %s %q: expected a number above 0, up to 1", TopPEnvVar, value)
+		}
+		topP = &p
+	}
+	return temperature, topP, nil
+}
+
+// newHTTPClient returns an HTTP client using the override if set, else the
+// fallback; a nil transport keeps the default
+func newHTTPClient(override, fallback time.Duration, transport http.RoundTripper) *http.Client {
+	if override > 0 {
+		return &http.Client{Timeout: override, Transport: transport}
+	}
+	return &http.Client{Timeout: fallback, Transport: transport}
+}
+
+// anthropicClientOptions builds SDK options for an Anthropic or Azure
+// Anthropic endpoint
+func anthropicClientOptions(apiKey, endpoint string, timeout time.Duration, transport http.RoundTripper) []option.RequestOption {
+	opts := []option.RequestOption{
+		option.WithAPIKey(apiKey),
+		option.WithBaseURL(endpoint),
+	}
+	if timeout > 0 {
+		opts = append(opts, option.WithRequestTimeout(timeout))
+	}
+	if transport != nil {
+		opts = append(opts, option.WithHTTPClient(&http.Client{Transport: transport}))
+	}
+	return opts
+}
+
 // GetProvider returns the current provider
 func (p *Parser) GetProvider() Provider {
 	return p.provider
@@ -343,6 +532,70 @@ func (p *Parser) GetModel() string {
 	return p.model
 }
 
+// GetEndpoint returns the base URL requests are sent to
+func (p *Parser) GetEndpoint() string {
+	return p.endpoint
+}
+
+// SetTemperature overrides the sampling temperature (default 0.1)
+func (p *Parser) SetTemperature(temperature float64) {
+	p.temperature = &temperature
+}
+
+// SetTopP sets nucleus sampling (top_p); unset uses the provider default
+func (p *Parser) SetTopP(topP float64) {
+	p.topP = &topP
+}
+
+// requestTemperature returns the temperature requests carry. OpenAI-compatible
+// servers get DefaultTemperature unless it is overridden; Azure OpenAI and
+// Claude requests only carry an override, leaving the model's default.
+func (p *Parser) requestTemperature() *float64 {
+	if p.temperature != nil {
+		return p.temperature
+	}
+	switch p.provider {
+	case ProviderLocal, ProviderOpenAI:
+		return ptrFloat(DefaultTemperature)
+	default:
+		return nil
+	}
+}
+
+// samplingParameters returns the sampling settings requests carry, for
+// transparency output
+func (p *Parser) samplingParameters() map[string]string {
+	params := map[string]string{}
+	if temperature := p.requestTemperature(); temperature != nil {
+		params["temperature"] = fmt.Sprintf("%g", *temperature)
+	}
+	if p.topP != nil {
+		params["top_p"] = fmt.Sprintf("%g", *p.topP)
+	}
+	return params
+}
+
+// anthropicMessageParams builds Claude request params with sampling overrides applied
+func (p *Parser) anthropicMessageParams(systemPrompt, userInput string) anthropic.MessageNewParams {
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.Model(p.model),
+		MaxTokens: 1024,
+		System: []anthropic.TextBlockParam{
+			{Text: systemPrompt},
+		},
+		Messages: []anthropic.MessageParam{
+			anthropic.NewUserMessage(anthropic.NewTextBlock(userInput)),
+		},
+	}
+	if temperature := p.requestTemperature(); temperature != nil {
+		params.Temperature = anthropic.Float(*temperature)
+	}
+	if p.topP != nil {
+		params.TopP = anthropic.Float(*p.topP)
+	}
+	return params
+}
+
 // GetProviderDisplayName returns a user-friendly provider name
 func (p *Parser) GetProviderDisplayName() string {
 	switch p.provider {
@@ -352,6 +605,10 @@ func (p *Parser) GetProviderDisplayName() string {
 		return "Azure OpenAI"
 	case ProviderAzureAnthropic:
 		return "Azure Anthropic"
+	case ProviderAnthropic:
+		return "Anthropic"
+	case ProviderOpenAI:
+		return "OpenAI"
 	default:
 		return string(p.provider)
 	}
@@ -362,8 +619,46 @@ func (p *Parser) ParseClipRequest(ctx context.Context, userInput string, videoDu
 	return p.ParseClipRequestWithProgress(ctx, userInput, videoDuration, nil)
 }
 
-// ParseClipRequestWithProgress parses a clip request with progress callbacks
+// ParseClipRequestWithProgress parses a clip request with progress callbacks.
+// A description of several clips is an ErrAmbiguousRequest here; use
+// ParseClipRequestsWithProgress to get them all.
 func (p *Parser) ParseClipRequestWithProgress(ctx context.Context, userInput string, videoDuration time.Duration, onProgress ParserProgressCallback) (*ClipRequest, error) {
+	clips, err := p.ParseClipRequestsWithProgress(ctx, userInput, videoDuration, onProgress)
+	if err != nil {
+		return nil, err
+	}
+	if len(clips) > 1 {
+		return nil, classify(ErrAmbiguousRequest, fmt.Errorf("the request describes %d clips; describe one clip at a time here", len(clips)))
+	}
+	return clips[0], nil
+}
+
+// ParseClipRequests parses a natural language request for one or more
+// clips, e.g. "the first 2 minutes and the last 30 seconds"
+func (p *Parser) ParseClipRequests(ctx context.Context, userInput string, videoDuration time.Duration) ([]*ClipRequest, error) {
+	return p.ParseClipRequestsWithProgress(ctx, userInput, videoDuration, nil)
+}
+
+// ParseClipRequestsWithProgress parses a request for one or more clips
+// with progress callbacks. The clips come back in the order the request
+// gives them; it always returns at least one, and overlapping clips are an
+// ErrAmbiguousRequest.
+func (p *Parser) ParseClipRequestsWithProgress(ctx context.Context, userInput string, videoDuration time.Duration, onProgress ParserProgressCallback) ([]*ClipRequest, error) {
+	// Simple requests don't need the model
+	if clip, ok := ParseClipRequestLocal(userInput, videoDuration); ok {
+		p.sendProgress(onProgress, ParserProgressUpdate{
+			Status:   ParserStatusComplete,
+			Provider: string(p.provider),
+			Model:    p.model,
+			Message:  "Parsed without AI",
+			Detail:   fmt.Sprintf("Start: %s, End: %s", clip.StartTime, clip.EndTime),
+		})
+		return []*ClipRequest{clip}, nil
+	}
+	if p.setupErr != nil {
+		return nil, p.setupErr
+	}
+
 	// Send initial progress
 	p.sendProgress(onProgress, ParserProgressUpdate{
 		Status:   ParserStatusConnecting,
@@ -380,30 +675,67 @@ The video duration is: %s
 Your job is to extract start_time and end_time from the user's natural language request.
 
 IMPORTANT RULES:
-1. Output times in HH:MM:SS format (e.g., 00:03:00 for 3 minutes)
+1. Output times in HH:MM:SS format (e.g., 00:03:00 for 3 minutes). Fractional seconds are allowed as HH:MM:SS.mmm (e.g., 00:01:02.500) when the request needs sub-second precision
 2. If the user says "first X minutes/seconds", start_time is 00:00:00
-3. If the user says "last X minutes/seconds", calculate from the video duration
-4. If the user gives a duration from a start point, calculate the end_time
-5. Ensure end_time does not exceed the video duration
-6. If you cannot understand the request, set an error message
+3. If the user says "last X minutes/seconds", set "start_from_end" to X and leave start_time empty; the start is computed for you
+4. If the user gives a start point and a length, set "duration" to the length and leave end_time empty; the end is computed for you
+5. If the end is given relative to the end of the video ("until 30 seconds before the end", "stop 10s early"), set "end_from_end" to that offset and leave end_time empty
+6. Ensure end_time does not exceed the video duration
+7. If the user asks for a share of the video ("the middle 50%%", "first third", "from 10%% to 20%%"), set "start_percent" and "end_percent" to numbers from 0 to 100 and leave start_time and end_time empty; the times are computed for you
+8. If the user asks for several separate clips ("the first 2 minutes and the last 30 seconds"), or several ranges joined into one file ("minutes 1-2 and 5-6 into one file"), respond with a JSON array holding one object per clip or range, in the order asked
+9. If you cannot understand the request, set an error message
+
+EXAMPLES:
+- "from 3 minutes to 5 minutes 30 seconds" -> {"start_time": "00:03:00", "end_time": "00:05:30"}
+- "first 2 minutes" -> {"start_time": "00:00:00", "end_time": "00:02:00"}
+- "starting at 2:15, give me 45 seconds" -> {"start_time": "00:02:15", "end_time": "", "duration": "00:00:45"}
+- "start at 1:00 for 30 seconds" -> {"start_time": "00:01:00", "end_time": "", "duration": "00:00:30"}
+- "90 seconds from the 10 minute mark" -> {"start_time": "00:10:00", "end_time": "", "duration": "00:01:30"}
+- "last 45 seconds" -> {"start_time": "", "end_time": "", "start_from_end": "00:00:45"}
+- "from 5:00 until 30 seconds before the end" -> {"start_time": "00:05:00", "end_time": "", "end_from_end": "00:00:30"}
+- "last 2 minutes but stop 10s early" -> {"start_time": "", "end_time": "", "start_from_end": "00:02:00", "end_from_end": "00:00:10"}
+- "the middle 50%%" -> {"start_time": "", "end_time": "", "start_percent": 25, "end_percent": 75}
+- "the second quarter" -> {"start_time": "", "end_time": "", "start_percent": 25, "end_percent": 50}
+- "30 seconds starting at the halfway point" -> {"start_time": "", "end_time": "", "start_percent": 50, "duration": "00:00:30"}
+- "the first 2 minutes and the last 30 seconds" -> [{"start_time": "00:00:00", "end_time": "00:02:00"}, {"start_time": "", "end_time": "", "start_from_end": "00:00:30"}]
+- "clip minutes 1-2 and 5-6 into one file" -> [{"start_time": "00:01:00", "end_time": "00:02:00"}, {"start_time": "00:05:00", "end_time": "00:06:00"}]
 
 Respond ONLY with valid JSON in this exact format:
 {"start_time": "HH:MM:SS", "end_time": "HH:MM:SS"}
 
+Or for a start point plus a length:
+{"start_time": "HH:MM:SS", "end_time": "", "duration": "HH:MM:SS"}
+
+Or with either end measured back from the end of the video:
+{"start_time": "", "end_time": "", "start_from_end": "HH:MM:SS", "end_from_end": "HH:MM:SS"}
+
+Or with either end as a percentage of the video:
+{"start_time": "", "end_time": "", "start_percent": 0, "end_percent": 100}
+
+Or for several clips, an array of these objects:
+[{"start_time": "HH:MM:SS", "end_time": "HH:MM:SS"}, {"start_time": "HH:MM:SS", "end_time": "HH:MM:SS"}]
+
 Or if there's an error:
 {"start_time": "", "end_time": "", "error": "description of the problem"}`, formatDuration(videoDuration))
 
 	// Build endpoint URL for transparency (sanitized)
 	var endpoint string
 	switch p.provider {
-	case ProviderLocal:
-		endpoint = p.endpoint + "/v1/chat/completions"
+	case ProviderLocal, ProviderOpenAI:
+		endpoint = llm.ChatCompletionsURL(p.endpoint)
 	case ProviderAzure:
 		endpoint = p.endpoint + "/openai/responses"
-	case ProviderAzureAnthropic:
+	case ProviderAzureAnthropic, ProviderAnthropic:
 		endpoint = p.endpoint + "/v1/messages"
 	}
 
+	params := p.samplingParameters()
+	params["model"] = p.model
+	params["max_tokens"] = "512"
+	if deadline, ok := ctx.Deadline(); ok {
+		params["time_left"] = time.Until(deadline).Round(time.Second).String()
+	}
+
 	// Send progress: sending request with transparency details
 	p.sendProgress(onProgress, ParserProgressUpdate{
 		Status:   ParserStatusSendingRequest,
@@ -416,15 +748,11 @@ Or if there's an error:
 			Method:              "POST",
 			SystemPromptPreview: truncatePrompt(systemPrompt, 100),
 			UserInput:           userInput,
-			Parameters: map[string]string{
-				"model":       p.model,
-				"max_tokens":  "512",
-				"temperature": "0.1",
-			},
+			Parameters:          params,
 		},
 	})
 
-	var result *ClipRequest
+	var result []*ClipRequest
 	var err error
 	var rawResponse string
 	var statusCode int
@@ -440,7 +768,16 @@ Or if there's an error:
 			Message:  "Waiting for Local LLM response",
 			Detail:   "Model: " + p.model,
 		})
-		result, rawResponse, statusCode, statusText, err = p.parseWithOpenAITransparent(ctx, systemPrompt, userInput)
+		result, rawResponse, statusCode, statusText, err = p.parseWithOpenAITransparent(ctx, systemPrompt, userInput, onProgress, streamingEnabled())
+	case ProviderOpenAI:
+		p.sendProgress(onProgress, ParserProgressUpdate{
+			Status:   ParserStatusWaitingResponse,
+			Provider: string(p.provider),
+			Model:    p.model,
+			Message:  "Waiting for OpenAI response",
+			Detail:   "Model: " + p.model,
+		})
+		result, rawResponse, statusCode, statusText, err = p.parseWithOpenAITransparent(ctx, systemPrompt, userInput, onProgress, streamingEnabled())
 	case ProviderAzure:
 		p.sendProgress(onProgress, ParserProgressUpdate{
 			Status:   ParserStatusWaitingResponse,
@@ -450,7 +787,7 @@ Or if there's an error:
 			Detail:   "Model: " + p.model,
 		})
 		result, rawResponse, statusCode, statusText, err = p.parseWithAzureTransparent(ctx, systemPrompt, userInput)
-	case ProviderAzureAnthropic:
+	case ProviderAzureAnthropic, ProviderAnthropic:
 		p.sendProgress(onProgress, ParserProgressUpdate{
 			Status:   ParserStatusWaitingResponse,
 			Provider: string(p.provider),
@@ -484,6 +821,27 @@ Or if there's an error:
 		return nil, err
 	}
 
+	for _, clip := range result {
+		err = resolveRelativeTimes(clip, videoDuration)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = checkOverlaps(result)
+	}
+	if err != nil {
+		p.sendProgress(onProgress, ParserProgressUpdate{
+			Status:   ParserStatusError,
+			Provider: string(p.provider),
+			Model:    p.model,
+			Message:  "Invalid time range",
+			Detail:   err.Error(),
+			Error:    err,
+		})
+		return nil, err
+	}
+
 	// Send response received progress with transparency details
 	p.sendProgress(onProgress, ParserProgressUpdate{
 		Status:   ParserStatusParsingResponse,
@@ -492,267 +850,294 @@ Or if there's an error:
 		Message:  "Response received from " + p.GetProviderDisplayName(),
 		Detail:   fmt.Sprintf("Latency: %.2fs", latency.Seconds()),
 		ResponseInfo: &ParserResponseInfo{
-			StatusCode:   statusCode,
-			StatusText:   statusText,
-			Latency:      latency,
-			RawResponse:  truncatePrompt(rawResponse, 200),
-			ParsedResult: result,
+			StatusCode:    statusCode,
+			StatusText:    statusText,
+			Latency:       latency,
+			RawResponse:   truncatePrompt(rawResponse, 200),
+			ParsedResult:  result[0],
+			ParsedResults: result,
 		},
 	})
 
 	// Send completion progress
+	detail := fmt.Sprintf("Start: %s, End: %s", result[0].StartTime, result[0].EndTime)
+	if len(result) > 1 {
+		ranges := make([]string, len(result))
+		for i, clip := range result {
+			ranges[i] = clip.StartTime + "-" + clip.EndTime
+		}
+		detail = fmt.Sprintf("%d clips: %s", len(result), strings.Join(ranges, ", "))
+	}
 	p.sendProgress(onProgress, ParserProgressUpdate{
 		Status:   ParserStatusComplete,
 		Provider: string(p.provider),
 		Model:    p.model,
 		Message:  "Parsing complete",
-		Detail:   fmt.Sprintf("Start: %s, End: %s", result.StartTime, result.EndTime),
+		Detail:   detail,
 	})
 
 	return result, nil
 }
 
-// sendProgress sends a progress update if callback is configured
-func (p *Parser) sendProgress(onProgress ParserProgressCallback, update ParserProgressUpdate) {
-	if onProgress == nil {
-		return
+// decodeClipRequests reads a model answer: one clip object, or an array
+// with one object per requested clip
+func decodeClipRequests(content string) ([]*ClipRequest, error) {
+	if strings.HasPrefix(strings.TrimSpace(content), "[") {
+		var clips []*ClipRequest
+		if err := json.Unmarshal([]byte(content), &clips); err != nil {
+			return nil, err
+		}
+		return clips, nil
 	}
-	onProgress(update)
+	var clip ClipRequest
+	if err := json.Unmarshal([]byte(content), &clip); err != nil {
+		return nil, err
+	}
+	return []*ClipRequest{&clip}, nil
 }
 
-// parseWithOpenAI handles OpenAI-compatible APIs (LM Studio, Ollama, etc.)
-func (p *Parser) parseWithOpenAI(ctx context.Context, systemPrompt, userInput string) (*ClipRequest, error) {
-	debug := os.Getenv("CAPYCUT_DEBUG") != ""
-
-	reqBody := openAIRequest{
-		Model: p.model,
-		Messages: []message{
-			{Role: "system", Content: systemPrompt},
-			{Role: "user", Content: userInput},
-		},
-		MaxTokens:   512,
-		Temperature: 0.1,
+// checkClipRequests rejects a decoded answer that reports an error or
+// holds no clips
+func checkClipRequests(clips []*ClipRequest) error {
+	if len(clips) == 0 {
+		return classify(ErrAmbiguousRequest, errors.New("AI found no clips in the request"))
 	}
-
-	jsonBody, err := json.Marshal(reqBody)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	for _, clip := range clips {
+		if clip == nil {
+			return classify(ErrInvalidResponse, errors.New("AI response has an empty clip"))
+		}
+		if clip.Error != "" {
+			return classify(ErrAmbiguousRequest, fmt.Errorf("AI could not parse request: %s", clip.Error))
+		}
 	}
+	return nil
+}
 
-	apiURL := fmt.Sprintf("%s/v1/chat/completions", p.endpoint)
-
-	if debug {
-		fmt.Printf("[DEBUG] Request URL: %s\n", apiURL)
-		fmt.Printf("[DEBUG] Request body: %s\n\n", string(jsonBody))
+// checkOverlaps reports the first two clips whose ranges overlap. Clips
+// whose times don't parse are left for the caller's validation.
+func checkOverlaps(clips []*ClipRequest) error {
+	type span struct {
+		index      int
+		start, end time.Duration
+	}
+	var spans []span
+	for i, clip := range clips {
+		start, err1 := video.ParseTimestamp(clip.StartTime)
+		end, err2 := video.ParseTimestamp(clip.EndTime)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		spans = append(spans, span{i, start, end})
 	}
+	sort.Slice(spans, func(a, b int) bool { return spans[a].start < spans[b].start })
 
-	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	for i := 1; i < len(spans); i++ {
+		prev, cur := spans[i-1], spans[i]
+		if cur.start < prev.end {
+			first, second := clips[prev.index], clips[cur.index]
+			if cur.index < prev.index {
+				first, second = second, first
+				prev, cur = cur, prev
+			}
+			return classify(ErrAmbiguousRequest, fmt.Errorf("clips %d (%s-%s) and %d (%s-%s) overlap",
+				prev.index+1, first.StartTime, first.EndTime, cur.index+1, second.StartTime, second.EndTime))
+		}
 	}
+	return nil
+}
 
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := p.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("AI request failed (is the LLM server running?): %w", err)
+// resolveRelativeTimes turns the relative fields of a model answer into
+// StartTime and EndTime so the arithmetic isn't left to the model and is the
+// same for every provider: StartPercent and EndPercent are shares of the
+// video length, StartFromEnd and EndFromEnd count back from the end of the
+// video, and Duration counts forward from the start, capped at the video
+// length. EndFromEnd wins over Duration when both are set, a Duration with
+// an end of its own is ambiguous, and a clip with a relative start and no
+// end runs to the end of the video.
+func resolveRelativeTimes(req *ClipRequest, videoDuration time.Duration) error {
+	if req.StartFromEnd == "" && req.EndFromEnd == "" && req.Duration == "" && req.StartPercent == nil && req.EndPercent == nil {
+		return nil
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+	if req.Duration != "" && req.EndFromEnd == "" && (req.EndTime != "" || req.EndPercent != nil) {
+		return classify(ErrAmbiguousRequest, fmt.Errorf("the answer gives both an end and a duration (%s)", req.Duration))
 	}
-
-	if debug {
-		fmt.Printf("[DEBUG] Response status: %s\n", resp.Status)
-		fmt.Printf("[DEBUG] Response body: %s\n\n", string(body))
+	if (req.StartPercent != nil || req.EndPercent != nil) && videoDuration <= 0 {
+		return classify(ErrAmbiguousRequest, fmt.Errorf("percentages of the video need the video length, which is unknown"))
 	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("AI request failed: %s\n  URL: %s\n  Response: %s", resp.Status, apiURL, string(body))
+	if (req.StartFromEnd != "" || req.EndFromEnd != "") && videoDuration <= 0 {
+		return classify(ErrAmbiguousRequest, fmt.Errorf("times relative to the end need the video length, which is unknown"))
 	}
 
-	var apiResp openAIResponse
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return nil, fmt.Errorf("failed to parse API response: %w\nResponse was: %s", err, string(body))
+	if req.StartPercent != nil {
+		pct := *req.StartPercent
+		if !validPercent(pct) {
+			return classify(ErrInvalidResponse, fmt.Errorf("invalid start percentage %g: must be between 0 and 100", pct))
+		}
+		req.StartTime = formatDuration(shareOf(pct/100, videoDuration))
+		req.StartPercent = nil
+	}
+	if req.EndPercent != nil {
+		pct := *req.EndPercent
+		if !validPercent(pct) {
+			return classify(ErrInvalidResponse, fmt.Errorf("invalid end percentage %g: must be between 0 and 100", pct))
+		}
+		req.EndTime = formatDuration(shareOf(pct/100, videoDuration))
+		req.EndPercent = nil
 	}
 
-	if apiResp.Error != nil {
-		return nil, fmt.Errorf("API error: %s - %s", apiResp.Error.Code, apiResp.Error.Message)
+	if req.StartFromEnd != "" {
+		offset, err := video.ParseTimestamp(req.StartFromEnd)
+		if err != nil {
+			return classify(ErrInvalidResponse, fmt.Errorf("invalid start offset %q: %w", req.StartFromEnd, err))
+		}
+		// "Last 20 minutes" of a shorter video is the whole video
+		req.StartTime = formatDuration(max(videoDuration-offset, 0))
+		req.StartFromEnd = ""
 	}
 
-	if len(apiResp.Choices) == 0 {
-		return nil, fmt.Errorf("no choices in AI response")
+	start, err := video.ParseTimestamp(req.StartTime)
+	if err != nil {
+		return classify(ErrInvalidResponse, fmt.Errorf("invalid start time %q: %w", req.StartTime, err))
+	}
+	if videoDuration > 0 && start >= videoDuration {
+		return classify(ErrAmbiguousRequest, fmt.Errorf("start time %s is past the end of the video (%s)", req.StartTime, formatDuration(videoDuration)))
 	}
 
-	content := cleanJSONResponse(apiResp.Choices[0].Message.Content)
+	switch {
+	case req.EndFromEnd != "":
+		offset, err := video.ParseTimestamp(req.EndFromEnd)
+		if err != nil {
+			return classify(ErrInvalidResponse, fmt.Errorf("invalid end offset %q: %w", req.EndFromEnd, err))
+		}
+		end := videoDuration - offset
+		if end <= start {
+			return classify(ErrAmbiguousRequest, fmt.Errorf("stopping %s before the end (at %s) is not after the start (%s)", req.EndFromEnd, formatDuration(max(end, 0)), req.StartTime))
+		}
+		req.EndTime = formatDuration(end)
 
-	if debug {
-		fmt.Printf("[DEBUG] Extracted content: %q\n\n", content)
-	}
+	case req.Duration != "":
+		length, err := video.ParseTimestamp(req.Duration)
+		if err != nil {
+			return classify(ErrInvalidResponse, fmt.Errorf("invalid duration %q: %w", req.Duration, err))
+		}
+		if length <= 0 {
+			return classify(ErrAmbiguousRequest, fmt.Errorf("clip duration must be positive, got %q", req.Duration))
+		}
+		end := start + length
+		if videoDuration > 0 && end > videoDuration {
+			end = videoDuration
+		}
+		req.EndTime = formatDuration(end)
 
-	var clipReq ClipRequest
-	if err := json.Unmarshal([]byte(content), &clipReq); err != nil {
-		return nil, fmt.Errorf("failed to parse AI response: %w\nResponse was: %s", err, content)
+	case req.EndTime == "":
+		// "Last 45 seconds" runs to the end of the video
+		req.EndTime = formatDuration(videoDuration)
 	}
 
-	if clipReq.Error != "" {
-		return nil, fmt.Errorf("AI could not parse request: %s", clipReq.Error)
-	}
+	req.Duration = ""
+	req.EndFromEnd = ""
+	return nil
+}
+
+// validPercent reports whether pct is a share of the video, 0 to 100
+func validPercent(pct float64) bool {
+	return pct >= 0 && pct <= 100
+}
 
-	return &clipReq, nil
+// sendProgress sends a progress update if callback is configured
+func (p *Parser) sendProgress(onProgress ParserProgressCallback, update ParserProgressUpdate) {
+	if onProgress == nil {
+		return
+	}
+	onProgress(update)
 }
 
-// parseWithAzure handles Azure OpenAI Responses API
-func (p *Parser) parseWithAzure(ctx context.Context, systemPrompt, userInput string) (*ClipRequest, error) {
+// repairPrompt asks the model to turn malformed output into the expected JSON
+const repairPrompt = `The following text was supposed to be valid JSON but failed to parse.
+Fix it into valid JSON matching exactly this shape:
+{"start_time": "HH:MM:SS", "end_time": "HH:MM:SS"}
+(seconds may carry milliseconds as HH:MM:SS.mmm) or, if it describes an error:
+{"start_time": "", "end_time": "", "error": "description of the problem"}
+Keep any "duration", "start_from_end" or "end_from_end" fields it has. If it
+holds several clips, keep them as a JSON array of such objects.
+
+Remove comments, trailing commas and any surrounding text. Respond ONLY with the JSON.`
+
+// repairClipJSON sends malformed model output back once with a repair
+// instruction. The result is not repaired again if it still fails to parse.
+// The repair gets a deadline of its own (ParseTimeout of the broken output),
+// since the first answer may have used up most of the parse deadline;
+// cancelling ctx still stops it.
+func (p *Parser) repairClipJSON(ctx context.Context, broken string) ([]*ClipRequest, error) {
 	debug := os.Getenv("CAPYCUT_DEBUG") != ""
 
-	reqBody := azureRequest{
+	ctx, cancel := repairContext(ctx, p.ParseTimeout(broken))
+	defer cancel()
+
+	reqBody := openAIRequest{
 		Model: p.model,
-		Input: []message{
-			{Role: "system", Content: systemPrompt},
-			{Role: "user", Content: userInput},
+		Messages: []message{
+			{Role: "system", Content: repairPrompt},
+			{Role: "user", Content: broken},
 		},
-		MaxOutputTokens: 2048,
+		MaxTokens:   512,
+		Temperature: ptrFloat(0),
 	}
 
 	jsonBody, err := json.Marshal(reqBody)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return nil, fmt.Errorf("failed to marshal repair request: %w", err)
 	}
 
-	apiURL := fmt.Sprintf("%s/openai/responses?api-version=%s", p.endpoint, p.apiVersion)
-
 	if debug {
-		fmt.Printf("[DEBUG] Request URL: %s\n", apiURL)
+		fmt.Printf("[DEBUG] Requesting JSON repair for: %q\n\n", broken)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(jsonBody))
+	resp, body, err := llm.PostChat(ctx, p.client, p.endpoint, p.apiKey, jsonBody)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+p.apiKey)
-
-	resp, err := p.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("AI request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, fmt.Errorf("repair request failed: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		if debug {
-			fmt.Printf("\n[DEBUG] Request failed:\n")
-			fmt.Printf("  URL:      %s\n", apiURL)
-			fmt.Printf("  Status:   %s\n", resp.Status)
-			fmt.Printf("  Response: %s\n\n", string(body))
-		}
-		return nil, fmt.Errorf("AI request failed: %s\n  URL: %s\n  Response: %s", resp.Status, apiURL, string(body))
+		return nil, fmt.Errorf("repair request failed: %s", resp.Status)
 	}
 
-	if debug {
-		fmt.Printf("\n[DEBUG] Raw API Response:\n%s\n\n", string(body))
-	}
-
-	var apiResp azureResponse
+	var apiResp openAIResponse
 	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return nil, fmt.Errorf("failed to parse API response: %w\nResponse was: %s", err, string(body))
-	}
-
-	if apiResp.Error != nil {
-		return nil, fmt.Errorf("API error: %s - %s", apiResp.Error.Code, apiResp.Error.Message)
+		return nil, fmt.Errorf("failed to parse repair response: %w", err)
 	}
 
-	content := extractAzureContent(apiResp)
-	if debug {
-		fmt.Printf("[DEBUG] Extracted content: %q\n\n", content)
-	}
-	if content == "" {
-		return nil, fmt.Errorf("no content in AI response\nFull response: %s", string(body))
-	}
-
-	content = cleanJSONResponse(content)
-
-	var clipReq ClipRequest
-	if err := json.Unmarshal([]byte(content), &clipReq); err != nil {
-		return nil, fmt.Errorf("failed to parse AI response: %w\nResponse was: %s", err, content)
-	}
-
-	if clipReq.Error != "" {
-		return nil, fmt.Errorf("AI could not parse request: %s", clipReq.Error)
+	if len(apiResp.Choices) == 0 {
+		return nil, fmt.Errorf("no choices in repair response")
 	}
 
-	return &clipReq, nil
-}
-
-// parseWithAzureAnthropic handles Azure Anthropic (Claude) API
-func (p *Parser) parseWithAzureAnthropic(ctx context.Context, systemPrompt, userInput string) (*ClipRequest, error) {
-	debug := os.Getenv("CAPYCUT_DEBUG") != ""
-
-	if p.anthropicClient == nil {
-		return nil, fmt.Errorf("Anthropic client not initialized")
-	}
+	content := llm.CleanJSON(apiResp.Choices[0].Message.Content)
 
 	if debug {
-		fmt.Printf("[DEBUG] Azure Anthropic request to model: %s\n", p.model)
+		fmt.Printf("[DEBUG] Repaired content: %q\n\n", content)
 	}
 
-	// Create the message request
-	message, err := p.anthropicClient.Messages.New(ctx, anthropic.MessageNewParams{
-		Model:     anthropic.Model(p.model),
-		MaxTokens: 1024,
-		System: []anthropic.TextBlockParam{
-			{Text: systemPrompt},
-		},
-		Messages: []anthropic.MessageParam{
-			anthropic.NewUserMessage(anthropic.NewTextBlock(userInput)),
-		},
-	})
+	clips, err := decodeClipRequests(content)
 	if err != nil {
-		return nil, fmt.Errorf("Azure Anthropic request failed: %w", err)
+		return nil, fmt.Errorf("repaired response is still invalid JSON: %w", err)
 	}
 
-	if debug {
-		fmt.Printf("[DEBUG] Azure Anthropic response: %+v\n", message)
-	}
+	return clips, nil
+}
 
-	// Extract text content from response
-	var content string
-	for _, block := range message.Content {
-		switch b := block.AsAny().(type) {
-		case anthropic.TextBlock:
-			content = b.Text
-			break
+// repairContext returns a context with its own timeout that is cancelled
+// along with parent, but doesn't inherit parent's deadline
+func repairContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(parent), timeout)
+	stop := context.AfterFunc(parent, func() {
+		if errors.Is(parent.Err(), context.Canceled) {
+			cancel()
 		}
+	})
+	return ctx, func() {
+		stop()
+		cancel()
 	}
-
-	if content == "" {
-		return nil, fmt.Errorf("no content in Azure Anthropic response")
-	}
-
-	if debug {
-		fmt.Printf("[DEBUG] Extracted content: %q\n\n", content)
-	}
-
-	content = cleanJSONResponse(content)
-
-	var clipReq ClipRequest
-	if err := json.Unmarshal([]byte(content), &clipReq); err != nil {
-		return nil, fmt.Errorf("failed to parse AI response: %w\nResponse was: %s", err, content)
-	}
-
-	if clipReq.Error != "" {
-		return nil, fmt.Errorf("AI could not parse request: %s", clipReq.Error)
-	}
-
-	return &clipReq, nil
 }
 
 // extractAzureContent extracts the text content from Azure API response
@@ -769,23 +1154,22 @@ func extractAzureContent(resp azureResponse) string {
 	return ""
 }
 
-// cleanJSONResponse removes markdown code blocks if present
-func cleanJSONResponse(s string) string {
-	s = strings.TrimSpace(s)
-	s = strings.TrimPrefix(s, "```json")
-	s = strings.TrimPrefix(s, "```")
-	s = strings.TrimSuffix(s, "```")
-	return strings.TrimSpace(s)
-}
-
-// formatDuration formats a duration as HH:MM:SS
+// formatDuration formats a duration as HH:MM:SS, adding .mmm when there are milliseconds
 func formatDuration(d time.Duration) string {
 	h := int(d.Hours())
 	m := int(d.Minutes()) % 60
 	s := int(d.Seconds()) % 60
+	if ms := d.Milliseconds() % 1000; ms > 0 {
+		return fmt.Sprintf("%02d:%02d:%02d.%03d", h, m, s, ms)
+	}
 	return fmt.Sprintf("%02d:%02d:%02d", h, m, s)
 }
 
+// ptrFloat returns a pointer to f
+func ptrFloat(f float64) *float64 {
+	return &f
+}
+
 // truncatePrompt truncates a prompt string to maxLen characters
 func truncatePrompt(s string, maxLen int) string {
 	// Remove newlines for preview
@@ -816,67 +1200,49 @@ Option 1: Local LLM (FREE - no API key needed!)
     3. Set: export LLM_ENDPOINT="http://localhost:11434"
            export LLM_MODEL="llama3.2"
 
-Option 2: Azure Anthropic (Claude)
+Option 2: Azure OpenAI
+  export AZURE_OPENAI_ENDPOINT="https://your-resource.cognitiveservices.azure.com"
+  export AZURE_OPENAI_API_KEY="your-api-key"
+  export AZURE_OPENAI_MODEL="gpt-4o"
+
+Option 3: OpenAI
+  export OPENAI_API_KEY="sk-..."
+  export OPENAI_MODEL="gpt-4o-mini"  # Optional, defaults to gpt-4o-mini
+  export OPENAI_BASE_URL="https://api.openai.com"  # Optional, for proxies and gateways
+
+Option 4: Azure Anthropic (Claude)
   export AZURE_ANTHROPIC_ENDPOINT="https://your-resource.services.ai.azure.com"
   export AZURE_ANTHROPIC_API_KEY="your-api-key"
   export AZURE_ANTHROPIC_MODEL="claude-sonnet-4-20250514"  # Optional, defaults to claude-sonnet-4
 
-Option 3: Azure OpenAI
-  export AZURE_OPENAI_ENDPOINT="https://your-resource.cognitiveservices.azure.com"
-  export AZURE_OPENAI_API_KEY="your-api-key"
-  export AZURE_OPENAI_MODEL="gpt-4o"
+Option 5: Anthropic (Claude)
+  export ANTHROPIC_API_KEY="sk-ant-..."
+  export ANTHROPIC_MODEL="claude-sonnet-4-20250514"  # Optional, defaults to claude-sonnet-4
+
+With several configured, set LLM_PROVIDER (or --provider) to pick one.
 
 Or create a .env file with these values.`
 }
 
 // CheckConfig validates that an AI backend is configured
 func CheckConfig() error {
-	// Check for local LLM first
-	if os.Getenv("LLM_ENDPOINT") != "" {
-		return nil // Local LLM configured, no API key needed
-	}
-
-	// Check Azure Anthropic config
-	if os.Getenv("AZURE_ANTHROPIC_ENDPOINT") != "" {
-		if os.Getenv("AZURE_ANTHROPIC_API_KEY") == "" {
-			return fmt.Errorf("AZURE_ANTHROPIC_API_KEY not set")
-		}
-		return nil // Azure Anthropic configured
+	provider, err := llm.RoleClip.Select()
+	if err != nil {
+		return err
 	}
-
-	// Check Azure OpenAI config
-	if os.Getenv("AZURE_OPENAI_ENDPOINT") == "" {
+	if provider == "" {
 		return fmt.Errorf("no AI backend configured")
 	}
-	if os.Getenv("AZURE_OPENAI_API_KEY") == "" {
-		return fmt.Errorf("AZURE_OPENAI_API_KEY not set")
-	}
-	if os.Getenv("AZURE_OPENAI_MODEL") == "" {
-		return fmt.Errorf("AZURE_OPENAI_MODEL not set")
+	if missing := llm.RoleClip.Missing(provider); missing != "" {
+		return fmt.Errorf("%s not set", missing)
 	}
 	return nil
 }
 
-// GetAvailableProviders returns a list of configured providers
+// GetAvailableProviders returns a list of configured providers, in the
+// order NewParser tries them
 func GetAvailableProviders() []Provider {
-	var providers []Provider
-
-	// Check for local LLM
-	if os.Getenv("LLM_ENDPOINT") != "" {
-		providers = append(providers, ProviderLocal)
-	}
-
-	// Check for Azure Anthropic
-	if os.Getenv("AZURE_ANTHROPIC_ENDPOINT") != "" && os.Getenv("AZURE_ANTHROPIC_API_KEY") != "" {
-		providers = append(providers, ProviderAzureAnthropic)
-	}
-
-	// Check for Azure OpenAI
-	if os.Getenv("AZURE_OPENAI_ENDPOINT") != "" && os.Getenv("AZURE_OPENAI_API_KEY") != "" && os.Getenv("AZURE_OPENAI_MODEL") != "" {
-		providers = append(providers, ProviderAzure)
-	}
-
-	return providers
+	return llm.RoleClip.Available()
 }
 
 // GetProviderDisplayNameStatic returns a user-friendly provider name for a given provider
@@ -892,6 +1258,10 @@ func GetProviderDisplayNameStatic(p Provider) string {
 		return "Azure OpenAI"
 	case ProviderAzureAnthropic:
 		return "Azure Anthropic (Claude)"
+	case ProviderAnthropic:
+		return "Anthropic (Claude)"
+	case ProviderOpenAI:
+		return "OpenAI"
 	default:
 		return string(p)
 	}
@@ -901,129 +1271,55 @@ func GetProviderDisplayNameStatic(p Provider) string {
 func NewParserWithProvider(provider Provider) (*Parser, error) {
 	debug := os.Getenv("CAPYCUT_DEBUG") != ""
 
-	switch provider {
-	case ProviderLocal:
-		localEndpoint := os.Getenv("LLM_ENDPOINT")
-		localModel := os.Getenv("LLM_MODEL")
-
-		if localEndpoint == "" {
-			return nil, fmt.Errorf("LLM_ENDPOINT environment variable not set for local LLM")
-		}
-
-		if localModel == "" {
-			localModel = "local-model"
-		}
-
-		localEndpoint = strings.TrimSuffix(localEndpoint, "/")
+	if !llm.RoleClip.Supports(provider) {
+		return nil, fmt.Errorf("unknown provider: %s", provider)
+	}
+	if missing := llm.RoleClip.Missing(provider); missing != "" {
+		return nil, fmt.Errorf("%s environment variable not set", missing)
+	}
 
-		if debug {
-			fmt.Println("\n[DEBUG] Local LLM Configuration:")
-			fmt.Printf("  LLM_ENDPOINT: %s\n", localEndpoint)
-			fmt.Printf("  LLM_MODEL:    %s\n", localModel)
-			fmt.Printf("  API URL:      %s/v1/chat/completions\n", localEndpoint)
-			fmt.Println()
-		}
+	timeout, err := timeoutFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	transport, err := llm.TransportFromEnv()
+	if err != nil {
+		return nil, err
+	}
 
-		return &Parser{
-			provider: ProviderLocal,
-			endpoint: localEndpoint,
-			model:    localModel,
-			client:   &http.Client{Timeout: 120 * time.Second},
-		}, nil
+	temperature, topP, err := samplingFromEnv()
+	if err != nil {
+		return nil, err
+	}
 
+	var p *Parser
+	switch provider {
+	case ProviderLocal:
+		p = newLocalParser(llm.LocalFromEnv([]string{"LLM_ENDPOINT"}, []string{"LLM_MODEL"}), timeout, transport, debug)
 	case ProviderAzureAnthropic:
-		azureAnthropicEndpoint := os.Getenv("AZURE_ANTHROPIC_ENDPOINT")
-		azureAnthropicAPIKey := os.Getenv("AZURE_ANTHROPIC_API_KEY")
-		azureAnthropicModel := os.Getenv("AZURE_ANTHROPIC_MODEL")
-
-		if azureAnthropicEndpoint == "" {
-			return nil, fmt.Errorf("AZURE_ANTHROPIC_ENDPOINT environment variable not set")
-		}
-		if azureAnthropicAPIKey == "" {
-			return nil, fmt.Errorf("AZURE_ANTHROPIC_API_KEY environment variable not set")
-		}
-		if azureAnthropicModel == "" {
-			azureAnthropicModel = "claude-sonnet-4-20250514"
-		}
-
-		azureAnthropicEndpoint = strings.TrimSuffix(azureAnthropicEndpoint, "/")
-
-		if debug {
-			fmt.Println("\n[DEBUG] Azure Anthropic Configuration:")
-			fmt.Printf("  AZURE_ANTHROPIC_ENDPOINT: %s\n", azureAnthropicEndpoint)
-			fmt.Printf("  AZURE_ANTHROPIC_API_KEY:  %s...%s\n", azureAnthropicAPIKey[:4], azureAnthropicAPIKey[len(azureAnthropicAPIKey)-4:])
-			fmt.Printf("  AZURE_ANTHROPIC_MODEL:    %s\n", azureAnthropicModel)
-			fmt.Println()
-		}
-
-		anthropicClient := anthropic.NewClient(
-			option.WithAPIKey(azureAnthropicAPIKey),
-			option.WithBaseURL(azureAnthropicEndpoint),
-		)
-
-		return &Parser{
-			provider:        ProviderAzureAnthropic,
-			endpoint:        azureAnthropicEndpoint,
-			apiKey:          azureAnthropicAPIKey,
-			model:           azureAnthropicModel,
-			anthropicClient: &anthropicClient,
-			client:          &http.Client{Timeout: 60 * time.Second},
-		}, nil
-
+		p = newAzureAnthropicParser(llm.AzureAnthropicFromEnv(), timeout, transport, debug)
+	case ProviderAnthropic:
+		p = newAnthropicParser(llm.AnthropicFromEnv(), timeout, transport, debug)
+	case ProviderOpenAI:
+		p = newOpenAIParser(llm.OpenAIFromEnv(), timeout, transport, debug)
 	case ProviderAzure:
-		endpoint := os.Getenv("AZURE_OPENAI_ENDPOINT")
-		apiKey := os.Getenv("AZURE_OPENAI_API_KEY")
-		model := os.Getenv("AZURE_OPENAI_MODEL")
-		apiVersion := os.Getenv("AZURE_OPENAI_API_VERSION")
-
-		if endpoint == "" {
-			return nil, fmt.Errorf("AZURE_OPENAI_ENDPOINT environment variable not set")
-		}
-		if apiKey == "" {
-			return nil, fmt.Errorf("AZURE_OPENAI_API_KEY environment variable not set")
-		}
-		if model == "" {
-			return nil, fmt.Errorf("AZURE_OPENAI_MODEL environment variable not set")
-		}
-
-		if apiVersion == "" {
-			apiVersion = "2025-04-01-preview"
+		if p, err = newAzureParser(llm.AzureOpenAIFromEnv(), timeout, transport, debug); err != nil {
+			return nil, err
 		}
-
-		endpoint = strings.TrimSuffix(endpoint, "/")
-		parsedURL, err := url.Parse(endpoint)
-		if err != nil {
-			return nil, fmt.Errorf("invalid AZURE_OPENAI_ENDPOINT URL: %w", err)
-		}
-		baseURL := fmt.Sprintf("%s://%s", parsedURL.Scheme, parsedURL.Host)
-
-		if debug {
-			fmt.Println("\n[DEBUG] Azure OpenAI Configuration:")
-			fmt.Printf("  AZURE_OPENAI_ENDPOINT (raw):  %s\n", os.Getenv("AZURE_OPENAI_ENDPOINT"))
-			fmt.Printf("  AZURE_OPENAI_ENDPOINT (base): %s\n", baseURL)
-			fmt.Printf("  AZURE_OPENAI_API_KEY:         %s...%s\n", apiKey[:4], apiKey[len(apiKey)-4:])
-			fmt.Printf("  AZURE_OPENAI_MODEL:           %s\n", model)
-			fmt.Printf("  AZURE_OPENAI_API_VERSION:     %s\n", apiVersion)
-			fmt.Printf("  API URL:                      %s/openai/responses?api-version=%s\n", baseURL, apiVersion)
-			fmt.Println()
-		}
-
-		return &Parser{
-			provider:   ProviderAzure,
-			endpoint:   baseURL,
-			apiKey:     apiKey,
-			model:      model,
-			apiVersion: apiVersion,
-			client:     &http.Client{Timeout: 30 * time.Second},
-		}, nil
-
 	default:
 		return nil, fmt.Errorf("unknown provider: %s", provider)
 	}
+	p.temperature, p.topP = temperature, topP
+	return p, nil
 }
 
-// parseWithOpenAITransparent handles OpenAI-compatible APIs with transparency info
-func (p *Parser) parseWithOpenAITransparent(ctx context.Context, systemPrompt, userInput string) (*ClipRequest, string, int, string, error) {
+// parseWithOpenAITransparent handles OpenAI-compatible APIs with transparency
+// info. With stream set it asks for "stream": true and reports each piece of
+// the answer through onProgress as it arrives (see readStreamedAnswer); the
+// raw response returned is then the assembled answer rather than the event
+// stream. A server that ignores stream and sends a single JSON response is
+// handled the same as without it.
+func (p *Parser) parseWithOpenAITransparent(ctx context.Context, systemPrompt, userInput string, onProgress ParserProgressCallback, stream bool) ([]*ClipRequest, string, int, string, error) {
 	debug := os.Getenv("CAPYCUT_DEBUG") != ""
 
 	reqBody := openAIRequest{
@@ -1033,7 +1329,9 @@ func (p *Parser) parseWithOpenAITransparent(ctx context.Context, systemPrompt, u
 			{Role: "user", Content: userInput},
 		},
 		MaxTokens:   512,
-		Temperature: 0.1,
+		Temperature: p.requestTemperature(),
+		TopP:        p.topP,
+		Stream:      stream,
 	}
 
 	jsonBody, err := json.Marshal(reqBody)
@@ -1041,75 +1339,141 @@ func (p *Parser) parseWithOpenAITransparent(ctx context.Context, systemPrompt, u
 		return nil, "", 0, "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	apiURL := fmt.Sprintf("%s/v1/chat/completions", p.endpoint)
+	apiURL := llm.ChatCompletionsURL(p.endpoint)
 
 	if debug {
 		fmt.Printf("[DEBUG] Request URL: %s\n", apiURL)
 		fmt.Printf("[DEBUG] Request body: %s\n\n", string(jsonBody))
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(jsonBody))
+	req, err := llm.NewChatRequest(ctx, p.endpoint, p.apiKey, jsonBody)
 	if err != nil {
-		return nil, "", 0, "", fmt.Errorf("failed to create request: %w", err)
+		return nil, "", 0, "", err
+	}
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
 	}
-
-	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := p.client.Do(req)
 	if err != nil {
-		return nil, "", 0, "", fmt.Errorf("AI request failed (is the LLM server running?): %w", err)
+		return nil, "", 0, "", classify(ErrProviderUnreachable, fmt.Errorf("AI request failed (is the LLM server running?): %w", err))
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, "", resp.StatusCode, resp.Status, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	rawResponse := string(body)
-
 	if debug {
 		fmt.Printf("[DEBUG] Response status: %s\n", resp.Status)
-		fmt.Printf("[DEBUG] Response body: %s\n\n", rawResponse)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, rawResponse, resp.StatusCode, resp.Status, fmt.Errorf("AI request failed: %s\n  URL: %s\n  Response: %s", resp.Status, apiURL, rawResponse)
-	}
+	var content, rawResponse string
+	if stream && resp.StatusCode == http.StatusOK && strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		content, err = p.readStreamedAnswer(resp.Body, onProgress)
+		rawResponse = content
+		if err != nil {
+			return nil, rawResponse, resp.StatusCode, resp.Status, err
+		}
+	} else {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, "", resp.StatusCode, resp.Status, fmt.Errorf("failed to read response: %w", err)
+		}
+		rawResponse = string(body)
 
-	var apiResp openAIResponse
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return nil, rawResponse, resp.StatusCode, resp.Status, fmt.Errorf("failed to parse API response: %w\nResponse was: %s", err, rawResponse)
-	}
+		if debug {
+			fmt.Printf("[DEBUG] Response body: %s\n\n", rawResponse)
+		}
 
-	if apiResp.Error != nil {
-		return nil, rawResponse, resp.StatusCode, resp.Status, fmt.Errorf("API error: %s - %s", apiResp.Error.Code, apiResp.Error.Message)
-	}
+		if resp.StatusCode != http.StatusOK {
+			return nil, rawResponse, resp.StatusCode, resp.Status, &ProviderError{StatusCode: resp.StatusCode, Status: resp.Status, URL: apiURL, Body: rawResponse}
+		}
 
-	if len(apiResp.Choices) == 0 {
-		return nil, rawResponse, resp.StatusCode, resp.Status, fmt.Errorf("no choices in AI response")
+		var apiResp openAIResponse
+		if err := json.Unmarshal(body, &apiResp); err != nil {
+			return nil, rawResponse, resp.StatusCode, resp.Status, classify(ErrInvalidResponse, fmt.Errorf("failed to parse API response: %w\nResponse was: %s", err, rawResponse))
+		}
+		if apiResp.Error != nil {
+			return nil, rawResponse, resp.StatusCode, resp.Status, fmt.Errorf("API error: %s - %s", apiResp.Error.Code, apiResp.Error.Message)
+		}
+		if len(apiResp.Choices) == 0 {
+			return nil, rawResponse, resp.StatusCode, resp.Status, classify(ErrInvalidResponse, errors.New("no choices in AI response"))
+		}
+		content = apiResp.Choices[0].Message.Content
 	}
 
-	content := cleanJSONResponse(apiResp.Choices[0].Message.Content)
+	content = llm.CleanJSON(content)
 
 	if debug {
 		fmt.Printf("[DEBUG] Extracted content: %q\n\n", content)
 	}
 
-	var clipReq ClipRequest
-	if err := json.Unmarshal([]byte(content), &clipReq); err != nil {
-		return nil, rawResponse, resp.StatusCode, resp.Status, fmt.Errorf("failed to parse AI response: %w\nResponse was: %s", err, content)
+	clips, err := decodeClipRequests(content)
+	if err != nil {
+		// Small local models often return almost-JSON; ask once for a fixed version
+		repaired, repairErr := p.repairClipJSON(ctx, content)
+		if repairErr != nil {
+			return nil, rawResponse, resp.StatusCode, resp.Status, classify(ErrInvalidResponse, fmt.Errorf("failed to parse AI response: %w\nResponse was: %s", err, content))
+		}
+		clips = repaired
+	}
+
+	if err := checkClipRequests(clips); err != nil {
+		return nil, rawResponse, resp.StatusCode, resp.Status, err
 	}
 
-	if clipReq.Error != "" {
-		return nil, rawResponse, resp.StatusCode, resp.Status, fmt.Errorf("AI could not parse request: %s", clipReq.Error)
+	return clips, rawResponse, resp.StatusCode, resp.Status, nil
+}
+
+// streamingEnabled reports whether StreamEnvVar asks for streamed answers
+func streamingEnabled() bool {
+	return os.Getenv(StreamEnvVar) == "1"
+}
+
+// readStreamedAnswer assembles a streamed chat answer, reporting it through
+// onProgress as a Partial ParserStatusWaitingResponse update at most every
+// streamProgressInterval and once more at the end
+func (p *Parser) readStreamedAnswer(body io.Reader, onProgress ParserProgressCallback) (string, error) {
+	debug := os.Getenv("CAPYCUT_DEBUG") != ""
+
+	if debug {
+		fmt.Print("[DEBUG] Streamed content: ")
+	}
+	var received strings.Builder
+	var lastSent time.Time
+	report := func() {
+		p.sendProgress(onProgress, ParserProgressUpdate{
+			Status:   ParserStatusWaitingResponse,
+			Provider: string(p.provider),
+			Model:    p.model,
+			Message:  fmt.Sprintf("Receiving %s response (%d chars)", p.GetProviderDisplayName(), received.Len()),
+			Detail:   received.String(),
+			Partial:  true,
+		})
+		lastSent = time.Now()
 	}
 
-	return &clipReq, rawResponse, resp.StatusCode, resp.Status, nil
+	content, err := llm.ReadChatStream(body, func(delta string) {
+		received.WriteString(delta)
+		if debug {
+			fmt.Print(delta)
+		}
+		if time.Since(lastSent) >= streamProgressInterval {
+			report()
+		}
+	})
+	if debug {
+		fmt.Print("\n\n")
+	}
+	if err != nil {
+		return content, classify(ErrInvalidResponse, err)
+	}
+	if content == "" {
+		return content, classify(ErrInvalidResponse, errors.New("empty streamed AI response"))
+	}
+	report() // the last pieces may have arrived within the interval
+	return content, nil
 }
 
 // parseWithAzureTransparent handles Azure OpenAI Responses API with transparency info
-func (p *Parser) parseWithAzureTransparent(ctx context.Context, systemPrompt, userInput string) (*ClipRequest, string, int, string, error) {
+func (p *Parser) parseWithAzureTransparent(ctx context.Context, systemPrompt, userInput string) ([]*ClipRequest, string, int, string, error) {
 	debug := os.Getenv("CAPYCUT_DEBUG") != ""
 
 	reqBody := azureRequest{
@@ -1119,6 +1483,8 @@ func (p *Parser) parseWithAzureTransparent(ctx context.Context, systemPrompt, us
 			{Role: "user", Content: userInput},
 		},
 		MaxOutputTokens: 2048,
+		Temperature:     p.requestTemperature(),
+		TopP:            p.topP,
 	}
 
 	jsonBody, err := json.Marshal(reqBody)
@@ -1142,7 +1508,7 @@ func (p *Parser) parseWithAzureTransparent(ctx context.Context, systemPrompt, us
 
 	resp, err := p.client.Do(req)
 	if err != nil {
-		return nil, "", 0, "", fmt.Errorf("AI request failed: %w", err)
+		return nil, "", 0, "", classify(ErrProviderUnreachable, fmt.Errorf("AI request failed: %w", err))
 	}
 	defer resp.Body.Close()
 
@@ -1160,7 +1526,7 @@ func (p *Parser) parseWithAzureTransparent(ctx context.Context, systemPrompt, us
 			fmt.Printf("  Status:   %s\n", resp.Status)
 			fmt.Printf("  Response: %s\n\n", rawResponse)
 		}
-		return nil, rawResponse, resp.StatusCode, resp.Status, fmt.Errorf("AI request failed: %s\n  URL: %s\n  Response: %s", resp.Status, apiURL, rawResponse)
+		return nil, rawResponse, resp.StatusCode, resp.Status, &ProviderError{StatusCode: resp.StatusCode, Status: resp.Status, URL: apiURL, Body: rawResponse}
 	}
 
 	if debug {
@@ -1169,7 +1535,7 @@ func (p *Parser) parseWithAzureTransparent(ctx context.Context, systemPrompt, us
 
 	var apiResp azureResponse
 	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return nil, rawResponse, resp.StatusCode, resp.Status, fmt.Errorf("failed to parse API response: %w\nResponse was: %s", err, rawResponse)
+		return nil, rawResponse, resp.StatusCode, resp.Status, classify(ErrInvalidResponse, fmt.Errorf("failed to parse API response: %w\nResponse was: %s", err, rawResponse))
 	}
 
 	if apiResp.Error != nil {
@@ -1181,25 +1547,26 @@ func (p *Parser) parseWithAzureTransparent(ctx context.Context, systemPrompt, us
 		fmt.Printf("[DEBUG] Extracted content: %q\n\n", content)
 	}
 	if content == "" {
-		return nil, rawResponse, resp.StatusCode, resp.Status, fmt.Errorf("no content in AI response\nFull response: %s", rawResponse)
+		return nil, rawResponse, resp.StatusCode, resp.Status, classify(ErrInvalidResponse, fmt.Errorf("no content in AI response\nFull response: %s", rawResponse))
 	}
 
-	content = cleanJSONResponse(content)
+	content = llm.CleanJSON(content)
 
-	var clipReq ClipRequest
-	if err := json.Unmarshal([]byte(content), &clipReq); err != nil {
-		return nil, rawResponse, resp.StatusCode, resp.Status, fmt.Errorf("failed to parse AI response: %w\nResponse was: %s", err, content)
+	clips, err := decodeClipRequests(content)
+	if err != nil {
+		return nil, rawResponse, resp.StatusCode, resp.Status, classify(ErrInvalidResponse, fmt.Errorf("failed to parse AI response: %w\nResponse was: %s", err, content))
 	}
 
-	if clipReq.Error != "" {
-		return nil, rawResponse, resp.StatusCode, resp.Status, fmt.Errorf("AI could not parse request: %s", clipReq.Error)
+	if err := checkClipRequests(clips); err != nil {
+		return nil, rawResponse, resp.StatusCode, resp.Status, err
 	}
 
-	return &clipReq, rawResponse, resp.StatusCode, resp.Status, nil
+	return clips, rawResponse, resp.StatusCode, resp.Status, nil
 }
 
-// parseWithAzureAnthropicTransparent handles Azure Anthropic (Claude) API with transparency info
-func (p *Parser) parseWithAzureAnthropicTransparent(ctx context.Context, systemPrompt, userInput string) (*ClipRequest, string, int, string, error) {
+// parseWithAzureAnthropicTransparent handles the Anthropic (Claude) API,
+// directly or through Azure, with transparency info
+func (p *Parser) parseWithAzureAnthropicTransparent(ctx context.Context, systemPrompt, userInput string) ([]*ClipRequest, string, int, string, error) {
 	debug := os.Getenv("CAPYCUT_DEBUG") != ""
 
 	if p.anthropicClient == nil {
@@ -1207,26 +1574,17 @@ func (p *Parser) parseWithAzureAnthropicTransparent(ctx context.Context, systemP
 	}
 
 	if debug {
-		fmt.Printf("[DEBUG] Azure Anthropic request to model: %s\n", p.model)
+		fmt.Printf("[DEBUG] %s request to model: %s\n", p.GetProviderDisplayName(), p.model)
 	}
 
 	// Create the message request
-	message, err := p.anthropicClient.Messages.New(ctx, anthropic.MessageNewParams{
-		Model:     anthropic.Model(p.model),
-		MaxTokens: 1024,
-		System: []anthropic.TextBlockParam{
-			{Text: systemPrompt},
-		},
-		Messages: []anthropic.MessageParam{
-			anthropic.NewUserMessage(anthropic.NewTextBlock(userInput)),
-		},
-	})
+	message, err := p.anthropicClient.Messages.New(ctx, p.anthropicMessageParams(systemPrompt, userInput))
 	if err != nil {
-		return nil, "", 0, "", fmt.Errorf("Azure Anthropic request failed: %w", err)
+		return nil, "", 0, "", anthropicRequestError(p.GetProviderDisplayName(), err)
 	}
 
 	if debug {
-		fmt.Printf("[DEBUG] Azure Anthropic response: %+v\n", message)
+		fmt.Printf("[DEBUG] %s response: %+v\n", p.GetProviderDisplayName(), message)
 	}
 
 	// Extract text content from response
@@ -1241,23 +1599,23 @@ func (p *Parser) parseWithAzureAnthropicTransparent(ctx context.Context, systemP
 	}
 
 	if content == "" {
-		return nil, rawResponse, 200, "OK", fmt.Errorf("no content in Azure Anthropic response")
+		return nil, rawResponse, 200, "OK", classify(ErrInvalidResponse, fmt.Errorf("no content in %s response", p.GetProviderDisplayName()))
 	}
 
 	if debug {
 		fmt.Printf("[DEBUG] Extracted content: %q\n\n", content)
 	}
 
-	content = cleanJSONResponse(content)
+	content = llm.CleanJSON(content)
 
-	var clipReq ClipRequest
-	if err := json.Unmarshal([]byte(content), &clipReq); err != nil {
-		return nil, rawResponse, 200, "OK", fmt.Errorf("failed to parse AI response: %w\nResponse was: %s", err, content)
+	clips, err := decodeClipRequests(content)
+	if err != nil {
+		return nil, rawResponse, 200, "OK", classify(ErrInvalidResponse, fmt.Errorf("failed to parse AI response: %w\nResponse was: %s", err, content))
 	}
 
-	if clipReq.Error != "" {
-		return nil, rawResponse, 200, "OK", fmt.Errorf("AI could not parse request: %s", clipReq.Error)
+	if err := checkClipRequests(clips); err != nil {
+		return nil, rawResponse, 200, "OK", err
 	}
 
-	return &clipReq, rawResponse, 200, "OK", nil
+	return clips, rawResponse, 200, "OK", nil
 }
@@ -1,11 +1,85 @@
 package ai
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"capycut/llm"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
 )
 
+// newParserForTest builds a parser for provider that talks to endpoint,
+// bypassing the environment lookups in NewParser
+func newParserForTest(provider Provider, endpoint, model string) *Parser {
+	p := &Parser{
+		provider: provider,
+		endpoint: endpoint,
+		apiKey:   "test-key",
+		model:    model,
+		client:   &http.Client{Timeout: 5 * time.Second},
+	}
+	switch provider {
+	case ProviderAzure:
+		p.apiVersion = "2025-04-01-preview"
+	case ProviderAzureAnthropic, ProviderAnthropic:
+		client := anthropic.NewClient(
+			option.WithAPIKey(p.apiKey),
+			option.WithBaseURL(endpoint),
+			option.WithMaxRetries(0),
+		)
+		p.anthropicClient = &client
+	}
+	return p
+}
+
+// providerReply encodes content in the response shape each provider returns
+func providerReply(t *testing.T, w http.ResponseWriter, provider Provider, content string) {
+	t.Helper()
+	w.Header().Set("Content-Type", "application/json")
+
+	var body any
+	switch provider {
+	case ProviderLocal, ProviderOpenAI:
+		body = openAIResponse{
+			Choices: []openAIChoice{{Message: message{Role: "assistant", Content: content}, FinishReason: "stop"}},
+		}
+	case ProviderAzure:
+		body = azureResponse{
+			ID:     "resp_test",
+			Status: "completed",
+			Output: []azureOutputItem{{
+				Type:    "message",
+				Content: []azureContentItem{{Type: "output_text", Text: content}},
+			}},
+		}
+	case ProviderAzureAnthropic, ProviderAnthropic:
+		body = map[string]any{
+			"id":          "msg_test",
+			"type":        "message",
+			"role":        "assistant",
+			"model":       "test-model",
+			"content":     []map[string]string{{"type": "text", "text": content}},
+			"stop_reason": "end_turn",
+			"usage":       map[string]int{"input_tokens": 10, "output_tokens": 10},
+		}
+	}
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		t.Errorf("failed to encode response: %v", err)
+	}
+}
+
 func TestFormatDuration(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -37,56 +111,18 @@ func TestFormatDuration(t *testing.T) {
 			input:    10*time.Hour + 5*time.Minute + 3*time.Second,
 			expected: "10:05:03",
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := formatDuration(tt.input)
-			if result != tt.expected {
-				t.Errorf("formatDuration(%v) = %q, want %q", tt.input, result, tt.expected)
-			}
-		})
-	}
-}
-
-func TestCleanJSONResponse(t *testing.T) {
-	tests := []struct {
-		name     string
-		input    string
-		expected string
-	}{
-		{
-			name:     "plain JSON",
-			input:    `{"start_time": "00:01:00", "end_time": "00:02:00"}`,
-			expected: `{"start_time": "00:01:00", "end_time": "00:02:00"}`,
-		},
 		{
-			name:     "with markdown code block",
-			input:    "```json\n{\"start_time\": \"00:01:00\", \"end_time\": \"00:02:00\"}\n```",
-			expected: `{"start_time": "00:01:00", "end_time": "00:02:00"}`,
-		},
-		{
-			name:     "with plain code block",
-			input:    "```\n{\"start_time\": \"00:01:00\"}\n```",
-			expected: `{"start_time": "00:01:00"}`,
-		},
-		{
-			name:     "with whitespace",
-			input:    "  {\"start_time\": \"00:00:00\"}  ",
-			expected: `{"start_time": "00:00:00"}`,
-		},
-		{
-			name:     "empty string",
-			input:    "",
-			expected: "",
+			name:     "milliseconds",
+			input:    1*time.Minute + 2*time.Second + 500*time.Millisecond,
+			expected: "00:01:02.500",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := cleanJSONResponse(tt.input)
+			result := formatDuration(tt.input)
 			if result != tt.expected {
-				t.Errorf("cleanJSONResponse(%q) = %q, want %q", tt.input, result, tt.expected)
+				t.Errorf("formatDuration(%v) = %q, want %q", tt.input, result, tt.expected)
 			}
 		})
 	}
@@ -126,6 +162,7 @@ func TestCheckConfig(t *testing.T) {
 	// Ensure local LLM is not configured so we test Azure path
 	os.Unsetenv("LLM_ENDPOINT")
 	os.Unsetenv("LLM_MODEL")
+	t.Setenv("ANTHROPIC_API_KEY", "")
 
 	// Test missing endpoint
 	os.Setenv("AZURE_OPENAI_ENDPOINT", "")
@@ -158,6 +195,13 @@ func TestCheckConfig(t *testing.T) {
 	if err := CheckConfig(); err != nil {
 		t.Errorf("CheckConfig() should not error when all vars are set: %v", err)
 	}
+
+	// Test OpenAI alone
+	os.Setenv("AZURE_OPENAI_ENDPOINT", "")
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	if err := CheckConfig(); err != nil {
+		t.Errorf("CheckConfig() should not error when OPENAI_API_KEY is set: %v", err)
+	}
 }
 
 func containsSubstring(s, substr string) bool {
@@ -203,6 +247,49 @@ func TestClipRequestWithError(t *testing.T) {
 	}
 }
 
+func TestClipRequestValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		start, end  string
+		duration    time.Duration
+		wantEnd     string
+		wantWarning bool
+		wantErr     string
+	}{
+		{name: "inside the video", start: "00:01:00", end: "00:02:00", duration: 10 * time.Minute, wantEnd: "00:02:00"},
+		{name: "unknown duration", start: "00:01:00", end: "02:00:00", wantEnd: "02:00:00"},
+		{name: "end at the video end", start: "00:09:00", end: "00:10:00", duration: 10 * time.Minute, wantEnd: "00:10:00"},
+		{name: "end past the video is clamped", start: "00:09:00", end: "00:12:00", duration: 10 * time.Minute, wantEnd: "00:10:00", wantWarning: true},
+		{name: "end before start", start: "00:05:00", end: "00:04:00", duration: 10 * time.Minute, wantErr: "before the start time"},
+		{name: "zero length", start: "00:05:00", end: "00:05:00", duration: 10 * time.Minute, wantErr: "no length"},
+		{name: "start past the video", start: "00:11:00", end: "00:12:00", duration: 10 * time.Minute, wantErr: "only 00:10:00 long"},
+		{name: "unparseable start", start: "soon", end: "00:02:00", wantErr: "invalid start time"},
+		{name: "unparseable end", start: "00:01:00", end: "", wantErr: "invalid end time"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &ClipRequest{StartTime: tt.start, EndTime: tt.end}
+			err := req.Validate(tt.duration)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Validate() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate() unexpected error: %v", err)
+			}
+			if req.EndTime != tt.wantEnd {
+				t.Errorf("EndTime = %q, want %q", req.EndTime, tt.wantEnd)
+			}
+			if (req.Warning != "") != tt.wantWarning {
+				t.Errorf("Warning = %q, want a warning: %v", req.Warning, tt.wantWarning)
+			}
+		})
+	}
+}
+
 func TestNewParser(t *testing.T) {
 	// Save original env vars
 	origEndpoint := os.Getenv("AZURE_OPENAI_ENDPOINT")
@@ -231,6 +318,7 @@ func TestNewParser(t *testing.T) {
 	// Ensure local LLM is not configured so we test Azure path
 	os.Unsetenv("LLM_ENDPOINT")
 	os.Unsetenv("LLM_MODEL")
+	t.Setenv("ANTHROPIC_API_KEY", "")
 
 	// Test successful parser creation with Azure
 	os.Setenv("AZURE_OPENAI_ENDPOINT", "https://test.openai.azure.com/")
@@ -250,3 +338,1058 @@ func TestNewParser(t *testing.T) {
 		t.Errorf("NewParser() model = %q, want %q", parser.model, "gpt-5-codex")
 	}
 }
+
+func TestNewParser_OpenAI(t *testing.T) {
+	t.Setenv("LLM_PROVIDER", "")
+	t.Setenv("LLM_ENDPOINT", "")
+	t.Setenv("AZURE_ANTHROPIC_ENDPOINT", "")
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	t.Setenv("AZURE_OPENAI_ENDPOINT", "")
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("OPENAI_MODEL", "")
+	t.Setenv("OPENAI_BASE_URL", "https://gateway.example.com/v1")
+
+	parser, err := NewParser()
+	if err != nil {
+		t.Fatalf("NewParser() unexpected error: %v", err)
+	}
+	if parser.GetProvider() != ProviderOpenAI || parser.GetModel() != llm.DefaultOpenAIModel || parser.GetEndpoint() != "https://gateway.example.com" {
+		t.Errorf("NewParser() = %s %s %s, want OpenAI with the default model at the gateway", parser.GetProvider(), parser.GetModel(), parser.GetEndpoint())
+	}
+
+	// Azure OpenAI keeps precedence when both are configured
+	t.Setenv("AZURE_OPENAI_ENDPOINT", "https://test.openai.azure.com")
+	t.Setenv("AZURE_OPENAI_API_KEY", "test-key")
+	t.Setenv("AZURE_OPENAI_MODEL", "gpt-4o")
+	parser, err = NewParser()
+	if err != nil {
+		t.Fatalf("NewParser() unexpected error: %v", err)
+	}
+	if parser.GetProvider() != ProviderAzure {
+		t.Errorf("NewParser() provider = %s, want %s", parser.GetProvider(), ProviderAzure)
+	}
+	if got := GetAvailableProviders(); len(got) != 2 || got[1] != ProviderOpenAI {
+		t.Errorf("GetAvailableProviders() = %v, want Azure OpenAI then OpenAI", got)
+	}
+
+	// LLM_PROVIDER overrides detection
+	t.Setenv("LLM_PROVIDER", "openai")
+	parser, err = NewParser()
+	if err != nil {
+		t.Fatalf("NewParser() with LLM_PROVIDER=openai unexpected error: %v", err)
+	}
+	if parser.GetProvider() != ProviderOpenAI {
+		t.Errorf("NewParser() with LLM_PROVIDER=openai provider = %s", parser.GetProvider())
+	}
+	t.Setenv("LLM_PROVIDER", "openia")
+	if _, err := NewParser(); err == nil || !strings.Contains(err.Error(), "openia") {
+		t.Errorf("NewParser() with LLM_PROVIDER=openia error = %v, want unknown provider", err)
+	}
+	t.Setenv("LLM_PROVIDER", "")
+
+	parser, err = NewParserWithProvider(ProviderOpenAI)
+	if err != nil {
+		t.Fatalf("NewParserWithProvider(openai) unexpected error: %v", err)
+	}
+	if parser.GetProvider() != ProviderOpenAI {
+		t.Errorf("NewParserWithProvider(openai) provider = %s", parser.GetProvider())
+	}
+}
+
+func TestNewParser_Anthropic(t *testing.T) {
+	t.Setenv("LLM_ENDPOINT", "")
+	t.Setenv("AZURE_ANTHROPIC_ENDPOINT", "")
+	t.Setenv("AZURE_OPENAI_ENDPOINT", "")
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-test")
+	t.Setenv("ANTHROPIC_MODEL", "")
+	t.Setenv("ANTHROPIC_BASE_URL", "")
+
+	if err := CheckConfig(); err != nil {
+		t.Errorf("CheckConfig() should not error when ANTHROPIC_API_KEY is set: %v", err)
+	}
+
+	// OpenAI keeps precedence; LLM_PROVIDER picks Anthropic
+	t.Setenv("LLM_PROVIDER", "")
+	parser, err := NewParser()
+	if err != nil {
+		t.Fatalf("NewParser() unexpected error: %v", err)
+	}
+	if parser.GetProvider() != ProviderOpenAI {
+		t.Errorf("NewParser() provider = %s, want %s", parser.GetProvider(), ProviderOpenAI)
+	}
+	t.Setenv("LLM_PROVIDER", "anthropic")
+	parser, err = NewParser()
+	if err != nil {
+		t.Fatalf("NewParser() unexpected error: %v", err)
+	}
+	if parser.GetProvider() != ProviderAnthropic || parser.GetModel() != llm.DefaultAnthropicModel || parser.GetEndpoint() != llm.DefaultAnthropicBaseURL {
+		t.Errorf("NewParser() = %s %s %s, want Anthropic with the default model and base URL", parser.GetProvider(), parser.GetModel(), parser.GetEndpoint())
+	}
+	if parser.anthropicClient == nil {
+		t.Error("NewParser() left the Anthropic client unset")
+	}
+	if got := parser.GetProviderDisplayName(); got != "Anthropic" {
+		t.Errorf("GetProviderDisplayName() = %q, want Anthropic", got)
+	}
+
+	// Azure Anthropic keeps precedence when both are configured
+	t.Setenv("LLM_PROVIDER", "")
+	t.Setenv("AZURE_ANTHROPIC_ENDPOINT", "https://example.services.ai.azure.com")
+	t.Setenv("AZURE_ANTHROPIC_API_KEY", "azure-key")
+	parser, err = NewParser()
+	if err != nil {
+		t.Fatalf("NewParser() unexpected error: %v", err)
+	}
+	if parser.GetProvider() != ProviderAzureAnthropic {
+		t.Errorf("NewParser() provider = %s, want %s", parser.GetProvider(), ProviderAzureAnthropic)
+	}
+	want := []Provider{ProviderAzureAnthropic, ProviderOpenAI, ProviderAnthropic}
+	if got := GetAvailableProviders(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAvailableProviders() = %v, want %v", got, want)
+	}
+
+	parser, err = NewParserWithProvider(ProviderAnthropic)
+	if err != nil {
+		t.Fatalf("NewParserWithProvider(anthropic) unexpected error: %v", err)
+	}
+	if parser.GetProvider() != ProviderAnthropic {
+		t.Errorf("NewParserWithProvider(anthropic) provider = %s", parser.GetProvider())
+	}
+
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	if _, err := NewParserWithProvider(ProviderAnthropic); err == nil || !strings.Contains(err.Error(), "ANTHROPIC_API_KEY") {
+		t.Errorf("NewParserWithProvider(anthropic) error = %v, want ANTHROPIC_API_KEY not set", err)
+	}
+}
+
+func TestNewParserTimeout(t *testing.T) {
+	t.Setenv("LLM_ENDPOINT", "http://localhost:1234")
+	t.Setenv("LLM_MODEL", "test-model")
+
+	t.Setenv(TimeoutEnvVar, "")
+	parser, err := NewParser()
+	if err != nil {
+		t.Fatalf("NewParser() unexpected error: %v", err)
+	}
+	if parser.client.Timeout != 120*time.Second {
+		t.Errorf("default timeout = %v, want 120s", parser.client.Timeout)
+	}
+
+	t.Setenv(TimeoutEnvVar, "10m")
+	parser, err = NewParser()
+	if err != nil {
+		t.Fatalf("NewParser() unexpected error: %v", err)
+	}
+	if parser.client.Timeout != 10*time.Minute {
+		t.Errorf("AI_TIMEOUT timeout = %v, want 10m", parser.client.Timeout)
+	}
+
+	t.Setenv(TimeoutEnvVar, "later")
+	if _, err := NewParser(); err == nil {
+		t.Error("NewParser() should reject an invalid AI_TIMEOUT")
+	}
+}
+
+func TestParserParseTimeout(t *testing.T) {
+	t.Setenv(TimeoutEnvVar, "")
+	local := &Parser{provider: ProviderLocal}
+	azure := &Parser{provider: ProviderAzure}
+
+	if got := azure.ParseTimeout(""); got != parseBaseTimeout {
+		t.Errorf("empty prompt = %v, want %v", got, parseBaseTimeout)
+	}
+	if got := local.ParseTimeout(""); got != localParseBaseTimeout {
+		t.Errorf("local empty prompt = %v, want %v", got, localParseBaseTimeout)
+	}
+	if got := azure.ParseTimeout("first minute"); got != parseBaseTimeout+parseTimeoutPerKB {
+		t.Errorf("short prompt = %v, want %v", got, parseBaseTimeout+parseTimeoutPerKB)
+	}
+	if got := azure.ParseTimeout(strings.Repeat("x", 1025)); got != parseBaseTimeout+2*parseTimeoutPerKB {
+		t.Errorf("prompt over 1KB = %v, want %v", got, parseBaseTimeout+2*parseTimeoutPerKB)
+	}
+	if got := azure.ParseTimeout(strings.Repeat("x", 64*1024)); got != MaxParseTimeout {
+		t.Errorf("long prompt = %v, want cap %v", got, MaxParseTimeout)
+	}
+	if got := local.ParseTimeout(strings.Repeat("x", 64*1024)); got != MaxLocalParseTimeout {
+		t.Errorf("local long prompt = %v, want cap %v", got, MaxLocalParseTimeout)
+	}
+	if MaxLocalParseTimeout < localClientTimeout {
+		t.Errorf("local cap %v is below the local client timeout %v", MaxLocalParseTimeout, localClientTimeout)
+	}
+
+	t.Setenv(TimeoutEnvVar, "5m")
+	if got := local.ParseTimeout(strings.Repeat("x", 64*1024)); got != 5*time.Minute {
+		t.Errorf("AI_TIMEOUT = %v, want 5m", got)
+	}
+}
+
+func TestNewParserInsecure(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	t.Setenv("LLM_ENDPOINT", server.URL)
+	t.Setenv(llm.CACertEnvVar, "")
+
+	t.Setenv(llm.InsecureEnvVar, "")
+	parser, err := NewParser()
+	if err != nil {
+		t.Fatalf("NewParser() unexpected error: %v", err)
+	}
+	if _, err := parser.client.Get(server.URL); err == nil {
+		t.Error("expected a self-signed certificate to be rejected")
+	}
+
+	t.Setenv(llm.InsecureEnvVar, "1")
+	parser, err = NewParser()
+	if err != nil {
+		t.Fatalf("NewParser() unexpected error: %v", err)
+	}
+	resp, err := parser.client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request with %s failed: %v", llm.InsecureEnvVar, err)
+	}
+	resp.Body.Close()
+
+	t.Setenv(llm.CACertEnvVar, filepath.Join(t.TempDir(), "missing.pem"))
+	if _, err := NewParser(); err == nil {
+		t.Error("NewParser() should reject a missing CA bundle")
+	}
+}
+
+func TestParserSamplingOverrides(t *testing.T) {
+	tests := []struct {
+		name            string
+		temperature     *float64
+		topP            *float64
+		wantTemperature float64
+		wantTopP        *float64
+	}{
+		{"defaults", nil, nil, DefaultTemperature, nil},
+		{"custom temperature", ptrFloat(0.7), nil, 0.7, nil},
+		{"zero temperature is sent", ptrFloat(0), nil, 0, nil},
+		{"top_p", nil, ptrFloat(0.9), DefaultTemperature, ptrFloat(0.9)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got openAIRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("failed to decode request: %v", err)
+				}
+				json.NewEncoder(w).Encode(openAIResponse{
+					Choices: []openAIChoice{{Message: message{Role: "assistant", Content: `{"start_time": "00:00:00", "end_time": "00:01:00"}`}}},
+				})
+			}))
+			defer server.Close()
+
+			p := &Parser{provider: ProviderLocal, endpoint: server.URL, model: "test", client: server.Client()}
+			if tt.temperature != nil {
+				p.SetTemperature(*tt.temperature)
+			}
+			if tt.topP != nil {
+				p.SetTopP(*tt.topP)
+			}
+
+			if _, err := p.ParseClipRequest(context.Background(), "first minute", 5*time.Minute); err != nil {
+				t.Fatalf("ParseClipRequest() error: %v", err)
+			}
+
+			if got.Temperature == nil || *got.Temperature != tt.wantTemperature {
+				t.Errorf("temperature = %v, want %v", got.Temperature, tt.wantTemperature)
+			}
+			if (got.TopP == nil) != (tt.wantTopP == nil) || (got.TopP != nil && *got.TopP != *tt.wantTopP) {
+				t.Errorf("top_p = %v, want %v", got.TopP, tt.wantTopP)
+			}
+		})
+	}
+}
+
+func TestNewParserSampling(t *testing.T) {
+	t.Setenv("LLM_PROVIDER", "")
+	t.Setenv("LLM_ENDPOINT", "http://localhost:1234")
+	t.Setenv("LLM_MODEL", "test-model")
+
+	t.Setenv(TemperatureEnvVar, "0.7")
+	t.Setenv(TopPEnvVar, "0.9")
+	parser, err := NewParser()
+	if err != nil {
+		t.Fatalf("NewParser() unexpected error: %v", err)
+	}
+	if got := parser.samplingParameters(); got["temperature"] != "0.7" || got["top_p"] != "0.9" {
+		t.Errorf("sampling parameters = %v, want temperature 0.7 and top_p 0.9", got)
+	}
+
+	for env, value := range map[string]string{TemperatureEnvVar: "3", TopPEnvVar: "0"} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := NewParser(); err == nil {
+				t.Errorf("NewParser() should reject %s=%s", env, value)
+			}
+		})
+	}
+}
+
+func TestParserSamplingParameters(t *testing.T) {
+	// Azure OpenAI and Claude requests carry no temperature unless it is set,
+	// so none is reported either
+	for _, provider := range []Provider{ProviderAzure, ProviderAzureAnthropic, ProviderAnthropic} {
+		p := &Parser{provider: provider}
+		if got, ok := p.samplingParameters()["temperature"]; ok {
+			t.Errorf("%s reports temperature %s without an override", provider, got)
+		}
+		p.SetTemperature(0.5)
+		if got := p.samplingParameters()["temperature"]; got != "0.5" {
+			t.Errorf("%s reports temperature %q, want 0.5", provider, got)
+		}
+	}
+
+	p := &Parser{provider: ProviderOpenAI}
+	if got := p.samplingParameters()["temperature"]; got != "0.1" {
+		t.Errorf("OpenAI reports temperature %q, want the default 0.1", got)
+	}
+}
+
+func TestParseClipRequest_JSONRepair(t *testing.T) {
+	tests := []struct {
+		name         string
+		responses    []string
+		wantErr      bool
+		wantRequests int
+	}{
+		{
+			name:         "valid JSON needs no repair",
+			responses:    []string{`{"start_time": "00:00:00", "end_time": "00:01:00"}`},
+			wantRequests: 1,
+		},
+		{
+			name: "trailing comma repaired",
+			responses: []string{
+				`{"start_time": "00:00:00", "end_time": "00:01:00",}`,
+				`{"start_time": "00:00:00", "end_time": "00:01:00"}`,
+			},
+			wantRequests: 2,
+		},
+		{
+			name: "single repair attempt",
+			responses: []string{
+				`{"start_time": "00:00:00" // start`,
+				`still not json`,
+				`{"start_time": "00:00:00", "end_time": "00:01:00"}`,
+			},
+			wantErr:      true,
+			wantRequests: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				content := tt.responses[requests]
+				requests++
+				json.NewEncoder(w).Encode(openAIResponse{
+					Choices: []openAIChoice{{Message: message{Role: "assistant", Content: content}}},
+				})
+			}))
+			defer server.Close()
+
+			p := &Parser{provider: ProviderLocal, endpoint: server.URL, model: "test", client: server.Client()}
+			result, err := p.ParseClipRequest(context.Background(), "first minute", 5*time.Minute)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseClipRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if requests != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", requests, tt.wantRequests)
+			}
+			if !tt.wantErr && result.EndTime != "00:01:00" {
+				t.Errorf("EndTime = %q, want 00:01:00", result.EndTime)
+			}
+		})
+	}
+}
+
+func TestRepairContext(t *testing.T) {
+	// The parse deadline running out leaves the repair its own budget
+	expired, cancelExpired := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancelExpired()
+	<-expired.Done()
+	ctx, cancel := repairContext(expired, time.Minute)
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("repair context after parent deadline: %v", err)
+	}
+
+	// Cancelling the parse still stops the repair
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel = repairContext(parent, time.Minute)
+	defer cancel()
+	cancelParent()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("repair context not cancelled with its parent")
+	}
+}
+
+func TestParseClipRequest_StartPlusDuration(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		response  string
+		wantStart string
+		wantEnd   string
+		wantErr   bool
+	}{
+		{
+			name:     "starting at, give me",
+			input:    "starting at 2:15, give me 45 seconds",
+			response: `{"start_time": "00:02:15", "end_time": "", "duration": "00:00:45"}`,
+			wantEnd:  "00:03:00",
+		},
+		{
+			name:     "start at for",
+			input:    "start at 1:00 for 30 seconds",
+			response: `{"start_time": "00:01:00", "end_time": "", "duration": "00:00:30"}`,
+			wantEnd:  "00:01:30",
+		},
+		{
+			name:     "length from a mark",
+			input:    "90 seconds from the 4 minute mark",
+			response: `{"start_time": "00:04:00", "end_time": "", "duration": "00:01:30"}`,
+			wantEnd:  "00:05:30",
+		},
+		{
+			name:     "model arithmetic disagreeing with the duration",
+			input:    "from 0:10, 20 seconds",
+			response: `{"start_time": "00:00:10", "end_time": "00:00:40", "duration": "00:00:20"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "end capped at video length",
+			input:    "starting at 9:30 give me two minutes",
+			response: `{"start_time": "00:09:30", "end_time": "", "duration": "00:02:00"}`,
+			wantEnd:  "00:10:00",
+		},
+		{
+			name:     "absolute range unchanged",
+			input:    "from minute three to minute five",
+			response: `{"start_time": "00:03:00", "end_time": "00:05:00"}`,
+			wantEnd:  "00:05:00",
+		},
+		{
+			name:     "start past the end",
+			input:    "starting at 12:00 for 10 seconds",
+			response: `{"start_time": "00:12:00", "end_time": "", "duration": "00:00:10"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "zero duration",
+			input:    "at 1:00 for zero seconds",
+			response: `{"start_time": "00:01:00", "end_time": "", "duration": "00:00:00"}`,
+			wantErr:  true,
+		},
+		{
+			name:      "until before the end",
+			input:     "from 5:00 until 30 seconds before the end",
+			response:  `{"start_time": "00:05:00", "end_time": "", "end_from_end": "00:00:30"}`,
+			wantStart: "00:05:00",
+			wantEnd:   "00:09:30",
+		},
+		{
+			name:      "last minutes but stop early",
+			input:     "last 2 minutes but stop 10s early",
+			response:  `{"start_time": "", "end_time": "", "start_from_end": "00:02:00", "end_from_end": "00:00:10"}`,
+			wantStart: "00:08:00",
+			wantEnd:   "00:09:50",
+		},
+		{
+			name:      "last seconds",
+			input:     "the final 45 seconds",
+			response:  `{"start_time": "", "end_time": "", "start_from_end": "00:00:45"}`,
+			wantStart: "00:09:15",
+			wantEnd:   "00:10:00",
+		},
+		{
+			name:      "last longer than the video",
+			input:     "last 20 minutes, skip the final 5 seconds",
+			response:  `{"start_time": "", "end_time": "", "start_from_end": "00:20:00", "end_from_end": "00:00:05"}`,
+			wantStart: "00:00:00",
+			wantEnd:   "00:09:55",
+		},
+		{
+			name:      "end offset beats duration",
+			input:     "from 1:00 for a minute, no, until 10 seconds before the end",
+			response:  `{"start_time": "00:01:00", "end_time": "", "duration": "00:01:00", "end_from_end": "00:00:10"}`,
+			wantStart: "00:01:00",
+			wantEnd:   "00:09:50",
+		},
+		{
+			name:     "end percentage and duration",
+			input:    "from the start to halfway, 30 seconds",
+			response: `{"start_time": "00:00:00", "end_time": "", "end_percent": 50, "duration": "00:00:30"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "end offset before the start",
+			input:    "from 9:45 until 30 seconds before the end",
+			response: `{"start_time": "00:09:45", "end_time": "", "end_from_end": "00:00:30"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "bad end offset",
+			input:    "until a bit before the end",
+			response: `{"start_time": "00:00:00", "end_time": "", "end_from_end": "a bit"}`,
+			wantErr:  true,
+		},
+		{
+			name:      "percentage range",
+			input:     "the middle half of the talk",
+			response:  `{"start_time": "", "end_time": "", "start_percent": 25, "end_percent": 75}`,
+			wantStart: "00:02:30",
+			wantEnd:   "00:07:30",
+		},
+		{
+			name:      "fractional percentage",
+			input:     "the opening third of the talk",
+			response:  `{"start_time": "", "end_time": "", "start_percent": 0, "end_percent": 33.3333}`,
+			wantStart: "00:00:00",
+			wantEnd:   "00:03:20",
+		},
+		{
+			name:      "percentage start with duration",
+			input:     "30 seconds from the halfway point",
+			response:  `{"start_time": "", "end_time": "", "start_percent": 50, "duration": "00:00:30"}`,
+			wantStart: "00:05:00",
+			wantEnd:   "00:05:30",
+		},
+		{
+			name:      "percentage start to the end",
+			input:     "everything after 90% through",
+			response:  `{"start_time": "", "end_time": "", "start_percent": 90}`,
+			wantStart: "00:09:00",
+			wantEnd:   "00:10:00",
+		},
+		{
+			name:     "percentage out of range",
+			input:    "the last 120% of the talk",
+			response: `{"start_time": "", "end_time": "", "start_percent": -20, "end_percent": 100}`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got openAIRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("failed to decode request: %v", err)
+				}
+				json.NewEncoder(w).Encode(openAIResponse{
+					Choices: []openAIChoice{{Message: message{Role: "assistant", Content: tt.response}}},
+				})
+			}))
+			defer server.Close()
+
+			p := &Parser{provider: ProviderLocal, endpoint: server.URL, model: "test", client: server.Client()}
+			result, err := p.ParseClipRequest(context.Background(), tt.input, 10*time.Minute)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseClipRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got.Messages) != 2 || got.Messages[1].Content != tt.input {
+				t.Errorf("user message = %v, want %q", got.Messages, tt.input)
+			}
+			if tt.wantErr {
+				return
+			}
+			if result.EndTime != tt.wantEnd {
+				t.Errorf("EndTime = %q, want %q", result.EndTime, tt.wantEnd)
+			}
+			if tt.wantStart != "" && result.StartTime != tt.wantStart {
+				t.Errorf("StartTime = %q, want %q", result.StartTime, tt.wantStart)
+			}
+			if result.Duration != "" || result.StartFromEnd != "" || result.EndFromEnd != "" {
+				t.Errorf("relative fields = %+v, want them resolved", result)
+			}
+		})
+	}
+}
+
+func TestParseClipRequests(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     []string // "start-end" per clip
+		wantErr  error
+	}{
+		{
+			name:     "single object",
+			response: `{"start_time": "00:00:00", "end_time": "00:02:00"}`,
+			want:     []string{"00:00:00-00:02:00"},
+		},
+		{
+			name:     "first and last",
+			response: `[{"start_time": "00:00:00", "end_time": "00:02:00"}, {"start_time": "", "end_time": "", "start_from_end": "00:00:30"}]`,
+			want:     []string{"00:00:00-00:02:00", "00:09:30-00:10:00"},
+		},
+		{
+			name:     "order kept",
+			response: "```json\n[{\"start_time\": \"00:05:00\", \"end_time\": \"00:06:00\"}, {\"start_time\": \"00:01:00\", \"end_time\": \"00:02:00\"}]\n```",
+			want:     []string{"00:05:00-00:06:00", "00:01:00-00:02:00"},
+		},
+		{
+			name:     "touching ranges",
+			response: `[{"start_time": "00:00:00", "end_time": "00:01:00"}, {"start_time": "00:01:00", "end_time": "00:02:00"}]`,
+			want:     []string{"00:00:00-00:01:00", "00:01:00-00:02:00"},
+		},
+		{
+			name:     "overlapping ranges",
+			response: `[{"start_time": "00:03:00", "end_time": "00:04:00"}, {"start_time": "00:00:00", "end_time": "00:02:00"}, {"start_time": "00:01:30", "end_time": "00:02:30"}]`,
+			wantErr:  ErrAmbiguousRequest,
+		},
+		{
+			name:     "empty array",
+			response: `[]`,
+			wantErr:  ErrAmbiguousRequest,
+		},
+		{
+			name:     "null clip",
+			response: `[null]`,
+			wantErr:  ErrInvalidResponse,
+		},
+		{
+			name:     "error in one clip",
+			response: `[{"start_time": "00:00:00", "end_time": "00:01:00"}, {"start_time": "", "end_time": "", "error": "which part?"}]`,
+			wantErr:  ErrAmbiguousRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(openAIResponse{
+					Choices: []openAIChoice{{Message: message{Role: "assistant", Content: tt.response}}},
+				})
+			}))
+			defer server.Close()
+
+			p := &Parser{provider: ProviderLocal, endpoint: server.URL, model: "test", client: server.Client()}
+			clips, err := p.ParseClipRequests(context.Background(), "some clips", 10*time.Minute)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ParseClipRequests() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseClipRequests() error: %v", err)
+			}
+			var got []string
+			for _, clip := range clips {
+				got = append(got, clip.StartTime+"-"+clip.EndTime)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("clips = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseClipRequest_SeveralClips(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(openAIResponse{
+			Choices: []openAIChoice{{Message: message{Role: "assistant", Content: `[{"start_time": "00:00:00", "end_time": "00:01:00"}, {"start_time": "00:02:00", "end_time": "00:03:00"}]`}}},
+		})
+	}))
+	defer server.Close()
+
+	p := &Parser{provider: ProviderLocal, endpoint: server.URL, model: "test", client: server.Client()}
+	_, err := p.ParseClipRequest(context.Background(), "first minute and the third", 10*time.Minute)
+	if !errors.Is(err, ErrAmbiguousRequest) || !strings.Contains(err.Error(), "2 clips") {
+		t.Errorf("ParseClipRequest() error = %v, want an ambiguous request naming 2 clips", err)
+	}
+}
+
+func TestParseClipRequestLocal(t *testing.T) {
+	tests := []struct {
+		input     string
+		wantStart string
+		wantEnd   string
+		wantOK    bool
+	}{
+		{"first 2 minutes", "00:00:00", "00:02:00", true},
+		{"Give me the first 90 seconds.", "00:00:00", "00:01:30", true},
+		{"first 1m30s", "00:00:00", "00:01:30", true},
+		{"first 1:30", "00:00:00", "00:01:30", true},
+		{"first 20 minutes", "00:00:00", "00:10:00", true},
+		{"last 45 seconds", "00:09:15", "00:10:00", true},
+		{"the last 2 mins", "00:08:00", "00:10:00", true},
+		{"last 1 hour", "00:00:00", "00:10:00", true},
+		{"from 3:00 to 5:30", "00:03:00", "00:05:30", true},
+		{"3:00-5:30", "00:03:00", "00:05:30", true},
+		{"from 0:01:00.500 until 0:02:00", "00:01:00.500", "00:02:00", true},
+		{"from 3 minutes to 5 minutes 30 seconds", "00:03:00", "00:05:30", true},
+		{"between 2 minutes and 3 minutes 10 seconds", "00:02:00", "00:03:10", true},
+		{"start at 1:23, end at 4:56", "00:01:23", "00:04:56", true},
+		{"from 8:00 to 15:00", "00:08:00", "00:10:00", true},
+		{"from 5:30 to 3:00", "", "", false},
+		{"from 12:00 to 13:00", "", "", false},
+		{"first 0 seconds", "", "", false},
+		{"first minute", "", "", false},
+		{"the part where she demos the app", "", "", false},
+		{"first 2 minutes and the last 30 seconds", "", "", false},
+		{"from 90 to 120", "", "", false},
+		{"the middle 50%", "00:02:30", "00:07:30", true},
+		{"first 10 percent", "00:00:00", "00:01:00", true},
+		{"last 12.5%", "00:08:45", "00:10:00", true},
+		{"first third", "00:00:00", "00:03:20", true},
+		{"middle third of the video", "00:03:20", "00:06:40", true},
+		{"last quarter", "00:07:30", "00:10:00", true},
+		{"first half of it", "00:00:00", "00:05:00", true},
+		{"first 100%", "00:00:00", "00:10:00", true},
+		{"first 0%", "", "", false},
+		{"middle 150%", "", "", false},
+		{"middle 2 minutes", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, ok := ParseClipRequestLocal(tt.input, 10*time.Minute)
+			if ok != tt.wantOK {
+				t.Fatalf("ParseClipRequestLocal(%q) ok = %v, want %v", tt.input, ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if got.StartTime != tt.wantStart || got.EndTime != tt.wantEnd {
+				t.Errorf("ParseClipRequestLocal(%q) = %s-%s, want %s-%s", tt.input, got.StartTime, got.EndTime, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+
+	// "Last" needs the video length
+	if _, ok := ParseClipRequestLocal("last 45 seconds", 0); ok {
+		t.Error("ParseClipRequestLocal(last 45 seconds) ok with an unknown video length")
+	}
+	if !CanParseLocally("last 45 seconds") || CanParseLocally("the good part") {
+		t.Error("CanParseLocally disagrees with ParseClipRequestLocal")
+	}
+
+	// So do shares of the video
+	if _, ok := ParseClipRequestLocal("middle 50%", 0); ok {
+		t.Error("ParseClipRequestLocal(middle 50%) ok with an unknown video length")
+	}
+	if !CanParseLocally("first third") {
+		t.Error("CanParseLocally(first third) = false, want true")
+	}
+}
+
+func TestWantsOneFile(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"clip minutes 1-2 and 5-6 into one file", true},
+		{"1:00-2:00 and 5:00-6:00 as a single video", true},
+		{"join 0:10-0:20 with 1:00-1:10", true},
+		{"Stitch the intro and the outro together", true},
+		{"make a highlight reel of 2:00-2:30 and 4:00-4:30", true},
+		{"minutes 1-2 and 5-6", false},
+		{"from 1:00 to 2:00, then 5:00 to 6:00", false},
+		{"combine them: 0:10-0:20 and 1:00-1:10", true},
+		{"merge the clips 1:00-2:00 and 3:00-4:00", true},
+		{"the part where they rejoin the call", false},
+		{"from when they join the call to 5:00, and 7:00-8:00", false},
+		{"where we combine flour and sugar, 1:00-2:00 and 5:00-6:00", false},
+		{"the merge conflict demo 1:00-2:00 and 4:00-5:00", false},
+	}
+
+	for _, tt := range tests {
+		if got := WantsOneFile(tt.input); got != tt.want {
+			t.Errorf("WantsOneFile(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseClipRequest_LocalFirst(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		json.NewEncoder(w).Encode(openAIResponse{
+			Choices: []openAIChoice{{Message: message{Role: "assistant", Content: `{"start_time": "00:00:00", "end_time": "00:01:00"}`}}},
+		})
+	}))
+	defer server.Close()
+
+	p := &Parser{provider: ProviderLocal, endpoint: server.URL, model: "test", client: server.Client()}
+	result, err := p.ParseClipRequest(context.Background(), "first 2 minutes", 10*time.Minute)
+	if err != nil {
+		t.Fatalf("ParseClipRequest() error: %v", err)
+	}
+	if requests != 0 || result.EndTime != "00:02:00" {
+		t.Errorf("got %s-%s after %d requests, want 00:00:00-00:02:00 without asking the provider", result.StartTime, result.EndTime, requests)
+	}
+
+	if !result.Local {
+		t.Error("Local = false for a clip parsed without the provider")
+	}
+
+	result, err = p.ParseClipRequest(context.Background(), "the intro", 10*time.Minute)
+	if err != nil {
+		t.Fatalf("ParseClipRequest() error: %v", err)
+	}
+	if requests != 1 || result.Local {
+		t.Errorf("requests = %d, Local = %v, want the provider asked for a prompt it can't parse locally", requests, result.Local)
+	}
+}
+
+func TestNewLocalOnlyParser(t *testing.T) {
+	setupErr := errors.New("no AI backend configured")
+	p := NewLocalOnlyParser(setupErr)
+
+	result, err := p.ParseClipRequest(context.Background(), "last 45 seconds", 10*time.Minute)
+	if err != nil {
+		t.Fatalf("ParseClipRequest() error: %v", err)
+	}
+	if result.StartTime != "00:09:15" || result.EndTime != "00:10:00" || !result.Local {
+		t.Errorf("got %s-%s (Local = %v), want 00:09:15-00:10:00 parsed locally", result.StartTime, result.EndTime, result.Local)
+	}
+
+	if _, err := p.ParseClipRequest(context.Background(), "the intro", 10*time.Minute); !errors.Is(err, setupErr) {
+		t.Errorf("ParseClipRequest() needing a provider = %v, want the setup error", err)
+	}
+}
+
+func TestParseClipRequest_Providers(t *testing.T) {
+	providers := []struct {
+		provider Provider
+		path     string
+	}{
+		{ProviderLocal, "/v1/chat/completions"},
+		{ProviderAzure, "/openai/responses"},
+		{ProviderAzureAnthropic, "/v1/messages"},
+		{ProviderAnthropic, "/v1/messages"},
+		{ProviderOpenAI, "/v1/chat/completions"},
+	}
+
+	tests := []struct {
+		name      string
+		status    int
+		content   string
+		wantStart string
+		wantEnd   string
+		wantErr   string
+		wantIs    error
+	}{
+		{
+			name:      "good response",
+			status:    http.StatusOK,
+			content:   `{"start_time": "00:01:00", "end_time": "00:02:30"}`,
+			wantStart: "00:01:00",
+			wantEnd:   "00:02:30",
+		},
+		{
+			name:      "fenced response",
+			status:    http.StatusOK,
+			content:   "```json\n{\"start_time\": \"00:00:00\", \"end_time\": \"00:00:45\"}\n```",
+			wantStart: "00:00:00",
+			wantEnd:   "00:00:45",
+		},
+		{
+			name:    "model reports error",
+			status:  http.StatusOK,
+			content: `{"start_time": "", "end_time": "", "error": "no times mentioned"}`,
+			wantErr: "no times mentioned",
+			wantIs:  ErrAmbiguousRequest,
+		},
+		{
+			name:    "malformed content",
+			status:  http.StatusOK,
+			content: `start at one minute please`,
+			wantErr: "failed to parse AI response",
+			wantIs:  ErrInvalidResponse,
+		},
+		{
+			name:    "server error status",
+			status:  http.StatusBadRequest,
+			wantErr: "request failed",
+		},
+		{
+			name:    "server unavailable",
+			status:  http.StatusServiceUnavailable,
+			wantErr: "request failed",
+			wantIs:  ErrProviderUnreachable,
+		},
+	}
+
+	for _, pr := range providers {
+		for _, tt := range tests {
+			t.Run(string(pr.provider)+"/"+tt.name, func(t *testing.T) {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.URL.Path != pr.path {
+						t.Errorf("request path = %q, want %q", r.URL.Path, pr.path)
+					}
+					if pr.provider == ProviderOpenAI && r.Header.Get("Authorization") != "Bearer test-key" {
+						t.Errorf("Authorization = %q, want the API key as a Bearer token", r.Header.Get("Authorization"))
+					}
+					if tt.status != http.StatusOK {
+						w.Header().Set("Content-Type", "application/json")
+						w.WriteHeader(tt.status)
+						w.Write([]byte(`{"type": "error", "error": {"type": "invalid_request_error", "message": "bad request"}}`))
+						return
+					}
+					providerReply(t, w, pr.provider, tt.content)
+				}))
+				defer server.Close()
+
+				p := newParserForTest(pr.provider, server.URL, "test-model")
+
+				// Exercise both the single-clip call and the progress-reporting
+				// one the CLI and TUI use
+				results := make([]*ClipRequest, 0, 2)
+				errs := make([]error, 0, 2)
+
+				result, err := p.ParseClipRequest(context.Background(), "the clip", 10*time.Minute)
+				results, errs = append(results, result), append(errs, err)
+
+				var updates int
+				clips, err := p.ParseClipRequestsWithProgress(context.Background(), "the clip", 10*time.Minute, func(ParserProgressUpdate) { updates++ })
+				result = nil
+				if len(clips) > 0 {
+					result = clips[0]
+				}
+				results, errs = append(results, result), append(errs, err)
+				if updates == 0 {
+					t.Error("ParseClipRequestsWithProgress() reported no progress")
+				}
+
+				for i := range results {
+					if tt.wantErr != "" {
+						if errs[i] == nil || !strings.Contains(errs[i].Error(), tt.wantErr) {
+							t.Errorf("call %d: error = %v, want it to contain %q", i, errs[i], tt.wantErr)
+						}
+						if tt.wantIs != nil && !errors.Is(errs[i], tt.wantIs) {
+							t.Errorf("call %d: error = %v, want errors.Is(%v)", i, errs[i], tt.wantIs)
+						}
+						for _, other := range []error{ErrAmbiguousRequest, ErrInvalidResponse, ErrProviderUnreachable} {
+							if other != tt.wantIs && errors.Is(errs[i], other) {
+								t.Errorf("call %d: error = %v also matches %v", i, errs[i], other)
+							}
+						}
+						continue
+					}
+					if errs[i] != nil {
+						t.Fatalf("call %d: unexpected error: %v", i, errs[i])
+					}
+					if results[i].StartTime != tt.wantStart || results[i].EndTime != tt.wantEnd {
+						t.Errorf("call %d: got %s-%s, want %s-%s", i, results[i].StartTime, results[i].EndTime, tt.wantStart, tt.wantEnd)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestParseClipRequest_Unreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	endpoint := server.URL
+	server.Close() // nothing listens here any more
+
+	p := newParserForTest(ProviderLocal, endpoint, "test-model")
+	_, err := p.ParseClipRequest(context.Background(), "first minute", 10*time.Minute)
+	if !errors.Is(err, ErrProviderUnreachable) {
+		t.Fatalf("error = %v, want ErrProviderUnreachable", err)
+	}
+	if !strings.Contains(ErrorGuidance(err), "running") {
+		t.Errorf("ErrorGuidance() = %q, want a hint to check the server", ErrorGuidance(err))
+	}
+}
+
+func TestErrorGuidance(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"ambiguous", classify(ErrAmbiguousRequest, errors.New("no times")), "rephrasing"},
+		{"invalid", classify(ErrInvalidResponse, errors.New("bad json")), "expected format"},
+		{"timeout", classify(ErrProviderUnreachable, fmt.Errorf("AI request failed: %w", context.DeadlineExceeded)), "AI_TIMEOUT"},
+		{"unauthorized", &ProviderError{StatusCode: http.StatusUnauthorized, Status: "401 Unauthorized"}, "API key"},
+		{"not found", &ProviderError{StatusCode: http.StatusNotFound, Status: "404 Not Found"}, "model name"},
+		{"server error", &ProviderError{StatusCode: http.StatusBadGateway, Status: "502 Bad Gateway"}, "running"},
+		{"other", errors.New("something else"), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ErrorGuidance(tt.err)
+			if tt.want == "" && got != "" || !strings.Contains(got, tt.want) {
+				t.Errorf("ErrorGuidance() = %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWithOpenAIStreaming(t *testing.T) {
+	t.Setenv(StreamEnvVar, "1")
+	pieces := []string{`{"start_time": `, `"00:00:00", `, `"end_time": "00:01:00"}`}
+
+	var got openAIRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, piece := range pieces {
+			chunk, _ := json.Marshal(llm.ChatChunk{Choices: []llm.ChatChunkChoice{{Delta: message{Content: piece}}}})
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	var partial []string
+	p := &Parser{provider: ProviderLocal, endpoint: server.URL, model: "test", client: server.Client()}
+	result, err := p.ParseClipRequestWithProgress(context.Background(), "the opening minute", 5*time.Minute, func(update ParserProgressUpdate) {
+		if update.Partial {
+			if update.Status != ParserStatusWaitingResponse {
+				t.Errorf("partial update has status %v, want waiting for response", update.Status)
+			}
+			partial = append(partial, update.Detail)
+		}
+	})
+	if err != nil {
+		t.Fatalf("ParseClipRequestWithProgress() error: %v", err)
+	}
+	if !got.Stream {
+		t.Error("request should ask for a stream")
+	}
+	if result.StartTime != "00:00:00" || result.EndTime != "00:01:00" {
+		t.Errorf("result = %s-%s, want 00:00:00-00:01:00", result.StartTime, result.EndTime)
+	}
+	if len(partial) == 0 || partial[len(partial)-1] != strings.Join(pieces, "") {
+		t.Errorf("partial updates = %q, want them to end with the whole answer", partial)
+	}
+}
+
+func TestParseWithOpenAIStreaming_NonStreamingServer(t *testing.T) {
+	t.Setenv(StreamEnvVar, "1")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(openAIResponse{
+			Choices: []openAIChoice{{Message: message{Role: "assistant", Content: `{"start_time": "00:00:00", "end_time": "00:01:00"}`}}},
+		})
+	}))
+	defer server.Close()
+
+	p := &Parser{provider: ProviderLocal, endpoint: server.URL, model: "test", client: server.Client()}
+	result, err := p.ParseClipRequest(context.Background(), "the opening minute", 5*time.Minute)
+	if err != nil {
+		t.Fatalf("ParseClipRequest() error: %v", err)
+	}
+	if result.EndTime != "00:01:00" {
+		t.Errorf("EndTime = %q, want 00:01:00", result.EndTime)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"capycut/ai"
+	"capycut/gemini"
+)
+
+// runConfigCommand handles the config subcommand
+func runConfigCommand(args []string) {
+	if len(args) == 0 {
+		printConfigHelp()
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "show":
+		if len(args) > 1 {
+			fmt.Println(errorStyle.Render("Error: unknown argument " + args[1]))
+			os.Exit(1)
+		}
+		if err := printConfig(os.Stdout); err != nil {
+			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			os.Exit(1)
+		}
+	case "-h", "--help":
+		printConfigHelp()
+	default:
+		fmt.Println(errorStyle.Render("Error: unknown config command " + args[0]))
+		fmt.Println(infoStyle.Render("Run 'capycut config --help' for usage information"))
+		os.Exit(1)
+	}
+}
+
+// printConfig prints the effective configuration: the config files found,
+// every setting that has a value and where it came from, and the
+// providers those settings resolve to. Secrets are masked.
+func printConfig(w io.Writer) error {
+	fmt.Fprintln(w, "Config files:")
+	for _, path := range configPaths() {
+		status := "not found"
+		if fileExists(path) {
+			status = "loaded"
+		}
+		fmt.Fprintf(w, "  %s (%s)\n", path, status)
+	}
+
+	if activeProfile != "" {
+		fmt.Fprintf(w, "  profile: %s\n", activeProfile)
+	}
+
+	fmt.Fprintln(w, "\nSettings:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	set := 0
+	for _, key := range configKeys {
+		value := os.Getenv(key.env)
+		if value == "" {
+			continue
+		}
+		if key.secret {
+			value = maskSecret(value)
+		}
+		source := envSources[key.env]
+		if source == "" {
+			source = "environment"
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", key.name, key.env, value, source)
+		set++
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if set == 0 {
+		fmt.Fprintln(w, "  (none set)")
+	}
+
+	fmt.Fprintln(w, "\nProviders:")
+	if parser, err := ai.NewParser(); err == nil {
+		fmt.Fprintf(w, "  Clip parser:   %s, model %s\n", parser.GetProviderDisplayName(), parser.GetModel())
+	} else {
+		fmt.Fprintf(w, "  Clip parser:   not configured (%v)\n", err)
+	}
+	if client, err := gemini.NewClientFromEnv(); err == nil {
+		fmt.Fprintf(w, "  Transcription: %s\n", client.GetProvider())
+	} else {
+		fmt.Fprintf(w, "  Transcription: not configured (%v)\n", err)
+	}
+	return nil
+}
+
+// printConfigHelp prints usage for the config subcommand
+func printConfigHelp() {
+	fmt.Print(`
+🦫 CapyCut Config - Inspect the configuration
+
+USAGE:
+    capycut config show     Print the effective settings, where each came
+                            from, and the providers they select (secrets
+                            are masked)
+    --profile <name>        Show them with a named profile applied
+
+Settings are read from ./capycut.yaml and ~/.config/capycut/config.yaml
+($XDG_CONFIG_HOME/capycut/config.yaml if set), with ./capycut.yaml winning.
+Keys are the environment variable names in lower case, e.g.
+
+    provider: openai
+    openai_api_key: sk-...
+    openai_model: gpt-4o-mini
+    ai_timeout: 90s
+
+except provider (LLM_PROVIDER) and the CAPYCUT_ settings, which drop the
+prefix (ca_cert, dir_mode, ...). Environment variables, .env and flags
+override the files.
+`)
+}
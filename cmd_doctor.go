@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"capycut/ai"
+	"capycut/gemini"
+	"capycut/llm"
+	"capycut/video"
+)
+
+// runDoctor prints the tools, providers and network settings capycut would
+// use, so a broken setup can be diagnosed without running a job
+func runDoctor(w io.Writer) {
+	fmt.Fprintln(w, "Tools:")
+	if v, err := video.DetectFFmpegVersion(); err == nil {
+		fmt.Fprintf(w, "  ffmpeg:        %s\n", v)
+	} else if video.CheckFFmpeg() == nil {
+		fmt.Fprintln(w, "  ffmpeg:        unknown version")
+	} else {
+		fmt.Fprintln(w, "  ffmpeg:        not found")
+	}
+	if video.CheckFFprobe() == nil {
+		fmt.Fprintln(w, "  ffprobe:       found")
+	} else {
+		fmt.Fprintln(w, "  ffprobe:       not found")
+	}
+
+	// Endpoints whose proxy is reported below
+	var endpoints []string
+
+	fmt.Fprintln(w, "\nProviders:")
+	if parser, err := ai.NewParser(); err == nil {
+		fmt.Fprintf(w, "  Clip parser:   %s, model %s\n", parser.GetProviderDisplayName(), parser.GetModel())
+		endpoints = append(endpoints, parser.GetEndpoint())
+	} else {
+		fmt.Fprintf(w, "  Clip parser:   not configured (%v)\n", err)
+	}
+	if client, err := gemini.NewClientFromEnv(); err == nil {
+		fmt.Fprintf(w, "  Transcription: %s\n", client.GetProvider())
+		endpoints = append(endpoints, client.GetBaseURL())
+	} else {
+		fmt.Fprintf(w, "  Transcription: not configured (%v)\n", err)
+	}
+
+	fmt.Fprintln(w, "\nNetwork:")
+	if caPath := os.Getenv(llm.CACertEnvVar); caPath != "" {
+		fmt.Fprintf(w, "  CA bundle:     %s (plus system roots)\n", caPath)
+	} else {
+		fmt.Fprintln(w, "  CA bundle:     system roots")
+	}
+	if insecure, err := llm.InsecureFromEnv(); err != nil {
+		fmt.Fprintf(w, "  TLS verify:    %v\n", err)
+	} else if insecure {
+		fmt.Fprintln(w, "  TLS verify:    DISABLED")
+	} else {
+		fmt.Fprintln(w, "  TLS verify:    on")
+	}
+	seen := make(map[string]bool)
+	for _, endpoint := range endpoints {
+		if endpoint == "" || seen[endpoint] {
+			continue
+		}
+		seen[endpoint] = true
+		fmt.Fprintf(w, "  Proxy:         %s -> %s\n", endpoint, describeProxy(endpoint))
+	}
+}
+
+// describeProxy reports the proxy HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+// select for endpoint, the same way the API clients resolve it
+func describeProxy(endpoint string) string {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "invalid URL"
+	}
+	proxy, err := http.ProxyFromEnvironment(req)
+	if err != nil {
+		return "invalid proxy setting: " + err.Error()
+	}
+	if proxy == nil {
+		return "direct"
+	}
+	// Keep proxy credentials out of the report
+	if proxy.User != nil {
+		proxy.User = nil
+		return proxy.String() + " (with credentials)"
+	}
+	return proxy.String()
+}
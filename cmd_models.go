@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"capycut/gemini"
+)
+
+// listModelsTimeout bounds the model list request; local servers answer
+// from memory and Gemini pages are small
+const listModelsTimeout = 30 * time.Second
+
+// runModelsCommand handles the models subcommand: it prints the models the
+// chosen (or auto-detected) transcription provider offers
+func runModelsCommand(args []string) {
+	var providerName string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--provider" && i+1 < len(args):
+			i++
+			providerName = args[i]
+		case strings.HasPrefix(arg, "--provider="):
+			providerName = strings.TrimPrefix(arg, "--provider=")
+		case arg == "--debug":
+			os.Setenv("CAPYCUT_DEBUG", "1")
+		case arg == "-h" || arg == "--help":
+			printModelsHelp()
+			os.Exit(0)
+		default:
+			fmt.Println(errorStyle.Render("Error: unknown argument " + arg))
+			fmt.Println(infoStyle.Render("Run 'capycut models --help' for usage information"))
+			os.Exit(1)
+		}
+	}
+
+	if err := listModels(providerName); err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		os.Exit(1)
+	}
+}
+
+// listModels prints a table of model IDs for a provider; an empty name
+// uses the provider transcription would pick
+func listModels(providerName string) error {
+	opts := []gemini.ClientOption{gemini.WithDebug(os.Getenv("CAPYCUT_DEBUG") != "")}
+
+	var client *gemini.Client
+	var err error
+	if providerName != "" {
+		provider, perr := gemini.ParseProvider(providerName)
+		if perr != nil {
+			return perr
+		}
+		client, err = gemini.NewClientForProviderFromEnv(provider, opts...)
+	} else {
+		client, err = gemini.NewClientFromEnv(opts...)
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), listModelsTimeout)
+	defer cancel()
+
+	models, err := client.ListModels(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list %s models: %w", client.GetProvider(), err)
+	}
+	if len(models) == 0 {
+		fmt.Println(infoStyle.Render(fmt.Sprintf("No models reported by %s", client.GetProvider())))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODEL\tNAME\tDETAILS")
+	for _, m := range models {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", m.ID, m.Name, m.Details)
+	}
+	return w.Flush()
+}
+
+// printModelsHelp prints usage for the models subcommand
+func printModelsHelp() {
+	fmt.Print(`
+🦫 CapyCut Models - List the models a provider offers
+
+USAGE:
+    capycut models [OPTIONS]
+    capycut --list-models [OPTIONS]
+
+OPTIONS:
+    --provider <name>       local, gemini, anthropic or azure_anthropic
+                            (default: the provider transcription would use)
+    --debug                 Enable debug output
+    -h, --help              Show this help message
+
+Gemini models come from the models API, local models from the server's
+/v1/models (or Ollama's /api/tags), and Claude models from a built-in list.
+`)
+}
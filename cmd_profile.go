@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+)
+
+// runProfileCommand handles the profile subcommand
+func runProfileCommand(args []string) {
+	if len(args) == 0 {
+		printProfileHelp()
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "list":
+		if len(args) > 1 {
+			fmt.Println(errorStyle.Render("Error: unknown argument " + args[1]))
+			os.Exit(1)
+		}
+		if err := listProfiles(os.Stdout, configPaths(), os.Getenv(ProfileEnvVar)); err != nil {
+			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			os.Exit(1)
+		}
+	case "-h", "--help":
+		printProfileHelp()
+	default:
+		fmt.Println(errorStyle.Render("Error: unknown profile command " + args[0]))
+		fmt.Println(infoStyle.Render("Run 'capycut profile --help' for usage information"))
+		os.Exit(1)
+	}
+}
+
+// listProfiles prints a table of the profiles defined in the config files
+// at paths, marking the active one with *
+func listProfiles(w io.Writer, paths []string, active string) error {
+	files, err := readConfigFiles(paths)
+	if err != nil {
+		return err
+	}
+
+	var profiles []*Profile
+	for _, f := range files {
+		for _, p := range f.Profiles {
+			profiles = append(profiles, p)
+		}
+	}
+	if len(profiles) == 0 {
+		fmt.Fprintln(w, infoStyle.Render("No profiles configured. Add them under 'profiles:' in "+paths[len(paths)-1]+" or run 'capycut --setup'"))
+		return nil
+	}
+	// Files are in precedence order, so keep that order within a name
+	sort.SliceStable(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  PROFILE\tPROVIDER\tMODEL\tFILE")
+	for _, p := range profiles {
+		marker := " "
+		if p.Name == active {
+			marker = "*"
+		}
+		provider := p.Provider()
+		if provider == "" {
+			provider = "(default)"
+		}
+		model := p.Model()
+		if model == "" {
+			model = "-"
+		}
+		fmt.Fprintf(tw, "%s %s\t%s\t%s\t%s\n", marker, p.Name, provider, model, p.Path)
+	}
+	return tw.Flush()
+}
+
+// printProfileHelp prints usage for the profile subcommand
+func printProfileHelp() {
+	fmt.Print(`
+🦫 CapyCut Profiles - Named sets of provider settings
+
+USAGE:
+    capycut profile list    Show the configured profiles and the provider
+                            each uses (* marks CAPYCUT_PROFILE)
+
+Profiles live under a profiles key in ./capycut.yaml or
+~/.config/capycut/config.yaml and take the same keys as the top level:
+
+    profiles:
+      home:
+        provider: local
+        llm_endpoint: http://localhost:1234
+        llm_model: qwen2.5-7b-instruct
+      work:
+        provider: azure
+        azure_openai_endpoint: https://my-resource.openai.azure.com
+        azure_openai_api_key: ...
+        azure_openai_model: gpt-4o
+
+Select one with --profile <name> (on any command) or CAPYCUT_PROFILE. Its
+settings override the top-level ones, and top-level settings for other
+providers are ignored. 'capycut --setup' can save into a profile.
+`)
+}
@@ -6,10 +6,13 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"capycut/fsmode"
 	"capycut/gemini"
+	"capycut/llm"
 	"capycut/tui"
 
 	"github.com/charmbracelet/bubbles/table"
@@ -23,11 +26,12 @@ import (
 type TranscribeOptions struct {
 	Images                   []string
 	OutputDir                string
-	Provider                 gemini.Provider // AI provider to use (gemini, local, azure_anthropic)
+	Provider                 gemini.Provider // AI provider to use (gemini, local, azure_anthropic, anthropic)
 	Model                    string
 	TextModel                string // For two-stage pipeline: text/agentic model for refinement
 	Language                 string
 	DetectChapters           bool
+	ChapterSensitivity       gemini.ChapterSensitivity // Heuristic chapter detection level (empty = medium)
 	CombinePages             bool
 	PreserveFormatting       bool
 	IncludeImageDescriptions bool
@@ -35,6 +39,26 @@ type TranscribeOptions struct {
 	AddTableOfContents       bool
 	CreateIndexFile          bool
 	Overwrite                bool
+	NameTemplate             string                // Output filename template, e.g. "{index}-{title}-{date}.md"
+	IndexTitle               string                // Heading for index.md
+	RawJSON                  bool                  // Also write the raw page JSON to pages.json
+	FromJSON                 string                // Re-organize a saved pages.json instead of transcribing
+	MaxOutputTokens          int                   // Output token budget per batch (0 = provider default)
+	Temperature              *float64              // Sampling temperature (nil = default)
+	TopP                     *float64              // Nucleus sampling (nil = provider default)
+	Formats                  []gemini.OutputFormat // Document file formats, primary first (empty = markdown)
+	BatchSize                int                   // Images per cloud request (0 = MaxImagesPerRequest)
+	BatchPayloadSize         int64                 // Estimated bytes per cloud request (0 = MaxPayloadSize)
+	SplitSpreads             bool                  // Cut landscape two-page spreads into left/right pages
+	DPI                      int                   // Resolution PDF pages are rendered at (0 = gemini.DefaultPDFDPI)
+	StripRunningHeads        bool                  // Remove headers/footers repeated across pages
+	DedupePages              bool                  // Transcribe byte-identical images once
+	ExtractTables            bool                  // Also write each markdown table to a CSV file
+	ResumeFrom               string                // Checkpoint directory; finished batches are saved and reused
+	Recursive                bool                  // Walk subdirectories of folder sources
+	MaxDepth                 int                   // Subdirectory levels to walk (0 = unlimited)
+	StyleGuide               string                // House style rules loaded from --style-guide
+	StyleGuideInVision       bool                  // Also send the style guide to the vision model
 }
 
 // ============================================================================
@@ -138,7 +162,7 @@ func (m *fileBrowserModel) loadDirectory(dir string) {
 		})
 	}
 
-	// Sort: directories first, then alphabetically
+	// Sort: directories first, then in natural order
 	sort.Slice(m.files, func(i, j int) bool {
 		if m.files[i].name == ".." {
 			return true
@@ -149,7 +173,7 @@ func (m *fileBrowserModel) loadDirectory(dir string) {
 		if m.files[i].isDir != m.files[j].isDir {
 			return m.files[i].isDir
 		}
-		return strings.ToLower(m.files[i].name) < strings.ToLower(m.files[j].name)
+		return gemini.NaturalLess(m.files[i].name, m.files[j].name)
 	})
 
 	m.currentDir = dir
@@ -320,6 +344,8 @@ func runTranscribeWorkflowNew() bool {
 // runTranscribeWorkflow runs the interactive image transcription workflow
 // Uses the new Bubble Tea TUI by default. Set CAPYCUT_LEGACY_UI=1 to use the old UI.
 func runTranscribeWorkflow() bool {
+	defer gemini.CleanupTempFiles()
+
 	// Use the new TUI by default, unless user explicitly wants the legacy UI
 	if os.Getenv("CAPYCUT_LEGACY_UI") != "1" {
 		return runTranscribeWorkflowNew()
@@ -346,7 +372,7 @@ func runTranscribeWorkflow() bool {
 
 	if err != nil {
 		if err == huh.ErrUserAborted {
-			return false
+			return true // Back out to the main menu
 		}
 		fmt.Println(errorStyle.Render("Error: " + err.Error()))
 		return askToContinueTranscribe()
@@ -371,7 +397,7 @@ func runTranscribeWorkflow() bool {
 		var pattern string
 		patternInput := huh.NewInput().
 			Title("Enter file paths or glob pattern").
-			Description("Examples:\n  • /path/to/images/*.png\n  • ./scans/page_*.jpg\n  • /path/to/folder").
+			Description("Examples:\n  • /path/to/images/*.png\n  • ./scans/page_{001..010}.jpg\n  • ./scans/{*.png,*.jpg}\n  • /path/to/folder ./more/*.png").
 			Placeholder("./images/*.png").
 			Value(&pattern)
 
@@ -387,7 +413,7 @@ func runTranscribeWorkflow() bool {
 			return askToContinueTranscribe()
 		}
 
-		imageSources = []string{pattern}
+		imageSources = gemini.SplitPatterns(pattern)
 	}
 
 	// Load and validate images
@@ -429,6 +455,29 @@ func runTranscribeWorkflow() bool {
 	var opts TranscribeOptions
 	opts.Images = images
 
+	// Offer to split scanned two-page spreads, which models read in the
+	// wrong column order when left whole
+	if spreads := gemini.FindSpreads(images); len(spreads) > 0 {
+		splitConfirm := huh.NewConfirm().
+			Title(fmt.Sprintf("%d landscape images look like two-page spreads", len(spreads))).
+			Description("Split each into left and right pages before transcribing?").
+			Affirmative("Yes, split").
+			Negative("No, keep whole").
+			Value(&opts.SplitSpreads)
+
+		err = huh.NewForm(huh.NewGroup(splitConfirm)).
+			WithTheme(huh.ThemeCatppuccin()).
+			Run()
+
+		if err != nil {
+			if err == huh.ErrUserAborted {
+				return askToContinueTranscribe()
+			}
+			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			return askToContinueTranscribe()
+		}
+	}
+
 	// Output directory
 	var outputDir string
 	outputInput := huh.NewInput().
@@ -482,10 +531,7 @@ func runTranscribeWorkflow() bool {
 
 	if opts.Provider == gemini.ProviderLocal {
 		// For local LLM, let user specify model or use default from env
-		defaultModel := os.Getenv("LLM_MODEL")
-		if defaultModel == "" {
-			defaultModel = "local-model"
-		}
+		defaultModel := gemini.DefaultModelFor(gemini.ProviderLocal)
 		modelSelect = huh.NewSelect[string]().
 			Title("Select vision model").
 			Description("Vision model for image scanning (must support images)").
@@ -516,9 +562,12 @@ func runTranscribeWorkflow() bool {
 				huh.NewOption("deepseek-r1 (DeepSeek R1)", "deepseek-r1"),
 			).
 			Value(&textModelChoice)
-	} else if opts.Provider == gemini.ProviderAzureAnthropic {
-		// For Azure Anthropic (Claude), show Claude model options
+	} else if opts.Provider == gemini.ProviderAzureAnthropic || opts.Provider == gemini.ProviderAnthropic {
+		// For Claude, directly or through Azure, show Claude model options
 		envModel := os.Getenv("AZURE_ANTHROPIC_MODEL")
+		if opts.Provider == gemini.ProviderAnthropic {
+			envModel = os.Getenv("ANTHROPIC_MODEL")
+		}
 
 		// Build options list
 		claudeOptions := []huh.Option[string]{}
@@ -531,14 +580,11 @@ func runTranscribeWorkflow() bool {
 		}
 
 		// Add standard Claude models with raw IDs shown
-		claudeOptions = append(claudeOptions,
-			huh.NewOption("Claude Sonnet 4.5 (claude-sonnet-4-5-20250514)", "claude-sonnet-4-5-20250514"),
-			huh.NewOption("Claude Sonnet 4 (claude-sonnet-4-20250514)", "claude-sonnet-4-20250514"),
-			huh.NewOption("Claude 3.5 Sonnet (claude-3-5-sonnet-20241022)", "claude-3-5-sonnet-20241022"),
-			huh.NewOption("Claude 3 Opus (claude-3-opus-20240229)", "claude-3-opus-20240229"),
-			huh.NewOption("Claude 3 Sonnet (claude-3-sonnet-20240229)", "claude-3-sonnet-20240229"),
-			huh.NewOption("Claude 3 Haiku (claude-3-haiku-20240307)", "claude-3-haiku-20240307"),
-		)
+		for _, m := range gemini.KnownAnthropicModels {
+			claudeOptions = append(claudeOptions,
+				huh.NewOption(fmt.Sprintf("%s (%s)", m.Name, m.ID), m.ID),
+			)
+		}
 
 		modelSelect = huh.NewSelect[string]().
 			Title("Select Claude model").
@@ -650,19 +696,27 @@ func runTranscribeWorkflow() bool {
 		modelInfo = fmt.Sprintf("%s (vision) + %s (text)", opts.Model, opts.TextModel)
 	}
 
+	// The estimate is only a guide, so a failure just leaves it out
+	estimate, err := estimateTranscription(opts)
+	if err != nil {
+		estimate = "unavailable (" + err.Error() + ")"
+	}
+
 	summaryBox := boxStyle.Render(fmt.Sprintf(
 		"📋 Transcription Summary\n\n"+
 			"Images:     %d files (%s)\n"+
 			"Provider:   %s\n"+
 			"Model:      %s\n"+
 			"Output:     %s\n"+
-			"Mode:       %s",
+			"Mode:       %s\n"+
+			"Estimate:   %s",
 		len(images),
 		gemini.FormatSize(totalSize),
 		providerInfo,
 		modelInfo,
 		opts.OutputDir,
 		getOrganizationMode(opts),
+		estimate,
 	))
 	fmt.Println(summaryBox)
 
@@ -686,6 +740,93 @@ func runTranscribeWorkflow() bool {
 	return runTranscription(opts)
 }
 
+// estimateTranscription forecasts the tokens, cost and time of a run for
+// the confirm box. It builds a client for the chosen provider from the same
+// environment the run reads, without contacting it.
+func estimateTranscription(opts TranscribeOptions) (string, error) {
+	clientOpts := batchClientOptions(opts)
+	if opts.Model != "" {
+		clientOpts = append(clientOpts, gemini.WithModel(opts.Model))
+	}
+	if opts.TextModel != "" {
+		clientOpts = append(clientOpts, gemini.WithTextModel(opts.TextModel))
+	}
+	client, err := gemini.NewClientForProviderFromEnv(opts.Provider, clientOpts...)
+	if err != nil {
+		return "", err
+	}
+
+	localResize, err := gemini.LocalResizeFromEnv()
+	if err != nil {
+		return "", err
+	}
+	thinkingBudget, err := gemini.ThinkingBudgetFromEnv()
+	if err != nil {
+		return "", err
+	}
+	concurrency, err := gemini.ConcurrencyFromEnv()
+	if err != nil {
+		return "", err
+	}
+
+	estimate, err := client.EstimateTranscription(&gemini.TranscribeRequest{
+		Images:                   opts.Images,
+		Model:                    opts.Model,
+		PreserveFormatting:       opts.PreserveFormatting,
+		IncludeImageDescriptions: opts.IncludeImageDescriptions,
+		SplitSpreads:             opts.SplitSpreads,
+		StyleGuide:               opts.StyleGuide,
+		StyleGuideInVision:       opts.StyleGuideInVision,
+		MaxOutputTokens:          opts.MaxOutputTokens,
+		LocalResize:              &localResize,
+		ThinkingBudget:           thinkingBudget,
+		Concurrency:              concurrency,
+	})
+	if err != nil {
+		return "", err
+	}
+	return estimate.Summary(client.GetProvider()), nil
+}
+
+// batchClientOptions turns the --batch-size and --batch-payload-mb flags into
+// client options; provider limits are checked when the client is built
+func batchClientOptions(opts TranscribeOptions) []gemini.ClientOption {
+	var clientOpts []gemini.ClientOption
+	if opts.BatchSize > 0 {
+		clientOpts = append(clientOpts, gemini.WithBatchSize(opts.BatchSize))
+	}
+	if opts.BatchPayloadSize > 0 {
+		clientOpts = append(clientOpts, gemini.WithBatchPayloadSize(opts.BatchPayloadSize))
+	}
+	return clientOpts
+}
+
+// warnIfNotVisionModel checks that a local model can read images before any
+// batch is sent, and prints what it finds. The transcription still runs: the
+// check can be wrong, and a failure to reach the server surfaces on its own.
+func warnIfNotVisionModel(client *gemini.Client) {
+	if !gemini.PreflightEnabled() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), gemini.PreflightTimeout)
+	defer cancel()
+
+	result, err := client.Preflight(ctx)
+	if err != nil {
+		if os.Getenv("CAPYCUT_DEBUG") != "" {
+			fmt.Printf("[DEBUG] Preflight failed: %v\n", err)
+		}
+		return
+	}
+	for _, warning := range result.Warnings {
+		fmt.Println(infoStyle.Render("⚠️  " + warning))
+	}
+	if len(result.Warnings) > 0 {
+		fmt.Println(infoStyle.Render(fmt.Sprintf("   Set %s=1 to skip this check", gemini.SkipPreflightEnvVar)))
+	}
+}
+
 // runTranscription executes the transcription with the given options
 func runTranscription(opts TranscribeOptions) bool {
 	// Create client based on selected provider
@@ -695,10 +836,63 @@ func runTranscription(opts TranscribeOptions) bool {
 	clientOpts := []gemini.ClientOption{
 		gemini.WithDebug(os.Getenv("CAPYCUT_DEBUG") != ""),
 	}
+	requestTimeout, err := gemini.RequestTimeoutFromEnv()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return askToContinueTranscribe()
+	}
+	if requestTimeout > 0 {
+		clientOpts = append(clientOpts, gemini.WithTimeout(requestTimeout))
+	}
+	memLimit, err := gemini.MemoryLimitFromEnv()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return askToContinueTranscribe()
+	}
+	if memLimit > 0 {
+		clientOpts = append(clientOpts, gemini.WithMemoryLimit(memLimit))
+	}
+	jobTimeout, err := gemini.JobTimeoutFor(len(opts.Images))
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return askToContinueTranscribe()
+	}
+	if os.Getenv("CAPYCUT_DEBUG") != "" {
+		fmt.Printf("[DEBUG] Job deadline: %s for %d images\n", jobTimeout, len(opts.Images))
+	}
+	localResize, err := gemini.LocalResizeFromEnv()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return askToContinueTranscribe()
+	}
+	thinkingBudget, err := gemini.ThinkingBudgetFromEnv()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return askToContinueTranscribe()
+	}
+	concurrency, err := gemini.ConcurrencyFromEnv()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return askToContinueTranscribe()
+	}
+	fallbacks, err := gemini.FallbackClientsFromEnv(opts.Provider, clientOpts...)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return askToContinueTranscribe()
+	}
+	if len(fallbacks) > 0 {
+		clientOpts = append(clientOpts, gemini.WithFallback(fallbacks...))
+	}
 	// If user selected a text model in UI, override the env var setting
 	if opts.TextModel != "" {
 		clientOpts = append(clientOpts, gemini.WithTextModel(opts.TextModel))
 	}
+	clientOpts = append(clientOpts, batchClientOptions(opts)...)
+
+	// Never send an empty model; each provider has its own default
+	if opts.Model == "" {
+		opts.Model = gemini.DefaultModelFor(opts.Provider)
+	}
 
 	switch opts.Provider {
 	case gemini.ProviderLocal:
@@ -725,6 +919,19 @@ func runTranscription(opts TranscribeOptions) bool {
 		}
 		client, err = gemini.NewAzureAnthropicClient(endpoint, apiKey, opts.Model, clientOpts...)
 
+	case gemini.ProviderAnthropic:
+		// Use Anthropic (Claude) directly
+		apiKey := os.Getenv("ANTHROPIC_API_KEY")
+		if apiKey == "" {
+			fmt.Println(errorStyle.Render("Error: Anthropic not configured"))
+			fmt.Println(infoStyle.Render("Set the ANTHROPIC_API_KEY environment variable"))
+			return askToContinueTranscribe()
+		}
+		if baseURL := os.Getenv("ANTHROPIC_BASE_URL"); baseURL != "" {
+			clientOpts = append(clientOpts, gemini.WithBaseURL(baseURL))
+		}
+		client, err = gemini.NewAnthropicClient(apiKey, opts.Model, clientOpts...)
+
 	default:
 		// Use Gemini (default)
 		apiKey := os.Getenv("GEMINI_API_KEY")
@@ -744,6 +951,7 @@ func runTranscription(opts TranscribeOptions) bool {
 		fmt.Println(infoStyle.Render(gemini.GetAPIKeyHelp()))
 		return askToContinueTranscribe()
 	}
+	warnIfNotVisionModel(client)
 
 	// Build request
 	req := &gemini.TranscribeRequest{
@@ -751,9 +959,23 @@ func runTranscription(opts TranscribeOptions) bool {
 		OutputDir:                opts.OutputDir,
 		Model:                    opts.Model,
 		DetectChapters:           opts.DetectChapters,
+		ChapterSensitivity:       opts.ChapterSensitivity,
 		CombinePages:             opts.CombinePages,
 		PreserveFormatting:       opts.PreserveFormatting,
 		IncludeImageDescriptions: opts.IncludeImageDescriptions,
+		SplitSpreads:             opts.SplitSpreads,
+		StripRunningHeads:        opts.StripRunningHeads,
+		DedupePages:              opts.DedupePages,
+		ExtractTables:            opts.ExtractTables,
+		ResumeFrom:               opts.ResumeFrom,
+		StyleGuide:               opts.StyleGuide,
+		StyleGuideInVision:       opts.StyleGuideInVision,
+		MaxOutputTokens:          opts.MaxOutputTokens,
+		Temperature:              opts.Temperature,
+		TopP:                     opts.TopP,
+		LocalResize:              &localResize,
+		ThinkingBudget:           thinkingBudget,
+		Concurrency:              concurrency,
 	}
 
 	// Show AI status box before transcription
@@ -790,6 +1012,8 @@ func runTranscription(opts TranscribeOptions) bool {
 		if newStatus != lastStatus {
 			if os.Getenv("CAPYCUT_DEBUG") != "" {
 				fmt.Printf("\n   AI Status: %s\n", newStatus)
+			} else if update.Status == gemini.StatusWarning {
+				fmt.Println(infoStyle.Render("\n⚠️  " + update.Message + ": " + update.Detail))
 			}
 			lastStatus = newStatus
 		}
@@ -798,17 +1022,45 @@ func runTranscription(opts TranscribeOptions) bool {
 	// Determine spinner message based on provider and pipeline mode
 	spinnerMsg := fmt.Sprintf("🔍 Transcribing %d images with %s...", len(opts.Images), providerName)
 
+	dirMode, fileMode, err := fsmode.FromEnv()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return askToContinueTranscribe()
+	}
+
+	// Write documents as batches finish so early pages can be read
+	stream, err := gemini.NewStreamWriter(req, gemini.WriteOptions{
+		OutputDir:          opts.OutputDir,
+		Overwrite:          opts.Overwrite,
+		AddFrontMatter:     opts.AddFrontMatter,
+		AddTableOfContents: opts.AddTableOfContents,
+		CreateIndexFile:    opts.CreateIndexFile,
+		IndexTitle:         opts.IndexTitle,
+		OutputTemplate:     opts.NameTemplate,
+		Formats:            opts.Formats,
+		DirMode:            dirMode,
+		FileMode:           fileMode,
+	})
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return askToContinueTranscribe()
+	}
+	req.OnBatchComplete = stream.AddBatch
+
 	err = spinner.New().
 		Title(spinnerMsg).
 		Action(func() {
-			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+			ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
 			defer cancel()
 			resp, transcribeErr = client.TranscribeImagesWithProgress(ctx, req, onProgress)
 		}).
 		Run()
 
+	writeResult, writeErr := stream.Close(rawPages(resp, opts.RawJSON))
+
 	if transcribeErr != nil {
 		fmt.Println(errorStyle.Render("Transcription failed: " + transcribeErr.Error()))
+		printPartialOutput(writeResult)
 		return askToContinueTranscribe()
 	}
 
@@ -820,21 +1072,25 @@ func runTranscription(opts TranscribeOptions) bool {
 	// Show AI completion
 	fmt.Println(successStyle.Render("✓ AI processing complete"))
 
-	// Write documents
-	fmt.Println(infoStyle.Render("\n📝 Writing markdown files..."))
+	if writeErr != nil {
+		fmt.Println(errorStyle.Render("Error writing files: " + writeErr.Error()))
+		return askToContinueTranscribe()
+	}
 
-	writeResult, err := gemini.WriteDocuments(resp.Documents, gemini.WriteOptions{
-		OutputDir:          opts.OutputDir,
-		Overwrite:          opts.Overwrite,
-		AddFrontMatter:     opts.AddFrontMatter,
-		AddTableOfContents: opts.AddTableOfContents,
-		CreateIndexFile:    opts.CreateIndexFile,
-		Verbose:            true,
-	})
+	// Files were written behind the spinner, so list them now
+	fmt.Println(infoStyle.Render("\n📝 Wrote markdown files:"))
+	for _, path := range writeResult.FilesWritten {
+		fmt.Printf("  Wrote: %s\n", path)
+	}
 
-	if err != nil {
-		fmt.Println(errorStyle.Render("Error writing files: " + err.Error()))
-		return askToContinueTranscribe()
+	if resp.ResumedBatches > 0 {
+		fmt.Println(infoStyle.Render(fmt.Sprintf("♻️  Restored %d batches from the checkpoint", resp.ResumedBatches)))
+	}
+	if summary := resp.ProviderSummary(); summary != "" {
+		fmt.Println(infoStyle.Render("⚠️  Provider fallback used: " + summary))
+	}
+	if summary := resp.RefinementSummary(); summary != "" {
+		fmt.Println(infoStyle.Render("⚠️  Text refinement failed for " + summary + ", using vision output"))
 	}
 
 	// Report errors if any
@@ -872,31 +1128,47 @@ func runTranscription(opts TranscribeOptions) bool {
 }
 
 // runNonInteractiveTranscribe runs transcription in non-interactive mode
-func runNonInteractiveTranscribe(sources []string, outputDir, model string, detectChapters, combine bool) {
-	// Load images
+func runNonInteractiveTranscribe(sources []string, opts *TranscribeOptions) {
+	outputDir := opts.OutputDir
+	model := opts.Model
+
+	// Load images. A failed load may have extracted some sources already,
+	// so exit through exitTranscribe to remove them.
 	fmt.Println(infoStyle.Render("Loading images..."))
-	images, err := gemini.LoadImages(sources)
+	defer gemini.CleanupTempFiles()
+	images, err := gemini.LoadImagesWithOptions(sources, gemini.LoadOptions{
+		Recursive: opts.Recursive,
+		MaxDepth:  opts.MaxDepth,
+		DPI:       opts.DPI,
+	})
 	if err != nil {
 		fmt.Println(errorStyle.Render("Error: " + err.Error()))
-		os.Exit(1)
+		exitTranscribe(1)
 	}
 
 	totalSize, count, _ := gemini.GetImageStats(images)
 	fmt.Println(infoStyle.Render(fmt.Sprintf("Found %d images (%s)", count, gemini.FormatSize(totalSize))))
+	if !opts.SplitSpreads {
+		if spreads := gemini.FindSpreads(images); len(spreads) > 0 {
+			fmt.Println(infoStyle.Render(fmt.Sprintf("⚠️  %d images look like two-page spreads; use --split-spreads to transcribe them as separate pages", len(spreads))))
+		}
+	}
 
 	// Create client
-	client, err := gemini.NewClientFromEnv(
+	clientOpts := append([]gemini.ClientOption{
 		gemini.WithDebug(os.Getenv("CAPYCUT_DEBUG") != ""),
-	)
+	}, batchClientOptions(*opts)...)
+	client, err := gemini.NewClientFromEnv(clientOpts...)
 	if err != nil {
 		fmt.Println(errorStyle.Render("Error: " + err.Error()))
 		fmt.Println(infoStyle.Render(gemini.GetAPIKeyHelp()))
-		os.Exit(1)
+		exitTranscribe(1)
 	}
+	warnIfNotVisionModel(client)
 
 	// Set defaults
 	if model == "" {
-		model = gemini.ModelGemini3Pro
+		model = gemini.DefaultModelFor(client.GetProvider())
 	}
 	if outputDir == "" {
 		outputDir = "./output"
@@ -915,14 +1187,52 @@ func runNonInteractiveTranscribe(sources []string, outputDir, model string, dete
 	))
 	fmt.Println(aiStatusBox)
 
+	jobTimeout, err := gemini.JobTimeoutFor(len(images))
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		exitTranscribe(1)
+	}
+	if os.Getenv("CAPYCUT_DEBUG") != "" {
+		fmt.Printf("[DEBUG] Job deadline: %s for %d images\n", jobTimeout, len(images))
+	}
+	localResize, err := gemini.LocalResizeFromEnv()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		exitTranscribe(1)
+	}
+	thinkingBudget, err := gemini.ThinkingBudgetFromEnv()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		exitTranscribe(1)
+	}
+	concurrency, err := gemini.ConcurrencyFromEnv()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		exitTranscribe(1)
+	}
+
 	// Build request
 	req := &gemini.TranscribeRequest{
 		Images:             images,
 		OutputDir:          outputDir,
 		Model:              model,
-		DetectChapters:     detectChapters,
-		CombinePages:       combine,
+		DetectChapters:     opts.DetectChapters,
+		ChapterSensitivity: opts.ChapterSensitivity,
+		CombinePages:       opts.CombinePages,
 		PreserveFormatting: true,
+		SplitSpreads:       opts.SplitSpreads,
+		StripRunningHeads:  opts.StripRunningHeads,
+		DedupePages:        opts.DedupePages,
+		ExtractTables:      opts.ExtractTables,
+		ResumeFrom:         opts.ResumeFrom,
+		StyleGuide:         opts.StyleGuide,
+		StyleGuideInVision: opts.StyleGuideInVision,
+		MaxOutputTokens:    opts.MaxOutputTokens,
+		Temperature:        opts.Temperature,
+		TopP:               opts.TopP,
+		LocalResize:        &localResize,
+		ThinkingBudget:     thinkingBudget,
+		Concurrency:        concurrency,
 	}
 
 	// Progress callback
@@ -931,33 +1241,68 @@ func runNonInteractiveTranscribe(sources []string, outputDir, model string, dete
 		if update.Detail != "" {
 			statusLine += " - " + update.Detail
 		}
+		// Warnings get their own line so the next status doesn't overwrite them
+		if update.Status == gemini.StatusWarning {
+			fmt.Printf("\r%s\n", statusLine)
+			return
+		}
 		fmt.Printf("\r%s", statusLine)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
 	defer cancel()
 
+	dirMode, fileMode, err := fsmode.FromEnv()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		exitTranscribe(1)
+	}
+
+	// Write documents as batches finish so early pages can be read
+	stream, err := gemini.NewStreamWriter(req, gemini.WriteOptions{
+		OutputDir:       outputDir,
+		Overwrite:       true,
+		CreateIndexFile: true,
+		ForceIndex:      opts.CreateIndexFile,
+		IndexTitle:      opts.IndexTitle,
+		OutputTemplate:  opts.NameTemplate,
+		Formats:         opts.Formats,
+		DirMode:         dirMode,
+		FileMode:        fileMode,
+	})
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		exitTranscribe(1)
+	}
+	req.OnBatchComplete = stream.AddBatch
+
 	startTime := time.Now()
 	resp, err := client.TranscribeImagesWithProgress(ctx, req, onProgress)
 	fmt.Println() // New line after progress updates
 
+	writeResult, writeErr := stream.Close(rawPages(resp, opts.RawJSON))
+
 	if err != nil {
 		fmt.Println(errorStyle.Render("Transcription failed: " + err.Error()))
-		os.Exit(1)
+		printPartialOutput(writeResult)
+		exitTranscribe(1)
 	}
 
 	fmt.Println(successStyle.Render("✓ AI processing complete"))
 
-	// Write documents
-	writeResult, err := gemini.WriteDocuments(resp.Documents, gemini.WriteOptions{
-		OutputDir:       outputDir,
-		Overwrite:       true,
-		CreateIndexFile: len(resp.Documents) > 1,
-	})
+	if writeErr != nil {
+		fmt.Println(errorStyle.Render("Error writing files: " + writeErr.Error()))
+		exitTranscribe(1)
+	}
 
-	if err != nil {
-		fmt.Println(errorStyle.Render("Error writing files: " + err.Error()))
-		os.Exit(1)
+	if resp.ResumedBatches > 0 {
+		fmt.Println(infoStyle.Render(fmt.Sprintf("♻️  Restored %d batches from the checkpoint", resp.ResumedBatches)))
+	}
+	if summary := resp.ProviderSummary(); summary != "" {
+		fmt.Println(infoStyle.Render("⚠️  Provider fallback used: " + summary))
+	}
+	if summary := resp.RefinementSummary(); summary != "" {
+		fmt.Println(infoStyle.Render("⚠️  Text refinement failed for " + summary + ", using vision output"))
 	}
 
 	// Success
@@ -975,6 +1320,88 @@ func runNonInteractiveTranscribe(sources []string, outputDir, model string, dete
 	}
 }
 
+// printPartialOutput lists files a failed job had already written
+func printPartialOutput(result *gemini.WriteResult) {
+	if result == nil || len(result.FilesWritten) == 0 {
+		return
+	}
+	fmt.Println(infoStyle.Render(fmt.Sprintf("⚠️  Kept %d files written before the failure:", len(result.FilesWritten))))
+	for _, path := range result.FilesWritten {
+		fmt.Println(infoStyle.Render("  • " + path))
+	}
+}
+
+// exitTranscribe removes images extracted from zip sources or downloaded
+// from URLs before exiting, since os.Exit skips deferred cleanup
+func exitTranscribe(code int) {
+	gemini.CleanupTempFiles()
+	os.Exit(code)
+}
+
+// runOrganizeFromJSON re-organizes pages saved by --raw-json and writes the
+// documents, making no API calls
+func runOrganizeFromJSON(opts *TranscribeOptions) {
+	outputDir := opts.OutputDir
+	if outputDir == "" {
+		outputDir = "./output"
+	}
+
+	pages, err := gemini.LoadPagesFile(opts.FromJSON)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		os.Exit(1)
+	}
+	fmt.Println(infoStyle.Render(fmt.Sprintf("Loaded %d pages from %s (%s)", len(pages), opts.FromJSON, getOrganizationMode(*opts))))
+
+	if opts.StripRunningHeads {
+		removed := gemini.StripRunningHeads(pages)
+		fmt.Println(infoStyle.Render(fmt.Sprintf("Stripped %d running header/footer lines", removed)))
+	}
+
+	docs := gemini.OrganizePages(pages, &gemini.TranscribeRequest{
+		OutputDir:          outputDir,
+		DetectChapters:     opts.DetectChapters,
+		ChapterSensitivity: opts.ChapterSensitivity,
+		CombinePages:       opts.CombinePages,
+		ExtractTables:      opts.ExtractTables,
+	})
+
+	var raw []*gemini.PageContent
+	if opts.RawJSON {
+		raw = pages
+	}
+	dirMode, fileMode, err := fsmode.FromEnv()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		os.Exit(1)
+	}
+	writeResult, err := gemini.WriteDocuments(docs, gemini.WriteOptions{
+		OutputDir:       outputDir,
+		Overwrite:       true,
+		CreateIndexFile: len(docs) > 1 || opts.CreateIndexFile,
+		ForceIndex:      opts.CreateIndexFile,
+		IndexTitle:      opts.IndexTitle,
+		OutputTemplate:  opts.NameTemplate,
+		RawPages:        raw,
+		Formats:         opts.Formats,
+		DirMode:         dirMode,
+		FileMode:        fileMode,
+	})
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error writing files: " + err.Error()))
+		os.Exit(1)
+	}
+
+	fmt.Println(successStyle.Render(fmt.Sprintf(
+		"\n✅ Done! Created %d files in %s (no API calls)",
+		len(writeResult.FilesWritten),
+		outputDir,
+	)))
+	for _, path := range writeResult.FilesWritten {
+		fmt.Println(infoStyle.Render("  • " + path))
+	}
+}
+
 // Helper functions
 
 func askToContinueTranscribe() bool {
@@ -1049,6 +1476,8 @@ func getProviderDisplayNameForProvider(provider gemini.Provider) string {
 		return "Local LLM"
 	case gemini.ProviderAzureAnthropic:
 		return "Azure Anthropic (Claude)"
+	case gemini.ProviderAnthropic:
+		return "Anthropic (Claude)"
 	default:
 		return string(provider)
 	}
@@ -1072,24 +1501,18 @@ func checkTranscribeConfig() error {
 // getAvailableProviders returns a list of available AI providers based on environment config
 func getAvailableProviders() []huh.Option[string] {
 	var options []huh.Option[string]
-
-	// Check for Gemini API key
-	if os.Getenv("GEMINI_API_KEY") != "" || os.Getenv("GOOGLE_API_KEY") != "" {
-		options = append(options, huh.NewOption("Google Gemini (Cloud API)", string(gemini.ProviderGemini)))
-	}
-
-	// Check for Local LLM endpoint
-	if os.Getenv("LLM_ENDPOINT") != "" || os.Getenv("IMAGE_LLM_ENDPOINT") != "" {
-		endpoint := os.Getenv("LLM_ENDPOINT")
-		if endpoint == "" {
-			endpoint = os.Getenv("IMAGE_LLM_ENDPOINT")
+	for _, p := range gemini.GetAvailableProviders() {
+		switch p {
+		case gemini.ProviderLocal:
+			endpoint := llm.FirstEnv("LLM_ENDPOINT", "IMAGE_LLM_ENDPOINT")
+			options = append(options, huh.NewOption(fmt.Sprintf("Local LLM (%s)", endpoint), string(p)))
+		case gemini.ProviderAzureAnthropic:
+			options = append(options, huh.NewOption("Azure Anthropic (Claude)", string(p)))
+		case gemini.ProviderAnthropic:
+			options = append(options, huh.NewOption("Anthropic (Claude)", string(p)))
+		case gemini.ProviderGemini:
+			options = append(options, huh.NewOption("Google Gemini (Cloud API)", string(p)))
 		}
-		options = append(options, huh.NewOption(fmt.Sprintf("Local LLM (%s)", endpoint), string(gemini.ProviderLocal)))
-	}
-
-	// Check for Azure Anthropic
-	if os.Getenv("AZURE_ANTHROPIC_ENDPOINT") != "" {
-		options = append(options, huh.NewOption("Azure Anthropic (Claude)", string(gemini.ProviderAzureAnthropic)))
 	}
 
 	// If no providers configured, still show options but mark as unconfigured
@@ -1098,6 +1521,7 @@ func getAvailableProviders() []huh.Option[string] {
 			huh.NewOption("Google Gemini (not configured)", string(gemini.ProviderGemini)),
 			huh.NewOption("Local LLM (not configured)", string(gemini.ProviderLocal)),
 			huh.NewOption("Azure Anthropic (not configured)", string(gemini.ProviderAzureAnthropic)),
+			huh.NewOption("Anthropic (not configured)", string(gemini.ProviderAnthropic)),
 		)
 	}
 
@@ -1113,10 +1537,16 @@ USAGE:
     capycut transcribe [OPTIONS] <images...>
 
 ARGUMENTS:
-    <images...>             Image files, directories, or glob patterns
+    <images...>             Image files, directories, zip archives, PDFs,
+                            http(s) URLs, or glob patterns
                             Examples:
                               ./scans/*.png
+                              "./scans/page_{001..010}.png"
+                              "./scans/{*.png,*.jpg}"
                               /path/to/images/
+                              scans.zip
+                              book.pdf
+                              https://example.com/page1.png
                               page1.jpg page2.jpg page3.jpg
 
 OPTIONS:
@@ -1124,7 +1554,9 @@ OPTIONS:
     -m, --model <name>      Model to use:
                             Gemini (when using GEMINI_API_KEY):
                               3pro     - Gemini 3 Pro (default, most capable)
-                              3think   - Gemini 3 Pro Thinking (enhanced reasoning)
+                              3think   - Gemini 3 Pro Thinking (reasons before
+                                         answering: better on messy layouts and
+                                         chapters, slower, thinking billed as output)
                               flash    - Gemini 2.5 Flash (fast)
                               pro      - Gemini 2.5 Pro (previous gen)
                             Local LLM (when using LLM_ENDPOINT):
@@ -1132,19 +1564,112 @@ OPTIONS:
                               or any model name supported by your local server
 
     --chapters              Auto-detect and split by chapters
+    --chapter-sensitivity <level>
+                            How eagerly page text ("# Title", "Chapter 3",
+                            "Part II", roman numerals) adds chapter breaks
+                            beyond the model's flags: off, low, medium
+                            (default), high
     --combine               Combine all pages into single file
+    --split-spreads         Split landscape scans of two-page spreads into
+                            left and right pages (in reading order)
+    --dpi <n>               Resolution PDF pages are rendered at (default
+                            200, 72-600); needs pdftoppm (poppler-utils)
+    --strip-running-heads   Remove lines repeated at the top or bottom of
+                            most pages, like the book title and page numbers
+    --dedupe-pages          Transcribe identical image files once and copy
+                            the text to each repeat, keeping page numbers
+    --tables                Also write every table to a CSV file named after
+                            its document, e.g. 02_results_table1.csv
+    --resume-from <dir>     Save each finished batch to <dir>; re-running
+                            with the same <dir> skips batches already done
+    -r, --recursive         Also read images from subfolders of folder
+                            sources, in path order (ch1/*.png, then ch2/*.png);
+                            hidden folders are skipped
+    --max-depth <n>         Subfolder levels to descend (implies --recursive)
     --language <code>       Document language (auto-detect if not set)
-
+    --style-guide <file>    House style rules, one per line (e.g. "Use sentence
+                            case headings"), applied by the text model in the
+                            two-stage pipeline, or by the vision model otherwise
+    --style-guide-vision    Also give the style guide to the vision model when
+                            a text model refines the output
+    --max-tokens <n>        Max output tokens per batch (default: 8192)
+                            Clamped to the provider limit if set too high
+    --temperature <t>       Sampling temperature 0-2 (default: 0.1 for local LLM,
+                            provider default otherwise; keep low for OCR)
+    --top-p <p>             Nucleus sampling 0-1 (default: provider default)
+    --batch-size <n>        Max images per request for cloud providers
+                            (default: 20; Gemini allows up to 3600, Claude 100)
+    --batch-payload-mb <mb> Max estimated request size per batch in MB
+                            (default: 14; Gemini allows up to 20, Claude 32)
+    --index                 Always write index.md (even for a single document)
+    --index-title <title>   Heading for index.md (default: Document Index)
+    --name-template <tmpl>  Output filename template
+                            Placeholders: {index} {title} {pagestart} {pageend} {date}
+                            Example: "{index}-{title}-{date}.md"
+                            (repeated names get the index appended)
+    --format <fmt>          Document format: markdown (default), docx (Word;
+                            front matter becomes document properties), html
+                            (a self-contained page) or json (the markdown
+                            plus headings, chapters and image descriptions
+                            per page). Comma-separate several to write each
+                            document in all of them, e.g. markdown,html;
+                            index.md links to the first
+    --raw-json              Also write the model's structured page output
+                            to pages.json in the output directory
+    --from-json <file>      Re-organize a saved pages.json (with --chapters
+                            or --combine) without calling the API
+    --dir-mode <octal>      Permissions for the output directory, e.g. 0750
+    --file-mode <octal>     Permissions for written files, e.g. 0640
+
+    --profile <name>        Use a named profile from the config file
     --debug                 Enable debug output
+    --insecure              Skip TLS certificate verification (development
+                            only; prefer CAPYCUT_CA_CERT)
 
 ENVIRONMENT:
     Option 1: Local LLM (FREE - uses same config as video clipping)
     LLM_ENDPOINT            Local LLM server URL (e.g., http://localhost:1234)
     LLM_MODEL               Model name (e.g., llava, qwen-vl)
+    CAPYCUT_SKIP_PREFLIGHT  Skip checking that the local model reads images
+    IMAGE_MAX_DIM           Longest side images are shrunk to for the local
+                            model (default 768; 0 or none sends full size)
+    IMAGE_QUALITY           JPEG quality of shrunk images (default 80)
+    IMAGE_RESIZE_THRESHOLD  Only shrink files larger than this (default 500K)
+    IMAGE_FORMAT            auto (keep PNG scans lossless when they fit),
+                            png or jpeg
 
     Option 2: Google Gemini API
     GEMINI_API_KEY          Your Google Gemini API key
     GOOGLE_API_KEY          Alternative API key variable
+    GEMINI_THINKING_BUDGET  Thinking tokens per batch for 3think (default
+                            8192, or dynamic to let the model decide)
+    GEMINI_CONCURRENCY      Batches sent at once (default 3, at most 20);
+                            use 1 on the free tier to avoid 429s
+
+    Fallback
+    CAPYCUT_PROVIDER_FALLBACK
+                            Ordered providers to fail over between, e.g.
+                            local,gemini (also: azure_anthropic)
+
+    Timeouts (Go durations, e.g. 90s, 10m, 1h)
+    CAPYCUT_REQUEST_TIMEOUT Per-request timeout (default 5m)
+    CAPYCUT_JOB_TIMEOUT     Overall job timeout (default: per-image budget
+                            x image count, between 5m and 4h)
+    CAPYCUT_PER_IMAGE_TIMEOUT
+                            Job budget per image (default 30s)
+
+    Memory
+    CAPYCUT_MEMORY_LIMIT    Cap on image data held by in-flight batches
+                            (e.g. 512M, 2G); lowers concurrency on small
+                            machines, never raises it
+
+    TLS
+    CAPYCUT_CA_CERT         PEM bundle of extra CAs to trust for private
+                            endpoints (e.g. a corporate gateway)
+
+    Output
+    CAPYCUT_DIR_MODE        Output directory permissions (like --dir-mode)
+    CAPYCUT_FILE_MODE       Output file permissions (like --file-mode)
 
 EXAMPLES:
     # Transcribe all PNGs in a folder
@@ -1156,6 +1681,18 @@ EXAMPLES:
     # Combine pages into single file
     capycut transcribe --combine -o ./output/ page*.jpg
 
+    # Produce Word documents for editors
+    capycut transcribe --format docx --chapters -o ./book/ ./pages/
+
+    # Markdown to edit plus Word copies, from a single transcription
+    capycut transcribe --format markdown,docx --chapters -o ./book/ ./pages/
+
+    # Transcribe scans straight from a zip archive
+    capycut transcribe ./scans.zip
+
+    # Try a different organization of an earlier --raw-json run
+    capycut transcribe --from-json ./output/pages.json --chapters -o ./book/
+
     # Use local LLM with LLaVA model
     LLM_ENDPOINT=http://localhost:1234 capycut transcribe ./document/
 
@@ -1164,6 +1701,15 @@ For more info: https://github.com/harmonyvt/capycut
 	fmt.Println(help)
 }
 
+// rawPages returns the pages for the pages.json sidecar, or nil when
+// --raw-json is off
+func rawPages(resp *gemini.TranscribeResponse, enabled bool) []*gemini.PageContent {
+	if !enabled || resp == nil {
+		return nil
+	}
+	return resp.Pages
+}
+
 // parseTranscribeArgs parses transcribe command arguments
 func parseTranscribeArgs(args []string) (*TranscribeOptions, []string) {
 	opts := &TranscribeOptions{}
@@ -1176,7 +1722,7 @@ func parseTranscribeArgs(args []string) (*TranscribeOptions, []string) {
 		switch arg {
 		case "-o", "--output":
 			if i+1 < len(args) {
-				opts.OutputDir = args[i+1]
+				opts.OutputDir = expandPath(args[i+1])
 				i += 2
 			} else {
 				i++
@@ -1211,9 +1757,83 @@ func parseTranscribeArgs(args []string) (*TranscribeOptions, []string) {
 		case "--chapters":
 			opts.DetectChapters = true
 			i++
+		case "--chapter-sensitivity":
+			if i+1 < len(args) {
+				level, err := gemini.ParseChapterSensitivity(args[i+1])
+				if err != nil {
+					fmt.Println(errorStyle.Render("Error: " + err.Error()))
+					os.Exit(1)
+				}
+				opts.ChapterSensitivity = level
+				i += 2
+			} else {
+				i++
+			}
 		case "--combine":
 			opts.CombinePages = true
 			i++
+		case "--split-spreads":
+			opts.SplitSpreads = true
+			i++
+		case "--dpi":
+			if i+1 < len(args) {
+				n, err := strconv.Atoi(args[i+1])
+				if err != nil || n == 0 || gemini.ValidatePDFDPI(n) != nil {
+					fmt.Println(errorStyle.Render(fmt.Sprintf("Error: --dpi must be between %d and %d", gemini.MinPDFDPI, gemini.MaxPDFDPI)))
+					os.Exit(1)
+				}
+				opts.DPI = n
+				i += 2
+			} else {
+				i++
+			}
+		case "--strip-running-heads":
+			opts.StripRunningHeads = true
+			i++
+		case "--dedupe-pages":
+			opts.DedupePages = true
+			i++
+		case "--tables":
+			opts.ExtractTables = true
+			i++
+		case "--resume-from":
+			if i+1 < len(args) {
+				opts.ResumeFrom = expandPath(args[i+1])
+				i += 2
+			} else {
+				i++
+			}
+		case "--recursive", "-r":
+			opts.Recursive = true
+			i++
+		case "--max-depth":
+			if i+1 < len(args) {
+				n, err := strconv.Atoi(args[i+1])
+				if err != nil || n <= 0 {
+					fmt.Println(errorStyle.Render("Error: --max-depth must be a positive integer"))
+					os.Exit(1)
+				}
+				opts.Recursive = true
+				opts.MaxDepth = n
+				i += 2
+			} else {
+				i++
+			}
+		case "--style-guide":
+			if i+1 < len(args) {
+				guide, err := gemini.LoadStyleGuide(expandPath(args[i+1]))
+				if err != nil {
+					fmt.Println(errorStyle.Render("Error: " + err.Error()))
+					os.Exit(1)
+				}
+				opts.StyleGuide = guide
+				i += 2
+			} else {
+				i++
+			}
+		case "--style-guide-vision":
+			opts.StyleGuideInVision = true
+			i++
 		case "--formatting":
 			opts.PreserveFormatting = true
 			i++
@@ -1232,12 +1852,115 @@ func parseTranscribeArgs(args []string) (*TranscribeOptions, []string) {
 		case "--overwrite":
 			opts.Overwrite = true
 			i++
+		case "--raw-json":
+			opts.RawJSON = true
+			i++
+		case "--from-json":
+			if i+1 < len(args) {
+				opts.FromJSON = expandPath(args[i+1])
+				i += 2
+			} else {
+				i++
+			}
+		case "--max-tokens":
+			if i+1 < len(args) {
+				n, err := strconv.Atoi(args[i+1])
+				if err != nil || n <= 0 {
+					fmt.Println(errorStyle.Render("Error: --max-tokens must be a positive integer"))
+					os.Exit(1)
+				}
+				opts.MaxOutputTokens = n
+				i += 2
+			} else {
+				i++
+			}
+		case "--batch-size":
+			if i+1 < len(args) {
+				n, err := strconv.Atoi(args[i+1])
+				if err != nil || n <= 0 {
+					fmt.Println(errorStyle.Render("Error: --batch-size must be a positive integer"))
+					os.Exit(1)
+				}
+				opts.BatchSize = n
+				i += 2
+			} else {
+				i++
+			}
+		case "--batch-payload-mb":
+			if i+1 < len(args) {
+				mb, err := strconv.ParseFloat(args[i+1], 64)
+				if err != nil || mb <= 0 {
+					fmt.Println(errorStyle.Render("Error: --batch-payload-mb must be a positive number"))
+					os.Exit(1)
+				}
+				opts.BatchPayloadSize = int64(mb * 1024 * 1024)
+				i += 2
+			} else {
+				i++
+			}
+		case "--temperature":
+			if i+1 < len(args) {
+				t, err := strconv.ParseFloat(args[i+1], 64)
+				if err != nil || t < 0 || t > 2 {
+					fmt.Println(errorStyle.Render("Error: --temperature must be a number between 0 and 2"))
+					os.Exit(1)
+				}
+				opts.Temperature = &t
+				i += 2
+			} else {
+				i++
+			}
+		case "--top-p":
+			if i+1 < len(args) {
+				p, err := strconv.ParseFloat(args[i+1], 64)
+				if err != nil || p <= 0 || p > 1 {
+					fmt.Println(errorStyle.Render("Error: --top-p must be a number in (0, 1]"))
+					os.Exit(1)
+				}
+				opts.TopP = &p
+				i += 2
+			} else {
+				i++
+			}
+		case "--format":
+			if i+1 < len(args) {
+				formats, err := gemini.ParseOutputFormats(args[i+1])
+				if err != nil {
+					fmt.Println(errorStyle.Render("Error: " + err.Error()))
+					os.Exit(1)
+				}
+				opts.Formats = formats
+				i += 2
+			} else {
+				i++
+			}
+		case "--dir-mode", "--file-mode":
+			if i+1 < len(args) {
+				setOutputModeEnv(arg, args[i+1])
+				i += 2
+			} else {
+				i++
+			}
+		case "--index-title":
+			if i+1 < len(args) {
+				opts.IndexTitle = args[i+1]
+				i += 2
+			} else {
+				i++
+			}
+		case "--name-template":
+			if i+1 < len(args) {
+				opts.NameTemplate = args[i+1]
+				i += 2
+			} else {
+				i++
+			}
 		case "--help", "-h":
 			printTranscribeHelp()
 			os.Exit(0)
 		default:
 			if !strings.HasPrefix(arg, "-") {
-				sources = append(sources, arg)
+				sources = append(sources, expandPath(arg))
 			}
 			i++
 		}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"capycut/ai"
+	"capycut/fsmode"
+	"capycut/gemini"
+	"capycut/llm"
+	"capycut/video"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// projectConfigFile is the per-project config file, read from the current
+// directory; it takes precedence over the user config file
+const projectConfigFile = "capycut.yaml"
+
+// configKey maps a config file key onto the environment variable it stands
+// for, so the file drives exactly the settings the variables do. provider
+// names the provider a connection setting belongs to, for keys that have
+// one.
+type configKey struct {
+	name     string
+	env      string
+	secret   bool
+	provider string
+}
+
+// configKeys lists every key a config file may set, in the order config
+// show and the setup wizard print them
+var configKeys = []configKey{
+	{name: "provider", env: "LLM_PROVIDER"},
+	{name: "llm_endpoint", env: "LLM_ENDPOINT", provider: "local"},
+	{name: "llm_model", env: "LLM_MODEL", provider: "local"},
+	{name: "llm_api_key", env: "LLM_API_KEY", secret: true, provider: "local"},
+	{name: "openai_api_key", env: "OPENAI_API_KEY", secret: true, provider: "openai"},
+	{name: "openai_model", env: "OPENAI_MODEL", provider: "openai"},
+	{name: "openai_base_url", env: "OPENAI_BASE_URL", provider: "openai"},
+	{name: "anthropic_api_key", env: "ANTHROPIC_API_KEY", secret: true, provider: "anthropic"},
+	{name: "anthropic_model", env: "ANTHROPIC_MODEL", provider: "anthropic"},
+	{name: "anthropic_base_url", env: "ANTHROPIC_BASE_URL", provider: "anthropic"},
+	{name: "azure_openai_endpoint", env: "AZURE_OPENAI_ENDPOINT", provider: "azure"},
+	{name: "azure_openai_api_key", env: "AZURE_OPENAI_API_KEY", secret: true, provider: "azure"},
+	{name: "azure_openai_model", env: "AZURE_OPENAI_MODEL", provider: "azure"},
+	{name: "azure_openai_api_version", env: "AZURE_OPENAI_API_VERSION", provider: "azure"},
+	{name: "azure_anthropic_endpoint", env: "AZURE_ANTHROPIC_ENDPOINT", provider: "azure_anthropic"},
+	{name: "azure_anthropic_api_key", env: "AZURE_ANTHROPIC_API_KEY", secret: true, provider: "azure_anthropic"},
+	{name: "azure_anthropic_model", env: "AZURE_ANTHROPIC_MODEL", provider: "azure_anthropic"},
+	{name: "gemini_api_key", env: "GEMINI_API_KEY", secret: true, provider: "gemini"},
+	{name: "google_api_key", env: "GOOGLE_API_KEY", secret: true, provider: "gemini"},
+	{name: "gemini_model", env: "GEMINI_MODEL", provider: "gemini"},
+	{name: "gemini_thinking_budget", env: gemini.ThinkingBudgetEnvVar},
+	{name: "gemini_concurrency", env: gemini.ConcurrencyEnvVar},
+	{name: "image_llm_endpoint", env: "IMAGE_LLM_ENDPOINT"},
+	{name: "image_llm_model", env: "IMAGE_LLM_MODEL"},
+	{name: "image_vision_model", env: "IMAGE_VISION_MODEL"},
+	{name: "image_text_endpoint", env: "IMAGE_TEXT_ENDPOINT"},
+	{name: "image_text_model", env: "IMAGE_TEXT_MODEL"},
+	{name: "image_max_dim", env: gemini.ImageMaxDimEnvVar},
+	{name: "image_quality", env: gemini.ImageQualityEnvVar},
+	{name: "image_resize_threshold", env: gemini.ImageResizeThresholdEnvVar},
+	{name: "image_format", env: gemini.ImageFormatEnvVar},
+	{name: "elevenlabs_api_key", env: "ELEVENLABS_API_KEY", secret: true},
+	{name: "ai_timeout", env: ai.TimeoutEnvVar},
+	{name: "request_timeout", env: gemini.RequestTimeoutEnvVar},
+	{name: "job_timeout", env: gemini.JobTimeoutEnvVar},
+	{name: "per_image_timeout", env: gemini.PerImageTimeoutEnvVar},
+	{name: "provider_fallback", env: gemini.ProviderFallbackEnvVar},
+	{name: "skip_preflight", env: gemini.SkipPreflightEnvVar},
+	{name: "memory_limit", env: gemini.MemoryLimitEnvVar},
+	{name: "min_clip", env: video.MinClipDurationEnvVar},
+	{name: "stdin_max_size", env: StdinMaxSizeEnvVar},
+	{name: "ca_cert", env: llm.CACertEnvVar},
+	{name: "insecure", env: llm.InsecureEnvVar},
+	{name: "dir_mode", env: fsmode.DirEnvVar},
+	{name: "file_mode", env: fsmode.FileEnvVar},
+	{name: "debug", env: "CAPYCUT_DEBUG"},
+	{name: "stream", env: ai.StreamEnvVar},
+	{name: "legacy_ui", env: "CAPYCUT_LEGACY_UI"},
+}
+
+// activeProfile is the config profile loadEnvironment applied, if any
+var activeProfile string
+
+// envSources records where loadEnvironment found each variable it set:
+// ".env" or the path of a config file. Variables missing from it came from
+// the environment itself.
+var envSources = map[string]string{}
+
+// lookupConfigKey returns the config key with the given name
+func lookupConfigKey(name string) (configKey, bool) {
+	for _, key := range configKeys {
+		if key.name == name {
+			return key, true
+		}
+	}
+	return configKey{}, false
+}
+
+// userConfigPath returns the user config file,
+// $XDG_CONFIG_HOME/capycut/config.yaml or ~/.config/capycut/config.yaml
+func userConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "capycut", "config.yaml")
+}
+
+// configPaths returns the config files in precedence order, highest first
+func configPaths() []string {
+	return []string{filepath.Join(".", projectConfigFile), userConfigPath()}
+}
+
+// lookupConfigEnv returns the config key for an environment variable
+func lookupConfigEnv(env string) (configKey, bool) {
+	for _, key := range configKeys {
+		if key.env == env {
+			return key, true
+		}
+	}
+	return configKey{}, false
+}
+
+// configFile is a parsed config file
+type configFile struct {
+	// Path is where the file was read from
+	Path string
+
+	// Settings maps environment variable names to the top-level values
+	Settings map[string]string
+
+	// Profiles are the named blocks under the profiles key
+	Profiles map[string]*Profile
+}
+
+// parseConfig decodes a config file: its top-level settings and the
+// profiles under its profiles key
+func parseConfig(data []byte) (*configFile, error) {
+	var doc map[string]yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	cfg := &configFile{Profiles: make(map[string]*Profile)}
+	if node, ok := doc["profiles"]; ok {
+		delete(doc, "profiles")
+		if node.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("line %d: profiles must map profile names to settings", node.Line)
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			name, block := node.Content[i].Value, node.Content[i+1]
+			if block.Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("line %d: profile %q must be a block of settings", block.Line, name)
+			}
+			var settings map[string]yaml.Node
+			if err := block.Decode(&settings); err != nil {
+				return nil, err
+			}
+			values, err := parseConfigSettings(settings)
+			if err != nil {
+				return nil, fmt.Errorf("profile %q: %w", name, err)
+			}
+			cfg.Profiles[name] = &Profile{Name: name, Settings: values}
+		}
+	}
+
+	values, err := parseConfigSettings(doc)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Settings = values
+	return cfg, nil
+}
+
+// parseConfigSettings converts a block of settings to environment variable
+// values. Scalars are taken as written, so "0750" and "90s" reach the
+// variable unchanged; true becomes "1" and false or null an empty value.
+// Unknown keys are errors, so a typo doesn't go unnoticed.
+func parseConfigSettings(doc map[string]yaml.Node) (map[string]string, error) {
+	values := make(map[string]string, len(doc))
+	for name, node := range doc {
+		key, ok := lookupConfigKey(name)
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown key %q", node.Line, name)
+		}
+		if node.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("line %d: %s must be a single value", node.Line, name)
+		}
+
+		switch node.ShortTag() {
+		case "!!null":
+			values[key.env] = ""
+		case "!!bool":
+			var b bool
+			if err := node.Decode(&b); err != nil {
+				return nil, fmt.Errorf("line %d: %s: %w", node.Line, name, err)
+			}
+			values[key.env] = ""
+			if b {
+				values[key.env] = "1"
+			}
+		default:
+			values[key.env] = node.Value
+		}
+	}
+	return values, nil
+}
+
+// readConfigFiles reads and parses the config files at paths, skipping
+// missing ones
+func readConfigFiles(paths []string) ([]*configFile, error) {
+	var files []*configFile
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+		}
+		cfg, err := parseConfig(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config %s: %w", path, err)
+		}
+		cfg.Path = path
+		for _, profile := range cfg.Profiles {
+			profile.Path = path
+		}
+		files = append(files, cfg)
+	}
+	return files, nil
+}
+
+// applyConfig sets the environment variables the config files at paths
+// give, earlier files winning over later ones, with the named profile (if
+// any) over their top-level settings. A variable that is already set is
+// left alone, so the environment, .env and flags all override the files.
+// Missing files are skipped.
+func applyConfig(paths []string, profile string) error {
+	files, err := readConfigFiles(paths)
+	if err != nil {
+		return err
+	}
+	values, sources, err := resolveConfig(files, profile)
+	if err != nil {
+		return err
+	}
+
+	for env, value := range values {
+		if value == "" {
+			continue
+		}
+		if _, ok := os.LookupEnv(env); ok {
+			continue
+		}
+		os.Setenv(env, value)
+		envSources[env] = sources[env]
+	}
+	return nil
+}
+
+// loadEnvironment loads .env and then the config files into the
+// environment, using the named profile or else the one CAPYCUT_PROFILE
+// names. Neither overrides a variable that is already set, giving
+// flags > environment > .env > profile > ./capycut.yaml > user config.
+func loadEnvironment(profile string) error {
+	// A missing .env is fine
+	if vars, err := godotenv.Read(); err == nil {
+		for env, value := range vars {
+			if _, ok := os.LookupEnv(env); ok {
+				continue
+			}
+			os.Setenv(env, value)
+			envSources[env] = ".env"
+		}
+	}
+
+	if profile == "" {
+		profile = os.Getenv(ProfileEnvVar)
+	}
+	if err := applyConfig(configPaths(), profile); err != nil {
+		return err
+	}
+	activeProfile = profile
+	return nil
+}
+
+// mustLoadEnvironment is loadEnvironment for startup: a broken config file
+// or unknown profile is reported and ends the run
+func mustLoadEnvironment(profile string) {
+	if err := loadEnvironment(profile); err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		os.Exit(1)
+	}
+}
+
+// generateConfigYAML generates config file content for the setup wizard,
+// holding the same settings generateDotEnv writes. With a profile name the
+// settings go in that profile instead of the top level.
+func generateConfigYAML(provider, endpoint, apiKey, model, apiVersion, profile string) (string, error) {
+	vars, err := godotenv.Unmarshal(generateDotEnv(provider, endpoint, apiKey, model, apiVersion))
+	if err != nil {
+		return "", err
+	}
+
+	settings := &yaml.Node{Kind: yaml.MappingNode}
+	for _, key := range configKeys {
+		if value, ok := vars[key.env]; ok {
+			settings.Content = append(settings.Content, yamlString(key.name), yamlString(value))
+		}
+	}
+
+	doc := settings
+	if profile != "" {
+		doc = &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+			yamlString("profiles"),
+			{Kind: yaml.MappingNode, Content: []*yaml.Node{yamlString(profile), settings}},
+		}}
+	}
+	doc.HeadComment = "CapyCut configuration"
+	return encodeYAML(doc)
+}
+
+// yamlString returns a string scalar node
+func yamlString(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+// mergeConfigYAML sets the keys of update in an existing config file,
+// replacing values already there and appending new keys. Other keys and
+// comments in existing are kept.
+func mergeConfigYAML(existing, update []byte) ([]byte, error) {
+	var base yaml.Node
+	if err := yaml.Unmarshal(existing, &base); err != nil {
+		return nil, err
+	}
+	if base.Kind == 0 {
+		// Empty or comment-only file
+		return update, nil
+	}
+	target := base.Content[0]
+	if target.Kind != yaml.MappingNode {
+		return nil, errors.New("config file is not a mapping of keys to values")
+	}
+
+	var changes yaml.Node
+	if err := yaml.Unmarshal(update, &changes); err != nil {
+		return nil, err
+	}
+	if changes.Kind == 0 {
+		return existing, nil
+	}
+	setMappingKeys(target, changes.Content[0])
+
+	out, err := encodeYAML(&base)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(out), nil
+}
+
+// setMappingKeys copies the key/value pairs of src into dst, replacing the
+// value of a key dst already has. Mappings on both sides are merged the
+// same way, so saving one profile keeps the others.
+func setMappingKeys(dst, src *yaml.Node) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		replaced := false
+		for j := 0; j+1 < len(dst.Content); j += 2 {
+			if dst.Content[j].Value == key.Value {
+				if dst.Content[j+1].Kind == yaml.MappingNode && value.Kind == yaml.MappingNode {
+					setMappingKeys(dst.Content[j+1], value)
+				} else {
+					dst.Content[j+1] = value
+				}
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			dst.Content = append(dst.Content, key, value)
+		}
+	}
+}
+
+// encodeYAML encodes a node with the two-space indent config files use
+func encodeYAML(node *yaml.Node) (string, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// writeConfigYAML saves wizard settings to a config file, merging them
+// into the file if it exists. Config files hold API keys, so new ones are
+// created 0600.
+func writeConfigYAML(path, content string) error {
+	data := []byte(content)
+	if existing, err := os.ReadFile(path); err == nil {
+		if data, err = mergeConfigYAML(existing, data); err != nil {
+			return fmt.Errorf("failed to update %s: %w", path, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// maskSecret hides all but the ends of a secret, enough to tell keys apart
+func maskSecret(s string) string {
+	if len(s) <= 8 {
+		return strings.Repeat("*", len(s))
+	}
+	return s[:4] + strings.Repeat("*", 4) + s[len(s)-4:]
+}
@@ -0,0 +1,85 @@
+// Package fsmode holds the permissions of the output capycut writes: the
+// defaults, the CAPYCUT_DIR_MODE and CAPYCUT_FILE_MODE overrides, and
+// creating output directories with them.
+package fsmode
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Default permissions for output directories and files
+const (
+	DefaultDir  os.FileMode = 0755
+	DefaultFile os.FileMode = 0644
+)
+
+// Env vars that set the permissions of written output, e.g. 0750 and 0640
+// on shared machines where output mustn't be readable by others
+const (
+	DirEnvVar  = "CAPYCUT_DIR_MODE"
+	FileEnvVar = "CAPYCUT_FILE_MODE"
+)
+
+// Parse parses an octal permission such as 750 or 0640
+func Parse(s string) (os.FileMode, error) {
+	s = strings.TrimSpace(s)
+	n, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimPrefix(s, "0o"), "0O"), 8, 32)
+	if err != nil || n == 0 || n > 0777 {
+		return 0, fmt.Errorf("invalid permission %q: expected octal like 0750 or 0640", s)
+	}
+	return os.FileMode(n), nil
+}
+
+// FromEnv reads CAPYCUT_DIR_MODE and CAPYCUT_FILE_MODE; a mode that isn't
+// set is returned as 0, which keeps the default
+func FromEnv() (dirMode, fileMode os.FileMode, err error) {
+	if v := os.Getenv(DirEnvVar); v != "" {
+		if dirMode, err = Parse(v); err != nil {
+			return 0, 0, fmt.Errorf("invalid %s: %w", DirEnvVar, err)
+		}
+	}
+	if v := os.Getenv(FileEnvVar); v != "" {
+		if fileMode, err = Parse(v); err != nil {
+			return 0, 0, fmt.Errorf("invalid %s: %w", FileEnvVar, err)
+		}
+	}
+	return dirMode, fileMode, nil
+}
+
+// MkdirAll creates dir and any missing parents. A mode that is set is
+// applied exactly to the directories this call creates; existing ones,
+// which may be shared like the current directory, keep theirs. With 0 the
+// directories get DefaultDir narrowed by the umask.
+func MkdirAll(dir string, mode os.FileMode) error {
+	var created []string
+	for p := filepath.Clean(dir); ; p = filepath.Dir(p) {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			break
+		}
+		created = append(created, p)
+		if filepath.Dir(p) == p {
+			break
+		}
+	}
+
+	perm := mode
+	if perm == 0 {
+		perm = DefaultDir
+	}
+	if err := os.MkdirAll(dir, perm); err != nil {
+		return err
+	}
+	if mode == 0 {
+		return nil
+	}
+	for _, p := range created {
+		if err := os.Chmod(p, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package fsmode
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv(DirEnvVar, "")
+	t.Setenv(FileEnvVar, "")
+	if dir, file, err := FromEnv(); err != nil || dir != 0 || file != 0 {
+		t.Errorf("FromEnv() unset = %v, %v, %v; want defaults", dir, file, err)
+	}
+
+	t.Setenv(DirEnvVar, "750")
+	t.Setenv(FileEnvVar, "0o640")
+	if dir, file, err := FromEnv(); err != nil || dir != 0750 || file != 0640 {
+		t.Errorf("FromEnv() = %v, %v, %v; want 0750, 0640", dir, file, err)
+	}
+
+	for _, bad := range []string{"rwx", "0", "1777", "9"} {
+		t.Setenv(FileEnvVar, bad)
+		if _, _, err := FromEnv(); err == nil {
+			t.Errorf("FromEnv() accepted %s=%q", FileEnvVar, bad)
+		}
+	}
+}
+
+func TestMkdirAll(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix permissions")
+	}
+	base := filepath.Join(t.TempDir(), "shared")
+	if err := os.Mkdir(base, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(base, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the directories MkdirAll creates get the mode
+	dir := filepath.Join(base, "a", "b")
+	if err := MkdirAll(dir, 0700); err != nil {
+		t.Fatalf("MkdirAll() error: %v", err)
+	}
+	for path, want := range map[string]os.FileMode{base: 0755, filepath.Join(base, "a"): 0700, dir: 0700} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Errorf("stat %s: %v", path, err)
+			continue
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s mode = %v, want %v", path, got, want)
+		}
+	}
+
+	// Existing directories are left alone, also when a mode is set
+	if err := MkdirAll(base, 0700); err != nil {
+		t.Fatalf("MkdirAll() on an existing directory error: %v", err)
+	}
+	if info, err := os.Stat(base); err != nil {
+		t.Error(err)
+	} else if info.Mode().Perm() != 0755 {
+		t.Errorf("existing directory mode = %v, want 0755 kept", info.Mode().Perm())
+	}
+}
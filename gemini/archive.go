@@ -0,0 +1,168 @@
+package gemini
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// extractedDirs tracks temp directories created for zip sources, rendered
+// PDF pages, URL downloads and split spreads so that CleanupTempFiles can
+// remove them once the pipeline is done
+var (
+	extractedMu   sync.Mutex
+	extractedDirs []string
+)
+
+// maxZipExtractSize caps the bytes extracted from one zip archive, so a
+// zip bomb fails instead of filling the disk. A variable so tests can
+// lower it.
+var maxZipExtractSize int64 = 4 << 30
+
+// isZipFile reports whether a source path names a zip archive
+func isZipFile(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".zip")
+}
+
+// loadFromZip extracts the image entries of a zip archive into a temp
+// directory and returns their paths in natural order of entry names.
+// Entries in sub-folders are flattened into "folder_name.ext" so that the
+// base-name sort in LoadImages keeps the archive's ordering.
+func loadFromZip(archive string) ([]string, error) {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zip archive: %w", err)
+	}
+	defer r.Close()
+
+	var entries []*zip.File
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() || !isZipImageEntry(f.Name) {
+			continue
+		}
+		entries = append(entries, f)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no image files found in zip archive")
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return NaturalLess(entries[i].Name, entries[j].Name)
+	})
+
+	// The sizes in the archive may lie, so extractZipEntry checks the
+	// bytes actually written too
+	var declared uint64
+	for _, f := range entries {
+		declared += f.UncompressedSize64
+	}
+	if declared > uint64(maxZipExtractSize) {
+		return nil, fmt.Errorf("zip archive would extract to %s, more than the %s limit", FormatSize(int64(declared)), FormatSize(maxZipExtractSize))
+	}
+
+	dir, err := newTempDir("capycut-zip-*")
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]string, 0, len(entries))
+	used := make(map[string]bool)
+	remaining := maxZipExtractSize
+	for _, f := range entries {
+		name := flattenEntryName(f.Name)
+		if used[name] {
+			return nil, fmt.Errorf("zip entries collide after flattening: %s", f.Name)
+		}
+		used[name] = true
+
+		dest := filepath.Join(dir, name)
+		written, err := extractZipEntry(f, dest, remaining)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract %s: %w", f.Name, err)
+		}
+		remaining -= written
+		images = append(images, dest)
+	}
+
+	return images, nil
+}
+
+// newTempDir creates a temp directory that CleanupTempFiles will remove
+func newTempDir(pattern string) (string, error) {
+	dir, err := os.MkdirTemp("", pattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	extractedMu.Lock()
+	extractedDirs = append(extractedDirs, dir)
+	extractedMu.Unlock()
+	return dir, nil
+}
+
+// isZipImageEntry filters out non-images and macOS resource-fork entries
+func isZipImageEntry(name string) bool {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), "._") {
+		return false
+	}
+	return isImageFile(name)
+}
+
+// flattenEntryName turns "scans/ch1/page2.png" into "scans_ch1_page2.png",
+// which also keeps "../" entries from escaping the temp directory
+func flattenEntryName(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	var parts []string
+	for _, p := range strings.Split(name, "/") {
+		if p != "" && p != "." && p != ".." {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, "_")
+}
+
+// extractZipEntry copies a single zip entry to dest, failing once it has
+// written more than limit bytes, and returns the bytes written
+func extractZipEntry(f *zip.File, dest string, limit int64) (int64, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(out, io.LimitReader(rc, limit+1))
+	if err == nil && n > limit {
+		err = fmt.Errorf("zip archive extracts to more than the %s limit", FormatSize(maxZipExtractSize))
+	}
+	if err != nil {
+		out.Close()
+		return n, err
+	}
+	return n, out.Close()
+}
+
+// CleanupTempFiles removes images extracted from zip sources, rendered from
+// PDFs or downloaded from URLs by LoadImages, and halves written by
+// SplitSpreads.
+// Call it once the images are no longer needed; it is safe to call when
+// nothing was extracted.
+func CleanupTempFiles() {
+	extractedMu.Lock()
+	dirs := extractedDirs
+	extractedDirs = nil
+	extractedMu.Unlock()
+
+	for _, dir := range dirs {
+		os.RemoveAll(dir)
+	}
+}
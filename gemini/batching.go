@@ -0,0 +1,114 @@
+package gemini
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// GeminiMaxImagesPerRequest is the most images Gemini accepts in one request
+	GeminiMaxImagesPerRequest = 3600
+
+	// AnthropicMaxImagesPerRequest is the most images Claude accepts in one request
+	AnthropicMaxImagesPerRequest = 100
+
+	// AnthropicMaxRequestSize is the Claude API's request body limit
+	AnthropicMaxRequestSize = 32 * 1024 * 1024
+)
+
+// WithBatchSize caps how many images are sent per request by cloud
+// providers, overriding MaxImagesPerRequest. Raise it for simple text pages
+// to cut round-trips, lower it for dense figures. Local LLMs still get one
+// image per request. Zero keeps the default.
+func WithBatchSize(n int) ClientOption {
+	return func(c *Client) {
+		c.batchSize = n
+	}
+}
+
+// WithBatchPayloadSize caps the estimated encoded size of a cloud batch in
+// bytes, overriding MaxPayloadSize. Zero keeps the default.
+func WithBatchPayloadSize(bytes int64) ClientOption {
+	return func(c *Client) {
+		c.batchPayloadSize = bytes
+	}
+}
+
+// batchLimits returns the images-per-request and payload limits a provider
+// enforces on its side; zero means the provider has no batching limit
+func batchLimits(provider Provider) (maxImages int, maxPayload int64) {
+	switch provider {
+	case ProviderGemini:
+		return GeminiMaxImagesPerRequest, MaxInlineRequestSize
+	case ProviderAzureAnthropic, ProviderAnthropic:
+		return AnthropicMaxImagesPerRequest, AnthropicMaxRequestSize
+	default:
+		return 0, 0
+	}
+}
+
+// ValidateBatchLimits checks a batch size and payload override against the
+// provider's hard limits. Zero values mean "use the default" and always pass.
+func ValidateBatchLimits(provider Provider, batchSize int, payloadSize int64) error {
+	if batchSize < 0 {
+		return fmt.Errorf("batch size must be positive, got %d", batchSize)
+	}
+	if payloadSize < 0 {
+		return fmt.Errorf("batch payload size must be positive, got %d", payloadSize)
+	}
+
+	maxImages, maxPayload := batchLimits(provider)
+	if maxImages > 0 && batchSize > maxImages {
+		return fmt.Errorf("batch size %d exceeds the %s limit of %d images per request", batchSize, provider, maxImages)
+	}
+	if maxPayload > 0 && payloadSize > maxPayload {
+		return fmt.Errorf("batch payload %s exceeds the %s request limit of %s", FormatSize(payloadSize), provider, FormatSize(maxPayload))
+	}
+	return nil
+}
+
+// ConcurrencyFromEnv returns the number of parallel batches from
+// GEMINI_CONCURRENCY, or 0 (MaxConcurrentRequests) when unset. Values above
+// MaxConcurrency are accepted and capped when the job runs.
+func ConcurrencyFromEnv() (int, error) {
+	value := strings.TrimSpace(os.Getenv(ConcurrencyEnvVar))
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid %s %q: expected a number of parallel requests, at least 1", ConcurrencyEnvVar, value)
+	}
+	return n, nil
+}
+
+// batchConcurrency returns how many batches req sends at once, and whether
+// its Concurrency was over MaxConcurrency and got capped
+func batchConcurrency(req *TranscribeRequest) (int, bool) {
+	switch {
+	case req.Concurrency <= 0:
+		return MaxConcurrentRequests, false
+	case req.Concurrency > MaxConcurrency:
+		return MaxConcurrency, true
+	default:
+		return req.Concurrency, false
+	}
+}
+
+// maxBatchImages returns the images-per-batch cap for createSmartBatches
+func (c *Client) maxBatchImages() int {
+	if c.batchSize > 0 {
+		return c.batchSize
+	}
+	return MaxImagesPerRequest
+}
+
+// maxBatchPayload returns the payload cap for createSmartBatches
+func (c *Client) maxBatchPayload() int64 {
+	if c.batchPayloadSize > 0 {
+		return c.batchPayloadSize
+	}
+	return MaxPayloadSize
+}
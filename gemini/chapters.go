@@ -0,0 +1,171 @@
+package gemini
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ChapterSensitivity controls how eagerly the text heuristics in
+// detectChapters add chapter boundaries on top of the model's own flags
+type ChapterSensitivity string
+
+const (
+	// ChapterSensitivityOff trusts only the model's IsChapterStart/heading flags
+	ChapterSensitivityOff ChapterSensitivity = "off"
+	// ChapterSensitivityLow needs strong evidence such as "Chapter 3" after a short page
+	ChapterSensitivityLow ChapterSensitivity = "low"
+	// ChapterSensitivityMedium accepts a top-level heading or "Chapter"/"Part" line (default)
+	ChapterSensitivityMedium ChapterSensitivity = "medium"
+	// ChapterSensitivityHigh also accepts second-level headings and bare roman numerals
+	ChapterSensitivityHigh ChapterSensitivity = "high"
+)
+
+// ParseChapterSensitivity parses a --chapter-sensitivity value; empty means medium
+func ParseChapterSensitivity(s string) (ChapterSensitivity, error) {
+	switch v := ChapterSensitivity(strings.ToLower(strings.TrimSpace(s))); v {
+	case "":
+		return ChapterSensitivityMedium, nil
+	case ChapterSensitivityOff, ChapterSensitivityLow, ChapterSensitivityMedium, ChapterSensitivityHigh:
+		return v, nil
+	default:
+		return "", fmt.Errorf("unknown chapter sensitivity %q (use off, low, medium or high)", s)
+	}
+}
+
+// threshold returns the heuristic score a page needs to start a chapter,
+// or 0 when heuristics are disabled
+func (s ChapterSensitivity) threshold() int {
+	switch s {
+	case ChapterSensitivityOff:
+		return 0
+	case ChapterSensitivityLow:
+		return 4
+	case ChapterSensitivityHigh:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// Heuristic weights. A page's score is the strongest line signal near its
+// top plus gapScore when the previous page was nearly empty, which is how
+// chapter endings usually look in scanned books.
+const (
+	h1Score      = 3
+	chapterScore = 3
+	h2Score      = 2
+	romanScore   = 2
+	gapScore     = 1
+
+	// headingScanLines is how many non-empty lines at the top of a page are
+	// checked for headings; chapter titles never sit mid-page
+	headingScanLines = 3
+
+	// maxHeadingLength rejects long prose lines that happen to start with "Chapter"
+	maxHeadingLength = 80
+
+	// gapRatio marks a page as nearly empty relative to the median page length
+	gapRatio = 0.25
+)
+
+var (
+	markdownHeadingRe = regexp.MustCompile(`^(#{1,2})\s+(\S.*)$`)
+	chapterLineRe     = regexp.MustCompile(`(?i)^(chapter|part|book)\s+(\d+|[ivxlcdm]+|one|two|three|four|five|six|seven|eight|nine|ten|eleven|twelve|thirteen|fourteen|fifteen|sixteen|seventeen|eighteen|nineteen|twenty)\b[.:\-—]?\s*(.*)$`)
+	romanLineRe       = regexp.MustCompile(`^[IVXLC]+\.?$`)
+)
+
+// chapterCandidate is a heuristic chapter start found in a page's text
+type chapterCandidate struct {
+	score int
+	title string
+	level int
+}
+
+// scorePageText looks for chapter-like headings in the first lines of a page
+func scorePageText(text string) chapterCandidate {
+	best := chapterCandidate{}
+	checked := 0
+
+	for _, raw := range strings.Split(text, "\n") {
+		line := strings.TrimSpace(raw)
+		if line == "" {
+			continue
+		}
+		if checked++; checked > headingScanLines {
+			break
+		}
+		if len(line) > maxHeadingLength {
+			continue
+		}
+
+		// plain is the line without markdown heading or emphasis markers
+		plain := strings.TrimSpace(strings.Trim(strings.TrimLeft(line, "#"), "*_ "))
+
+		var c chapterCandidate
+		if m := markdownHeadingRe.FindStringSubmatch(line); m != nil {
+			if len(m[1]) == 1 {
+				c = chapterCandidate{score: h1Score, title: plain, level: 1}
+			} else {
+				c = chapterCandidate{score: h2Score, title: plain, level: 2}
+			}
+		}
+		if chapterLineRe.MatchString(plain) && c.score < chapterScore {
+			c = chapterCandidate{score: chapterScore, title: plain, level: 1}
+		} else if c.score == 0 && romanLineRe.MatchString(plain) {
+			c = chapterCandidate{score: romanScore, title: plain, level: 2}
+		}
+
+		if c.score > best.score {
+			best = c
+		}
+	}
+
+	return best
+}
+
+// shortPages reports which pages are nearly empty compared with the median
+func shortPages(pages []*PageContent) []bool {
+	lengths := make([]int, len(pages))
+	for i, p := range pages {
+		lengths[i] = len(strings.TrimSpace(p.Text))
+	}
+	sorted := append([]int(nil), lengths...)
+	sort.Ints(sorted)
+	median := 0
+	if len(sorted) > 0 {
+		median = sorted[len(sorted)/2]
+	}
+
+	short := make([]bool, len(pages))
+	for i, n := range lengths {
+		short[i] = median > 0 && float64(n) < float64(median)*gapRatio
+	}
+	return short
+}
+
+// heuristicChapterStarts returns, per page, the heuristic candidate when it
+// meets the sensitivity threshold
+func heuristicChapterStarts(pages []*PageContent, sensitivity ChapterSensitivity) []*chapterCandidate {
+	starts := make([]*chapterCandidate, len(pages))
+	threshold := sensitivity.threshold()
+	if threshold == 0 {
+		return starts
+	}
+
+	short := shortPages(pages)
+	for i, page := range pages {
+		c := scorePageText(page.Text)
+		if c.score == 0 {
+			continue
+		}
+		if i > 0 && short[i-1] {
+			c.score += gapScore
+		}
+		if c.score >= threshold {
+			starts[i] = &c
+		}
+	}
+	return starts
+}
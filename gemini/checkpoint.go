@@ -0,0 +1,210 @@
+package gemini
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"capycut/fsmode"
+)
+
+// CheckpointVersion is the schema version of checkpoint batch files
+const CheckpointVersion = 2
+
+// checkpointEntry is one finished batch as saved in the checkpoint directory
+type checkpointEntry struct {
+	Version   int      `json:"version"`
+	Model     string   `json:"model"`
+	TextModel string   `json:"text_model,omitempty"`
+	Provider  Provider `json:"provider"`
+	// BatchModel is the model that transcribed the batch, which differs
+	// from Model when a fallback provider took over
+	BatchModel string         `json:"batch_model,omitempty"`
+	Images     []string       `json:"images"`
+	FirstPage  int            `json:"first_page"`
+	Pages      []*PageContent `json:"pages"`
+}
+
+// checkpoint saves finished batches under dir so a failed or cancelled job
+// can be re-run without transcribing them again. A batch is found by its
+// images' contents, the models used and the request options that change
+// what they return, so editing an image or changing the language, say,
+// transcribes it afresh. Contents rather than paths let zip, PDF, URL and
+// split-spread pages, which are extracted to a new temp dir each run, be
+// found again.
+type checkpoint struct {
+	dir       string
+	model     string
+	textModel string
+	settings  []byte
+}
+
+// checkpointSettings are the request options that change a batch's
+// transcription, and so its checkpoint key
+type checkpointSettings struct {
+	Language                 string              `json:"language,omitempty"`
+	PreserveFormatting       bool                `json:"preserve_formatting,omitempty"`
+	IncludeImageDescriptions bool                `json:"include_image_descriptions,omitempty"`
+	ExtractTables            bool                `json:"extract_tables,omitempty"`
+	MaxOutputTokens          int                 `json:"max_output_tokens,omitempty"`
+	Temperature              *float64            `json:"temperature,omitempty"`
+	TopP                     *float64            `json:"top_p,omitempty"`
+	ThinkingBudget           int                 `json:"thinking_budget,omitempty"`
+	LocalResize              *LocalResizeOptions `json:"local_resize,omitempty"`
+	StyleGuide               string              `json:"style_guide,omitempty"`
+	StyleGuideInVision       bool                `json:"style_guide_in_vision,omitempty"`
+}
+
+// openCheckpoint creates the checkpoint directory if needed
+func openCheckpoint(dir, model, textModel string, req *TranscribeRequest) (*checkpoint, error) {
+	if err := os.MkdirAll(dir, fsmode.DefaultDir); err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint directory: %w", err)
+	}
+	settings, err := json.Marshal(checkpointSettings{
+		Language:                 req.Language,
+		PreserveFormatting:       req.PreserveFormatting,
+		IncludeImageDescriptions: req.IncludeImageDescriptions,
+		ExtractTables:            req.ExtractTables,
+		MaxOutputTokens:          req.MaxOutputTokens,
+		Temperature:              req.Temperature,
+		TopP:                     req.TopP,
+		ThinkingBudget:           req.ThinkingBudget,
+		LocalResize:              req.LocalResize,
+		StyleGuide:               req.StyleGuide,
+		StyleGuideInVision:       req.StyleGuideInVision,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &checkpoint{dir: dir, model: model, textModel: textModel, settings: settings}, nil
+}
+
+// path returns the file a batch is saved to, or "" when an image can't be
+// read, in which case the batch isn't checkpointed
+func (cp *checkpoint) path(images []*ImageInfo) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00", cp.model, cp.textModel, cp.settings)
+	for _, img := range images {
+		sum, err := hashFile(img.Path)
+		if err != nil {
+			return ""
+		}
+		h.Write(sum[:])
+	}
+	return filepath.Join(cp.dir, "batch-"+hex.EncodeToString(h.Sum(nil))[:32]+".json")
+}
+
+// load returns a saved batch's pages, renumbered for where the batch falls
+// in this job, which changes when pages are added before it, and the
+// provider and model that transcribed them
+func (cp *checkpoint) load(path string, images []*ImageInfo) ([]*PageContent, Provider, string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", "", false
+	}
+	var entry checkpointEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Version != CheckpointVersion || len(entry.Pages) == 0 {
+		return nil, "", "", false
+	}
+
+	offset := images[0].PageIndex + 1 - entry.FirstPage
+	for _, page := range entry.Pages {
+		page.PageNumber += offset
+	}
+	model := entry.BatchModel
+	if model == "" {
+		model = entry.Model
+	}
+	return entry.Pages, entry.Provider, model, true
+}
+
+// save writes a finished batch. It goes to a temp file first so a job
+// killed mid-write never leaves a truncated batch behind.
+func (cp *checkpoint) save(path string, images []*ImageInfo, pages []*PageContent, provider Provider, model string) error {
+	entry := checkpointEntry{
+		Version:    CheckpointVersion,
+		Model:      cp.model,
+		TextModel:  cp.textModel,
+		Provider:   provider,
+		BatchModel: model,
+		FirstPage:  images[0].PageIndex + 1,
+		Pages:      pages,
+	}
+	for _, img := range images {
+		entry.Images = append(entry.Images, img.Path)
+	}
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(cp.dir, ".batch-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// processBatchCheckpointed returns a batch from the job's checkpoint when
+// an earlier run finished it, and otherwise transcribes it with
+// processBatchWithFallback and saves the result. Restored batches cost no
+// tokens. Either way the pages fill the batch's own slot, so the caller
+// combines cached and fresh batches in page order as usual.
+func (c *Client) processBatchCheckpointed(ctx context.Context, images []*ImageInfo, req *TranscribeRequest, model string, tctx *transcribeContext, batchNum int) ([]*PageContent, int, Provider, string, error) {
+	if tctx == nil || tctx.checkpoint == nil {
+		return c.processBatchWithFallback(ctx, images, req, model, tctx, batchNum)
+	}
+	cp := tctx.checkpoint
+
+	path := cp.path(images)
+	if path != "" {
+		if pages, provider, batchModel, ok := cp.load(path, images); ok {
+			tctx.resumedBatches.Add(1)
+			c.sendProgress(tctx, ProgressUpdate{
+				Status:       StatusProcessingBatch,
+				Message:      fmt.Sprintf("Batch %d restored from checkpoint", batchNum),
+				Detail:       fmt.Sprintf("%d pages", len(pages)),
+				CurrentBatch: batchNum,
+				Model:        model,
+			})
+			if c.debug {
+				fmt.Printf("[DEBUG] Batch %d restored from %s\n", batchNum, path)
+			}
+			return pages, 0, provider, batchModel, nil
+		}
+	}
+
+	pages, tokens, provider, batchModel, err := c.processBatchWithFallback(ctx, images, req, model, tctx, batchNum)
+	if err != nil || path == "" {
+		return pages, tokens, provider, batchModel, err
+	}
+
+	// A batch that can't be saved is only transcribed again next time
+	if saveErr := cp.save(path, images, pages, provider, batchModel); saveErr != nil {
+		c.sendProgress(tctx, ProgressUpdate{
+			Status:       StatusWarning,
+			Message:      "Checkpoint not saved",
+			Detail:       fmt.Sprintf("Batch %d: %v", batchNum, saveErr),
+			CurrentBatch: batchNum,
+			Model:        model,
+		})
+	}
+	return pages, tokens, provider, batchModel, nil
+}
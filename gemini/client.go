@@ -5,15 +5,21 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
+
+	"capycut/llm"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
@@ -26,6 +32,24 @@ const (
 	// DefaultTimeout for API requests
 	DefaultTimeout = 5 * time.Minute
 
+	// DefaultPerImageTimeout is the job budget per image; a whole
+	// transcription job gets this times its image count
+	DefaultPerImageTimeout = 30 * time.Second
+
+	// MinJobTimeout and MaxJobTimeout bound the job timeout computed from
+	// the image count; an explicit CAPYCUT_JOB_TIMEOUT is not clamped
+	MinJobTimeout = 5 * time.Minute
+	MaxJobTimeout = 4 * time.Hour
+
+	// RequestTimeoutEnvVar overrides the per-request timeout (a Go duration, e.g. "10m")
+	RequestTimeoutEnvVar = "CAPYCUT_REQUEST_TIMEOUT"
+
+	// JobTimeoutEnvVar overrides the overall job timeout (a Go duration, e.g. "1h")
+	JobTimeoutEnvVar = "CAPYCUT_JOB_TIMEOUT"
+
+	// PerImageTimeoutEnvVar overrides DefaultPerImageTimeout (a Go duration, e.g. "2m")
+	PerImageTimeoutEnvVar = "CAPYCUT_PER_IMAGE_TIMEOUT"
+
 	// MaxImagesPerRequest is the maximum images per API call (Gemini supports up to 3600)
 	// We use a conservative limit for better performance and reliability
 	MaxImagesPerRequest = 20
@@ -44,15 +68,38 @@ const (
 	// 20MB limit / 1.4 overhead factor = ~14.3MB raw images, we use 14MB to be safe
 	MaxPayloadSize = 14 * 1024 * 1024
 
-	// MaxConcurrentRequests is the maximum parallel API calls
+	// MaxConcurrentRequests is the default number of parallel API calls
 	// Free tier: 5 RPM, Tier 1: 500 RPM, Tier 2+: 1000+ RPM
 	MaxConcurrentRequests = 3
 
+	// MaxConcurrency caps TranscribeRequest.Concurrency; past this, even
+	// Tier 2+ rate limits gain little and batches held in memory pile up
+	MaxConcurrency = 20
+
+	// ConcurrencyEnvVar overrides MaxConcurrentRequests (e.g. "8")
+	ConcurrencyEnvVar = "GEMINI_CONCURRENCY"
+
+	// MaxConcurrentValidations is the maximum parallel file checks while
+	// validating images; these are stat calls, not API requests
+	MaxConcurrentValidations = 16
+
 	// GeminiContextWindow is the maximum input tokens (1M, 2M coming soon)
 	GeminiContextWindow = 1000000
 
 	// GeminiMaxOutputTokens is the maximum output tokens
 	GeminiMaxOutputTokens = 65535
+
+	// DefaultMaxOutputTokens is the output token budget per batch request
+	DefaultMaxOutputTokens = 8192
+
+	// LocalMaxOutputTokens caps the output budget for OpenAI-compatible local servers
+	LocalMaxOutputTokens = 32768
+
+	// AnthropicMaxOutputTokens is the largest budget the SDK allows without streaming
+	AnthropicMaxOutputTokens = 16384
+
+	// DefaultExtractionTemperature keeps OCR output close to deterministic
+	DefaultExtractionTemperature = 0.1
 )
 
 // Client is the Google Gemini API client (also supports OpenAI-compatible APIs and Azure Anthropic)
@@ -64,6 +111,20 @@ type Client struct {
 	httpClient *http.Client
 	debug      bool
 
+	// requestTimeout is set by WithTimeout and also applied to SDK-backed providers
+	requestTimeout time.Duration
+
+	// memory throttles concurrently resident batch data (nil = unlimited)
+	memory *memoryLimiter
+
+	// fallbacks take over batches this client fails (see WithFallback)
+	fallbacks []*Client
+
+	// batchSize and batchPayloadSize override the cloud batching limits
+	// (see WithBatchSize and WithBatchPayloadSize); zero keeps the defaults
+	batchSize        int
+	batchPayloadSize int64
+
 	// Two-stage pipeline for local LLM (optional)
 	// If set, vision model extracts raw text, then text model refines into markdown
 	textModel    string // Agentic/text model for refinement (e.g., mistral, llama)
@@ -100,10 +161,21 @@ func WithHTTPClient(client *http.Client) ClientOption {
 	}
 }
 
+// WithTransport sets the HTTP transport used for API requests, including
+// the Anthropic SDK's; nil keeps the default transport
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(c *Client) {
+		if transport != nil {
+			c.httpClient.Transport = transport
+		}
+	}
+}
+
 // WithTimeout sets the HTTP client timeout
 func WithTimeout(timeout time.Duration) ClientOption {
 	return func(c *Client) {
 		c.httpClient.Timeout = timeout
+		c.requestTimeout = timeout
 	}
 }
 
@@ -162,6 +234,10 @@ func NewClient(apiKey string, opts ...ClientOption) (*Client, error) {
 		opt(c)
 	}
 
+	if err := ValidateBatchLimits(c.provider, c.batchSize, c.batchPayloadSize); err != nil {
+		return nil, err
+	}
+
 	return c, nil
 }
 
@@ -174,7 +250,7 @@ func NewLocalClient(endpoint, model string, opts ...ClientOption) (*Client, erro
 	endpoint = strings.TrimSuffix(endpoint, "/")
 
 	if model == "" {
-		model = "local-model"
+		model = DefaultLocalModel
 	}
 
 	c := &Client{
@@ -202,38 +278,96 @@ func NewAzureAnthropicClient(endpoint, apiKey, model string, opts ...ClientOptio
 	if apiKey == "" {
 		return nil, fmt.Errorf("Azure Anthropic API key is required")
 	}
+	return newClaudeClient(ProviderAzureAnthropic, endpoint, apiKey, model, opts)
+}
+
+// NewAnthropicClient creates a client for the Anthropic (Claude) API at
+// DefaultAnthropicBaseURL; WithBaseURL points it at a proxy instead
+func NewAnthropicClient(apiKey, model string, opts ...ClientOption) (*Client, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("Anthropic API key is required")
+	}
+	return newClaudeClient(ProviderAnthropic, DefaultAnthropicBaseURL, apiKey, model, opts)
+}
 
+// newClaudeClient creates a client for provider, either Claude backend,
+// with its SDK client built once the options are applied
+func newClaudeClient(provider Provider, endpoint, apiKey, model string, opts []ClientOption) (*Client, error) {
 	endpoint = strings.TrimSuffix(endpoint, "/")
 
 	if model == "" {
-		model = "claude-sonnet-4-20250514" // Default to Claude Sonnet 4
+		model = DefaultAnthropicModel
 	}
 
-	// Create Anthropic client with Azure endpoint
-	anthropicClient := anthropic.NewClient(
-		option.WithAPIKey(apiKey),
-		option.WithBaseURL(endpoint),
-	)
-
 	c := &Client{
-		provider: ProviderAzureAnthropic,
+		provider: provider,
 		baseURL:  endpoint,
 		apiKey:   apiKey,
 		model:    model,
 		httpClient: &http.Client{
 			Timeout: 5 * time.Minute,
 		},
-		debug:           false,
-		anthropicClient: &anthropicClient,
+		debug: false,
 	}
 
 	for _, opt := range opts {
 		opt(c)
 	}
 
+	// Create the Anthropic SDK client after the options so it shares a
+	// custom transport and base URL (the SDK applies its own request timeout)
+	sdkOpts := []option.RequestOption{
+		option.WithAPIKey(apiKey),
+		option.WithBaseURL(c.baseURL),
+	}
+	if c.httpClient.Transport != nil {
+		sdkOpts = append(sdkOpts, option.WithHTTPClient(&http.Client{Transport: c.httpClient.Transport}))
+	}
+	anthropicClient := anthropic.NewClient(sdkOpts...)
+	c.anthropicClient = &anthropicClient
+
+	if err := ValidateBatchLimits(c.provider, c.batchSize, c.batchPayloadSize); err != nil {
+		return nil, err
+	}
+
 	return c, nil
 }
 
+// RequestTimeoutFromEnv returns the per-request timeout from CAPYCUT_REQUEST_TIMEOUT,
+// or zero when unset so each provider keeps its default
+func RequestTimeoutFromEnv() (time.Duration, error) {
+	return durationFromEnv(RequestTimeoutEnvVar, 0)
+}
+
+// JobTimeoutFor returns the overall timeout for a job of imageCount images:
+// CAPYCUT_JOB_TIMEOUT when set, otherwise the per-image budget
+// (CAPYCUT_PER_IMAGE_TIMEOUT or DefaultPerImageTimeout) times the count,
+// kept between MinJobTimeout and MaxJobTimeout
+func JobTimeoutFor(imageCount int) (time.Duration, error) {
+	fixed, err := durationFromEnv(JobTimeoutEnvVar, 0)
+	if err != nil || fixed > 0 {
+		return fixed, err
+	}
+	perImage, err := durationFromEnv(PerImageTimeoutEnvVar, DefaultPerImageTimeout)
+	if err != nil {
+		return 0, err
+	}
+	return min(max(perImage*time.Duration(imageCount), MinJobTimeout), MaxJobTimeout), nil
+}
+
+// durationFromEnv parses a positive duration from an env var, returning fallback when unset
+func durationFromEnv(name string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: expected a positive duration like 90s or 10m", name, value)
+	}
+	return d, nil
+}
+
 // IsTwoStageEnabled returns true if the client has a separate text model configured
 func (c *Client) IsTwoStageEnabled() bool {
 	return c.textModel != ""
@@ -244,31 +378,150 @@ func (c *Client) GetTextModel() string {
 	return c.textModel
 }
 
+// GetProvider returns the provider the client talks to
+func (c *Client) GetProvider() Provider {
+	return c.provider
+}
+
+// GetBaseURL returns the base URL requests are sent to
+func (c *Client) GetBaseURL() string {
+	return c.baseURL
+}
+
 // NewClientFromEnv creates a client using environment variables
-// It first checks for local LLM (LLM_ENDPOINT), then falls back to Gemini API
+// It uses the provider LLM_PROVIDER names when it can transcribe, and
+// otherwise the first configured one: local LLM (LLM_ENDPOINT) first,
+// Gemini API last
 //
 // For local LLM two-stage pipeline (vision + text model):
 //   - IMAGE_VISION_MODEL / LLM_MODEL: Vision model for image scanning (e.g., llava, qwen-vl)
 //   - IMAGE_TEXT_MODEL: Text/agentic model for markdown generation (e.g., mistral, llama)
 //   - IMAGE_TEXT_ENDPOINT: Optional separate endpoint for text model
+//
+// When CAPYCUT_PROVIDER_FALLBACK lists providers (e.g. "local,gemini"), the
+// first one that can be configured becomes the primary and the rest are
+// tried in order for batches it fails.
+//
+// Requests honor the standard proxy variables, and CAPYCUT_CA_CERT and
+// CAPYCUT_INSECURE configure TLS for private endpoints (see llm.TransportFromEnv).
 func NewClientFromEnv(opts ...ClientOption) (*Client, error) {
-	debug := os.Getenv("CAPYCUT_DEBUG") != ""
+	// Env timeout goes first so explicit options still take precedence
+	timeout, err := RequestTimeoutFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		opts = append([]ClientOption{WithTimeout(timeout)}, opts...)
+	}
+	memLimit, err := MemoryLimitFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if memLimit > 0 {
+		opts = append([]ClientOption{WithMemoryLimit(memLimit)}, opts...)
+	}
+	transport, err := llm.TransportFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	opts = append([]ClientOption{WithTransport(transport)}, opts...)
 
-	// Check for local LLM first (same env vars as video clipping)
-	localEndpoint := os.Getenv("LLM_ENDPOINT")
-	localModel := os.Getenv("LLM_MODEL")
+	// An explicit fallback chain replaces the usual provider detection
+	chain, err := ProviderFallbackFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if len(chain) > 0 {
+		return newClientChain(chain, opts)
+	}
 
-	// Also check for image-specific overrides
-	if imgEndpoint := os.Getenv("IMAGE_LLM_ENDPOINT"); imgEndpoint != "" {
-		localEndpoint = imgEndpoint
+	// Otherwise the chosen or first configured provider (see llm.RoleTranscription)
+	provider, err := llm.RoleTranscription.Select()
+	if err != nil {
+		return nil, err
+	}
+	if provider == "" {
+		return nil, fmt.Errorf("no backend configured. Set LLM_ENDPOINT for local LLM, AZURE_ANTHROPIC_ENDPOINT for Azure Anthropic, GEMINI_API_KEY for Gemini, or ANTHROPIC_API_KEY for Anthropic")
 	}
-	if imgModel := os.Getenv("IMAGE_LLM_MODEL"); imgModel != "" {
-		localModel = imgModel
+	return NewClientForProviderFromEnv(provider, opts...)
+}
+
+// NewClientForProviderFromEnv creates a client for one specific provider,
+// reading that provider's settings from the environment
+func NewClientForProviderFromEnv(provider Provider, opts ...ClientOption) (*Client, error) {
+	switch provider {
+	case ProviderLocal:
+		if missing := llm.RoleTranscription.Missing(provider); missing != "" {
+			return nil, fmt.Errorf("%s is not set", missing)
+		}
+		return newLocalClientFromEnv(opts)
+	case ProviderAzureAnthropic:
+		return newAzureAnthropicClientFromEnv(opts)
+	case ProviderAnthropic:
+		return newAnthropicClientFromEnv(opts)
+	case ProviderGemini:
+		return newGeminiClientFromEnv(opts)
+	default:
+		return nil, fmt.Errorf("unknown provider %q", provider)
 	}
-	// Vision model override (more explicit name)
-	if visionModel := os.Getenv("IMAGE_VISION_MODEL"); visionModel != "" {
-		localModel = visionModel
+}
+
+// Variables naming the local server and its vision model, image-specific
+// overrides first
+var (
+	localEndpointVars = []string{"IMAGE_LLM_ENDPOINT", "LLM_ENDPOINT"}
+	localModelVars    = []string{"IMAGE_VISION_MODEL", "IMAGE_LLM_MODEL", "LLM_MODEL"}
+)
+
+// localEndpointFromEnv returns the local LLM endpoint, preferring the
+// image-specific override
+func localEndpointFromEnv() string {
+	return llm.FirstEnv(localEndpointVars...)
+}
+
+// geminiAPIKeyFromEnv returns GEMINI_API_KEY or GOOGLE_API_KEY
+func geminiAPIKeyFromEnv() string {
+	return llm.FirstEnv("GEMINI_API_KEY", "GOOGLE_API_KEY")
+}
+
+// Built-in models for providers whose env vars don't name one
+const (
+	// DefaultLocalModel is sent to local servers, most of which answer with
+	// whatever model is loaded
+	DefaultLocalModel = llm.DefaultLocalModel
+
+	// DefaultAnthropicModel is the Claude model for Anthropic and Azure
+	// Anthropic
+	DefaultAnthropicModel = llm.DefaultAnthropicModel
+)
+
+// DefaultAnthropicBaseURL is the Anthropic API
+const DefaultAnthropicBaseURL = llm.DefaultAnthropicBaseURL
+
+// DefaultModelFor returns the model to use for provider when none was
+// chosen: IMAGE_VISION_MODEL, IMAGE_LLM_MODEL or LLM_MODEL (in that order)
+// for local servers, AZURE_ANTHROPIC_MODEL for Azure Anthropic,
+// ANTHROPIC_MODEL for Anthropic, then the built-in default. It never
+// returns an empty string.
+func DefaultModelFor(provider Provider) string {
+	switch provider {
+	case ProviderLocal:
+		return llm.LocalFromEnv(localEndpointVars, localModelVars).Model
+	case ProviderAzureAnthropic:
+		return llm.AzureAnthropicFromEnv().Model
+	case ProviderAnthropic:
+		return llm.AnthropicFromEnv().Model
+	default:
+		return ModelGemini3Pro
 	}
+}
+
+// newLocalClientFromEnv creates a local LLM client from LLM_* and IMAGE_* variables
+func newLocalClientFromEnv(opts []ClientOption) (*Client, error) {
+	debug := os.Getenv("CAPYCUT_DEBUG") != ""
+
+	localEndpoint := localEndpointFromEnv()
+	localModel := DefaultModelFor(ProviderLocal)
 
 	// Two-stage pipeline: separate text/agentic model for refinement
 	textModel := os.Getenv("IMAGE_TEXT_MODEL")
@@ -277,53 +530,64 @@ func NewClientFromEnv(opts ...ClientOption) (*Client, error) {
 		textEndpoint = localEndpoint // Default to same endpoint
 	}
 
-	if localEndpoint != "" {
-		if debug {
-			fmt.Println("\n[DEBUG] Local LLM Configuration (Image Transcription):")
-			fmt.Printf("  Vision Endpoint: %s\n", localEndpoint)
-			fmt.Printf("  Vision Model:    %s\n", localModel)
-			if textModel != "" {
-				fmt.Printf("  Text Endpoint:   %s\n", textEndpoint)
-				fmt.Printf("  Text Model:      %s (two-stage pipeline enabled)\n", textModel)
-			} else {
-				fmt.Println("  Text Model:      (same as vision - single-stage)")
-			}
-			fmt.Println()
-		}
-		clientOpts := append(opts,
-			WithTextModel(textModel),
-			WithTextEndpoint(textEndpoint),
-		)
-		return NewLocalClient(localEndpoint, localModel, clientOpts...)
-	}
-
-	// Check for Azure Anthropic
-	azureAnthropicEndpoint := os.Getenv("AZURE_ANTHROPIC_ENDPOINT")
-	azureAnthropicAPIKey := os.Getenv("AZURE_ANTHROPIC_API_KEY")
-	azureAnthropicModel := os.Getenv("AZURE_ANTHROPIC_MODEL")
-
-	if azureAnthropicEndpoint != "" {
-		if debug {
-			fmt.Println("\n[DEBUG] Azure Anthropic Configuration (Image Transcription):")
-			fmt.Printf("  Endpoint: %s\n", azureAnthropicEndpoint)
-			if azureAnthropicAPIKey != "" {
-				fmt.Printf("  API Key:  %s...%s\n", azureAnthropicAPIKey[:4], azureAnthropicAPIKey[len(azureAnthropicAPIKey)-4:])
-			}
-			fmt.Printf("  Model:    %s\n", azureAnthropicModel)
-			fmt.Println()
+	if debug {
+		fmt.Println("\n[DEBUG] Local LLM Configuration (Image Transcription):")
+		fmt.Printf("  Vision Endpoint: %s\n", localEndpoint)
+		fmt.Printf("  Vision Model:    %s\n", localModel)
+		if textModel != "" {
+			fmt.Printf("  Text Endpoint:   %s\n", textEndpoint)
+			fmt.Printf("  Text Model:      %s (two-stage pipeline enabled)\n", textModel)
+		} else {
+			fmt.Println("  Text Model:      (same as vision - single-stage)")
 		}
-		return NewAzureAnthropicClient(azureAnthropicEndpoint, azureAnthropicAPIKey, azureAnthropicModel, opts...)
+		fmt.Println()
 	}
+	clientOpts := append(opts[:len(opts):len(opts)],
+		WithTextModel(textModel),
+		WithTextEndpoint(textEndpoint),
+	)
+	return NewLocalClient(localEndpoint, localModel, clientOpts...)
+}
 
-	// Fall back to Gemini API
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	if apiKey == "" {
-		apiKey = os.Getenv("GOOGLE_API_KEY")
+// newAzureAnthropicClientFromEnv creates a Claude client from AZURE_ANTHROPIC_* variables
+func newAzureAnthropicClientFromEnv(opts []ClientOption) (*Client, error) {
+	debug := os.Getenv("CAPYCUT_DEBUG") != ""
+
+	cfg := llm.AzureAnthropicFromEnv()
+	azureAnthropicEndpoint, azureAnthropicAPIKey, azureAnthropicModel := cfg.Endpoint, cfg.APIKey, cfg.Model
+
+	if debug && azureAnthropicEndpoint != "" {
+		fmt.Println("\n[DEBUG] Azure Anthropic Configuration (Image Transcription):")
+		fmt.Printf("  Endpoint: %s\n", azureAnthropicEndpoint)
+		if len(azureAnthropicAPIKey) >= 8 {
+			fmt.Printf("  API Key:  %s...%s\n", azureAnthropicAPIKey[:4], azureAnthropicAPIKey[len(azureAnthropicAPIKey)-4:])
+		}
+		fmt.Printf("  Model:    %s\n", azureAnthropicModel)
+		fmt.Println()
 	}
-	if apiKey == "" {
-		return nil, fmt.Errorf("no backend configured. Set LLM_ENDPOINT for local LLM, AZURE_ANTHROPIC_ENDPOINT for Azure Anthropic, or GEMINI_API_KEY for Gemini")
+	return NewAzureAnthropicClient(azureAnthropicEndpoint, azureAnthropicAPIKey, azureAnthropicModel, opts...)
+}
+
+// newAnthropicClientFromEnv creates a Claude client from ANTHROPIC_* variables
+func newAnthropicClientFromEnv(opts []ClientOption) (*Client, error) {
+	cfg := llm.AnthropicFromEnv()
+
+	if os.Getenv("CAPYCUT_DEBUG") != "" && cfg.APIKey != "" {
+		fmt.Println("\n[DEBUG] Anthropic Configuration (Image Transcription):")
+		fmt.Printf("  Base URL: %s\n", cfg.Endpoint)
+		if len(cfg.APIKey) >= 8 {
+			fmt.Printf("  API Key:  %s...%s\n", cfg.APIKey[:4], cfg.APIKey[len(cfg.APIKey)-4:])
+		}
+		fmt.Printf("  Model:    %s\n", cfg.Model)
+		fmt.Println()
 	}
-	return NewClient(apiKey, opts...)
+	opts = append([]ClientOption{WithBaseURL(cfg.Endpoint)}, opts...)
+	return NewAnthropicClient(cfg.APIKey, cfg.Model, opts...)
+}
+
+// newGeminiClientFromEnv creates a Gemini client from GEMINI_API_KEY or GOOGLE_API_KEY
+func newGeminiClientFromEnv(opts []ClientOption) (*Client, error) {
+	return NewClient(geminiAPIKeyFromEnv(), opts...)
 }
 
 // batchResult holds the result of processing a batch
@@ -331,6 +595,8 @@ type batchResult struct {
 	batchIndex int
 	pages      []*PageContent
 	tokens     int
+	provider   Provider
+	model      string
 	err        error
 }
 
@@ -341,6 +607,25 @@ type transcribeContext struct {
 	totalBatches int
 	tokensUsed   int
 	onProgress   ProgressCallback
+
+	// batchProviders and batchModels record which provider and model
+	// handled each batch
+	batchProviders []Provider
+	batchModels    []string
+
+	// completedBatches counts finished batches; progress is sent from
+	// worker goroutines, so it is atomic
+	completedBatches atomic.Int32
+
+	// refineFailures counts batches that kept their vision output because
+	// text-model refinement failed
+	refineFailures atomic.Int32
+
+	// checkpoint saves and restores finished batches (nil = no ResumeFrom)
+	checkpoint *checkpoint
+
+	// resumedBatches counts batches restored from the checkpoint
+	resumedBatches atomic.Int32
 }
 
 // sendProgress sends a progress update if callback is configured
@@ -352,6 +637,7 @@ func (c *Client) sendProgress(ctx *transcribeContext, update ProgressUpdate) {
 	// Fill in common fields
 	update.TotalImages = ctx.totalImages
 	update.TotalBatches = ctx.totalBatches
+	update.CompletedBatches = int(ctx.completedBatches.Load())
 	update.TokensUsed = ctx.tokensUsed
 	update.Elapsed = time.Since(ctx.startTime)
 
@@ -366,7 +652,7 @@ func (c *Client) sendProgress(ctx *transcribeContext, update ProgressUpdate) {
 		if update.Model == "" {
 			update.Model = c.model
 		}
-	case ProviderAzureAnthropic:
+	case ProviderAzureAnthropic, ProviderAnthropic:
 		if update.Model == "" {
 			update.Model = c.model
 		}
@@ -388,8 +674,50 @@ func (c *Client) TranscribeImages(ctx context.Context, req *TranscribeRequest) (
 	return c.TranscribeImagesWithProgress(ctx, req, nil)
 }
 
-// TranscribeImagesWithProgress transcribes images with progress callbacks for UI updates
+// TranscribeImagesWithProgress transcribes images with progress callbacks for UI updates.
+// If ctx is cancelled after some batches finished, it returns a partial response
+// (Partial = true) built from the completed pages together with the context error.
+// The callback runs on the calling goroutine, one update at a time.
 func (c *Client) TranscribeImagesWithProgress(ctx context.Context, req *TranscribeRequest, onProgress ProgressCallback) (*TranscribeResponse, error) {
+	progress, results := c.TranscribeImagesStream(ctx, req)
+	for update := range progress {
+		if onProgress != nil {
+			onProgress(update)
+		}
+	}
+	result := <-results
+	return result.Response, result.Err
+}
+
+// progressStreamBuffer is how many progress updates TranscribeImagesStream
+// holds for a slow receiver before the job waits
+const progressStreamBuffer = 64
+
+// TranscribeImagesStream runs TranscribeImagesWithProgress in the background
+// and returns its progress updates and outcome as channels, for callers with
+// a select loop. progress is closed when the job ends, after which results
+// delivers exactly one TranscribeResult. Keep receiving from progress until
+// it is closed: the job waits when the buffer is full rather than dropping
+// updates.
+func (c *Client) TranscribeImagesStream(ctx context.Context, req *TranscribeRequest) (<-chan ProgressUpdate, <-chan TranscribeResult) {
+	progress := make(chan ProgressUpdate, progressStreamBuffer)
+	results := make(chan TranscribeResult, 1)
+
+	go func() {
+		resp, err := c.transcribeImages(ctx, req, func(update ProgressUpdate) {
+			progress <- update
+		})
+		close(progress)
+		results <- TranscribeResult{Response: resp, Err: err}
+		close(results)
+	}()
+
+	return progress, results
+}
+
+// transcribeImages does the work of TranscribeImagesStream; onProgress may
+// be called from several goroutines at once
+func (c *Client) transcribeImages(ctx context.Context, req *TranscribeRequest, onProgress ProgressCallback) (*TranscribeResponse, error) {
 	startTime := time.Now()
 
 	// Initialize progress tracking context
@@ -409,33 +737,105 @@ func (c *Client) TranscribeImagesWithProgress(ctx context.Context, req *Transcri
 	if len(req.Images) == 0 {
 		return nil, fmt.Errorf("at least one image is required")
 	}
-	if len(req.Images) > MaxTotalImages {
-		return nil, fmt.Errorf("maximum %d images allowed, got %d", MaxTotalImages, len(req.Images))
+
+	// Split two-page spreads first so every later step sees logical pages
+	images := req.Images
+	if req.SplitSpreads {
+		split, err := SplitSpreads(images)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(split) - len(images); n > 0 {
+			c.sendProgress(tctx, ProgressUpdate{
+				Status:  StatusConnecting,
+				Message: "Split two-page spreads",
+				Detail:  fmt.Sprintf("%d spreads became %d pages", n, 2*n),
+			})
+			if c.debug {
+				fmt.Printf("[DEBUG] Split %d spreads: %d images -> %d pages\n", n, len(images), len(split))
+			}
+		}
+		images = split
+	}
+
+	if len(images) > MaxTotalImages {
+		return nil, fmt.Errorf("maximum %d images allowed, got %d", MaxTotalImages, len(images))
 	}
 
-	tctx.totalImages = len(req.Images)
+	tctx.totalImages = len(images)
 
 	// Validate all images exist and are valid
-	imageInfos := make([]*ImageInfo, 0, len(req.Images))
-	for i, imgPath := range req.Images {
-		info, err := c.getImageInfo(imgPath)
+	imageInfos, failed, err := c.validateImages(images)
+	if err != nil {
+		imgPath := images[failed]
+		c.sendProgress(tctx, ProgressUpdate{
+			Status:  StatusError,
+			Message: "Image validation failed",
+			Detail:  fmt.Sprintf("Image %d (%s): %v", failed+1, imgPath, err),
+			Error:   err,
+		})
+		return nil, fmt.Errorf("image %d (%s): %w", failed+1, imgPath, err)
+	}
+
+	// Send each distinct image once; its pages are copied back to the
+	// repeats below and as batches complete
+	var duplicates map[int]int
+	if req.DedupePages {
+		imageInfos, duplicates, err = dedupeImages(imageInfos)
 		if err != nil {
+			return nil, err
+		}
+		if len(duplicates) > 0 {
 			c.sendProgress(tctx, ProgressUpdate{
-				Status:  StatusError,
-				Message: "Image validation failed",
-				Detail:  fmt.Sprintf("Image %d (%s): %v", i+1, imgPath, err),
-				Error:   err,
+				Status:  StatusConnecting,
+				Message: "Found duplicate pages",
+				Detail:  fmt.Sprintf("%d of %d pages repeat an earlier one and are transcribed once", len(duplicates), len(images)),
 			})
-			return nil, fmt.Errorf("image %d (%s): %w", i+1, imgPath, err)
+			if onBatch := req.OnBatchComplete; onBatch != nil {
+				r := *req
+				r.OnBatchComplete = func(batchIndex int, pages []*PageContent) {
+					onBatch(batchIndex, fanOutDuplicates(pages, duplicates))
+				}
+				req = &r
+			}
 		}
-		info.PageIndex = i
-		imageInfos = append(imageInfos, info)
 	}
 
 	// Set defaults - use Gemini 3 Pro as default (most capable model)
 	model := req.Model
 	if model == "" {
-		model = ModelGemini3Pro
+		model = DefaultModelFor(ProviderGemini)
+	}
+
+	if req.Concurrency < 0 {
+		return nil, fmt.Errorf("concurrency must be at least 1, got %d", req.Concurrency)
+	}
+	if concurrency, capped := batchConcurrency(req); capped {
+		c.sendProgress(tctx, ProgressUpdate{
+			Status:  StatusWarning,
+			Message: "Concurrency capped",
+			Detail:  fmt.Sprintf("%d exceeds the limit of %d parallel requests, using %d", req.Concurrency, MaxConcurrency, concurrency),
+		})
+	}
+
+	// Warn (but continue) if the requested output budget exceeds the provider ceiling
+	if maxTokens, clamped := c.outputTokenBudget(req); clamped {
+		c.sendProgress(tctx, ProgressUpdate{
+			Status:  StatusWarning,
+			Message: "Max output tokens clamped",
+			Detail:  fmt.Sprintf("%d exceeds the %s limit, using %d", req.MaxOutputTokens, c.getProviderDisplayName(), maxTokens),
+		})
+		if c.debug {
+			fmt.Printf("[DEBUG] MaxOutputTokens %d clamped to %d\n", req.MaxOutputTokens, maxTokens)
+		}
+	}
+
+	if req.ResumeFrom != "" {
+		cp, err := openCheckpoint(req.ResumeFrom, model, c.textModel, req)
+		if err != nil {
+			return nil, err
+		}
+		tctx.checkpoint = cp
 	}
 
 	// Create smart batches based on payload size
@@ -448,6 +848,8 @@ func (c *Client) TranscribeImagesWithProgress(ctx context.Context, req *Transcri
 	}
 
 	tctx.totalBatches = len(batches)
+	tctx.batchProviders = make([]Provider, len(batches))
+	tctx.batchModels = make([]string, len(batches))
 
 	// Determine number of stages
 	totalStages := 1
@@ -478,6 +880,16 @@ func (c *Client) TranscribeImagesWithProgress(ctx context.Context, req *Transcri
 
 	// Process batches in parallel with worker pool
 	allPageContents, totalTokens, err := c.processBatchesParallelWithProgress(ctx, batches, req, model, tctx)
+	allPageContents = fanOutDuplicates(allPageContents, duplicates)
+
+	// Running heads are found by comparing pages, so this waits for every batch
+	if req.StripRunningHeads {
+		removed := StripRunningHeads(allPageContents)
+		if os.Getenv("CAPYCUT_DEBUG") != "" {
+			fmt.Printf("[DEBUG] Stripped %d running header/footer lines\n", removed)
+		}
+	}
+
 	if err != nil {
 		c.sendProgress(tctx, ProgressUpdate{
 			Status:  StatusError,
@@ -485,6 +897,23 @@ func (c *Client) TranscribeImagesWithProgress(ctx context.Context, req *Transcri
 			Detail:  err.Error(),
 			Error:   err,
 		})
+
+		// Keep whatever finished before cancellation so the caller can still write it
+		if ctx.Err() != nil && len(allPageContents) > 0 {
+			return &TranscribeResponse{
+				Documents:          c.organizePages(allPageContents, req),
+				TotalPages:         len(images),
+				ProcessingTime:     time.Since(startTime),
+				TokensUsed:         totalTokens,
+				Partial:            true,
+				CompletedPages:     len(allPageContents),
+				Pages:              allPageContents,
+				BatchProviders:     tctx.batchProviders,
+				BatchModels:        tctx.batchModels,
+				RefinementFailures: int(tctx.refineFailures.Load()),
+				ResumedBatches:     int(tctx.resumedBatches.Load()),
+			}, err
+		}
 		return nil, err
 	}
 
@@ -499,22 +928,46 @@ func (c *Client) TranscribeImagesWithProgress(ctx context.Context, req *Transcri
 		Progress:     1.0,
 	})
 
+	return &TranscribeResponse{
+		Documents:          c.organizePages(allPageContents, req),
+		TotalPages:         len(images),
+		ProcessingTime:     time.Since(startTime),
+		TokensUsed:         totalTokens,
+		CompletedPages:     len(allPageContents),
+		Pages:              allPageContents,
+		BatchProviders:     tctx.batchProviders,
+		BatchModels:        tctx.batchModels,
+		RefinementFailures: int(tctx.refineFailures.Load()),
+		ResumedBatches:     int(tctx.resumedBatches.Load()),
+	}, nil
+}
+
+// organizePages groups extracted pages into documents based on the request options
+func (c *Client) organizePages(pages []*PageContent, req *TranscribeRequest) []*MarkdownDocument {
 	// Detect chapters and organize content
-	var documents []*MarkdownDocument
-	if req.DetectChapters {
-		documents = c.organizeByChapters(allPageContents, req)
-	} else if req.CombinePages {
-		documents = []*MarkdownDocument{c.combineAllPages(allPageContents, req)}
-	} else {
-		documents = c.createPerPageDocuments(allPageContents, req)
+	var docs []*MarkdownDocument
+	switch {
+	case req.DetectChapters:
+		docs = c.organizeByChapters(pages, req)
+	case req.CombinePages:
+		docs = []*MarkdownDocument{c.combineAllPages(pages, req)}
+	default:
+		docs = c.createPerPageDocuments(pages, req)
 	}
 
-	return &TranscribeResponse{
-		Documents:      documents,
-		TotalPages:     len(req.Images),
-		ProcessingTime: time.Since(startTime),
-		TokensUsed:     totalTokens,
-	}, nil
+	if req.ExtractTables {
+		for _, doc := range docs {
+			doc.Tables = tablesFromPages(doc.Pages)
+		}
+	}
+	return docs
+}
+
+// OrganizePages groups previously extracted pages into documents exactly as
+// TranscribeImages would, without calling any API. DetectChapters and
+// CombinePages on req select the organization mode.
+func OrganizePages(pages []*PageContent, req *TranscribeRequest) []*MarkdownDocument {
+	return (&Client{}).organizePages(pages, req)
 }
 
 // getProviderDisplayName returns a user-friendly provider name
@@ -526,12 +979,15 @@ func (c *Client) getProviderDisplayName() string {
 		return fmt.Sprintf("Local LLM (%s)", c.model)
 	case ProviderAzureAnthropic:
 		return fmt.Sprintf("Azure Anthropic (%s)", c.model)
+	case ProviderAnthropic:
+		return fmt.Sprintf("Anthropic (%s)", c.model)
 	default:
 		return string(c.provider)
 	}
 }
 
 // createSmartBatches groups images into batches based on payload size limits
+// and the images-per-request cap (see WithBatchSize and WithBatchPayloadSize)
 func (c *Client) createSmartBatches(images []*ImageInfo) [][]*ImageInfo {
 	var batches [][]*ImageInfo
 	var currentBatch []*ImageInfo
@@ -540,12 +996,15 @@ func (c *Client) createSmartBatches(images []*ImageInfo) [][]*ImageInfo {
 	// Calculate base64 overhead factor (~1.37x for base64 encoding + JSON overhead)
 	const overheadFactor = 1.4
 
+	maxImages := c.maxBatchImages()
+	maxPayload := c.maxBatchPayload()
+
 	for _, img := range images {
 		estimatedSize := int64(float64(img.Size) * overheadFactor)
 
 		// Check if adding this image would exceed limits
-		wouldExceedSize := currentSize+estimatedSize > MaxPayloadSize
-		wouldExceedCount := len(currentBatch) >= MaxImagesPerRequest
+		wouldExceedSize := currentSize+estimatedSize > maxPayload
+		wouldExceedCount := len(currentBatch) >= maxImages
 
 		if (wouldExceedSize || wouldExceedCount) && len(currentBatch) > 0 {
 			// Start a new batch
@@ -555,7 +1014,7 @@ func (c *Client) createSmartBatches(images []*ImageInfo) [][]*ImageInfo {
 		}
 
 		// Handle case where single image exceeds payload size
-		if estimatedSize > MaxPayloadSize {
+		if estimatedSize > maxPayload {
 			if c.debug {
 				fmt.Printf("[DEBUG] Warning: Image %s (%.2f MB) is large, processing alone\n",
 					img.Filename, float64(img.Size)/(1024*1024))
@@ -610,9 +1069,15 @@ func (c *Client) processBatchesParallelWithProgress(ctx context.Context, batches
 		return c.processBatchesSequentialWithProgress(ctx, batches, req, model, tctx)
 	}
 
+	// Siblings share a child context that is cancelled on the first batch
+	// failure, so queued batches never start and in-flight requests stop
+	batchCtx, cancelBatches := context.WithCancel(ctx)
+	defer cancelBatches()
+
 	// Process in parallel with worker pool
 	results := make(chan *batchResult, len(batches))
-	sem := make(chan struct{}, MaxConcurrentRequests)
+	concurrency, _ := batchConcurrency(req)
+	sem := make(chan struct{}, concurrency)
 
 	var wg sync.WaitGroup
 
@@ -621,14 +1086,19 @@ func (c *Client) processBatchesParallelWithProgress(ctx context.Context, batches
 		go func(idx int, imgs []*ImageInfo) {
 			defer wg.Done()
 
-			// Acquire semaphore
-			sem <- struct{}{}
+			// Acquire semaphore unless the job is already failing
+			select {
+			case sem <- struct{}{}:
+			case <-batchCtx.Done():
+				results <- &batchResult{batchIndex: idx, err: batchCtx.Err()}
+				return
+			}
 			defer func() { <-sem }()
 
 			// Check context cancellation
 			select {
-			case <-ctx.Done():
-				results <- &batchResult{batchIndex: idx, err: ctx.Err()}
+			case <-batchCtx.Done():
+				results <- &batchResult{batchIndex: idx, err: batchCtx.Err()}
 				return
 			default:
 			}
@@ -649,11 +1119,21 @@ func (c *Client) processBatchesParallelWithProgress(ctx context.Context, batches
 				fmt.Printf("[DEBUG] Processing batch %d/%d (%d images)...\n", idx+1, len(batches), len(imgs))
 			}
 
-			pages, tokens, err := c.processBatchWithProgress(ctx, imgs, req, model, tctx, idx+1)
+			pages, tokens, provider, batchModel, err := c.processBatchCheckpointed(batchCtx, imgs, req, model, tctx, idx+1)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				// A failed batch fails the job, so stop the rest here rather
+				// than leave it to the collector. The deferred release frees
+				// this slot as soon as the result is sent, and a queued
+				// sibling could take it and start a request, to be billed
+				// for, before the collector reads the failure and cancels.
+				cancelBatches()
+			}
 			results <- &batchResult{
 				batchIndex: idx,
 				pages:      pages,
 				tokens:     tokens,
+				provider:   provider,
+				model:      batchModel,
 				err:        err,
 			}
 		}(i, batch)
@@ -665,13 +1145,58 @@ func (c *Client) processBatchesParallelWithProgress(ctx context.Context, batches
 		close(results)
 	}()
 
-	// Collect results
+	// Collect results, always draining so no worker outlives this call. On
+	// cancellation completed batches are still returned to the caller. Errors
+	// are reported for the lowest failing batch so they don't depend on
+	// scheduling, and siblings stopped by our own cancel are not failures.
 	resultMap := make(map[int]*batchResult)
+	var failed, cancelled *batchResult
 	for result := range results {
 		if result.err != nil {
-			return nil, 0, fmt.Errorf("batch %d failed: %w", result.batchIndex+1, result.err)
+			switch {
+			case ctx.Err() != nil:
+				if cancelled == nil || result.batchIndex < cancelled.batchIndex {
+					cancelled = result
+				}
+			case batchCtx.Err() != nil && errors.Is(result.err, context.Canceled):
+				// Stopped because another batch failed
+			default:
+				if failed == nil || result.batchIndex < failed.batchIndex {
+					failed = result
+				}
+				cancelBatches()
+			}
+			continue
 		}
 		resultMap[result.batchIndex] = result
+		if tctx != nil {
+			tctx.batchProviders[result.batchIndex] = result.provider
+			tctx.batchModels[result.batchIndex] = result.model
+			tctx.completedBatches.Add(1)
+		}
+		if req.OnBatchComplete != nil {
+			req.OnBatchComplete(result.batchIndex, result.pages)
+		}
+		c.sendProgress(tctx, ProgressUpdate{
+			Status:       StatusParsingResponse,
+			Message:      fmt.Sprintf("Batch %d complete", result.batchIndex+1),
+			Detail:       fmt.Sprintf("%d pages extracted", len(result.pages)),
+			CurrentBatch: result.batchIndex + 1,
+			Progress:     float64(len(resultMap)) / float64(len(batches)),
+			Model:        result.model,
+			ResponseInfo: &AIResponseInfo{
+				TokensTotal:    result.tokens,
+				ItemsProcessed: len(result.pages),
+			},
+		})
+	}
+
+	if failed != nil {
+		return nil, 0, fmt.Errorf("batch %d failed: %w", failed.batchIndex+1, failed.err)
+	}
+	var cancelErr error
+	if cancelled != nil {
+		cancelErr = fmt.Errorf("batch %d failed: %w", cancelled.batchIndex+1, cancelled.err)
 	}
 
 	// Combine results in order
@@ -679,12 +1204,15 @@ func (c *Client) processBatchesParallelWithProgress(ctx context.Context, batches
 	totalTokens := 0
 
 	for i := 0; i < len(batches); i++ {
-		result := resultMap[i]
+		result, ok := resultMap[i]
+		if !ok {
+			continue
+		}
 		allPages = append(allPages, result.pages...)
 		totalTokens += result.tokens
 	}
 
-	return allPages, totalTokens, nil
+	return allPages, totalTokens, cancelErr
 }
 
 // processBatchesSequential processes batches one by one (for small jobs)
@@ -717,8 +1245,12 @@ func (c *Client) processBatchesSequentialWithProgress(ctx context.Context, batch
 			fmt.Printf("[DEBUG] Processing batch %d/%d (%d images)...\n", i+1, totalBatches, len(batch))
 		}
 
-		pages, tokens, err := c.processBatchWithProgress(ctx, batch, req, model, tctx, i+1)
+		pages, tokens, provider, batchModel, err := c.processBatchCheckpointed(ctx, batch, req, model, tctx, i+1)
 		if err != nil {
+			if ctx.Err() != nil {
+				// Cancelled: hand back the batches that already finished
+				return allPages, totalTokens, fmt.Errorf("batch %d failed: %w", i+1, err)
+			}
 			return nil, 0, fmt.Errorf("batch %d failed: %w", i+1, err)
 		}
 
@@ -728,6 +1260,12 @@ func (c *Client) processBatchesSequentialWithProgress(ctx context.Context, batch
 		// Update tokens used and progress after batch complete
 		if tctx != nil {
 			tctx.tokensUsed = totalTokens
+			tctx.batchProviders[i] = provider
+			tctx.batchModels[i] = batchModel
+			tctx.completedBatches.Add(1)
+		}
+		if req.OnBatchComplete != nil {
+			req.OnBatchComplete(i, pages)
 		}
 
 		// Send completion progress for this batch
@@ -739,7 +1277,7 @@ func (c *Client) processBatchesSequentialWithProgress(ctx context.Context, batch
 			CurrentBatch: i + 1,
 			TotalBatches: totalBatches,
 			Progress:     batchProgress,
-			Model:        model,
+			Model:        batchModel,
 			ResponseInfo: &AIResponseInfo{
 				TokensTotal:    tokens,
 				ItemsProcessed: len(pages),
@@ -750,6 +1288,39 @@ func (c *Client) processBatchesSequentialWithProgress(ctx context.Context, batch
 	return allPages, totalTokens, nil
 }
 
+// validateImages runs getImageInfo over paths with a bounded worker pool,
+// which matters for hundreds of images on a network drive. Results keep the
+// input order with PageIndex set. On failure it returns the index and error
+// of the earliest failing path, so the reported error doesn't depend on
+// scheduling.
+func (c *Client) validateImages(paths []string) ([]*ImageInfo, int, error) {
+	infos := make([]*ImageInfo, len(paths))
+	errs := make([]error, len(paths))
+	sem := make(chan struct{}, MaxConcurrentValidations)
+
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		wg.Add(1)
+		go func(idx int, p string) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			infos[idx], errs[idx] = c.getImageInfo(p)
+		}(i, path)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, i, err
+		}
+		infos[i].PageIndex = i
+	}
+	return infos, -1, nil
+}
+
 // getImageInfo validates and extracts info about an image file
 func (c *Client) getImageInfo(path string) (*ImageInfo, error) {
 	info, err := os.Stat(path)
@@ -765,6 +1336,10 @@ func (c *Client) getImageInfo(path string) (*ImageInfo, error) {
 		return nil, fmt.Errorf("file size %d exceeds maximum %d bytes (20MB)", info.Size(), MaxFileSize)
 	}
 
+	if isPDFFile(path) {
+		return nil, fmt.Errorf("PDF documents must be rendered to images first; load them with LoadImages")
+	}
+
 	ext := strings.ToLower(filepath.Ext(path))
 	mimeType := getMIMEType(ext)
 	if mimeType == "" {
@@ -816,8 +1391,8 @@ func (c *Client) processBatchWithProgress(ctx context.Context, images []*ImageIn
 	var endpoint string
 	switch c.provider {
 	case ProviderLocal:
-		endpoint = c.baseURL + "/v1/chat/completions"
-	case ProviderAzureAnthropic:
+		endpoint = llm.ChatCompletionsURL(c.baseURL)
+	case ProviderAzureAnthropic, ProviderAnthropic:
 		endpoint = c.baseURL + "/v1/messages"
 	default:
 		endpoint = fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent", model)
@@ -826,6 +1401,23 @@ func (c *Client) processBatchWithProgress(ctx context.Context, images []*ImageIn
 	// Build prompt preview for transparency
 	promptPreview := "Extract text from images, output JSON with page contents..."
 
+	maxTokens, _ := c.outputTokenBudget(req)
+
+	params := map[string]string{
+		"model":             model,
+		"max_output_tokens": fmt.Sprintf("%d", maxTokens),
+		"response_format":   "application/json",
+	}
+	if req.Temperature != nil {
+		params["temperature"] = fmt.Sprintf("%g", *req.Temperature)
+	}
+	if req.TopP != nil {
+		params["top_p"] = fmt.Sprintf("%g", *req.TopP)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		params["job_time_left"] = time.Until(deadline).Round(time.Second).String()
+	}
+
 	// Send progress: sending request with transparency info
 	c.sendProgress(tctx, ProgressUpdate{
 		Status:       StatusSendingRequest,
@@ -840,11 +1432,7 @@ func (c *Client) processBatchWithProgress(ctx context.Context, images []*ImageIn
 			ImageCount:    len(images),
 			TotalDataSize: totalDataSize,
 			PromptPreview: promptPreview,
-			Parameters: map[string]string{
-				"model":             model,
-				"max_output_tokens": "8192",
-				"response_format":   "application/json",
-			},
+			Parameters:    params,
 		},
 	})
 
@@ -853,44 +1441,59 @@ func (c *Client) processBatchWithProgress(ctx context.Context, images []*ImageIn
 	var err error
 	startTime := time.Now()
 
-	// Route to appropriate provider
-	switch c.provider {
-	case ProviderLocal:
-		// Send progress: waiting for response
-		c.sendProgress(tctx, ProgressUpdate{
-			Status:       StatusWaitingResponse,
-			Message:      "Waiting for Local LLM response",
-			Detail:       fmt.Sprintf("Model: %s", c.model),
-			CurrentBatch: batchNum,
-			Model:        c.model,
-		})
-		pages, tokens, err = c.processBatchLocal(ctx, images, req)
-	case ProviderAzureAnthropic:
-		c.sendProgress(tctx, ProgressUpdate{
-			Status:       StatusWaitingResponse,
-			Message:      "Waiting for Claude response",
-			Detail:       fmt.Sprintf("Model: %s", c.model),
-			CurrentBatch: batchNum,
-			Model:        c.model,
-		})
-		pages, tokens, err = c.processBatchAzureAnthropic(ctx, images, req)
-	default:
+	// Retry with a larger budget when the model runs out of output tokens
+	ceiling := c.maxOutputTokensCeiling()
+	var truncatedTokens int
+	for {
+		pages, tokens, err = c.processBatchProviderWithRetry(ctx, images, req, model, maxTokens, tctx, batchNum)
+
+		var truncErr *TruncatedOutputError
+		if !errors.As(err, &truncErr) {
+			break
+		}
+
+		if maxTokens >= ceiling {
+			// No headroom left, keep the best-effort result from the partial output
+			c.sendProgress(tctx, ProgressUpdate{
+				Status:       StatusWarning,
+				Message:      "Output still truncated, using partial result",
+				Detail:       fmt.Sprintf("Batch %d: hit the %d token ceiling", batchNum, ceiling),
+				CurrentBatch: batchNum,
+				Model:        model,
+			})
+			pages, tokens, err = truncErr.Pages, truncErr.Tokens, nil
+			break
+		}
+
+		next := min(maxTokens*2, ceiling)
 		c.sendProgress(tctx, ProgressUpdate{
-			Status:       StatusWaitingResponse,
-			Message:      "Waiting for Gemini response",
-			Detail:       fmt.Sprintf("Model: %s", model),
+			Status:       StatusWarning,
+			Message:      "Output truncated, retrying batch",
+			Detail:       fmt.Sprintf("Batch %d: max tokens %d -> %d", batchNum, maxTokens, next),
 			CurrentBatch: batchNum,
 			Model:        model,
 		})
-		pages, tokens, err = c.processBatchGemini(ctx, images, req, model)
+		if c.debug {
+			fmt.Printf("[DEBUG] Batch %d output truncated at %d tokens, retrying with %d\n", batchNum, maxTokens, next)
+		}
+
+		truncatedTokens += truncErr.Tokens
+		maxTokens = next
 	}
+	tokens += truncatedTokens
 
 	latency := time.Since(startTime)
 
 	if err != nil {
+		// A fallback may still rescue the batch, so don't report it as fatal
+		status := StatusError
+		if len(c.fallbacks) > 0 && ctx.Err() == nil {
+			status = StatusWarning
+		}
+
 		// Send error with transparency info
 		c.sendProgress(tctx, ProgressUpdate{
-			Status:       StatusError,
+			Status:       status,
 			Message:      "Request failed",
 			Detail:       err.Error(),
 			CurrentBatch: batchNum,
@@ -923,8 +1526,67 @@ func (c *Client) processBatchWithProgress(ctx context.Context, images []*ImageIn
 	return pages, tokens, nil
 }
 
+// processBatchProvider routes a single batch request to the configured provider
+func (c *Client) processBatchProvider(ctx context.Context, images []*ImageInfo, req *TranscribeRequest, model string, maxTokens int, tctx *transcribeContext, batchNum int) ([]*PageContent, int, error) {
+	switch c.provider {
+	case ProviderLocal:
+		// Send progress: waiting for response
+		c.sendProgress(tctx, ProgressUpdate{
+			Status:       StatusWaitingResponse,
+			Message:      "Waiting for Local LLM response",
+			Detail:       fmt.Sprintf("Model: %s", c.model),
+			CurrentBatch: batchNum,
+			Model:        c.model,
+		})
+		return c.processBatchLocal(ctx, images, req, maxTokens, tctx, batchNum)
+	case ProviderAzureAnthropic, ProviderAnthropic:
+		c.sendProgress(tctx, ProgressUpdate{
+			Status:       StatusWaitingResponse,
+			Message:      "Waiting for Claude response",
+			Detail:       fmt.Sprintf("Model: %s", c.model),
+			CurrentBatch: batchNum,
+			Model:        c.model,
+		})
+		return c.processBatchAzureAnthropic(ctx, images, req, maxTokens)
+	default:
+		c.sendProgress(tctx, ProgressUpdate{
+			Status:       StatusWaitingResponse,
+			Message:      "Waiting for Gemini response",
+			Detail:       fmt.Sprintf("Model: %s", model),
+			CurrentBatch: batchNum,
+			Model:        model,
+		})
+		return c.processBatchGemini(ctx, images, req, model, maxTokens)
+	}
+}
+
+// outputTokenBudget returns the per-batch output token budget for a request,
+// clamped to the provider ceiling. The bool reports whether clamping happened.
+func (c *Client) outputTokenBudget(req *TranscribeRequest) (int, bool) {
+	ceiling := c.maxOutputTokensCeiling()
+	if req.MaxOutputTokens <= 0 {
+		return min(DefaultMaxOutputTokens, ceiling), false
+	}
+	if req.MaxOutputTokens > ceiling {
+		return ceiling, true
+	}
+	return req.MaxOutputTokens, false
+}
+
+// maxOutputTokensCeiling returns the largest output token budget for the provider
+func (c *Client) maxOutputTokensCeiling() int {
+	switch c.provider {
+	case ProviderLocal:
+		return LocalMaxOutputTokens
+	case ProviderAzureAnthropic, ProviderAnthropic:
+		return AnthropicMaxOutputTokens
+	default:
+		return GeminiMaxOutputTokens
+	}
+}
+
 // processBatchGemini processes a batch using Gemini API
-func (c *Client) processBatchGemini(ctx context.Context, images []*ImageInfo, req *TranscribeRequest, model string) ([]*PageContent, int, error) {
+func (c *Client) processBatchGemini(ctx context.Context, images []*ImageInfo, req *TranscribeRequest, model string, maxTokens int) ([]*PageContent, int, error) {
 	// Build the prompt
 	prompt := c.buildExtractionPrompt(images, req)
 
@@ -958,17 +1620,25 @@ func (c *Client) processBatchGemini(ctx context.Context, images []*ImageInfo, re
 			},
 		},
 		GenerationConfig: &GenerationConfig{
-			MaxOutputTokens:  intPtr(8192),
 			ResponseMimeType: "application/json",
 		},
 	}
 
+	// The thinking variant is Gemini 3 Pro with a thinking budget, which
+	// also needs room in the output budget
+	thinking, maxTokens := thinkingSettings(model, req.ThinkingBudget, maxTokens)
+	apiReq.GenerationConfig.MaxOutputTokens = intPtr(maxTokens)
+	apiReq.GenerationConfig.ThinkingConfig = thinking
+
 	if req.Temperature != nil {
 		apiReq.GenerationConfig.Temperature = req.Temperature
 	}
+	if req.TopP != nil {
+		apiReq.GenerationConfig.TopP = req.TopP
+	}
 
 	// Make API call
-	resp, err := c.generateContent(ctx, model, apiReq)
+	resp, err := c.generateContent(ctx, geminiAPIModel(model), apiReq)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -984,11 +1654,16 @@ func (c *Client) processBatchGemini(ctx context.Context, images []*ImageInfo, re
 		tokens = resp.UsageMetadata.TotalTokenCount
 	}
 
+	if len(resp.Candidates) > 0 && resp.Candidates[0].FinishReason == "MAX_TOKENS" {
+		return nil, 0, &TruncatedOutputError{MaxTokens: maxTokens, Pages: pageContents, Tokens: tokens}
+	}
+
 	return pageContents, tokens, nil
 }
 
-// processBatchAzureAnthropic processes a batch using Azure Anthropic (Claude) API
-func (c *Client) processBatchAzureAnthropic(ctx context.Context, images []*ImageInfo, req *TranscribeRequest) ([]*PageContent, int, error) {
+// processBatchAzureAnthropic processes a batch using the Anthropic (Claude)
+// API, directly or through Azure
+func (c *Client) processBatchAzureAnthropic(ctx context.Context, images []*ImageInfo, req *TranscribeRequest, maxTokens int) ([]*PageContent, int, error) {
 	if c.anthropicClient == nil {
 		return nil, 0, fmt.Errorf("Anthropic client not initialized")
 	}
@@ -1017,22 +1692,35 @@ func (c *Client) processBatchAzureAnthropic(ctx context.Context, images []*Image
 	contentBlocks = append(contentBlocks, anthropic.NewTextBlock(prompt))
 
 	if c.debug {
-		fmt.Printf("[DEBUG] Azure Anthropic request to model: %s with %d images\n", c.model, len(images))
+		fmt.Printf("[DEBUG] %s request to model: %s with %d images\n", c.claudeBackendName(), c.model, len(images))
 	}
 
 	// Create the message request
-	message, err := c.anthropicClient.Messages.New(ctx, anthropic.MessageNewParams{
+	params := anthropic.MessageNewParams{
 		Model:     anthropic.Model(c.model),
-		MaxTokens: 8192,
+		MaxTokens: int64(maxTokens),
 		Messages: []anthropic.MessageParam{
 			{
 				Role:    anthropic.MessageParamRoleUser,
 				Content: contentBlocks,
 			},
 		},
-	})
+	}
+	if req.Temperature != nil {
+		params.Temperature = anthropic.Float(*req.Temperature)
+	}
+	if req.TopP != nil {
+		params.TopP = anthropic.Float(*req.TopP)
+	}
+
+	var reqOpts []option.RequestOption
+	if c.requestTimeout > 0 {
+		reqOpts = append(reqOpts, option.WithRequestTimeout(c.requestTimeout))
+	}
+
+	message, err := c.anthropicClient.Messages.New(ctx, params, reqOpts...)
 	if err != nil {
-		return nil, 0, fmt.Errorf("Azure Anthropic request failed: %w", err)
+		return nil, 0, fmt.Errorf("%s request failed: %w", c.claudeBackendName(), err)
 	}
 
 	// Extract text content from response
@@ -1046,14 +1734,14 @@ func (c *Client) processBatchAzureAnthropic(ctx context.Context, images []*Image
 	}
 
 	if textContent == "" {
-		return nil, 0, fmt.Errorf("no content in Azure Anthropic response")
+		return nil, 0, fmt.Errorf("no content in %s response", c.claudeBackendName())
 	}
 
 	if c.debug {
 		if len(textContent) < 500 {
-			fmt.Printf("[DEBUG] Azure Anthropic response: %s\n", textContent)
+			fmt.Printf("[DEBUG] %s response: %s\n", c.claudeBackendName(), textContent)
 		} else {
-			fmt.Printf("[DEBUG] Azure Anthropic response (truncated): %s...\n", textContent[:500])
+			fmt.Printf("[DEBUG] %s response (truncated): %s...\n", c.claudeBackendName(), textContent[:500])
 		}
 	}
 
@@ -1068,10 +1756,22 @@ func (c *Client) processBatchAzureAnthropic(ctx context.Context, images []*Image
 		tokens = int(message.Usage.InputTokens + message.Usage.OutputTokens)
 	}
 
+	if message.StopReason == anthropic.StopReasonMaxTokens {
+		return nil, 0, &TruncatedOutputError{MaxTokens: maxTokens, Pages: pageContents, Tokens: tokens}
+	}
+
 	return pageContents, tokens, nil
 }
 
-// parseAzureAnthropicResponse parses the Azure Anthropic response into page contents
+// claudeBackendName names the Claude backend in messages
+func (c *Client) claudeBackendName() string {
+	if c.provider == ProviderAnthropic {
+		return "Anthropic"
+	}
+	return "Azure Anthropic"
+}
+
+// parseAzureAnthropicResponse parses a Claude response into page contents
 func (c *Client) parseAzureAnthropicResponse(text string, images []*ImageInfo) ([]*PageContent, error) {
 	// Try to parse as JSON (same format as Gemini)
 	var result struct {
@@ -1079,16 +1779,7 @@ func (c *Client) parseAzureAnthropicResponse(text string, images []*ImageInfo) (
 	}
 
 	// Clean up the text (remove markdown code blocks if present)
-	text = strings.TrimSpace(text)
-	if strings.HasPrefix(text, "```json") {
-		text = strings.TrimPrefix(text, "```json")
-		text = strings.TrimSuffix(text, "```")
-		text = strings.TrimSpace(text)
-	} else if strings.HasPrefix(text, "```") {
-		text = strings.TrimPrefix(text, "```")
-		text = strings.TrimSuffix(text, "```")
-		text = strings.TrimSpace(text)
-	}
+	text = llm.CleanJSON(text)
 
 	if err := json.Unmarshal([]byte(text), &result); err != nil {
 		// If JSON parsing fails, treat the whole response as a single page
@@ -1114,7 +1805,7 @@ func (c *Client) parseAzureAnthropicResponse(text string, images []*ImageInfo) (
 }
 
 // processBatchLocal processes a batch using local LLM (LM Studio, Ollama, etc.)
-func (c *Client) processBatchLocal(ctx context.Context, images []*ImageInfo, req *TranscribeRequest) ([]*PageContent, int, error) {
+func (c *Client) processBatchLocal(ctx context.Context, images []*ImageInfo, req *TranscribeRequest, maxTokens int, tctx *transcribeContext, batchNum int) ([]*PageContent, int, error) {
 	// Build a simplified prompt for local LLM (shorter to save context)
 	prompt := c.buildLocalLLMPrompt(images, req)
 
@@ -1122,16 +1813,15 @@ func (c *Client) processBatchLocal(ctx context.Context, images []*ImageInfo, req
 	content := make([]LocalLLMContent, 0, len(images)+1)
 
 	// Resize options for local LLM - smaller images to fit context
-	resizeOpts := ResizeOptions{
-		MaxWidth:  768, // Smaller for local LLM context limits
-		MaxHeight: 768,
-		Quality:   80,
+	resizeOpts := DefaultLocalResizeOptions()
+	if req.LocalResize != nil {
+		resizeOpts = *req.LocalResize
 	}
 
 	// Add images first (as base64 data URLs)
 	for _, img := range images {
 		// Resize image to reduce token usage
-		data, mimeType, err := ResizeImageIfNeeded(img.Path, 500*1024, resizeOpts) // 500KB threshold
+		data, mimeType, err := resizeOpts.load(img.Path)
 		if err != nil {
 			return nil, 0, fmt.Errorf("failed to process %s: %w", img.Filename, err)
 		}
@@ -1169,12 +1859,13 @@ func (c *Client) processBatchLocal(ctx context.Context, images []*ImageInfo, req
 				Content: content,
 			},
 		},
-		MaxTokens:   8192,
-		Temperature: 0.1,
+		MaxTokens:   maxTokens,
+		Temperature: floatPtr(DefaultExtractionTemperature),
+		TopP:        req.TopP,
 	}
 
 	if req.Temperature != nil {
-		apiReq.Temperature = *req.Temperature
+		apiReq.Temperature = req.Temperature
 	}
 
 	// Make API call
@@ -1194,14 +1885,38 @@ func (c *Client) processBatchLocal(ctx context.Context, images []*ImageInfo, req
 		tokens = resp.Usage.TotalTokens
 	}
 
+	if resp.Choices[0].FinishReason == "length" {
+		return nil, 0, &TruncatedOutputError{MaxTokens: maxTokens, Pages: pageContents, Tokens: tokens}
+	}
+
 	// Stage 2: If text model is configured, refine the extracted text
 	if c.textModel != "" {
 		if c.debug {
 			fmt.Printf("[DEBUG] Two-stage pipeline: refining with text model %s\n", c.textModel)
 		}
+		c.sendProgress(tctx, ProgressUpdate{
+			Status:       StatusRefining,
+			Message:      "Refining with text model",
+			Detail:       fmt.Sprintf("Batch %d: %d pages", batchNum, len(pageContents)),
+			CurrentBatch: batchNum,
+			Stage:        2,
+			TotalStages:  2,
+			Model:        c.textModel,
+		})
 		refinedContents, refinedTokens, err := c.refineWithTextModel(ctx, pageContents, req)
 		if err != nil {
-			// Log warning but don't fail - return vision model output
+			// Don't fail the batch, but say so: the pages are unrefined
+			if tctx != nil {
+				tctx.refineFailures.Add(1)
+			}
+			c.sendProgress(tctx, ProgressUpdate{
+				Status:       StatusWarning,
+				Message:      "Text refinement failed, using vision output",
+				Detail:       fmt.Sprintf("Batch %d: %v", batchNum, err),
+				CurrentBatch: batchNum,
+				Model:        c.textModel,
+				Error:        err,
+			})
 			if c.debug {
 				fmt.Printf("[DEBUG] Text model refinement failed: %v (using vision model output)\n", err)
 			}
@@ -1214,6 +1929,21 @@ func (c *Client) processBatchLocal(ctx context.Context, images []*ImageInfo, req
 	return pageContents, tokens, nil
 }
 
+// RefinementSummary describes how many batches kept their vision output
+// because text refinement failed, e.g. "2 of 5 batches", or "" when there
+// were no failures
+func (r *TranscribeResponse) RefinementSummary() string {
+	if r.RefinementFailures == 0 {
+		return ""
+	}
+	total := max(len(r.BatchProviders), r.RefinementFailures)
+	unit := "batches"
+	if total == 1 {
+		unit = "batch"
+	}
+	return fmt.Sprintf("%d of %d %s", r.RefinementFailures, total, unit)
+}
+
 // refineWithTextModel sends extracted text to the text/agentic model for refinement
 func (c *Client) refineWithTextModel(ctx context.Context, pages []*PageContent, req *TranscribeRequest) ([]*PageContent, int, error) {
 	// Build the refinement prompt
@@ -1240,12 +1970,13 @@ func (c *Client) refineWithTextModel(ctx context.Context, pages []*PageContent,
 				Content: content,
 			},
 		},
-		MaxTokens:   16384, // More tokens for refined output
-		Temperature: 0.2,   // Slightly more creative for better prose
+		MaxTokens:   16384,         // More tokens for refined output
+		Temperature: floatPtr(0.2), // Slightly more creative for better prose
+		TopP:        req.TopP,
 	}
 
 	if req.Temperature != nil {
-		apiReq.Temperature = *req.Temperature
+		apiReq.Temperature = req.Temperature
 	}
 
 	// Make API call to text model endpoint
@@ -1280,7 +2011,14 @@ func (c *Client) buildTextRefinementPrompt(pages []*PageContent, req *Transcribe
 3. **Maintain accuracy**: Do NOT add, remove, or change the meaning of any content
 4. **Preserve structure**: Keep chapter/section organization intact
 5. **Clean up artifacts**: Remove scanning artifacts, page numbers if redundant, etc.
+`)
 
+	if req.StyleGuide != "" {
+		sb.WriteString("6. **Follow the house style guide**, as long as it does not change the meaning:\n")
+		sb.WriteString(styleGuideRules(req.StyleGuide, "   "))
+	}
+
+	sb.WriteString(`
 ## Output Format:
 Return JSON with the refined pages:
 {
@@ -1328,19 +2066,8 @@ func (c *Client) parseRefinementResponse(resp *LocalLLMResponse, originalPages [
 		return nil, fmt.Errorf("no choices in refinement response")
 	}
 
-	text := resp.Choices[0].Message.Content
-	text = strings.TrimSpace(text)
-
 	// Clean up markdown code blocks
-	if strings.HasPrefix(text, "```json") {
-		text = strings.TrimPrefix(text, "```json")
-		text = strings.TrimSuffix(text, "```")
-		text = strings.TrimSpace(text)
-	} else if strings.HasPrefix(text, "```") {
-		text = strings.TrimPrefix(text, "```")
-		text = strings.TrimSuffix(text, "```")
-		text = strings.TrimSpace(text)
-	}
+	text := llm.CleanJSON(resp.Choices[0].Message.Content)
 
 	var result struct {
 		Pages []*PageContent `json:"pages"`
@@ -1376,7 +2103,7 @@ func (c *Client) parseRefinementResponse(resp *LocalLLMResponse, originalPages [
 // generateContentLocalWithEndpoint makes an API call to a specific endpoint
 func (c *Client) generateContentLocalWithEndpoint(ctx context.Context, endpoint string, req *LocalLLMRequest) (*LocalLLMResponse, error) {
 	// Build URL
-	apiURL := fmt.Sprintf("%s/v1/chat/completions", endpoint)
+	apiURL := llm.ChatCompletionsURL(endpoint)
 
 	// Serialize request
 	body, err := json.Marshal(req)
@@ -1389,25 +2116,12 @@ func (c *Client) generateContentLocalWithEndpoint(ctx context.Context, endpoint
 		fmt.Printf("[DEBUG] Model: %s\n", req.Model)
 	}
 
-	// Create HTTP request
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewReader(body))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	// Execute request
-	resp, err := c.httpClient.Do(httpReq)
-	if err != nil {
+	resp, respBody, err := llm.PostChat(ctx, c.httpClient, endpoint, "", body)
+	if resp == nil {
 		return nil, fmt.Errorf("text model request failed: %w", err)
 	}
-	defer resp.Body.Close()
-
-	// Read response body
-	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, err
 	}
 
 	if c.debug {
@@ -1429,7 +2143,7 @@ func (c *Client) generateContentLocalWithEndpoint(ctx context.Context, endpoint
 // generateContentLocal makes an API call to local LLM
 func (c *Client) generateContentLocal(ctx context.Context, req *LocalLLMRequest) (*LocalLLMResponse, error) {
 	// Build URL
-	apiURL := fmt.Sprintf("%s/v1/chat/completions", c.baseURL)
+	apiURL := llm.ChatCompletionsURL(c.baseURL)
 
 	// Serialize request
 	body, err := json.Marshal(req)
@@ -1442,25 +2156,12 @@ func (c *Client) generateContentLocal(ctx context.Context, req *LocalLLMRequest)
 		fmt.Printf("[DEBUG] Model: %s, Messages: %d\n", req.Model, len(req.Messages))
 	}
 
-	// Create HTTP request
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewReader(body))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	// Execute request
-	resp, err := c.httpClient.Do(httpReq)
-	if err != nil {
+	resp, respBody, err := llm.PostChat(ctx, c.httpClient, c.baseURL, "", body)
+	if resp == nil {
 		return nil, fmt.Errorf("request failed (is the LLM server running?): %w", err)
 	}
-	defer resp.Body.Close()
-
-	// Read response body
-	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, err
 	}
 
 	if c.debug {
@@ -1483,7 +2184,12 @@ func (c *Client) generateContentLocal(ctx context.Context, req *LocalLLMRequest)
 				"  3. The image may be too detailed - try smaller/simpler images\n"+
 				"Original error: %s", errStr)
 		}
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, errStr)
+		return nil, &APIError{
+			StatusCode: resp.StatusCode,
+			Message:    fmt.Sprintf("API error (status %d)", resp.StatusCode),
+			Details:    errStr,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
 	}
 
 	// Parse response
@@ -1523,16 +2229,7 @@ func (c *Client) parseLocalResponse(resp *LocalLLMResponse, images []*ImageInfo)
 	}
 
 	// Clean up the text (remove markdown code blocks if present)
-	text = strings.TrimSpace(text)
-	if strings.HasPrefix(text, "```json") {
-		text = strings.TrimPrefix(text, "```json")
-		text = strings.TrimSuffix(text, "```")
-		text = strings.TrimSpace(text)
-	} else if strings.HasPrefix(text, "```") {
-		text = strings.TrimPrefix(text, "```")
-		text = strings.TrimSuffix(text, "```")
-		text = strings.TrimSpace(text)
-	}
+	text = llm.CleanJSON(text)
 
 	if err := json.Unmarshal([]byte(text), &result); err != nil {
 		// If JSON parsing fails, treat the whole response as a single page
@@ -1616,6 +2313,16 @@ Guidelines:
 		sb.WriteString("   - Mathematical notation (use LaTeX format: $equation$)\n\n")
 	}
 
+	if c.styleGuideForVision(req) {
+		item := 5
+		if req.PreserveFormatting {
+			item = 6
+		}
+		sb.WriteString(fmt.Sprintf("%d. Follow this house style guide:\n", item))
+		sb.WriteString(styleGuideRules(req.StyleGuide, "   "))
+		sb.WriteString("\n")
+	}
+
 	sb.WriteString(fmt.Sprintf("Process the following %d images as consecutive pages (starting from page %d):\n",
 		len(images), images[0].PageIndex+1))
 
@@ -1639,6 +2346,11 @@ Rules:
 		sb.WriteString(fmt.Sprintf("- Document language: %s\n", req.Language))
 	}
 
+	if c.styleGuideForVision(req) {
+		sb.WriteString("- House style:\n")
+		sb.WriteString(styleGuideRules(req.StyleGuide, "  "))
+	}
+
 	sb.WriteString(fmt.Sprintf("\nPage %d:\n", images[0].PageIndex+1))
 
 	return sb.String()
@@ -1700,13 +2412,20 @@ func (c *Client) generateContent(ctx context.Context, model string, req *Generat
 				Status  string `json:"status"`
 			} `json:"error"`
 		}
+		retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
 		if err := json.Unmarshal(respBody, &apiErr); err != nil {
-			return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
+			return nil, &APIError{
+				StatusCode: resp.StatusCode,
+				Message:    fmt.Sprintf("API error (status %d)", resp.StatusCode),
+				Details:    string(respBody),
+				RetryAfter: retryAfter,
+			}
 		}
 		return nil, &APIError{
 			StatusCode: resp.StatusCode,
 			Message:    apiErr.Error.Message,
 			Details:    apiErr.Error.Status,
+			RetryAfter: retryAfter,
 		}
 	}
 
@@ -1719,6 +2438,18 @@ func (c *Client) generateContent(ctx context.Context, model string, req *Generat
 	return &result, nil
 }
 
+// answerText joins the text of a response's parts, leaving out the thought
+// summaries a thinking model may return ahead of its answer
+func answerText(content *Content) string {
+	var b strings.Builder
+	for _, part := range content.Parts {
+		if !part.Thought {
+			b.WriteString(part.Text)
+		}
+	}
+	return b.String()
+}
+
 // parseExtractionResponse parses the API response into page contents
 func (c *Client) parseExtractionResponse(resp *GenerateContentResponse, images []*ImageInfo) ([]*PageContent, error) {
 	if len(resp.Candidates) == 0 {
@@ -1730,8 +2461,8 @@ func (c *Client) parseExtractionResponse(resp *GenerateContentResponse, images [
 		return nil, fmt.Errorf("no content in response")
 	}
 
-	// Get the text content
-	text := candidate.Content.Parts[0].Text
+	// Get the text content, skipping any thought summaries
+	text := answerText(candidate.Content)
 
 	// Try to parse as JSON
 	var result struct {
@@ -1739,16 +2470,7 @@ func (c *Client) parseExtractionResponse(resp *GenerateContentResponse, images [
 	}
 
 	// Clean up the text (remove markdown code blocks if present)
-	text = strings.TrimSpace(text)
-	if strings.HasPrefix(text, "```json") {
-		text = strings.TrimPrefix(text, "```json")
-		text = strings.TrimSuffix(text, "```")
-		text = strings.TrimSpace(text)
-	} else if strings.HasPrefix(text, "```") {
-		text = strings.TrimPrefix(text, "```")
-		text = strings.TrimSuffix(text, "```")
-		text = strings.TrimSpace(text)
-	}
+	text = llm.CleanJSON(text)
 
 	if err := json.Unmarshal([]byte(text), &result); err != nil {
 		// If JSON parsing fails, treat the whole response as a single page
@@ -1780,7 +2502,7 @@ func (c *Client) organizeByChapters(pages []*PageContent, req *TranscribeRequest
 	}
 
 	// Find chapter boundaries
-	chapters := c.detectChapters(pages)
+	chapters := c.detectChapters(pages, req.ChapterSensitivity)
 
 	if len(chapters) == 0 {
 		// No chapters detected, create single document
@@ -1812,15 +2534,27 @@ func (c *Client) organizeByChapters(pages []*PageContent, req *TranscribeRequest
 }
 
 // detectChapters finds chapter boundaries in the pages
-func (c *Client) detectChapters(pages []*PageContent) []*ChapterInfo {
+func (c *Client) detectChapters(pages []*PageContent, sensitivity ChapterSensitivity) []*ChapterInfo {
 	var chapters []*ChapterInfo
 
+	// Local vision models set the chapter flags unreliably, so text
+	// heuristics can add boundaries the model missed
+	heuristic := heuristicChapterStarts(pages, sensitivity)
+
 	for i, page := range pages {
-		if page.IsChapterStart || (page.HasHeading && page.HeadingLevel <= 2) {
+		modelStart := page.IsChapterStart || (page.HasHeading && page.HeadingLevel <= 2)
+		if modelStart || heuristic[i] != nil {
 			title := page.ChapterTitle
 			if title == "" {
 				title = page.HeadingText
 			}
+			level := page.HeadingLevel
+			if !modelStart {
+				level = heuristic[i].level
+			}
+			if title == "" && heuristic[i] != nil {
+				title = heuristic[i].title
+			}
 			if title == "" {
 				title = fmt.Sprintf("Section %d", len(chapters)+1)
 			}
@@ -1834,7 +2568,7 @@ func (c *Client) detectChapters(pages []*PageContent) []*ChapterInfo {
 				Title:     title,
 				StartPage: page.PageNumber,
 				EndPage:   pages[len(pages)-1].PageNumber, // Will be updated
-				Level:     page.HeadingLevel,
+				Level:     level,
 			})
 		}
 
@@ -1865,7 +2599,7 @@ func (c *Client) createDocumentFromPages(pages []*PageContent, title string, ind
 	for i, page := range pages {
 		// Add page separator if not first page
 		if i > 0 {
-			content.WriteString("\n\n---\n\n")
+			content.WriteString(pageSeparator)
 		}
 
 		// Track sections
@@ -1877,20 +2611,7 @@ func (c *Client) createDocumentFromPages(pages []*PageContent, title string, ind
 			})
 		}
 
-		// Add page content
-		content.WriteString(page.Text)
-
-		// Add image descriptions if enabled
-		if req.IncludeImageDescriptions && len(page.Images) > 0 {
-			content.WriteString("\n\n")
-			for _, img := range page.Images {
-				content.WriteString(fmt.Sprintf("*[%s: %s", img.Type, img.Description))
-				if img.Caption != "" {
-					content.WriteString(fmt.Sprintf(" - %s", img.Caption))
-				}
-				content.WriteString("]*\n\n")
-			}
-		}
+		writePageContent(&content, page, req)
 	}
 
 	// Generate filename
@@ -1909,6 +2630,28 @@ func (c *Client) createDocumentFromPages(pages []*PageContent, title string, ind
 			End:   pages[len(pages)-1].PageNumber,
 		},
 		Sections: sections,
+		Pages:    pages,
+	}
+}
+
+// pageSeparator goes between pages of a multi-page document
+const pageSeparator = "\n\n---\n\n"
+
+// writePageContent appends a page's text and, if enabled, its image
+// descriptions to a multi-page document
+func writePageContent(content *strings.Builder, page *PageContent, req *TranscribeRequest) {
+	content.WriteString(page.Text)
+
+	// Add image descriptions if enabled
+	if req.IncludeImageDescriptions && len(page.Images) > 0 {
+		content.WriteString("\n\n")
+		for _, img := range page.Images {
+			content.WriteString(fmt.Sprintf("*[%s: %s", img.Type, img.Description))
+			if img.Caption != "" {
+				content.WriteString(fmt.Sprintf(" - %s", img.Caption))
+			}
+			content.WriteString("]*\n\n")
+		}
 	}
 }
 
@@ -1925,6 +2668,7 @@ func (c *Client) createPerPageDocuments(pages []*PageContent, req *TranscribeReq
 				Start: page.PageNumber,
 				End:   page.PageNumber,
 			},
+			Pages: []*PageContent{page},
 		}
 
 		if page.HasHeading {
@@ -1959,10 +2703,19 @@ func (c *Client) createPerPageDocuments(pages []*PageContent, req *TranscribeReq
 	return documents
 }
 
-// TranscribeWithRetry transcribes with automatic retry on transient failures
+// TranscribeWithRetry transcribes with automatic retry on transient failures.
+// Rate-limited responses that carry a Retry-After header are retried after
+// the requested delay instead of the fixed backoff schedule.
+//
+// Each batch is already retried on its own (see
+// TranscribeRequest.MaxBatchRetries), which keeps the batches that
+// succeeded; this resends the whole job, so it only helps when a batch
+// still fails after those retries. The two multiply: every job attempt
+// retries its batches again, so a batch can be sent up to
+// (MaxBatchRetries+1)*(maxRetries+1) times. Pass maxRetries 0, or set
+// MaxBatchRetries to NoBatchRetries, to keep only one level.
 func (c *Client) TranscribeWithRetry(ctx context.Context, req *TranscribeRequest, maxRetries int) (*TranscribeResponse, error) {
 	var lastErr error
-	backoff := []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second}
 
 	for attempt := 0; attempt <= maxRetries; attempt++ {
 		result, err := c.TranscribeImages(ctx, req)
@@ -1972,12 +2725,10 @@ func (c *Client) TranscribeWithRetry(ctx context.Context, req *TranscribeRequest
 
 		lastErr = err
 
-		// Check if error is retryable
-		if apiErr, ok := err.(*APIError); ok {
-			// Don't retry client errors (4xx) except rate limits
-			if apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 && apiErr.StatusCode != 429 {
-				return nil, err
-			}
+		// Don't retry client errors (4xx) except rate limits, nor errors
+		// that aren't the API's or the network's
+		if !isRetryable(err) {
+			return nil, err
 		}
 
 		// Check context cancellation
@@ -1989,10 +2740,7 @@ func (c *Client) TranscribeWithRetry(ctx context.Context, req *TranscribeRequest
 
 		// Wait before retry
 		if attempt < maxRetries {
-			wait := backoff[attempt]
-			if attempt >= len(backoff) {
-				wait = backoff[len(backoff)-1]
-			}
+			wait := retryWait(attempt, err)
 
 			if c.debug {
 				fmt.Printf("[DEBUG] Retry %d/%d after %v: %v\n", attempt+1, maxRetries, wait, err)
@@ -2009,7 +2757,36 @@ func (c *Client) TranscribeWithRetry(ctx context.Context, req *TranscribeRequest
 	return nil, fmt.Errorf("transcription failed after %d retries: %w", maxRetries, lastErr)
 }
 
-// sanitizeFilename creates a safe filename from a title
+// maxRetryAfter caps how long a retry honors a Retry-After
+// header, so a misbehaving server can't stall a run indefinitely
+const maxRetryAfter = 5 * time.Minute
+
+// parseRetryAfter parses a Retry-After header value, which is either a
+// number of seconds or an HTTP date. It returns zero when the header is
+// missing, malformed or already in the past.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		if secs <= 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// sanitizeFilename creates a safe filename from a title. Besides path
+// separators and characters Windows rejects, it removes control characters,
+// leading and trailing dots (no hidden files, no "..") and renames Windows
+// reserved device names such as CON or LPT1.
 func sanitizeFilename(title string) string {
 	// Replace unsafe characters
 	replacer := strings.NewReplacer(
@@ -2024,19 +2801,24 @@ func sanitizeFilename(title string) string {
 		"|", "_",
 		" ", "_",
 	)
-	result := replacer.Replace(title)
+	result := strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return '_'
+		}
+		return r
+	}, replacer.Replace(title))
 
 	// Remove consecutive underscores
 	for strings.Contains(result, "__") {
 		result = strings.ReplaceAll(result, "__", "_")
 	}
 
-	// Trim underscores from ends
-	result = strings.Trim(result, "_")
+	// Trim underscores and dots from ends
+	result = strings.Trim(result, "_.")
 
-	// Limit length
+	// Limit length without splitting a multi-byte character
 	if len(result) > 50 {
-		result = result[:50]
+		result = strings.Trim(truncateUTF8(result, 50), "_.")
 	}
 
 	// Default name if empty
@@ -2044,7 +2826,39 @@ func sanitizeFilename(title string) string {
 		result = "document"
 	}
 
-	return strings.ToLower(result)
+	result = strings.ToLower(result)
+	if isWindowsReservedName(result) {
+		result = "_" + result
+	}
+	return result
+}
+
+// truncateUTF8 shortens s to at most n bytes on a rune boundary
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// windowsReservedNames are device names Windows refuses as file names,
+// with or without an extension
+var windowsReservedNames = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true,
+	"com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true,
+	"lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// isWindowsReservedName reports whether a file name is a reserved device
+// name such as "con" or "nul.md"
+func isWindowsReservedName(name string) bool {
+	stem, _, _ := strings.Cut(name, ".")
+	return windowsReservedNames[strings.ToLower(strings.TrimRight(stem, " "))]
 }
 
 // Helper function to create int pointer
@@ -2052,6 +2866,11 @@ func intPtr(i int) *int {
 	return &i
 }
 
+// Helper function to create float64 pointer
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
 // GetAPIKeyHelp returns help text for setting up the API key
 func GetAPIKeyHelp() string {
 	return `To use image transcription, you need a backend configured.
@@ -2078,7 +2897,13 @@ Option 2: Azure Anthropic (Claude)
          export AZURE_ANTHROPIC_API_KEY="your-api-key"
          export AZURE_ANTHROPIC_MODEL="claude-sonnet-4-20250514"  # Optional
 
-Option 3: Google Gemini API
+Option 3: Anthropic (Claude)
+
+  1. Create an API key at https://console.anthropic.com/settings/keys
+  2. Set: export ANTHROPIC_API_KEY="sk-ant-..."
+         export ANTHROPIC_MODEL="claude-sonnet-4-20250514"  # Optional
+
+Option 4: Google Gemini API
 
   1. Go to https://aistudio.google.com/apikey
   2. Sign in with your Google account
@@ -2091,41 +2916,34 @@ Or create a .env file with these values.`
 
 // CheckConfig verifies that a transcription backend is configured
 func CheckConfig() error {
-	// Check for local LLM first
-	if os.Getenv("LLM_ENDPOINT") != "" || os.Getenv("IMAGE_LLM_ENDPOINT") != "" {
-		return nil // Local LLM configured, no API key needed
-	}
-
-	// Check Azure Anthropic config
-	if os.Getenv("AZURE_ANTHROPIC_ENDPOINT") != "" {
-		if os.Getenv("AZURE_ANTHROPIC_API_KEY") == "" {
-			return fmt.Errorf("AZURE_ANTHROPIC_API_KEY not set")
-		}
-		return nil // Azure Anthropic configured
+	provider, err := llm.RoleTranscription.Select()
+	if err != nil {
+		return err
 	}
-
-	// Check Gemini config
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	if apiKey == "" {
-		apiKey = os.Getenv("GOOGLE_API_KEY")
+	if provider == "" {
+		return fmt.Errorf("no backend configured. Set LLM_ENDPOINT for local LLM, AZURE_ANTHROPIC_ENDPOINT for Azure Anthropic, GEMINI_API_KEY for Gemini, or ANTHROPIC_API_KEY for Anthropic")
 	}
-	if apiKey == "" {
-		return fmt.Errorf("no backend configured. Set LLM_ENDPOINT for local LLM, AZURE_ANTHROPIC_ENDPOINT for Azure Anthropic, or GEMINI_API_KEY for Gemini")
+	if missing := llm.RoleTranscription.Missing(provider); missing != "" {
+		return fmt.Errorf("%s not set", missing)
 	}
 	return nil
 }
 
-// GetProvider returns the current provider type based on environment
+// GetProvider returns the current provider type based on environment,
+// Gemini when none is configured
 func GetProvider() Provider {
-	if os.Getenv("LLM_ENDPOINT") != "" || os.Getenv("IMAGE_LLM_ENDPOINT") != "" {
-		return ProviderLocal
-	}
-	if os.Getenv("AZURE_ANTHROPIC_ENDPOINT") != "" {
-		return ProviderAzureAnthropic
+	if provider, err := llm.RoleTranscription.Select(); err == nil && provider != "" {
+		return provider
 	}
 	return ProviderGemini
 }
 
+// GetAvailableProviders returns the configured transcription providers, in
+// the order NewClientFromEnv tries them
+func GetAvailableProviders() []Provider {
+	return llm.RoleTranscription.Available()
+}
+
 // GetTextModel returns the configured text model for two-stage pipeline (empty if not configured)
 func GetTextModel() string {
 	return os.Getenv("IMAGE_TEXT_MODEL")
@@ -0,0 +1,85 @@
+package gemini
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// dedupeImages drops images whose bytes match an earlier image, such as a
+// page scanned twice or a blank separator page, so each is transcribed
+// once. It returns the images to send, in order, and maps the PageIndex of
+// every dropped image to the PageIndex of the first image with the same
+// bytes. Only exact copies match: a re-scan of the same page differs in
+// every pixel, and pages that merely look alike can differ in the text
+// that matters, like a page number.
+func dedupeImages(images []*ImageInfo) ([]*ImageInfo, map[int]int, error) {
+	first := make(map[[sha256.Size]byte]int)
+	duplicates := make(map[int]int)
+	unique := make([]*ImageInfo, 0, len(images))
+
+	for _, img := range images {
+		sum, err := hashFile(img.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("image %d (%s): %w", img.PageIndex+1, img.Path, err)
+		}
+		if original, ok := first[sum]; ok {
+			duplicates[img.PageIndex] = original
+			continue
+		}
+		first[sum] = img.PageIndex
+		unique = append(unique, img)
+	}
+	return unique, duplicates, nil
+}
+
+// hashFile returns the SHA-256 of a file's contents
+func hashFile(path string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	f, err := os.Open(path)
+	if err != nil {
+		return sum, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return sum, err
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// fanOutDuplicates adds a copy of each transcribed page for every duplicate
+// of it (see dedupeImages), numbered as the duplicate's own position, and
+// returns the pages sorted by page number. Duplicates of pages that were
+// not transcribed, e.g. in a cancelled batch, are left out. A chapter start
+// is not copied, so a repeated page doesn't open the chapter again.
+func fanOutDuplicates(pages []*PageContent, duplicates map[int]int) []*PageContent {
+	if len(duplicates) == 0 {
+		return pages
+	}
+
+	byIndex := make(map[int]*PageContent, len(pages))
+	for _, page := range pages {
+		byIndex[page.PageNumber-1] = page
+	}
+
+	out := append([]*PageContent(nil), pages...)
+	for dup, original := range duplicates {
+		page, ok := byIndex[original]
+		if !ok {
+			continue
+		}
+		clone := *page
+		clone.PageNumber = dup + 1
+		clone.IsChapterStart, clone.ChapterTitle = false, ""
+		clone.Images = append([]ImageDescription(nil), page.Images...)
+		out = append(out, &clone)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].PageNumber < out[j].PageNumber })
+	return out
+}
@@ -0,0 +1,541 @@
+package gemini
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// buildDOCX converts a document's markdown into a minimal Office Open XML
+// package. Headings map to Word's Heading 1-6 styles, lists use Word
+// numbering, pipe tables become bordered tables and bold/italic/code spans
+// become formatted runs. Link targets are dropped and only their text is
+// kept. Title, author, language, keywords and the page range are written as
+// document properties instead of front matter.
+func buildDOCX(doc *MarkdownDocument, opts WriteOptions, now time.Time) ([]byte, error) {
+	var body strings.Builder
+	w := &docxWriter{body: &body}
+
+	if opts.AddTableOfContents && len(doc.Sections) > 1 {
+		w.paragraph("TOCHeading", nil, parseInline("Table of Contents"))
+		for _, section := range doc.Sections {
+			w.paragraph("", &docxList{numID: bulletNumID, level: clampLevel(section.Level - 1)}, parseInline(section.Title))
+		}
+	}
+	w.markdown(doc.Content)
+
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", docxContentTypes},
+		{"_rels/.rels", docxPackageRels},
+		{"docProps/core.xml", docxCoreProperties(doc, now)},
+		{"word/_rels/document.xml.rels", docxDocumentRels},
+		{"word/styles.xml", docxStyles},
+		{"word/numbering.xml", w.numbering()},
+		{"word/document.xml", docxDocumentHeader + body.String() + docxDocumentFooter},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, part := range parts {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: part.name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s: %w", part.name, err)
+		}
+		if _, err := f.Write([]byte(part.content)); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", part.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish docx: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// bulletNumID is the numbering instance shared by all bullet lists; each
+// numbered list gets its own instance so that it restarts at 1
+const bulletNumID = 1
+
+var (
+	docxHeadingRe  = regexp.MustCompile(`^(#{1,6})\s+(.*?)(?:\s+#+)?\s*$`)
+	docxBulletRe   = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	docxNumberedRe = regexp.MustCompile(`^(\s*)\d+[.)]\s+(.*)$`)
+	docxRuleRe     = regexp.MustCompile(`^(-{3,}|\*{3,}|_{3,})$`)
+	docxTableSepRe = regexp.MustCompile(`^\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?$`)
+)
+
+// docxList places a paragraph in a list
+type docxList struct {
+	numID int
+	level int
+}
+
+// docxWriter accumulates WordprocessingML for a document body
+type docxWriter struct {
+	body *strings.Builder
+
+	numberedLists int // numbered list instances allocated so far
+	currentNumID  int // numbering instance of the numbered list in progress
+}
+
+// markdown converts markdown blocks to paragraphs and tables
+func (w *docxWriter) markdown(content string) {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+
+	var para []string
+	paraStyle := ""
+	var paraList *docxList
+
+	flush := func() {
+		if len(para) > 0 {
+			w.paragraph(paraStyle, paraList, parseInline(joinParagraphLines(para)))
+		}
+		para, paraStyle, paraList = nil, "", nil
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			flush()
+
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			flush()
+			w.currentNumID = 0
+			fence := trimmed[:3]
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				w.paragraph("Code", nil, []docxRun{{text: lines[i], code: true}})
+			}
+
+		case docxHeadingRe.MatchString(trimmed):
+			flush()
+			w.currentNumID = 0
+			m := docxHeadingRe.FindStringSubmatch(trimmed)
+			w.paragraph(fmt.Sprintf("Heading%d", len(m[1])), nil, parseInline(m[2]))
+
+		case docxRuleRe.MatchString(trimmed):
+			flush()
+			w.currentNumID = 0
+
+		case strings.HasPrefix(trimmed, "|") && i+1 < len(lines) && docxTableSepRe.MatchString(strings.TrimSpace(lines[i+1])):
+			flush()
+			w.currentNumID = 0
+			rows := [][]string{splitTableRow(trimmed)}
+			for i += 2; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), "|"); i++ {
+				rows = append(rows, splitTableRow(strings.TrimSpace(lines[i])))
+			}
+			i--
+			w.table(rows)
+
+		case docxBulletRe.MatchString(line) && !docxRuleRe.MatchString(trimmed):
+			flush()
+			m := docxBulletRe.FindStringSubmatch(line)
+			para = []string{m[2]}
+			paraList = &docxList{numID: bulletNumID, level: indentLevel(m[1])}
+
+		case docxNumberedRe.MatchString(line):
+			flush()
+			m := docxNumberedRe.FindStringSubmatch(line)
+			if w.currentNumID == 0 {
+				w.numberedLists++
+				w.currentNumID = bulletNumID + w.numberedLists
+			}
+			para = []string{m[2]}
+			paraList = &docxList{numID: w.currentNumID, level: indentLevel(m[1])}
+
+		case strings.HasPrefix(trimmed, ">"):
+			if paraStyle != "Quote" {
+				flush()
+				w.currentNumID = 0
+				paraStyle = "Quote"
+			}
+			para = append(para, strings.TrimSpace(strings.TrimPrefix(trimmed, ">")))
+
+		default:
+			// Indented lines continue a list item; anything else ends the list
+			if paraList != nil && line != strings.TrimLeft(line, " \t") {
+				para = append(para, line)
+				continue
+			}
+			if paraList != nil || paraStyle != "" {
+				flush()
+			}
+			w.currentNumID = 0
+			para = append(para, line)
+		}
+	}
+	flush()
+}
+
+// joinParagraphLines joins soft-wrapped lines with spaces and keeps hard
+// breaks (two trailing spaces or a trailing backslash) as newlines
+func joinParagraphLines(lines []string) string {
+	var sb strings.Builder
+	for i, line := range lines {
+		hard := strings.HasSuffix(line, "  ") || strings.HasSuffix(line, "\\")
+		line = strings.TrimSpace(line)
+		if hard {
+			line = strings.TrimSuffix(line, "\\")
+		}
+		sb.WriteString(line)
+		if i < len(lines)-1 {
+			if hard {
+				sb.WriteString("\n")
+			} else {
+				sb.WriteString(" ")
+			}
+		}
+	}
+	return sb.String()
+}
+
+// indentLevel converts list indentation to a Word list level
+func indentLevel(indent string) int {
+	width := 0
+	for _, r := range indent {
+		if r == '\t' {
+			width += 4
+		} else {
+			width++
+		}
+	}
+	return clampLevel(width / 2)
+}
+
+// clampLevel keeps a list level within Word's nine levels
+func clampLevel(level int) int {
+	if level < 0 {
+		return 0
+	}
+	if level > 8 {
+		return 8
+	}
+	return level
+}
+
+// splitTableRow splits "| a | b \| c |" into cells, honouring escaped pipes
+func splitTableRow(row string) []string {
+	row = strings.TrimSuffix(strings.TrimPrefix(row, "|"), "|")
+	row = strings.ReplaceAll(row, `\|`, "\x00")
+	cells := strings.Split(row, "|")
+	for i, cell := range cells {
+		cells[i] = strings.TrimSpace(strings.ReplaceAll(cell, "\x00", "|"))
+	}
+	return cells
+}
+
+// paragraph writes a <w:p> with an optional style and list placement
+func (w *docxWriter) paragraph(style string, list *docxList, runs []docxRun) {
+	w.body.WriteString("<w:p>")
+	if style != "" || list != nil {
+		w.body.WriteString("<w:pPr>")
+		if style == "" {
+			style = "ListParagraph"
+		}
+		fmt.Fprintf(w.body, `<w:pStyle w:val="%s"/>`, style)
+		if list != nil {
+			fmt.Fprintf(w.body, `<w:numPr><w:ilvl w:val="%d"/><w:numId w:val="%d"/></w:numPr>`, list.level, list.numID)
+		}
+		w.body.WriteString("</w:pPr>")
+	}
+	for _, run := range runs {
+		writeRun(w.body, run)
+	}
+	w.body.WriteString("</w:p>")
+}
+
+// table writes a bordered table; the first row is the bold header row
+func (w *docxWriter) table(rows [][]string) {
+	cols := 0
+	for _, row := range rows {
+		if len(row) > cols {
+			cols = len(row)
+		}
+	}
+
+	w.body.WriteString(`<w:tbl><w:tblPr><w:tblStyle w:val="TableGrid"/><w:tblW w:w="0" w:type="auto"/></w:tblPr><w:tblGrid>`)
+	colWidth := 9360 / cols // text width of a Letter page with 1" margins, in twips
+	for c := 0; c < cols; c++ {
+		fmt.Fprintf(w.body, `<w:gridCol w:w="%d"/>`, colWidth)
+	}
+	w.body.WriteString("</w:tblGrid>")
+
+	for r, row := range rows {
+		w.body.WriteString("<w:tr>")
+		if r == 0 {
+			w.body.WriteString("<w:trPr><w:tblHeader/></w:trPr>")
+		}
+		for c := 0; c < cols; c++ {
+			cell := ""
+			if c < len(row) {
+				cell = row[c]
+			}
+			runs := parseInline(cell)
+			if r == 0 {
+				for i := range runs {
+					runs[i].bold = true
+				}
+			}
+			fmt.Fprintf(w.body, `<w:tc><w:tcPr><w:tcW w:w="%d" w:type="dxa"/></w:tcPr>`, colWidth)
+			w.paragraph("", nil, runs)
+			w.body.WriteString("</w:tc>")
+		}
+		w.body.WriteString("</w:tr>")
+	}
+	w.body.WriteString("</w:tbl>")
+}
+
+// numbering returns word/numbering.xml with one bullet instance and one
+// restarting instance per numbered list
+func (w *docxWriter) numbering() string {
+	var sb strings.Builder
+	sb.WriteString(xml.Header)
+	sb.WriteString(`<w:numbering xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">`)
+
+	bullets := []string{"•", "◦", "▪"}
+	formats := []string{"decimal", "lowerLetter", "lowerRoman"}
+
+	sb.WriteString(`<w:abstractNum w:abstractNumId="0"><w:multiLevelType w:val="hybridMultilevel"/>`)
+	for l := 0; l < 9; l++ {
+		fmt.Fprintf(&sb, `<w:lvl w:ilvl="%d"><w:start w:val="1"/><w:numFmt w:val="bullet"/><w:lvlText w:val="%s"/><w:lvlJc w:val="left"/><w:pPr><w:ind w:left="%d" w:hanging="360"/></w:pPr></w:lvl>`,
+			l, bullets[l%len(bullets)], 720*(l+1))
+	}
+	sb.WriteString(`</w:abstractNum>`)
+
+	sb.WriteString(`<w:abstractNum w:abstractNumId="1"><w:multiLevelType w:val="hybridMultilevel"/>`)
+	for l := 0; l < 9; l++ {
+		fmt.Fprintf(&sb, `<w:lvl w:ilvl="%d"><w:start w:val="1"/><w:numFmt w:val="%s"/><w:lvlText w:val="%%%d."/><w:lvlJc w:val="left"/><w:pPr><w:ind w:left="%d" w:hanging="360"/></w:pPr></w:lvl>`,
+			l, formats[l%len(formats)], l+1, 720*(l+1))
+	}
+	sb.WriteString(`</w:abstractNum>`)
+
+	fmt.Fprintf(&sb, `<w:num w:numId="%d"><w:abstractNumId w:val="0"/></w:num>`, bulletNumID)
+	for n := 1; n <= w.numberedLists; n++ {
+		fmt.Fprintf(&sb, `<w:num w:numId="%d"><w:abstractNumId w:val="1"/><w:lvlOverride w:ilvl="0"><w:startOverride w:val="1"/></w:lvlOverride></w:num>`, bulletNumID+n)
+	}
+
+	sb.WriteString(`</w:numbering>`)
+	return sb.String()
+}
+
+// docxRun is a span of text sharing one set of character formatting. HTML
+// output renders the same runs.
+type docxRun struct {
+	text   string
+	bold   bool
+	italic bool
+	code   bool
+	link   string // target of the link the run is in; Word output drops it
+}
+
+// parseInline splits markdown inline text into formatted runs. Markers only
+// open when a matching closer follows, so stray asterisks stay literal, and
+// underscores inside words (snake_case) never toggle italics.
+func parseInline(s string) []docxRun {
+	var runs []docxRun
+	var cur strings.Builder
+	bold, italic := false, false
+
+	emit := func(code bool) {
+		if cur.Len() > 0 {
+			runs = append(runs, docxRun{text: cur.String(), bold: bold, italic: italic, code: code})
+			cur.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_{}[]()#+-.!|", s[i+1]) >= 0:
+			i++
+			cur.WriteByte(s[i])
+
+		case c == '`':
+			end := strings.IndexByte(s[i+1:], '`')
+			if end < 0 {
+				cur.WriteByte(c)
+				continue
+			}
+			emit(false)
+			cur.WriteString(s[i+1 : i+1+end])
+			emit(true)
+			i += end + 1
+
+		case c == '[':
+			mid := strings.Index(s[i:], "](")
+			if mid < 0 {
+				cur.WriteByte(c)
+				continue
+			}
+			end := strings.IndexByte(s[i+mid:], ')')
+			if end < 0 {
+				cur.WriteByte(c)
+				continue
+			}
+			// Keep the link text and its formatting, marked with the target
+			inner := parseInline(s[i+1 : i+mid])
+			target := strings.TrimSpace(s[i+mid+2 : i+mid+end])
+			emit(false)
+			for _, r := range inner {
+				r.bold = r.bold || bold
+				r.italic = r.italic || italic
+				r.link = target
+				runs = append(runs, r)
+			}
+			i += mid + end
+
+		case (c == '*' || c == '_') && i+1 < len(s) && s[i+1] == c:
+			marker := s[i : i+2]
+			if bold || strings.Contains(s[i+2:], marker) {
+				emit(false)
+				bold = !bold
+				i++
+			} else {
+				cur.WriteString(marker)
+				i++
+			}
+
+		case c == '*' || c == '_':
+			if c == '_' && isWordByte(s, i-1) && isWordByte(s, i+1) {
+				cur.WriteByte(c)
+				continue
+			}
+			if italic || strings.IndexByte(s[i+1:], c) >= 0 {
+				emit(false)
+				italic = !italic
+			} else {
+				cur.WriteByte(c)
+			}
+
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	emit(false)
+	return runs
+}
+
+// isWordByte reports whether s[i] exists and is a letter or digit
+func isWordByte(s string, i int) bool {
+	if i < 0 || i >= len(s) {
+		return false
+	}
+	r := rune(s[i])
+	return r >= 0x80 || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// writeRun writes a <w:r>, turning newlines into line breaks
+func writeRun(sb *strings.Builder, run docxRun) {
+	sb.WriteString("<w:r>")
+	if run.bold || run.italic || run.code {
+		sb.WriteString("<w:rPr>")
+		if run.code {
+			sb.WriteString(`<w:rFonts w:ascii="Courier New" w:hAnsi="Courier New" w:cs="Courier New"/>`)
+		}
+		if run.bold {
+			sb.WriteString("<w:b/>")
+		}
+		if run.italic {
+			sb.WriteString("<w:i/>")
+		}
+		sb.WriteString("</w:rPr>")
+	}
+	for i, line := range strings.Split(run.text, "\n") {
+		if i > 0 {
+			sb.WriteString("<w:br/>")
+		}
+		sb.WriteString(`<w:t xml:space="preserve">`)
+		sb.WriteString(xmlEscape(line))
+		sb.WriteString("</w:t>")
+	}
+	sb.WriteString("</w:r>")
+}
+
+// xmlEscape escapes text for XML character data and attribute values
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// docxCoreProperties returns docProps/core.xml carrying what markdown output
+// would put in front matter
+func docxCoreProperties(doc *MarkdownDocument, now time.Time) string {
+	var sb strings.Builder
+	sb.WriteString(xml.Header)
+	sb.WriteString(`<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">`)
+	fmt.Fprintf(&sb, "<dc:title>%s</dc:title>", xmlEscape(doc.Title))
+	fmt.Fprintf(&sb, "<dc:description>%s</dc:description>", xmlEscape(fmt.Sprintf("Pages %d-%d", doc.PageRange.Start, doc.PageRange.End)))
+	if doc.Metadata != nil {
+		if doc.Metadata.Author != "" {
+			fmt.Fprintf(&sb, "<dc:creator>%s</dc:creator>", xmlEscape(doc.Metadata.Author))
+		}
+		if doc.Metadata.Language != "" {
+			fmt.Fprintf(&sb, "<dc:language>%s</dc:language>", xmlEscape(doc.Metadata.Language))
+		}
+		if len(doc.Metadata.Keywords) > 0 {
+			fmt.Fprintf(&sb, "<cp:keywords>%s</cp:keywords>", xmlEscape(strings.Join(doc.Metadata.Keywords, ", ")))
+		}
+	}
+	fmt.Fprintf(&sb, `<dcterms:created xsi:type="dcterms:W3CDTF">%s</dcterms:created>`, now.UTC().Format(time.RFC3339))
+	sb.WriteString("</cp:coreProperties>")
+	return sb.String()
+}
+
+const docxContentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>` +
+	`<Override PartName="/word/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.styles+xml"/>` +
+	`<Override PartName="/word/numbering.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.numbering+xml"/>` +
+	`<Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/>` +
+	`</Types>`
+
+const docxPackageRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="docProps/core.xml"/>` +
+	`</Relationships>`
+
+const docxDocumentRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/numbering" Target="numbering.xml"/>` +
+	`</Relationships>`
+
+const docxDocumentHeader = xml.Header + `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>`
+
+const docxDocumentFooter = `<w:sectPr><w:pgSz w:w="12240" w:h="15840"/>` +
+	`<w:pgMar w:top="1440" w:right="1440" w:bottom="1440" w:left="1440" w:header="720" w:footer="720" w:gutter="0"/>` +
+	`</w:sectPr></w:body></w:document>`
+
+var docxStyles = xml.Header + `<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">` +
+	`<w:docDefaults><w:rPrDefault><w:rPr><w:rFonts w:ascii="Calibri" w:hAnsi="Calibri" w:cs="Calibri"/><w:sz w:val="22"/></w:rPr></w:rPrDefault>` +
+	`<w:pPrDefault><w:pPr><w:spacing w:after="160" w:line="259" w:lineRule="auto"/></w:pPr></w:pPrDefault></w:docDefaults>` +
+	`<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/><w:qFormat/></w:style>` +
+	docxHeadingStyle(1, 32) + docxHeadingStyle(2, 28) + docxHeadingStyle(3, 26) +
+	docxHeadingStyle(4, 24) + docxHeadingStyle(5, 22) + docxHeadingStyle(6, 22) +
+	`<w:style w:type="paragraph" w:styleId="TOCHeading"><w:name w:val="TOC Heading"/><w:basedOn w:val="Heading1"/><w:next w:val="Normal"/><w:qFormat/></w:style>` +
+	`<w:style w:type="paragraph" w:styleId="ListParagraph"><w:name w:val="List Paragraph"/><w:basedOn w:val="Normal"/><w:qFormat/><w:pPr><w:spacing w:after="60"/><w:contextualSpacing/></w:pPr></w:style>` +
+	`<w:style w:type="paragraph" w:styleId="Quote"><w:name w:val="Quote"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:qFormat/><w:pPr><w:ind w:left="720" w:right="720"/></w:pPr><w:rPr><w:i/><w:color w:val="595959"/></w:rPr></w:style>` +
+	`<w:style w:type="paragraph" w:styleId="Code"><w:name w:val="Code"/><w:basedOn w:val="Normal"/><w:pPr><w:spacing w:after="0" w:line="240" w:lineRule="auto"/></w:pPr><w:rPr><w:rFonts w:ascii="Courier New" w:hAnsi="Courier New" w:cs="Courier New"/><w:sz w:val="20"/></w:rPr></w:style>` +
+	`<w:style w:type="table" w:styleId="TableGrid"><w:name w:val="Table Grid"/><w:tblPr><w:tblBorders>` +
+	`<w:top w:val="single" w:sz="4" w:space="0" w:color="auto"/><w:left w:val="single" w:sz="4" w:space="0" w:color="auto"/>` +
+	`<w:bottom w:val="single" w:sz="4" w:space="0" w:color="auto"/><w:right w:val="single" w:sz="4" w:space="0" w:color="auto"/>` +
+	`<w:insideH w:val="single" w:sz="4" w:space="0" w:color="auto"/><w:insideV w:val="single" w:sz="4" w:space="0" w:color="auto"/>` +
+	`</w:tblBorders><w:tblCellMar><w:left w:w="108" w:type="dxa"/><w:right w:w="108" w:type="dxa"/></w:tblCellMar></w:tblPr></w:style>` +
+	`</w:styles>`
+
+// docxHeadingStyle returns the style for Heading1-6 with a half-point size
+func docxHeadingStyle(level, size int) string {
+	return fmt.Sprintf(`<w:style w:type="paragraph" w:styleId="Heading%d"><w:name w:val="heading %d"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:uiPriority w:val="9"/><w:qFormat/>`+
+		`<w:pPr><w:keepNext/><w:spacing w:before="240" w:after="120"/><w:outlineLvl w:val="%d"/></w:pPr><w:rPr><w:b/><w:sz w:val="%d"/></w:rPr></w:style>`,
+		level, level, level-1, size)
+}
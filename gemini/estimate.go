@@ -0,0 +1,332 @@
+package gemini
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// Token counts the providers charge per image, as they document them
+const (
+	// geminiTileTokens is what Gemini 2.x charges per 768x768 tile, and
+	// for any image that fits in 384x384
+	geminiTileTokens = 258
+	geminiTileSize   = 768
+
+	// gemini3ImageTokens is Gemini 3's flat charge per image at its default
+	// (high) media resolution
+	gemini3ImageTokens = 1120
+
+	// Claude scales images to fit anthropicMaxImageEdge and charges one
+	// token per anthropicPixelsPerToken
+	anthropicMaxImageEdge   = 1568
+	anthropicPixelsPerToken = 750
+
+	// localPatchSize is the patch side of Qwen2-VL-style vision encoders,
+	// which charge one token per patch; other local models are close enough
+	localPatchSize = 28
+)
+
+// Assumptions behind an estimate where the images alone can't tell
+const (
+	// estimatedOutputTokensPerPage is the markdown a dense book page turns
+	// into, with the JSON around it
+	estimatedOutputTokensPerPage = 800
+
+	// charsPerToken converts prompt text to tokens
+	charsPerToken = 4
+
+	// fallbackPageWidth and fallbackPageHeight stand in for images whose
+	// header can't be read: a letter page scanned at 200 dpi
+	fallbackPageWidth  = 1700
+	fallbackPageHeight = 2200
+
+	// Output speeds used for the time estimate, in tokens per second
+	cloudTokensPerSecond = 80
+	localTokensPerSecond = 20
+)
+
+// ModelPricing is a model's list price in US dollars per million tokens
+type ModelPricing struct {
+	InputPerMillion  float64
+	OutputPerMillion float64
+}
+
+// modelPrices maps model name prefixes to their pricing, most specific
+// first. Prices are list prices for prompts under 200k tokens and will
+// drift; they are only meant for a ballpark figure.
+var modelPrices = []struct {
+	prefix  string
+	pricing ModelPricing
+}{
+	{"gemini-3-pro", ModelPricing{2.00, 12.00}},
+	{"gemini-2.5-pro", ModelPricing{1.25, 10.00}},
+	{"gemini-2.5-flash", ModelPricing{0.30, 2.50}},
+	{"gemini-2.0-flash", ModelPricing{0.10, 0.40}},
+	{"claude-3-opus", ModelPricing{15.00, 75.00}},
+	{"claude-3-haiku", ModelPricing{0.25, 1.25}},
+	{"claude-opus-4", ModelPricing{15.00, 75.00}},
+	{"claude-sonnet-4", ModelPricing{3.00, 15.00}},
+	{"claude-3-5-sonnet", ModelPricing{3.00, 15.00}},
+	{"claude-3-sonnet", ModelPricing{3.00, 15.00}},
+}
+
+// PricingFor returns the list price of a model, and false when it isn't in
+// the pricing table
+func PricingFor(model string) (ModelPricing, bool) {
+	model = strings.ToLower(model)
+	for _, p := range modelPrices {
+		if strings.HasPrefix(model, p.prefix) {
+			return p.pricing, true
+		}
+	}
+	return ModelPricing{}, false
+}
+
+// Estimate is a rough forecast of a transcription run, made before any
+// request is sent
+type Estimate struct {
+	// Pages is the number of pages that would be transcribed, counting
+	// both halves of a split spread
+	Pages int
+
+	// Batches is the number of requests the pages would be sent in
+	Batches int
+
+	// InputTokens is the estimated prompt and image tokens over all batches
+	InputTokens int
+
+	// OutputTokens is the estimated markdown and thinking tokens
+	OutputTokens int
+
+	// Cost is the estimated price in US dollars; zero for local LLMs and
+	// for models without known pricing (see PricingKnown)
+	Cost float64
+
+	// PricingKnown is false for cloud models missing from the pricing
+	// table, whose Cost is left at zero
+	PricingKnown bool
+
+	// Duration is a rough wall-clock time for the run
+	Duration time.Duration
+
+	// Model is the vision model the estimate was made for
+	Model string
+}
+
+// TotalTokens returns the input and output tokens together
+func (e *Estimate) TotalTokens() int {
+	return e.InputTokens + e.OutputTokens
+}
+
+// Summary formats the estimate on one line for a confirmation screen, e.g.
+// "~48K tokens in 4 batches, ~$0.19, about 2m"
+func (e *Estimate) Summary(provider Provider) string {
+	batches := "batches"
+	if e.Batches == 1 {
+		batches = "batch"
+	}
+	return fmt.Sprintf("~%s tokens in %d %s, %s, about %s",
+		formatTokenCount(e.TotalTokens()), e.Batches, batches, e.costString(provider), formatRoughDuration(e.Duration))
+}
+
+// costString formats Cost: "free" for local LLMs, "unknown" for unpriced
+// models, and otherwise dollars to the cent
+func (e *Estimate) costString(provider Provider) string {
+	switch {
+	case provider == ProviderLocal:
+		return "free (local)"
+	case !e.PricingKnown:
+		return "cost unknown for " + e.Model
+	case e.Cost < 0.01:
+		return "< $0.01"
+	default:
+		return fmt.Sprintf("~$%.2f", e.Cost)
+	}
+}
+
+// formatRoughDuration rounds an estimated duration to what it's worth:
+// seconds under a minute, minutes under an hour, then hours and minutes
+func formatRoughDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", max(1, int(d.Round(time.Second).Seconds())))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Round(time.Minute).Minutes()))
+	default:
+		d = d.Round(time.Minute)
+		return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+}
+
+// EstimateTranscription forecasts the tokens, cost and time of
+// transcribing req without sending anything. Image tokens come from each
+// image's resolution, following the provider's documented image pricing;
+// prompt tokens from the prompt length; output from a typical dense page.
+// Only image headers are read, and spreads are not actually split. PDFs
+// must already be rendered, as LoadImages does. The figures are ballpark:
+// real pages vary a lot in how much text they hold.
+func (c *Client) EstimateTranscription(req *TranscribeRequest) (*Estimate, error) {
+	if len(req.Images) == 0 {
+		return nil, fmt.Errorf("at least one image is required")
+	}
+
+	images := req.Images
+	imageInfos, failed, err := c.validateImages(images)
+	if err != nil {
+		return nil, fmt.Errorf("image %d (%s): %w", failed+1, images[failed], err)
+	}
+
+	// Each half of a spread is its own page with half the pixels
+	var pages []*ImageInfo
+	for _, img := range imageInfos {
+		img.Width, img.Height = imageDimensions(img.Path)
+		if !req.SplitSpreads || float64(img.Width)/float64(img.Height) <= SpreadAspectRatio {
+			pages = append(pages, img)
+			continue
+		}
+		half := *img
+		half.Width /= 2
+		half.Size /= 2
+		left, right := half, half
+		pages = append(pages, &left, &right)
+	}
+	if len(pages) > MaxTotalImages {
+		return nil, fmt.Errorf("maximum %d images allowed, got %d", MaxTotalImages, len(pages))
+	}
+	for i, page := range pages {
+		page.PageIndex = i
+	}
+
+	model := c.model
+	if c.provider == ProviderGemini || model == "" {
+		model = req.Model
+		if model == "" {
+			model = DefaultModelFor(c.provider)
+		}
+	}
+
+	var batches [][]*ImageInfo
+	if c.provider == ProviderLocal {
+		batches = c.createLocalLLMBatches(pages)
+	} else {
+		batches = c.createSmartBatches(pages)
+	}
+
+	est := &Estimate{Pages: len(pages), Batches: len(batches), Model: model}
+	maxTokens, _ := c.outputTokenBudget(req)
+	for _, batch := range batches {
+		var prompt string
+		if c.provider == ProviderLocal {
+			prompt = c.buildLocalLLMPrompt(batch, req)
+		} else {
+			prompt = c.buildExtractionPrompt(batch, req)
+		}
+		est.InputTokens += len(prompt) / charsPerToken
+
+		for _, img := range batch {
+			est.InputTokens += c.imageTokens(img, model, req)
+		}
+
+		// A batch never writes more than its output budget
+		est.OutputTokens += min(len(batch)*estimatedOutputTokensPerPage, maxTokens)
+		if IsThinkingModel(model) && c.provider == ProviderGemini {
+			budget := req.ThinkingBudget
+			if budget == 0 || budget == DynamicThinkingBudget {
+				budget = DefaultThinkingBudget
+			}
+			est.OutputTokens += budget
+		}
+	}
+
+	// The text model reads the vision output back and rewrites it
+	refineTokens := 0
+	if c.textModel != "" {
+		refineTokens = est.OutputTokens
+		est.InputTokens += refineTokens
+		est.OutputTokens += refineTokens
+	}
+
+	if c.provider == ProviderLocal {
+		// A local server works through one request at a time
+		est.PricingKnown = true
+		est.Duration = time.Duration(est.OutputTokens) * time.Second / localTokensPerSecond
+		return est, nil
+	}
+
+	if pricing, ok := PricingFor(model); ok {
+		est.PricingKnown = true
+		est.Cost = (float64(est.InputTokens)*pricing.InputPerMillion + float64(est.OutputTokens)*pricing.OutputPerMillion) / 1e6
+	}
+
+	// Up to req.Concurrency batches run at once
+	concurrency, _ := batchConcurrency(req)
+	rounds := (len(batches) + concurrency - 1) / concurrency
+	perBatch := time.Duration(est.OutputTokens/len(batches)) * time.Second / cloudTokensPerSecond
+	est.Duration = time.Duration(rounds) * perBatch
+	return est, nil
+}
+
+// imageTokens estimates what one image costs the provider in input tokens
+func (c *Client) imageTokens(img *ImageInfo, model string, req *TranscribeRequest) int {
+	width, height := img.Width, img.Height
+
+	switch c.provider {
+	case ProviderLocal:
+		resize := DefaultLocalResizeOptions()
+		if req.LocalResize != nil {
+			resize = *req.LocalResize
+		}
+		if !resize.FullSize() && img.Size > resize.Threshold {
+			width, height = fitWithin(width, height, resize.MaxWidth, resize.MaxHeight)
+		}
+		return max(1, (width/localPatchSize)*(height/localPatchSize))
+
+	case ProviderAzureAnthropic, ProviderAnthropic:
+		width, height = fitWithin(width, height, anthropicMaxImageEdge, anthropicMaxImageEdge)
+		return max(1, width*height/anthropicPixelsPerToken)
+
+	default:
+		if strings.HasPrefix(geminiAPIModel(model), "gemini-3") {
+			return gemini3ImageTokens
+		}
+		if width <= geminiTileSize/2 && height <= geminiTileSize/2 {
+			return geminiTileTokens
+		}
+		tilesX := (width + geminiTileSize - 1) / geminiTileSize
+		tilesY := (height + geminiTileSize - 1) / geminiTileSize
+		return tilesX * tilesY * geminiTileTokens
+	}
+}
+
+// fitWithin scales width and height down, keeping the aspect ratio, until
+// they fit maxWidth by maxHeight; a zero limit leaves that side free
+func fitWithin(width, height, maxWidth, maxHeight int) (int, int) {
+	scale := 1.0
+	if maxWidth > 0 && width > maxWidth {
+		scale = float64(maxWidth) / float64(width)
+	}
+	if maxHeight > 0 && height > maxHeight {
+		scale = min(scale, float64(maxHeight)/float64(height))
+	}
+	return int(math.Round(float64(width) * scale)), int(math.Round(float64(height) * scale))
+}
+
+// imageDimensions reads an image's size from its header, falling back to a
+// typical scanned page for formats the image package can't decode
+func imageDimensions(path string) (int, int) {
+	f, err := os.Open(path)
+	if err != nil {
+		return fallbackPageWidth, fallbackPageHeight
+	}
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil || cfg.Width == 0 || cfg.Height == 0 {
+		return fallbackPageWidth, fallbackPageHeight
+	}
+	return cfg.Width, cfg.Height
+}
@@ -0,0 +1,220 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ProviderFallbackEnvVar lists providers to fail over between, in order
+// (e.g. "local,gemini")
+const ProviderFallbackEnvVar = "CAPYCUT_PROVIDER_FALLBACK"
+
+// ParseProvider parses a provider name as used in CAPYCUT_PROVIDER_FALLBACK
+func ParseProvider(s string) (Provider, error) {
+	switch p := Provider(strings.ToLower(strings.TrimSpace(s))); p {
+	case ProviderGemini, ProviderLocal, ProviderAzureAnthropic, ProviderAnthropic:
+		return p, nil
+	case "azure", "azure-anthropic":
+		return ProviderAzureAnthropic, nil
+	default:
+		return "", fmt.Errorf("unknown provider %q (use local, gemini, anthropic or azure_anthropic)", s)
+	}
+}
+
+// ProviderFallbackFromEnv reads CAPYCUT_PROVIDER_FALLBACK; nil means unset
+func ProviderFallbackFromEnv() ([]Provider, error) {
+	v := strings.TrimSpace(os.Getenv(ProviderFallbackEnvVar))
+	if v == "" {
+		return nil, nil
+	}
+
+	var chain []Provider
+	seen := make(map[Provider]bool)
+	for _, name := range strings.Split(v, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		p, err := ParseProvider(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", ProviderFallbackEnvVar, err)
+		}
+		if !seen[p] {
+			seen[p] = true
+			chain = append(chain, p)
+		}
+	}
+	return chain, nil
+}
+
+// WithFallback sets clients that take over a batch the primary client fails
+// for any reason other than cancellation. They are tried in order, and the
+// provider that handled each batch is reported in
+// TranscribeResponse.BatchProviders and BatchModels. Fallbacks share the primary client's
+// memory limit.
+func WithFallback(clients ...*Client) ClientOption {
+	return func(c *Client) {
+		c.fallbacks = clients
+	}
+}
+
+// FallbackClientsFromEnv builds clients for the CAPYCUT_PROVIDER_FALLBACK
+// providers other than primary, for callers that pick the primary provider
+// themselves. Providers that aren't configured are skipped.
+func FallbackClientsFromEnv(primary Provider, opts ...ClientOption) ([]*Client, error) {
+	chain, err := ProviderFallbackFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	var clients []*Client
+	for _, p := range chain {
+		if p == primary {
+			continue
+		}
+		c, err := NewClientForProviderFromEnv(p, opts...)
+		if err != nil {
+			if os.Getenv("CAPYCUT_DEBUG") != "" {
+				fmt.Printf("[DEBUG] Skipping fallback provider %s: %v\n", p, err)
+			}
+			continue
+		}
+		clients = append(clients, c)
+	}
+	return clients, nil
+}
+
+// newClientChain builds a client for each provider in order. The first one
+// that constructs becomes the primary and the rest its fallbacks.
+func newClientChain(providers []Provider, opts []ClientOption) (*Client, error) {
+	var clients []*Client
+	var failures []string
+	for _, p := range providers {
+		c, err := NewClientForProviderFromEnv(p, opts...)
+		if err != nil {
+			if os.Getenv("CAPYCUT_DEBUG") != "" {
+				fmt.Printf("[DEBUG] Skipping provider %s: %v\n", p, err)
+			}
+			failures = append(failures, fmt.Sprintf("%s: %v", p, err))
+			continue
+		}
+		clients = append(clients, c)
+	}
+
+	if len(clients) == 0 {
+		return nil, fmt.Errorf("no provider in %s could be configured (%s)", ProviderFallbackEnvVar, strings.Join(failures, "; "))
+	}
+	clients[0].fallbacks = clients[1:]
+	return clients[0], nil
+}
+
+// processBatchWithFallback reserves memory for a batch, sends it to the
+// primary provider and, if that fails, to each fallback in turn. It returns
+// the provider and model that produced the pages.
+func (c *Client) processBatchWithFallback(ctx context.Context, images []*ImageInfo, req *TranscribeRequest, model string, tctx *transcribeContext, batchNum int) ([]*PageContent, int, Provider, string, error) {
+	// Hold a share of the memory budget while image data is resident
+	reserved, err := c.memory.acquire(ctx, estimateBatchMemory(images))
+	if err != nil {
+		return nil, 0, c.provider, c.sentModel(model), err
+	}
+	defer c.memory.release(reserved)
+
+	pages, tokens, err := c.processBatchWithProgress(ctx, images, req, model, tctx, batchNum)
+	if err == nil || ctx.Err() != nil {
+		return pages, tokens, c.provider, c.sentModel(model), err
+	}
+
+	for _, fb := range c.fallbacks {
+		c.sendProgress(tctx, ProgressUpdate{
+			Status:       StatusWarning,
+			Message:      "Falling back to " + fb.getProviderDisplayName(),
+			Detail:       fmt.Sprintf("Batch %d: %s failed: %v", batchNum, c.getProviderDisplayName(), err),
+			CurrentBatch: batchNum,
+			Model:        model,
+		})
+		if c.debug {
+			fmt.Printf("[DEBUG] Batch %d failed on %s, trying %s: %v\n", batchNum, c.provider, fb.provider, err)
+		}
+
+		fbModel := fallbackModel(fb, model)
+		fbPages, fbTokens, fbErr := fb.processBatchAsFallback(ctx, images, req, fbModel, tctx, batchNum)
+		if fbErr == nil {
+			return fbPages, fbTokens, fb.provider, fb.sentModel(fbModel), nil
+		}
+		if ctx.Err() != nil {
+			return nil, 0, fb.provider, fb.sentModel(fbModel), fbErr
+		}
+		err = fmt.Errorf("%w; %s fallback: %v", err, fb.provider, fbErr)
+	}
+
+	return nil, 0, c.provider, c.sentModel(model), err
+}
+
+// processBatchAsFallback sends a batch built for another provider. Local
+// models get one image per request, as createLocalLLMBatches would have done.
+func (c *Client) processBatchAsFallback(ctx context.Context, images []*ImageInfo, req *TranscribeRequest, model string, tctx *transcribeContext, batchNum int) ([]*PageContent, int, error) {
+	if c.provider != ProviderLocal || len(images) <= 1 {
+		return c.processBatchWithProgress(ctx, images, req, model, tctx, batchNum)
+	}
+
+	var allPages []*PageContent
+	totalTokens := 0
+	for _, img := range images {
+		pages, tokens, err := c.processBatchWithProgress(ctx, []*ImageInfo{img}, req, model, tctx, batchNum)
+		if err != nil {
+			return nil, 0, err
+		}
+		allPages = append(allPages, pages...)
+		totalTokens += tokens
+	}
+	return allPages, totalTokens, nil
+}
+
+// sentModel returns the model a batch requested as model goes to: Gemini
+// takes it per request, while local and Claude clients use their own
+func (c *Client) sentModel(model string) string {
+	if c.provider == ProviderGemini {
+		return model
+	}
+	return c.model
+}
+
+// fallbackModel keeps the requested model unless a Gemini fallback was
+// given a model meant for another provider
+func fallbackModel(fb *Client, model string) string {
+	if fb.provider == ProviderGemini && !strings.HasPrefix(model, "gemini") {
+		return ModelGemini3Pro
+	}
+	return model
+}
+
+// ProviderSummary describes how batches were split across providers, e.g.
+// "local: 3 batches, gemini: 1 batch". It is empty when a single provider
+// handled everything.
+func (r *TranscribeResponse) ProviderSummary() string {
+	counts := make(map[Provider]int)
+	var order []Provider
+	for _, p := range r.BatchProviders {
+		if p == "" {
+			continue
+		}
+		if counts[p] == 0 {
+			order = append(order, p)
+		}
+		counts[p]++
+	}
+	if len(order) < 2 {
+		return ""
+	}
+
+	parts := make([]string, len(order))
+	for i, p := range order {
+		unit := "batches"
+		if counts[p] == 1 {
+			unit = "batch"
+		}
+		parts[i] = fmt.Sprintf("%s: %d %s", p, counts[p], unit)
+	}
+	return strings.Join(parts, ", ")
+}
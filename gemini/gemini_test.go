@@ -1,14 +1,37 @@
 package gemini
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
+
+	"capycut/llm"
 )
 
 func TestNewClient(t *testing.T) {
@@ -42,6 +65,7 @@ func TestNewClientFromEnv(t *testing.T) {
 		os.Setenv("GEMINI_API_KEY", origGemini)
 		os.Setenv("GOOGLE_API_KEY", origGoogle)
 	}()
+	t.Setenv("ANTHROPIC_API_KEY", "")
 
 	// Test with GEMINI_API_KEY
 	os.Setenv("GEMINI_API_KEY", "test-gemini-key")
@@ -76,6 +100,151 @@ func TestNewClientFromEnv(t *testing.T) {
 	}
 }
 
+func TestNewClientFromEnv_LLMProvider(t *testing.T) {
+	t.Setenv("LLM_ENDPOINT", "")
+	t.Setenv("IMAGE_LLM_ENDPOINT", "")
+	t.Setenv("AZURE_ANTHROPIC_ENDPOINT", "")
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-test")
+	t.Setenv("GEMINI_API_KEY", "test-gemini-key")
+	t.Setenv(ProviderFallbackEnvVar, "")
+
+	tests := []struct {
+		setting string
+		want    Provider
+	}{
+		{"anthropic", ProviderAnthropic},
+		{"gemini", ProviderGemini},
+		// Azure OpenAI only parses clips, so detection decides
+		{"azure", ProviderGemini},
+	}
+	for _, tt := range tests {
+		t.Setenv("LLM_PROVIDER", tt.setting)
+		client, err := NewClientFromEnv()
+		if err != nil {
+			t.Fatalf("LLM_PROVIDER=%s: NewClientFromEnv() failed: %v", tt.setting, err)
+		}
+		if client.GetProvider() != tt.want || GetProvider() != tt.want {
+			t.Errorf("LLM_PROVIDER=%s: provider = %s (GetProvider() %s), want %s", tt.setting, client.GetProvider(), GetProvider(), tt.want)
+		}
+	}
+
+	t.Setenv("LLM_PROVIDER", "gemnii")
+	if _, err := NewClientFromEnv(); err == nil {
+		t.Error("NewClientFromEnv() should reject an unknown LLM_PROVIDER")
+	}
+}
+
+func TestNewClientFromEnv_RequestTimeout(t *testing.T) {
+	t.Setenv("LLM_ENDPOINT", "")
+	t.Setenv("IMAGE_LLM_ENDPOINT", "")
+	t.Setenv("AZURE_ANTHROPIC_ENDPOINT", "")
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	t.Setenv("GEMINI_API_KEY", "test-gemini-key")
+
+	t.Setenv(RequestTimeoutEnvVar, "12m")
+	client, err := NewClientFromEnv()
+	if err != nil {
+		t.Fatalf("NewClientFromEnv() failed: %v", err)
+	}
+	if client.httpClient.Timeout != 12*time.Minute {
+		t.Errorf("timeout = %v, want 12m", client.httpClient.Timeout)
+	}
+
+	// Explicit options win over the environment
+	client, err = NewClientFromEnv(WithTimeout(time.Minute))
+	if err != nil {
+		t.Fatalf("NewClientFromEnv() failed: %v", err)
+	}
+	if client.httpClient.Timeout != time.Minute {
+		t.Errorf("timeout = %v, want 1m", client.httpClient.Timeout)
+	}
+
+	t.Setenv(RequestTimeoutEnvVar, "soon")
+	if _, err := NewClientFromEnv(); err == nil {
+		t.Error("NewClientFromEnv() should reject an invalid timeout")
+	}
+}
+
+func TestNewClientFromEnv_CACert(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	t.Setenv("LLM_ENDPOINT", server.URL)
+	t.Setenv("IMAGE_LLM_ENDPOINT", "")
+	t.Setenv(llm.InsecureEnvVar, "")
+
+	// Without the CA the server's self-signed certificate is rejected
+	t.Setenv(llm.CACertEnvVar, "")
+	client, err := NewClientFromEnv()
+	if err != nil {
+		t.Fatalf("NewClientFromEnv() failed: %v", err)
+	}
+	if _, err := client.httpClient.Get(server.URL); err == nil {
+		t.Error("expected an untrusted certificate to be rejected")
+	}
+
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caPath, certPEM, 0644); err != nil {
+		t.Fatalf("failed to write CA: %v", err)
+	}
+	t.Setenv(llm.CACertEnvVar, caPath)
+	client, err = NewClientFromEnv()
+	if err != nil {
+		t.Fatalf("NewClientFromEnv() failed: %v", err)
+	}
+	resp, err := client.httpClient.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request with %s failed: %v", llm.CACertEnvVar, err)
+	}
+	resp.Body.Close()
+
+	if err := os.WriteFile(caPath, []byte("not a certificate"), 0644); err != nil {
+		t.Fatalf("failed to write CA: %v", err)
+	}
+	if _, err := NewClientFromEnv(); err == nil {
+		t.Error("NewClientFromEnv() should reject a bundle without certificates")
+	}
+}
+
+func TestJobTimeoutFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		job      string
+		perImage string
+		images   int
+		want     time.Duration
+		wantErr  bool
+	}{
+		{"small job gets the floor", "", "", 3, MinJobTimeout, false},
+		{"scales with images", "", "", 40, 40 * DefaultPerImageTimeout, false},
+		{"custom per-image budget", "", "2m", 10, 20 * time.Minute, false},
+		{"capped", "", "10m", 100, MaxJobTimeout, false},
+		{"explicit job timeout wins", "1h", "2m", 100, time.Hour, false},
+		{"explicit job timeout is not floored", "90s", "", 3, 90 * time.Second, false},
+		{"zero job timeout", "0s", "", 3, 0, true},
+		{"negative job timeout", "-5m", "", 3, 0, true},
+		{"invalid job timeout", "forever", "", 3, 0, true},
+		{"invalid per-image budget", "", "slow", 3, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(JobTimeoutEnvVar, tt.job)
+			t.Setenv(PerImageTimeoutEnvVar, tt.perImage)
+			got, err := JobTimeoutFor(tt.images)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("JobTimeoutFor(%d) error = %v, wantErr %v", tt.images, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("JobTimeoutFor(%d) = %v, want %v", tt.images, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestClientOptions(t *testing.T) {
 	client, err := NewClient("test-key",
 		WithBaseURL("https://custom.api.com"),
@@ -157,6 +326,20 @@ func TestSanitizeFilename(t *testing.T) {
 		{"___Leading_Trailing___", "leading_trailing"},
 		{"", "document"},
 		{"A Very Long Title That Should Be Truncated Because It Exceeds Fifty Characters Limit", "a_very_long_title_that_should_be_truncated_because"},
+
+		// Adversarial titles
+		{"../../etc/passwd", "etc_passwd"},
+		{"..", "document"},
+		{". . .", "document"},
+		{".hidden", "hidden"},
+		{"trailing dot.", "trailing_dot"},
+		{"CON", "_con"},
+		{"nul.txt", "_nul.txt"},
+		{"Lpt9", "_lpt9"},
+		{"console", "console"},
+		{"tab\there\x00null", "tab_here_null"},
+		{"C:\\Windows\\System32", "c_windows_system32"},
+		{strings.Repeat("日本", 20), strings.Repeat("日本", 8)},
 	}
 
 	for _, tt := range tests {
@@ -168,6 +351,94 @@ func TestSanitizeFilename(t *testing.T) {
 	}
 }
 
+func TestOutputPath(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		filename string
+		want     string
+	}{
+		{"plain", "01_intro.md", "01_intro.md"},
+		{"traversal", "../../escape.md", "escape.md"},
+		{"absolute", "/etc/passwd", "etc_passwd"},
+		{"windows traversal", `..\..\evil.docx`, "evil.docx"},
+		{"reserved", "CON.md", "_con.md"},
+		{"leading dots", "...md", "document.md"},
+		{"dot dir", "..", "document"},
+		{"control characters", "a\nb.md", "a_b.md"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := outputPath(dir, tt.filename)
+			if err != nil {
+				t.Fatalf("outputPath(%q) error: %v", tt.filename, err)
+			}
+			if got != filepath.Join(dir, tt.want) {
+				t.Errorf("outputPath(%q) = %s, want %s", tt.filename, got, filepath.Join(dir, tt.want))
+			}
+		})
+	}
+
+	// Long names are shortened to fit the path limit, keeping the extension
+	long := strings.Repeat("a", 300) + ".md"
+	got, err := outputPath(dir, long)
+	if err != nil {
+		t.Fatalf("outputPath(long) error: %v", err)
+	}
+	if abs, _ := filepath.Abs(got); len(abs) > MaxOutputPathLength || !strings.HasSuffix(got, ".md") {
+		t.Errorf("outputPath(long) = %s (%d chars), want <= %d ending in .md", got, len(abs), MaxOutputPathLength)
+	}
+
+	// An output directory that leaves no room is an error, not a truncated name
+	deep := filepath.Join(dir, strings.Repeat("d", MaxOutputPathLength))
+	if _, err := outputPath(deep, "01_intro.md"); err == nil {
+		t.Error("outputPath() with an overlong directory should fail")
+	}
+}
+
+func TestWriteDocuments_MaliciousTitles(t *testing.T) {
+	parent := t.TempDir()
+	outDir := filepath.Join(parent, "out")
+
+	titles := []string{"../../escape", "/etc/passwd", "CON", "..", ".bashrc", "a\x00b", strings.Repeat("x/", 200)}
+	var docs []*MarkdownDocument
+	for i, title := range titles {
+		docs = append(docs, &MarkdownDocument{
+			Filename:  title + ".md",
+			Title:     title,
+			Content:   "content",
+			PageRange: PageRange{Start: i + 1, End: i + 1},
+		})
+	}
+
+	// Filenames built verbatim from titles must still land inside outDir
+	result, err := WriteDocuments(docs, WriteOptions{OutputDir: outDir, Overwrite: true, CreateIndexFile: true})
+	if err != nil {
+		t.Fatalf("WriteDocuments() failed: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		t.Fatalf("WriteDocuments() errors: %v", result.Errors)
+	}
+
+	for _, path := range result.FilesWritten {
+		rel, err := filepath.Rel(outDir, path)
+		if err != nil || strings.Contains(rel, string(filepath.Separator)) || strings.HasPrefix(rel, ".") {
+			t.Errorf("wrote %s outside %s", path, outDir)
+		}
+	}
+	entries, _ := os.ReadDir(parent)
+	if len(entries) != 1 {
+		t.Errorf("files escaped the output directory: %v", entries)
+	}
+	for _, doc := range docs {
+		if _, err := os.Stat(filepath.Join(outDir, doc.Filename)); err != nil {
+			t.Errorf("doc.Filename %q should name the file written: %v", doc.Filename, err)
+		}
+	}
+}
+
 func TestNaturalSort(t *testing.T) {
 	tests := []struct {
 		a, b string
@@ -179,12 +450,24 @@ func TestNaturalSort(t *testing.T) {
 		{"a.png", "b.png", true},
 		{"img1.jpg", "img1.jpg", false},
 		{"file_001.png", "file_002.png", true},
+		{"page9.png", "page10.png", true},
+		{"page10.png", "page100.png", true},
+		{"Page2.png", "page10.png", true},
+		{"page002.png", "page10.png", true},
+		{"page2.png", "page02.png", true},
+		{"page02.png", "page2.png", false},
+		{"page02.png", "page2a.png", true},
+		{"scan_20240101120000000001.png", "scan_20240101120000000002.png", true},
+		{"scan_99999999999999999999.png", "scan_100000000000000000000.png", true},
+		{"Page1.png", "page1.png", true},
+		{"page1.png", "Page1.png", false},
+		{"page1.png", "page1.png.bak", true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
-			if got := naturalSort(tt.a, tt.b); got != tt.want {
-				t.Errorf("naturalSort(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			if got := NaturalLess(tt.a, tt.b); got != tt.want {
+				t.Errorf("NaturalLess(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
 			}
 		})
 	}
@@ -251,421 +534,4666 @@ func TestLoadImages(t *testing.T) {
 	}
 }
 
-func TestValidateImages(t *testing.T) {
-	tmpDir := t.TempDir()
-
-	// Create valid image
-	validPath := filepath.Join(tmpDir, "valid.png")
-	if err := os.WriteFile(validPath, []byte("image data"), 0644); err != nil {
-		t.Fatalf("Failed to create test file: %v", err)
+func TestLoadImages_MixedNumbering(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  []string
+	}{
+		{
+			name:  "unpadded",
+			files: []string{"page1.png", "page10.png", "page11.png", "page2.png", "page9.png"},
+			want:  []string{"page1.png", "page2.png", "page9.png", "page10.png", "page11.png"},
+		},
+		{
+			name:  "mixed padding",
+			files: []string{"page010.png", "page9.png", "page1.png", "page02.png", "page100.png"},
+			want:  []string{"page1.png", "page02.png", "page9.png", "page010.png", "page100.png"},
+		},
+		{
+			name:  "padded and unpadded duplicates",
+			files: []string{"page02.png", "page2.png", "page10.png", "page1.png"},
+			want:  []string{"page1.png", "page2.png", "page02.png", "page10.png"},
+		},
 	}
 
-	// Test valid image
-	if err := ValidateImages([]string{validPath}); err != nil {
-		t.Errorf("ValidateImages() failed for valid image: %v", err)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte("fake image data"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// A directory, a glob and explicit paths all come out the same
+			var explicit []string
+			for _, name := range tt.files {
+				explicit = append(explicit, filepath.Join(dir, name))
+			}
+			for _, sources := range [][]string{{dir}, {filepath.Join(dir, "*.png")}, explicit} {
+				images, err := LoadImages(sources)
+				if err != nil {
+					t.Fatalf("LoadImages(%v) failed: %v", sources, err)
+				}
+				if len(images) != len(tt.want) {
+					t.Fatalf("LoadImages(%v) returned %d images, want %d", sources, len(images), len(tt.want))
+				}
+				for i, img := range images {
+					if filepath.Base(img) != tt.want[i] {
+						t.Errorf("LoadImages(%v)[%d] = %s, want %s", sources, i, filepath.Base(img), tt.want[i])
+					}
+				}
+			}
+		})
 	}
+}
 
-	// Test non-existent file
-	if err := ValidateImages([]string{"/nonexistent/file.png"}); err == nil {
-		t.Error("ValidateImages() should fail for non-existent file")
+// fakePDFRenderer points pdfRenderer at a script that stands in for
+// pdftoppm: it writes pages 1 to pages as "<prefix>-<n>.jpg", unpadded so
+// only a natural sort puts them in order, and logs its arguments
+func fakePDFRenderer(t *testing.T, pages int) (logPath string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake renderer is a shell script")
+	}
+	dir := t.TempDir()
+	logPath = filepath.Join(dir, "args.log")
+	script := fmt.Sprintf(`#!/bin/sh
+echo "$@" >> %q
+for last; do :; done
+i=1
+while [ $i -le %d ]; do
+	echo page > "$last-$i.jpg"
+	i=$((i+1))
+done
+`, logPath, pages)
+	bin := filepath.Join(dir, "fake-pdftoppm")
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
 	}
 
-	// Test invalid extension
-	invalidPath := filepath.Join(tmpDir, "invalid.txt")
-	if err := os.WriteFile(invalidPath, []byte("text"), 0644); err != nil {
-		t.Fatalf("Failed to create test file: %v", err)
+	old := pdfRenderer
+	pdfRenderer = bin
+	t.Cleanup(func() { pdfRenderer = old })
+	return logPath
+}
+
+func TestValidatePDFDPI(t *testing.T) {
+	for _, dpi := range []int{0, MinPDFDPI, DefaultPDFDPI, MaxPDFDPI} {
+		if err := ValidatePDFDPI(dpi); err != nil {
+			t.Errorf("ValidatePDFDPI(%d) = %v, want nil", dpi, err)
+		}
 	}
-	if err := ValidateImages([]string{invalidPath}); err == nil {
-		t.Error("ValidateImages() should fail for invalid extension")
+	for _, dpi := range []int{-1, MinPDFDPI - 1, MaxPDFDPI + 1} {
+		if err := ValidatePDFDPI(dpi); err == nil {
+			t.Errorf("ValidatePDFDPI(%d) = nil, want an error", dpi)
+		}
 	}
 }
 
-func TestAPIError(t *testing.T) {
-	err := &APIError{
-		StatusCode: 400,
-		Message:    "Bad Request",
-		Details:    "Invalid parameter",
+func TestBuildPdftoppmArgs(t *testing.T) {
+	got := strings.Join(buildPdftoppmArgs("in.pdf", "/tmp/x/in", 150), " ")
+	want := "-r 150 -jpeg -jpegopt quality=90 in.pdf /tmp/x/in"
+	if got != want {
+		t.Errorf("buildPdftoppmArgs() = %q, want %q", got, want)
 	}
+}
 
-	expected := "Bad Request: Invalid parameter"
-	if err.Error() != expected {
-		t.Errorf("APIError.Error() = %v, want %v", err.Error(), expected)
+func TestLoadImages_PDF(t *testing.T) {
+	defer CleanupTempFiles()
+	logPath := fakePDFRenderer(t, 12)
+
+	dir := t.TempDir()
+	pdf := filepath.Join(dir, "book.pdf")
+	cover := filepath.Join(dir, "a-cover.png")
+	for _, p := range []string{pdf, cover} {
+		if err := os.WriteFile(p, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
 	}
 
-	err2 := &APIError{
-		StatusCode: 401,
-		Message:    "Unauthorized",
+	images, err := LoadImagesWithOptions([]string{pdf, cover}, LoadOptions{DPI: 300})
+	if err != nil {
+		t.Fatalf("LoadImagesWithOptions() failed: %v", err)
 	}
-	if err2.Error() != "Unauthorized" {
-		t.Errorf("APIError.Error() = %v, want Unauthorized", err2.Error())
+	if len(images) != 13 {
+		t.Fatalf("got %d images, want the cover and 12 pages: %v", len(images), images)
+	}
+	if images[0] != cover {
+		t.Errorf("images[0] = %s, want the cover", images[0])
+	}
+	// PDF page N lands at index N, the cover sorting before "book"
+	for i, img := range images[1:] {
+		if want := fmt.Sprintf("book-%d.jpg", i+1); filepath.Base(img) != want {
+			t.Errorf("images[%d] = %s, want %s", i+1, filepath.Base(img), want)
+		}
 	}
-}
-
-func TestTranscribeRequest_Validation(t *testing.T) {
-	client, _ := NewClient("test-key")
 
-	// Test empty images
-	_, err := client.TranscribeImages(context.Background(), &TranscribeRequest{
-		Images: []string{},
-	})
-	if err == nil {
-		t.Error("TranscribeImages() should fail with empty images")
+	args, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(args), "-r 300 ") {
+		t.Errorf("renderer called with %q, want -r 300", args)
 	}
 
-	// Test too many images
-	manyImages := make([]string, MaxTotalImages+1)
-	for i := range manyImages {
-		manyImages[i] = "/fake/image.png"
+	// A folder holding the PDF only yields its images
+	folder, err := LoadImages([]string{dir})
+	if err != nil {
+		t.Fatalf("LoadImages(dir) failed: %v", err)
 	}
-	_, err = client.TranscribeImages(context.Background(), &TranscribeRequest{
-		Images: manyImages,
-	})
-	if err == nil {
-		t.Error("TranscribeImages() should fail with too many images")
+	if len(folder) != 1 {
+		t.Errorf("LoadImages(dir) = %v, want only the cover", folder)
 	}
 }
 
-func TestGenerateContent_MockServer(t *testing.T) {
-	// Create mock server
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Verify request
-		if r.Method != "POST" {
-			t.Errorf("Expected POST, got %s", r.Method)
-		}
+func TestLoadImages_PDFWithoutRenderer(t *testing.T) {
+	old := pdfRenderer
+	pdfRenderer = "capycut-missing-pdftoppm"
+	defer func() { pdfRenderer = old }()
 
-		// Return mock response
-		resp := GenerateContentResponse{
-			Candidates: []*Candidate{
-				{
-					Content: &Content{
-						Parts: []*Part{
-							{Text: `{"pages": [{"page_number": 1, "text": "Test content", "has_heading": false}]}`},
-						},
-					},
-					FinishReason: "STOP",
-				},
-			},
-			UsageMetadata: &UsageMetadata{
-				PromptTokenCount:     100,
-				CandidatesTokenCount: 50,
-				TotalTokenCount:      150,
-			},
+	pdf := filepath.Join(t.TempDir(), "book.pdf")
+	if err := os.WriteFile(pdf, []byte("%PDF-1.4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, source := range []string{pdf, filepath.Join(filepath.Dir(pdf), "*.pdf")} {
+		_, err := LoadImages([]string{source})
+		if err == nil || !strings.Contains(err.Error(), "capycut-missing-pdftoppm") {
+			t.Errorf("LoadImages(%s) error = %v, want one naming the renderer", source, err)
 		}
+	}
+}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(resp)
-	}))
-	defer server.Close()
+func TestTranscribe_RejectsPDFs(t *testing.T) {
+	// LoadImages renders PDFs; the client doesn't render them again
+	logPath := fakePDFRenderer(t, 2)
+	pdf := filepath.Join(t.TempDir(), "ch1.pdf")
+	if err := os.WriteFile(pdf, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
 
-	client, _ := NewClient("test-key", WithBaseURL(server.URL))
+	gem, err := NewClient("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gem.EstimateTranscription(&TranscribeRequest{Images: []string{pdf}}); err == nil || !strings.Contains(err.Error(), "LoadImages") {
+		t.Errorf("EstimateTranscription() with a PDF = %v, want an error pointing to LoadImages", err)
+	}
+	if _, err := gem.TranscribeImages(context.Background(), &TranscribeRequest{Images: []string{pdf}}); err == nil || !strings.Contains(err.Error(), "LoadImages") {
+		t.Errorf("TranscribeImages() with a PDF = %v, want an error pointing to LoadImages", err)
+	}
+	if data, _ := os.ReadFile(logPath); len(data) > 0 {
+		t.Errorf("the client ran the renderer: %s", data)
+	}
 
-	// Create test image
-	tmpDir := t.TempDir()
-	imgPath := filepath.Join(tmpDir, "test.png")
-	if err := os.WriteFile(imgPath, []byte("fake png data"), 0644); err != nil {
-		t.Fatalf("Failed to create test image: %v", err)
+	if _, err := LoadImagesWithOptions([]string{pdf}, LoadOptions{DPI: MaxPDFDPI + 1}); err == nil {
+		t.Error("LoadImagesWithOptions() with too high a DPI should fail")
 	}
+}
 
-	// Make request
-	resp, err := client.TranscribeImages(context.Background(), &TranscribeRequest{
-		Images: []string{imgPath},
-	})
+// writeTestImage writes a w x h image whose left half is red and right half
+// blue, as PNG or JPEG depending on the extension
+func writeTestImage(t *testing.T, path string, w, h int) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= w/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
 
+	f, err := os.Create(path)
 	if err != nil {
-		t.Fatalf("TranscribeImages() failed: %v", err)
+		t.Fatal(err)
 	}
-
-	if resp.TokensUsed != 150 {
-		t.Errorf("TokensUsed = %d, want 150", resp.TokensUsed)
+	defer f.Close()
+	if strings.HasSuffix(path, ".jpg") {
+		err = jpeg.Encode(f, img, nil)
+	} else {
+		err = png.Encode(f, img)
 	}
-
-	if len(resp.Documents) == 0 {
-		t.Error("Expected at least one document")
+	if err != nil {
+		t.Fatal(err)
 	}
 }
 
-func TestWriteDocuments(t *testing.T) {
-	tmpDir := t.TempDir()
+func TestSplitSpreads(t *testing.T) {
+	defer CleanupTempFiles()
+	dir := t.TempDir()
 
-	docs := []*MarkdownDocument{
-		{
-			Filename:  "chapter_1.md",
-			Title:     "Chapter 1",
-			Content:   "# Chapter 1\n\nThis is chapter 1.",
-			PageRange: PageRange{Start: 1, End: 5},
-		},
-		{
-			Filename:  "chapter_2.md",
-			Title:     "Chapter 2",
-			Content:   "# Chapter 2\n\nThis is chapter 2.",
-			PageRange: PageRange{Start: 6, End: 10},
-		},
-	}
+	portrait := filepath.Join(dir, "01.png")
+	spread := filepath.Join(dir, "02.png")
+	jpegSpread := filepath.Join(dir, "03.jpg")
+	square := filepath.Join(dir, "04.png")
+	writeTestImage(t, portrait, 70, 100)
+	writeTestImage(t, spread, 140, 100)
+	writeTestImage(t, jpegSpread, 140, 100)
+	writeTestImage(t, square, 100, 100)
 
-	result, err := WriteDocuments(docs, WriteOptions{
-		OutputDir:       tmpDir,
-		CreateIndexFile: true,
-		AddFrontMatter:  true,
-	})
+	if got := FindSpreads([]string{portrait, spread, jpegSpread, square}); len(got) != 2 {
+		t.Errorf("FindSpreads() = %v, want the two landscape images", got)
+	}
 
+	paths, err := SplitSpreads([]string{portrait, spread, jpegSpread, square})
 	if err != nil {
-		t.Fatalf("WriteDocuments() failed: %v", err)
+		t.Fatalf("SplitSpreads() failed: %v", err)
 	}
-
-	// Should have 3 files: 2 chapters + index
-	if len(result.FilesWritten) != 3 {
-		t.Errorf("FilesWritten = %d, want 3", len(result.FilesWritten))
+	if len(paths) != 6 {
+		t.Fatalf("SplitSpreads() returned %d paths, want 6: %v", len(paths), paths)
+	}
+	if paths[0] != portrait || paths[5] != square {
+		t.Errorf("non-spreads should pass through in place: %v", paths)
 	}
 
-	// Verify files exist
-	for _, path := range result.FilesWritten {
-		if _, err := os.Stat(path); err != nil {
-			t.Errorf("File %s was not created: %v", path, err)
+	// Left half first, then right, with the source format kept
+	for i, want := range []struct {
+		ext  string
+		blue bool
+	}{{".png", false}, {".png", true}, {".jpg", false}, {".jpg", true}} {
+		path := paths[i+1]
+		if filepath.Ext(path) != want.ext {
+			t.Errorf("half %d = %s, want a %s file", i, path, want.ext)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, _, err := image.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("half %d: %v", i, err)
+		}
+		if b := img.Bounds(); b.Dx() != 70 || b.Dy() != 100 {
+			t.Errorf("half %d is %dx%d, want 70x100", i, b.Dx(), b.Dy())
+		}
+		_, _, blue, _ := img.At(35, 50).RGBA()
+		if (blue > 0x8000) != want.blue {
+			t.Errorf("half %d has the wrong side of the spread", i)
 		}
 	}
 
-	// Verify front matter was added
-	content, err := os.ReadFile(filepath.Join(tmpDir, "chapter_1.md"))
-	if err != nil {
-		t.Fatalf("Failed to read chapter_1.md: %v", err)
-	}
-	if len(content) == 0 {
-		t.Error("chapter_1.md is empty")
-	}
-	contentStr := string(content)
-	if !contains(contentStr, "---") {
-		t.Error("Front matter not found in chapter_1.md")
+	CleanupTempFiles()
+	if _, err := os.Stat(paths[1]); !os.IsNotExist(err) {
+		t.Errorf("CleanupTempFiles() left %s behind", paths[1])
 	}
 }
 
-func TestWriteDocuments_NoOverwrite(t *testing.T) {
-	tmpDir := t.TempDir()
-
-	// Create existing file
-	existingPath := filepath.Join(tmpDir, "existing.md")
-	if err := os.WriteFile(existingPath, []byte("existing content"), 0644); err != nil {
-		t.Fatalf("Failed to create existing file: %v", err)
-	}
+func TestTranscribeImages_SplitSpreads(t *testing.T) {
+	defer CleanupTempFiles()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(LocalLLMResponse{
+			Choices: []LocalLLMChoice{{Message: LocalLLMChoiceMessage{Content: `{"pages": [{"page_number": 1, "text": "ok"}]}`}}},
+		})
+	}))
+	defer server.Close()
 
-	docs := []*MarkdownDocument{
-		{
-			Filename: "existing.md",
-			Title:    "Test",
-			Content:  "new content",
-		},
+	client, err := NewLocalClient(server.URL, "test-model")
+	if err != nil {
+		t.Fatal(err)
 	}
+	dir := t.TempDir()
+	cover := filepath.Join(dir, "01.png")
+	spread := filepath.Join(dir, "02.png")
+	writeTestImage(t, cover, 70, 100)
+	writeTestImage(t, spread, 140, 100)
 
-	result, err := WriteDocuments(docs, WriteOptions{
-		OutputDir: tmpDir,
-		Overwrite: false,
+	resp, err := client.TranscribeImages(context.Background(), &TranscribeRequest{
+		Images:       []string{cover, spread},
+		SplitSpreads: true,
 	})
-
 	if err != nil {
-		t.Fatalf("WriteDocuments() failed: %v", err)
+		t.Fatalf("TranscribeImages() failed: %v", err)
 	}
-
-	// Should have error about existing file
-	if len(result.Errors) == 0 {
-		t.Error("Expected error about existing file")
+	if resp.TotalPages != 3 || len(resp.Pages) != 3 {
+		t.Fatalf("got %d pages of %d, want the spread counted as two", len(resp.Pages), resp.TotalPages)
 	}
-
-	// Original file should be unchanged
-	content, _ := os.ReadFile(existingPath)
-	if string(content) != "existing content" {
-		t.Error("Existing file was overwritten")
+	for i, page := range resp.Pages {
+		if page.PageNumber != i+1 {
+			t.Errorf("page %d has number %d", i, page.PageNumber)
+		}
 	}
 }
 
-func TestFormatSize(t *testing.T) {
+func TestLoadImagesWithOptions_Recursive(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := []string{
+		"cover.png",
+		"chapter10/page1.png",
+		"chapter2/page10.png",
+		"chapter2/page2.png",
+		"chapter2/figures/fig1.png",
+		"chapter2/figures/deeper/fig2.png",
+		".thumbnails/cover.png",
+		"chapter2/.hidden.png",
+		"chapter2/notes.txt",
+	}
+	for _, name := range files {
+		path := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("fake image data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
 	tests := []struct {
-		bytes int64
-		want  string
+		name string
+		opts LoadOptions
+		want []string
 	}{
-		{0, "0 bytes"},
-		{100, "100 bytes"},
-		{1024, "1.00 KB"},
-		{1536, "1.50 KB"},
-		{1048576, "1.00 MB"},
-		{1572864, "1.50 MB"},
-		{1073741824, "1.00 GB"},
+		{"top level only", LoadOptions{}, []string{"cover.png"}},
+		{"recursive", LoadOptions{Recursive: true}, []string{
+			"cover.png",
+			"chapter2/page2.png",
+			"chapter2/page10.png",
+			"chapter2/figures/fig1.png",
+			"chapter2/figures/deeper/fig2.png",
+			"chapter10/page1.png",
+		}},
+		{"max depth", LoadOptions{Recursive: true, MaxDepth: 1}, []string{
+			"cover.png",
+			"chapter2/page2.png",
+			"chapter2/page10.png",
+			"chapter10/page1.png",
+		}},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.want, func(t *testing.T) {
-			if got := FormatSize(tt.bytes); got != tt.want {
-				t.Errorf("FormatSize(%d) = %v, want %v", tt.bytes, got, tt.want)
+		t.Run(tt.name, func(t *testing.T) {
+			images, err := LoadImagesWithOptions([]string{tmpDir}, tt.opts)
+			if err != nil {
+				t.Fatalf("LoadImagesWithOptions() error = %v", err)
+			}
+			got := make([]string, len(images))
+			for i, img := range images {
+				rel, _ := filepath.Rel(tmpDir, img)
+				got[i] = filepath.ToSlash(rel)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("LoadImagesWithOptions() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
-func TestCheckConfig(t *testing.T) {
-	// Save original env
-	origGemini := os.Getenv("GEMINI_API_KEY")
-	origGoogle := os.Getenv("GOOGLE_API_KEY")
-	defer func() {
-		os.Setenv("GEMINI_API_KEY", origGemini)
-		os.Setenv("GOOGLE_API_KEY", origGoogle)
-	}()
-
-	// Test with key set
-	os.Setenv("GEMINI_API_KEY", "test-key")
-	if err := CheckConfig(); err != nil {
-		t.Errorf("CheckConfig() failed with key set: %v", err)
+func TestExpandBraces(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+		wantErr bool
+	}{
+		{"*.png", []string{"*.png"}, false},
+		{"{*.png,*.jpg}", []string{"*.png", "*.jpg"}, false},
+		{"page_{001..003}.png", []string{"page_001.png", "page_002.png", "page_003.png"}, false},
+		{"p{9..11}.png", []string{"p9.png", "p10.png", "p11.png"}, false},
+		{"p{3..1}", []string{"p3", "p2", "p1"}, false},
+		{"p{0..10..5}", []string{"p0", "p5", "p10"}, false},
+		{"{a..c}.jpg", []string{"a.jpg", "b.jpg", "c.jpg"}, false},
+		{"ch{1,2}/p{1..2}", []string{"ch1/p1", "ch1/p2", "ch2/p1", "ch2/p2"}, false},
+		{"{scans/{a,b},misc}.png", []string{"scans/a.png", "scans/b.png", "misc.png"}, false},
+		{"{x}/{a,b}", []string{"{x}/a", "{x}/b"}, false},
+		{"unclosed{a,b", []string{"unclosed{a,b"}, false},
+		{"p{1..100000}", nil, true},
+		{"{1..100}{1..100}{1..100}", nil, true},
 	}
 
-	// Test with no keys (also unset LLM_ENDPOINT for local LLM)
-	os.Unsetenv("GEMINI_API_KEY")
-	os.Unsetenv("GOOGLE_API_KEY")
-	os.Unsetenv("LLM_ENDPOINT")
-	os.Unsetenv("IMAGE_LLM_ENDPOINT")
-	if err := CheckConfig(); err == nil {
-		t.Error("CheckConfig() should fail with no keys set")
+	for _, tt := range tests {
+		got, err := ExpandBraces(tt.pattern)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ExpandBraces(%q) error = %v, wantErr %v", tt.pattern, err, tt.wantErr)
+			continue
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("ExpandBraces(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
 	}
 }
 
-// Helper function
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr || len(s) > 0 && containsHelper(s, substr))
-}
-
-func containsHelper(s, substr string) bool {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return true
+func TestLoadImages_BracesAndPatterns(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"page_001.png", "page_002.jpg", "page_003.png", "page_011.png", "notes.png"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte("fake image data"), 0644); err != nil {
+			t.Fatal(err)
 		}
 	}
-	return false
+
+	// Missing names in a range are fine as long as something matches
+	images, err := LoadImages([]string{filepath.Join(tmpDir, "page_{001..005}.{png,jpg}")})
+	if err != nil {
+		t.Fatalf("LoadImages() error = %v", err)
+	}
+	var got []string
+	for _, img := range images {
+		got = append(got, filepath.Base(img))
+	}
+	if want := "page_001.png page_002.jpg page_003.png"; strings.Join(got, " ") != want {
+		t.Errorf("LoadImages() = %v, want %s", got, want)
+	}
+
+	sources := SplitPatterns(fmt.Sprintf("%s \"%s\"", filepath.Join(tmpDir, "page_01*.png"), filepath.Join(tmpDir, "notes.png")))
+	if len(sources) != 2 {
+		t.Fatalf("SplitPatterns() = %q, want two sources", sources)
+	}
+	images, err = LoadImages(sources)
+	if err != nil || len(images) != 2 {
+		t.Errorf("LoadImages(%q) = %v, %v", sources, images, err)
+	}
 }
 
-func TestCreateSmartBatches(t *testing.T) {
-	client, _ := NewClient("test-key")
+func TestSplitPatterns(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "My Scans")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
 
 	tests := []struct {
-		name        string
-		imageSizes  []int64 // sizes in bytes
-		wantBatches int
+		input string
+		want  []string
 	}{
-		{
-			name:        "small images fit in one batch",
-			imageSizes:  []int64{100000, 200000, 300000}, // ~600KB total
-			wantBatches: 1,
-		},
-		{
-			name:        "images split by size limit",
-			imageSizes:  []int64{5000000, 5000000, 5000000, 5000000}, // 4x5MB = 20MB
-			wantBatches: 2,                                           // Should split due to payload size limit
-		},
-		{
-			name:        "many small images split by count",
-			imageSizes:  make([]int64, 25), // 25 small images
-			wantBatches: 2,                 // Should split at MaxImagesPerRequest (20)
-		},
-		{
-			name:        "single large image gets own batch",
-			imageSizes:  []int64{100000, 12000000, 100000}, // 100KB, 12MB, 100KB
-			wantBatches: 3,                                 // Large image needs its own batch
-		},
+		{"", nil},
+		{"  *.png  ", []string{"*.png"}},
+		{"*.png ./more/*.jpg", []string{"*.png", "./more/*.jpg"}},
+		{`"a b/*.png" 'c d'`, []string{"a b/*.png", "c d"}},
+		{dir, []string{dir}},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Create mock ImageInfo slice
-			images := make([]*ImageInfo, len(tt.imageSizes))
-			for i, size := range tt.imageSizes {
-				if size == 0 {
-					size = 10000 // Default small size for count test
-				}
-				images[i] = &ImageInfo{
-					Path:      fmt.Sprintf("/fake/image_%d.png", i),
-					Filename:  fmt.Sprintf("image_%d.png", i),
-					Size:      size,
-					PageIndex: i,
-				}
-			}
-
-			batches := client.createSmartBatches(images)
-
-			if len(batches) != tt.wantBatches {
-				t.Errorf("createSmartBatches() created %d batches, want %d", len(batches), tt.wantBatches)
-				for i, batch := range batches {
-					totalSize := int64(0)
-					for _, img := range batch {
-						totalSize += img.Size
-					}
-					t.Logf("  Batch %d: %d images, %d bytes", i, len(batch), totalSize)
-				}
-			}
-
-			// Verify all images are accounted for
-			totalImages := 0
-			for _, batch := range batches {
-				totalImages += len(batch)
-			}
-			if totalImages != len(images) {
-				t.Errorf("Total images in batches = %d, want %d", totalImages, len(images))
-			}
-		})
+		if got := SplitPatterns(tt.input); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("SplitPatterns(%q) = %q, want %q", tt.input, got, tt.want)
+		}
 	}
 }
 
-func TestCreateSmartBatches_PayloadSizeLimit(t *testing.T) {
-	client, _ := NewClient("test-key")
+func TestLoadImages_Zip(t *testing.T) {
+	tmpDir := t.TempDir()
+	archive := filepath.Join(tmpDir, "scans.ZIP")
 
-	// Create images that together exceed MaxPayloadSize
-	// MaxPayloadSize is 15MB, with 1.4x overhead factor
-	// So ~10.7MB of raw images should trigger a split
-	images := []*ImageInfo{
-		{Path: "/fake/1.png", Filename: "1.png", Size: 4000000, PageIndex: 0}, // 4MB
-		{Path: "/fake/2.png", Filename: "2.png", Size: 4000000, PageIndex: 1}, // 4MB
-		{Path: "/fake/3.png", Filename: "3.png", Size: 4000000, PageIndex: 2}, // 4MB -> total ~12MB raw, ~17MB with overhead
-		{Path: "/fake/4.png", Filename: "4.png", Size: 1000000, PageIndex: 3}, // 1MB
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
 	}
+	zw := zip.NewWriter(f)
+	entries := []string{"page10.png", "page2.png", "notes.txt", "__MACOSX/._page2.png", "../escape.png", "sub/", "sub/page1.jpg"}
+	for _, name := range entries {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(name, "/") {
+			w.Write([]byte("fake image data: " + name))
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
 
-	batches := client.createSmartBatches(images)
-
-	// Should create at least 2 batches due to size
-	if len(batches) < 2 {
-		t.Errorf("Expected at least 2 batches for large payload, got %d", len(batches))
+	images, err := LoadImages([]string{archive})
+	if err != nil {
+		t.Fatalf("LoadImages() failed: %v", err)
 	}
+	defer CleanupTempFiles()
 
-	// First batch should not exceed estimated payload limit
-	const overheadFactor = 1.4
-	for i, batch := range batches {
-		totalEstimated := int64(0)
-		for _, img := range batch {
-			totalEstimated += int64(float64(img.Size) * overheadFactor)
+	expected := []string{"escape.png", "page2.png", "page10.png", "sub_page1.jpg"}
+	if len(images) != len(expected) {
+		t.Fatalf("LoadImages() returned %v, want %v", images, expected)
+	}
+	dir := filepath.Dir(images[0])
+	for i, img := range images {
+		if filepath.Base(img) != expected[i] {
+			t.Errorf("LoadImages()[%d] = %v, want %v", i, filepath.Base(img), expected[i])
 		}
-		if totalEstimated > MaxPayloadSize && len(batch) > 1 {
-			t.Errorf("Batch %d estimated size %d exceeds MaxPayloadSize %d", i, totalEstimated, MaxPayloadSize)
+		if filepath.Dir(img) != dir {
+			t.Errorf("LoadImages()[%d] = %v, want it extracted into %s", i, img, dir)
 		}
 	}
-}
+	data, err := os.ReadFile(images[1])
+	if err != nil || string(data) != "fake image data: page2.png" {
+		t.Errorf("extracted page2.png = %q, %v", data, err)
+	}
 
-func TestCreateSmartBatches_PreservesOrder(t *testing.T) {
-	client, _ := NewClient("test-key")
+	CleanupTempFiles()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("CleanupTempFiles() left %s behind (err = %v)", dir, err)
+	}
 
-	// Create 25 images
-	images := make([]*ImageInfo, 25)
-	for i := 0; i < 25; i++ {
-		images[i] = &ImageInfo{
-			Path:      fmt.Sprintf("/fake/page_%02d.png", i+1),
-			Filename:  fmt.Sprintf("page_%02d.png", i+1),
-			Size:      100000,
-			PageIndex: i,
-		}
+	empty := filepath.Join(tmpDir, "empty.zip")
+	f, _ = os.Create(empty)
+	zip.NewWriter(f).Close()
+	f.Close()
+	if _, err := LoadImages([]string{empty}); err == nil {
+		t.Error("LoadImages() on a zip without images should fail")
 	}
 
-	batches := client.createSmartBatches(images)
+	saved := maxZipExtractSize
+	maxZipExtractSize = 40
+	t.Cleanup(func() { maxZipExtractSize = saved })
+	if _, err := LoadImages([]string{archive}); err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Errorf("LoadImages() on a zip over the size limit = %v, want a limit error", err)
+	}
+	CleanupTempFiles()
 
-	// Verify page order is preserved across batches
+	// An entry whose header understates its size still stops at the limit
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if n, err := extractZipEntry(r.File[0], filepath.Join(tmpDir, "out.png"), 5); err == nil || n > 6 {
+		t.Errorf("extractZipEntry() over its limit = %d bytes, %v; want an error within a byte of it", n, err)
+	}
+}
+
+func TestLoadImages_URLs(t *testing.T) {
+	pngHeader := "\x89PNG\r\n\x1a\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/scans/page10.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte(pngHeader + "page10"))
+		case "/presigned":
+			// Object stores often send a generic type; the bytes are sniffed
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte(pngHeader + "page2"))
+		case "/doc.html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html></html>"))
+		case "/huge.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte(pngHeader + strings.Repeat("x", 2048)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	// The URL order wins over the page numbers in the names
+	sources := []string{server.URL + "/scans/page10.png", server.URL + "/presigned?sig=abc"}
+	images, err := LoadImages(sources)
+	if err != nil {
+		t.Fatalf("LoadImages() failed: %v", err)
+	}
+	defer CleanupTempFiles()
+
+	expected := []string{"0001_page10.png", "0002_presigned.png"}
+	if len(images) != len(expected) {
+		t.Fatalf("LoadImages() returned %v, want %v", images, expected)
+	}
+	for i, img := range images {
+		if filepath.Base(img) != expected[i] {
+			t.Errorf("LoadImages()[%d] = %v, want %v", i, filepath.Base(img), expected[i])
+		}
+	}
+	data, err := os.ReadFile(images[1])
+	if err != nil || string(data) != pngHeader+"page2" {
+		t.Errorf("downloaded image = %q, %v", data, err)
+	}
+
+	dir := filepath.Dir(images[0])
+	CleanupTempFiles()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("CleanupTempFiles() left %s behind (err = %v)", dir, err)
+	}
+
+	defer func(size int64) { maxRemoteImageSize = size }(maxRemoteImageSize)
+	maxRemoteImageSize = 1024
+	for _, path := range []string{"/doc.html", "/missing.png", "/huge.png"} {
+		if _, err := LoadImages([]string{server.URL + path}); err == nil {
+			t.Errorf("LoadImages(%s) should fail", path)
+		}
+	}
+}
+
+func TestValidateImages(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Create valid image
+	validPath := filepath.Join(tmpDir, "valid.png")
+	if err := os.WriteFile(validPath, []byte("image data"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// Test valid image
+	if err := ValidateImages([]string{validPath}); err != nil {
+		t.Errorf("ValidateImages() failed for valid image: %v", err)
+	}
+
+	// Test non-existent file
+	if err := ValidateImages([]string{"/nonexistent/file.png"}); err == nil {
+		t.Error("ValidateImages() should fail for non-existent file")
+	}
+
+	// Test invalid extension
+	invalidPath := filepath.Join(tmpDir, "invalid.txt")
+	if err := os.WriteFile(invalidPath, []byte("text"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := ValidateImages([]string{invalidPath}); err == nil {
+		t.Error("ValidateImages() should fail for invalid extension")
+	}
+}
+
+func TestValidateImagesParallel(t *testing.T) {
+	tmpDir := t.TempDir()
+	var paths []string
+	for i := 0; i < 50; i++ {
+		path := filepath.Join(tmpDir, fmt.Sprintf("page%03d.png", i))
+		if err := os.WriteFile(path, []byte("fake png data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	c := &Client{}
+	infos, _, err := c.validateImages(paths)
+	if err != nil {
+		t.Fatalf("validateImages() failed: %v", err)
+	}
+	for i, info := range infos {
+		if info.PageIndex != i || info.Path != paths[i] {
+			t.Fatalf("infos[%d] = {PageIndex: %d, Path: %s}, want input order", i, info.PageIndex, info.Path)
+		}
+	}
+
+	// The earliest failure is reported regardless of which worker finishes first
+	bad := append([]string(nil), paths...)
+	bad[30] = filepath.Join(tmpDir, "missing.png")
+	bad[12] = filepath.Join(tmpDir, "notes.txt")
+	os.WriteFile(bad[12], []byte("text"), 0644)
+	for run := 0; run < 5; run++ {
+		_, failed, err := c.validateImages(bad)
+		if err == nil || failed != 12 {
+			t.Fatalf("validateImages() failed index = %d, err = %v; want 12", failed, err)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{"1048576", 1 << 20, false},
+		{"512K", 512 << 10, false},
+		{"512MB", 512 << 20, false},
+		{"2g", 2 << 30, false},
+		{"1.5GiB", 3 << 29, false},
+		{"0", 0, true},
+		{"lots", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseByteSize(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseByteSize(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseByteSize(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	m := newMemoryLimiter(100)
+	ctx := context.Background()
+
+	first, err := m.acquire(ctx, 60)
+	if err != nil || first != 60 {
+		t.Fatalf("acquire(60) = %d, %v", first, err)
+	}
+
+	// A second reservation that doesn't fit waits for a release
+	acquired := make(chan int64)
+	go func() {
+		n, _ := m.acquire(ctx, 50)
+		acquired <- n
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquire(50) should block while 60 of 100 bytes are held")
+	case <-time.After(50 * time.Millisecond):
+	}
+	m.release(first)
+	select {
+	case n := <-acquired:
+		m.release(n)
+	case <-time.After(time.Second):
+		t.Fatal("acquire(50) did not proceed after release")
+	}
+
+	// Oversized requests are capped at the limit so they can run alone
+	n, err := m.acquire(ctx, 500)
+	if err != nil || n != 100 {
+		t.Fatalf("acquire(500) = %d, %v; want capped at 100", n, err)
+	}
+
+	// Waiting honours cancellation
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := m.acquire(cctx, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("acquire() on a cancelled context = %v, want context.Canceled", err)
+	}
+	m.release(n)
+
+	// A nil limiter never blocks
+	var none *memoryLimiter
+	if n, err := none.acquire(ctx, 1<<40); err != nil || n != 0 {
+		t.Errorf("nil limiter acquire() = %d, %v", n, err)
+	}
+	none.release(0)
+}
+
+func TestWithMemoryLimit_SerializesBatches(t *testing.T) {
+	var inFlight, maxInFlight int
+	var mu sync.Mutex
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		choice := LocalLLMChoice{FinishReason: "stop"}
+		choice.Message.Content = `{"pages": [{"text": "page"}]}`
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(LocalLLMResponse{Choices: []LocalLLMChoice{choice}})
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	var images []string
+	data := []byte(strings.Repeat("x", 1000))
+	for i := 0; i < 6; i++ {
+		path := filepath.Join(tmpDir, fmt.Sprintf("page%d.png", i))
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, path)
+	}
+
+	// One page per batch for local models; a budget of one batch's estimate
+	// forces the parallel path to run them one at a time
+	client, _ := NewLocalClient(server.URL, "test-model", WithMemoryLimit(int64(len(data))*batchMemoryFactor))
+	if _, err := client.TranscribeImages(context.Background(), &TranscribeRequest{Images: images}); err != nil {
+		t.Fatalf("TranscribeImages() failed: %v", err)
+	}
+	if maxInFlight != 1 {
+		t.Errorf("max concurrent batches = %d, want 1 under the memory limit", maxInFlight)
+	}
+}
+
+func TestProviderFallbackFromEnv(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []Provider
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"local,gemini", []Provider{ProviderLocal, ProviderGemini}, false},
+		{" Gemini , azure, gemini,", []Provider{ProviderGemini, ProviderAzureAnthropic}, false},
+		{"anthropic,azure_anthropic", []Provider{ProviderAnthropic, ProviderAzureAnthropic}, false},
+		{"local,openai", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Setenv(ProviderFallbackEnvVar, tt.value)
+		got, err := ProviderFallbackFromEnv()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%q: chain = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestNewClientFromEnv_Anthropic(t *testing.T) {
+	var gotPath, gotKey string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotKey = r.URL.Path, r.Header.Get("X-Api-Key")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":          "msg_test",
+			"type":        "message",
+			"role":        "assistant",
+			"model":       DefaultAnthropicModel,
+			"content":     []map[string]string{{"type": "text", "text": `{"pages": [{"page_number": 1, "text": "ok"}]}`}},
+			"stop_reason": "end_turn",
+			"usage":       map[string]int{"input_tokens": 10, "output_tokens": 10},
+		})
+	}))
+	defer server.Close()
+
+	t.Setenv(ProviderFallbackEnvVar, "")
+	t.Setenv("LLM_ENDPOINT", "")
+	t.Setenv("IMAGE_LLM_ENDPOINT", "")
+	t.Setenv("AZURE_ANTHROPIC_ENDPOINT", "")
+	t.Setenv("GEMINI_API_KEY", "test-gemini-key")
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-test")
+	t.Setenv("ANTHROPIC_MODEL", "")
+	t.Setenv("ANTHROPIC_BASE_URL", "")
+
+	// Gemini keeps precedence; LLM_PROVIDER picks Anthropic, at the public API
+	t.Setenv("LLM_PROVIDER", "")
+	if got := GetProvider(); got != ProviderGemini {
+		t.Errorf("GetProvider() = %s, want %s", got, ProviderGemini)
+	}
+	t.Setenv("GEMINI_API_KEY", "")
+	if err := CheckConfig(); err != nil {
+		t.Errorf("CheckConfig() failed with ANTHROPIC_API_KEY set: %v", err)
+	}
+	t.Setenv("GEMINI_API_KEY", "test-gemini-key")
+	t.Setenv("LLM_PROVIDER", "anthropic")
+	client, err := NewClientFromEnv()
+	if err != nil {
+		t.Fatalf("NewClientFromEnv() failed: %v", err)
+	}
+	if client.provider != ProviderAnthropic || client.baseURL != DefaultAnthropicBaseURL || client.model != DefaultAnthropicModel {
+		t.Errorf("client = %s at %s with %s, want anthropic at %s with %s", client.provider, client.baseURL, client.model, DefaultAnthropicBaseURL, DefaultAnthropicModel)
+	}
+
+	// ANTHROPIC_BASE_URL redirects the requests, which go through the Claude path
+	t.Setenv("ANTHROPIC_BASE_URL", server.URL)
+	client, err = NewClientForProviderFromEnv(ProviderAnthropic)
+	if err != nil {
+		t.Fatalf("NewClientForProviderFromEnv(anthropic) failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "page1.png")
+	writeTestImage(t, path, 10, 10)
+	resp, err := client.TranscribeImages(context.Background(), &TranscribeRequest{Images: []string{path}})
+	if err != nil {
+		t.Fatalf("TranscribeImages() failed: %v", err)
+	}
+	if len(resp.Pages) != 1 || resp.Pages[0].Text != "ok" {
+		t.Errorf("pages = %+v, want one page reading ok", resp.Pages)
+	}
+	if gotPath != "/v1/messages" || gotKey != "sk-ant-test" {
+		t.Errorf("request = %s with key %q, want /v1/messages with the ANTHROPIC_API_KEY", gotPath, gotKey)
+	}
+
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	if _, err := NewClientForProviderFromEnv(ProviderAnthropic); err == nil {
+		t.Error("NewClientForProviderFromEnv(anthropic) should fail without ANTHROPIC_API_KEY")
+	}
+}
+
+func TestNewClientFromEnv_FallbackChain(t *testing.T) {
+	t.Setenv(ProviderFallbackEnvVar, "local,gemini")
+	t.Setenv("LLM_ENDPOINT", "")
+	t.Setenv("IMAGE_LLM_ENDPOINT", "")
+	t.Setenv("GOOGLE_API_KEY", "")
+	t.Setenv("GEMINI_API_KEY", "test-key")
+
+	// The local LLM isn't configured, so Gemini becomes the primary
+	client, err := NewClientFromEnv()
+	if err != nil {
+		t.Fatalf("NewClientFromEnv() failed: %v", err)
+	}
+	if client.provider != ProviderGemini || len(client.fallbacks) != 0 {
+		t.Errorf("client = %s with %d fallbacks, want gemini with none", client.provider, len(client.fallbacks))
+	}
+
+	t.Setenv("LLM_ENDPOINT", "http://localhost:1234")
+	client, err = NewClientFromEnv()
+	if err != nil {
+		t.Fatalf("NewClientFromEnv() failed: %v", err)
+	}
+	if client.provider != ProviderLocal || len(client.fallbacks) != 1 || client.fallbacks[0].provider != ProviderGemini {
+		t.Errorf("client = %s with fallbacks %v, want local then gemini", client.provider, client.fallbacks)
+	}
+
+	t.Setenv("LLM_ENDPOINT", "")
+	t.Setenv("GEMINI_API_KEY", "")
+	if _, err := NewClientFromEnv(); err == nil || !strings.Contains(err.Error(), ProviderFallbackEnvVar) {
+		t.Errorf("NewClientFromEnv() with nothing configured = %v, want an error naming %s", err, ProviderFallbackEnvVar)
+	}
+}
+
+func TestTranscribeImages_ProviderFallback(t *testing.T) {
+	var primaryCalls int
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryCalls++
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	var fallbackCalls int
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbackCalls++
+		choice := LocalLLMChoice{FinishReason: "stop"}
+		choice.Message.Content = `{"pages": [{"text": "page"}]}`
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(LocalLLMResponse{Choices: []LocalLLMChoice{choice}})
+	}))
+	defer fallback.Close()
+
+	tmpDir := t.TempDir()
+	var images []string
+	for i := 0; i < 3; i++ {
+		path := filepath.Join(tmpDir, fmt.Sprintf("page%d.png", i))
+		if err := os.WriteFile(path, []byte("fake png data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, path)
+	}
+
+	local, _ := NewLocalClient(fallback.URL, "test-model")
+	client, _ := NewClient("test-key", WithBaseURL(primary.URL), WithFallback(local))
+
+	var warned bool
+	resp, err := client.TranscribeImagesWithProgress(context.Background(), &TranscribeRequest{Images: images}, func(u ProgressUpdate) {
+		if u.Status == StatusWarning && strings.HasPrefix(u.Message, "Falling back") {
+			warned = true
+		}
+	})
+	if err != nil {
+		t.Fatalf("TranscribeImages() failed: %v", err)
+	}
+
+	// Gemini sends one batch; the local fallback takes it one image at a time
+	if primaryCalls != 1 || fallbackCalls != 3 {
+		t.Errorf("calls = %d primary, %d fallback; want 1 and 3", primaryCalls, fallbackCalls)
+	}
+	if len(resp.Pages) != 3 {
+		t.Errorf("got %d pages, want 3", len(resp.Pages))
+	}
+	if fmt.Sprint(resp.BatchProviders) != "[local]" {
+		t.Errorf("BatchProviders = %v, want [local]", resp.BatchProviders)
+	}
+	if fmt.Sprint(resp.BatchModels) != "[test-model]" {
+		t.Errorf("BatchModels = %v, want the fallback's [test-model]", resp.BatchModels)
+	}
+	if !warned {
+		t.Error("expected a fallback warning progress update")
+	}
+
+	// Without a working fallback the original error is kept
+	shortenRetryBackoff(t)
+	broken, _ := NewLocalClient(primary.URL, "test-model")
+	client, _ = NewClient("test-key", WithBaseURL(primary.URL), WithFallback(broken))
+	if _, err := client.TranscribeImages(context.Background(), &TranscribeRequest{Images: images}); err == nil || !strings.Contains(err.Error(), "local fallback") {
+		t.Errorf("TranscribeImages() error = %v, want both failures reported", err)
+	}
+}
+
+func TestProviderSummary(t *testing.T) {
+	tests := []struct {
+		providers []Provider
+		want      string
+	}{
+		{nil, ""},
+		{[]Provider{ProviderLocal, ProviderLocal}, ""},
+		{[]Provider{ProviderLocal, ProviderGemini, ProviderLocal, ""}, "local: 2 batches, gemini: 1 batch"},
+	}
+
+	for _, tt := range tests {
+		resp := &TranscribeResponse{BatchProviders: tt.providers}
+		if got := resp.ProviderSummary(); got != tt.want {
+			t.Errorf("ProviderSummary(%v) = %q, want %q", tt.providers, got, tt.want)
+		}
+	}
+}
+
+func TestTranscribeImages_CancelsSiblingsOnFailure(t *testing.T) {
+	var mu sync.Mutex
+	var requests, cancelled int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Drain the body so the server notices when the client goes away
+		io.Copy(io.Discard, r.Body)
+
+		mu.Lock()
+		requests++
+		first := requests == 1
+		mu.Unlock()
+
+		if first {
+			// Let the siblings get in flight before failing
+			time.Sleep(50 * time.Millisecond)
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			mu.Lock()
+			cancelled++
+			mu.Unlock()
+		case <-time.After(5 * time.Second):
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	var images []string
+	for i := 0; i < 6; i++ {
+		path := filepath.Join(tmpDir, fmt.Sprintf("page%d.png", i))
+		if err := os.WriteFile(path, []byte("fake png data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, path)
+	}
+
+	// One page per batch for local models, so six batches share three workers
+	client, _ := NewLocalClient(server.URL, "test-model")
+	start := time.Now()
+	_, err := client.TranscribeImages(context.Background(), &TranscribeRequest{Images: images})
+	if err == nil {
+		t.Fatal("TranscribeImages() should fail when a batch fails")
+	}
+	if errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want the failing batch's error rather than a sibling's cancellation", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("TranscribeImages() took %s; in-flight siblings should be cancelled", elapsed)
+	}
+
+	// Wait for the handlers to observe the disconnects
+	server.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requests > MaxConcurrentRequests {
+		t.Errorf("%d requests sent; queued batches should not start after a failure", requests)
+	}
+	if cancelled == 0 {
+		t.Error("expected in-flight sibling requests to be cancelled")
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	err := &APIError{
+		StatusCode: 400,
+		Message:    "Bad Request",
+		Details:    "Invalid parameter",
+	}
+
+	expected := "Bad Request: Invalid parameter"
+	if err.Error() != expected {
+		t.Errorf("APIError.Error() = %v, want %v", err.Error(), expected)
+	}
+
+	err2 := &APIError{
+		StatusCode: 401,
+		Message:    "Unauthorized",
+	}
+	if err2.Error() != "Unauthorized" {
+		t.Errorf("APIError.Error() = %v, want Unauthorized", err2.Error())
+	}
+}
+
+func TestTranscribeRequest_Validation(t *testing.T) {
+	client, _ := NewClient("test-key")
+
+	// Test empty images
+	_, err := client.TranscribeImages(context.Background(), &TranscribeRequest{
+		Images: []string{},
+	})
+	if err == nil {
+		t.Error("TranscribeImages() should fail with empty images")
+	}
+
+	// Test too many images
+	manyImages := make([]string, MaxTotalImages+1)
+	for i := range manyImages {
+		manyImages[i] = "/fake/image.png"
+	}
+	_, err = client.TranscribeImages(context.Background(), &TranscribeRequest{
+		Images: manyImages,
+	})
+	if err == nil {
+		t.Error("TranscribeImages() should fail with too many images")
+	}
+}
+
+func TestGenerateContent_MockServer(t *testing.T) {
+	// Create mock server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Verify request
+		if r.Method != "POST" {
+			t.Errorf("Expected POST, got %s", r.Method)
+		}
+
+		// Return mock response
+		resp := GenerateContentResponse{
+			Candidates: []*Candidate{
+				{
+					Content: &Content{
+						Parts: []*Part{
+							{Text: `{"pages": [{"page_number": 1, "text": "Test content", "has_heading": false}]}`},
+						},
+					},
+					FinishReason: "STOP",
+				},
+			},
+			UsageMetadata: &UsageMetadata{
+				PromptTokenCount:     100,
+				CandidatesTokenCount: 50,
+				TotalTokenCount:      150,
+			},
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client, _ := NewClient("test-key", WithBaseURL(server.URL))
+
+	// Create test image
+	tmpDir := t.TempDir()
+	imgPath := filepath.Join(tmpDir, "test.png")
+	if err := os.WriteFile(imgPath, []byte("fake png data"), 0644); err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+
+	// Make request
+	resp, err := client.TranscribeImages(context.Background(), &TranscribeRequest{
+		Images: []string{imgPath},
+	})
+
+	if err != nil {
+		t.Fatalf("TranscribeImages() failed: %v", err)
+	}
+
+	if resp.TokensUsed != 150 {
+		t.Errorf("TokensUsed = %d, want 150", resp.TokensUsed)
+	}
+
+	if len(resp.Documents) == 0 {
+		t.Error("Expected at least one document")
+	}
+
+	if len(resp.Pages) != 1 || resp.Pages[0].Text != "Test content" {
+		t.Errorf("Pages = %+v, want the raw page content", resp.Pages)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+	}{
+		{"empty", "", 0},
+		{"seconds", "30", 30 * time.Second},
+		{"seconds with spaces", " 7 ", 7 * time.Second},
+		{"zero seconds", "0", 0},
+		{"negative seconds", "-5", 0},
+		{"http date", now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{"http date in the past", now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"garbage", "soon", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.header, now); got != tt.want {
+				t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateContent_RetryAfterOnAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "12")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error": {"code": 429, "message": "quota exceeded", "status": "RESOURCE_EXHAUSTED"}}`))
+	}))
+	defer server.Close()
+
+	client, _ := NewClient("test-key", WithBaseURL(server.URL))
+	imgPath := filepath.Join(t.TempDir(), "test.png")
+	if err := os.WriteFile(imgPath, []byte("fake png data"), 0644); err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+
+	_, err := client.TranscribeImages(context.Background(), &TranscribeRequest{Images: []string{imgPath}, MaxBatchRetries: NoBatchRetries})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("TranscribeImages() error = %v, want an *APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusTooManyRequests || apiErr.RetryAfter != 12*time.Second {
+		t.Errorf("APIError = %+v, want status 429 with RetryAfter 12s", apiErr)
+	}
+}
+
+func TestTranscribeWithRetry_HonorsRetryAfter(t *testing.T) {
+	var mu sync.Mutex
+	var calls []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, time.Now())
+		n := len(calls)
+		mu.Unlock()
+
+		if n == 1 {
+			// Local servers often return plain-text errors
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte("rate limited"))
+			return
+		}
+		json.NewEncoder(w).Encode(LocalLLMResponse{
+			Choices: []LocalLLMChoice{{Message: LocalLLMChoiceMessage{Content: `{"pages": [{"page_number": 1, "text": "ok"}]}`}}},
+		})
+	}))
+	defer server.Close()
+
+	client, err := NewLocalClient(server.URL, "test-model")
+	if err != nil {
+		t.Fatalf("NewLocalClient() failed: %v", err)
+	}
+	imgPath := filepath.Join(t.TempDir(), "test.png")
+	if err := os.WriteFile(imgPath, []byte("fake png data"), 0644); err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+
+	resp, err := client.TranscribeWithRetry(context.Background(), &TranscribeRequest{Images: []string{imgPath}, MaxBatchRetries: NoBatchRetries}, 1)
+	if err != nil {
+		t.Fatalf("TranscribeWithRetry() failed: %v", err)
+	}
+	if len(resp.Pages) != 1 || resp.Pages[0].Text != "ok" {
+		t.Errorf("Pages = %+v, want the retried page", resp.Pages)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) != 2 {
+		t.Fatalf("server saw %d requests, want 2", len(calls))
+	}
+	// The 1s Retry-After replaces the 2s first step of the backoff schedule
+	if gap := calls[1].Sub(calls[0]); gap < time.Second || gap >= 2*time.Second {
+		t.Errorf("retry came after %v, want about 1s", gap)
+	}
+}
+
+func TestStyleGuidePrompts(t *testing.T) {
+	guide := "Use sentence case headings\n\n- Keep code fences with language hints\n2. Spell out numbers under ten"
+	wantRules := []string{
+		"   - Use sentence case headings\n",
+		"   - Keep code fences with language hints\n",
+		"   - Spell out numbers under ten\n",
+	}
+	images := []*ImageInfo{{PageIndex: 0}}
+	pages := []*PageContent{{PageNumber: 1, Text: "raw"}}
+
+	single, _ := NewLocalClient("http://localhost:1234", "vision")
+	twoStage, _ := NewLocalClient("http://localhost:1234", "vision", WithTextModel("text"))
+
+	tests := []struct {
+		name   string
+		prompt string
+		want   bool
+	}{
+		{"refinement", twoStage.buildTextRefinementPrompt(pages, &TranscribeRequest{StyleGuide: guide}), true},
+		{"extraction without refinement", single.buildExtractionPrompt(images, &TranscribeRequest{StyleGuide: guide}), true},
+		{"extraction before refinement", twoStage.buildExtractionPrompt(images, &TranscribeRequest{StyleGuide: guide}), false},
+		{"extraction opted in", twoStage.buildExtractionPrompt(images, &TranscribeRequest{StyleGuide: guide, StyleGuideInVision: true}), true},
+		{"unset", twoStage.buildTextRefinementPrompt(pages, &TranscribeRequest{}), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, rule := range wantRules {
+				if strings.Contains(tt.prompt, rule) != tt.want {
+					t.Errorf("prompt contains %q = %v, want %v:\n%s", rule, !tt.want, tt.want, tt.prompt)
+				}
+			}
+		})
+	}
+
+	if p := single.buildLocalLLMPrompt(images, &TranscribeRequest{StyleGuide: guide}); !strings.Contains(p, "  - Use sentence case headings\n") {
+		t.Errorf("local prompt is missing the style guide:\n%s", p)
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	tests := []struct {
+		name        string
+		models      string // /v1/models body; empty means 404
+		probeStatus int
+		probeReply  string
+		wantVision  VisionSupport
+		wantListed  bool
+		wantWarns   int
+		wantProbe   bool
+	}{
+		{
+			name:       "listed as vision model",
+			models:     `{"data":[{"id":"vision","type":"vlm"}]}`,
+			wantVision: VisionSupported,
+			wantListed: true,
+		},
+		{
+			name:       "listed as text model",
+			models:     `{"data":[{"id":"vision","type":"llm"}]}`,
+			wantVision: VisionUnsupported,
+			wantListed: true,
+			wantWarns:  1,
+		},
+		{
+			name:       "capabilities without vision",
+			models:     `{"data":[{"id":"vision","capabilities":["completion"]}]}`,
+			wantVision: VisionUnsupported,
+			wantListed: true,
+			wantWarns:  1,
+		},
+		{
+			name:        "probe reads the image",
+			models:      `{"data":[{"id":"vision"}]}`,
+			probeStatus: http.StatusOK,
+			probeReply:  "Red.",
+			wantVision:  VisionSupported,
+			wantListed:  true,
+			wantProbe:   true,
+		},
+		{
+			name:        "probe misreads the image",
+			probeStatus: http.StatusOK,
+			probeReply:  "I cannot see any image.",
+			wantVision:  VisionUnsupported,
+			wantListed:  true,
+			wantWarns:   1,
+			wantProbe:   true,
+		},
+		{
+			name:        "red only inside another word",
+			probeStatus: http.StatusOK,
+			probeReply:  "I cannot read images.",
+			wantVision:  VisionUnsupported,
+			wantListed:  true,
+			wantWarns:   1,
+			wantProbe:   true,
+		},
+		{
+			name:        "server rejects the image",
+			probeStatus: http.StatusBadRequest,
+			probeReply:  `{"error":"model does not support image input"}`,
+			wantVision:  VisionUnsupported,
+			wantListed:  true,
+			wantWarns:   1,
+			wantProbe:   true,
+		},
+		{
+			name:        "model not loaded",
+			models:      `{"data":[{"id":"other"}]}`,
+			probeStatus: http.StatusInternalServerError,
+			probeReply:  "model not found",
+			wantVision:  VisionUnknown,
+			wantListed:  false,
+			wantWarns:   1,
+			wantProbe:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probed := false
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v1/models":
+					if tt.models == "" {
+						http.NotFound(w, r)
+						return
+					}
+					w.Write([]byte(tt.models))
+				case "/v1/chat/completions":
+					probed = true
+					if tt.probeStatus != http.StatusOK {
+						w.WriteHeader(tt.probeStatus)
+						w.Write([]byte(tt.probeReply))
+						return
+					}
+					json.NewEncoder(w).Encode(LocalLLMResponse{
+						Choices: []LocalLLMChoice{{Message: LocalLLMChoiceMessage{Content: tt.probeReply}}},
+					})
+				}
+			}))
+			defer server.Close()
+
+			client, _ := NewLocalClient(server.URL, "vision")
+			result, err := client.Preflight(context.Background())
+			if err != nil {
+				t.Fatalf("Preflight() error = %v", err)
+			}
+			if result.Vision != tt.wantVision {
+				t.Errorf("Vision = %v, want %v", result.Vision, tt.wantVision)
+			}
+			if result.ModelListed != tt.wantListed {
+				t.Errorf("ModelListed = %v, want %v", result.ModelListed, tt.wantListed)
+			}
+			if len(result.Warnings) != tt.wantWarns {
+				t.Errorf("Warnings = %q, want %d", result.Warnings, tt.wantWarns)
+			}
+			if probed != tt.wantProbe {
+				t.Errorf("probed = %v, want %v", probed, tt.wantProbe)
+			}
+		})
+	}
+}
+
+func TestPreflight_Unreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+
+	client, _ := NewLocalClient(server.URL, "vision")
+	if _, err := client.Preflight(context.Background()); err == nil {
+		t.Error("Preflight() succeeded against a closed server")
+	}
+
+	cloud, _ := NewClient("key")
+	result, err := cloud.Preflight(context.Background())
+	if err != nil || result.Vision != VisionSupported {
+		t.Errorf("Preflight() for Gemini = %+v, %v", result, err)
+	}
+}
+
+func TestListModels(t *testing.T) {
+	t.Run("gemini pages and filters", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("key") != "test-key" {
+				t.Errorf("missing API key in %s", r.URL)
+			}
+			if r.URL.Query().Get("pageToken") == "" {
+				w.Write([]byte(`{"models":[
+					{"name":"models/gemini-2.0-flash","displayName":"Gemini 2.0 Flash","inputTokenLimit":1048576,"outputTokenLimit":8192,"supportedGenerationMethods":["generateContent"]},
+					{"name":"models/text-embedding-004","supportedGenerationMethods":["embedContent"]}
+				],"nextPageToken":"next"}`))
+				return
+			}
+			w.Write([]byte(`{"models":[{"name":"models/gemini-2.5-pro","supportedGenerationMethods":["generateContent","countTokens"]}]}`))
+		}))
+		defer server.Close()
+
+		client, _ := NewClient("test-key", WithBaseURL(server.URL))
+		models, err := client.ListModels(context.Background())
+		if err != nil {
+			t.Fatalf("ListModels() error = %v", err)
+		}
+		if len(models) != 2 || models[0].ID != "gemini-2.0-flash" || models[1].ID != "gemini-2.5-pro" {
+			t.Fatalf("ListModels() = %+v", models)
+		}
+		if models[0].Name != "Gemini 2.0 Flash" || models[0].Details != "in 1M / out 8K tokens" {
+			t.Errorf("ListModels()[0] = %+v", models[0])
+		}
+	})
+
+	t.Run("local falls back to ollama tags", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/tags" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(`{"models":[
+				{"name":"llava:13b","size":8000000000,"details":{"family":"llama","parameter_size":"13B","quantization_level":"Q4_0"}},
+				{"name":"bakllava"}
+			]}`))
+		}))
+		defer server.Close()
+
+		client, _ := NewLocalClient(server.URL, "llava")
+		models, err := client.ListModels(context.Background())
+		if err != nil {
+			t.Fatalf("ListModels() error = %v", err)
+		}
+		if len(models) != 2 || models[0].ID != "bakllava" || models[1].ID != "llava:13b" {
+			t.Fatalf("ListModels() = %+v", models)
+		}
+		if !strings.HasPrefix(models[1].Details, "llama, 13B, Q4_0, ") {
+			t.Errorf("Details = %q", models[1].Details)
+		}
+	})
+
+	t.Run("local openai models", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"data":[{"id":"qwen2.5-vl-7b","type":"vlm"}]}`))
+		}))
+		defer server.Close()
+
+		client, _ := NewLocalClient(server.URL, "qwen2.5-vl-7b")
+		models, err := client.ListModels(context.Background())
+		if err != nil || len(models) != 1 || models[0].ID != "qwen2.5-vl-7b" || models[0].Details != "vlm" {
+			t.Errorf("ListModels() = %+v, %v", models, err)
+		}
+	})
+
+	t.Run("azure anthropic static list", func(t *testing.T) {
+		client, _ := NewAzureAnthropicClient("https://example.azure.com", "key", "")
+		models, err := client.ListModels(context.Background())
+		if err != nil || len(models) != len(KnownAnthropicModels) {
+			t.Errorf("ListModels() = %d models, %v", len(models), err)
+		}
+	})
+}
+
+func TestLoadStyleGuide(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	guide, err := LoadStyleGuide(write("style.md", "\n Use sentence case headings \n"))
+	if err != nil || guide != "Use sentence case headings" {
+		t.Errorf("LoadStyleGuide() = %q, %v", guide, err)
+	}
+	if _, err := LoadStyleGuide(write("empty.md", " \n\n")); err == nil {
+		t.Error("LoadStyleGuide() accepted an empty file")
+	}
+	if _, err := LoadStyleGuide(write("huge.md", strings.Repeat("x", MaxStyleGuideSize+1))); err == nil {
+		t.Error("LoadStyleGuide() accepted an oversized file")
+	}
+	if _, err := LoadStyleGuide(filepath.Join(dir, "missing.md")); err == nil {
+		t.Error("LoadStyleGuide() accepted a missing file")
+	}
+}
+
+func TestOutputTokenBudget(t *testing.T) {
+	tests := []struct {
+		name        string
+		provider    Provider
+		requested   int
+		want        int
+		wantClamped bool
+	}{
+		{"gemini default", ProviderGemini, 0, DefaultMaxOutputTokens, false},
+		{"gemini custom", ProviderGemini, 16000, 16000, false},
+		{"gemini over ceiling", ProviderGemini, 100000, GeminiMaxOutputTokens, true},
+		{"local over ceiling", ProviderLocal, 50000, LocalMaxOutputTokens, true},
+		{"anthropic over ceiling", ProviderAzureAnthropic, 20000, AnthropicMaxOutputTokens, true},
+		{"negative uses default", ProviderLocal, -5, DefaultMaxOutputTokens, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{provider: tt.provider}
+			got, clamped := c.outputTokenBudget(&TranscribeRequest{MaxOutputTokens: tt.requested})
+			if got != tt.want || clamped != tt.wantClamped {
+				t.Errorf("outputTokenBudget(%d) = (%d, %v), want (%d, %v)", tt.requested, got, clamped, tt.want, tt.wantClamped)
+			}
+		})
+	}
+}
+
+func TestTranscribeImages_RefinementFailureWarns(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req LocalLLMRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		if req.Model == "text" {
+			http.Error(w, "text model crashed", http.StatusInternalServerError)
+			return
+		}
+
+		choice := LocalLLMChoice{FinishReason: "stop"}
+		choice.Message.Content = `{"pages": [{"text": "Vision page"}]}`
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(LocalLLMResponse{Choices: []LocalLLMChoice{choice}})
+	}))
+	defer server.Close()
+
+	client, _ := NewLocalClient(server.URL, "vision", WithTextModel("text"))
+
+	imgPath := filepath.Join(t.TempDir(), "test.png")
+	if err := os.WriteFile(imgPath, []byte("fake png data"), 0644); err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+
+	var warning *ProgressUpdate
+	resp, err := client.TranscribeImagesWithProgress(context.Background(), &TranscribeRequest{
+		Images: []string{imgPath},
+	}, func(update ProgressUpdate) {
+		if update.Status == StatusWarning {
+			warning = &update
+		}
+	})
+	if err != nil {
+		t.Fatalf("refinement failure should not fail the job: %v", err)
+	}
+
+	if warning == nil {
+		t.Fatal("expected a warning progress update")
+	}
+	if warning.Message != "Text refinement failed, using vision output" || warning.Error == nil {
+		t.Errorf("warning = %q (error %v)", warning.Message, warning.Error)
+	}
+	if !contains(warning.Detail, "500") {
+		t.Errorf("warning detail %q should carry the underlying error", warning.Detail)
+	}
+	if resp.RefinementFailures != 1 || resp.RefinementSummary() != "1 of 1 batch" {
+		t.Errorf("RefinementFailures = %d, summary %q", resp.RefinementFailures, resp.RefinementSummary())
+	}
+	if len(resp.Documents) == 0 || !contains(resp.Documents[0].Content, "Vision page") {
+		t.Error("expected the vision output to be kept")
+	}
+}
+
+func TestTranscribeImages_TruncatedOutputRetry(t *testing.T) {
+	var maxTokensSeen []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req LocalLLMRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		maxTokensSeen = append(maxTokensSeen, req.MaxTokens)
+
+		choice := LocalLLMChoice{FinishReason: "stop"}
+		choice.Message.Content = `{"pages": [{"text": "Full page"}]}`
+		if len(maxTokensSeen) == 1 {
+			choice.FinishReason = "length"
+			choice.Message.Content = `{"pages": [{"text": "Part`
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(LocalLLMResponse{Choices: []LocalLLMChoice{choice}})
+	}))
+	defer server.Close()
+
+	client, _ := NewLocalClient(server.URL, "test-model")
+
+	tmpDir := t.TempDir()
+	imgPath := filepath.Join(tmpDir, "test.png")
+	if err := os.WriteFile(imgPath, []byte("fake png data"), 0644); err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+
+	var warnings int
+	resp, err := client.TranscribeImagesWithProgress(context.Background(), &TranscribeRequest{
+		Images: []string{imgPath},
+	}, func(update ProgressUpdate) {
+		if update.Status == StatusWarning {
+			warnings++
+		}
+	})
+	if err != nil {
+		t.Fatalf("TranscribeImagesWithProgress() failed: %v", err)
+	}
+
+	if len(maxTokensSeen) != 2 || maxTokensSeen[0] != DefaultMaxOutputTokens || maxTokensSeen[1] != DefaultMaxOutputTokens*2 {
+		t.Errorf("max_tokens per attempt = %v, want [%d %d]", maxTokensSeen, DefaultMaxOutputTokens, DefaultMaxOutputTokens*2)
+	}
+	if warnings != 1 {
+		t.Errorf("warnings = %d, want 1", warnings)
+	}
+	if len(resp.Documents) == 0 || !contains(resp.Documents[0].Content, "Full page") {
+		t.Error("expected content from the retried request")
+	}
+}
+
+func TestTranscribeImages_PartialOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests > 1 {
+			// Cancel while the second batch is in flight
+			cancel()
+			select {
+			case <-r.Context().Done():
+			case <-done:
+			}
+			return
+		}
+
+		choice := LocalLLMChoice{FinishReason: "stop"}
+		choice.Message.Content = `{"pages": [{"text": "First page"}]}`
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(LocalLLMResponse{Choices: []LocalLLMChoice{choice}})
+	}))
+	defer server.Close()
+	defer close(done)
+
+	client, _ := NewLocalClient(server.URL, "test-model")
+
+	tmpDir := t.TempDir()
+	var images []string
+	for _, name := range []string{"page1.png", "page2.png"} {
+		imgPath := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(imgPath, []byte("fake png data"), 0644); err != nil {
+			t.Fatalf("Failed to create test image: %v", err)
+		}
+		images = append(images, imgPath)
+	}
+
+	resp, err := client.TranscribeImagesWithProgress(ctx, &TranscribeRequest{Images: images}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if resp == nil || !resp.Partial {
+		t.Fatalf("expected partial response, got %+v", resp)
+	}
+	if resp.CompletedPages != 1 || resp.TotalPages != 2 {
+		t.Errorf("CompletedPages/TotalPages = %d/%d, want 1/2", resp.CompletedPages, resp.TotalPages)
+	}
+	if len(resp.Documents) == 0 || !contains(resp.Documents[0].Content, "First page") {
+		t.Error("expected content from the completed batch")
+	}
+}
+
+func TestSuggestTitle(t *testing.T) {
+	tmpDir := t.TempDir()
+	imgPath := filepath.Join(tmpDir, "frame_01.jpg")
+	if err := os.WriteFile(imgPath, []byte("fake jpg data"), 0644); err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+
+	t.Run("gemini", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req GenerateContentRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("failed to decode request: %v", err)
+			}
+			if len(req.Contents) != 1 || len(req.Contents[0].Parts) != 2 {
+				t.Errorf("expected one image part and one prompt part, got %+v", req.Contents)
+			}
+			resp := GenerateContentResponse{
+				Candidates: []*Candidate{{
+					Content: &Content{Parts: []*Part{{Text: "\"Capybara Eats Watermelon.\"\n"}}},
+				}},
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(resp)
+		}))
+		defer server.Close()
+
+		client, _ := NewClient("test-key", WithBaseURL(server.URL))
+		title, err := client.SuggestTitle(context.Background(), []string{imgPath})
+		if err != nil {
+			t.Fatalf("SuggestTitle() failed: %v", err)
+		}
+		if title != "Capybara Eats Watermelon" {
+			t.Errorf("title = %q, want %q", title, "Capybara Eats Watermelon")
+		}
+		if got := SanitizeFilename(title); got != "capybara_eats_watermelon" {
+			t.Errorf("SanitizeFilename(%q) = %q", title, got)
+		}
+	})
+
+	t.Run("local", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			choice := LocalLLMChoice{FinishReason: "stop"}
+			choice.Message.Content = "Sunset Over the Lake\nThis clip shows..."
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(LocalLLMResponse{Choices: []LocalLLMChoice{choice}})
+		}))
+		defer server.Close()
+
+		client, _ := NewLocalClient(server.URL, "test-model")
+		title, err := client.SuggestTitle(context.Background(), []string{imgPath})
+		if err != nil {
+			t.Fatalf("SuggestTitle() failed: %v", err)
+		}
+		if title != "Sunset Over the Lake" {
+			t.Errorf("title = %q, want %q", title, "Sunset Over the Lake")
+		}
+	})
+
+	t.Run("empty reply", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			choice := LocalLLMChoice{FinishReason: "stop"}
+			choice.Message.Content = "  \"\"  "
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(LocalLLMResponse{Choices: []LocalLLMChoice{choice}})
+		}))
+		defer server.Close()
+
+		client, _ := NewLocalClient(server.URL, "test-model")
+		if _, err := client.SuggestTitle(context.Background(), []string{imgPath}); err == nil {
+			t.Error("expected an error for an empty title")
+		}
+	})
+
+	t.Run("no frames", func(t *testing.T) {
+		client, _ := NewClient("test-key")
+		if _, err := client.SuggestTitle(context.Background(), nil); err == nil {
+			t.Error("expected an error without frames")
+		}
+	})
+}
+
+func TestCleanTitle(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"Simple Title", "Simple Title"},
+		{"  \"Quoted Title!\"  ", "Quoted Title"},
+		{"**Bold Title**", "Bold Title"},
+		{"First Line\nSecond line", "First Line"},
+		{strings.Repeat("a", 80), strings.Repeat("a", MaxTitleLength)},
+	}
+
+	for _, tt := range tests {
+		if got := cleanTitle(tt.input); got != tt.want {
+			t.Errorf("cleanTitle(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestDescribeFrame(t *testing.T) {
+	imgPath := filepath.Join(t.TempDir(), "frame_01.jpg")
+	if err := os.WriteFile(imgPath, []byte("fake jpg data"), 0644); err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+
+	var gotPrompt string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req GenerateContentRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if len(req.Contents) == 1 && len(req.Contents[0].Parts) == 2 {
+			gotPrompt = req.Contents[0].Parts[1].Text
+		}
+		json.NewEncoder(w).Encode(GenerateContentResponse{
+			Candidates: []*Candidate{{
+				Content: &Content{Parts: []*Part{{Text: "\"A speaker walks onto the stage.\"\nExtra detail"}}},
+			}},
+		})
+	}))
+	defer server.Close()
+
+	client, _ := NewClient("test-key", WithBaseURL(server.URL))
+	description, err := client.DescribeFrame(context.Background(), imgPath)
+	if err != nil {
+		t.Fatalf("DescribeFrame() failed: %v", err)
+	}
+	if description != "A speaker walks onto the stage." {
+		t.Errorf("DescribeFrame() = %q", description)
+	}
+	if gotPrompt != framePrompt {
+		t.Errorf("prompt = %q, want the frame prompt", gotPrompt)
+	}
+}
+
+func TestCleanDescription(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"A cat sleeps on a couch.", "A cat sleeps on a couch."},
+		{"  **A cat sleeps**  ", "A cat sleeps"},
+		{"First line\nSecond line", "First line"},
+		{strings.Repeat("a", 200), strings.Repeat("a", MaxDescriptionLength-1) + "…"},
+	}
+
+	for _, tt := range tests {
+		if got := cleanDescription(tt.input); got != tt.want {
+			t.Errorf("cleanDescription(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestWriteDocuments(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	docs := []*MarkdownDocument{
+		{
+			Filename:  "chapter_1.md",
+			Title:     "Chapter 1",
+			Content:   "# Chapter 1\n\nThis is chapter 1.",
+			PageRange: PageRange{Start: 1, End: 5},
+		},
+		{
+			Filename:  "chapter_2.md",
+			Title:     "Chapter 2",
+			Content:   "# Chapter 2\n\nThis is chapter 2.",
+			PageRange: PageRange{Start: 6, End: 10},
+		},
+	}
+
+	result, err := WriteDocuments(docs, WriteOptions{
+		OutputDir:       tmpDir,
+		CreateIndexFile: true,
+		AddFrontMatter:  true,
+	})
+
+	if err != nil {
+		t.Fatalf("WriteDocuments() failed: %v", err)
+	}
+
+	// Should have 3 files: 2 chapters + index
+	if len(result.FilesWritten) != 3 {
+		t.Errorf("FilesWritten = %d, want 3", len(result.FilesWritten))
+	}
+
+	// Verify files exist
+	for _, path := range result.FilesWritten {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("File %s was not created: %v", path, err)
+		}
+	}
+
+	// Verify front matter was added
+	content, err := os.ReadFile(filepath.Join(tmpDir, "chapter_1.md"))
+	if err != nil {
+		t.Fatalf("Failed to read chapter_1.md: %v", err)
+	}
+	if len(content) == 0 {
+		t.Error("chapter_1.md is empty")
+	}
+	contentStr := string(content)
+	if !contains(contentStr, "---") {
+		t.Error("Front matter not found in chapter_1.md")
+	}
+}
+
+func TestWriteDocuments_NoOverwrite(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Create existing file
+	existingPath := filepath.Join(tmpDir, "existing.md")
+	if err := os.WriteFile(existingPath, []byte("existing content"), 0644); err != nil {
+		t.Fatalf("Failed to create existing file: %v", err)
+	}
+
+	docs := []*MarkdownDocument{
+		{
+			Filename: "existing.md",
+			Title:    "Test",
+			Content:  "new content",
+		},
+	}
+
+	result, err := WriteDocuments(docs, WriteOptions{
+		OutputDir: tmpDir,
+		Overwrite: false,
+	})
+
+	if err != nil {
+		t.Fatalf("WriteDocuments() failed: %v", err)
+	}
+
+	// Should have error about existing file
+	if len(result.Errors) == 0 {
+		t.Error("Expected error about existing file")
+	}
+
+	// Original file should be unchanged
+	content, _ := os.ReadFile(existingPath)
+	if string(content) != "existing content" {
+		t.Error("Existing file was overwritten")
+	}
+}
+
+func TestWriteDocuments_Modes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix permissions")
+	}
+	docs := []*MarkdownDocument{
+		{Filename: "part_1.md", Title: "Part 1", Content: "one", PageRange: PageRange{Start: 1, End: 1}},
+		{Filename: "part_2.md", Title: "Part 2", Content: "two", PageRange: PageRange{Start: 2, End: 2}},
+	}
+	checkMode := func(path string, want os.FileMode) {
+		t.Helper()
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Errorf("stat %s: %v", filepath.Base(path), err)
+			return
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s mode = %v, want %v", filepath.Base(path), got, want)
+		}
+	}
+
+	// A directory the run creates and every file written get the modes
+	outDir := filepath.Join(t.TempDir(), "private")
+	result, err := WriteDocuments(docs, WriteOptions{
+		OutputDir:       outDir,
+		CreateIndexFile: true,
+		RawPages:        []*PageContent{{PageNumber: 1, Text: "one"}},
+		DirMode:         0750,
+		FileMode:        0600,
+	})
+	if err != nil {
+		t.Fatalf("WriteDocuments() failed: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		t.Fatalf("WriteDocuments() errors: %v", result.Errors)
+	}
+	checkMode(outDir, 0750)
+	for _, path := range result.FilesWritten {
+		checkMode(path, 0600)
+	}
+
+	// An existing directory keeps its mode, and so does an existing file on
+	// overwrite unless a file mode is set
+	sharedDir := filepath.Join(t.TempDir(), "shared")
+	if err := os.Mkdir(sharedDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(sharedDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	existing := filepath.Join(sharedDir, "part_1.md")
+	if err := os.WriteFile(existing, []byte("old"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(existing, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := WriteDocuments(docs, WriteOptions{OutputDir: sharedDir, Overwrite: true, DirMode: 0700}); err != nil {
+		t.Fatalf("WriteDocuments() failed: %v", err)
+	}
+	checkMode(sharedDir, 0755)
+	checkMode(existing, 0640)
+
+	if _, err := WriteDocuments(docs, WriteOptions{OutputDir: sharedDir, Overwrite: true, FileMode: 0600}); err != nil {
+		t.Fatalf("WriteDocuments() failed: %v", err)
+	}
+	checkMode(existing, 0600)
+}
+
+func TestWriteDocuments_RawPages(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	docs := []*MarkdownDocument{{Filename: "doc.md", Title: "Doc", Content: "Body"}}
+	pages := []*PageContent{
+		{PageNumber: 1, Text: "Intro", HasHeading: true, HeadingText: "Intro", HeadingLevel: 1, IsChapterStart: true, ChapterTitle: "Intro"},
+		{PageNumber: 2, Text: "See figure", Images: []ImageDescription{{Description: "A chart", Type: "chart", Caption: "Fig. 1"}}},
+	}
+
+	result, err := WriteDocuments(docs, WriteOptions{OutputDir: tmpDir, RawPages: pages})
+	if err != nil {
+		t.Fatalf("WriteDocuments() failed: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		t.Fatalf("WriteDocuments() errors: %v", result.Errors)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, RawPagesFilename))
+	if err != nil {
+		t.Fatalf("pages.json not written: %v", err)
+	}
+
+	var file PagesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("pages.json is not valid JSON: %v", err)
+	}
+	if file.Version != PagesFileVersion || len(file.Pages) != 2 {
+		t.Fatalf("pages.json = %+v", file)
+	}
+	if !file.Pages[0].IsChapterStart || file.Pages[0].ChapterTitle != "Intro" {
+		t.Errorf("chapter flags not preserved: %+v", file.Pages[0])
+	}
+	if len(file.Pages[1].Images) != 1 || file.Pages[1].Images[0].Caption != "Fig. 1" {
+		t.Errorf("image descriptions not preserved: %+v", file.Pages[1])
+	}
+
+	// Without RawPages no sidecar is written
+	otherDir := t.TempDir()
+	if _, err := WriteDocuments(docs, WriteOptions{OutputDir: otherDir}); err != nil {
+		t.Fatalf("WriteDocuments() failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(otherDir, RawPagesFilename)); !os.IsNotExist(err) {
+		t.Error("pages.json written without RawPages")
+	}
+}
+
+func TestLoadPagesFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+		want    []int
+	}{
+		{"valid", `{"version": 1, "pages": [{"page_number": 1, "text": "a"}, {"page_number": 2, "text": "b"}]}`, false, []int{1, 2}},
+		{"sorted on load", `{"version": 1, "pages": [{"page_number": 3, "text": "c"}, {"page_number": 1, "text": "a"}]}`, false, []int{1, 3}},
+		{"not json", `pages`, true, nil},
+		{"unknown field", `{"version": 1, "pages": [{"page_number": 1, "txt": "a"}]}`, true, nil},
+		{"wrong version", `{"version": 2, "pages": [{"page_number": 1, "text": "a"}]}`, true, nil},
+		{"no pages", `{"version": 1, "pages": []}`, true, nil},
+		{"zero page number", `{"version": 1, "pages": [{"page_number": 0, "text": "a"}]}`, true, nil},
+		{"duplicate page number", `{"version": 1, "pages": [{"page_number": 1, "text": "a"}, {"page_number": 1, "text": "b"}]}`, true, nil},
+		{"null page", `{"version": 1, "pages": [null]}`, true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "pages.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			pages, err := LoadPagesFile(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadPagesFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var got []int
+			for _, p := range pages {
+				got = append(got, p.PageNumber)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("page numbers = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := LoadPagesFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("LoadPagesFile() should fail for a missing file")
+	}
+}
+
+func TestOrganizePages_FromSidecar(t *testing.T) {
+	tmpDir := t.TempDir()
+	pages := []*PageContent{
+		{PageNumber: 1, Text: "# One\n\nFirst", HasHeading: true, HeadingText: "One", HeadingLevel: 1, IsChapterStart: true, ChapterTitle: "One"},
+		{PageNumber: 2, Text: "More of one"},
+		{PageNumber: 3, Text: "# Two\n\nSecond", HasHeading: true, HeadingText: "Two", HeadingLevel: 1, IsChapterStart: true, ChapterTitle: "Two"},
+	}
+
+	if _, err := WriteDocuments([]*MarkdownDocument{{Filename: "x.md", Content: "x"}}, WriteOptions{OutputDir: tmpDir, RawPages: pages}); err != nil {
+		t.Fatalf("WriteDocuments() failed: %v", err)
+	}
+	loaded, err := LoadPagesFile(filepath.Join(tmpDir, RawPagesFilename))
+	if err != nil {
+		t.Fatalf("LoadPagesFile() failed: %v", err)
+	}
+
+	if docs := OrganizePages(loaded, &TranscribeRequest{CombinePages: true}); len(docs) != 1 {
+		t.Errorf("combined: got %d documents, want 1", len(docs))
+	}
+	if docs := OrganizePages(loaded, &TranscribeRequest{}); len(docs) != 3 {
+		t.Errorf("per page: got %d documents, want 3", len(docs))
+	}
+	if docs := OrganizePages(loaded, &TranscribeRequest{DetectChapters: true}); len(docs) != 2 {
+		t.Errorf("chapters: got %d documents, want 2", len(docs))
+	}
+}
+
+func TestScorePageText(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		wantScore int
+		wantTitle string
+	}{
+		{"markdown h1", "# The Beginning\n\nIt was a dark night.", h1Score, "The Beginning"},
+		{"markdown h2", "## A Section\n\nBody", h2Score, "A Section"},
+		{"chapter number", "Chapter 3\n\nBody text", chapterScore, "Chapter 3"},
+		{"chapter word", "CHAPTER TWELVE: The End\nBody", chapterScore, "CHAPTER TWELVE: The End"},
+		{"part roman", "**Part IV**\nBody", chapterScore, "Part IV"},
+		{"h3 chapter heading", "### Chapter 5", chapterScore, "Chapter 5"},
+		{"bare roman numeral", "XIV.\n\nBody", romanScore, "XIV."},
+		{"plain prose", "The chapter began quietly.\nMore prose.", 0, ""},
+		{"chapter mid page", "Line one\nLine two\nLine three\nChapter 9", 0, ""},
+		{"h3 is not a chapter", "### Details\nBody", 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scorePageText(tt.text)
+			if got.score != tt.wantScore || got.title != tt.wantTitle {
+				t.Errorf("scorePageText() = {%d %q}, want {%d %q}", got.score, got.title, tt.wantScore, tt.wantTitle)
+			}
+		})
+	}
+}
+
+func TestDetectChapters_Heuristics(t *testing.T) {
+	body := strings.Repeat("Plain body text on a full page. ", 20)
+	pages := []*PageContent{
+		{PageNumber: 1, Text: "Chapter 1\n\n" + body},
+		{PageNumber: 2, Text: body},
+		{PageNumber: 3, Text: "The end."},
+		{PageNumber: 4, Text: "## Interlude\n\n" + body},
+		{PageNumber: 5, Text: body},
+		{PageNumber: 6, Text: "II\n\n" + body},
+		{PageNumber: 7, Text: body, IsChapterStart: true, ChapterTitle: "Model Flagged"},
+	}
+
+	tests := []struct {
+		sensitivity ChapterSensitivity
+		wantStarts  []int
+	}{
+		// Only the model's flag
+		{ChapterSensitivityOff, []int{7}},
+		// "Chapter 1" (3) is below low's threshold of 4; "## Interlude" after a short page scores 3
+		{ChapterSensitivityLow, []int{7}},
+		{ChapterSensitivityMedium, []int{1, 4, 7}},
+		{"", []int{1, 4, 7}},
+		{ChapterSensitivityHigh, []int{1, 4, 6, 7}},
+	}
+
+	c := &Client{}
+	for _, tt := range tests {
+		chapters := c.detectChapters(pages, tt.sensitivity)
+		var got []int
+		for _, ch := range chapters {
+			got = append(got, ch.StartPage)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.wantStarts) {
+			t.Errorf("sensitivity %q: chapter starts = %v, want %v", tt.sensitivity, got, tt.wantStarts)
+		}
+		// Chapters must tile the pages without gaps
+		for i := 1; i < len(chapters); i++ {
+			if chapters[i-1].EndPage != chapters[i].StartPage-1 {
+				t.Errorf("sensitivity %q: chapter %d ends at %d but next starts at %d", tt.sensitivity, i, chapters[i-1].EndPage, chapters[i].StartPage)
+			}
+		}
+	}
+
+	medium := c.detectChapters(pages, ChapterSensitivityMedium)
+	if medium[0].Title != "Chapter 1" || medium[1].Title != "Interlude" || medium[2].Title != "Model Flagged" {
+		t.Errorf("titles = %q, %q, %q", medium[0].Title, medium[1].Title, medium[2].Title)
+	}
+}
+
+func TestParseChapterSensitivity(t *testing.T) {
+	for input, want := range map[string]ChapterSensitivity{
+		"":       ChapterSensitivityMedium,
+		"off":    ChapterSensitivityOff,
+		"LOW":    ChapterSensitivityLow,
+		"medium": ChapterSensitivityMedium,
+		" high ": ChapterSensitivityHigh,
+	} {
+		got, err := ParseChapterSensitivity(input)
+		if err != nil || got != want {
+			t.Errorf("ParseChapterSensitivity(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+	if _, err := ParseChapterSensitivity("max"); err == nil {
+		t.Error("ParseChapterSensitivity(\"max\") should fail")
+	}
+}
+
+func TestBuildIndexContent_SortedTable(t *testing.T) {
+	docs := []*MarkdownDocument{
+		{Filename: "02_b.md", Title: "B", PageRange: PageRange{Start: 6, End: 10}},
+		{Filename: "01_a.md", Title: "A", PageRange: PageRange{Start: 1, End: 5}},
+		{Filename: "03_c.md", Title: "C", PageRange: PageRange{Start: 11, End: 11}},
+	}
+
+	content := buildIndexContent(docs, WriteOptions{IndexTitle: "My Book"})
+
+	if !contains(content, "# My Book") {
+		t.Error("index title not used")
+	}
+	if !contains(content, "| Document | Pages | File |") {
+		t.Error("index table header not found")
+	}
+
+	rowA := strings.Index(content, "| [A](01_a.md) | 1-5 | 01_a.md |")
+	rowB := strings.Index(content, "| [B](02_b.md) | 6-10 | 02_b.md |")
+	rowC := strings.Index(content, "| [C](03_c.md) | 11 | 03_c.md |")
+	if rowA < 0 || rowB < 0 || rowC < 0 {
+		t.Fatalf("missing index rows:\n%s", content)
+	}
+	if !(rowA < rowB && rowB < rowC) {
+		t.Error("index rows not sorted by start page")
+	}
+}
+
+func TestWriteDocuments_SingleDocIndex(t *testing.T) {
+	tests := []struct {
+		name      string
+		force     bool
+		wantIndex bool
+	}{
+		{"skipped by default", false, false},
+		{"forced", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			docs := []*MarkdownDocument{
+				{Filename: "document.md", Title: "Document", Content: "text", PageRange: PageRange{Start: 1, End: 3}},
+			}
+
+			_, err := WriteDocuments(docs, WriteOptions{
+				OutputDir:       tmpDir,
+				CreateIndexFile: true,
+				ForceIndex:      tt.force,
+			})
+			if err != nil {
+				t.Fatalf("WriteDocuments() failed: %v", err)
+			}
+
+			_, statErr := os.Stat(filepath.Join(tmpDir, "index.md"))
+			if gotIndex := statErr == nil; gotIndex != tt.wantIndex {
+				t.Errorf("index.md written = %v, want %v", gotIndex, tt.wantIndex)
+			}
+		})
+	}
+}
+
+func TestExpandFilenameTemplate(t *testing.T) {
+	doc := &MarkdownDocument{
+		Title:     "Chapter 1: Introduction",
+		PageRange: PageRange{Start: 3, End: 12},
+	}
+	now := time.Date(2025, 3, 14, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		tmpl string
+		want string
+	}{
+		{"index title date", "{index}-{title}-{date}.md", "02-chapter_1_introduction-2025-03-14.md"},
+		{"no extension", "{title}", "chapter_1_introduction.md"},
+		{"page range", "pages_{pagestart}-{pageend}", "pages_3-12.md"},
+		{"unsafe literal text", "../{index}/{title}", "02_chapter_1_introduction.md"},
+		{"unknown placeholder kept", "{unknown}", "{unknown}.md"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expandFilenameTemplate(tt.tmpl, doc, 2, now); got != tt.want {
+				t.Errorf("expandFilenameTemplate(%q) = %v, want %v", tt.tmpl, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteDocuments_OutputTemplate(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	docs := []*MarkdownDocument{
+		{Filename: "01_intro.md", Title: "Intro", Content: "intro", PageRange: PageRange{Start: 1, End: 2}},
+		{Filename: "02_body.md", Title: "Body", Content: "body", PageRange: PageRange{Start: 3, End: 4}},
+	}
+
+	result, err := WriteDocuments(docs, WriteOptions{
+		OutputDir:      tmpDir,
+		OutputTemplate: "{index}-{title}_p{pagestart}",
+	})
+	if err != nil {
+		t.Fatalf("WriteDocuments() failed: %v", err)
+	}
+
+	for _, name := range []string{"01-intro_p1.md", "02-body_p3.md"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("expected %s to be written: %v", name, err)
+		}
+	}
+	if len(result.FilesWritten) != 2 {
+		t.Errorf("FilesWritten = %d, want 2", len(result.FilesWritten))
+	}
+
+	// Without {index} every document expands to the same name; later ones
+	// get their index appended instead of overwriting the first
+	sameDir := t.TempDir()
+	if _, err := WriteDocuments(docs, WriteOptions{
+		OutputDir:      sameDir,
+		OutputTemplate: "notes",
+		Overwrite:      true,
+	}); err != nil {
+		t.Fatalf("WriteDocuments() failed: %v", err)
+	}
+	for name, want := range map[string]string{"notes.md": "intro", "notes-02.md": "body"} {
+		data, err := os.ReadFile(filepath.Join(sameDir, name))
+		if err != nil {
+			t.Errorf("expected %s to be written: %v", name, err)
+			continue
+		}
+		if !strings.Contains(string(data), want) {
+			t.Errorf("%s = %q, want the %s document", name, data, want)
+		}
+	}
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    OutputFormat
+		wantErr bool
+	}{
+		{"", FormatMarkdown, false},
+		{"md", FormatMarkdown, false},
+		{"DOCX", FormatDOCX, false},
+		{"htm", FormatHTML, false},
+		{"JSON", FormatJSON, false},
+		{"pdf", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseOutputFormat(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseOutputFormat(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseOutputFormat(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseOutputFormats(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []OutputFormat
+		wantErr bool
+	}{
+		{"", []OutputFormat{FormatMarkdown}, false},
+		{"docx", []OutputFormat{FormatDOCX}, false},
+		{"markdown, docx", []OutputFormat{FormatMarkdown, FormatDOCX}, false},
+		{"word,md,docx", []OutputFormat{FormatDOCX, FormatMarkdown}, false},
+		{"html,json,html", []OutputFormat{FormatHTML, FormatJSON}, false},
+		{"markdown,pdf", nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseOutputFormats(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseOutputFormats(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("ParseOutputFormats(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseInline(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []docxRun
+	}{
+		{"plain", []docxRun{{text: "plain"}}},
+		{"a **bold** b", []docxRun{{text: "a "}, {text: "bold", bold: true}, {text: " b"}}},
+		{"*it* and __b__", []docxRun{{text: "it", italic: true}, {text: " and "}, {text: "b", bold: true}}},
+		{"***both***", []docxRun{{text: "both", bold: true, italic: true}}},
+		{"use `go_vet` now", []docxRun{{text: "use "}, {text: "go_vet", code: true}, {text: " now"}}},
+		{"snake_case_name", []docxRun{{text: "snake_case_name"}}},
+		{"2 * 3 = 6", []docxRun{{text: "2 * 3 = 6"}}},
+		{`\*literal\*`, []docxRun{{text: "*literal*"}}},
+		{"see [the **docs**](http://x)", []docxRun{{text: "see "}, {text: "the ", link: "http://x"}, {text: "docs", bold: true, link: "http://x"}}},
+	}
+
+	for _, tt := range tests {
+		got := parseInline(tt.input)
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("parseInline(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestBuildDOCX(t *testing.T) {
+	doc := &MarkdownDocument{
+		Title: "Chapter <1> & More",
+		Content: "# Chapter 1\n\nSome **bold** and *italic* text\ncontinued.\n\n" +
+			"- one\n  - nested\n- two\n\n1. first\n2. second\n\nBreak\n\n1. again\n\n" +
+			"| Name | Qty |\n|------|----:|\n| a \\| b | 2 |\n| c |\n\n> quoted\n\n```\ncode line\n```\n",
+		PageRange: PageRange{Start: 3, End: 7},
+		Metadata:  &DocumentMetadata{Author: "Ada", Language: "en", Keywords: []string{"x", "y"}},
+	}
+
+	data, err := buildDOCX(doc, WriteOptions{}, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("buildDOCX() error: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("output is not a zip: %v", err)
+	}
+	parts := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = string(b)
+
+		// Every part must be well-formed XML
+		dec := xml.NewDecoder(strings.NewReader(string(b)))
+		for {
+			if _, err := dec.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s is not well-formed: %v", f.Name, err)
+			}
+		}
+	}
+	if zr.File[0].Name != "[Content_Types].xml" {
+		t.Errorf("first part = %s, want [Content_Types].xml", zr.File[0].Name)
+	}
+
+	body := parts["word/document.xml"]
+	for _, want := range []string{
+		`<w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t xml:space="preserve">Chapter 1</w:t>`,
+		`<w:rPr><w:b/></w:rPr><w:t xml:space="preserve">bold</w:t>`,
+		`<w:rPr><w:i/></w:rPr><w:t xml:space="preserve">italic</w:t>`,
+		`text continued.`,
+		`<w:ilvl w:val="1"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t xml:space="preserve">nested`,
+		`<w:numId w:val="2"/></w:numPr></w:pPr><w:r><w:t xml:space="preserve">second`,
+		`<w:numId w:val="3"/></w:numPr></w:pPr><w:r><w:t xml:space="preserve">again`,
+		`<w:tblHeader/>`,
+		`<w:rPr><w:b/></w:rPr><w:t xml:space="preserve">Qty</w:t>`,
+		`a | b`,
+		`<w:pStyle w:val="Quote"/>`,
+		`<w:pStyle w:val="Code"/>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("document.xml missing %s", want)
+		}
+	}
+	if n := strings.Count(body, "<w:tc>"); n != 6 {
+		t.Errorf("table has %d cells, want 6 (short rows padded)", n)
+	}
+	if !strings.Contains(parts["word/numbering.xml"], `<w:num w:numId="3">`) {
+		t.Error("numbering.xml should define a restarting instance per numbered list")
+	}
+
+	core := parts["docProps/core.xml"]
+	for _, want := range []string{
+		"<dc:title>Chapter &lt;1&gt; &amp; More</dc:title>",
+		"<dc:creator>Ada</dc:creator>",
+		"<dc:language>en</dc:language>",
+		"<cp:keywords>x, y</cp:keywords>",
+		"<dc:description>Pages 3-7</dc:description>",
+		"2026-01-02T03:04:05Z",
+	} {
+		if !strings.Contains(core, want) {
+			t.Errorf("core.xml missing %s", want)
+		}
+	}
+}
+
+func TestWriteDocuments_DOCX(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	docs := []*MarkdownDocument{
+		{Filename: "01_intro.md", Title: "Intro", Content: "# Intro", PageRange: PageRange{Start: 1, End: 1}},
+		{Filename: "02_body.md", Title: "Body", Content: "body", PageRange: PageRange{Start: 2, End: 2}},
+	}
+
+	result, err := WriteDocuments(docs, WriteOptions{
+		OutputDir:       tmpDir,
+		CreateIndexFile: true,
+		Format:          FormatDOCX,
+	})
+	if err != nil {
+		t.Fatalf("WriteDocuments() failed: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		t.Fatalf("WriteDocuments() errors: %v", result.Errors)
+	}
+
+	for _, name := range []string{"01_intro.docx", "02_body.docx"} {
+		if _, err := zip.OpenReader(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("expected %s to be a docx: %v", name, err)
+		}
+	}
+	index, err := os.ReadFile(filepath.Join(tmpDir, "index.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(index), "(01_intro.docx)") {
+		t.Errorf("index.md should link the docx files:\n%s", index)
+	}
+}
+
+func TestBuildHTML(t *testing.T) {
+	doc := &MarkdownDocument{
+		Title: "Chapter <1> & More",
+		Content: "# Chapter 1\n\nSome **bold** and *italic* text\ncontinued.\n\n" +
+			"- one\n  - nested\n- two\n\n1. first\n2. second\n\n" +
+			"| Name | Qty |\n|------|----:|\n| a \\| b | 2 |\n| c |\n\n> quoted\n\n```\n<code> line\n```\n\n" +
+			"---\n\n## Notes\n\n[site](https://example.com) [bad](javascript:void) [local](#notes)\n\n## Notes\n",
+		PageRange: PageRange{Start: 3, End: 7},
+		Sections:  []*Section{{Title: "Chapter 1", Level: 1}, {Title: "Notes", Level: 2}},
+		Metadata:  &DocumentMetadata{Author: "Ada", Language: "en", Keywords: []string{"x", "y"}},
+	}
+
+	out := string(buildHTML(doc, WriteOptions{AddTableOfContents: true}, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)))
+	for _, want := range []string{
+		"<!DOCTYPE html>\n<html lang=\"en\">",
+		"<title>Chapter &lt;1&gt; &amp; More</title>",
+		`<meta name="author" content="Ada">`,
+		`<meta name="keywords" content="x, y">`,
+		`<meta name="description" content="Pages 3-7">`,
+		`<meta name="date" content="2026-01-02T03:04:05Z">`,
+		"<style>",
+		`<nav class="toc">`,
+		`<li><a href="#chapter-1">Chapter 1</a><ul>` + "\n" + `<li><a href="#notes">Notes</a>`,
+		`<h1 id="chapter-1">Chapter 1</h1>`,
+		"<p>Some <strong>bold</strong> and <em>italic</em> text continued.</p>",
+		"<ul>\n<li>one<ul>\n<li>nested</li>\n</ul>\n</li>\n<li>two</li>\n</ul>",
+		"<ol>\n<li>first</li>\n<li>second</li>\n</ol>",
+		"<thead>\n<tr><th>Name</th><th>Qty</th></tr>\n</thead>",
+		"<tr><td>a | b</td><td>2</td></tr>",
+		"<tr><td>c</td><td></td></tr>",
+		"<blockquote><p>quoted</p></blockquote>",
+		"<pre><code>&lt;code&gt; line</code></pre>",
+		"<hr>",
+		`<a href="https://example.com">site</a>`,
+		`<a href="#">bad</a>`,
+		`<a href="#notes">local</a>`,
+		`<h2 id="notes">Notes</h2>`,
+		`<h2 id="notes-2">Notes</h2>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("HTML missing %q\n%s", want, out)
+		}
+	}
+	if strings.Count(out, "<ul>") != strings.Count(out, "</ul>") || strings.Count(out, "<li>") != strings.Count(out, "</li>") {
+		t.Errorf("unbalanced lists:\n%s", out)
+	}
+
+	// Without metadata the language is left undetermined
+	plain := string(buildHTML(&MarkdownDocument{Title: "T", Content: "text"}, WriteOptions{}, time.Now()))
+	if !strings.Contains(plain, `<html lang="und">`) || strings.Contains(plain, "<nav") {
+		t.Errorf("plain document rendered unexpectedly:\n%s", plain)
+	}
+}
+
+func TestBuildDocumentJSON(t *testing.T) {
+	pages := []*PageContent{
+		{PageNumber: 3, Text: "# Chapter 1\n\nText", HasHeading: true, HeadingText: "Chapter 1", HeadingLevel: 1, IsChapterStart: true, ChapterTitle: "Chapter 1"},
+		{PageNumber: 4, Text: "More", Images: []ImageDescription{{Description: "A map", Type: "figure", Caption: "Fig. 1"}}},
+	}
+	client := &Client{}
+	doc := client.createDocumentFromPages(pages, "Chapter 1", 1, &TranscribeRequest{})
+	doc.Metadata = &DocumentMetadata{Author: "Ada", Language: "en"}
+
+	data, err := buildDocumentJSON(doc, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("buildDocumentJSON() error: %v", err)
+	}
+
+	var file DocumentFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("output is not a DocumentFile: %v\n%s", err, data)
+	}
+	if file.Version != DocumentFileVersion || file.Title != "Chapter 1" || file.PageStart != 3 || file.PageEnd != 4 {
+		t.Errorf("header = %+v", file)
+	}
+	if file.Generated != "2026-01-02T03:04:05Z" || file.Author != "Ada" || file.Language != "en" {
+		t.Errorf("metadata = %+v", file)
+	}
+	if file.Markdown != doc.Content {
+		t.Errorf("markdown = %q, want %q", file.Markdown, doc.Content)
+	}
+	if len(file.Sections) != 1 || file.Sections[0] != (DocumentSection{Title: "Chapter 1", Level: 1, StartPage: 3}) {
+		t.Errorf("sections = %+v", file.Sections)
+	}
+	if len(file.Pages) != 2 || !file.Pages[0].IsChapterStart || len(file.Pages[1].Images) != 1 || file.Pages[1].Images[0].Caption != "Fig. 1" {
+		t.Errorf("pages = %+v", file.Pages)
+	}
+}
+
+func TestWriteDocuments_HTMLAndJSON(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	docs := []*MarkdownDocument{
+		{Filename: "01_intro.md", Title: "Intro", Content: "# Intro", PageRange: PageRange{Start: 1, End: 1}},
+		{Filename: "02_body.md", Title: "Body", Content: "body", PageRange: PageRange{Start: 2, End: 2}},
+	}
+
+	result, err := WriteDocuments(docs, WriteOptions{
+		OutputDir:       tmpDir,
+		CreateIndexFile: true,
+		Formats:         []OutputFormat{FormatHTML, FormatJSON},
+	})
+	if err != nil {
+		t.Fatalf("WriteDocuments() failed: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		t.Fatalf("WriteDocuments() errors: %v", result.Errors)
+	}
+
+	var names []string
+	for _, path := range result.FilesWritten {
+		names = append(names, filepath.Base(path))
+	}
+	want := "01_intro.html 01_intro.json 02_body.html 02_body.json index.md"
+	if got := strings.Join(names, " "); got != want {
+		t.Errorf("FilesWritten = %s, want %s", got, want)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, "02_body.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file DocumentFile
+	if err := json.Unmarshal(data, &file); err != nil || file.Markdown != "body" {
+		t.Errorf("02_body.json = %s (%v)", data, err)
+	}
+	index, err := os.ReadFile(filepath.Join(tmpDir, "index.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(index), "(01_intro.html)") {
+		t.Errorf("index.md should link the html files:\n%s", index)
+	}
+}
+
+func TestExtractTables(t *testing.T) {
+	text := "Intro\n\n" +
+		"| Name | **Qty** | Note |\n" +
+		"|:-----|----:|:---:|\n" +
+		"| a \\| b | 2 | `x` |\n" +
+		"| c |\n" +
+		"| d | 4 | e | extra |\n" +
+		"\nBetween\n\n" +
+		"```\n| not | a table |\n|---|---|\n```\n\n" +
+		"| Only | Header |\n| --- | --- |\n\n" +
+		"| no separator |\n| row |\n"
+
+	tables := ExtractTables(text)
+	if len(tables) != 2 {
+		t.Fatalf("ExtractTables() found %d tables, want 2: %+v", len(tables), tables)
+	}
+
+	first := tables[0]
+	if got := fmt.Sprint(first.Header); got != "[Name Qty Note ]" {
+		t.Errorf("header = %q, want padded to the widest row", got)
+	}
+	want := [][]string{
+		{"a | b", "2", "x", ""},
+		{"c", "", "", ""},
+		{"d", "4", "e", "extra"},
+	}
+	if fmt.Sprint(first.Rows) != fmt.Sprint(want) {
+		t.Errorf("rows = %q, want %q", first.Rows, want)
+	}
+
+	if len(tables[1].Rows) != 0 || fmt.Sprint(tables[1].Header) != "[Only Header]" {
+		t.Errorf("header-only table = %+v", tables[1])
+	}
+
+	data, err := first.CSV()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "Name,Qty,Note,\na | b,2,x,\nc,,,\nd,4,e,extra\n"; got != want {
+		t.Errorf("CSV() = %q, want %q", got, want)
+	}
+}
+
+func TestWriteDocuments_Tables(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	pages := []*PageContent{
+		{PageNumber: 1, Text: "# Results\n\n| k | v |\n|---|---|\n| \"q\" | 1,5 |"},
+		{PageNumber: 2, Text: "| x |\n|---|\n| y |"},
+		{PageNumber: 3, Text: "No tables here"},
+	}
+	docs := OrganizePages(pages, &TranscribeRequest{CombinePages: true, ExtractTables: true})
+	if len(docs) != 1 || len(docs[0].Tables) != 2 || docs[0].Tables[1].PageNumber != 2 {
+		t.Fatalf("OrganizePages() tables = %+v", docs[0].Tables)
+	}
+	if plain := OrganizePages(pages, &TranscribeRequest{CombinePages: true}); plain[0].Tables != nil {
+		t.Error("tables should only be collected with ExtractTables")
+	}
+
+	result, err := WriteDocuments(docs, WriteOptions{OutputDir: tmpDir, Formats: []OutputFormat{FormatMarkdown, FormatHTML}})
+	if err != nil {
+		t.Fatalf("WriteDocuments() failed: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		t.Fatalf("WriteDocuments() errors: %v", result.Errors)
+	}
+
+	var names []string
+	for _, path := range result.TableFiles {
+		names = append(names, filepath.Base(path))
+	}
+	if got := strings.Join(names, " "); got != "document_table1.csv document_table2.csv" {
+		t.Errorf("TableFiles = %s", got)
+	}
+	if len(result.FilesWritten) != 4 {
+		t.Errorf("FilesWritten = %v, want both formats and both tables", result.FilesWritten)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, "document_table1.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "k,v\n\"\"\"q\"\"\",\"1,5\"\n"; got != want {
+		t.Errorf("document_table1.csv = %q, want %q", got, want)
+	}
+
+	// A document that already exists isn't overwritten, and neither are
+	// its tables
+	result, err = WriteDocuments(docs, WriteOptions{OutputDir: tmpDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.TableFiles) != 0 || len(result.Errors) != 1 {
+		t.Errorf("second write: TableFiles = %v, errors = %v", result.TableFiles, result.Errors)
+	}
+}
+
+func TestWriteDocuments_MultipleFormats(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	docs := []*MarkdownDocument{
+		{Filename: "01_intro.md", Title: "Intro", Content: "# Intro", PageRange: PageRange{Start: 1, End: 1}},
+		{Filename: "02_body.md", Title: "Body", Content: "body", PageRange: PageRange{Start: 2, End: 2}},
+	}
+
+	result, err := WriteDocuments(docs, WriteOptions{
+		OutputDir:       tmpDir,
+		CreateIndexFile: true,
+		Formats:         []OutputFormat{FormatDOCX, FormatMarkdown},
+	})
+	if err != nil {
+		t.Fatalf("WriteDocuments() failed: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		t.Fatalf("WriteDocuments() errors: %v", result.Errors)
+	}
+	if len(result.FilesWritten) != 5 {
+		t.Errorf("FilesWritten = %v, want both formats of both documents and the index", result.FilesWritten)
+	}
+
+	for _, name := range []string{"01_intro.docx", "02_body.docx"} {
+		if _, err := zip.OpenReader(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("expected %s to be a docx: %v", name, err)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(tmpDir, "01_intro.md")); err != nil || !strings.Contains(string(data), "# Intro") {
+		t.Errorf("01_intro.md = %q, %v; want the markdown copy", data, err)
+	}
+
+	// The index and the documents' names follow the primary format
+	index, err := os.ReadFile(filepath.Join(tmpDir, "index.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(index), "(01_intro.docx)") || strings.Contains(string(index), "(01_intro.md)") {
+		t.Errorf("index.md should link only the primary docx files:\n%s", index)
+	}
+	if docs[0].Filename != "01_intro.docx" {
+		t.Errorf("Filename = %q, want the primary 01_intro.docx", docs[0].Filename)
+	}
+
+	// A single document in two formats is still one document: no index
+	single := t.TempDir()
+	doc := &MarkdownDocument{Filename: "book.md", Title: "Book", Content: "text", PageRange: PageRange{Start: 1, End: 3}}
+	result, err = WriteDocuments([]*MarkdownDocument{doc}, WriteOptions{
+		OutputDir:       single,
+		CreateIndexFile: true,
+		Formats:         []OutputFormat{FormatMarkdown, FormatDOCX},
+	})
+	if err != nil {
+		t.Fatalf("WriteDocuments() failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(single, "index.md")); !os.IsNotExist(err) {
+		t.Errorf("index.md written for a single document (files %v)", result.FilesWritten)
+	}
+}
+
+func TestWriteDocuments_OnFileWritten(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	docs := []*MarkdownDocument{
+		{Filename: "01_intro.md", Title: "Intro", Content: "# Intro", PageRange: PageRange{Start: 1, End: 1}},
+		{Filename: "02_body.md", Title: "Body", Content: "body", PageRange: PageRange{Start: 2, End: 2}},
+	}
+
+	var seen []string
+	result, err := WriteDocuments(docs, WriteOptions{
+		OutputDir:       tmpDir,
+		CreateIndexFile: true,
+		OnFileWritten: func(path string, doc *MarkdownDocument) {
+			// Called once the file is complete on disk
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("OnFileWritten(%s) before the file exists: %v", path, err)
+			}
+			title := "-"
+			if doc != nil {
+				title = doc.Title
+			}
+			seen = append(seen, filepath.Base(path)+":"+title)
+		},
+	})
+	if err != nil {
+		t.Fatalf("WriteDocuments() failed: %v", err)
+	}
+
+	want := []string{"01_intro.md:Intro", "02_body.md:Body", "index.md:-"}
+	if fmt.Sprint(seen) != fmt.Sprint(want) {
+		t.Errorf("OnFileWritten saw %v, want %v", seen, want)
+	}
+	if len(seen) != len(result.FilesWritten) {
+		t.Errorf("OnFileWritten called %d times for %d files", len(seen), len(result.FilesWritten))
+	}
+}
+
+func TestStreamWriter_MatchesWriteDocuments(t *testing.T) {
+	batches := [][]*PageContent{
+		{{PageNumber: 1, Text: "First page"}, {PageNumber: 2, Text: "Second page", HasHeading: true, HeadingText: "Intro", HeadingLevel: 1}},
+		{{PageNumber: 3, Text: "Third page", Images: []ImageDescription{{Type: "figure", Description: "A chart"}}}},
+		{{PageNumber: 4, Text: "Fourth page\n"}},
+	}
+	var all []*PageContent
+	for _, b := range batches {
+		all = append(all, b...)
+	}
+
+	tests := []struct {
+		name string
+		req  TranscribeRequest
+		opts WriteOptions
+	}{
+		{"per page", TranscribeRequest{IncludeImageDescriptions: true}, WriteOptions{CreateIndexFile: true}},
+		{"per page with template", TranscribeRequest{}, WriteOptions{OutputTemplate: "{index}-{title}"}},
+		{"combine appends", TranscribeRequest{CombinePages: true, IncludeImageDescriptions: true}, WriteOptions{}},
+		{"combine with front matter", TranscribeRequest{CombinePages: true}, WriteOptions{AddFrontMatter: true}},
+		{"chapters", TranscribeRequest{DetectChapters: true}, WriteOptions{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wantDir, gotDir := t.TempDir(), t.TempDir()
+
+			req := tt.req
+			wantOpts := tt.opts
+			wantOpts.OutputDir = wantDir
+			want, err := WriteDocuments(OrganizePages(all, &req), wantOpts)
+			if err != nil {
+				t.Fatalf("WriteDocuments() failed: %v", err)
+			}
+
+			gotOpts := tt.opts
+			gotOpts.OutputDir = gotDir
+			stream, err := NewStreamWriter(&req, gotOpts)
+			if err != nil {
+				t.Fatalf("NewStreamWriter() failed: %v", err)
+			}
+			// Out of order, as parallel batches can finish
+			stream.AddBatch(2, batches[2])
+			stream.AddBatch(0, batches[0])
+			stream.AddBatch(1, batches[1])
+			got, err := stream.Close(nil)
+			if err != nil {
+				t.Fatalf("Close() failed: %v", err)
+			}
+			if len(got.Errors) > 0 {
+				t.Fatalf("Close() errors: %v", got.Errors)
+			}
+
+			if len(got.FilesWritten) != len(want.FilesWritten) {
+				t.Fatalf("wrote %v, want %v", got.FilesWritten, want.FilesWritten)
+			}
+			for i, path := range want.FilesWritten {
+				name := filepath.Base(path)
+				if filepath.Base(got.FilesWritten[i]) != name {
+					t.Errorf("file %d = %s, want %s", i, filepath.Base(got.FilesWritten[i]), name)
+					continue
+				}
+				if name == "index.md" {
+					continue // contains a timestamp
+				}
+				wantData, _ := os.ReadFile(path)
+				gotData, _ := os.ReadFile(got.FilesWritten[i])
+				if name != "document.md" || !tt.opts.AddFrontMatter {
+					if string(gotData) != string(wantData) {
+						t.Errorf("%s differs:\ngot:\n%s\nwant:\n%s", name, gotData, wantData)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestStreamWriter_WritesBeforeClose(t *testing.T) {
+	t.Run("per page", func(t *testing.T) {
+		dir := t.TempDir()
+		stream, err := NewStreamWriter(&TranscribeRequest{}, WriteOptions{OutputDir: dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream.AddBatch(1, []*PageContent{{PageNumber: 2, Text: "two"}})
+		if _, err := os.Stat(filepath.Join(dir, "page_002.md")); err == nil {
+			t.Error("batch 1 was written before batch 0")
+		}
+		stream.AddBatch(0, []*PageContent{{PageNumber: 1, Text: "one"}})
+		for _, name := range []string{"page_001.md", "page_002.md"} {
+			if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+				t.Errorf("%s not written before Close: %v", name, err)
+			}
+		}
+		if _, err := stream.Close(nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("combine", func(t *testing.T) {
+		dir := t.TempDir()
+		stream, err := NewStreamWriter(&TranscribeRequest{CombinePages: true}, WriteOptions{OutputDir: dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream.AddBatch(0, []*PageContent{{PageNumber: 1, Text: "one"}})
+		data, err := os.ReadFile(filepath.Join(dir, "document.md"))
+		if err != nil || string(data) != "one" {
+			t.Errorf("document.md before Close = %q, %v; want the first page", data, err)
+		}
+		stream.AddBatch(1, []*PageContent{{PageNumber: 2, Text: "two"}})
+		if _, err := stream.Close(nil); err != nil {
+			t.Fatal(err)
+		}
+		data, _ = os.ReadFile(filepath.Join(dir, "document.md"))
+		if string(data) != "one\n\n---\n\ntwo\n" {
+			t.Errorf("document.md = %q", data)
+		}
+	})
+
+	t.Run("gap is flushed at close", func(t *testing.T) {
+		dir := t.TempDir()
+		stream, err := NewStreamWriter(&TranscribeRequest{}, WriteOptions{OutputDir: dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Batch 0 failed, batch 1 finished
+		stream.AddBatch(1, []*PageContent{{PageNumber: 3, Text: "three"}})
+		result, err := stream.Close([]*PageContent{{PageNumber: 3, Text: "three"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.FilesWritten) != 2 {
+			t.Errorf("FilesWritten = %v, want the page and pages.json", result.FilesWritten)
+		}
+		if _, err := os.Stat(filepath.Join(dir, RawPagesFilename)); err != nil {
+			t.Errorf("pages.json not written: %v", err)
+		}
+	})
+}
+
+func TestTranscribeImages_OnBatchComplete(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(LocalLLMResponse{
+			Choices: []LocalLLMChoice{{Message: LocalLLMChoiceMessage{Content: `{"pages": [{"page_number": 1, "text": "ok"}]}`}}},
+		})
+	}))
+	defer server.Close()
+
+	client, err := NewLocalClient(server.URL, "test-model")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpDir := t.TempDir()
+	var images []string
+	for i := 1; i <= 4; i++ {
+		path := filepath.Join(tmpDir, fmt.Sprintf("page%d.png", i))
+		if err := os.WriteFile(path, []byte("fake png data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, path)
+	}
+
+	seen := make(map[int]int)
+	_, err = client.TranscribeImages(context.Background(), &TranscribeRequest{
+		Images: images,
+		OnBatchComplete: func(batchIndex int, pages []*PageContent) {
+			seen[batchIndex] += len(pages)
+		},
+	})
+	if err != nil {
+		t.Fatalf("TranscribeImages() failed: %v", err)
+	}
+	if len(seen) != 4 {
+		t.Errorf("OnBatchComplete saw batches %v, want 0-3 once each", seen)
+	}
+	for idx, n := range seen {
+		if n != 1 {
+			t.Errorf("batch %d delivered %d pages, want 1", idx, n)
+		}
+	}
+}
+
+func TestDedupeImages(t *testing.T) {
+	tmpDir := t.TempDir()
+	var images []*ImageInfo
+	for i, data := range []string{"a", "b", "a", "c", "b", "a"} {
+		path := filepath.Join(tmpDir, fmt.Sprintf("page%d.png", i+1))
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, &ImageInfo{Path: path, PageIndex: i})
+	}
+
+	unique, duplicates, err := dedupeImages(images)
+	if err != nil {
+		t.Fatalf("dedupeImages() failed: %v", err)
+	}
+	var kept []int
+	for _, img := range unique {
+		kept = append(kept, img.PageIndex)
+	}
+	if want := []int{0, 1, 3}; !reflect.DeepEqual(kept, want) {
+		t.Errorf("dedupeImages() kept pages %v, want %v", kept, want)
+	}
+	if want := map[int]int{2: 0, 4: 1, 5: 0}; !reflect.DeepEqual(duplicates, want) {
+		t.Errorf("dedupeImages() duplicates = %v, want %v", duplicates, want)
+	}
+
+	if _, _, err := dedupeImages([]*ImageInfo{{Path: filepath.Join(tmpDir, "missing.png")}}); err == nil {
+		t.Error("dedupeImages() with a missing file should fail")
+	}
+}
+
+func TestFanOutDuplicates(t *testing.T) {
+	pages := []*PageContent{
+		{PageNumber: 1, Text: "cover", IsChapterStart: true, ChapterTitle: "Intro", Images: []ImageDescription{{Description: "logo"}}},
+		{PageNumber: 2, Text: "body"},
+	}
+	// Page 4 repeats page 1, page 3 repeats page 2, and page 5 repeats a
+	// page that was never transcribed
+	out := fanOutDuplicates(pages, map[int]int{3: 0, 2: 1, 4: 6})
+
+	var got []string
+	for _, p := range out {
+		got = append(got, fmt.Sprintf("%d:%s", p.PageNumber, p.Text))
+	}
+	if want := []string{"1:cover", "2:body", "3:body", "4:cover"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("fanOutDuplicates() = %v, want %v", got, want)
+	}
+	if out[3].IsChapterStart || out[3].ChapterTitle != "" {
+		t.Error("a repeated page should not start its chapter again")
+	}
+	out[3].Images[0].Description = "changed"
+	out[2].Text = "changed"
+	if pages[0].Images[0].Description != "logo" || pages[1].Text != "body" {
+		t.Error("fanOutDuplicates() copies should not share state with the original pages")
+	}
+
+	if out := fanOutDuplicates(pages, nil); len(out) != 2 {
+		t.Errorf("fanOutDuplicates() without duplicates returned %d pages, want 2", len(out))
+	}
+}
+
+func TestTranscribeImages_DedupePages(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		json.NewEncoder(w).Encode(LocalLLMResponse{
+			Choices: []LocalLLMChoice{{Message: LocalLLMChoiceMessage{Content: fmt.Sprintf(`{"pages": [{"page_number": 1, "text": "call %d"}]}`, n)}}},
+		})
+	}))
+	defer server.Close()
+
+	client, err := NewLocalClient(server.URL, "test-model")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpDir := t.TempDir()
+	var images []string
+	for i, data := range []string{"blank", "text", "blank", "blank"} {
+		path := filepath.Join(tmpDir, fmt.Sprintf("page%d.png", i+1))
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, path)
+	}
+
+	delivered := 0
+	resp, err := client.TranscribeImages(context.Background(), &TranscribeRequest{
+		Images:       images,
+		CombinePages: true,
+		DedupePages:  true,
+		OnBatchComplete: func(batchIndex int, pages []*PageContent) {
+			delivered += len(pages)
+		},
+	})
+	if err != nil {
+		t.Fatalf("TranscribeImages() failed: %v", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("sent %d requests, want 2 (one per distinct image)", n)
+	}
+	if delivered != 4 {
+		t.Errorf("OnBatchComplete delivered %d pages, want 4", delivered)
+	}
+	if resp.CompletedPages != 4 || len(resp.Pages) != 4 {
+		t.Fatalf("got %d completed pages (%d in Pages), want 4", resp.CompletedPages, len(resp.Pages))
+	}
+	for i, page := range resp.Pages {
+		if page.PageNumber != i+1 {
+			t.Errorf("Pages[%d].PageNumber = %d, want %d", i, page.PageNumber, i+1)
+		}
+	}
+	if resp.Pages[0].Text != resp.Pages[2].Text || resp.Pages[0].Text != resp.Pages[3].Text || resp.Pages[0].Text == resp.Pages[1].Text {
+		t.Errorf("page texts %q, %q, %q, %q: want pages 1, 3 and 4 to match and page 2 to differ",
+			resp.Pages[0].Text, resp.Pages[1].Text, resp.Pages[2].Text, resp.Pages[3].Text)
+	}
+	if doc := resp.Documents[0]; doc.PageRange.Start != 1 || doc.PageRange.End != 4 {
+		t.Errorf("combined document covers pages %d-%d, want 1-4", doc.PageRange.Start, doc.PageRange.End)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		bytes int64
+		want  string
+	}{
+		{0, "0 bytes"},
+		{100, "100 bytes"},
+		{1024, "1.00 KB"},
+		{1536, "1.50 KB"},
+		{1048576, "1.00 MB"},
+		{1572864, "1.50 MB"},
+		{1073741824, "1.00 GB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := FormatSize(tt.bytes); got != tt.want {
+				t.Errorf("FormatSize(%d) = %v, want %v", tt.bytes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	// Save original env
+	origGemini := os.Getenv("GEMINI_API_KEY")
+	origGoogle := os.Getenv("GOOGLE_API_KEY")
+	defer func() {
+		os.Setenv("GEMINI_API_KEY", origGemini)
+		os.Setenv("GOOGLE_API_KEY", origGoogle)
+	}()
+	t.Setenv("ANTHROPIC_API_KEY", "")
+
+	// Test with key set
+	os.Setenv("GEMINI_API_KEY", "test-key")
+	if err := CheckConfig(); err != nil {
+		t.Errorf("CheckConfig() failed with key set: %v", err)
+	}
+
+	// Test with no keys (also unset LLM_ENDPOINT for local LLM)
+	os.Unsetenv("GEMINI_API_KEY")
+	os.Unsetenv("GOOGLE_API_KEY")
+	os.Unsetenv("LLM_ENDPOINT")
+	os.Unsetenv("IMAGE_LLM_ENDPOINT")
+	if err := CheckConfig(); err == nil {
+		t.Error("CheckConfig() should fail with no keys set")
+	}
+}
+
+// Helper function
+func contains(s, substr string) bool {
+	return len(s) >= len(substr) && (s == substr || len(s) > 0 && containsHelper(s, substr))
+}
+
+func containsHelper(s, substr string) bool {
+	for i := 0; i <= len(s)-len(substr); i++ {
+		if s[i:i+len(substr)] == substr {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCreateSmartBatches(t *testing.T) {
+	client, _ := NewClient("test-key")
+
+	tests := []struct {
+		name        string
+		imageSizes  []int64 // sizes in bytes
+		wantBatches int
+	}{
+		{
+			name:        "small images fit in one batch",
+			imageSizes:  []int64{100000, 200000, 300000}, // ~600KB total
+			wantBatches: 1,
+		},
+		{
+			name:        "images split by size limit",
+			imageSizes:  []int64{5000000, 5000000, 5000000, 5000000}, // 4x5MB = 20MB
+			wantBatches: 2,                                           // Should split due to payload size limit
+		},
+		{
+			name:        "many small images split by count",
+			imageSizes:  make([]int64, 25), // 25 small images
+			wantBatches: 2,                 // Should split at MaxImagesPerRequest (20)
+		},
+		{
+			name:        "single large image gets own batch",
+			imageSizes:  []int64{100000, 12000000, 100000}, // 100KB, 12MB, 100KB
+			wantBatches: 3,                                 // Large image needs its own batch
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Create mock ImageInfo slice
+			images := make([]*ImageInfo, len(tt.imageSizes))
+			for i, size := range tt.imageSizes {
+				if size == 0 {
+					size = 10000 // Default small size for count test
+				}
+				images[i] = &ImageInfo{
+					Path:      fmt.Sprintf("/fake/image_%d.png", i),
+					Filename:  fmt.Sprintf("image_%d.png", i),
+					Size:      size,
+					PageIndex: i,
+				}
+			}
+
+			batches := client.createSmartBatches(images)
+
+			if len(batches) != tt.wantBatches {
+				t.Errorf("createSmartBatches() created %d batches, want %d", len(batches), tt.wantBatches)
+				for i, batch := range batches {
+					totalSize := int64(0)
+					for _, img := range batch {
+						totalSize += img.Size
+					}
+					t.Logf("  Batch %d: %d images, %d bytes", i, len(batch), totalSize)
+				}
+			}
+
+			// Verify all images are accounted for
+			totalImages := 0
+			for _, batch := range batches {
+				totalImages += len(batch)
+			}
+			if totalImages != len(images) {
+				t.Errorf("Total images in batches = %d, want %d", totalImages, len(images))
+			}
+		})
+	}
+}
+
+func TestCreateSmartBatches_PayloadSizeLimit(t *testing.T) {
+	client, _ := NewClient("test-key")
+
+	// Create images that together exceed MaxPayloadSize
+	// MaxPayloadSize is 15MB, with 1.4x overhead factor
+	// So ~10.7MB of raw images should trigger a split
+	images := []*ImageInfo{
+		{Path: "/fake/1.png", Filename: "1.png", Size: 4000000, PageIndex: 0}, // 4MB
+		{Path: "/fake/2.png", Filename: "2.png", Size: 4000000, PageIndex: 1}, // 4MB
+		{Path: "/fake/3.png", Filename: "3.png", Size: 4000000, PageIndex: 2}, // 4MB -> total ~12MB raw, ~17MB with overhead
+		{Path: "/fake/4.png", Filename: "4.png", Size: 1000000, PageIndex: 3}, // 1MB
+	}
+
+	batches := client.createSmartBatches(images)
+
+	// Should create at least 2 batches due to size
+	if len(batches) < 2 {
+		t.Errorf("Expected at least 2 batches for large payload, got %d", len(batches))
+	}
+
+	// First batch should not exceed estimated payload limit
+	const overheadFactor = 1.4
+	for i, batch := range batches {
+		totalEstimated := int64(0)
+		for _, img := range batch {
+			totalEstimated += int64(float64(img.Size) * overheadFactor)
+		}
+		if totalEstimated > MaxPayloadSize && len(batch) > 1 {
+			t.Errorf("Batch %d estimated size %d exceeds MaxPayloadSize %d", i, totalEstimated, MaxPayloadSize)
+		}
+	}
+}
+
+func TestCreateSmartBatches_Overrides(t *testing.T) {
+	images := make([]*ImageInfo, 50)
+	for i := range images {
+		images[i] = &ImageInfo{
+			Path:      fmt.Sprintf("/fake/page_%02d.png", i+1),
+			Filename:  fmt.Sprintf("page_%02d.png", i+1),
+			Size:      100000, // 100KB, ~140KB estimated
+			PageIndex: i,
+		}
+	}
+
+	tests := []struct {
+		name        string
+		opts        []ClientOption
+		wantBatches int
+	}{
+		{"defaults", nil, 3},
+		{"larger batches", []ClientOption{WithBatchSize(50)}, 1},
+		{"smaller batches", []ClientOption{WithBatchSize(5)}, 10},
+		{"payload limit wins", []ClientOption{WithBatchSize(50), WithBatchPayloadSize(1400000)}, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient("test-key", tt.opts...)
+			if err != nil {
+				t.Fatalf("NewClient() failed: %v", err)
+			}
+			if got := len(client.createSmartBatches(images)); got != tt.wantBatches {
+				t.Errorf("createSmartBatches() created %d batches, want %d", got, tt.wantBatches)
+			}
+		})
+	}
+}
+
+func TestValidateBatchLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider Provider
+		size     int
+		payload  int64
+		wantErr  bool
+	}{
+		{"defaults", ProviderGemini, 0, 0, false},
+		{"gemini max images", ProviderGemini, GeminiMaxImagesPerRequest, 0, false},
+		{"gemini too many images", ProviderGemini, GeminiMaxImagesPerRequest + 1, 0, true},
+		{"gemini payload over inline limit", ProviderGemini, 0, MaxInlineRequestSize + 1, true},
+		{"anthropic too many images", ProviderAzureAnthropic, 101, 0, true},
+		{"anthropic larger payload", ProviderAzureAnthropic, 0, 30 * 1024 * 1024, false},
+		{"local ignores overrides", ProviderLocal, 10000, 1 << 30, false},
+		{"negative size", ProviderGemini, -1, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateBatchLimits(tt.provider, tt.size, tt.payload)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateBatchLimits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := NewClient("test-key", WithBatchSize(GeminiMaxImagesPerRequest+1)); err == nil {
+		t.Error("NewClient() accepted a batch size above the Gemini limit")
+	}
+}
+
+func TestCreateSmartBatches_PreservesOrder(t *testing.T) {
+	client, _ := NewClient("test-key")
+
+	// Create 25 images
+	images := make([]*ImageInfo, 25)
+	for i := 0; i < 25; i++ {
+		images[i] = &ImageInfo{
+			Path:      fmt.Sprintf("/fake/page_%02d.png", i+1),
+			Filename:  fmt.Sprintf("page_%02d.png", i+1),
+			Size:      100000,
+			PageIndex: i,
+		}
+	}
+
+	batches := client.createSmartBatches(images)
+
+	// Verify page order is preserved across batches
 	expectedIndex := 0
 	for _, batch := range batches {
 		for _, img := range batch {
 			if img.PageIndex != expectedIndex {
 				t.Errorf("Page order broken: expected index %d, got %d", expectedIndex, img.PageIndex)
 			}
-			expectedIndex++
+			expectedIndex++
+		}
+	}
+}
+
+// fakeImages builds ImageInfo entries of the given sizes for batching tests
+func fakeImages(sizes ...int64) []*ImageInfo {
+	images := make([]*ImageInfo, len(sizes))
+	for i, size := range sizes {
+		images[i] = &ImageInfo{
+			Path:      fmt.Sprintf("/fake/page_%03d.png", i+1),
+			Filename:  fmt.Sprintf("page_%03d.png", i+1),
+			Size:      size,
+			PageIndex: i,
+		}
+	}
+	return images
+}
+
+// repeatSize returns n copies of size
+func repeatSize(n int, size int64) []int64 {
+	sizes := make([]int64, n)
+	for i := range sizes {
+		sizes[i] = size
+	}
+	return sizes
+}
+
+// batchSizeDistributions are representative scan sets for the batching
+// tests and benchmarks
+var batchSizeDistributions = []struct {
+	name  string
+	sizes []int64
+}{
+	{"many tiny pages", repeatSize(100, 50*1024)},
+	{"1MB pages", repeatSize(40, 1<<20)},
+	{"a few huge pages", repeatSize(6, 8<<20)},
+	{"huge pages among tiny ones", append(append(repeatSize(3, 50*1024), 8<<20, 8<<20), repeatSize(3, 50*1024)...)},
+	{"single oversized image", []int64{50 * 1024, 50 * 1024, 15 << 20, 50 * 1024}},
+}
+
+func TestCreateSmartBatches_Distributions(t *testing.T) {
+	client, _ := NewClient("test-key")
+
+	want := map[string][]int{
+		// The images-per-request cap splits small pages
+		"many tiny pages": {20, 20, 20, 20, 20},
+		// 10 x 1.4MB estimated fills the 14MB payload
+		"1MB pages": {10, 10, 10, 10},
+		// Two 8MB pages never fit together
+		"a few huge pages":           {1, 1, 1, 1, 1, 1},
+		"huge pages among tiny ones": {4, 4},
+		// An image over the payload limit goes alone and the batch around
+		// it is split rather than reordered
+		"single oversized image": {2, 1, 1},
+	}
+
+	for _, dist := range batchSizeDistributions {
+		t.Run(dist.name, func(t *testing.T) {
+			batches := client.createSmartBatches(fakeImages(dist.sizes...))
+			got := make([]int, len(batches))
+			for i, batch := range batches {
+				got[i] = len(batch)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want[dist.name]) {
+				t.Errorf("createSmartBatches() batch sizes = %v, want %v", got, want[dist.name])
+			}
+		})
+	}
+}
+
+func TestCreateLocalLLMBatches(t *testing.T) {
+	client, _ := NewClient("test-key")
+
+	for _, dist := range batchSizeDistributions {
+		t.Run(dist.name, func(t *testing.T) {
+			images := fakeImages(dist.sizes...)
+			batches := client.createLocalLLMBatches(images)
+			if len(batches) != len(images) {
+				t.Fatalf("createLocalLLMBatches() created %d batches, want one per image (%d)", len(batches), len(images))
+			}
+			for i, batch := range batches {
+				if len(batch) != 1 || batch[0] != images[i] {
+					t.Errorf("batch %d = %v, want only image %d", i, batch, i)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCreateSmartBatches(b *testing.B) {
+	client, _ := NewClient("test-key")
+	for _, dist := range batchSizeDistributions {
+		images := fakeImages(dist.sizes...)
+		b.Run(dist.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				client.createSmartBatches(images)
+			}
+		})
+	}
+
+	// A full-size job at the MaxTotalImages limit
+	images := fakeImages(repeatSize(MaxTotalImages, 700*1024)...)
+	b.Run("max job", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			client.createSmartBatches(images)
+		}
+	})
+}
+
+func BenchmarkCreateLocalLLMBatches(b *testing.B) {
+	client, _ := NewClient("test-key")
+	images := fakeImages(repeatSize(MaxTotalImages, 700*1024)...)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		client.createLocalLLMBatches(images)
+	}
+}
+
+func TestLocalResizeFromEnv(t *testing.T) {
+	tests := []struct {
+		name                    string
+		maxDim, quality, thresh string
+		want                    LocalResizeOptions
+		wantErr                 bool
+	}{
+		{
+			name: "defaults",
+			want: DefaultLocalResizeOptions(),
+		},
+		{
+			name:    "overrides",
+			maxDim:  "1536",
+			quality: "92",
+			thresh:  "2M",
+			want: LocalResizeOptions{
+				ResizeOptions: ResizeOptions{MaxWidth: 1536, MaxHeight: 1536, Quality: 92},
+				Threshold:     2 << 20,
+			},
+		},
+		{
+			name:   "none disables resizing",
+			maxDim: "none",
+			want: LocalResizeOptions{
+				ResizeOptions: ResizeOptions{Quality: 80},
+				Threshold:     500 * 1024,
+			},
+		},
+		{name: "bad dimension", maxDim: "big", wantErr: true},
+		{name: "negative dimension", maxDim: "-1", wantErr: true},
+		{name: "quality out of range", quality: "101", wantErr: true},
+		{name: "bad threshold", thresh: "lots", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(ImageMaxDimEnvVar, tt.maxDim)
+			t.Setenv(ImageQualityEnvVar, tt.quality)
+			t.Setenv(ImageResizeThresholdEnvVar, tt.thresh)
+
+			got, err := LocalResizeFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LocalResizeFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("LocalResizeFromEnv() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalResizeOptions_Load(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "page.jpg")
+	writeTestImage(t, path, 200, 100)
+	original, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		opts      LocalResizeOptions
+		wantWidth int
+	}{
+		{"over threshold is resized", LocalResizeOptions{ResizeOptions: ResizeOptions{MaxWidth: 50, MaxHeight: 50}}, 50},
+		{"under threshold is kept", LocalResizeOptions{ResizeOptions: ResizeOptions{MaxWidth: 50, MaxHeight: 50}, Threshold: 1 << 20}, 200},
+		{"full size is kept", NoLocalResize(), 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, mimeType, err := tt.opts.load(path)
+			if err != nil {
+				t.Fatalf("load() error = %v", err)
+			}
+			if mimeType != "image/jpeg" {
+				t.Errorf("mimeType = %q, want image/jpeg", mimeType)
+			}
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if cfg.Width != tt.wantWidth {
+				t.Errorf("width = %d, want %d", cfg.Width, tt.wantWidth)
+			}
+			if tt.wantWidth == 200 && !bytes.Equal(data, original) {
+				t.Error("image was re-encoded, want the original bytes")
+			}
+		})
+	}
+}
+
+func TestResizeImageIfNeeded_Formats(t *testing.T) {
+	dir := t.TempDir()
+	pngPath := filepath.Join(dir, "scan.png")
+	writeTestImage(t, pngPath, 400, 200)
+	jpgPath := filepath.Join(dir, "photo.jpg")
+	writeTestImage(t, jpgPath, 400, 200)
+
+	tests := []struct {
+		name      string
+		path      string
+		maxBytes  int64
+		opts      ResizeOptions
+		wantMIME  string
+		wantWidth int
+	}{
+		{"png stays png when it fits", pngPath, 1 << 10, ResizeOptions{MaxWidth: 100}, "image/png", 100},
+		{"png falls back to jpeg over the target", pngPath, 1, ResizeOptions{MaxWidth: 100}, "image/jpeg", 100},
+		{"png forced", pngPath, 1, ResizeOptions{MaxWidth: 100, Format: ImageFormatPNG}, "image/png", 100},
+		{"jpeg forced", pngPath, 1 << 10, ResizeOptions{MaxWidth: 100, Format: ImageFormatJPEG}, "image/jpeg", 100},
+		{"within limits is untouched", pngPath, 1, ResizeOptions{MaxWidth: 800, Format: ImageFormatPNG}, "image/png", 400},
+		{"jpeg source stays jpeg", jpgPath, 1, ResizeOptions{MaxWidth: 100}, "image/jpeg", 100},
+		{"height limit scales width", jpgPath, 1, ResizeOptions{MaxWidth: 1000, MaxHeight: 50}, "image/jpeg", 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, mimeType, err := ResizeImageIfNeeded(tt.path, tt.maxBytes, tt.opts)
+			if err != nil {
+				t.Fatalf("ResizeImageIfNeeded() error = %v", err)
+			}
+			if mimeType != tt.wantMIME {
+				t.Errorf("mimeType = %q, want %q", mimeType, tt.wantMIME)
+			}
+			cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if "image/"+format != tt.wantMIME {
+				t.Errorf("data is %s, want %s", format, tt.wantMIME)
+			}
+			if cfg.Width != tt.wantWidth {
+				t.Errorf("width = %d, want %d", cfg.Width, tt.wantWidth)
+			}
+		})
+	}
+}
+
+func TestEncodeJPEG_TransparentBecomesWhite(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8)) // fully transparent
+	data, _, err := encodeJPEG(img, 90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, g, b, _ := decoded.At(4, 4).RGBA()
+	if r>>8 < 250 || g>>8 < 250 || b>>8 < 250 {
+		t.Errorf("transparent pixel = (%d, %d, %d), want white", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestThinkingBudgetFromEnv(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "", want: 0},
+		{value: "4096", want: 4096},
+		{value: "dynamic", want: DynamicThinkingBudget},
+		{value: "Dynamic", want: DynamicThinkingBudget},
+		{value: "0", wantErr: true},
+		{value: "-5", wantErr: true},
+		{value: "lots", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv(ThinkingBudgetEnvVar, tt.value)
+			got, err := ThinkingBudgetFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ThinkingBudgetFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ThinkingBudgetFromEnv() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessBatchGemini_Thinking(t *testing.T) {
+	tests := []struct {
+		name          string
+		model         string
+		budget        int
+		wantPath      string
+		wantBudget    *int
+		wantMaxTokens int
+	}{
+		{name: "regular model", model: ModelGemini3Pro, wantPath: "/models/" + ModelGemini3Pro + ":generateContent", wantMaxTokens: DefaultMaxOutputTokens},
+		{name: "thinking default budget", model: ModelGemini3ProThinking, wantPath: "/models/" + ModelGemini3Pro + ":generateContent", wantBudget: intPtr(DefaultThinkingBudget), wantMaxTokens: DefaultMaxOutputTokens + DefaultThinkingBudget},
+		{name: "thinking custom budget", model: ModelGemini3ProThinking, budget: 2048, wantPath: "/models/" + ModelGemini3Pro + ":generateContent", wantBudget: intPtr(2048), wantMaxTokens: DefaultMaxOutputTokens + 2048},
+		{name: "thinking dynamic", model: ModelGemini3ProThinking, budget: DynamicThinkingBudget, wantPath: "/models/" + ModelGemini3Pro + ":generateContent", wantBudget: intPtr(DynamicThinkingBudget), wantMaxTokens: GeminiMaxOutputTokens},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath string
+			var got GenerateContentRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				json.NewDecoder(r.Body).Decode(&got)
+				json.NewEncoder(w).Encode(GenerateContentResponse{
+					Candidates: []*Candidate{{Content: &Content{Parts: []*Part{
+						{Text: "Looking at the page layout first", Thought: true},
+						{Text: `{"pages": [{"page_number": 1, "text": "ok"}]}`},
+					}}}},
+				})
+			}))
+			defer server.Close()
+
+			client, err := NewClient("test-key", WithBaseURL(server.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(t.TempDir(), "page1.png")
+			writeTestImage(t, path, 10, 10)
+			img, err := client.getImageInfo(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pages, _, err := client.processBatchGemini(context.Background(), []*ImageInfo{img}, &TranscribeRequest{ThinkingBudget: tt.budget}, tt.model, DefaultMaxOutputTokens)
+			if err != nil {
+				t.Fatalf("processBatchGemini() failed: %v", err)
+			}
+			if len(pages) != 1 || pages[0].Text != "ok" {
+				t.Errorf("pages = %+v, want the answer without the thought summary", pages)
+			}
+
+			if gotPath != tt.wantPath {
+				t.Errorf("path = %q, want %q", gotPath, tt.wantPath)
+			}
+			cfg := got.GenerationConfig
+			if cfg.MaxOutputTokens == nil || *cfg.MaxOutputTokens != tt.wantMaxTokens {
+				t.Errorf("maxOutputTokens = %v, want %d", cfg.MaxOutputTokens, tt.wantMaxTokens)
+			}
+			switch {
+			case tt.wantBudget == nil && cfg.ThinkingConfig != nil:
+				t.Errorf("thinkingConfig = %+v, want none", cfg.ThinkingConfig)
+			case tt.wantBudget != nil && (cfg.ThinkingConfig == nil || cfg.ThinkingConfig.ThinkingBudget == nil):
+				t.Errorf("thinkingConfig missing, want budget %d", *tt.wantBudget)
+			case tt.wantBudget != nil && *cfg.ThinkingConfig.ThinkingBudget != *tt.wantBudget:
+				t.Errorf("thinkingBudget = %d, want %d", *cfg.ThinkingConfig.ThinkingBudget, *tt.wantBudget)
+			}
+		})
+	}
+}
+
+func TestDefaultModelFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider Provider
+		env      map[string]string
+		want     string
+	}{
+		{name: "gemini", provider: ProviderGemini, want: ModelGemini3Pro},
+		{name: "unknown provider", provider: "", want: ModelGemini3Pro},
+		{name: "local fallback", provider: ProviderLocal, want: DefaultLocalModel},
+		{name: "local LLM_MODEL", provider: ProviderLocal, env: map[string]string{"LLM_MODEL": "llava"}, want: "llava"},
+		{name: "local image model wins", provider: ProviderLocal, env: map[string]string{"LLM_MODEL": "llava", "IMAGE_LLM_MODEL": "qwen-vl"}, want: "qwen-vl"},
+		{name: "local vision model wins", provider: ProviderLocal, env: map[string]string{"IMAGE_LLM_MODEL": "qwen-vl", "IMAGE_VISION_MODEL": "minicpm-v"}, want: "minicpm-v"},
+		{name: "azure fallback", provider: ProviderAzureAnthropic, want: DefaultAnthropicModel},
+		{name: "azure env", provider: ProviderAzureAnthropic, env: map[string]string{"AZURE_ANTHROPIC_MODEL": "claude-3-haiku-20240307"}, want: "claude-3-haiku-20240307"},
+		{name: "anthropic fallback", provider: ProviderAnthropic, want: DefaultAnthropicModel},
+		{name: "anthropic env", provider: ProviderAnthropic, env: map[string]string{"ANTHROPIC_MODEL": "claude-opus-4-1"}, want: "claude-opus-4-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"LLM_MODEL", "IMAGE_LLM_MODEL", "IMAGE_VISION_MODEL", "AZURE_ANTHROPIC_MODEL", "ANTHROPIC_MODEL"} {
+				t.Setenv(name, tt.env[name])
+			}
+			if got := DefaultModelFor(tt.provider); got != tt.want {
+				t.Errorf("DefaultModelFor(%q) = %q, want %q", tt.provider, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranscribeImages_EmptyModelUsesDefault(t *testing.T) {
+	t.Run("local", func(t *testing.T) {
+		var gotModel string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req LocalLLMRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			gotModel = req.Model
+			json.NewEncoder(w).Encode(LocalLLMResponse{
+				Choices: []LocalLLMChoice{{Message: LocalLLMChoiceMessage{Content: `{"pages": [{"page_number": 1, "text": "ok"}]}`}}},
+			})
+		}))
+		defer server.Close()
+
+		client, err := NewLocalClient(server.URL, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "page1.png")
+		writeTestImage(t, path, 10, 10)
+		if _, err := client.TranscribeImages(context.Background(), &TranscribeRequest{Images: []string{path}}); err != nil {
+			t.Fatalf("TranscribeImages() failed: %v", err)
+		}
+		if gotModel != DefaultLocalModel {
+			t.Errorf("request model = %q, want %q", gotModel, DefaultLocalModel)
+		}
+	})
+
+	t.Run("gemini", func(t *testing.T) {
+		var gotPath string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotPath = r.URL.Path
+			json.NewEncoder(w).Encode(GenerateContentResponse{
+				Candidates: []*Candidate{{Content: &Content{Parts: []*Part{{Text: `{"pages": [{"page_number": 1, "text": "ok"}]}`}}}}},
+			})
+		}))
+		defer server.Close()
+
+		client, err := NewClient("test-key", WithBaseURL(server.URL))
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "page1.png")
+		writeTestImage(t, path, 10, 10)
+		if _, err := client.TranscribeImages(context.Background(), &TranscribeRequest{Images: []string{path}}); err != nil {
+			t.Fatalf("TranscribeImages() failed: %v", err)
+		}
+		if want := "/models/" + ModelGemini3Pro + ":generateContent"; gotPath != want {
+			t.Errorf("request path = %q, want %q", gotPath, want)
+		}
+	})
+}
+
+func TestStripRunningHeads(t *testing.T) {
+	book := func() []*PageContent {
+		return []*PageContent{
+			{PageNumber: 1, Text: "# Chapter 1\n\nIt was a dark night.\n\nPage 1", IsChapterStart: true, ChapterTitle: "Chapter 1"},
+			{PageNumber: 2, Text: "THE GREAT NOVEL\n\nThe wind howled.\n\nPage 2"},
+			{PageNumber: 3, Text: "The Great Novel\n\nA door creaked.\n\n**Page 3**"},
+			{PageNumber: 4, Text: "THE GREAT N0VEL\n\nSomeone knocked.\n\nPage 4"},
+			{PageNumber: 5, Text: "The Great Novel\n\nNobody answered."},
+		}
+	}
+
+	t.Run("headers and footers", func(t *testing.T) {
+		pages := book()
+		removed := StripRunningHeads(pages)
+		want := []string{
+			"# Chapter 1\n\nIt was a dark night.",
+			"The wind howled.",
+			"A door creaked.",
+			"Someone knocked.",
+			"Nobody answered.",
+		}
+		for i, page := range pages {
+			if page.Text != want[i] {
+				t.Errorf("page %d = %q, want %q", page.PageNumber, page.Text, want[i])
+			}
+		}
+		if removed != 8 {
+			t.Errorf("removed = %d, want 8", removed)
+		}
+	})
+
+	t.Run("chapter title kept", func(t *testing.T) {
+		pages := []*PageContent{
+			{PageNumber: 1, Text: "Chapter One\n\nThe ship left at dawn.", IsChapterStart: true, ChapterTitle: "Chapter One"},
+			{PageNumber: 2, Text: "Chapter One\n\nGulls followed it out."},
+			{PageNumber: 3, Text: "Chapter One\n\nBy noon the coast was gone."},
+			{PageNumber: 4, Text: "Chapter One\n\nThen the storm came."},
+		}
+		StripRunningHeads(pages)
+		if pages[0].Text != "Chapter One\n\nThe ship left at dawn." {
+			t.Errorf("chapter start page = %q, want the title kept", pages[0].Text)
+		}
+		if pages[1].Text != "Gulls followed it out." {
+			t.Errorf("page 2 = %q, want the running head removed", pages[1].Text)
+		}
+	})
+
+	t.Run("nothing repeated", func(t *testing.T) {
+		pages := []*PageContent{
+			{PageNumber: 1, Text: "Alpha\n\nOne."},
+			{PageNumber: 2, Text: "Beta\n\nTwo."},
+			{PageNumber: 3, Text: "Gamma\n\nThree."},
+		}
+		if removed := StripRunningHeads(pages); removed != 0 {
+			t.Errorf("removed = %d, want 0", removed)
+		}
+		if pages[0].Text != "Alpha\n\nOne." {
+			t.Errorf("page 1 = %q, want it unchanged", pages[0].Text)
+		}
+	})
+
+	t.Run("too few pages", func(t *testing.T) {
+		pages := []*PageContent{
+			{PageNumber: 1, Text: "Title\n\nOne."},
+			{PageNumber: 2, Text: "Title\n\nTwo."},
+		}
+		if removed := StripRunningHeads(pages); removed != 0 {
+			t.Errorf("removed = %d, want 0", removed)
+		}
+	})
+}
+
+func TestStreamWriter_StripRunningHeadsWritesAtClose(t *testing.T) {
+	dir := t.TempDir()
+	stream, err := NewStreamWriter(&TranscribeRequest{StripRunningHeads: true}, WriteOptions{OutputDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.AddBatch(0, []*PageContent{{PageNumber: 1, Text: "one"}})
+	if _, err := os.Stat(filepath.Join(dir, "page_001.md")); err == nil {
+		t.Error("page written before Close; running heads aren't known until every page is in")
+	}
+	if _, err := stream.Close(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "page_001.md")); err != nil {
+		t.Errorf("page_001.md not written at Close: %v", err)
+	}
+}
+
+func TestTranscribeImagesStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		choice := LocalLLMChoice{FinishReason: "stop"}
+		choice.Message.Content = `{"pages": [{"text": "page"}]}`
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(LocalLLMResponse{Choices: []LocalLLMChoice{choice}})
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	var images []string
+	for i := 0; i < 2; i++ {
+		path := filepath.Join(tmpDir, fmt.Sprintf("page%d.png", i))
+		if err := os.WriteFile(path, []byte("fake png data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, path)
+	}
+	client, _ := NewLocalClient(server.URL, "test-model")
+
+	t.Run("success", func(t *testing.T) {
+		progress, results := client.TranscribeImagesStream(context.Background(), &TranscribeRequest{Images: images})
+		var last ProgressUpdate
+		updates := 0
+		for update := range progress {
+			last = update
+			updates++
+		}
+		if updates == 0 || last.Status != StatusComplete {
+			t.Errorf("got %d updates ending in %s, want them to end in complete", updates, last.Status)
+		}
+		result, ok := <-results
+		if !ok {
+			t.Fatal("results closed without a result")
+		}
+		if result.Err != nil {
+			t.Fatalf("TranscribeImagesStream() failed: %v", result.Err)
+		}
+		if len(result.Response.Pages) != 2 {
+			t.Errorf("got %d pages, want 2", len(result.Response.Pages))
+		}
+		if _, ok := <-results; ok {
+			t.Error("results delivered more than one result")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		progress, results := client.TranscribeImagesStream(context.Background(), &TranscribeRequest{})
+		for range progress {
+		}
+		if result := <-results; result.Err == nil || result.Response != nil {
+			t.Errorf("result = %+v, want an error for no images", result)
+		}
+	})
+}
+
+func TestTranscribeImages_ResumeFrom(t *testing.T) {
+	var requests atomic.Int32
+	var reply atomic.Value
+	reply.Store("first run")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		choice := LocalLLMChoice{FinishReason: "stop"}
+		choice.Message.Content = fmt.Sprintf(`{"pages": [{"text": %q}]}`, reply.Load().(string))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(LocalLLMResponse{Choices: []LocalLLMChoice{choice}})
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	var images []string
+	for i := 0; i < 4; i++ {
+		path := filepath.Join(tmpDir, fmt.Sprintf("page%d.png", i))
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("fake png data %d", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, path)
+	}
+	checkpointDir := filepath.Join(tmpDir, "checkpoint")
+	client, _ := NewLocalClient(server.URL, "test-model")
+
+	resp, err := client.TranscribeImages(context.Background(), &TranscribeRequest{Images: images, ResumeFrom: checkpointDir})
+	if err != nil {
+		t.Fatalf("first run failed: %v", err)
+	}
+	if resp.ResumedBatches != 0 || requests.Load() != 4 {
+		t.Fatalf("first run resumed %d batches with %d requests, want 0 and 4", resp.ResumedBatches, requests.Load())
+	}
+	saved, _ := filepath.Glob(filepath.Join(checkpointDir, "batch-*.json"))
+	if len(saved) != 4 {
+		t.Fatalf("checkpoint holds %d batches, want 4", len(saved))
+	}
+
+	// Editing an image makes its batch stale, while touching one doesn't;
+	// the others come from the checkpoint
+	if err := os.WriteFile(images[1], []byte("rescanned png data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(images[2], later, later); err != nil {
+		t.Fatal(err)
+	}
+	requests.Store(0)
+	reply.Store("second run")
+	resp, err = client.TranscribeImages(context.Background(), &TranscribeRequest{Images: images, ResumeFrom: checkpointDir})
+	if err != nil {
+		t.Fatalf("second run failed: %v", err)
+	}
+	if resp.ResumedBatches != 3 || requests.Load() != 1 {
+		t.Errorf("second run resumed %d batches with %d requests, want 3 and 1", resp.ResumedBatches, requests.Load())
+	}
+	if len(resp.Pages) != 4 {
+		t.Fatalf("got %d pages, want 4", len(resp.Pages))
+	}
+	for i, page := range resp.Pages {
+		want := "first run"
+		if i == 1 {
+			want = "second run"
+		}
+		if page.PageNumber != i+1 || page.Text != want {
+			t.Errorf("page %d = %d %q, want %d %q", i, page.PageNumber, page.Text, i+1, want)
+		}
+	}
+
+	// A page added in front shifts the restored batches' page numbers
+	cover := filepath.Join(tmpDir, "cover.png")
+	if err := os.WriteFile(cover, []byte("fake png data 0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = client.TranscribeImages(context.Background(), &TranscribeRequest{Images: append([]string{cover}, images...), ResumeFrom: checkpointDir})
+	if err != nil {
+		t.Fatalf("third run failed: %v", err)
+	}
+	if resp.ResumedBatches != 5 {
+		t.Errorf("third run resumed %d batches, want 5", resp.ResumedBatches)
+	}
+	for i, page := range resp.Pages {
+		if page.PageNumber != i+1 {
+			t.Errorf("page %d numbered %d, want %d", i, page.PageNumber, i+1)
+		}
+	}
+
+	// An option that changes the transcription misses the checkpoint
+	requests.Store(0)
+	resp, err = client.TranscribeImages(context.Background(), &TranscribeRequest{Images: images, ResumeFrom: checkpointDir, Language: "German"})
+	if err != nil {
+		t.Fatalf("fourth run failed: %v", err)
+	}
+	if resp.ResumedBatches != 0 || requests.Load() != 4 {
+		t.Errorf("run in another language resumed %d batches with %d requests, want 0 and 4", resp.ResumedBatches, requests.Load())
+	}
+}
+
+func TestTranscribeImages_ResumeZip(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		choice := LocalLLMChoice{FinishReason: "stop"}
+		choice.Message.Content = `{"pages": [{"text": "page"}]}`
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(LocalLLMResponse{Choices: []LocalLLMChoice{choice}})
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	archive := filepath.Join(tmpDir, "scans.zip")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for i := 1; i <= 3; i++ {
+		w, err := zw.Create(fmt.Sprintf("page%d.png", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(w, "fake png data %d", i)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	checkpointDir := filepath.Join(tmpDir, "checkpoint")
+	client, _ := NewLocalClient(server.URL, "test-model")
+
+	// Each run extracts the archive to a new temp dir, as separate
+	// invocations of capycut would
+	run := func() *TranscribeResponse {
+		t.Helper()
+		defer CleanupTempFiles()
+		images, err := LoadImages([]string{archive})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.TranscribeImages(context.Background(), &TranscribeRequest{Images: images, ResumeFrom: checkpointDir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := run(); resp.ResumedBatches != 0 || requests.Load() != 3 {
+		t.Fatalf("first run resumed %d batches with %d requests, want 0 and 3", resp.ResumedBatches, requests.Load())
+	}
+	requests.Store(0)
+	if resp := run(); resp.ResumedBatches != 3 || requests.Load() != 0 {
+		t.Errorf("second run resumed %d batches with %d requests, want 3 and 0", resp.ResumedBatches, requests.Load())
+	}
+}
+
+func TestPricingFor(t *testing.T) {
+	tests := []struct {
+		model string
+		want  float64 // input price; 0 means unpriced
+	}{
+		{ModelGemini3Pro, 2.00},
+		{ModelGemini3ProThinking, 2.00},
+		{ModelGemini25Flash, 0.30},
+		{ModelGemini20Flash, 0.10},
+		{"claude-sonnet-4-5-20250514", 3.00},
+		{"Claude-3-Haiku-20240307", 0.25},
+		{"qwen2.5-vl-7b", 0},
+	}
+	for _, tt := range tests {
+		pricing, ok := PricingFor(tt.model)
+		if ok != (tt.want > 0) || pricing.InputPerMillion != tt.want {
+			t.Errorf("PricingFor(%q) = %v, %v, want input price %v", tt.model, pricing, ok, tt.want)
+		}
+	}
+}
+
+func TestEstimateTranscription(t *testing.T) {
+	dir := t.TempDir()
+	page := filepath.Join(dir, "01.png")
+	small := filepath.Join(dir, "02.png")
+	spread := filepath.Join(dir, "03.png")
+	writeTestImage(t, page, 1536, 1536)
+	writeTestImage(t, small, 300, 300)
+	writeTestImage(t, spread, 2000, 1000)
+
+	gem, err := NewClient("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2x2 tiles for the page and one for the small image, plus the prompt
+	est, err := gem.EstimateTranscription(&TranscribeRequest{Images: []string{page, small}, Model: ModelGemini20Flash})
+	if err != nil {
+		t.Fatalf("EstimateTranscription() failed: %v", err)
+	}
+	if est.Pages != 2 || est.Batches != 1 {
+		t.Errorf("got %d pages in %d batches, want 2 in 1", est.Pages, est.Batches)
+	}
+	if imageTokens := 5 * geminiTileTokens; est.InputTokens <= imageTokens || est.InputTokens > imageTokens+2000 {
+		t.Errorf("InputTokens = %d, want the %d image tokens plus a prompt", est.InputTokens, imageTokens)
+	}
+	if est.OutputTokens != 2*estimatedOutputTokensPerPage {
+		t.Errorf("OutputTokens = %d, want %d", est.OutputTokens, 2*estimatedOutputTokensPerPage)
+	}
+	if !est.PricingKnown || est.Cost <= 0 || est.Duration <= 0 {
+		t.Errorf("estimate = %+v, want a known cost and a duration", est)
+	}
+
+	// Gemini 3 charges a flat rate per image; thinking adds its budget
+	flat, err := gem.EstimateTranscription(&TranscribeRequest{Images: []string{page, small}, Model: ModelGemini3Pro})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := flat.InputTokens - est.InputTokens; diff != 2*gemini3ImageTokens-5*geminiTileTokens {
+		t.Errorf("Gemini 3 input tokens differ by %d, want the flat per-image rate", diff)
+	}
+	thinking, err := gem.EstimateTranscription(&TranscribeRequest{Images: []string{page, small}, Model: ModelGemini3ProThinking, ThinkingBudget: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thinking.OutputTokens != flat.OutputTokens+1000 {
+		t.Errorf("thinking OutputTokens = %d, want %d", thinking.OutputTokens, flat.OutputTokens+1000)
+	}
+
+	// Spreads count as two pages when they'll be split
+	split, err := gem.EstimateTranscription(&TranscribeRequest{Images: []string{page, spread}, Model: ModelGemini20Flash, SplitSpreads: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if split.Pages != 3 {
+		t.Errorf("split Pages = %d, want 3", split.Pages)
+	}
+
+	local, err := NewLocalClient("http://localhost:1234", "qwen2.5-vl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	est, err = local.EstimateTranscription(&TranscribeRequest{Images: []string{page, small}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if est.Batches != 2 || est.Cost != 0 || est.InputTokens == 0 {
+		t.Errorf("local estimate = %+v, want 2 free batches with tokens", est)
+	}
+	if got := est.Summary(ProviderLocal); !strings.Contains(got, "free") || !strings.Contains(got, "2 batches") {
+		t.Errorf("Summary() = %q, want a free run in 2 batches", got)
+	}
+
+	claude, err := NewAzureAnthropicClient("https://example.azure.com", "key", "claude-next")
+	if err != nil {
+		t.Fatal(err)
+	}
+	est, err = claude.EstimateTranscription(&TranscribeRequest{Images: []string{page}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if est.PricingKnown || est.Cost != 0 {
+		t.Errorf("unpriced model estimate = %+v, want no cost", est)
+	}
+	if got := est.Summary(ProviderAzureAnthropic); !strings.Contains(got, "cost unknown for claude-next") || !strings.Contains(got, "1 batch,") {
+		t.Errorf("Summary() = %q, want an unknown cost in 1 batch", got)
+	}
+
+	if _, err := gem.EstimateTranscription(&TranscribeRequest{}); err == nil {
+		t.Error("EstimateTranscription() with no images succeeded, want an error")
+	}
+	if _, err := gem.EstimateTranscription(&TranscribeRequest{Images: []string{filepath.Join(dir, "missing.png")}}); err == nil {
+		t.Error("EstimateTranscription() with a missing image succeeded, want an error")
+	}
+}
+
+func TestImageTokens(t *testing.T) {
+	img := &ImageInfo{Width: 3000, Height: 1500, Size: 2 << 20}
+	req := &TranscribeRequest{}
+
+	claude := &Client{provider: ProviderAzureAnthropic}
+	if got, want := claude.imageTokens(img, "", req), 1568*784/anthropicPixelsPerToken; got != want {
+		t.Errorf("Claude imageTokens() = %d, want %d", got, want)
+	}
+
+	// Local images over the threshold are shrunk to 768px first
+	local := &Client{provider: ProviderLocal}
+	if got, want := local.imageTokens(img, "", req), (768/localPatchSize)*(384/localPatchSize); got != want {
+		t.Errorf("local imageTokens() = %d, want %d", got, want)
+	}
+	full := NoLocalResize()
+	if got, want := local.imageTokens(img, "", &TranscribeRequest{LocalResize: &full}), (3000/localPatchSize)*(1500/localPatchSize); got != want {
+		t.Errorf("full-size local imageTokens() = %d, want %d", got, want)
+	}
+}
+
+func TestFormatRoughDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "1s"},
+		{42 * time.Second, "42s"},
+		{150 * time.Second, "3m"},
+		{95 * time.Minute, "1h 35m"},
+	}
+	for _, tt := range tests {
+		if got := formatRoughDuration(tt.d); got != tt.want {
+			t.Errorf("formatRoughDuration(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestConcurrencyFromEnv(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "", want: 0},
+		{value: "8", want: 8},
+		{value: " 1 ", want: 1},
+		{value: "50", want: 50},
+		{value: "0", wantErr: true},
+		{value: "-2", wantErr: true},
+		{value: "many", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv(ConcurrencyEnvVar, tt.value)
+			got, err := ConcurrencyFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ConcurrencyFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ConcurrencyFromEnv() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchConcurrency(t *testing.T) {
+	tests := []struct {
+		concurrency int
+		want        int
+		wantCapped  bool
+	}{
+		{0, MaxConcurrentRequests, false},
+		{1, 1, false},
+		{MaxConcurrency, MaxConcurrency, false},
+		{MaxConcurrency + 1, MaxConcurrency, true},
+	}
+	for _, tt := range tests {
+		got, capped := batchConcurrency(&TranscribeRequest{Concurrency: tt.concurrency})
+		if got != tt.want || capped != tt.wantCapped {
+			t.Errorf("batchConcurrency(%d) = %d, %v, want %d, %v", tt.concurrency, got, capped, tt.want, tt.wantCapped)
+		}
+	}
+}
+
+func TestTranscribeImages_Concurrency(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		json.NewEncoder(w).Encode(LocalLLMResponse{
+			Choices: []LocalLLMChoice{{Message: LocalLLMChoiceMessage{Content: `{"pages": [{"page_number": 1, "text": "ok"}]}`}}},
+		})
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	var images []string
+	for i := 0; i < 6; i++ {
+		path := filepath.Join(tmpDir, fmt.Sprintf("page%d.png", i))
+		if err := os.WriteFile(path, []byte("fake png data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, path)
+	}
+	client, _ := NewLocalClient(server.URL, "test-model")
+
+	// One page per batch for local models, so six batches
+	for _, concurrency := range []int{1, 6} {
+		peak.Store(0)
+		resp, err := client.TranscribeImages(context.Background(), &TranscribeRequest{Images: images, Concurrency: concurrency})
+		if err != nil {
+			t.Fatalf("Concurrency %d: TranscribeImages() failed: %v", concurrency, err)
+		}
+		if resp.CompletedPages != 6 {
+			t.Errorf("Concurrency %d: %d pages, want 6", concurrency, resp.CompletedPages)
+		}
+		if got := int(peak.Load()); got > concurrency || (concurrency > 1 && got < 2) {
+			t.Errorf("Concurrency %d: %d requests in flight at once", concurrency, got)
+		}
+	}
+
+	if _, err := client.TranscribeImages(context.Background(), &TranscribeRequest{Images: images, Concurrency: -1}); err == nil {
+		t.Error("TranscribeImages() with negative concurrency succeeded, want an error")
+	}
+}
+
+// shortenRetryBackoff makes batch retries wait milliseconds for the rest
+// of the test
+func shortenRetryBackoff(t *testing.T) {
+	t.Helper()
+	saved := retryBackoff
+	retryBackoff = []time.Duration{time.Millisecond, 2 * time.Millisecond}
+	t.Cleanup(func() { retryBackoff = saved })
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"rate limited", &APIError{StatusCode: http.StatusTooManyRequests}, true},
+		{"server error", fmt.Errorf("batch: %w", &APIError{StatusCode: http.StatusBadGateway}), true},
+		{"bad request", &APIError{StatusCode: http.StatusBadRequest}, false},
+		{"unauthorized", &APIError{StatusCode: http.StatusUnauthorized}, false},
+		{"request timeout", &APIError{StatusCode: http.StatusRequestTimeout}, true},
+		{"connection dropped", fmt.Errorf("request failed: %w", &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}), true},
+		{"connection refused", &url.Error{Op: "Post", URL: "http://localhost:1234", Err: syscall.ECONNREFUSED}, true},
+		{"truncated body", fmt.Errorf("failed to read response: %w", io.ErrUnexpectedEOF), true},
+		{"missing image", fmt.Errorf("failed to read page.png: %w", &fs.PathError{Op: "open", Path: "page.png", Err: fs.ErrNotExist}), false},
+		{"invalid request", errors.New("no images provided"), false},
+		{"cancelled", fmt.Errorf("request failed: %w", context.Canceled), false},
+		{"timed out", context.DeadlineExceeded, false},
+	}
+	for _, tt := range tests {
+		if got := isRetryable(tt.err); got != tt.want {
+			t.Errorf("isRetryable(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	if got := retryWait(0, errors.New("boom")); got != retryBackoff[0] {
+		t.Errorf("retryWait(0) = %v, want %v", got, retryBackoff[0])
+	}
+	if got := retryWait(10, errors.New("boom")); got != retryBackoff[len(retryBackoff)-1] {
+		t.Errorf("retryWait(10) = %v, want the last step", got)
+	}
+	if got := retryWait(0, &APIError{StatusCode: 429, RetryAfter: 7 * time.Second}); got != 7*time.Second {
+		t.Errorf("retryWait(Retry-After 7s) = %v, want 7s", got)
+	}
+	if got := retryWait(0, &APIError{StatusCode: 429, RetryAfter: time.Hour}); got != maxRetryAfter {
+		t.Errorf("retryWait(Retry-After 1h) = %v, want the %v cap", got, maxRetryAfter)
+	}
+}
+
+func TestTranscribeImages_RetriesFailingBatch(t *testing.T) {
+	shortenRetryBackoff(t)
+
+	// page2 is rate limited twice; the other pages succeed first time
+	var mu sync.Mutex
+	calls := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		page := "other"
+		if bytes.Contains(body, []byte(base64.StdEncoding.EncodeToString([]byte("page2 data")))) {
+			page = "page2"
+		}
+		mu.Lock()
+		calls[page]++
+		n := calls[page]
+		mu.Unlock()
+
+		if page == "page2" && n <= 2 {
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+			return
+		}
+		json.NewEncoder(w).Encode(LocalLLMResponse{
+			Choices: []LocalLLMChoice{{Message: LocalLLMChoiceMessage{Content: `{"pages": [{"page_number": 1, "text": "ok"}]}`}}},
+		})
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	var images []string
+	for i := 0; i < 4; i++ {
+		path := filepath.Join(tmpDir, fmt.Sprintf("page%d.png", i))
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("page%d data", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, path)
+	}
+	client, _ := NewLocalClient(server.URL, "test-model")
+	noResize := NoLocalResize()
+
+	var retries int
+	resp, err := client.TranscribeImagesWithProgress(context.Background(), &TranscribeRequest{Images: images, LocalResize: &noResize}, func(u ProgressUpdate) {
+		if u.Message == "Batch failed, retrying" {
+			retries++
 		}
+	})
+	if err != nil {
+		t.Fatalf("TranscribeImages() failed: %v", err)
+	}
+	if resp.CompletedPages != 4 {
+		t.Errorf("CompletedPages = %d, want 4", resp.CompletedPages)
+	}
+	mu.Lock()
+	if calls["page2"] != 3 || calls["other"] != 3 {
+		t.Errorf("calls = %v, want page2 sent 3 times and the others once each", calls)
+	}
+	mu.Unlock()
+	if retries != 2 {
+		t.Errorf("saw %d retry warnings, want 2", retries)
+	}
+
+	// Out of retries, the job fails with the batch's error
+	mu.Lock()
+	calls = map[string]int{}
+	mu.Unlock()
+	_, err = client.TranscribeImages(context.Background(), &TranscribeRequest{Images: images, LocalResize: &noResize, MaxBatchRetries: 1})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("TranscribeImages() error = %v, want the 429", err)
+	}
+
+	// Client errors aren't worth resending
+	mu.Lock()
+	calls = map[string]int{}
+	mu.Unlock()
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls["bad"]++
+		mu.Unlock()
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer bad.Close()
+	client, _ = NewLocalClient(bad.URL, "test-model")
+	if _, err := client.TranscribeImages(context.Background(), &TranscribeRequest{Images: images[:1]}); err == nil {
+		t.Fatal("TranscribeImages() succeeded against a server that rejects every request")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if calls["bad"] != 1 {
+		t.Errorf("a 400 was sent %d times, want 1", calls["bad"])
 	}
 }
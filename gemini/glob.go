@@ -0,0 +1,256 @@
+package gemini
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// MaxBraceExpansions caps how many patterns one source may expand to, so a
+// typo like {1..10000000} fails fast instead of exhausting memory
+const MaxBraceExpansions = 10000
+
+// ExpandBraces expands shell-style brace expressions in a pattern:
+// alternatives like {*.png,*.jpg} and ranges like {001..010} or {a..e},
+// with an optional step ({0..20..5}). Patterns can nest and combine,
+// e.g. ch{1,2}/page_{01..03}.png. Braces that don't form a valid
+// expression (a single item, an unclosed brace) are kept literally, as
+// bash does. The expansion happens here rather than in the shell, so
+// quoted CLI arguments and the interactive pattern step behave the same.
+func ExpandBraces(pattern string) ([]string, error) {
+	results := []string{""}
+	rest := pattern
+
+	for rest != "" {
+		open, close, items, ok, err := nextBraceExpr(rest)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q: %w", pattern, err)
+		}
+		if !ok {
+			for i := range results {
+				results[i] += rest
+			}
+			break
+		}
+
+		prefix := rest[:open]
+		rest = rest[close+1:]
+
+		// Items can contain braces of their own
+		var alternatives []string
+		for _, item := range items {
+			expanded, err := ExpandBraces(item)
+			if err != nil {
+				return nil, err
+			}
+			alternatives = append(alternatives, expanded...)
+		}
+
+		if len(results)*len(alternatives) > MaxBraceExpansions {
+			return nil, fmt.Errorf("pattern %q expands to more than %d paths", pattern, MaxBraceExpansions)
+		}
+		next := make([]string, 0, len(results)*len(alternatives))
+		for _, r := range results {
+			for _, alt := range alternatives {
+				next = append(next, r+prefix+alt)
+			}
+		}
+		results = next
+	}
+
+	return results, nil
+}
+
+// nextBraceExpr finds the first brace expression in s that expands to
+// something, returning the positions of its braces and its items. Braces
+// that don't form an expression are skipped over.
+func nextBraceExpr(s string) (open, close int, items []string, ok bool, err error) {
+	for start := 0; start < len(s); {
+		i := strings.IndexByte(s[start:], '{')
+		if i < 0 {
+			return 0, 0, nil, false, nil
+		}
+		open = start + i
+
+		close = matchingBrace(s, open)
+		if close < 0 {
+			return 0, 0, nil, false, nil
+		}
+
+		body := s[open+1 : close]
+		items, ok, err := braceRange(body)
+		if err != nil || ok {
+			return open, close, items, ok, err
+		}
+		if parts := splitTopLevel(body); len(parts) > 1 {
+			return open, close, parts, true, nil
+		}
+
+		// Not an expression, e.g. "{x}"; look for one inside or after it
+		start = open + 1
+	}
+	return 0, 0, nil, false, nil
+}
+
+// matchingBrace returns the index of the brace closing the one at open,
+// or -1 when it is never closed
+func matchingBrace(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitTopLevel splits a brace body at commas that aren't inside nested braces
+func splitTopLevel(body string) []string {
+	var parts []string
+	depth, last := 0, 0
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, body[last:i])
+				last = i + 1
+			}
+		}
+	}
+	return append(parts, body[last:])
+}
+
+// braceRange expands a range body like "1..10", "001..010", "10..1..2" or
+// "a..e". Numbers keep the zero padding of the wider operand.
+func braceRange(body string) ([]string, bool, error) {
+	parts := strings.Split(body, "..")
+	if len(parts) != 2 && len(parts) != 3 {
+		return nil, false, nil
+	}
+
+	step := 1
+	if len(parts) == 3 {
+		n, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return nil, false, nil
+		}
+		if n < 0 {
+			n = -n
+		}
+		if n == 0 {
+			n = 1
+		}
+		step = n
+	}
+
+	// Letter ranges
+	if len(parts[0]) == 1 && len(parts[1]) == 1 && isLetter(parts[0][0]) && isLetter(parts[1][0]) {
+		from, to := int(parts[0][0]), int(parts[1][0])
+		var items []string
+		for _, v := range rangeValues(from, to, step) {
+			items = append(items, string(rune(v)))
+		}
+		return items, true, nil
+	}
+
+	from, err1 := strconv.Atoi(parts[0])
+	to, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil {
+		return nil, false, nil
+	}
+	if (to-from)/step >= MaxBraceExpansions || (from-to)/step >= MaxBraceExpansions {
+		return nil, false, fmt.Errorf("{%s} expands to more than %d paths", body, MaxBraceExpansions)
+	}
+
+	width := 0
+	if isZeroPadded(parts[0]) || isZeroPadded(parts[1]) {
+		width = max(len(parts[0]), len(parts[1]))
+	}
+
+	var items []string
+	for _, v := range rangeValues(from, to, step) {
+		items = append(items, fmt.Sprintf("%0*d", width, v))
+	}
+	return items, true, nil
+}
+
+// rangeValues counts from from to to inclusive, downwards when to < from
+func rangeValues(from, to, step int) []int {
+	var values []int
+	if from <= to {
+		for v := from; v <= to; v += step {
+			values = append(values, v)
+		}
+	} else {
+		for v := from; v >= to; v -= step {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// isZeroPadded reports whether a number is written with leading zeros
+func isZeroPadded(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	return len(s) > 1 && s[0] == '0'
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// SplitPatterns splits a line of input into sources at whitespace, like a
+// shell would: quotes ("..." or '...') keep spaces inside a path. When the
+// whole line names an existing file or folder it is kept as one source, so
+// unquoted paths with spaces keep working.
+func SplitPatterns(input string) []string {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil
+	}
+	if _, err := os.Stat(input); err == nil {
+		return []string{input}
+	}
+
+	var sources []string
+	var current strings.Builder
+	var quote rune
+	inField := false
+	for _, r := range input {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inField = true
+		case r == ' ' || r == '\t':
+			if inField {
+				sources = append(sources, current.String())
+				current.Reset()
+				inField = false
+			}
+		default:
+			current.WriteRune(r)
+			inField = true
+		}
+	}
+	if inField {
+		sources = append(sources, current.String())
+	}
+	return sources
+}
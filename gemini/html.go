@@ -0,0 +1,344 @@
+package gemini
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// buildHTML renders a document's markdown as a self-contained HTML page
+// with an inline stylesheet, so it opens anywhere without other files. It
+// understands the same markdown as buildDOCX; unlike Word output, links
+// keep their targets, as long as they are web, mail or in-page links.
+// Headings get ids to link to. Title, author, language, keywords and the
+// page range go into the <head> instead of front matter.
+func buildHTML(doc *MarkdownDocument, opts WriteOptions, now time.Time) []byte {
+	var body strings.Builder
+	w := &htmlWriter{body: &body, ids: make(map[string]int)}
+
+	if opts.AddTableOfContents && len(doc.Sections) > 1 {
+		body.WriteString(`<nav class="toc">` + "\n<h2>Table of Contents</h2>\n")
+		for _, section := range doc.Sections {
+			runs := parseInline(section.Title)
+			for i := range runs {
+				runs[i].link = "#" + htmlAnchor(runsText(runs))
+			}
+			w.listItem("ul", clampLevel(section.Level-1), runs)
+		}
+		w.closeLists(0)
+		body.WriteString("</nav>\n")
+	}
+	w.markdown(doc.Content)
+
+	var sb strings.Builder
+	lang := "und"
+	if doc.Metadata != nil && doc.Metadata.Language != "" {
+		lang = doc.Metadata.Language
+	}
+	fmt.Fprintf(&sb, "<!DOCTYPE html>\n<html lang=\"%s\">\n<head>\n", html.EscapeString(lang))
+	sb.WriteString(`<meta charset="utf-8">` + "\n")
+	sb.WriteString(`<meta name="viewport" content="width=device-width, initial-scale=1">` + "\n")
+	fmt.Fprintf(&sb, "<title>%s</title>\n", html.EscapeString(doc.Title))
+	writeHTMLMeta(&sb, "generator", "capycut")
+	writeHTMLMeta(&sb, "date", now.UTC().Format(time.RFC3339))
+	writeHTMLMeta(&sb, "description", fmt.Sprintf("Pages %d-%d", doc.PageRange.Start, doc.PageRange.End))
+	if doc.Metadata != nil {
+		if doc.Metadata.Author != "" {
+			writeHTMLMeta(&sb, "author", doc.Metadata.Author)
+		}
+		if len(doc.Metadata.Keywords) > 0 {
+			writeHTMLMeta(&sb, "keywords", strings.Join(doc.Metadata.Keywords, ", "))
+		}
+	}
+	sb.WriteString("<style>\n" + htmlStyle + "</style>\n</head>\n<body>\n<main>\n")
+	sb.WriteString(body.String())
+	sb.WriteString("</main>\n</body>\n</html>\n")
+	return []byte(sb.String())
+}
+
+// writeHTMLMeta writes a <meta name content> tag
+func writeHTMLMeta(sb *strings.Builder, name, content string) {
+	fmt.Fprintf(sb, "<meta name=\"%s\" content=\"%s\">\n", name, html.EscapeString(content))
+}
+
+// htmlWriter accumulates the HTML for a document body
+type htmlWriter struct {
+	body *strings.Builder
+
+	lists []string       // tags of the open lists, outermost first; each has an open <li>
+	ids   map[string]int // heading ids handed out, to keep them unique
+}
+
+// markdown converts markdown blocks to HTML, following docxWriter.markdown
+func (w *htmlWriter) markdown(content string) {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+
+	var para []string
+	quote := false
+	listTag, listLevel := "", 0
+
+	flush := func() {
+		if len(para) > 0 {
+			runs := parseInline(joinParagraphLines(para))
+			switch {
+			case listTag != "":
+				w.listItem(listTag, listLevel, runs)
+			case quote:
+				w.closeLists(0)
+				w.block("blockquote", "<p>"+htmlRuns(runs)+"</p>")
+			default:
+				w.closeLists(0)
+				w.block("p", htmlRuns(runs))
+			}
+		}
+		para, quote, listTag = nil, false, ""
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			flush()
+
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			flush()
+			w.closeLists(0)
+			fence := trimmed[:3]
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, html.EscapeString(lines[i]))
+			}
+			w.block("pre", "<code>"+strings.Join(code, "\n")+"</code>")
+
+		case docxHeadingRe.MatchString(trimmed):
+			flush()
+			w.closeLists(0)
+			m := docxHeadingRe.FindStringSubmatch(trimmed)
+			runs := parseInline(m[2])
+			fmt.Fprintf(w.body, "<h%d id=\"%s\">%s</h%d>\n", len(m[1]), w.headingID(runsText(runs)), htmlRuns(runs), len(m[1]))
+
+		case docxRuleRe.MatchString(trimmed):
+			flush()
+			w.closeLists(0)
+			w.body.WriteString("<hr>\n")
+
+		case strings.HasPrefix(trimmed, "|") && i+1 < len(lines) && docxTableSepRe.MatchString(strings.TrimSpace(lines[i+1])):
+			flush()
+			w.closeLists(0)
+			rows := [][]string{splitTableRow(trimmed)}
+			for i += 2; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), "|"); i++ {
+				rows = append(rows, splitTableRow(strings.TrimSpace(lines[i])))
+			}
+			i--
+			w.table(rows)
+
+		case docxBulletRe.MatchString(line) && !docxRuleRe.MatchString(trimmed):
+			flush()
+			m := docxBulletRe.FindStringSubmatch(line)
+			para = []string{m[2]}
+			listTag, listLevel = "ul", indentLevel(m[1])
+
+		case docxNumberedRe.MatchString(line):
+			flush()
+			m := docxNumberedRe.FindStringSubmatch(line)
+			para = []string{m[2]}
+			listTag, listLevel = "ol", indentLevel(m[1])
+
+		case strings.HasPrefix(trimmed, ">"):
+			if !quote {
+				flush()
+				quote = true
+			}
+			para = append(para, strings.TrimSpace(strings.TrimPrefix(trimmed, ">")))
+
+		default:
+			// Indented lines continue a list item; anything else ends the list
+			if listTag != "" && line != strings.TrimLeft(line, " \t") {
+				para = append(para, line)
+				continue
+			}
+			if listTag != "" || quote {
+				flush()
+			}
+			para = append(para, line)
+		}
+	}
+	flush()
+	w.closeLists(0)
+}
+
+// block writes an element holding already-escaped HTML
+func (w *htmlWriter) block(tag, inner string) {
+	fmt.Fprintf(w.body, "<%s>%s</%s>\n", tag, inner, tag)
+}
+
+// listItem writes an item at level of a tag ("ul" or "ol") list, opening
+// and closing lists as the level and kind change. A deeper list opens
+// inside the item before it, as HTML nests lists.
+func (w *htmlWriter) listItem(tag string, level int, runs []docxRun) {
+	w.closeLists(level + 1)
+	if len(w.lists) == level+1 && w.lists[level] != tag {
+		w.closeLists(level)
+	}
+	if len(w.lists) == level+1 {
+		w.body.WriteString("</li>\n<li>")
+	}
+	for len(w.lists) < level+1 {
+		fmt.Fprintf(w.body, "<%s>\n<li>", tag)
+		w.lists = append(w.lists, tag)
+	}
+	w.body.WriteString(htmlRuns(runs))
+}
+
+// closeLists closes open lists until only depth remain. The item that
+// held a closed list stays open for a following item to close.
+func (w *htmlWriter) closeLists(depth int) {
+	for len(w.lists) > depth {
+		fmt.Fprintf(w.body, "</li>\n</%s>\n", w.lists[len(w.lists)-1])
+		w.lists = w.lists[:len(w.lists)-1]
+	}
+}
+
+// table writes a table; the first row is the header row
+func (w *htmlWriter) table(rows [][]string) {
+	cols := 0
+	for _, row := range rows {
+		if len(row) > cols {
+			cols = len(row)
+		}
+	}
+
+	w.body.WriteString("<table>\n")
+	for r, row := range rows {
+		cell := "td"
+		if r == 0 {
+			cell = "th"
+			w.body.WriteString("<thead>\n")
+		}
+		w.body.WriteString("<tr>")
+		for c := 0; c < cols; c++ {
+			text := ""
+			if c < len(row) {
+				text = row[c]
+			}
+			fmt.Fprintf(w.body, "<%s>%s</%s>", cell, htmlRuns(parseInline(text)), cell)
+		}
+		w.body.WriteString("</tr>\n")
+		if r == 0 {
+			w.body.WriteString("</thead>\n<tbody>\n")
+		}
+	}
+	w.body.WriteString("</tbody>\n</table>\n")
+}
+
+// headingID returns a unique id for a heading, numbering repeats like
+// "notes-2"
+func (w *htmlWriter) headingID(text string) string {
+	id := htmlAnchor(text)
+	w.ids[id]++
+	if n := w.ids[id]; n > 1 {
+		return fmt.Sprintf("%s-%d", id, n)
+	}
+	return id
+}
+
+// htmlAnchor turns heading text into an id: lower case letters and digits
+// with runs of anything else replaced by a hyphen
+func htmlAnchor(text string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && sb.Len() > 0 {
+				sb.WriteByte('-')
+			}
+			sb.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	if sb.Len() == 0 {
+		return "section"
+	}
+	return sb.String()
+}
+
+// runsText returns the plain text of runs
+func runsText(runs []docxRun) string {
+	var sb strings.Builder
+	for _, run := range runs {
+		sb.WriteString(run.text)
+	}
+	return sb.String()
+}
+
+// htmlRuns renders formatted runs as inline HTML. Runs sharing a link go
+// into one <a>; newlines become <br>.
+func htmlRuns(runs []docxRun) string {
+	var sb strings.Builder
+	link := ""
+	for _, run := range runs {
+		if run.link != link {
+			if link != "" {
+				sb.WriteString("</a>")
+			}
+			link = run.link
+			if link != "" {
+				fmt.Fprintf(&sb, `<a href="%s">`, html.EscapeString(safeHref(link)))
+			}
+		}
+
+		text := strings.ReplaceAll(html.EscapeString(run.text), "\n", "<br>\n")
+		if run.code {
+			text = "<code>" + text + "</code>"
+		}
+		if run.italic {
+			text = "<em>" + text + "</em>"
+		}
+		if run.bold {
+			text = "<strong>" + text + "</strong>"
+		}
+		sb.WriteString(text)
+	}
+	if link != "" {
+		sb.WriteString("</a>")
+	}
+	return sb.String()
+}
+
+// safeHref keeps web, mail and relative link targets and replaces anything
+// else, such as javascript: URLs in model output, with "#"
+func safeHref(target string) string {
+	lower := strings.ToLower(strings.TrimSpace(target))
+	for _, scheme := range []string{"http://", "https://", "mailto:"} {
+		if strings.HasPrefix(lower, scheme) {
+			return target
+		}
+	}
+	if i := strings.IndexAny(lower, ":/?#"); i >= 0 && lower[i] == ':' {
+		return "#"
+	}
+	return target
+}
+
+// htmlStyle is the stylesheet embedded in every page: a readable measure
+// and the look of the markdown preview most people know
+const htmlStyle = `body { margin: 0; background: #fff; color: #1f2328; font: 16px/1.6 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; }
+main { max-width: 46em; margin: 0 auto; padding: 2em 1.5em; }
+h1, h2, h3, h4, h5, h6 { line-height: 1.25; margin: 1.5em 0 0.5em; }
+h1, h2 { border-bottom: 1px solid #d1d9e0; padding-bottom: 0.3em; }
+code { font-family: ui-monospace, Menlo, Consolas, monospace; font-size: 0.9em; background: #f6f8fa; padding: 0.1em 0.3em; border-radius: 4px; }
+pre { background: #f6f8fa; padding: 1em; overflow-x: auto; border-radius: 6px; }
+pre code { background: none; padding: 0; }
+blockquote { margin: 0 0 1em; padding: 0 1em; color: #59636e; border-left: 0.25em solid #d1d9e0; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #d1d9e0; padding: 0.3em 0.8em; }
+th { background: #f6f8fa; }
+hr { border: 0; border-top: 1px solid #d1d9e0; margin: 2em 0; }
+nav.toc { background: #f6f8fa; padding: 0.5em 1.5em; border-radius: 6px; }
+`
@@ -6,9 +6,11 @@ import (
 	"image"
 	"image/jpeg"
 	"image/png"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 
 	// Register image formats for decoding
@@ -17,65 +19,154 @@ import (
 	"golang.org/x/image/draw"
 )
 
+// LoadOptions controls how LoadImagesWithOptions reads directory sources
+type LoadOptions struct {
+	// Recursive walks subdirectories of directory sources
+	Recursive bool
+
+	// MaxDepth limits how many levels of subdirectories a recursive walk
+	// descends; 0 means no limit
+	MaxDepth int
+
+	// DPI is the resolution PDF sources are rendered at; 0 means
+	// DefaultPDFDPI
+	DPI int
+}
+
 // LoadImages loads and validates image files from various sources
-// Supports: directory path, glob pattern, or list of file paths
+// Supports: directory path, glob pattern (with brace expansion, see
+// ExpandBraces), zip archive, PDF document, http(s) URL, or list of file
+// paths. Images in zip archives are extracted, PDF pages rendered (one
+// image per page, at LoadOptions.DPI), and URLs downloaded, to a temp
+// directory; call CleanupTempFiles when done with the returned paths.
+// Downloads keep the order their URLs were given in.
 func LoadImages(sources []string) ([]string, error) {
+	return LoadImagesWithOptions(sources, LoadOptions{})
+}
+
+// LoadImagesWithOptions is LoadImages with control over directory walking.
+// Images are sorted naturally by their path below the source directory, so
+// with Recursive set chapter1/*.png come before chapter2/*.png, and the
+// files of a folder come before its subfolders. Hidden files and
+// directories are skipped.
+func LoadImagesWithOptions(sources []string, opts LoadOptions) ([]string, error) {
 	if len(sources) == 0 {
 		return nil, fmt.Errorf("no image sources provided")
 	}
 
-	var allPaths []string
+	// Download URL sources up front so they can be fetched concurrently
+	var urls []string
+	for _, source := range sources {
+		if isRemoteSource(source) {
+			urls = append(urls, source)
+		}
+	}
+	downloaded := make(map[string]string, len(urls))
+	if len(urls) > 0 {
+		paths, err := downloadRemoteImages(urls)
+		if err != nil {
+			return nil, err
+		}
+		for i, u := range urls {
+			downloaded[u] = paths[i]
+		}
+	}
+
+	var all []sourceImage
 	seen := make(map[string]bool)
 
 	for _, source := range sources {
-		paths, err := resolveSource(source)
+		var images []sourceImage
+		var err error
+		if p, ok := downloaded[source]; ok {
+			images = baseNameImages([]string{p})
+		} else {
+			images, err = resolveSource(source, opts)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("source %q: %w", source, err)
 		}
 
-		for _, p := range paths {
-			absPath, err := filepath.Abs(p)
+		for _, img := range images {
+			absPath, err := filepath.Abs(img.path)
 			if err != nil {
-				return nil, fmt.Errorf("failed to get absolute path for %s: %w", p, err)
+				return nil, fmt.Errorf("failed to get absolute path for %s: %w", img.path, err)
 			}
 
 			if !seen[absPath] {
 				seen[absPath] = true
-				allPaths = append(allPaths, absPath)
+				all = append(all, sourceImage{path: absPath, key: img.key})
 			}
 		}
 	}
 
-	if len(allPaths) == 0 {
+	if len(all) == 0 {
 		return nil, fmt.Errorf("no valid image files found")
 	}
 
-	// Sort by filename for consistent ordering
-	sort.Slice(allPaths, func(i, j int) bool {
-		return naturalSort(filepath.Base(allPaths[i]), filepath.Base(allPaths[j]))
+	// Sort by filename (or relative path) for consistent ordering
+	sort.SliceStable(all, func(i, j int) bool {
+		return naturalPathLess(all[i].key, all[j].key)
 	})
 
-	return allPaths, nil
+	paths := make([]string, len(all))
+	for i, img := range all {
+		paths[i] = img.path
+	}
+	return paths, nil
+}
+
+// sourceImage is an image path with the key it is sorted by: its path
+// relative to the directory it was found in, or its file name
+type sourceImage struct {
+	path string
+	key  string
+}
+
+// baseNameImages keys paths by file name
+func baseNameImages(paths []string) []sourceImage {
+	images := make([]sourceImage, len(paths))
+	for i, p := range paths {
+		images[i] = sourceImage{path: p, key: filepath.Base(p)}
+	}
+	return images
 }
 
 // resolveSource resolves a source to a list of file paths
-func resolveSource(source string) ([]string, error) {
+func resolveSource(source string, opts LoadOptions) ([]sourceImage, error) {
 	// Check if it's an existing file
 	info, err := os.Stat(source)
 	if err == nil {
 		if info.IsDir() {
-			return loadFromDirectory(source)
+			return loadFromDirectory(source, opts)
+		}
+		if isZipFile(source) {
+			paths, err := loadFromZip(source)
+			return baseNameImages(paths), err
+		}
+		if isPDFFile(source) {
+			paths, err := rasterizePDF(source, opts.DPI)
+			return baseNameImages(paths), err
 		}
 		if isImageFile(source) {
-			return []string{source}, nil
+			return baseNameImages([]string{source}), nil
 		}
 		return nil, fmt.Errorf("not a supported image file: %s", source)
 	}
 
-	// Try as glob pattern
-	matches, err := filepath.Glob(source)
+	// Try as glob pattern, after brace expansion; literal paths produced by
+	// a range like page_{001..010}.png may not all exist
+	patterns, err := ExpandBraces(source)
 	if err != nil {
-		return nil, fmt.Errorf("invalid pattern: %w", err)
+		return nil, err
+	}
+	var matches []string
+	for _, pattern := range patterns {
+		found, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+		matches = append(matches, found...)
 	}
 
 	if len(matches) == 0 {
@@ -83,42 +174,79 @@ func resolveSource(source string) ([]string, error) {
 	}
 
 	// Filter to only image files
-	var imagePaths []string
+	var images []sourceImage
 	for _, match := range matches {
 		info, err := os.Stat(match)
 		if err != nil {
 			continue
 		}
 		if info.IsDir() {
-			dirImages, err := loadFromDirectory(match)
+			dirImages, err := loadFromDirectory(match, opts)
 			if err == nil {
-				imagePaths = append(imagePaths, dirImages...)
+				images = append(images, dirImages...)
+			}
+		} else if isZipFile(match) {
+			zipImages, err := loadFromZip(match)
+			if err == nil {
+				images = append(images, baseNameImages(zipImages)...)
+			}
+		} else if isPDFFile(match) {
+			// Unlike a broken zip, a PDF that can't be rendered is usually a
+			// missing pdftoppm, which every other match would hit too
+			pdfImages, err := rasterizePDF(match, opts.DPI)
+			if err != nil {
+				return nil, err
 			}
+			images = append(images, baseNameImages(pdfImages)...)
 		} else if isImageFile(match) {
-			imagePaths = append(imagePaths, match)
+			images = append(images, baseNameImages([]string{match})...)
 		}
 	}
 
-	return imagePaths, nil
+	return images, nil
 }
 
-// loadFromDirectory loads all image files from a directory
-func loadFromDirectory(dir string) ([]string, error) {
-	entries, err := os.ReadDir(dir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read directory: %w", err)
-	}
+// loadFromDirectory loads the image files in a directory and, with
+// opts.Recursive, its subdirectories, keyed by path relative to dir
+func loadFromDirectory(dir string, opts LoadOptions) ([]sourceImage, error) {
+	var images []sourceImage
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil // skip unreadable subdirectories rather than failing the scan
+		}
+		if path == dir {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if isHidden(entry.Name()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 
-	var images []string
-	for _, entry := range entries {
 		if entry.IsDir() {
-			continue
+			depth := strings.Count(filepath.ToSlash(rel), "/") + 1
+			if !opts.Recursive || (opts.MaxDepth > 0 && depth > opts.MaxDepth) {
+				return filepath.SkipDir
+			}
+			return nil
 		}
 
-		path := filepath.Join(dir, entry.Name())
 		if isImageFile(path) {
-			images = append(images, path)
+			images = append(images, sourceImage{path: path, key: filepath.ToSlash(rel)})
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
 	}
 
 	if len(images) == 0 {
@@ -128,6 +256,31 @@ func loadFromDirectory(dir string) ([]string, error) {
 	return images, nil
 }
 
+// isHidden reports whether a file or directory name is hidden by the dot
+// convention, which also covers macOS "._" resource forks
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// naturalPathLess orders slash-separated paths one component at a time
+// with NaturalLess. Where one path ends at a file and the other continues
+// into a subdirectory, the file comes first, so a folder's own pages
+// precede its subfolders.
+func naturalPathLess(a, b string) bool {
+	aParts := strings.Split(a, "/")
+	bParts := strings.Split(b, "/")
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		aLast, bLast := i == len(aParts)-1, i == len(bParts)-1
+		if aLast != bLast {
+			return aLast
+		}
+		if aParts[i] != bParts[i] {
+			return NaturalLess(aParts[i], bParts[i])
+		}
+	}
+	return len(aParts) < len(bParts)
+}
+
 // isImageFile checks if a file has a supported image extension
 func isImageFile(path string) bool {
 	ext := strings.ToLower(filepath.Ext(path))
@@ -139,41 +292,44 @@ func isImageFile(path string) bool {
 	return false
 }
 
-// naturalSort performs natural sorting for filenames with numbers
-// e.g., page_2.png comes before page_10.png
-func naturalSort(a, b string) bool {
+// NaturalLess orders file names the way a person numbers pages: runs of
+// digits compare by value, so page2.png comes before page10.png, and the
+// rest compares case-insensitively. Names that differ only in zero
+// padding put the unpadded one first (page2 before page02), and names that
+// differ only in case fall back to a plain comparison, so the order never
+// depends on the order the names were found in.
+func NaturalLess(a, b string) bool {
 	aLower := strings.ToLower(a)
 	bLower := strings.ToLower(b)
 
 	aPos, bPos := 0, 0
 
+	// The first difference in zero padding, for when nothing else differs
+	padding := 0
+
 	for aPos < len(aLower) && bPos < len(bLower) {
 		aChar := aLower[aPos]
 		bChar := bLower[bPos]
 
-		aIsDigit := aChar >= '0' && aChar <= '9'
-		bIsDigit := bChar >= '0' && bChar <= '9'
-
-		if aIsDigit && bIsDigit {
+		if isDigit(aChar) && isDigit(bChar) {
 			// Extract full numbers from both strings
 			aNumStart := aPos
 			bNumStart := bPos
 
-			for aPos < len(aLower) && aLower[aPos] >= '0' && aLower[aPos] <= '9' {
+			for aPos < len(aLower) && isDigit(aLower[aPos]) {
 				aPos++
 			}
-			for bPos < len(bLower) && bLower[bPos] >= '0' && bLower[bPos] <= '9' {
+			for bPos < len(bLower) && isDigit(bLower[bPos]) {
 				bPos++
 			}
 
-			// Parse numbers
-			aNum := parseNumber(aLower[aNumStart:aPos])
-			bNum := parseNumber(bLower[bNumStart:bPos])
-
-			if aNum != bNum {
-				return aNum < bNum
+			if c := compareNumbers(aLower[aNumStart:aPos], bLower[bNumStart:bPos]); c != 0 {
+				return c < 0
 			}
 			// Numbers are equal, continue comparing
+			if padding == 0 {
+				padding = (aPos - aNumStart) - (bPos - bNumStart)
+			}
 		} else {
 			// Compare characters directly
 			if aChar != bChar {
@@ -184,17 +340,35 @@ func naturalSort(a, b string) bool {
 		}
 	}
 
-	// Shorter string comes first
-	return len(aLower) < len(bLower)
+	// A name that is a prefix of the other comes first
+	aRest, bRest := len(aLower)-aPos, len(bLower)-bPos
+	if aRest != bRest {
+		return aRest < bRest
+	}
+	if padding != 0 {
+		return padding < 0
+	}
+	return a < b
 }
 
-// parseNumber parses a string of digits into an integer
-func parseNumber(s string) int {
-	n := 0
-	for _, c := range s {
-		n = n*10 + int(c-'0')
+// isDigit reports whether c is an ASCII digit
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// compareNumbers compares two runs of digits by value, without parsing
+// them, so numbers too long for an int (timestamps, say) still order
+// correctly. It returns -1, 0 or 1.
+func compareNumbers(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
 	}
-	return n
+	return strings.Compare(a, b)
 }
 
 // ValidateImages checks that all images are valid
@@ -258,11 +432,42 @@ func FormatSize(b int64) string {
 	}
 }
 
+// ImageFormat is the encoding resized images are written in
+type ImageFormat string
+
+const (
+	// ImageFormatAuto keeps PNG and GIF sources lossless (as PNG) and
+	// writes JPEG for the rest. With a size target, lossless output that
+	// doesn't fit falls back to JPEG.
+	ImageFormatAuto ImageFormat = ""
+
+	// ImageFormatPNG writes lossless PNG regardless of size
+	ImageFormatPNG ImageFormat = "png"
+
+	// ImageFormatJPEG writes JPEG, the smallest output
+	ImageFormatJPEG ImageFormat = "jpeg"
+)
+
+// ParseImageFormat parses "auto", "png" or "jpeg" (also "jpg")
+func ParseImageFormat(s string) (ImageFormat, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "auto":
+		return ImageFormatAuto, nil
+	case "png":
+		return ImageFormatPNG, nil
+	case "jpeg", "jpg":
+		return ImageFormatJPEG, nil
+	default:
+		return "", fmt.Errorf("unknown image format %q (expected auto, png or jpeg)", s)
+	}
+}
+
 // ResizeOptions configures image resizing
 type ResizeOptions struct {
-	MaxWidth  int // Maximum width in pixels (0 = no limit)
-	MaxHeight int // Maximum height in pixels (0 = no limit)
-	Quality   int // JPEG quality (1-100, default 85)
+	MaxWidth  int         // Maximum width in pixels (0 = no limit)
+	MaxHeight int         // Maximum height in pixels (0 = no limit)
+	Quality   int         // JPEG quality (1-100, default 85)
+	Format    ImageFormat // Output encoding (default ImageFormatAuto)
 }
 
 // DefaultResizeOptions returns sensible defaults for local LLM
@@ -274,9 +479,128 @@ func DefaultResizeOptions() ResizeOptions {
 	}
 }
 
-// ResizeImage resizes an image to fit within the specified dimensions
-// Returns the resized image as bytes (JPEG format for efficiency)
+// Env vars that tune how images are shrunk before they go to a local LLM
+const (
+	ImageMaxDimEnvVar          = "IMAGE_MAX_DIM"
+	ImageQualityEnvVar         = "IMAGE_QUALITY"
+	ImageResizeThresholdEnvVar = "IMAGE_RESIZE_THRESHOLD"
+	ImageFormatEnvVar          = "IMAGE_FORMAT"
+)
+
+// LocalResizeOptions controls how images are shrunk before they're sent to a
+// local LLM, whose context fills up quickly with full-size scans
+type LocalResizeOptions struct {
+	ResizeOptions
+
+	// Threshold is the file size in bytes at or below which an image is
+	// sent unchanged (0 = resize every image)
+	Threshold int64
+}
+
+// DefaultLocalResizeOptions returns the settings used when a request doesn't
+// set LocalResize: 768px at JPEG quality 80, for files over 500 KB
+func DefaultLocalResizeOptions() LocalResizeOptions {
+	return LocalResizeOptions{
+		ResizeOptions: ResizeOptions{MaxWidth: 768, MaxHeight: 768, Quality: 80},
+		Threshold:     500 * 1024,
+	}
+}
+
+// NoLocalResize sends every image at full size, for models that handle it
+func NoLocalResize() LocalResizeOptions {
+	return LocalResizeOptions{}
+}
+
+// FullSize reports whether images are sent without resizing
+func (o LocalResizeOptions) FullSize() bool {
+	return o.MaxWidth <= 0 && o.MaxHeight <= 0
+}
+
+// load reads an image for a local LLM request, resizing it when it is over
+// the threshold
+func (o LocalResizeOptions) load(path string) ([]byte, string, error) {
+	if o.FullSize() {
+		return readOriginalImage(path)
+	}
+	return ResizeImageIfNeeded(path, o.Threshold, o.ResizeOptions)
+}
+
+// LocalResizeFromEnv starts from DefaultLocalResizeOptions and applies
+// IMAGE_MAX_DIM (pixels; 0 or "none" sends full-size images), IMAGE_QUALITY
+// (1-100), IMAGE_RESIZE_THRESHOLD (e.g. 500K, 2M; 0 resizes every image)
+// and IMAGE_FORMAT (auto, png or jpeg)
+func LocalResizeFromEnv() (LocalResizeOptions, error) {
+	opts := DefaultLocalResizeOptions()
+
+	if v := strings.TrimSpace(os.Getenv(ImageMaxDimEnvVar)); v != "" {
+		if strings.EqualFold(v, "none") {
+			v = "0"
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return LocalResizeOptions{}, fmt.Errorf("invalid %s %q: expected pixels like 1536, or none", ImageMaxDimEnvVar, v)
+		}
+		opts.MaxWidth, opts.MaxHeight = n, n
+	}
+
+	if v := strings.TrimSpace(os.Getenv(ImageQualityEnvVar)); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			return LocalResizeOptions{}, fmt.Errorf("invalid %s %q: expected 1-100", ImageQualityEnvVar, v)
+		}
+		opts.Quality = n
+	}
+
+	if v := strings.TrimSpace(os.Getenv(ImageResizeThresholdEnvVar)); v != "" {
+		n, err := ParseByteSize(v)
+		if err != nil {
+			return LocalResizeOptions{}, fmt.Errorf("invalid %s: %w", ImageResizeThresholdEnvVar, err)
+		}
+		opts.Threshold = n
+	}
+
+	if v := os.Getenv(ImageFormatEnvVar); v != "" {
+		format, err := ParseImageFormat(v)
+		if err != nil {
+			return LocalResizeOptions{}, fmt.Errorf("invalid %s: %w", ImageFormatEnvVar, err)
+		}
+		opts.Format = format
+	}
+
+	return opts, nil
+}
+
+// ResizeImage resizes an image to fit within the specified dimensions.
+// Images already within them are returned unchanged, keeping their encoding
+// and any embedded color profile. Resized PNG and GIF sources stay lossless
+// PNG unless opts.Format asks for JPEG.
 func ResizeImage(path string, opts ResizeOptions) ([]byte, string, error) {
+	return resizeImage(path, 0, opts)
+}
+
+// ResizeImageIfNeeded resizes an image only if it exceeds the max size in
+// bytes. A resized lossless source is kept as PNG when that fits maxBytes
+// and only falls back to JPEG when it doesn't, since JPEG artifacts blur
+// fine print.
+func ResizeImageIfNeeded(path string, maxBytes int64, opts ResizeOptions) ([]byte, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// If file is small enough, just return it as-is
+	if info.Size() <= maxBytes {
+		return readOriginalImage(path)
+	}
+
+	// Resize the image
+	return resizeImage(path, maxBytes, opts)
+}
+
+// resizeImage scales an image to fit opts and encodes it in the format opts
+// asks for. maxBytes is the size the PNG output of a lossless source has to
+// fit before it is re-encoded as JPEG; 0 means no size target.
+func resizeImage(path string, maxBytes int64, opts ResizeOptions) ([]byte, string, error) {
 	// Read the image file
 	file, err := os.Open(path)
 	if err != nil {
@@ -303,67 +627,83 @@ func ResizeImage(path string, opts ResizeOptions) ([]byte, string, error) {
 	}
 
 	if opts.MaxHeight > 0 && newHeight > opts.MaxHeight {
-		newHeight = opts.MaxHeight
 		newWidth = int(float64(newWidth) * float64(opts.MaxHeight) / float64(newHeight))
+		newHeight = opts.MaxHeight
 	}
 
-	// If no resizing needed, just return the original file
-	if newWidth == width && newHeight == height {
-		data, err := os.ReadFile(path)
-		if err != nil {
-			return nil, "", err
+	lossless := format == "png" || format == "gif"
+	outFormat := opts.Format
+	if outFormat == ImageFormatAuto {
+		outFormat = ImageFormatJPEG
+		if lossless {
+			outFormat = ImageFormatPNG
 		}
-		mimeType := getMIMEType(strings.ToLower(filepath.Ext(path)))
-		return data, mimeType, nil
 	}
 
-	// Create resized image
-	resized := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
-
-	// Use high-quality resampling
-	draw.CatmullRom.Scale(resized, resized.Bounds(), img, bounds, draw.Over, nil)
-
-	// Encode to JPEG (more efficient for transmission)
-	var buf bytes.Buffer
-	quality := opts.Quality
-	if quality <= 0 || quality > 100 {
-		quality = 85
+	// Nothing to scale: keep the original bytes unless a lossless source has
+	// to become JPEG, to meet the size target or because opts asks for it
+	if newWidth == width && newHeight == height {
+		if !lossless || outFormat == ImageFormatPNG && (opts.Format == ImageFormatPNG || maxBytes <= 0) {
+			return readOriginalImage(path)
+		}
+		return encodeJPEG(img, opts.Quality)
 	}
 
-	// Use PNG for images that might have transparency, JPEG otherwise
-	var mimeType string
-	if format == "png" || format == "gif" {
-		err = png.Encode(&buf, resized)
-		mimeType = "image/png"
-	} else {
-		err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: quality})
-		mimeType = "image/jpeg"
-	}
+	resized := scaleImage(img, newWidth, newHeight)
 
-	if err != nil {
-		return nil, "", fmt.Errorf("failed to encode resized image: %w", err)
+	if outFormat == ImageFormatPNG {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, resized); err != nil {
+			return nil, "", fmt.Errorf("failed to encode resized image: %w", err)
+		}
+		// Auto mode gives up on lossless only when PNG misses the size target
+		if opts.Format == ImageFormatPNG || maxBytes <= 0 || int64(buf.Len()) <= maxBytes {
+			return buf.Bytes(), "image/png", nil
+		}
 	}
 
-	return buf.Bytes(), mimeType, nil
+	return encodeJPEG(resized, opts.Quality)
 }
 
-// ResizeImageIfNeeded resizes an image only if it exceeds the max size in bytes
-func ResizeImageIfNeeded(path string, maxBytes int64, opts ResizeOptions) ([]byte, string, error) {
-	info, err := os.Stat(path)
+// readOriginalImage returns an image file's bytes untouched
+func readOriginalImage(path string) ([]byte, string, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, "", err
 	}
+	return data, getMIMEType(strings.ToLower(filepath.Ext(path))), nil
+}
 
-	// If file is small enough, just return it as-is
-	if info.Size() <= maxBytes {
-		data, err := os.ReadFile(path)
-		if err != nil {
-			return nil, "", err
-		}
-		mimeType := getMIMEType(strings.ToLower(filepath.Ext(path)))
-		return data, mimeType, nil
+// scaleImage resamples img to width x height. Grayscale scans stay
+// grayscale, which keeps their PNG output a third the size of RGBA.
+func scaleImage(img image.Image, width, height int) image.Image {
+	rect := image.Rect(0, 0, width, height)
+	if _, ok := img.(*image.Gray); ok {
+		dst := image.NewGray(rect)
+		draw.CatmullRom.Scale(dst, rect, img, img.Bounds(), draw.Src, nil)
+		return dst
 	}
+	// Use high-quality resampling
+	dst := image.NewRGBA(rect)
+	draw.CatmullRom.Scale(dst, rect, img, img.Bounds(), draw.Src, nil)
+	return dst
+}
 
-	// Resize the image
-	return ResizeImage(path, opts)
+// encodeJPEG encodes img as JPEG at quality (85 when out of range).
+// Transparent areas become white rather than JPEG's default black, so text
+// on a transparent background stays readable.
+func encodeJPEG(img image.Image, quality int) ([]byte, string, error) {
+	if quality <= 0 || quality > 100 {
+		quality = 85
+	}
+
+	flat := image.NewRGBA(img.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, flat, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, "", fmt.Errorf("failed to encode resized image: %w", err)
+	}
+	return buf.Bytes(), "image/jpeg", nil
 }
@@ -0,0 +1,69 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DocumentFileVersion is the schema version written to JSON documents
+const DocumentFileVersion = 1
+
+// DocumentFile is a document written with FormatJSON: the markdown
+// together with the structure it was built from, so tools can use the
+// headings, chapters and image descriptions without parsing markdown
+type DocumentFile struct {
+	Version   int               `json:"version"`
+	Title     string            `json:"title"`
+	PageStart int               `json:"page_start"`
+	PageEnd   int               `json:"page_end"`
+	Generated string            `json:"generated"`
+	Author    string            `json:"author,omitempty"`
+	Date      string            `json:"date,omitempty"`
+	Language  string            `json:"language,omitempty"`
+	Keywords  []string          `json:"keywords,omitempty"`
+	Sections  []DocumentSection `json:"sections,omitempty"`
+	Markdown  string            `json:"markdown"`
+	Pages     []*PageContent    `json:"pages,omitempty"`
+}
+
+// DocumentSection is a heading within a DocumentFile
+type DocumentSection struct {
+	Title     string `json:"title"`
+	Level     int    `json:"level"`
+	StartPage int    `json:"start_page"`
+}
+
+// buildDocumentJSON encodes a document as an indented DocumentFile. Pages
+// come from doc.Pages, with every heading, chapter flag and image
+// description the model returned, whether or not the markdown shows them.
+func buildDocumentJSON(doc *MarkdownDocument, now time.Time) ([]byte, error) {
+	file := DocumentFile{
+		Version:   DocumentFileVersion,
+		Title:     doc.Title,
+		PageStart: doc.PageRange.Start,
+		PageEnd:   doc.PageRange.End,
+		Generated: now.UTC().Format(time.RFC3339),
+		Markdown:  doc.Content,
+		Pages:     doc.Pages,
+	}
+	if doc.Metadata != nil {
+		file.Author = doc.Metadata.Author
+		file.Date = doc.Metadata.Date
+		file.Language = doc.Metadata.Language
+		file.Keywords = doc.Metadata.Keywords
+	}
+	for _, section := range doc.Sections {
+		file.Sections = append(file.Sections, DocumentSection{
+			Title:     section.Title,
+			Level:     section.Level,
+			StartPage: section.StartPage,
+		})
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode document: %w", err)
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,140 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MemoryLimitEnvVar sets WithMemoryLimit from the environment (e.g. 512M, 2G)
+const MemoryLimitEnvVar = "CAPYCUT_MEMORY_LIMIT"
+
+// batchMemoryFactor estimates peak resident bytes per byte of image file
+// while a batch is in flight: the raw file, its base64 copy (~1.37x) and the
+// JSON request body that embeds it (~1.37x again), rounded up for slack.
+const batchMemoryFactor = 4
+
+// WithMemoryLimit caps the estimated memory held by batches that are being
+// sent at the same time. Each batch reserves about 4x the size of its image
+// files before reading them and releases it when its request finishes.
+//
+// This is independent of TranscribeRequest.Concurrency: at most that many batches
+// are ever in flight, and the memory limit can only lower the effective
+// concurrency further, never raise it. A batch that alone exceeds the limit
+// still runs, but only once nothing else holds memory. Zero disables the
+// limit.
+func WithMemoryLimit(bytes int64) ClientOption {
+	return func(c *Client) {
+		if bytes > 0 {
+			c.memory = newMemoryLimiter(bytes)
+		} else {
+			c.memory = nil
+		}
+	}
+}
+
+// MemoryLimitFromEnv reads CAPYCUT_MEMORY_LIMIT; 0 means unset
+func MemoryLimitFromEnv() (int64, error) {
+	v := strings.TrimSpace(os.Getenv(MemoryLimitEnvVar))
+	if v == "" {
+		return 0, nil
+	}
+	n, err := ParseByteSize(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", MemoryLimitEnvVar, err)
+	}
+	return n, nil
+}
+
+// ParseByteSize parses sizes like "1048576", "512K", "512MB" or "2G"
+// (binary multiples)
+func ParseByteSize(s string) (int64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	upper = strings.TrimSuffix(upper, "IB")
+	upper = strings.TrimSuffix(upper, "B")
+
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(upper, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(upper, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(upper, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		upper = upper[:len(upper)-1]
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(upper), 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("expected a positive size like 512M or 2G, got %q", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// memoryLimiter is a weighted semaphore over an estimated byte budget
+type memoryLimiter struct {
+	limit int64
+
+	mu      sync.Mutex
+	used    int64
+	changed chan struct{} // closed and replaced whenever memory is released
+}
+
+func newMemoryLimiter(limit int64) *memoryLimiter {
+	return &memoryLimiter{limit: limit, changed: make(chan struct{})}
+}
+
+// acquire blocks until n bytes fit in the budget and returns the amount
+// actually reserved, which is capped at the limit so oversized batches can
+// still run alone. A nil limiter never blocks.
+func (m *memoryLimiter) acquire(ctx context.Context, n int64) (int64, error) {
+	if m == nil {
+		return 0, nil
+	}
+	if n > m.limit {
+		n = m.limit
+	}
+
+	for {
+		m.mu.Lock()
+		if m.used+n <= m.limit {
+			m.used += n
+			m.mu.Unlock()
+			return n, nil
+		}
+		wait := m.changed
+		m.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+// release returns n bytes to the budget and wakes waiting batches
+func (m *memoryLimiter) release(n int64) {
+	if m == nil || n == 0 {
+		return
+	}
+	m.mu.Lock()
+	m.used -= n
+	close(m.changed)
+	m.changed = make(chan struct{})
+	m.mu.Unlock()
+}
+
+// estimateBatchMemory returns the bytes a batch is expected to hold in memory
+func estimateBatchMemory(images []*ImageInfo) int64 {
+	var total int64
+	for _, img := range images {
+		total += img.Size
+	}
+	return total * batchMemoryFactor
+}
@@ -0,0 +1,231 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// ModelInfo describes a model a provider offers
+type ModelInfo struct {
+	// ID is the name to pass as the model, e.g. in LLM_MODEL or --model
+	ID string
+
+	// Name is a human-readable name, when the provider has one
+	Name string
+
+	// Details holds whatever else the provider reports, e.g. token limits
+	// or quantization, already formatted for display
+	Details string
+}
+
+// KnownAnthropicModels are the Claude models offered for Anthropic and
+// Azure Anthropic, newest first. Azure deployments have no model list
+// endpoint.
+var KnownAnthropicModels = []ModelInfo{
+	{ID: "claude-sonnet-4-5-20250514", Name: "Claude Sonnet 4.5"},
+	{ID: "claude-sonnet-4-20250514", Name: "Claude Sonnet 4", Details: "default"},
+	{ID: "claude-3-5-sonnet-20241022", Name: "Claude 3.5 Sonnet"},
+	{ID: "claude-3-opus-20240229", Name: "Claude 3 Opus"},
+	{ID: "claude-3-sonnet-20240229", Name: "Claude 3 Sonnet"},
+	{ID: "claude-3-haiku-20240307", Name: "Claude 3 Haiku"},
+}
+
+// ListModels returns the models the client's provider can use. Gemini and
+// local servers are asked for their current list; for local servers that
+// means the models that are loaded or installed. Anthropic and Azure
+// Anthropic get KnownAnthropicModels.
+func (c *Client) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	switch c.provider {
+	case ProviderLocal:
+		return c.listModelsLocal(ctx)
+	case ProviderAzureAnthropic, ProviderAnthropic:
+		return append([]ModelInfo(nil), KnownAnthropicModels...), nil
+	default:
+		return c.listModelsGemini(ctx)
+	}
+}
+
+// geminiModelsResponse is one page of GET /models
+type geminiModelsResponse struct {
+	Models []struct {
+		Name                       string   `json:"name"`
+		DisplayName                string   `json:"displayName"`
+		InputTokenLimit            int      `json:"inputTokenLimit"`
+		OutputTokenLimit           int      `json:"outputTokenLimit"`
+		SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+	} `json:"models"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+// listModelsGemini pages through the Gemini models endpoint, keeping only
+// models that support generateContent
+func (c *Client) listModelsGemini(ctx context.Context) ([]ModelInfo, error) {
+	var models []ModelInfo
+	pageToken := ""
+	for {
+		query := url.Values{"key": {c.apiKey}, "pageSize": {"100"}}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+
+		var page geminiModelsResponse
+		if err := c.getJSON(ctx, c.baseURL+"/models?"+query.Encode(), &page); err != nil {
+			return nil, err
+		}
+
+		for _, m := range page.Models {
+			if !containsString(m.SupportedGenerationMethods, "generateContent") {
+				continue
+			}
+			models = append(models, ModelInfo{
+				ID:      strings.TrimPrefix(m.Name, "models/"),
+				Name:    m.DisplayName,
+				Details: fmt.Sprintf("in %s / out %s tokens", formatTokenCount(m.InputTokenLimit), formatTokenCount(m.OutputTokenLimit)),
+			})
+		}
+
+		if page.NextPageToken == "" {
+			return models, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// ollamaTagsResponse is the body of Ollama's GET /api/tags
+type ollamaTagsResponse struct {
+	Models []struct {
+		Name    string `json:"name"`
+		Size    int64  `json:"size"`
+		Details struct {
+			Family            string `json:"family"`
+			ParameterSize     string `json:"parameter_size"`
+			QuantizationLevel string `json:"quantization_level"`
+		} `json:"details"`
+	} `json:"models"`
+}
+
+// listModelsLocal asks an OpenAI-compatible server for /v1/models and falls
+// back to Ollama's /api/tags, which lists installed rather than loaded
+// models and says more about each one
+func (c *Client) listModelsLocal(ctx context.Context) ([]ModelInfo, error) {
+	list, err := c.listLocalModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if list != nil && len(list.Data) > 0 {
+		models := make([]ModelInfo, 0, len(list.Data))
+		for _, m := range list.Data {
+			var details []string
+			if m.Type != "" {
+				details = append(details, m.Type)
+			}
+			if len(m.Capabilities) > 0 {
+				details = append(details, strings.Join(m.Capabilities, ", "))
+			}
+			models = append(models, ModelInfo{ID: m.ID, Details: strings.Join(details, "; ")})
+		}
+		return models, nil
+	}
+
+	var tags ollamaTagsResponse
+	if err := c.getJSON(ctx, c.baseURL+"/api/tags", &tags); err != nil {
+		if list != nil {
+			return nil, nil // the server answered /v1/models with an empty list
+		}
+		return nil, fmt.Errorf("server lists no models at /v1/models or /api/tags: %w", err)
+	}
+
+	models := make([]ModelInfo, 0, len(tags.Models))
+	for _, m := range tags.Models {
+		var details []string
+		for _, d := range []string{m.Details.Family, m.Details.ParameterSize, m.Details.QuantizationLevel} {
+			if d != "" {
+				details = append(details, d)
+			}
+		}
+		if m.Size > 0 {
+			details = append(details, FormatSize(m.Size))
+		}
+		models = append(models, ModelInfo{ID: m.Name, Details: strings.Join(details, ", ")})
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models, nil
+}
+
+// getJSON fetches apiURL and decodes the JSON body into v
+func (c *Client) getJSON(ctx context.Context, apiURL string, v any) error {
+	if c.debug {
+		fmt.Printf("[DEBUG] GET %s\n", redactKey(apiURL))
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &APIError{
+			StatusCode: resp.StatusCode,
+			Message:    fmt.Sprintf("API error (status %d)", resp.StatusCode),
+			Details:    string(body),
+		}
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// redactKey hides the API key in a URL for debug output
+func redactKey(apiURL string) string {
+	u, err := url.Parse(apiURL)
+	if err != nil || u.Query().Get("key") == "" {
+		return apiURL
+	}
+	q := u.Query()
+	q.Set("key", "REDACTED")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// formatTokenCount shortens a token limit, e.g. 1048576 -> "1M", 8192 -> "8K"
+func formatTokenCount(n int) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%dM", n>>20)
+	case n >= 1000000:
+		return fmt.Sprintf("%.1fM", float64(n)/1000000)
+	case n >= 1024 && n%1024 == 0:
+		return fmt.Sprintf("%dK", n>>10)
+	case n >= 1000:
+		return fmt.Sprintf("%dK", n/1000)
+	default:
+		return fmt.Sprintf("%d", n)
+	}
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
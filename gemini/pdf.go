@@ -0,0 +1,117 @@
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultPDFDPI is the resolution PDF pages are rendered at when none
+	// is given: sharp enough for small print, small enough to stay well
+	// under MaxFileSize
+	DefaultPDFDPI = 200
+
+	// MinPDFDPI and MaxPDFDPI bound the render resolution. Below 72 text
+	// becomes unreadable; above 600 pages grow past what any provider
+	// looks at and risk exceeding MaxFileSize.
+	MinPDFDPI = 72
+	MaxPDFDPI = 600
+
+	// pdfJPEGQuality keeps rendered pages compact without visible
+	// artifacts around text
+	pdfJPEGQuality = 90
+
+	// pdfRenderTimeout stops a renderer stuck on a damaged PDF; a long
+	// book at MaxPDFDPI takes a few minutes
+	pdfRenderTimeout = 10 * time.Minute
+)
+
+// pdfRenderer is the poppler tool PDF pages are rendered with
+var pdfRenderer = "pdftoppm"
+
+// isPDFFile reports whether a source path names a PDF document
+func isPDFFile(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".pdf")
+}
+
+// ValidatePDFDPI checks a PDF render resolution; 0 stands for DefaultPDFDPI
+func ValidatePDFDPI(dpi int) error {
+	if dpi != 0 && (dpi < MinPDFDPI || dpi > MaxPDFDPI) {
+		return fmt.Errorf("PDF DPI must be between %d and %d, got %d", MinPDFDPI, MaxPDFDPI, dpi)
+	}
+	return nil
+}
+
+// rasterizePDF renders each page of a PDF into its own temp directory and
+// returns the images in page order. They are named "<stem>-<page>.jpg",
+// so the base-name sort in LoadImages keeps several PDFs apart.
+func rasterizePDF(pdf string, dpi int) ([]string, error) {
+	if err := ValidatePDFDPI(dpi); err != nil {
+		return nil, err
+	}
+	if dpi == 0 {
+		dpi = DefaultPDFDPI
+	}
+
+	renderer, err := exec.LookPath(pdfRenderer)
+	if err != nil {
+		return nil, fmt.Errorf("PDF input needs %s on PATH (install poppler-utils, or poppler on macOS)", pdfRenderer)
+	}
+
+	dir, err := newTempDir("capycut-pdf-*")
+	if err != nil {
+		return nil, err
+	}
+
+	stem := strings.TrimSuffix(filepath.Base(pdf), filepath.Ext(pdf))
+	prefix := filepath.Join(dir, stem)
+
+	ctx, cancel := context.WithTimeout(context.Background(), pdfRenderTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, renderer, buildPdftoppmArgs(pdf, prefix, dpi)...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("rendering %s took longer than %s", filepath.Base(pdf), pdfRenderTimeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("failed to render %s: %s", filepath.Base(pdf), msg)
+		}
+		return nil, fmt.Errorf("failed to render %s: %w", filepath.Base(pdf), err)
+	}
+
+	// pdftoppm pads page numbers to the width of the page count, but sort
+	// by number rather than trust that
+	pages, err := filepath.Glob(filepath.Join(dir, "*.jpg"))
+	if err != nil {
+		return nil, err
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("no pages rendered from %s", filepath.Base(pdf))
+	}
+	sort.Slice(pages, func(i, j int) bool {
+		return NaturalLess(filepath.Base(pages[i]), filepath.Base(pages[j]))
+	})
+	return pages, nil
+}
+
+// buildPdftoppmArgs returns the pdftoppm arguments that render every page
+// of pdf as "<prefix>-<page>.jpg" at dpi
+func buildPdftoppmArgs(pdf, prefix string, dpi int) []string {
+	return []string{
+		"-r", strconv.Itoa(dpi),
+		"-jpeg",
+		"-jpegopt", fmt.Sprintf("quality=%d", pdfJPEGQuality),
+		pdf,
+		prefix,
+	}
+}
@@ -0,0 +1,248 @@
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SkipPreflightEnvVar turns off the local model check when set, for servers
+// where the test image is slow or the check gets it wrong
+const SkipPreflightEnvVar = "CAPYCUT_SKIP_PREFLIGHT"
+
+// PreflightTimeout bounds the check; a local server may have to load the
+// model before it answers the test image
+const PreflightTimeout = 90 * time.Second
+
+// PreflightEnabled reports whether callers should run Preflight
+func PreflightEnabled() bool {
+	return os.Getenv(SkipPreflightEnvVar) == ""
+}
+
+// VisionSupport is what Preflight could find out about a model's image input
+type VisionSupport int
+
+const (
+	// VisionUnknown means the server gave no usable answer either way
+	VisionUnknown VisionSupport = iota
+
+	// VisionSupported means the model read the test image or the server
+	// lists it as vision-capable
+	VisionSupported
+
+	// VisionUnsupported means the model is listed as text-only, the server
+	// rejected the test image, or the model misread it
+	VisionUnsupported
+)
+
+// PreflightResult describes the model a client is about to use
+type PreflightResult struct {
+	// Model is the vision model that was checked
+	Model string
+
+	// ModelListed is false when the server's model list leaves Model out,
+	// which usually means it isn't loaded; always true for cloud providers
+	ModelListed bool
+
+	// AvailableModels is the server's model list, when it has one
+	AvailableModels []string
+
+	// Vision is whether the model appears to accept images
+	Vision VisionSupport
+
+	// Warnings are problems worth showing before the first batch
+	Warnings []string
+}
+
+// localModelsResponse is the body of an OpenAI-compatible GET /v1/models.
+// Type and Capabilities are extensions some servers add (LM Studio reports
+// "vlm" or "llm", Ollama a capability list).
+type localModelsResponse struct {
+	Data []struct {
+		ID           string   `json:"id"`
+		Type         string   `json:"type,omitempty"`
+		Capabilities []string `json:"capabilities,omitempty"`
+	} `json:"data"`
+}
+
+// probePrompt asks about the solid red probe image
+const probePrompt = "What color is this image? Answer with one word."
+
+// Preflight checks that a local vision model exists and can read images, so
+// a text-only model picked by mistake is caught before it turns every page
+// into garbage. It asks the server's /v1/models first and, when that says
+// nothing about vision, sends a tiny test image. Cloud providers always
+// pass. An error means the server couldn't be reached at all.
+func (c *Client) Preflight(ctx context.Context) (*PreflightResult, error) {
+	result := &PreflightResult{Model: c.model, ModelListed: true}
+	if c.provider != ProviderLocal {
+		result.Vision = VisionSupported
+		return result, nil
+	}
+
+	models, err := c.listLocalModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if models != nil {
+		result.ModelListed = false
+		for _, m := range models.Data {
+			result.AvailableModels = append(result.AvailableModels, m.ID)
+			if m.ID != c.model {
+				continue
+			}
+			result.ModelListed = true
+			result.Vision = modelVisionSupport(m.Type, m.Capabilities)
+		}
+		if !result.ModelListed && len(result.AvailableModels) > 0 {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("Model %q is not loaded on %s (available: %s)",
+				c.model, c.baseURL, strings.Join(result.AvailableModels, ", ")))
+		}
+	}
+
+	var answer string
+	if result.Vision == VisionUnknown {
+		result.Vision, answer = c.probeVision(ctx)
+	}
+
+	if result.Vision == VisionUnsupported {
+		warning := fmt.Sprintf("Model %q does not appear to support images; set LLM_MODEL to a vision model such as qwen2.5-vl or llava", c.model)
+		if answer != "" {
+			warning += fmt.Sprintf(" (it answered %q when shown a solid red test image)", truncateUTF8(answer, 40))
+		}
+		result.Warnings = append(result.Warnings, warning)
+	}
+
+	return result, nil
+}
+
+// listLocalModels fetches the server's model list. It returns nil without an
+// error when the server doesn't implement the endpoint.
+func (c *Client) listLocalModels(ctx context.Context) (*localModelsResponse, error) {
+	apiURL := fmt.Sprintf("%s/v1/models", c.baseURL)
+	if c.debug {
+		fmt.Printf("[DEBUG] GET %s\n", apiURL)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("request failed (is the LLM server running?): %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if c.debug {
+			fmt.Printf("[DEBUG] Model list unavailable (status %d)\n", resp.StatusCode)
+		}
+		return nil, nil
+	}
+
+	var models localModelsResponse
+	if err := json.Unmarshal(body, &models); err != nil {
+		if c.debug {
+			fmt.Printf("[DEBUG] Unrecognized model list: %v\n", err)
+		}
+		return nil, nil
+	}
+	return &models, nil
+}
+
+// modelVisionSupport reads the vision hints some servers add to /v1/models
+func modelVisionSupport(modelType string, capabilities []string) VisionSupport {
+	for _, c := range capabilities {
+		if strings.EqualFold(c, "vision") {
+			return VisionSupported
+		}
+	}
+	switch strings.ToLower(modelType) {
+	case "vlm":
+		return VisionSupported
+	case "llm", "embeddings":
+		return VisionUnsupported
+	}
+	if len(capabilities) > 0 {
+		return VisionUnsupported
+	}
+	return VisionUnknown
+}
+
+// probeVision shows the model a solid red image and checks that the answer
+// names the color. Text-only models either get the request rejected or,
+// when the server drops the image silently, have to guess. It also returns
+// the model's answer, for the warning.
+func (c *Client) probeVision(ctx context.Context) (VisionSupport, string) {
+	resp, err := c.generateContentLocal(ctx, &LocalLLMRequest{
+		Model: c.model,
+		Messages: []LocalLLMMessage{{Role: "user", Content: []LocalLLMContent{
+			{Type: "image_url", ImageURL: &LocalLLMImageURL{URL: probeImageURL()}},
+			{Type: "text", Text: probePrompt},
+		}}},
+		MaxTokens:   16,
+		Temperature: floatPtr(0),
+	})
+	if err != nil {
+		if c.debug {
+			fmt.Printf("[DEBUG] Vision probe failed: %v\n", err)
+		}
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode < 500 && mentionsImages(apiErr.Details) {
+			return VisionUnsupported, ""
+		}
+		return VisionUnknown, ""
+	}
+	if len(resp.Choices) == 0 {
+		return VisionUnknown, ""
+	}
+
+	answer := strings.TrimSpace(resp.Choices[0].Message.Content)
+	if probeAnswerPattern.MatchString(answer) {
+		return VisionSupported, answer
+	}
+	return VisionUnsupported, answer
+}
+
+// probeAnswerPattern matches red as a word, so an answer like "I cannot
+// read images" or "it's covered" doesn't pass for seeing the image
+var probeAnswerPattern = regexp.MustCompile(`(?i)\bred\b`)
+
+// mentionsImages reports whether a server error is about image input
+func mentionsImages(details string) bool {
+	details = strings.ToLower(details)
+	for _, word := range []string{"image", "vision", "multimodal"} {
+		if strings.Contains(details, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// probeImageURL returns a small solid red PNG as a data URL
+func probeImageURL() string {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: color.RGBA{R: 255, A: 255}}, image.Point{}, draw.Src)
+
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, img) // can't fail for an in-memory RGBA image
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
@@ -0,0 +1,158 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"capycut/llm"
+)
+
+const (
+	// remoteDownloadConcurrency bounds how many URL sources download at once
+	remoteDownloadConcurrency = 4
+
+	// remoteDownloadTimeout bounds a single URL download
+	remoteDownloadTimeout = 2 * time.Minute
+)
+
+// maxRemoteImageSize caps a downloaded image, matching the local file limit
+var maxRemoteImageSize int64 = MaxFileSize
+
+// remoteImageTypes maps the content types accepted for URL sources to the
+// extension the download is saved with
+var remoteImageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"image/bmp":  ".bmp",
+	"image/tiff": ".tiff",
+}
+
+// isRemoteSource reports whether a source is an http:// or https:// URL
+func isRemoteSource(source string) bool {
+	lower := strings.ToLower(source)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// downloadRemoteImages downloads the URL sources into a temp directory that
+// CleanupTempFiles removes, a few at a time. The files are numbered in the
+// order the URLs were given so the base-name sort in LoadImages keeps it.
+func downloadRemoteImages(urls []string) ([]string, error) {
+	transport, err := llm.TransportFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Transport: transport, Timeout: remoteDownloadTimeout}
+
+	dir, err := newTempDir("capycut-url-*")
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, len(urls))
+	errs := make([]error, len(urls))
+	sem := make(chan struct{}, remoteDownloadConcurrency)
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			paths[i], errs[i] = downloadRemoteImage(client, u, dir, i)
+		}(i, u)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("source %q: %w", urls[i], err)
+		}
+	}
+	return paths, nil
+}
+
+// downloadRemoteImage fetches one image into dir, rejecting responses that
+// aren't images or are larger than maxRemoteImageSize
+func downloadRemoteImage(client *http.Client, rawURL, dir string, index int) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), remoteDownloadTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download failed: %s", resp.Status)
+	}
+	if resp.ContentLength > maxRemoteImageSize {
+		return "", fmt.Errorf("image is %s, over the %s limit", FormatSize(resp.ContentLength), FormatSize(maxRemoteImageSize))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteImageSize+1))
+	if err != nil {
+		return "", fmt.Errorf("download failed: %w", err)
+	}
+	if int64(len(data)) > maxRemoteImageSize {
+		return "", fmt.Errorf("image is over the %s limit", FormatSize(maxRemoteImageSize))
+	}
+
+	ext, err := remoteImageExt(resp.Header.Get("Content-Type"), data, u.Path)
+	if err != nil {
+		return "", err
+	}
+
+	name := strings.TrimSuffix(path.Base(u.Path), path.Ext(u.Path))
+	if name == "" || name == "." || name == "/" {
+		name = "image"
+	}
+	dest := filepath.Join(dir, fmt.Sprintf("%04d_%s%s", index+1, flattenEntryName(name), ext))
+	if err := os.WriteFile(dest, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to save download: %w", err)
+	}
+	return dest, nil
+}
+
+// remoteImageExt picks the extension for a download from its Content-Type.
+// Generic types like application/octet-stream, which object stores often
+// send, fall back to sniffing the bytes and then to the URL's extension.
+func remoteImageExt(contentType string, data []byte, urlPath string) (string, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if ext, ok := remoteImageTypes[mediaType]; ok {
+		return ext, nil
+	}
+	if mediaType != "" && mediaType != "application/octet-stream" && mediaType != "binary/octet-stream" {
+		return "", fmt.Errorf("not an image: content type %s", mediaType)
+	}
+
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	if ext, ok := remoteImageTypes[sniffed]; ok {
+		return ext, nil
+	}
+	if isImageFile(urlPath) {
+		return strings.ToLower(path.Ext(urlPath)), nil
+	}
+	return "", fmt.Errorf("not an image: content type %s", sniffed)
+}
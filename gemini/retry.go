@@ -0,0 +1,115 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+const (
+	// DefaultMaxBatchRetries is how often a failing batch is sent again
+	// when TranscribeRequest.MaxBatchRetries is unset
+	DefaultMaxBatchRetries = 3
+
+	// NoBatchRetries turns batch retries off, failing the job on the first
+	// error as before
+	NoBatchRetries = -1
+)
+
+// retryBackoff is the wait before each retry, the last step repeating.
+// Tests shorten it.
+var retryBackoff = []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second}
+
+// isRetryable reports whether a failed request may succeed if sent again:
+// rate limits, timeouts and server errors from the API, and network errors
+// such as a dropped connection, are. Anything else, from a client error
+// or cancellation to an unreadable image or an invalid request, fails the
+// same way every time.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return retryableStatus(apiErr.StatusCode)
+	}
+	var sdkErr *anthropic.Error
+	if errors.As(err, &sdkErr) {
+		return retryableStatus(sdkErr.StatusCode)
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// retryableStatus reports whether an HTTP status is worth retrying
+func retryableStatus(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
+
+// retryWait returns how long to wait before retry attempt (0-based),
+// preferring the server's Retry-After when err carries one
+func retryWait(attempt int, err error) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return min(apiErr.RetryAfter, maxRetryAfter)
+	}
+	return retryBackoff[min(attempt, len(retryBackoff)-1)]
+}
+
+// batchRetries returns how often this client retries a failing batch. A
+// client with fallbacks hands the batch on instead, so a provider that is
+// down fails over at once; the last provider in the chain retries.
+func (c *Client) batchRetries(req *TranscribeRequest) int {
+	if len(c.fallbacks) > 0 {
+		return 0
+	}
+	switch {
+	case req.MaxBatchRetries == 0:
+		return DefaultMaxBatchRetries
+	case req.MaxBatchRetries < 0:
+		return 0
+	default:
+		return req.MaxBatchRetries
+	}
+}
+
+// processBatchProviderWithRetry sends a batch, sending it again with
+// exponential backoff while it fails with a retryable error. Only this
+// batch is resent; the others keep running and keep their results.
+func (c *Client) processBatchProviderWithRetry(ctx context.Context, images []*ImageInfo, req *TranscribeRequest, model string, maxTokens int, tctx *transcribeContext, batchNum int) ([]*PageContent, int, error) {
+	retries := c.batchRetries(req)
+	for attempt := 0; ; attempt++ {
+		pages, tokens, err := c.processBatchProvider(ctx, images, req, model, maxTokens, tctx, batchNum)
+
+		var truncErr *TruncatedOutputError
+		if err == nil || errors.As(err, &truncErr) || attempt >= retries || !isRetryable(err) || ctx.Err() != nil {
+			return pages, tokens, err
+		}
+
+		wait := retryWait(attempt, err)
+		c.sendProgress(tctx, ProgressUpdate{
+			Status:       StatusWarning,
+			Message:      "Batch failed, retrying",
+			Detail:       fmt.Sprintf("Batch %d: retry %d/%d in %s: %v", batchNum, attempt+1, retries, wait, err),
+			CurrentBatch: batchNum,
+			Model:        model,
+		})
+		if c.debug {
+			fmt.Printf("[DEBUG] Batch %d retry %d/%d after %v: %v\n", batchNum, attempt+1, retries, wait, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
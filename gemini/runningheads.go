@@ -0,0 +1,243 @@
+package gemini
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+const (
+	// runningHeadZone is how many non-blank lines at the top and at the
+	// bottom of each page are checked for running heads
+	runningHeadZone = 2
+
+	// runningHeadMinPages is the fewest pages a line must repeat on
+	runningHeadMinPages = 3
+
+	// runningHeadMinShare is the share of pages a line must repeat on. It
+	// is under half so books that alternate the book title and the chapter
+	// title on facing pages still have both detected.
+	runningHeadMinShare = 0.4
+
+	// runningHeadSimilarity is how alike two normalized lines must be
+	// (1 - edit distance / length) to count as the same head, which
+	// absorbs OCR slips
+	runningHeadSimilarity = 0.8
+
+	// runningHeadMaxLen skips long lines, which are body text rather than
+	// a header or footer
+	runningHeadMaxLen = 100
+)
+
+// StripRunningHeads removes running headers and footers, such as a book
+// title at the top and page numbers at the bottom of every page, from the
+// pages' Text. It compares the first and last few lines of every page, so
+// call it once on the whole page set rather than per batch. It returns the
+// number of lines removed.
+func StripRunningHeads(pages []*PageContent) int {
+	minPages := int(math.Ceil(runningHeadMinShare * float64(len(pages))))
+	if minPages < runningHeadMinPages {
+		minPages = runningHeadMinPages
+	}
+	if len(pages) < minPages {
+		return 0
+	}
+
+	lines := make([][]string, len(pages))
+	tops := make([][]headLine, len(pages))
+	bottoms := make([][]headLine, len(pages))
+	for i, page := range pages {
+		lines[i] = strings.Split(page.Text, "\n")
+		tops[i], bottoms[i] = runningHeadZones(lines[i])
+	}
+	topHeads := repeatedHeads(tops, minPages)
+	bottomHeads := repeatedHeads(bottoms, minPages)
+	if len(topHeads) == 0 && len(bottomHeads) == 0 {
+		return 0
+	}
+
+	removed := 0
+	for i, page := range pages {
+		drop := make(map[int]bool)
+		for _, l := range tops[i] {
+			if matchesHead(l.key, topHeads) && !isChapterTitle(page, lines[i][l.index]) {
+				drop[l.index] = true
+			}
+		}
+		for _, l := range bottoms[i] {
+			if matchesHead(l.key, bottomHeads) {
+				drop[l.index] = true
+			}
+		}
+		if len(drop) == 0 {
+			continue
+		}
+
+		kept := make([]string, 0, len(lines[i])-len(drop))
+		for j, line := range lines[i] {
+			if !drop[j] {
+				kept = append(kept, line)
+			}
+		}
+		page.Text = strings.Trim(strings.Join(kept, "\n"), "\n")
+		removed += len(drop)
+	}
+	return removed
+}
+
+// headLine is a candidate running head: its line index and normalized text
+type headLine struct {
+	index int
+	key   string
+}
+
+// runningHeadZones returns the first and last runningHeadZone non-blank
+// lines of a page that are short enough to be a header or footer
+func runningHeadZones(lines []string) (top, bottom []headLine) {
+	candidate := func(i int) (headLine, bool) {
+		if len([]rune(strings.TrimSpace(lines[i]))) > runningHeadMaxLen {
+			return headLine{}, false
+		}
+		key := normalizeRunningHead(lines[i])
+		return headLine{index: i, key: key}, key != ""
+	}
+
+	// On short pages the zones would overlap; a line is only ever a header
+	end := 0
+	seen := 0
+	for i := 0; i < len(lines) && seen < runningHeadZone; i++ {
+		if strings.TrimSpace(lines[i]) == "" {
+			continue
+		}
+		seen++
+		end = i + 1
+		if l, ok := candidate(i); ok {
+			top = append(top, l)
+		}
+	}
+	seen = 0
+	for i := len(lines) - 1; i >= end && seen < runningHeadZone; i-- {
+		if strings.TrimSpace(lines[i]) == "" {
+			continue
+		}
+		seen++
+		if l, ok := candidate(i); ok {
+			bottom = append(bottom, l)
+		}
+	}
+	return top, bottom
+}
+
+// repeatedHeads groups similar zone lines across pages and returns the
+// normalized text of each group found on at least minPages pages
+func repeatedHeads(zones [][]headLine, minPages int) []string {
+	type group struct {
+		key   string
+		pages map[int]bool
+	}
+	var groups []*group
+	for page, zone := range zones {
+		for _, l := range zone {
+			var match *group
+			for _, g := range groups {
+				if similarHeads(l.key, g.key) {
+					match = g
+					break
+				}
+			}
+			if match == nil {
+				match = &group{key: l.key, pages: make(map[int]bool)}
+				groups = append(groups, match)
+			}
+			match.pages[page] = true
+		}
+	}
+
+	var heads []string
+	for _, g := range groups {
+		if len(g.pages) >= minPages {
+			heads = append(heads, g.key)
+		}
+	}
+	return heads
+}
+
+// matchesHead reports whether key is similar to one of heads
+func matchesHead(key string, heads []string) bool {
+	for _, head := range heads {
+		if similarHeads(key, head) {
+			return true
+		}
+	}
+	return false
+}
+
+// isChapterTitle reports whether line is the title of the chapter starting
+// on page, which can look like a running head but has to stay
+func isChapterTitle(page *PageContent, line string) bool {
+	if !page.IsChapterStart || page.ChapterTitle == "" {
+		return false
+	}
+	return normalizeRunningHead(line) == normalizeRunningHead(page.ChapterTitle)
+}
+
+// normalizeRunningHead reduces a line to lowercase letters, single spaces
+// and a 0 for each run of digits, so "Page 12" matches "**Page 13**" and a
+// title in a heading matches the same title in plain text
+func normalizeRunningHead(line string) string {
+	var b strings.Builder
+	space, digit := false, false
+	for _, r := range strings.ToLower(line) {
+		switch {
+		case unicode.IsDigit(r):
+			if !digit {
+				if space && b.Len() > 0 {
+					b.WriteByte(' ')
+				}
+				b.WriteByte('0')
+			}
+			space, digit = false, true
+		case unicode.IsLetter(r):
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(r)
+			space, digit = false, false
+		case unicode.IsSpace(r):
+			space, digit = true, false
+		}
+	}
+	return b.String()
+}
+
+// similarHeads reports whether two normalized lines are close enough to be
+// the same running head
+func similarHeads(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	return 1-float64(editDistance(ra, rb))/float64(longest) >= runningHeadSimilarity
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
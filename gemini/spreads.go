@@ -0,0 +1,143 @@
+package gemini
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SpreadAspectRatio is the width/height ratio above which an image is taken
+// for a two-page spread. A single portrait page is about 0.7 and a scanned
+// spread about 1.4, so 1.2 leaves room for wide margins and skewed scans.
+const SpreadAspectRatio = 1.2
+
+// IsSpread reports whether an image is landscape enough to be a two-page
+// spread. Only the header is read. Images that can't be decoded are never
+// spreads; they are left for validation to report.
+func IsSpread(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil || cfg.Height == 0 {
+		return false
+	}
+	return float64(cfg.Width)/float64(cfg.Height) > SpreadAspectRatio
+}
+
+// FindSpreads returns the images that look like two-page spreads, so
+// interactive callers can offer to split them
+func FindSpreads(paths []string) []string {
+	var spreads []string
+	for _, p := range paths {
+		if IsSpread(p) {
+			spreads = append(spreads, p)
+		}
+	}
+	return spreads
+}
+
+// SplitSpreads replaces every spread in paths with its left and right
+// halves, in that order, so each becomes two logical pages in reading
+// order. Other images are kept as they are. Halves are written to a temp
+// directory; call CleanupTempFiles when done with the returned paths.
+//
+// Page numbers come from an image's position in the list, so after
+// splitting they count logical pages rather than source files.
+func SplitSpreads(paths []string) ([]string, error) {
+	var out []string
+	var dir string
+
+	for i, p := range paths {
+		if !IsSpread(p) {
+			out = append(out, p)
+			continue
+		}
+
+		if dir == "" {
+			var err error
+			if dir, err = newTempDir("capycut-spreads-*"); err != nil {
+				return nil, err
+			}
+		}
+
+		left, right, err := splitSpread(p, dir, i)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split %s: %w", filepath.Base(p), err)
+		}
+		out = append(out, left, right)
+	}
+
+	return out, nil
+}
+
+// splitSpread writes the two halves of a spread into dir. The halves are
+// named after the source so they stay recognizable in progress output, and
+// prefixed with its position in case two sources share a name.
+func splitSpread(path, dir string, index int) (string, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	img, format, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	})
+	if !ok {
+		return "", "", fmt.Errorf("unsupported image type %T", img)
+	}
+
+	b := img.Bounds()
+	mid := b.Min.X + b.Dx()/2
+	halves := []image.Rectangle{
+		image.Rect(b.Min.X, b.Min.Y, mid, b.Max.Y),
+		image.Rect(mid, b.Min.Y, b.Max.X, b.Max.Y),
+	}
+
+	// Keep JPEG scans as JPEG; everything else goes lossless
+	ext := ".png"
+	if format == "jpeg" {
+		ext = ".jpg"
+	}
+	stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	var names [2]string
+	for i, r := range halves {
+		name := filepath.Join(dir, fmt.Sprintf("%04d_%s_%c%s", index+1, stem, "LR"[i], ext))
+		if err := writeImage(name, sub.SubImage(r), format); err != nil {
+			return "", "", err
+		}
+		names[i] = name
+	}
+	return names[0], names[1], nil
+}
+
+// writeImage encodes img to path, as JPEG when the source was JPEG
+func writeImage(path string, img image.Image, format string) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if format == "jpeg" {
+		err = jpeg.Encode(out, img, &jpeg.Options{Quality: 95})
+	} else {
+		err = png.Encode(out, img)
+	}
+	if err != nil {
+		out.Close()
+		return fmt.Errorf("failed to encode %s: %w", filepath.Base(path), err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,265 @@
+package gemini
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"capycut/fsmode"
+)
+
+// StreamWriter writes documents to disk while a transcription is still
+// running, so early pages can be read before late batches finish. Plug
+// AddBatch into TranscribeRequest.OnBatchComplete and call Close once
+// TranscribeImages returns, whether or not it succeeded.
+//
+// Batches are flushed in order, so a batch that finishes early waits for
+// its predecessors. In per-page mode each page is written as soon as its
+// batch is flushed. In combine mode pages are appended to the open file,
+// unless front matter, a table of contents, a filename template or a
+// non-markdown format needs the whole document, in which case the file is
+// written at Close. Chapter mode always writes at Close, since chapter
+// boundaries depend on every page, and so does StripRunningHeads, since
+// running heads are only known once every page is in. With DedupePages a
+// batch also carries the repeats of its pages, which belong further on, so
+// those documents are written at Close as well.
+type StreamWriter struct {
+	req  *TranscribeRequest
+	opts WriteOptions
+	now  time.Time
+
+	mu      sync.Mutex
+	next    int                    // index of the next batch to flush
+	pending map[int][]*PageContent // finished batches waiting for earlier ones
+	docs    []*MarkdownDocument    // written documents, content dropped, for the index
+	held    []*PageContent         // pages kept for documents written at Close
+	result  *WriteResult
+	closed  bool
+
+	// combined is the open file in streaming combine mode
+	combined     *os.File
+	combinedPath string
+	combinedDoc  *MarkdownDocument
+	lastByte     byte
+}
+
+// NewStreamWriter creates the output directory and prepares to write the
+// documents req would produce. opts.RawPages is ignored; pass the pages to
+// Close instead.
+func NewStreamWriter(req *TranscribeRequest, opts WriteOptions) (*StreamWriter, error) {
+	if opts.OutputDir == "" {
+		opts.OutputDir = "."
+	}
+	if err := makeOutputDir(opts); err != nil {
+		return nil, err
+	}
+	opts.RawPages = nil
+
+	return &StreamWriter{
+		req:     req,
+		opts:    opts,
+		now:     time.Now(),
+		pending: make(map[int][]*PageContent),
+		result:  &WriteResult{},
+	}, nil
+}
+
+// streamsPages reports whether documents are written as batches arrive
+func (w *StreamWriter) streamsPages() bool {
+	switch {
+	case w.req.DetectChapters, w.req.StripRunningHeads, w.req.DedupePages:
+		return false
+	case w.req.CombinePages:
+		return w.combineAppends()
+	default:
+		return true
+	}
+}
+
+// combineAppends reports whether the combined document can be appended to
+// page by page and still match what WriteDocuments would produce
+func (w *StreamWriter) combineAppends() bool {
+	formats := w.opts.formats()
+	return len(formats) == 1 && formats[0] == FormatMarkdown && !w.req.ExtractTables &&
+		!w.opts.AddFrontMatter && !w.opts.AddTableOfContents && w.opts.OutputTemplate == ""
+}
+
+// AddBatch accepts a finished batch; it matches OnBatchComplete. Write
+// errors are collected and returned by Close rather than stopping the job.
+func (w *StreamWriter) AddBatch(batchIndex int, pages []*PageContent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed || batchIndex < w.next {
+		return // already flushed, e.g. a retried job delivering it again
+	}
+	if _, ok := w.pending[batchIndex]; ok {
+		return
+	}
+	w.pending[batchIndex] = pages
+
+	for {
+		batch, ok := w.pending[w.next]
+		if !ok {
+			return
+		}
+		delete(w.pending, w.next)
+		w.next++
+		w.flush(batch)
+	}
+}
+
+// flush writes or holds the pages of one batch
+func (w *StreamWriter) flush(pages []*PageContent) {
+	if !w.streamsPages() {
+		w.held = append(w.held, pages...)
+		return
+	}
+	if w.req.CombinePages {
+		for _, page := range pages {
+			w.appendCombined(page)
+		}
+		return
+	}
+
+	for _, doc := range w.organize(pages) {
+		if writeDocument(doc, len(w.docs)+1, w.opts, w.now, w.result) {
+			doc.Content, doc.Pages, doc.Tables = "", nil, nil // the index only needs names and page ranges
+			w.docs = append(w.docs, doc)
+		}
+	}
+}
+
+// organize groups pages into documents exactly as TranscribeImages would
+func (w *StreamWriter) organize(pages []*PageContent) []*MarkdownDocument {
+	return OrganizePages(pages, w.req)
+}
+
+// appendCombined adds a page to the combined document, opening it first
+func (w *StreamWriter) appendCombined(page *PageContent) {
+	if w.combinedDoc == nil {
+		doc := w.organize([]*PageContent{page})[0]
+		doc.Content = "" // the text goes straight to the file
+		w.combinedDoc = doc
+
+		path, err := outputPath(w.opts.OutputDir, doc.Filename)
+		if err != nil {
+			w.result.Errors = append(w.result.Errors, err)
+			return
+		}
+		doc.Filename = filepath.Base(path)
+		if !w.opts.Overwrite {
+			if _, err := os.Stat(path); err == nil {
+				w.result.Errors = append(w.result.Errors, fmt.Errorf("file exists: %s (use --overwrite to replace)", path))
+				return
+			}
+		}
+		mode := w.opts.FileMode
+		if mode == 0 {
+			mode = fsmode.DefaultFile
+		}
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, mode)
+		if err != nil {
+			w.result.Errors = append(w.result.Errors, fmt.Errorf("failed to write %s: %w", path, err))
+			return
+		}
+		if err := applyFileMode(path, w.opts); err != nil {
+			f.Close()
+			w.result.Errors = append(w.result.Errors, fmt.Errorf("failed to write %s: %w", path, err))
+			return
+		}
+		w.combined = f
+		w.combinedPath = path
+	} else {
+		w.combinedDoc.PageRange.End = page.PageNumber
+		w.writeCombined(pageSeparator)
+	}
+
+	var content strings.Builder
+	writePageContent(&content, page, w.req)
+	w.writeCombined(content.String())
+}
+
+// writeCombined appends text to the combined file; after the first error
+// the file is abandoned
+func (w *StreamWriter) writeCombined(text string) {
+	if w.combined == nil || text == "" {
+		return
+	}
+	if _, err := w.combined.WriteString(text); err != nil {
+		w.result.Errors = append(w.result.Errors, fmt.Errorf("failed to write %s: %w", w.combinedPath, err))
+		w.combined.Close()
+		w.combined = nil
+		return
+	}
+	w.result.TotalBytes += int64(len(text))
+	w.lastByte = text[len(text)-1]
+}
+
+// Close flushes batches still waiting for a predecessor that never arrived,
+// writes the documents that needed every page, and then pages.json (when
+// rawPages is non-nil) and the index. It returns everything written.
+func (w *StreamWriter) Close(rawPages []*PageContent) (*WriteResult, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil, fmt.Errorf("stream writer already closed")
+	}
+	w.closed = true
+
+	// A failed or cancelled job can leave gaps; keep the pages that did finish
+	for len(w.pending) > 0 {
+		if batch, ok := w.pending[w.next]; ok {
+			delete(w.pending, w.next)
+			w.flush(batch)
+		}
+		w.next++
+	}
+
+	if w.combined != nil {
+		if w.lastByte != '\n' {
+			w.writeCombined("\n")
+		}
+		if w.combined != nil {
+			if err := w.combined.Close(); err != nil {
+				w.result.Errors = append(w.result.Errors, fmt.Errorf("failed to write %s: %w", w.combinedPath, err))
+			} else {
+				w.result.FilesWritten = append(w.result.FilesWritten, w.combinedPath)
+				w.docs = append(w.docs, w.combinedDoc)
+
+				if w.opts.Verbose {
+					fmt.Printf("  Wrote: %s\n", w.combinedPath)
+				}
+				w.opts.fileWritten(w.combinedPath, w.combinedDoc)
+			}
+			w.combined = nil
+		}
+	}
+
+	if len(w.held) > 0 {
+		sort.SliceStable(w.held, func(i, j int) bool { return w.held[i].PageNumber < w.held[j].PageNumber })
+		for _, doc := range w.organize(w.held) {
+			writeDocument(doc, len(w.docs)+1, w.opts, w.now, w.result)
+			w.docs = append(w.docs, doc)
+		}
+		w.held = nil
+	}
+
+	if len(w.result.FilesWritten) == 0 && len(w.result.Errors) == 0 {
+		return nil, fmt.Errorf("no documents to write")
+	}
+
+	// Match WriteDocuments callers, which index only multi-document output
+	// unless ForceIndex is set
+	opts := w.opts
+	opts.RawPages = rawPages
+	opts.CreateIndexFile = opts.CreateIndexFile && (len(w.docs) > 1 || opts.ForceIndex)
+	writeSidecars(w.docs, len(w.docs), opts, w.result)
+
+	return w.result, nil
+}
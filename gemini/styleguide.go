@@ -0,0 +1,51 @@
+package gemini
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// MaxStyleGuideSize keeps a style guide from crowding out the page text in
+// small local context windows
+const MaxStyleGuideSize = 8 * 1024
+
+// LoadStyleGuide reads a house style file for TranscribeRequest.StyleGuide
+func LoadStyleGuide(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read style guide: %w", err)
+	}
+	if len(data) > MaxStyleGuideSize {
+		return "", fmt.Errorf("style guide %s is %s, the limit is %s", path, FormatSize(int64(len(data))), FormatSize(MaxStyleGuideSize))
+	}
+	guide := strings.TrimSpace(string(data))
+	if guide == "" {
+		return "", fmt.Errorf("style guide %s is empty", path)
+	}
+	return guide, nil
+}
+
+// styleRuleMarkerRe strips list markers so every rule is rendered the same way
+var styleRuleMarkerRe = regexp.MustCompile(`^(?:[-*+]|\d+[.)])\s+`)
+
+// styleGuideRules formats a style guide as an indented bullet list, one
+// rule per non-empty line
+func styleGuideRules(guide, indent string) string {
+	var sb strings.Builder
+	for _, line := range strings.Split(guide, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		sb.WriteString(indent + "- " + styleRuleMarkerRe.ReplaceAllString(line, "") + "\n")
+	}
+	return sb.String()
+}
+
+// styleGuideForVision reports whether the extraction prompt gets the style
+// guide: when asked to, or when no refinement stage will apply it
+func (c *Client) styleGuideForVision(req *TranscribeRequest) bool {
+	return req.StyleGuide != "" && (req.StyleGuideInVision || c.textModel == "")
+}
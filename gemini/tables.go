@@ -0,0 +1,150 @@
+package gemini
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Table is a markdown table found in a page's text
+type Table struct {
+	// PageNumber is the page the table is on
+	PageNumber int
+
+	// Header is the table's first row
+	Header []string
+
+	// Rows holds the body rows, each padded to the width of the widest row
+	Rows [][]string
+}
+
+// ExtractTables finds the pipe tables in markdown text, skipping fenced
+// code blocks. A table is a row starting with "|" followed by an alignment
+// row such as "|:---|--:|". Cells are unescaped (\| becomes |) and stripped
+// of bold, italic, code and link markup, and every row is padded with empty
+// cells to the width of the widest row, header included.
+func ExtractTables(text string) []*Table {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	var tables []*Table
+	fence := ""
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+
+		if !strings.HasPrefix(trimmed, "|") || i+1 >= len(lines) || !docxTableSepRe.MatchString(strings.TrimSpace(lines[i+1])) {
+			continue
+		}
+
+		rows := [][]string{tableCells(trimmed)}
+		for i += 2; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), "|"); i++ {
+			rows = append(rows, tableCells(strings.TrimSpace(lines[i])))
+		}
+		i--
+
+		cols := 0
+		for _, row := range rows {
+			cols = max(cols, len(row))
+		}
+		for r, row := range rows {
+			for len(row) < cols {
+				row = append(row, "")
+			}
+			rows[r] = row
+		}
+		tables = append(tables, &Table{Header: rows[0], Rows: rows[1:]})
+	}
+	return tables
+}
+
+// tableCells splits a table row into cells of plain text
+func tableCells(row string) []string {
+	cells := splitTableRow(row)
+	for i, cell := range cells {
+		cells[i] = runsText(parseInline(cell))
+	}
+	return cells
+}
+
+// tablesFromPages extracts the tables of pages in page order
+func tablesFromPages(pages []*PageContent) []*Table {
+	var tables []*Table
+	for _, page := range pages {
+		for _, table := range ExtractTables(page.Text) {
+			table.PageNumber = page.PageNumber
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
+// CSV encodes the table as RFC 4180 CSV, header first
+func (t *Table) CSV() ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(t.Header); err != nil {
+		return nil, err
+	}
+	if err := w.WriteAll(t.Rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// tableFilename names the CSV of a document's nth table (1-based) after
+// the document file, e.g. "03_results_table2.csv"
+func tableFilename(docFilename string, n int) string {
+	stem := strings.TrimSuffix(docFilename, filepath.Ext(docFilename))
+	return fmt.Sprintf("%s_table%d.csv", stem, n)
+}
+
+// writeTables writes each of doc's tables to a CSV next to its primary
+// file, recording the files or the errors in result
+func writeTables(doc *MarkdownDocument, opts WriteOptions, result *WriteResult) {
+	for i, table := range doc.Tables {
+		path, err := outputPath(opts.OutputDir, tableFilename(doc.Filename, i+1))
+		if err != nil {
+			result.Errors = append(result.Errors, err)
+			continue
+		}
+
+		if !opts.Overwrite {
+			if _, err := os.Stat(path); err == nil {
+				result.Errors = append(result.Errors, fmt.Errorf("file exists: %s (use --overwrite to replace)", path))
+				continue
+			}
+		}
+
+		data, err := table.CSV()
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to encode %s: %w", path, err))
+			continue
+		}
+		if err := writeOutputFile(path, data, opts); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to write %s: %w", path, err))
+			continue
+		}
+
+		result.FilesWritten = append(result.FilesWritten, path)
+		result.TableFiles = append(result.TableFiles, path)
+		result.TotalBytes += int64(len(data))
+
+		if opts.Verbose {
+			fmt.Printf("  Wrote: %s (%d bytes)\n", path, len(data))
+		}
+		opts.fileWritten(path, doc)
+	}
+}
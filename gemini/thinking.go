@@ -0,0 +1,71 @@
+package gemini
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ThinkingBudgetEnvVar sets the thinking token budget for
+// ModelGemini3ProThinking: a token count, or "dynamic" to let the model
+// decide per request
+const ThinkingBudgetEnvVar = "GEMINI_THINKING_BUDGET"
+
+// DefaultThinkingBudget is the thinking budget when a request doesn't set
+// one. Pages are mostly read, not reasoned about, so a modest budget covers
+// the layout and chapter decisions that benefit from thinking.
+const DefaultThinkingBudget = 8192
+
+// DynamicThinkingBudget lets the model pick its thinking budget per request
+const DynamicThinkingBudget = -1
+
+// IsThinkingModel reports whether model is a thinking variant whose
+// requests carry a thinking config
+func IsThinkingModel(model string) bool {
+	return model == ModelGemini3ProThinking
+}
+
+// geminiAPIModel returns the model name the API knows. The thinking variant
+// is Gemini 3 Pro with a thinking config, not a separate model.
+func geminiAPIModel(model string) string {
+	if model == ModelGemini3ProThinking {
+		return ModelGemini3Pro
+	}
+	return model
+}
+
+// thinkingSettings returns the thinking config for a model and the output
+// token budget to ask for. Thinking tokens count against maxOutputTokens,
+// so the budget is added on top of maxTokens (up to the Gemini ceiling),
+// leaving the transcription its full share. Models without thinking get a
+// nil config and maxTokens unchanged.
+func thinkingSettings(model string, budget, maxTokens int) (*ThinkingConfig, int) {
+	if !IsThinkingModel(model) {
+		return nil, maxTokens
+	}
+	if budget == 0 {
+		budget = DefaultThinkingBudget
+	}
+	if budget == DynamicThinkingBudget {
+		return &ThinkingConfig{ThinkingBudget: intPtr(budget)}, GeminiMaxOutputTokens
+	}
+	return &ThinkingConfig{ThinkingBudget: intPtr(budget)}, min(maxTokens+budget, GeminiMaxOutputTokens)
+}
+
+// ThinkingBudgetFromEnv returns the thinking budget from
+// GEMINI_THINKING_BUDGET, or 0 (DefaultThinkingBudget) when unset
+func ThinkingBudgetFromEnv() (int, error) {
+	value := strings.TrimSpace(os.Getenv(ThinkingBudgetEnvVar))
+	if value == "" {
+		return 0, nil
+	}
+	if strings.EqualFold(value, "dynamic") {
+		return DynamicThinkingBudget, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: expected a positive token count or \"dynamic\"", ThinkingBudgetEnvVar, value)
+	}
+	return n, nil
+}
@@ -0,0 +1,226 @@
+package gemini
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+)
+
+// MaxTitleLength caps suggested titles so they stay usable in filenames
+const MaxTitleLength = 60
+
+// titlePrompt asks for a short descriptive title for a set of frames
+const titlePrompt = `These images are frames sampled in order from a short video clip.
+Suggest a short, descriptive title for the clip (3 to 6 words).
+Respond with ONLY the title: no quotes, no punctuation at the end, no explanation.`
+
+// MaxDescriptionLength caps frame descriptions at one terminal line
+const MaxDescriptionLength = 120
+
+// framePrompt asks for a one-line description of a single video frame
+const framePrompt = `This image is a single frame from a video.
+Describe what is happening in it in one short sentence (at most 15 words).
+Respond with ONLY the sentence, no preamble.`
+
+// SuggestTitle asks the configured vision model for a short title describing
+// the given frames. The result is plain text; use SanitizeFilename before
+// putting it in a path.
+func (c *Client) SuggestTitle(ctx context.Context, images []string) (string, error) {
+	if len(images) == 0 {
+		return "", fmt.Errorf("no frames to describe")
+	}
+
+	title, err := c.askAboutImages(ctx, images, titlePrompt)
+	if err != nil {
+		return "", err
+	}
+
+	title = cleanTitle(title)
+	if title == "" {
+		return "", fmt.Errorf("model returned an empty title")
+	}
+	return title, nil
+}
+
+// DescribeFrame asks the configured vision model for a one-line description
+// of a single video frame, e.g. to check a clip range before cutting it
+func (c *Client) DescribeFrame(ctx context.Context, image string) (string, error) {
+	description, err := c.askAboutImages(ctx, []string{image}, framePrompt)
+	if err != nil {
+		return "", err
+	}
+
+	description = cleanDescription(description)
+	if description == "" {
+		return "", fmt.Errorf("model returned an empty description")
+	}
+	return description, nil
+}
+
+// askAboutImages sends images and a short-answer prompt to the provider
+// and returns the raw reply text
+func (c *Client) askAboutImages(ctx context.Context, images []string, prompt string) (string, error) {
+	switch c.provider {
+	case ProviderLocal:
+		return c.askAboutImagesLocal(ctx, images, prompt)
+	case ProviderAzureAnthropic, ProviderAnthropic:
+		return c.askAboutImagesAzureAnthropic(ctx, images, prompt)
+	default:
+		return c.askAboutImagesGemini(ctx, images, prompt)
+	}
+}
+
+// askAboutImagesGemini sends the frames inline to the Gemini API
+func (c *Client) askAboutImagesGemini(ctx context.Context, images []string, prompt string) (string, error) {
+	parts := make([]*Part, 0, len(images)+1)
+	for _, path := range images {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+		}
+		parts = append(parts, &Part{
+			InlineData: &InlineData{
+				MIMEType: getMIMEType(strings.ToLower(filepath.Ext(path))),
+				Data:     base64.StdEncoding.EncodeToString(data),
+			},
+		})
+	}
+	parts = append(parts, &Part{Text: prompt})
+
+	model := c.model
+	if model == "" {
+		model = ModelGemini25Flash
+	}
+
+	resp, err := c.generateContent(ctx, model, &GenerateContentRequest{
+		Contents: []*Content{{Role: "user", Parts: parts}},
+		GenerationConfig: &GenerationConfig{
+			MaxOutputTokens: intPtr(64),
+			Temperature:     floatPtr(0.4),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
+		return "", fmt.Errorf("no answer in response")
+	}
+	return answerText(resp.Candidates[0].Content), nil
+}
+
+// askAboutImagesLocal sends the frames as data URLs to an OpenAI-compatible server
+func (c *Client) askAboutImagesLocal(ctx context.Context, images []string, prompt string) (string, error) {
+	content := make([]LocalLLMContent, 0, len(images)+1)
+	for _, path := range images {
+		data, mimeType, err := ResizeImageIfNeeded(path, 500*1024, ResizeOptions{MaxWidth: 768, MaxHeight: 768, Quality: 80})
+		if err != nil {
+			return "", fmt.Errorf("failed to process %s: %w", filepath.Base(path), err)
+		}
+		content = append(content, LocalLLMContent{
+			Type: "image_url",
+			ImageURL: &LocalLLMImageURL{
+				URL: fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(data)),
+			},
+		})
+	}
+	content = append(content, LocalLLMContent{Type: "text", Text: prompt})
+
+	resp, err := c.generateContentLocal(ctx, &LocalLLMRequest{
+		Model:       c.model,
+		Messages:    []LocalLLMMessage{{Role: "user", Content: content}},
+		MaxTokens:   64,
+		Temperature: floatPtr(0.4),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no answer in response")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+// askAboutImagesAzureAnthropic sends the frames as base64 image blocks to Claude
+func (c *Client) askAboutImagesAzureAnthropic(ctx context.Context, images []string, prompt string) (string, error) {
+	if c.anthropicClient == nil {
+		return "", fmt.Errorf("Anthropic client not initialized")
+	}
+
+	blocks := make([]anthropic.ContentBlockParamUnion, 0, len(images)+1)
+	for _, path := range images {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+		}
+		blocks = append(blocks, anthropic.NewImageBlockBase64(
+			getMIMEType(strings.ToLower(filepath.Ext(path))),
+			base64.StdEncoding.EncodeToString(data),
+		))
+	}
+	blocks = append(blocks, anthropic.NewTextBlock(prompt))
+
+	var reqOpts []option.RequestOption
+	if c.requestTimeout > 0 {
+		reqOpts = append(reqOpts, option.WithRequestTimeout(c.requestTimeout))
+	}
+
+	message, err := c.anthropicClient.Messages.New(ctx, anthropic.MessageNewParams{
+		Model:     anthropic.Model(c.model),
+		MaxTokens: 64,
+		Messages: []anthropic.MessageParam{
+			{Role: anthropic.MessageParamRoleUser, Content: blocks},
+		},
+	}, reqOpts...)
+	if err != nil {
+		return "", fmt.Errorf("%s request failed: %w", c.claudeBackendName(), err)
+	}
+
+	for _, block := range message.Content {
+		if b, ok := block.AsAny().(anthropic.TextBlock); ok {
+			return b.Text, nil
+		}
+	}
+	return "", fmt.Errorf("no answer in response")
+}
+
+// cleanTitle keeps the first line of a model reply, strips quotes and
+// trailing punctuation, and caps the length at MaxTitleLength
+func cleanTitle(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexAny(s, "\r\n"); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.Trim(s, "\"'`*# ")
+	s = strings.TrimRight(s, ".!?,;: ")
+	if r := []rune(s); len(r) > MaxTitleLength {
+		s = strings.TrimSpace(string(r[:MaxTitleLength]))
+	}
+	return s
+}
+
+// cleanDescription keeps the first line of a model reply, strips quotes and
+// markdown, and caps the length at MaxDescriptionLength
+func cleanDescription(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexAny(s, "\r\n"); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.Trim(s, "\"'`*# ")
+	if r := []rune(s); len(r) > MaxDescriptionLength {
+		s = strings.TrimSpace(string(r[:MaxDescriptionLength-1])) + "…"
+	}
+	return s
+}
+
+// SanitizeFilename makes a title safe to use as a filename component
+func SanitizeFilename(title string) string {
+	return sanitizeFilename(title)
+}
@@ -3,19 +3,24 @@
 package gemini
 
 import (
+	"fmt"
 	"time"
+
+	"capycut/llm"
 )
 
 // Provider type for transcription backend
-type Provider string
+type Provider = llm.Provider
 
 const (
 	// ProviderGemini uses Google's Gemini API
-	ProviderGemini Provider = "gemini"
+	ProviderGemini = llm.ProviderGemini
 	// ProviderLocal uses local LLM via OpenAI-compatible APIs (LM Studio, Ollama, etc.)
-	ProviderLocal Provider = "local"
+	ProviderLocal = llm.ProviderLocal
 	// ProviderAzureAnthropic uses Azure Anthropic (Claude) API
-	ProviderAzureAnthropic Provider = "azure_anthropic"
+	ProviderAzureAnthropic = llm.ProviderAzureAnthropic
+	// ProviderAnthropic uses the Anthropic (Claude) API at api.anthropic.com
+	ProviderAnthropic = llm.ProviderAnthropic
 )
 
 // Model constants for Gemini models
@@ -51,7 +56,8 @@ type ImageInfo struct {
 
 // TranscribeRequest configures an image transcription request
 type TranscribeRequest struct {
-	// Images is a list of image file paths to transcribe
+	// Images is a list of image file paths to transcribe. PDFs are not
+	// accepted: LoadImages renders them one image per page.
 	Images []string
 
 	// OutputDir is the directory to write markdown files to
@@ -67,20 +73,100 @@ type TranscribeRequest struct {
 	// DetectChapters enables automatic chapter/section detection
 	DetectChapters bool
 
+	// ChapterSensitivity tunes the text heuristics that supplement the
+	// model's chapter flags (empty = medium)
+	ChapterSensitivity ChapterSensitivity
+
 	// PreserveFormatting attempts to preserve original document formatting
 	PreserveFormatting bool
 
 	// IncludeImageDescriptions adds descriptions for non-text images
 	IncludeImageDescriptions bool
 
+	// SplitSpreads cuts landscape images (see SpreadAspectRatio) into left
+	// and right pages before transcription, for scanned two-page spreads
+	SplitSpreads bool
+
+	// ExtractTables also collects the markdown tables of each document's
+	// pages (see ExtractTables) into MarkdownDocument.Tables, so that
+	// WriteDocuments writes them as CSV files next to the document
+	ExtractTables bool
+
+	// StripRunningHeads removes headers and footers repeated across pages,
+	// like a book title or page numbers, from each page's Text once every
+	// batch has finished (see StripRunningHeads)
+	StripRunningHeads bool
+
+	// DedupePages transcribes images with identical bytes once, e.g. a page
+	// scanned twice, and copies the result to each repeat in its own
+	// position, so page numbers and the documents are as without it
+	DedupePages bool
+
 	// CombinePages combines all pages into a single markdown file when false chapter detection is used
 	CombinePages bool
 
 	// MaxTokensPerRequest limits tokens per API call (for rate limiting)
 	MaxTokensPerRequest int
 
+	// Concurrency is how many batches are sent at once (0 =
+	// MaxConcurrentRequests). Raise it on high rate limit tiers, lower it
+	// to 1 on the free tier to avoid 429s. Values above MaxConcurrency are
+	// capped.
+	Concurrency int
+
+	// MaxBatchRetries is how often a batch that fails with a transient
+	// error (a 408, 429 or 5xx, or a network error like a dropped
+	// connection) is sent again, with exponential backoff, before the job
+	// fails (0 = DefaultMaxBatchRetries, NoBatchRetries = never). Only that
+	// batch is resent; the others keep their results. With fallback
+	// providers (see WithFallback) the batch moves on to the next provider
+	// instead, and only the last one retries. TranscribeWithRetry resends
+	// the whole job on top of this, so the attempts multiply; see there.
+	MaxBatchRetries int
+
+	// MaxOutputTokens is the output token budget per batch (0 = DefaultMaxOutputTokens)
+	// Values above the provider's ceiling are clamped
+	MaxOutputTokens int
+
 	// Temperature controls randomness (0.0-2.0, lower = more deterministic)
+	// Unset uses DefaultExtractionTemperature for local LLMs and the provider default otherwise
 	Temperature *float64
+
+	// TopP enables nucleus sampling (0.0-1.0); unset uses the provider default
+	TopP *float64
+
+	// ThinkingBudget is the thinking token budget for ModelGemini3ProThinking
+	// (0 = DefaultThinkingBudget, DynamicThinkingBudget = model decides).
+	// Thinking tokens are billed as output and add latency; other models
+	// ignore it.
+	ThinkingBudget int
+
+	// LocalResize controls how images are shrunk before they go to a local
+	// LLM; nil uses DefaultLocalResizeOptions. Other providers get the
+	// original files.
+	LocalResize *LocalResizeOptions
+
+	// StyleGuide holds house style rules, one per line (e.g. "Use sentence
+	// case headings"), added to the refinement prompt's tasks. Without a
+	// text model it goes to the extraction prompt instead. Empty keeps the
+	// default prompts.
+	StyleGuide string
+
+	// StyleGuideInVision also adds StyleGuide to the extraction prompt when
+	// a text model refines the output
+	StyleGuideInVision bool
+
+	// OnBatchComplete, if set, receives each batch's pages as soon as the
+	// batch finishes, e.g. to write output incrementally with a StreamWriter.
+	// batchIndex is 0-based and batches may finish out of order; calls never
+	// overlap.
+	OnBatchComplete func(batchIndex int, pages []*PageContent)
+
+	// ResumeFrom is a checkpoint directory. Each finished batch is saved
+	// there, and batches an earlier run with the same images (by content),
+	// models and transcription options already saved are restored instead
+	// of sent again. Empty disables checkpointing.
+	ResumeFrom string
 }
 
 // TranscribeResponse contains the transcription results
@@ -91,11 +177,37 @@ type TranscribeResponse struct {
 	// TotalPages is the total number of pages/images processed
 	TotalPages int
 
+	// Partial is true when the job was cancelled and Documents only hold
+	// the pages that finished before cancellation
+	Partial bool
+
+	// CompletedPages is the number of pages actually transcribed
+	CompletedPages int
+
+	// Pages holds the raw structured output per page, in page order
+	Pages []*PageContent
+
+	// BatchProviders records, per batch, the provider that handled it; it
+	// only differs from the client's provider when a fallback took over
+	BatchProviders []Provider
+
+	// BatchModels records, per batch, the model that handled it, which a
+	// fallback provider may have swapped for one of its own
+	BatchModels []string
+
 	// ProcessingTime is the total time taken
 	ProcessingTime time.Duration
 
 	// TokensUsed is the total tokens consumed
 	TokensUsed int
+
+	// RefinementFailures counts the batches whose text-model refinement
+	// failed; those pages hold the unrefined vision model output
+	RefinementFailures int
+
+	// ResumedBatches counts the batches restored from ResumeFrom rather
+	// than transcribed
+	ResumedBatches int
 }
 
 // MarkdownDocument represents a generated markdown file
@@ -117,6 +229,15 @@ type MarkdownDocument struct {
 
 	// Metadata contains additional document metadata
 	Metadata *DocumentMetadata
+
+	// Pages holds the pages the document was built from, written out by
+	// FormatJSON; nil for documents not built from pages
+	Pages []*PageContent
+
+	// Tables holds the markdown tables of Pages when
+	// TranscribeRequest.ExtractTables is set; WriteDocuments writes each
+	// to a CSV file
+	Tables []*Table
 }
 
 // PageRange represents a range of pages
@@ -171,21 +292,31 @@ type TOCEntry struct {
 
 // PageContent represents the extracted content from a single page
 type PageContent struct {
-	PageNumber     int
-	Text           string
-	HasHeading     bool
-	HeadingText    string
-	HeadingLevel   int
-	IsChapterStart bool
-	ChapterTitle   string
-	Images         []ImageDescription
+	PageNumber     int                `json:"page_number"`
+	Text           string             `json:"text"`
+	HasHeading     bool               `json:"has_heading,omitempty"`
+	HeadingText    string             `json:"heading_text,omitempty"`
+	HeadingLevel   int                `json:"heading_level,omitempty"`
+	IsChapterStart bool               `json:"is_chapter_start,omitempty"`
+	ChapterTitle   string             `json:"chapter_title,omitempty"`
+	Images         []ImageDescription `json:"images,omitempty"`
 }
 
 // ImageDescription describes a non-text image on a page
 type ImageDescription struct {
-	Description string
-	Type        string // "figure", "chart", "photo", "diagram", etc.
-	Caption     string
+	Description string `json:"description"`
+	Type        string `json:"type,omitempty"` // "figure", "chart", "photo", "diagram", etc.
+	Caption     string `json:"caption,omitempty"`
+}
+
+// PagesFileVersion is the schema version written to pages.json
+const PagesFileVersion = 1
+
+// PagesFile is the pages.json sidecar: the structured page output exactly
+// as the model returned it, before organization into documents
+type PagesFile struct {
+	Version int            `json:"version"`
+	Pages   []*PageContent `json:"pages"`
 }
 
 // ChapterInfo represents a detected chapter boundary
@@ -201,6 +332,10 @@ type APIError struct {
 	StatusCode int    `json:"status_code"`
 	Message    string `json:"message"`
 	Details    string `json:"details,omitempty"`
+
+	// RetryAfter is how long the server asked us to wait before retrying,
+	// from the Retry-After header of a 429/503 response; zero when absent
+	RetryAfter time.Duration `json:"retry_after,omitempty"`
 }
 
 func (e *APIError) Error() string {
@@ -210,6 +345,18 @@ func (e *APIError) Error() string {
 	return e.Message
 }
 
+// TruncatedOutputError is returned when the model stopped because it hit the
+// output token limit. Pages holds the best-effort result from the partial output.
+type TruncatedOutputError struct {
+	MaxTokens int
+	Pages     []*PageContent
+	Tokens    int
+}
+
+func (e *TruncatedOutputError) Error() string {
+	return fmt.Sprintf("model output truncated at %d max tokens", e.MaxTokens)
+}
+
 // GenerateContentRequest is the request structure for the Gemini API
 type GenerateContentRequest struct {
 	Contents          []*Content        `json:"contents"`
@@ -228,6 +375,9 @@ type Content struct {
 type Part struct {
 	Text       string      `json:"text,omitempty"`
 	InlineData *InlineData `json:"inlineData,omitempty"`
+
+	// Thought marks a thought summary from a thinking model rather than the answer
+	Thought bool `json:"thought,omitempty"`
 }
 
 // InlineData represents binary data (images) inline
@@ -244,6 +394,17 @@ type GenerationConfig struct {
 	MaxOutputTokens  *int     `json:"maxOutputTokens,omitempty"`
 	StopSequences    []string `json:"stopSequences,omitempty"`
 	ResponseMimeType string   `json:"responseMimeType,omitempty"`
+
+	ThinkingConfig *ThinkingConfig `json:"thinkingConfig,omitempty"`
+}
+
+// ThinkingConfig controls the reasoning a thinking model does before it answers
+type ThinkingConfig struct {
+	// ThinkingBudget caps thinking tokens; -1 lets the model decide
+	ThinkingBudget *int `json:"thinkingBudget,omitempty"`
+
+	// IncludeThoughts returns thought summaries as parts marked Thought
+	IncludeThoughts bool `json:"includeThoughts,omitempty"`
 }
 
 // SafetySetting configures content safety filters
@@ -302,46 +463,22 @@ type LocalLLMImageURL struct {
 }
 
 // LocalLLMRequest is the request structure for local LLM
-type LocalLLMRequest struct {
-	Model       string            `json:"model"`
-	Messages    []LocalLLMMessage `json:"messages"`
-	MaxTokens   int               `json:"max_tokens,omitempty"`
-	Temperature float64           `json:"temperature,omitempty"`
-}
+type LocalLLMRequest = llm.ChatRequest[LocalLLMMessage]
 
 // LocalLLMResponse is the response structure from local LLM
-type LocalLLMResponse struct {
-	ID      string           `json:"id"`
-	Choices []LocalLLMChoice `json:"choices"`
-	Usage   *LocalLLMUsage   `json:"usage,omitempty"`
-	Error   *LocalLLMError   `json:"error,omitempty"`
-}
+type LocalLLMResponse = llm.ChatResponse
 
 // LocalLLMChoice represents a choice in the local LLM response
-type LocalLLMChoice struct {
-	Index        int                   `json:"index"`
-	Message      LocalLLMChoiceMessage `json:"message"`
-	FinishReason string                `json:"finish_reason"`
-}
+type LocalLLMChoice = llm.ChatChoice
 
 // LocalLLMChoiceMessage represents the message in a choice
-type LocalLLMChoiceMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
+type LocalLLMChoiceMessage = llm.TextMessage
 
 // LocalLLMUsage contains token usage information for local LLM
-type LocalLLMUsage struct {
-	PromptTokens     int `json:"prompt_tokens"`
-	CompletionTokens int `json:"completion_tokens"`
-	TotalTokens      int `json:"total_tokens"`
-}
+type LocalLLMUsage = llm.ChatUsage
 
 // LocalLLMError represents an error from local LLM
-type LocalLLMError struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
-}
+type LocalLLMError = llm.APIError
 
 // ============================================
 // Progress callback types for UI updates
@@ -360,6 +497,7 @@ const (
 	StatusRefining
 	StatusComplete
 	StatusError
+	StatusWarning
 )
 
 // String returns a human-readable status description
@@ -383,6 +521,8 @@ func (s ProgressStatus) String() string {
 		return "Complete"
 	case StatusError:
 		return "Error"
+	case StatusWarning:
+		return "Warning"
 	default:
 		return "Unknown"
 	}
@@ -414,6 +554,10 @@ type ProgressUpdate struct {
 	// TotalBatches is the total number of batches
 	TotalBatches int
 
+	// CompletedBatches is how many batches have finished so far; with
+	// parallel processing it can lag behind CurrentBatch
+	CompletedBatches int
+
 	// CurrentImage is the current image being processed (1-based)
 	CurrentImage int
 
@@ -504,6 +648,14 @@ type AIResponseInfo struct {
 // ProgressCallback is a function called with progress updates during processing
 type ProgressCallback func(update ProgressUpdate)
 
+// TranscribeResult is the outcome TranscribeImagesStream delivers when the
+// job ends. As with TranscribeImagesWithProgress, a cancelled job can carry
+// both a partial Response and an Err.
+type TranscribeResult struct {
+	Response *TranscribeResponse
+	Err      error
+}
+
 // TranscribeRequestWithProgress extends TranscribeRequest with progress callback
 type TranscribeRequestWithProgress struct {
 	*TranscribeRequest
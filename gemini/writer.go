@@ -1,14 +1,20 @@
 package gemini
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
+	"unicode/utf8"
+
+	"capycut/fsmode"
 )
 
-// WriteOptions configures markdown output writing
+// WriteOptions configures document output writing
 type WriteOptions struct {
 	// OutputDir is the directory to write files to
 	OutputDir string
@@ -25,18 +31,179 @@ type WriteOptions struct {
 	// CreateIndexFile creates an index.md linking all documents
 	CreateIndexFile bool
 
+	// ForceIndex writes the index even when only one document was written
+	ForceIndex bool
+
+	// IndexTitle is the heading used in index.md (default: "Document Index")
+	IndexTitle string
+
 	// Verbose enables verbose output
 	Verbose bool
+
+	// OutputTemplate overrides generated filenames (empty = default naming)
+	// Placeholders: {index}, {title}, {pagestart}, {pageend}, {date}
+	// Example: "{index}-{title}-{date}.md". A document whose name an earlier
+	// one already has gets its index appended, e.g. notes-02.md.
+	OutputTemplate string
+
+	// RawPages, when set, is also written to pages.json so the extraction
+	// can be audited or re-organized without calling the API again
+	RawPages []*PageContent
+
+	// Format selects the document file format (default: FormatMarkdown).
+	// The index file is always markdown.
+	Format OutputFormat
+
+	// Formats, when set, writes every document once per format from the
+	// same content, overriding Format. The first is the primary format:
+	// MarkdownDocument.Filename and the index link to its files.
+	Formats []OutputFormat
+
+	// DirMode and FileMode set the permissions of the output directory and
+	// the files written to it (0 = fsmode.DefaultDir and fsmode.DefaultFile,
+	// narrowed by the umask). A mode that is set is applied exactly, also
+	// to files being overwritten, but not to a directory that already
+	// exists. See fsmode.FromEnv.
+	DirMode  os.FileMode
+	FileMode os.FileMode
+
+	// OnFileWritten, when set, is called synchronously after each file is
+	// written, e.g. to upload documents as they are produced. doc is the
+	// document the file holds, or nil for index.md and pages.json. With
+	// several Formats it is called once per file.
+	OnFileWritten func(path string, doc *MarkdownDocument)
+}
+
+// makeOutputDir creates opts.OutputDir with opts.DirMode (see
+// fsmode.MkdirAll)
+func makeOutputDir(opts WriteOptions) error {
+	if err := fsmode.MkdirAll(opts.OutputDir, opts.DirMode); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	return nil
+}
+
+// writeOutputFile writes data to path with opts.FileMode
+func writeOutputFile(path string, data []byte, opts WriteOptions) error {
+	mode := opts.FileMode
+	if mode == 0 {
+		mode = fsmode.DefaultFile
+	}
+	if err := os.WriteFile(path, data, mode); err != nil {
+		return err
+	}
+	return applyFileMode(path, opts)
+}
+
+// applyFileMode sets an explicit opts.FileMode on a written file, since
+// the create mode is narrowed by the umask and ignored for existing files
+func applyFileMode(path string, opts WriteOptions) error {
+	if opts.FileMode == 0 {
+		return nil
+	}
+	return os.Chmod(path, opts.FileMode)
+}
+
+// OutputFormat is the file format documents are written in
+type OutputFormat string
+
+const (
+	FormatMarkdown OutputFormat = "markdown"
+	FormatDOCX     OutputFormat = "docx"
+	FormatHTML     OutputFormat = "html"
+	FormatJSON     OutputFormat = "json"
+)
+
+// ParseOutputFormat parses a --format value; empty means markdown
+func ParseOutputFormat(s string) (OutputFormat, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "md", "markdown":
+		return FormatMarkdown, nil
+	case "docx", "word":
+		return FormatDOCX, nil
+	case "html", "htm":
+		return FormatHTML, nil
+	case "json":
+		return FormatJSON, nil
+	default:
+		return "", fmt.Errorf("unknown output format %q (use markdown, docx, html or json)", s)
+	}
+}
+
+// ParseOutputFormats parses a comma-separated --format value such as
+// "markdown,docx", dropping repeats; the first format is the primary one
+func ParseOutputFormats(s string) ([]OutputFormat, error) {
+	var formats []OutputFormat
+	seen := make(map[OutputFormat]bool)
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		format, err := ParseOutputFormat(part)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[format] {
+			seen[format] = true
+			formats = append(formats, format)
+		}
+	}
+	if len(formats) == 0 {
+		return []OutputFormat{FormatMarkdown}, nil
+	}
+	return formats, nil
+}
+
+// fileWritten calls OnFileWritten if it is set
+func (o WriteOptions) fileWritten(path string, doc *MarkdownDocument) {
+	if o.OnFileWritten != nil {
+		o.OnFileWritten(path, doc)
+	}
 }
 
+// formats returns the formats documents are written in, primary first
+func (o WriteOptions) formats() []OutputFormat {
+	if len(o.Formats) > 0 {
+		return o.Formats
+	}
+	if o.Format == "" {
+		return []OutputFormat{FormatMarkdown}
+	}
+	return []OutputFormat{o.Format}
+}
+
+// Extension returns the file extension for the format, including the dot
+func (f OutputFormat) Extension() string {
+	switch f {
+	case FormatDOCX:
+		return ".docx"
+	case FormatHTML:
+		return ".html"
+	case FormatJSON:
+		return ".json"
+	default:
+		return ".md"
+	}
+}
+
+// RawPagesFilename is the name of the raw page JSON sidecar
+const RawPagesFilename = "pages.json"
+
 // WriteResult contains information about written files
 type WriteResult struct {
 	FilesWritten []string
 	TotalBytes   int64
 	Errors       []error
+
+	// TableFiles lists the CSV files written for MarkdownDocument.Tables;
+	// they are in FilesWritten too
+	TableFiles []string
+
+	// templateNames holds the names OutputTemplate has given so far
+	templateNames map[string]bool
 }
 
-// WriteDocuments writes markdown documents to the filesystem
+// WriteDocuments writes documents to the filesystem in the formats of opts
 func WriteDocuments(docs []*MarkdownDocument, opts WriteOptions) (*WriteResult, error) {
 	if len(docs) == 0 {
 		return nil, fmt.Errorf("no documents to write")
@@ -47,17 +214,57 @@ func WriteDocuments(docs []*MarkdownDocument, opts WriteOptions) (*WriteResult,
 		opts.OutputDir = "."
 	}
 
-	if err := os.MkdirAll(opts.OutputDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	if err := makeOutputDir(opts); err != nil {
+		return nil, err
 	}
 
 	result := &WriteResult{
 		FilesWritten: make([]string, 0, len(docs)),
 	}
 
+	now := time.Now()
+
 	// Write each document
-	for _, doc := range docs {
-		path := filepath.Join(opts.OutputDir, doc.Filename)
+	written := 0
+	for i, doc := range docs {
+		if writeDocument(doc, i+1, opts, now, result) {
+			written++
+		}
+	}
+
+	writeSidecars(docs, written, opts, result)
+
+	return result, nil
+}
+
+// writeDocument names, renders and writes one document in each output
+// format, and its tables as CSV, recording the files or the errors in
+// result, and reports whether anything was written. index is the
+// document's 1-based position, used by OutputTemplate. doc.Filename is
+// left naming the primary format's file.
+func writeDocument(doc *MarkdownDocument, index int, opts WriteOptions, now time.Time, result *WriteResult) bool {
+	// Apply filename template if configured
+	if opts.OutputTemplate != "" {
+		doc.Filename = result.uniqueTemplateName(expandFilenameTemplate(opts.OutputTemplate, doc, index, now), index)
+	}
+
+	written := false
+	primary := ""
+	for i, format := range opts.formats() {
+		// Give filenames the extension of the output format
+		name := doc.Filename
+		if ext := format.Extension(); ext != ".md" {
+			name = strings.TrimSuffix(name, filepath.Ext(name)) + ext
+		}
+
+		path, err := outputPath(opts.OutputDir, name)
+		if err != nil {
+			result.Errors = append(result.Errors, err)
+			continue
+		}
+		if i == 0 {
+			primary = filepath.Base(path)
+		}
 
 		// Check if file exists
 		if !opts.Overwrite {
@@ -68,28 +275,64 @@ func WriteDocuments(docs []*MarkdownDocument, opts WriteOptions) (*WriteResult,
 		}
 
 		// Build content
-		content := buildDocumentContent(doc, opts)
+		content, err := renderDocument(doc, format, opts, now)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to render %s: %w", path, err))
+			continue
+		}
 
 		// Write file
-		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		if err := writeOutputFile(path, content, opts); err != nil {
 			result.Errors = append(result.Errors, fmt.Errorf("failed to write %s: %w", path, err))
 			continue
 		}
 
+		written = true
 		result.FilesWritten = append(result.FilesWritten, path)
 		result.TotalBytes += int64(len(content))
 
 		if opts.Verbose {
 			fmt.Printf("  Wrote: %s (%d bytes)\n", path, len(content))
 		}
+		opts.fileWritten(path, doc)
+	}
+
+	if primary != "" {
+		doc.Filename = primary
+	}
+	if written {
+		writeTables(doc, opts, result)
+	}
+	return written
+}
+
+// writeSidecars writes the files that describe a whole run once its
+// documents are on disk: the raw page JSON and the index. written is the
+// number of documents that made it to disk.
+func writeSidecars(docs []*MarkdownDocument, written int, opts WriteOptions, result *WriteResult) {
+	// Write the raw page sidecar if requested
+	if opts.RawPages != nil {
+		path := filepath.Join(opts.OutputDir, RawPagesFilename)
+		n, err := writeRawPages(path, opts.RawPages, opts)
+		if err != nil {
+			result.Errors = append(result.Errors, err)
+		} else {
+			result.FilesWritten = append(result.FilesWritten, path)
+			result.TotalBytes += n
+
+			if opts.Verbose {
+				fmt.Printf("  Wrote: %s (%d bytes)\n", path, n)
+			}
+			opts.fileWritten(path, nil)
+		}
 	}
 
 	// Create index file if requested
-	if opts.CreateIndexFile && len(result.FilesWritten) > 1 {
+	if opts.CreateIndexFile && (written > 1 || (opts.ForceIndex && written > 0)) {
 		indexPath := filepath.Join(opts.OutputDir, "index.md")
 		indexContent := buildIndexContent(docs, opts)
 
-		if err := os.WriteFile(indexPath, []byte(indexContent), 0644); err != nil {
+		if err := writeOutputFile(indexPath, []byte(indexContent), opts); err != nil {
 			result.Errors = append(result.Errors, fmt.Errorf("failed to write index: %w", err))
 		} else {
 			result.FilesWritten = append(result.FilesWritten, indexPath)
@@ -98,10 +341,188 @@ func WriteDocuments(docs []*MarkdownDocument, opts WriteOptions) (*WriteResult,
 			if opts.Verbose {
 				fmt.Printf("  Wrote: %s (%d bytes)\n", indexPath, len(indexContent))
 			}
+			opts.fileWritten(indexPath, nil)
 		}
 	}
+}
 
-	return result, nil
+// MaxOutputPathLength caps the absolute path of each written file. It is
+// the classic Windows MAX_PATH, the tightest limit of the supported platforms.
+const MaxOutputPathLength = 260
+
+// outputPath returns the path to write a document filename to. Names that
+// aren't a single portable path element are sanitized, names that would
+// push the absolute path past MaxOutputPathLength are shortened, and the
+// result is checked to stay inside outputDir.
+func outputPath(outputDir, filename string) (string, error) {
+	name := filename
+	if !isSafeFilename(name) {
+		ext := ""
+		if e := filepath.Ext(name); safeExtRe.MatchString(e) {
+			ext = strings.ToLower(e)
+		}
+		name = sanitizeFilename(strings.TrimSuffix(name, filepath.Ext(name))) + ext
+	}
+
+	absDir, err := filepath.Abs(outputDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve output directory: %w", err)
+	}
+
+	if over := len(filepath.Join(absDir, name)) - MaxOutputPathLength; over > 0 {
+		ext := filepath.Ext(name)
+		stem := strings.TrimSuffix(name, ext)
+		if over >= len(stem) {
+			return "", fmt.Errorf("output directory %s is too long to hold %s (paths are limited to %d characters)", outputDir, filename, MaxOutputPathLength)
+		}
+		stem = strings.TrimRight(truncateUTF8(stem, len(stem)-over), "_.")
+		if stem == "" {
+			return "", fmt.Errorf("output directory %s is too long to hold %s (paths are limited to %d characters)", outputDir, filename, MaxOutputPathLength)
+		}
+		name = stem + ext
+	}
+
+	// Defense in depth: the joined path must be a direct child of the directory
+	if rel, err := filepath.Rel(absDir, filepath.Join(absDir, name)); err != nil || rel != name {
+		return "", fmt.Errorf("refusing to write %q outside %s", filename, outputDir)
+	}
+
+	return filepath.Join(outputDir, name), nil
+}
+
+// safeExtRe matches extensions kept when a filename has to be sanitized
+var safeExtRe = regexp.MustCompile(`^\.[A-Za-z0-9]{1,5}$`)
+
+// isSafeFilename reports whether name is a single, portable path element:
+// no separators or characters Windows rejects, no leading dot, no trailing
+// dot or space and no reserved device name
+func isSafeFilename(name string) bool {
+	if name == "" || len(name) > 255 || !utf8.ValidString(name) {
+		return false
+	}
+	if strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+		return false
+	}
+	if strings.ContainsAny(name, `/\:*?"<>|`) || isWindowsReservedName(name) {
+		return false
+	}
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// renderDocument returns the file contents of a document in format
+func renderDocument(doc *MarkdownDocument, format OutputFormat, opts WriteOptions, now time.Time) ([]byte, error) {
+	switch format {
+	case FormatDOCX:
+		return buildDOCX(doc, opts, now)
+	case FormatHTML:
+		return buildHTML(doc, opts, now), nil
+	case FormatJSON:
+		return buildDocumentJSON(doc, now)
+	default:
+		return []byte(buildDocumentContent(doc, opts)), nil
+	}
+}
+
+// writeRawPages writes pages as a PagesFile and returns the bytes written
+func writeRawPages(path string, pages []*PageContent, opts WriteOptions) (int64, error) {
+	if !opts.Overwrite {
+		if _, err := os.Stat(path); err == nil {
+			return 0, fmt.Errorf("file exists: %s (use --overwrite to replace)", path)
+		}
+	}
+
+	data, err := json.MarshalIndent(PagesFile{Version: PagesFileVersion, Pages: pages}, "", "  ")
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode %s: %w", RawPagesFilename, err)
+	}
+	data = append(data, '\n')
+
+	if err := writeOutputFile(path, data, opts); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return int64(len(data)), nil
+}
+
+// LoadPagesFile reads a pages.json sidecar written with RawPages and checks
+// it before use: the schema must match PagesFile exactly, and page numbers
+// must be positive and unique. Pages are returned sorted by page number.
+func LoadPagesFile(path string) ([]*PageContent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+
+	var file PagesFile
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid pages file %s: %w", path, err)
+	}
+	if file.Version != PagesFileVersion {
+		return nil, fmt.Errorf("unsupported pages file version %d (expected %d)", file.Version, PagesFileVersion)
+	}
+	if len(file.Pages) == 0 {
+		return nil, fmt.Errorf("pages file %s contains no pages", path)
+	}
+
+	seen := make(map[int]bool, len(file.Pages))
+	for i, page := range file.Pages {
+		if page == nil {
+			return nil, fmt.Errorf("page entry %d is null", i+1)
+		}
+		if page.PageNumber < 1 {
+			return nil, fmt.Errorf("page entry %d has invalid page_number %d", i+1, page.PageNumber)
+		}
+		if seen[page.PageNumber] {
+			return nil, fmt.Errorf("duplicate page_number %d", page.PageNumber)
+		}
+		seen[page.PageNumber] = true
+	}
+
+	sort.SliceStable(file.Pages, func(i, j int) bool {
+		return file.Pages[i].PageNumber < file.Pages[j].PageNumber
+	})
+	return file.Pages, nil
+}
+
+// expandFilenameTemplate builds a filename for a document from a template.
+// The expanded name is passed through sanitizeFilename so it is always safe
+// to write, and the .md extension is added if missing.
+func expandFilenameTemplate(tmpl string, doc *MarkdownDocument, index int, now time.Time) string {
+	name := strings.TrimSuffix(tmpl, ".md")
+
+	replacer := strings.NewReplacer(
+		"{index}", fmt.Sprintf("%02d", index),
+		"{title}", doc.Title,
+		"{pagestart}", fmt.Sprintf("%d", doc.PageRange.Start),
+		"{pageend}", fmt.Sprintf("%d", doc.PageRange.End),
+		"{date}", now.Format("2006-01-02"),
+	)
+	name = replacer.Replace(name)
+
+	return sanitizeFilename(name) + ".md"
+}
+
+// uniqueTemplateName returns name, or when an earlier document already got
+// it (a template without {index}, say), name with index appended, so
+// Overwrite doesn't replace the earlier document
+func (r *WriteResult) uniqueTemplateName(name string, index int) string {
+	if r.templateNames == nil {
+		r.templateNames = make(map[string]bool)
+	}
+	base := strings.TrimSuffix(name, ".md")
+	for n := index; r.templateNames[name]; n++ {
+		name = fmt.Sprintf("%s-%02d.md", base, n)
+	}
+	r.templateNames[name] = true
+	return name
 }
 
 // buildDocumentContent builds the full content for a document
@@ -158,15 +579,20 @@ func buildDocumentContent(doc *MarkdownDocument, opts WriteOptions) string {
 func buildIndexContent(docs []*MarkdownDocument, opts WriteOptions) string {
 	var sb strings.Builder
 
+	title := opts.IndexTitle
+	if title == "" {
+		title = "Document Index"
+	}
+
 	if opts.AddFrontMatter {
 		sb.WriteString("---\n")
-		sb.WriteString("title: \"Document Index\"\n")
+		sb.WriteString(fmt.Sprintf("title: %q\n", title))
 		sb.WriteString(fmt.Sprintf("generated: %s\n", time.Now().Format(time.RFC3339)))
 		sb.WriteString(fmt.Sprintf("documents: %d\n", len(docs)))
 		sb.WriteString("---\n\n")
 	}
 
-	sb.WriteString("# Document Index\n\n")
+	sb.WriteString(fmt.Sprintf("# %s\n\n", title))
 	sb.WriteString(fmt.Sprintf("*Generated: %s*\n\n", time.Now().Format("January 2, 2006 3:04 PM")))
 
 	// Calculate total pages
@@ -177,17 +603,24 @@ func buildIndexContent(docs []*MarkdownDocument, opts WriteOptions) string {
 	sb.WriteString(fmt.Sprintf("**Total Documents:** %d  \n", len(docs)))
 	sb.WriteString(fmt.Sprintf("**Total Pages:** %d\n\n", totalPages))
 
-	sb.WriteString("## Documents\n\n")
-	sb.WriteString("| # | Title | Pages | Filename |\n")
-	sb.WriteString("|---|-------|-------|----------|\n")
+	// List documents in page order regardless of how they were produced
+	sorted := make([]*MarkdownDocument, len(docs))
+	copy(sorted, docs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].PageRange.Start < sorted[j].PageRange.Start
+	})
 
-	for i, doc := range docs {
+	sb.WriteString("| Document | Pages | File |\n")
+	sb.WriteString("|----------|-------|------|\n")
+
+	for _, doc := range sorted {
 		pageRange := fmt.Sprintf("%d-%d", doc.PageRange.Start, doc.PageRange.End)
 		if doc.PageRange.Start == doc.PageRange.End {
 			pageRange = fmt.Sprintf("%d", doc.PageRange.Start)
 		}
-		sb.WriteString(fmt.Sprintf("| %d | [%s](%s) | %s | %s |\n",
-			i+1, doc.Title, doc.Filename, pageRange, doc.Filename))
+		docTitle := strings.ReplaceAll(doc.Title, "|", "\\|")
+		sb.WriteString(fmt.Sprintf("| [%s](%s) | %s | %s |\n",
+			docTitle, doc.Filename, pageRange, doc.Filename))
 	}
 
 	sb.WriteString("\n")
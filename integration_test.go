@@ -291,7 +291,7 @@ func TestIntegration_OutputPathGeneration(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.input, func(t *testing.T) {
-			output := video.GenerateOutputPath(tc.input, tc.startTime, tc.endTime)
+			output := video.GenerateOutputPath(tc.input, tc.startTime, tc.endTime, "")
 
 			// Should have same extension
 			inputExt := filepath.Ext(tc.input)
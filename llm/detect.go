@@ -0,0 +1,129 @@
+package llm
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ProviderEnvVar names the provider to use instead of detecting one; the
+// --provider flag and the provider config key set it
+const ProviderEnvVar = "LLM_PROVIDER"
+
+// Role is a job capycut uses a provider for. Clip parsing and transcription
+// pick their providers independently and support different ones.
+type Role int
+
+const (
+	// RoleClip turns clip descriptions into timestamps (package ai)
+	RoleClip Role = iota
+	// RoleTranscription reads scanned pages (package gemini)
+	RoleTranscription
+)
+
+// Providers for each role in detection order: with several configured,
+// the first wins. Anthropic comes last, so a stray ANTHROPIC_API_KEY (one
+// set for other tools, say) doesn't take over from a provider capycut was
+// already using; LLM_PROVIDER=anthropic picks it over the others.
+var (
+	clipProviders          = []Provider{ProviderLocal, ProviderAzureAnthropic, ProviderAzureOpenAI, ProviderOpenAI, ProviderAnthropic}
+	transcriptionProviders = []Provider{ProviderLocal, ProviderAzureAnthropic, ProviderGemini, ProviderAnthropic}
+)
+
+// Providers returns the providers the role can use, in detection order
+func (r Role) Providers() []Provider {
+	if r == RoleTranscription {
+		return transcriptionProviders
+	}
+	return clipProviders
+}
+
+// Supports reports whether the role can use provider
+func (r Role) Supports(provider Provider) bool {
+	for _, p := range r.Providers() {
+		if p == provider {
+			return true
+		}
+	}
+	return false
+}
+
+// Detect returns the provider the role uses when none is chosen: the first
+// whose main setting (an endpoint or API key) is present. Its other
+// settings may still be missing; see Missing. It is empty when no provider
+// is set up.
+func (r Role) Detect() Provider {
+	for _, p := range r.Providers() {
+		if required := r.requiredEnv(p); len(required) > 0 && FirstEnv(required[0]...) != "" {
+			return p
+		}
+	}
+	return ""
+}
+
+// Select returns the provider named by LLM_PROVIDER when the role supports
+// it, and otherwise the detected one. A provider the role can't use, like
+// azure for transcription, leaves the choice to Detect so one setting can
+// cover both roles; a name that is no provider at all is an error.
+func (r Role) Select() (Provider, error) {
+	name := strings.ToLower(strings.TrimSpace(os.Getenv(ProviderEnvVar)))
+	if name == "" {
+		return r.Detect(), nil
+	}
+	provider := Provider(name)
+	if !RoleClip.Supports(provider) && !RoleTranscription.Supports(provider) {
+		return "", fmt.Errorf("unknown %s %q", ProviderEnvVar, name)
+	}
+	if r.Supports(provider) {
+		return provider, nil
+	}
+	return r.Detect(), nil
+}
+
+// Available returns the role's providers whose settings are complete, in
+// detection order
+func (r Role) Available() []Provider {
+	var providers []Provider
+	for _, p := range r.Providers() {
+		if r.Missing(p) == "" {
+			providers = append(providers, p)
+		}
+	}
+	return providers
+}
+
+// Missing returns the first environment variable provider still needs for
+// the role, or "" when it is fully configured
+func (r Role) Missing(provider Provider) string {
+	for _, names := range r.requiredEnv(provider) {
+		if FirstEnv(names...) == "" {
+			return names[0]
+		}
+	}
+	return ""
+}
+
+// requiredEnv lists the variables provider needs, main setting first; any
+// variable of a group will do. A local server for transcription may have
+// its own endpoint.
+func (r Role) requiredEnv(provider Provider) [][]string {
+	switch provider {
+	case ProviderLocal:
+		if r == RoleTranscription {
+			return [][]string{{"LLM_ENDPOINT", "IMAGE_LLM_ENDPOINT"}}
+		}
+		return [][]string{{"LLM_ENDPOINT"}}
+	case ProviderAzureAnthropic:
+		return [][]string{{"AZURE_ANTHROPIC_ENDPOINT"}, {"AZURE_ANTHROPIC_API_KEY"}}
+	case ProviderAnthropic:
+		return [][]string{{"ANTHROPIC_API_KEY"}}
+	case ProviderAzureOpenAI:
+		return [][]string{{"AZURE_OPENAI_ENDPOINT"}, {"AZURE_OPENAI_API_KEY"}, {"AZURE_OPENAI_MODEL"}}
+	case ProviderOpenAI:
+		return [][]string{{"OPENAI_API_KEY"}}
+	case ProviderGemini:
+		return [][]string{{"GEMINI_API_KEY", "GOOGLE_API_KEY"}}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,119 @@
+package llm
+
+import (
+	"os"
+	"strings"
+)
+
+// Config is a provider's connection settings as read from the environment
+type Config struct {
+	Provider Provider
+	Endpoint string
+	APIKey   string
+	Model    string
+
+	// APIVersion is the api-version query parameter, for Azure OpenAI
+	APIVersion string
+}
+
+// FirstEnv returns the value of the first named variable that is set
+func FirstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// LocalFromEnv reads a local server's endpoint and model from the first set
+// variable of each list; the model falls back to DefaultLocalModel. An empty
+// Endpoint means no local server is configured.
+func LocalFromEnv(endpointVars, modelVars []string) Config {
+	model := FirstEnv(modelVars...)
+	if model == "" {
+		model = DefaultLocalModel
+	}
+	return Config{
+		Provider: ProviderLocal,
+		Endpoint: strings.TrimSuffix(FirstEnv(endpointVars...), "/"),
+		Model:    model,
+	}
+}
+
+// AzureAnthropicFromEnv reads AZURE_ANTHROPIC_ENDPOINT, AZURE_ANTHROPIC_API_KEY
+// and AZURE_ANTHROPIC_MODEL; the model falls back to DefaultAnthropicModel
+func AzureAnthropicFromEnv() Config {
+	model := os.Getenv("AZURE_ANTHROPIC_MODEL")
+	if model == "" {
+		model = DefaultAnthropicModel
+	}
+	return Config{
+		Provider: ProviderAzureAnthropic,
+		Endpoint: strings.TrimSuffix(os.Getenv("AZURE_ANTHROPIC_ENDPOINT"), "/"),
+		APIKey:   os.Getenv("AZURE_ANTHROPIC_API_KEY"),
+		Model:    model,
+	}
+}
+
+// AnthropicFromEnv reads ANTHROPIC_API_KEY, ANTHROPIC_MODEL and
+// ANTHROPIC_BASE_URL. The model falls back to DefaultAnthropicModel and the
+// base URL to DefaultAnthropicBaseURL. An empty APIKey means Anthropic isn't
+// configured.
+func AnthropicFromEnv() Config {
+	model := os.Getenv("ANTHROPIC_MODEL")
+	if model == "" {
+		model = DefaultAnthropicModel
+	}
+	baseURL := strings.TrimSuffix(os.Getenv("ANTHROPIC_BASE_URL"), "/")
+	if baseURL == "" {
+		baseURL = DefaultAnthropicBaseURL
+	}
+	return Config{
+		Provider: ProviderAnthropic,
+		Endpoint: baseURL,
+		APIKey:   os.Getenv("ANTHROPIC_API_KEY"),
+		Model:    model,
+	}
+}
+
+// OpenAIFromEnv reads OPENAI_API_KEY, OPENAI_MODEL and OPENAI_BASE_URL. The
+// model falls back to DefaultOpenAIModel and the base URL to
+// DefaultOpenAIBaseURL. A trailing /v1, as the OpenAI SDKs expect it, is
+// dropped since ChatCompletionsPath adds it. An empty APIKey means OpenAI
+// isn't configured.
+func OpenAIFromEnv() Config {
+	model := os.Getenv("OPENAI_MODEL")
+	if model == "" {
+		model = DefaultOpenAIModel
+	}
+	baseURL := strings.TrimSuffix(os.Getenv("OPENAI_BASE_URL"), "/")
+	baseURL = strings.TrimSuffix(baseURL, "/v1")
+	if baseURL == "" {
+		baseURL = DefaultOpenAIBaseURL
+	}
+	return Config{
+		Provider: ProviderOpenAI,
+		Endpoint: baseURL,
+		APIKey:   os.Getenv("OPENAI_API_KEY"),
+		Model:    model,
+	}
+}
+
+// AzureOpenAIFromEnv reads AZURE_OPENAI_ENDPOINT, AZURE_OPENAI_API_KEY,
+// AZURE_OPENAI_MODEL and AZURE_OPENAI_API_VERSION; the version falls back
+// to DefaultAzureOpenAIAPIVersion. There is no default model, since Azure
+// names deployments rather than models.
+func AzureOpenAIFromEnv() Config {
+	apiVersion := os.Getenv("AZURE_OPENAI_API_VERSION")
+	if apiVersion == "" {
+		apiVersion = DefaultAzureOpenAIAPIVersion
+	}
+	return Config{
+		Provider:   ProviderAzureOpenAI,
+		Endpoint:   strings.TrimSuffix(os.Getenv("AZURE_OPENAI_ENDPOINT"), "/"),
+		APIKey:     os.Getenv("AZURE_OPENAI_API_KEY"),
+		Model:      os.Getenv("AZURE_OPENAI_MODEL"),
+		APIVersion: apiVersion,
+	}
+}
@@ -0,0 +1,353 @@
+package llm
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCleanJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "plain JSON",
+			input:    `{"start_time": "00:01:00", "end_time": "00:02:00"}`,
+			expected: `{"start_time": "00:01:00", "end_time": "00:02:00"}`,
+		},
+		{
+			name:     "with markdown code block",
+			input:    "```json\n{\"start_time\": \"00:01:00\", \"end_time\": \"00:02:00\"}\n```",
+			expected: `{"start_time": "00:01:00", "end_time": "00:02:00"}`,
+		},
+		{
+			name:     "with plain code block",
+			input:    "```\n{\"start_time\": \"00:01:00\"}\n```",
+			expected: `{"start_time": "00:01:00"}`,
+		},
+		{
+			name:     "with whitespace",
+			input:    "  {\"start_time\": \"00:00:00\"}  ",
+			expected: `{"start_time": "00:00:00"}`,
+		},
+		{
+			name:     "empty string",
+			input:    "",
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := CleanJSON(tt.input)
+			if result != tt.expected {
+				t.Errorf("CleanJSON(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLocalFromEnv(t *testing.T) {
+	endpointVars := []string{"IMAGE_LLM_ENDPOINT", "LLM_ENDPOINT"}
+	modelVars := []string{"IMAGE_LLM_MODEL", "LLM_MODEL"}
+
+	t.Setenv("IMAGE_LLM_ENDPOINT", "")
+	t.Setenv("LLM_ENDPOINT", "http://localhost:1234/")
+	t.Setenv("IMAGE_LLM_MODEL", "")
+	t.Setenv("LLM_MODEL", "")
+
+	cfg := LocalFromEnv(endpointVars, modelVars)
+	if cfg.Endpoint != "http://localhost:1234" || cfg.Model != DefaultLocalModel || cfg.Provider != ProviderLocal {
+		t.Errorf("LocalFromEnv() = %+v", cfg)
+	}
+
+	t.Setenv("IMAGE_LLM_ENDPOINT", "http://gpu:8080")
+	t.Setenv("LLM_MODEL", "llava")
+	cfg = LocalFromEnv(endpointVars, modelVars)
+	if cfg.Endpoint != "http://gpu:8080" || cfg.Model != "llava" {
+		t.Errorf("LocalFromEnv() = %+v, want the first set variable of each list", cfg)
+	}
+}
+
+func TestAzureAnthropicFromEnv(t *testing.T) {
+	t.Setenv("AZURE_ANTHROPIC_ENDPOINT", "https://example.azure.com/anthropic/")
+	t.Setenv("AZURE_ANTHROPIC_API_KEY", "key")
+	t.Setenv("AZURE_ANTHROPIC_MODEL", "")
+
+	cfg := AzureAnthropicFromEnv()
+	if cfg.Endpoint != "https://example.azure.com/anthropic" || cfg.APIKey != "key" || cfg.Model != DefaultAnthropicModel {
+		t.Errorf("AzureAnthropicFromEnv() = %+v", cfg)
+	}
+}
+
+func TestAnthropicFromEnv(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-test")
+	t.Setenv("ANTHROPIC_MODEL", "")
+	t.Setenv("ANTHROPIC_BASE_URL", "")
+
+	cfg := AnthropicFromEnv()
+	if cfg.Endpoint != DefaultAnthropicBaseURL || cfg.APIKey != "sk-ant-test" || cfg.Model != DefaultAnthropicModel || cfg.Provider != ProviderAnthropic {
+		t.Errorf("AnthropicFromEnv() = %+v", cfg)
+	}
+
+	t.Setenv("ANTHROPIC_MODEL", "claude-opus-4-1")
+	t.Setenv("ANTHROPIC_BASE_URL", "https://proxy.example.com/")
+	cfg = AnthropicFromEnv()
+	if cfg.Endpoint != "https://proxy.example.com" || cfg.Model != "claude-opus-4-1" {
+		t.Errorf("AnthropicFromEnv() = %+v, want the model and base URL from the environment", cfg)
+	}
+}
+
+func TestOpenAIFromEnv(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("OPENAI_MODEL", "")
+	t.Setenv("OPENAI_BASE_URL", "")
+
+	cfg := OpenAIFromEnv()
+	if cfg.Endpoint != DefaultOpenAIBaseURL || cfg.APIKey != "sk-test" || cfg.Model != DefaultOpenAIModel || cfg.Provider != ProviderOpenAI {
+		t.Errorf("OpenAIFromEnv() = %+v", cfg)
+	}
+
+	for _, baseURL := range []string{"https://proxy.example.com", "https://proxy.example.com/", "https://proxy.example.com/v1", "https://proxy.example.com/v1/"} {
+		t.Setenv("OPENAI_BASE_URL", baseURL)
+		if got := OpenAIFromEnv().Endpoint; got != "https://proxy.example.com" {
+			t.Errorf("OPENAI_BASE_URL=%q: Endpoint = %q, want https://proxy.example.com", baseURL, got)
+		}
+	}
+}
+
+func TestAzureOpenAIFromEnv(t *testing.T) {
+	t.Setenv("AZURE_OPENAI_ENDPOINT", "https://example.openai.azure.com/")
+	t.Setenv("AZURE_OPENAI_API_KEY", "key")
+	t.Setenv("AZURE_OPENAI_MODEL", "gpt-4o")
+	t.Setenv("AZURE_OPENAI_API_VERSION", "")
+
+	cfg := AzureOpenAIFromEnv()
+	if cfg.Endpoint != "https://example.openai.azure.com" || cfg.APIKey != "key" || cfg.Model != "gpt-4o" || cfg.APIVersion != DefaultAzureOpenAIAPIVersion || cfg.Provider != ProviderAzureOpenAI {
+		t.Errorf("AzureOpenAIFromEnv() = %+v", cfg)
+	}
+}
+
+// clearProviderEnv unsets every variable provider detection looks at
+func clearProviderEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{
+		"LLM_ENDPOINT", "IMAGE_LLM_ENDPOINT",
+		"AZURE_ANTHROPIC_ENDPOINT", "AZURE_ANTHROPIC_API_KEY",
+		"ANTHROPIC_API_KEY",
+		"AZURE_OPENAI_ENDPOINT", "AZURE_OPENAI_API_KEY", "AZURE_OPENAI_MODEL",
+		"OPENAI_API_KEY",
+		"GEMINI_API_KEY", "GOOGLE_API_KEY",
+	} {
+		t.Setenv(name, "")
+	}
+}
+
+func TestRoleDetect(t *testing.T) {
+	clearProviderEnv(t)
+	if got := RoleClip.Detect(); got != "" {
+		t.Errorf("RoleClip.Detect() = %q with nothing configured, want empty", got)
+	}
+
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("GEMINI_API_KEY", "gm-test")
+	if got := RoleClip.Detect(); got != ProviderOpenAI {
+		t.Errorf("RoleClip.Detect() = %q, want openai", got)
+	}
+	if got := RoleTranscription.Detect(); got != ProviderGemini {
+		t.Errorf("RoleTranscription.Detect() = %q, want gemini", got)
+	}
+
+	// A local server wins for both roles
+	t.Setenv("IMAGE_LLM_ENDPOINT", "http://gpu:8080")
+	if got := RoleTranscription.Detect(); got != ProviderLocal {
+		t.Errorf("RoleTranscription.Detect() = %q, want local from IMAGE_LLM_ENDPOINT", got)
+	}
+	if got := RoleClip.Detect(); got != ProviderOpenAI {
+		t.Errorf("RoleClip.Detect() = %q, IMAGE_LLM_ENDPOINT is for transcription only", got)
+	}
+}
+
+func TestRoleMissingAndAvailable(t *testing.T) {
+	clearProviderEnv(t)
+	t.Setenv("AZURE_OPENAI_ENDPOINT", "https://example.openai.azure.com")
+	t.Setenv("AZURE_OPENAI_API_KEY", "key")
+
+	if got := RoleClip.Detect(); got != ProviderAzureOpenAI {
+		t.Errorf("RoleClip.Detect() = %q, want azure from its endpoint", got)
+	}
+	if got := RoleClip.Missing(ProviderAzureOpenAI); got != "AZURE_OPENAI_MODEL" {
+		t.Errorf("Missing(azure) = %q, want AZURE_OPENAI_MODEL", got)
+	}
+	if got := RoleClip.Available(); len(got) != 0 {
+		t.Errorf("Available() = %v, want none while azure is incomplete", got)
+	}
+
+	t.Setenv("AZURE_OPENAI_MODEL", "gpt-4o")
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	got := RoleClip.Available()
+	if len(got) != 2 || got[0] != ProviderAzureOpenAI || got[1] != ProviderOpenAI {
+		t.Errorf("Available() = %v, want [azure openai]", got)
+	}
+	if RoleTranscription.Supports(ProviderOpenAI) || !RoleTranscription.Supports(ProviderGemini) {
+		t.Error("transcription supports gemini but not openai")
+	}
+}
+
+func TestRoleSelect(t *testing.T) {
+	clearProviderEnv(t)
+	t.Setenv("AZURE_OPENAI_ENDPOINT", "https://example.openai.azure.com")
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("GEMINI_API_KEY", "gm-test")
+
+	tests := []struct {
+		setting          string
+		clip, transcribe Provider
+		wantErr          bool
+	}{
+		{setting: "", clip: ProviderAzureOpenAI, transcribe: ProviderGemini},
+		{setting: "openai", clip: ProviderOpenAI, transcribe: ProviderGemini},
+		{setting: " Anthropic ", clip: ProviderAnthropic, transcribe: ProviderAnthropic},
+		{setting: "gemini", clip: ProviderAzureOpenAI, transcribe: ProviderGemini},
+		{setting: "claude", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Setenv(ProviderEnvVar, tt.setting)
+		clip, err := RoleClip.Select()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("LLM_PROVIDER=%q: RoleClip.Select() error = %v", tt.setting, err)
+			continue
+		}
+		transcribe, _ := RoleTranscription.Select()
+		if clip != tt.clip || transcribe != tt.transcribe {
+			t.Errorf("LLM_PROVIDER=%q: Select() = %q for clips, %q for transcription, want %q and %q", tt.setting, clip, transcribe, tt.clip, tt.transcribe)
+		}
+	}
+}
+
+func TestPostChat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer sk-test" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("request = %s %s, headers %v", r.Method, r.URL.Path, r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	resp, body, err := PostChat(context.Background(), server.Client(), server.URL, "sk-test", []byte(`{"model":"m"}`))
+	if err != nil || resp == nil || resp.StatusCode != http.StatusOK || string(body) != `{"model":"m"}` {
+		t.Fatalf("PostChat() = %v, %q, %v", resp, body, err)
+	}
+
+	server.Close()
+	resp, _, err = PostChat(context.Background(), http.DefaultClient, server.URL, "", nil)
+	if resp != nil || err == nil {
+		t.Errorf("PostChat() to a closed server = %v, %v, want no response and an error", resp, err)
+	}
+}
+
+func TestChatCompletionsURL(t *testing.T) {
+	for _, endpoint := range []string{"http://localhost:1234", "http://localhost:1234/"} {
+		if got := ChatCompletionsURL(endpoint); got != "http://localhost:1234/v1/chat/completions" {
+			t.Errorf("ChatCompletionsURL(%q) = %q", endpoint, got)
+		}
+	}
+}
+
+func TestTransportFromEnv_Proxy(t *testing.T) {
+	t.Setenv(CACertEnvVar, "")
+
+	for _, insecure := range []string{"", "1"} {
+		t.Setenv(InsecureEnvVar, insecure)
+		rt, err := TransportFromEnv()
+		if err != nil {
+			t.Fatalf("TransportFromEnv() failed: %v", err)
+		}
+		transport, ok := rt.(*http.Transport)
+		if !ok || transport.Proxy == nil {
+			t.Errorf("insecure=%q: transport should resolve proxies from the environment", insecure)
+		}
+	}
+}
+
+func TestInsecureFromEnv(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    bool
+		wantErr bool
+	}{
+		{"", false, false},
+		{"1", true, false},
+		{"true", true, false},
+		{"0", false, false},
+		{"false", false, false},
+		{"maybe", false, true},
+	}
+	for _, tt := range tests {
+		t.Setenv(InsecureEnvVar, tt.value)
+		got, err := InsecureFromEnv()
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("%s=%q: InsecureFromEnv() = %v, %v; want %v, error %v", InsecureEnvVar, tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	t.Setenv(CACertEnvVar, "")
+	t.Setenv(InsecureEnvVar, "0")
+	rt, err := TransportFromEnv()
+	if err != nil {
+		t.Fatalf("TransportFromEnv() failed: %v", err)
+	}
+	if transport := rt.(*http.Transport); transport.TLSClientConfig != nil && transport.TLSClientConfig.InsecureSkipVerify {
+		t.Errorf("%s=0 disabled certificate verification", InsecureEnvVar)
+	}
+	t.Setenv(InsecureEnvVar, "maybe")
+	if _, err := TransportFromEnv(); err == nil {
+		t.Errorf("TransportFromEnv() accepted %s=maybe", InsecureEnvVar)
+	}
+}
+
+func TestReadChatStream(t *testing.T) {
+	stream := strings.Join([]string{
+		`: keep-alive`,
+		`data: {"choices":[{"delta":{"role":"assistant"}}]}`,
+		``,
+		`data: {"choices":[{"delta":{"content":"{\"start_time\": "}}]}`,
+		``,
+		`data:{"choices":[{"delta":{"content":"\"00:00:00\"}"},"finish_reason":"stop"}]}`,
+		``,
+		`data: [DONE]`,
+		`data: {"choices":[{"delta":{"content":"after done"}}]}`,
+	}, "\n")
+
+	var deltas []string
+	content, err := ReadChatStream(strings.NewReader(stream), func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatalf("ReadChatStream() error: %v", err)
+	}
+	if want := `{"start_time": "00:00:00"}`; content != want {
+		t.Errorf("content = %q, want %q", content, want)
+	}
+	if len(deltas) != 2 {
+		t.Errorf("onDelta called %d times (%q), want 2", len(deltas), deltas)
+	}
+
+	// A stream that ends without [DONE] keeps what arrived
+	if content, err := ReadChatStream(strings.NewReader(`data: {"choices":[{"delta":{"content":"ok"}}]}`), nil); err != nil || content != "ok" {
+		t.Errorf("ReadChatStream() without [DONE] = %q, %v; want ok", content, err)
+	}
+
+	if _, err := ReadChatStream(strings.NewReader(`data: {"error":{"code":"overloaded","message":"try later"}}`), nil); err == nil || !strings.Contains(err.Error(), "try later") {
+		t.Errorf("ReadChatStream() error = %v, want the API error", err)
+	}
+	if _, err := ReadChatStream(strings.NewReader(`data: not json`), nil); err == nil {
+		t.Error("ReadChatStream() should reject a malformed event")
+	}
+}
@@ -0,0 +1,174 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ChatCompletionsPath is appended to an OpenAI-compatible server's base URL
+const ChatCompletionsPath = "/v1/chat/completions"
+
+// ChatCompletionsURL returns the chat completions URL for a base endpoint
+func ChatCompletionsURL(endpoint string) string {
+	return strings.TrimSuffix(endpoint, "/") + ChatCompletionsPath
+}
+
+// NewChatRequest builds a POST of body, an encoded ChatRequest, to the chat
+// completions URL of endpoint. apiKey is sent as a bearer token when set;
+// local servers take none.
+func NewChatRequest(ctx context.Context, endpoint, apiKey string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", ChatCompletionsURL(endpoint), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	return req, nil
+}
+
+// PostChat sends a chat completions request (see NewChatRequest) and reads
+// the whole answer. The response is returned with its body already read
+// and closed, whatever the status; callers judge the status, since servers
+// word their errors differently. A nil response means no answer arrived,
+// e.g. because the server is down.
+func PostChat(ctx context.Context, client *http.Client, endpoint, apiKey string, body []byte) (*http.Response, []byte, error) {
+	req, err := NewChatRequest(ctx, endpoint, apiKey, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return resp, respBody, nil
+}
+
+// ChatRequest is an OpenAI-compatible chat completions request; M is the
+// message type, plain text or multimodal content parts
+type ChatRequest[M any] struct {
+	Model       string   `json:"model"`
+	Messages    []M      `json:"messages"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	Stream      bool     `json:"stream,omitempty"`
+}
+
+// TextMessage is a chat message with plain string content
+type TextMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ChatResponse is an OpenAI-compatible chat completions response
+type ChatResponse struct {
+	ID      string       `json:"id"`
+	Choices []ChatChoice `json:"choices"`
+	Usage   *ChatUsage   `json:"usage,omitempty"`
+	Error   *APIError    `json:"error,omitempty"`
+}
+
+// ChatChoice is one completion in a ChatResponse
+type ChatChoice struct {
+	Index        int         `json:"index"`
+	Message      TextMessage `json:"message"`
+	FinishReason string      `json:"finish_reason"`
+}
+
+// ChatChunk is one server-sent event of a streamed chat completion
+// (ChatRequest.Stream); each choice carries the next piece of the answer
+type ChatChunk struct {
+	ID      string            `json:"id"`
+	Choices []ChatChunkChoice `json:"choices"`
+	Error   *APIError         `json:"error,omitempty"`
+}
+
+// ChatChunkChoice is one completion's piece of a ChatChunk
+type ChatChunkChoice struct {
+	Index        int         `json:"index"`
+	Delta        TextMessage `json:"delta"`
+	FinishReason string      `json:"finish_reason"`
+}
+
+// ReadChatStream reads a text/event-stream chat completion from r until
+// the [DONE] event or the end of the body, calling onDelta (if set) with
+// each new piece of the first choice's content. It returns the whole
+// content. Comments, keep-alives and events other than data are skipped.
+func ReadChatStream(r io.Reader, onDelta func(delta string)) (string, error) {
+	var content strings.Builder
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+		if data == "" {
+			continue
+		}
+
+		var chunk ChatChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return content.String(), fmt.Errorf("failed to parse stream event: %w\nEvent was: %s", err, data)
+		}
+		if chunk.Error != nil {
+			return content.String(), fmt.Errorf("API error: %s - %s", chunk.Error.Code, chunk.Error.Message)
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		delta := chunk.Choices[0].Delta.Content
+		content.WriteString(delta)
+		if onDelta != nil {
+			onDelta(delta)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return content.String(), fmt.Errorf("failed to read stream: %w", err)
+	}
+	return content.String(), nil
+}
+
+// ChatUsage contains token usage information
+type ChatUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// APIError is the error object OpenAI-style APIs return
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// CleanJSON strips a surrounding markdown code fence (```json or ```) and
+// whitespace from a model's JSON answer
+func CleanJSON(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "```") {
+		return s
+	}
+	s = strings.TrimPrefix(s, "```json")
+	s = strings.TrimPrefix(s, "```")
+	s = strings.TrimSuffix(s, "```")
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,47 @@
+// Package llm holds what the clip parser (ai) and the transcription client
+// (gemini) share: provider names, env-based configuration, the
+// OpenAI-compatible chat types and the HTTP transport.
+package llm
+
+// Provider identifies an LLM backend
+type Provider string
+
+const (
+	// ProviderLocal uses an OpenAI-compatible server (LM Studio, Ollama, etc.)
+	ProviderLocal Provider = "local"
+	// ProviderOpenAI uses the OpenAI chat completions API (api.openai.com)
+	ProviderOpenAI Provider = "openai"
+	// ProviderAzureOpenAI uses the Azure OpenAI Responses API
+	ProviderAzureOpenAI Provider = "azure"
+	// ProviderAzureAnthropic uses Claude through Azure
+	ProviderAzureAnthropic Provider = "azure_anthropic"
+	// ProviderAnthropic uses Claude through the Anthropic API (api.anthropic.com)
+	ProviderAnthropic Provider = "anthropic"
+	// ProviderGemini uses Google's Gemini API
+	ProviderGemini Provider = "gemini"
+)
+
+// Built-in models for providers whose env vars don't name one
+const (
+	// DefaultLocalModel is sent to local servers, most of which answer with
+	// whatever model is loaded
+	DefaultLocalModel = "local-model"
+
+	// DefaultOpenAIModel is the model for OpenAI
+	DefaultOpenAIModel = "gpt-4o-mini"
+
+	// DefaultAnthropicModel is the Claude model for Anthropic and Azure
+	// Anthropic
+	DefaultAnthropicModel = "claude-sonnet-4-20250514"
+)
+
+// DefaultOpenAIBaseURL is the OpenAI API, used when OPENAI_BASE_URL is unset
+const DefaultOpenAIBaseURL = "https://api.openai.com"
+
+// DefaultAzureOpenAIAPIVersion is the Azure OpenAI Responses API version
+// used when AZURE_OPENAI_API_VERSION is unset
+const DefaultAzureOpenAIAPIVersion = "2025-04-01-preview"
+
+// DefaultAnthropicBaseURL is the Anthropic API, used when ANTHROPIC_BASE_URL
+// is unset
+const DefaultAnthropicBaseURL = "https://api.anthropic.com"
@@ -0,0 +1,83 @@
+package llm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+const (
+	// CACertEnvVar points to a PEM bundle of extra CAs to trust, for
+	// private endpoints signed by an internal CA
+	CACertEnvVar = "CAPYCUT_CA_CERT"
+
+	// InsecureEnvVar disables TLS certificate verification when true (1,
+	// true, yes...); for development against self-signed endpoints only
+	InsecureEnvVar = "CAPYCUT_INSECURE"
+)
+
+// TransportFromEnv builds the transport for API requests. It always routes
+// through HTTP_PROXY, HTTPS_PROXY and NO_PROXY, trusts the CAs in
+// CAPYCUT_CA_CERT on top of the system pool, and skips verification when
+// CAPYCUT_INSECURE is true.
+func TransportFromEnv() (http.RoundTripper, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+
+	caPath := os.Getenv(CACertEnvVar)
+	insecure, err := InsecureFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if caPath == "" && !insecure {
+		return transport, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caPath != "" {
+		pool, err := loadCertPool(caPath)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if insecure {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// InsecureFromEnv reports whether CAPYCUT_INSECURE turns certificate
+// verification off. Unset and empty mean no; otherwise the value must be a
+// boolean like 1, true, 0 or false, so "0" doesn't disable verification.
+func InsecureFromEnv() (bool, error) {
+	v := os.Getenv(InsecureEnvVar)
+	if v == "" {
+		return false, nil
+	}
+	insecure, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q: use 1 or 0", InsecureEnvVar, v)
+	}
+	return insecure, nil
+}
+
+// loadCertPool returns the system pool with the PEM certificates at path added
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", CACertEnvVar, err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s %q contains no PEM certificates", CACertEnvVar, path)
+	}
+	return pool, nil
+}
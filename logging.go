@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"capycut/ai"
+)
+
+// Verbosity controls how much the non-interactive CLI prints
+type Verbosity int
+
+const (
+	// VerbosityQuiet prints only errors and the final output path
+	VerbosityQuiet Verbosity = iota
+	// VerbosityNormal is the default decorated output
+	VerbosityNormal
+	// VerbosityVerbose adds AI request/response details on stderr
+	VerbosityVerbose
+	// VerbosityDebug adds full [DEBUG] tracing (CAPYCUT_DEBUG)
+	VerbosityDebug
+)
+
+// verbosity is the active output level, set once from flags in main
+var verbosity = VerbosityNormal
+
+// verboseOut is where verbose transparency output goes
+var verboseOut io.Writer = os.Stderr
+
+// resolveVerbosity maps the --quiet/--verbose/--debug flags to a level.
+// Each louder level includes the quieter ones; quiet cannot be combined with them.
+func resolveVerbosity(quiet, verbose, debug bool) (Verbosity, error) {
+	if quiet && (verbose || debug) {
+		return VerbosityNormal, fmt.Errorf("--quiet cannot be combined with --verbose or --debug")
+	}
+	switch {
+	case debug:
+		return VerbosityDebug, nil
+	case verbose:
+		return VerbosityVerbose, nil
+	case quiet:
+		return VerbosityQuiet, nil
+	default:
+		return VerbosityNormal, nil
+	}
+}
+
+// infoOut is where regular progress output and errors go; stderr when the
+// clip itself is streamed to stdout
+var infoOut io.Writer = os.Stdout
+
+// printInfo prints a line of regular progress output unless running quietly
+func printInfo(s string) {
+	if verbosity >= VerbosityNormal {
+		fmt.Fprintln(infoOut, s)
+	}
+}
+
+// printVerboseRequest writes AI request details to stderr at verbose level
+func printVerboseRequest(info *ai.ParserRequestInfo) {
+	if verbosity < VerbosityVerbose || info == nil {
+		return
+	}
+	fmt.Fprintf(verboseOut, "[request] %s %s\n", info.Method, info.Endpoint)
+	fmt.Fprintf(verboseOut, "[request] input: %q\n", info.UserInput)
+	if info.SystemPromptPreview != "" {
+		fmt.Fprintf(verboseOut, "[request] system prompt: %q\n", info.SystemPromptPreview)
+	}
+	keys := make([]string, 0, len(info.Parameters))
+	for k := range info.Parameters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(verboseOut, "[request] %s=%s\n", k, info.Parameters[k])
+	}
+}
+
+// printVerboseResponse writes AI response details to stderr at verbose level
+func printVerboseResponse(info *ai.ParserResponseInfo) {
+	if verbosity < VerbosityVerbose || info == nil {
+		return
+	}
+	fmt.Fprintf(verboseOut, "[response] status: %d %s (%.2fs)\n", info.StatusCode, info.StatusText, info.Latency.Seconds())
+	if info.RawResponse != "" {
+		fmt.Fprintf(verboseOut, "[response] raw: %s\n", info.RawResponse)
+	}
+	if len(info.ParsedResults) > 1 {
+		for i, clip := range info.ParsedResults {
+			fmt.Fprintf(verboseOut, "[response] parsed clip %d: start=%s end=%s\n", i+1, clip.StartTime, clip.EndTime)
+		}
+	} else if info.ParsedResult != nil {
+		fmt.Fprintf(verboseOut, "[response] parsed: start=%s end=%s\n", info.ParsedResult.StartTime, info.ParsedResult.EndTime)
+	}
+	if info.ErrorMessage != "" {
+		fmt.Fprintf(verboseOut, "[response] error: %s\n", info.ErrorMessage)
+	}
+}
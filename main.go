@@ -2,23 +2,34 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"capycut/ai"
+	"capycut/fsmode"
+	"capycut/gemini"
+	"capycut/llm"
 	"capycut/tui"
 	"capycut/video"
 
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/huh"
 	"github.com/charmbracelet/huh/spinner"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/creativeprojects/go-selfupdate"
-	"github.com/joho/godotenv"
 )
 
 // Build info - set via ldflags
@@ -68,30 +79,88 @@ var (
 	versionFlag      bool
 	shortVersionFlag bool
 	debugFlag        bool
+	quietFlag        bool
+	verboseFlag      bool
 	helpFlag         bool
 	setupFlag        bool
 	updateFlag       bool
+	jsonFlag         bool
 	providerFlag     string
+	profileFlag      string
 	fileFlag         string
 	promptFlag       string
 	outputFlag       string
+	autoTitleFlag    bool
+	previewFlag      bool
+	subtitlesFlag    string
+	hwaccelFlag      string
+	crfFlag          int
+	presetFlag       string
+	bitrateFlag      string
+	gifFlag          bool
+	aspectFlag       string
+	audioOnlyFlag    string
+	audioBitrateFlag string
+	dryRunFlag       bool
+	concatFlag       bool
+	gifFPSFlag       int
+	gifWidthFlag     int
+	temperatureFlag  float64
+	topPFlag         float64
+	insecureFlag     bool
+	doctorFlag       bool
+	dirModeFlag      string
+	fileModeFlag     string
+	sinceFlag        string
+	untilFlag        string
+	nameTimeFlag     string
 )
 
 func init() {
 	flag.BoolVar(&versionFlag, "version", false, "Print version information")
 	flag.BoolVar(&shortVersionFlag, "v", false, "Print version information (short)")
 	flag.BoolVar(&debugFlag, "debug", false, "Enable debug output")
+	flag.BoolVar(&quietFlag, "quiet", false, "Print only errors and the output path")
+	flag.BoolVar(&quietFlag, "q", false, "Print only errors and the output path (short)")
+	flag.BoolVar(&verboseFlag, "verbose", false, "Print AI request/response details to stderr")
 	flag.BoolVar(&helpFlag, "help", false, "Show help message")
 	flag.BoolVar(&helpFlag, "h", false, "Show help message (short)")
 	flag.BoolVar(&setupFlag, "setup", false, "Run interactive setup wizard")
 	flag.BoolVar(&updateFlag, "update", false, "Update capycut to the latest version")
-	flag.StringVar(&providerFlag, "provider", "", "LLM provider: 'local' or 'azure'")
+	flag.BoolVar(&jsonFlag, "json", false, "Print machine-readable JSON (with --version)")
+	flag.StringVar(&providerFlag, "provider", "", "LLM provider: 'local', 'openai', 'anthropic' or 'azure'")
+	flag.StringVar(&profileFlag, "profile", "", "Config file profile to use")
 	flag.StringVar(&fileFlag, "file", "", "Path to video file")
 	flag.StringVar(&fileFlag, "f", "", "Path to video file (short)")
 	flag.StringVar(&promptFlag, "prompt", "", "Clip description (e.g., 'first 2 minutes')")
 	flag.StringVar(&promptFlag, "p", "", "Clip description (short)")
-	flag.StringVar(&outputFlag, "output", "", "Output file path (optional)")
-	flag.StringVar(&outputFlag, "o", "", "Output file path (short)")
+	flag.StringVar(&outputFlag, "output", "", "Output file or directory (optional)")
+	flag.StringVar(&outputFlag, "o", "", "Output file or directory (short)")
+	flag.StringVar(&subtitlesFlag, "subtitles", "", "Burn in an .srt, .vtt, .ass or .ssa subtitle file")
+	flag.StringVar(&hwaccelFlag, "hwaccel", "none", "Hardware encoder for re-encoded clips: nvenc, qsv, videotoolbox or none")
+	flag.IntVar(&crfFlag, "crf", 0, "Quality for re-encoded clips, 1-51, lower is better (default 23)")
+	flag.StringVar(&presetFlag, "preset", "", "Encoder speed preset for re-encoded clips (default medium)")
+	flag.StringVar(&bitrateFlag, "bitrate", "", "Target video bitrate for re-encoded clips instead of --crf (e.g. 4M)")
+	flag.StringVar(&aspectFlag, "aspect", "", "Center-crop the clip to an aspect ratio, e.g. 9:16, 1:1 or 4:5")
+	flag.StringVar(&audioOnlyFlag, "audio-only", "", "Save only the clip's audio, as mp3 or m4a")
+	flag.StringVar(&audioBitrateFlag, "audio-bitrate", "", "Bitrate of --audio-only clips (default 192k)")
+	flag.BoolVar(&gifFlag, "gif", false, "Export the clip as an animated GIF")
+	flag.IntVar(&gifFPSFlag, "gif-fps", 0, "Frame rate of --gif clips (default 12)")
+	flag.IntVar(&gifWidthFlag, "gif-width", 0, "Width in pixels of --gif clips (default 480)")
+	flag.BoolVar(&autoTitleFlag, "auto-title", false, "Name the clip from an AI-suggested title (extra vision API call)")
+	flag.BoolVar(&concatFlag, "concat", false, "Join the clips of a multi-clip prompt into one file")
+	flag.BoolVar(&dryRunFlag, "dry-run", false, "Print the ffmpeg command for the clip instead of running it")
+	flag.BoolVar(&previewFlag, "preview", false, "Describe a few frames of the parsed range instead of cutting (vision API calls)")
+	flag.BoolVar(&previewFlag, "seek-preview", false, "Describe a few frames of the parsed range instead of cutting (alias of --preview)")
+	flag.Float64Var(&temperatureFlag, "temperature", -1, "Sampling temperature for the clip parser (default 0.1)")
+	flag.Float64Var(&topPFlag, "top-p", -1, "Nucleus sampling (top_p) for the clip parser")
+	flag.BoolVar(&insecureFlag, "insecure", false, "Skip TLS certificate verification (development only)")
+	flag.BoolVar(&doctorFlag, "doctor", false, "Print tools, providers and network settings, then exit")
+	flag.StringVar(&dirModeFlag, "dir-mode", "", "Permissions for created output directories, e.g. 0750")
+	flag.StringVar(&fileModeFlag, "file-mode", "", "Permissions for written clips and documents, e.g. 0640")
+	flag.StringVar(&sinceFlag, "since", "", "With a directory or glob, only clip videos from this time on")
+	flag.StringVar(&untilFlag, "until", "", "With a directory or glob, only clip videos from before this time")
+	flag.StringVar(&nameTimeFlag, "name-time-format", "", "Go time layout of a timestamp in video file names, used by --since/--until instead of the modification time")
 }
 
 func printHelp() {
@@ -105,16 +174,70 @@ USAGE:
 COMMANDS:
     clip                    Video clipping mode (default)
     transcribe              Image to Markdown transcription
+    models                  List a provider's models (--provider <name>)
+    config show             Print the effective configuration
+    profile list            List the config file's named profiles
 
 VIDEO CLIPPING OPTIONS:
-    -f, --file <path>       Path to video file
+    -f, --file <path>       Path to video file, or - to read it from stdin
+                            (buffered to a temp file first). A directory or
+                            quoted glob clips every video in it the same way
     -p, --prompt <text>     Clip description in natural language
                             Examples:
                               "first 2 minutes"
                               "from 3:00 to 5:30"
                               "last 45 seconds"
-    -o, --output <path>     Output file path (optional)
-    --provider <name>       LLM provider: 'local' or 'azure'
+                              "the middle 50%"
+                              "first minute and last 30 seconds"
+                            (several clips each get their own file; plain
+                            ranges are parsed without the AI provider)
+    -o, --output <path>     Output file or directory (optional; a directory
+                            or path ending in / gets an auto-generated name).
+                            - streams the clip to stdout as Matroska
+    --subtitles <path>      Burn in subtitles (.srt, .vtt, .ass, .ssa); cue
+                            times are shifted to the clip start
+    --aspect <W:H>          Center-crop to an aspect ratio such as 9:16, 1:1
+                            or 4:5 for shorts and reels (re-encodes)
+    --hwaccel <name>        Encoder for re-encoded clips: nvenc, qsv,
+                            videotoolbox or none (default: none/libx264)
+    --crf <n>               Re-encode quality, 1-51, lower is better (default: 23)
+    --preset <name>         Re-encode speed preset, ultrafast..veryslow
+                            (default: medium)
+    --bitrate <rate>        Re-encode to a target bitrate instead of --crf,
+                            e.g. 2500k or 4M
+    --audio-only <format>   Save only the audio, as mp3 or m4a
+    --audio-bitrate <rate>  Audio bitrate for --audio-only (default: 192k)
+    --gif                   Export an animated GIF instead of a video
+    --gif-fps <n>           GIF frame rate, up to 50 (default: 12)
+    --gif-width <px>        GIF width, up to 1920; height keeps the aspect
+                            ratio (default: 480)
+    --auto-title            Name the clip after an AI-suggested title
+                            (uses the transcription vision provider)
+    --concat                Join the clips a prompt describes into one file
+                            (also when the prompt says "into one file")
+    --dry-run               Print the ffmpeg command(s) for the clip instead
+                            of running them (the prompt is still parsed)
+    --preview               Describe 3 frames from the parsed range with the
+                            vision provider and stop without cutting, to
+                            check a vague prompt (one vision call per frame)
+    --since <time>          With a directory or glob, only clip videos from
+                            this time on (2024-01-01, 2024-01-01T09:30 or
+                            RFC 3339; local time unless a zone is given)
+    --until <time>          With a directory or glob, only clip videos from
+                            before this time
+    --name-time-format <layout>
+                            Compare a timestamp in the file name instead of
+                            the modification time, as a Go layout
+                            (e.g. 20060102_150405)
+    --provider <name>       LLM provider: 'local', 'openai', 'anthropic'
+                            or 'azure'
+    --profile <name>        Use a named profile from the config file (on
+                            any command; see 'capycut profile --help')
+    --temperature <t>       Parser sampling temperature, 0-2 (default: 0.1 for
+                            local and OpenAI, the model's own for Azure and
+                            Claude; or set AI_TEMPERATURE)
+    --top-p <p>             Parser nucleus sampling, up to 1 (default:
+                            provider default; or set AI_TOP_P)
 
 IMAGE TRANSCRIPTION:
     capycut transcribe [OPTIONS] <images...>
@@ -127,23 +250,72 @@ IMAGE TRANSCRIPTION:
 GENERAL OPTIONS:
     --setup                 Run interactive setup wizard
     --update                Update to latest version
-    --debug                 Enable debug output
+    --doctor                Show ffmpeg, the configured providers, CA and
+                            TLS settings and the effective proxy per endpoint
+    --list-models           Same as 'capycut models', whose --provider
+                            names it takes (local, gemini, anthropic or
+                            azure_anthropic)
+    -q, --quiet             Print only errors and the final output path
+    --verbose               Print AI request/response details to stderr
+    --debug                 Enable debug output (implies --verbose)
+    --insecure              Skip TLS certificate verification for AI
+                            endpoints (development only; prefer
+                            CAPYCUT_CA_CERT)
+    --dir-mode <octal>      Permissions for created output directories,
+                            e.g. 0750 (default 0755 minus the umask)
+    --file-mode <octal>     Permissions for written clips and documents,
+                            e.g. 0640 (default 0644 minus the umask)
     -v, --version           Print version information
+    --json                  With --version, print it as JSON
     -h, --help              Show this help message
 
 ENVIRONMENT VARIABLES:
   Video Clipping:
-    LLM_PROVIDER            'local' or 'azure'
+    LLM_PROVIDER            'local', 'openai', 'azure', 'azure_anthropic'
+                            or 'anthropic' (default: the first configured)
     AZURE_OPENAI_ENDPOINT   Azure OpenAI endpoint
     AZURE_OPENAI_API_KEY    Azure OpenAI API key
     AZURE_OPENAI_MODEL      Model deployment name
+    ANTHROPIC_API_KEY       Anthropic API key (clipping and transcription)
+    ANTHROPIC_MODEL         Claude model (default claude-sonnet-4)
 
   Image Transcription:
     GEMINI_API_KEY          Google Gemini API key
     GOOGLE_API_KEY          Alternative API key variable
 
+  Timeouts (Go durations, e.g. 90s, 10m):
+    AI_TIMEOUT              Clip parsing request timeout (default: 20-60s,
+                            45-120s for local models; longer prompts get more)
+    CAPYCUT_REQUEST_TIMEOUT Transcription request timeout (default 5m)
+    CAPYCUT_JOB_TIMEOUT     Transcription job timeout (default: per-image
+                            budget x images, 5m-4h)
+    CAPYCUT_PER_IMAGE_TIMEOUT
+                            Job budget per image (default 30s)
+
+  Clipping:
+    CAPYCUT_MIN_CLIP        Shortest clip to cut (default 100ms)
+    CAPYCUT_STDIN_MAX_SIZE  Largest video accepted from stdin (default 4G)
+    CAPYCUT_FILE            Video to clip when run without a terminal
+    CAPYCUT_PROMPT          Clip description when run without a terminal
+
+  Output:
+    CAPYCUT_DIR_MODE        Output directory permissions (like --dir-mode)
+    CAPYCUT_FILE_MODE       Output file permissions (like --file-mode)
+
+  Network:
+    HTTPS_PROXY, HTTP_PROXY Proxy for AI requests (NO_PROXY lists hosts
+                            to reach directly); see --doctor
+    CAPYCUT_CA_CERT         PEM bundle of extra CAs to trust for private
+                            endpoints (e.g. a corporate gateway)
+    CAPYCUT_INSECURE        Skip certificate verification (like --insecure)
+
+  Config:
+    CAPYCUT_PROFILE         Config file profile to use (like --profile)
+
   Debug:
     CAPYCUT_DEBUG           Enable debug output
+    CAPYCUT_STREAM=1        Show clip parsing answers from local and OpenAI
+                            models as they arrive
 
 EXAMPLES:
     # Interactive mode
@@ -151,6 +323,9 @@ EXAMPLES:
 
     # Video clipping
     capycut -f video.mp4 -p "first 2 minutes"
+    capycut -f video.mp4 -p "last 30 seconds" -o ./clips/
+    capycut -f video.mp4 -p "first 2 minutes and last 30 seconds"
+    capycut -f ./recordings -p "first minute" --since 2024-01-01 -o ./clips/
 
     # Image transcription
     capycut transcribe ./scanned_pages/
@@ -170,6 +345,17 @@ EXAMPLES:
     export LLM_MODEL=my-model
     capycut
 
+    # OpenAI setup example
+    export LLM_PROVIDER=openai
+    export OPENAI_API_KEY=sk-my-key
+    export OPENAI_MODEL=gpt-4o-mini
+    capycut
+
+    # Anthropic setup example
+    export LLM_PROVIDER=anthropic
+    export ANTHROPIC_API_KEY=sk-ant-my-key
+    capycut
+
     # Azure setup example
     export LLM_PROVIDER=azure
     export AZURE_OPENAI_ENDPOINT=https://my-resource.openai.azure.com
@@ -197,6 +383,7 @@ const (
 	ShellFish
 	ShellPowerShell
 	ShellDotEnv
+	ShellYAML
 )
 
 // detectShell detects the current shell and returns available profile files
@@ -302,6 +489,10 @@ func detectShell() (string, []shellProfile) {
 		}
 	}
 
+	// The capycut config file is read on every platform and by every shell
+	configFile := userConfigPath()
+	profiles = append(profiles, shellProfile{fmt.Sprintf("capycut config file (%s)", shortenPath(configFile, homeDir)), configFile, false})
+
 	// Always offer .env option (works on all platforms)
 	envFile := filepath.Join(".", ".env")
 	profiles = append(profiles, shellProfile{".env file (current directory)", envFile, false})
@@ -355,6 +546,9 @@ func getShellType(profilePath string) ShellType {
 	if strings.HasSuffix(lower, ".ps1") {
 		return ShellPowerShell
 	}
+	if strings.HasSuffix(lower, ".yaml") || strings.HasSuffix(lower, ".yml") {
+		return ShellYAML
+	}
 	if strings.Contains(lower, "fish") {
 		return ShellFish
 	}
@@ -373,14 +567,29 @@ func generateEnvExports(provider, endpoint, apiKey, model, apiVersion string, sh
 
 	var envVars []struct{ key, value string }
 
-	if provider == "local" {
+	switch provider {
+	case "local":
 		envVars = append(envVars, struct{ key, value string }{"LLM_PROVIDER", "local"})
 		envVars = append(envVars, struct{ key, value string }{"LLM_ENDPOINT", endpoint})
 		envVars = append(envVars, struct{ key, value string }{"LLM_MODEL", model})
 		if apiKey != "" {
 			envVars = append(envVars, struct{ key, value string }{"LLM_API_KEY", apiKey})
 		}
-	} else {
+	case "openai":
+		envVars = append(envVars, struct{ key, value string }{"LLM_PROVIDER", "openai"})
+		envVars = append(envVars, struct{ key, value string }{"OPENAI_API_KEY", apiKey})
+		envVars = append(envVars, struct{ key, value string }{"OPENAI_MODEL", model})
+		if endpoint != "" {
+			envVars = append(envVars, struct{ key, value string }{"OPENAI_BASE_URL", endpoint})
+		}
+	case "anthropic":
+		envVars = append(envVars, struct{ key, value string }{"LLM_PROVIDER", "anthropic"})
+		envVars = append(envVars, struct{ key, value string }{"ANTHROPIC_API_KEY", apiKey})
+		envVars = append(envVars, struct{ key, value string }{"ANTHROPIC_MODEL", model})
+		if endpoint != "" {
+			envVars = append(envVars, struct{ key, value string }{"ANTHROPIC_BASE_URL", endpoint})
+		}
+	default:
 		envVars = append(envVars, struct{ key, value string }{"LLM_PROVIDER", "azure"})
 		envVars = append(envVars, struct{ key, value string }{"AZURE_OPENAI_ENDPOINT", endpoint})
 		envVars = append(envVars, struct{ key, value string }{"AZURE_OPENAI_API_KEY", apiKey})
@@ -414,14 +623,29 @@ func generateDotEnv(provider, endpoint, apiKey, model, apiVersion string) string
 
 	lines = append(lines, "# CapyCut configuration")
 
-	if provider == "local" {
+	switch provider {
+	case "local":
 		lines = append(lines, "LLM_PROVIDER=local")
 		lines = append(lines, fmt.Sprintf("LLM_ENDPOINT=%s", endpoint))
 		lines = append(lines, fmt.Sprintf("LLM_MODEL=%s", model))
 		if apiKey != "" {
 			lines = append(lines, fmt.Sprintf("LLM_API_KEY=%s", apiKey))
 		}
-	} else {
+	case "openai":
+		lines = append(lines, "LLM_PROVIDER=openai")
+		lines = append(lines, fmt.Sprintf("OPENAI_API_KEY=%s", apiKey))
+		lines = append(lines, fmt.Sprintf("OPENAI_MODEL=%s", model))
+		if endpoint != "" {
+			lines = append(lines, fmt.Sprintf("OPENAI_BASE_URL=%s", endpoint))
+		}
+	case "anthropic":
+		lines = append(lines, "LLM_PROVIDER=anthropic")
+		lines = append(lines, fmt.Sprintf("ANTHROPIC_API_KEY=%s", apiKey))
+		lines = append(lines, fmt.Sprintf("ANTHROPIC_MODEL=%s", model))
+		if endpoint != "" {
+			lines = append(lines, fmt.Sprintf("ANTHROPIC_BASE_URL=%s", endpoint))
+		}
+	default:
 		lines = append(lines, "LLM_PROVIDER=azure")
 		lines = append(lines, fmt.Sprintf("AZURE_OPENAI_ENDPOINT=%s", endpoint))
 		lines = append(lines, fmt.Sprintf("AZURE_OPENAI_API_KEY=%s", apiKey))
@@ -495,10 +719,60 @@ func runSelfUpdate() error {
 	}
 
 	fmt.Println(successStyle.Render(fmt.Sprintf("Successfully updated to version %s!", latest.Version())))
+
+	releaseURL := latest.URL
+	if releaseURL == "" {
+		releaseURL = fmt.Sprintf("https://github.com/%s/%s/releases/tag/v%s", repoOwner, repoName, latest.Version())
+	}
+	fmt.Println()
+	fmt.Println(subtitleStyle.Render(fmt.Sprintf("What's new in %s:", latest.Version())))
+	fmt.Println(formatReleaseNotes(latest.ReleaseNotes, releaseURL))
+	fmt.Println()
+
 	fmt.Println(infoStyle.Render("Please restart capycut to use the new version."))
 	return nil
 }
 
+// Release notes longer than this are cut short after self-update, with a
+// link to the full release page
+const (
+	maxReleaseNoteLines = 25
+	maxReleaseNoteChars = 2000
+)
+
+// formatReleaseNotes trims release notes for the terminal, truncating long
+// ones, and ends with a link to the release page
+func formatReleaseNotes(notes, releaseURL string) string {
+	notes = strings.TrimSpace(strings.ReplaceAll(notes, "\r\n", "\n"))
+	if notes == "" {
+		return infoStyle.Render("No release notes. See " + releaseURL)
+	}
+
+	truncated := false
+	if lines := strings.Split(notes, "\n"); len(lines) > maxReleaseNoteLines {
+		notes = strings.Join(lines[:maxReleaseNoteLines], "\n")
+		truncated = true
+	}
+	if len(notes) > maxReleaseNoteChars {
+		// Cut at a line break where possible, and never inside a UTF-8 sequence
+		cut := strings.LastIndexByte(notes[:maxReleaseNoteChars], '\n')
+		if cut <= 0 {
+			cut = maxReleaseNoteChars
+			for cut > 0 && !utf8.RuneStart(notes[cut]) {
+				cut--
+			}
+		}
+		notes = notes[:cut]
+		truncated = true
+	}
+	notes = strings.TrimRight(notes, " \t\n")
+
+	if truncated {
+		return notes + "\n...\n\n" + infoStyle.Render("Full release notes: "+releaseURL)
+	}
+	return notes + "\n\n" + infoStyle.Render("Release page: "+releaseURL)
+}
+
 func runSetupWizard() {
 	fmt.Println(titleStyle.Render(capybaraLogo))
 	fmt.Println(subtitleStyle.Render("Welcome to CapyCut Setup! Let's configure your LLM provider.\n"))
@@ -509,6 +783,8 @@ func runSetupWizard() {
 		Title("Which LLM provider would you like to use?").
 		Options(
 			huh.NewOption("Local LLM (LM Studio, Ollama, etc.) - Free & Private", "local"),
+			huh.NewOption("OpenAI - Cloud-based, api.openai.com", "openai"),
+			huh.NewOption("Anthropic (Claude) - Cloud-based, api.anthropic.com", "anthropic"),
 			huh.NewOption("Azure OpenAI - Cloud-based", "azure"),
 		).
 		Value(&provider)
@@ -607,6 +883,94 @@ func runSetupWizard() {
 			model = defaultModel
 		}
 
+	} else if provider == "openai" {
+		// OpenAI setup
+		fmt.Println(infoStyle.Render("\nYou'll need an API key from https://platform.openai.com/api-keys\n"))
+
+		apiKeyInput := huh.NewInput().
+			Title("OpenAI API Key").
+			Description("Your secret key, starting with sk-").
+			Placeholder("sk-...").
+			EchoMode(huh.EchoModePassword).
+			Value(&apiKey)
+
+		modelInput := huh.NewInput().
+			Title("Model Name").
+			Description("e.g., gpt-4o-mini, gpt-4o").
+			Placeholder(llm.DefaultOpenAIModel).
+			Value(&model)
+
+		baseURLInput := huh.NewInput().
+			Title("Base URL (optional)").
+			Description("Only needed for a proxy or gateway in front of the OpenAI API").
+			Placeholder("(press Enter to use " + llm.DefaultOpenAIBaseURL + ")").
+			Value(&endpoint)
+
+		err = huh.NewForm(huh.NewGroup(apiKeyInput, modelInput, baseURLInput)).
+			WithTheme(huh.ThemeCatppuccin()).
+			Run()
+
+		if err != nil {
+			if err == huh.ErrUserAborted {
+				fmt.Println(infoStyle.Render("Setup cancelled."))
+				return
+			}
+			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			return
+		}
+
+		if apiKey == "" {
+			fmt.Println(errorStyle.Render("Error: An API key is required for OpenAI"))
+			return
+		}
+		if model == "" {
+			model = llm.DefaultOpenAIModel
+		}
+
+	} else if provider == "anthropic" {
+		// Anthropic setup
+		fmt.Println(infoStyle.Render("\nYou'll need an API key from https://console.anthropic.com/settings/keys\n"))
+
+		apiKeyInput := huh.NewInput().
+			Title("Anthropic API Key").
+			Description("Your secret key, starting with sk-ant-").
+			Placeholder("sk-ant-...").
+			EchoMode(huh.EchoModePassword).
+			Value(&apiKey)
+
+		modelInput := huh.NewInput().
+			Title("Model Name").
+			Description("e.g., claude-sonnet-4-20250514, claude-3-5-haiku-20241022").
+			Placeholder(llm.DefaultAnthropicModel).
+			Value(&model)
+
+		baseURLInput := huh.NewInput().
+			Title("Base URL (optional)").
+			Description("Only needed for a proxy or gateway in front of the Anthropic API").
+			Placeholder("(press Enter to use " + llm.DefaultAnthropicBaseURL + ")").
+			Value(&endpoint)
+
+		err = huh.NewForm(huh.NewGroup(apiKeyInput, modelInput, baseURLInput)).
+			WithTheme(huh.ThemeCatppuccin()).
+			Run()
+
+		if err != nil {
+			if err == huh.ErrUserAborted {
+				fmt.Println(infoStyle.Render("Setup cancelled."))
+				return
+			}
+			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			return
+		}
+
+		if apiKey == "" {
+			fmt.Println(errorStyle.Render("Error: An API key is required for Anthropic"))
+			return
+		}
+		if model == "" {
+			model = llm.DefaultAnthropicModel
+		}
+
 	} else {
 		// Azure OpenAI setup
 		fmt.Println(infoStyle.Render("\nYou'll need your Azure OpenAI credentials from the Azure Portal."))
@@ -690,13 +1054,44 @@ func runSetupWizard() {
 		return
 	}
 
+	// The config file can hold several named sets of settings
+	shellType := getShellType(selectedProfile)
+	configProfile := profileFlag
+	if shellType == ShellYAML {
+		profileInput := huh.NewInput().
+			Title("Profile name (optional)").
+			Description("Save as a named profile, used with --profile <name>").
+			Placeholder("(press Enter to save as the default settings)").
+			Value(&configProfile)
+
+		err = huh.NewForm(huh.NewGroup(profileInput)).
+			WithTheme(huh.ThemeCatppuccin()).
+			Run()
+
+		if err != nil {
+			if err == huh.ErrUserAborted {
+				fmt.Println(infoStyle.Render("Setup cancelled."))
+				return
+			}
+			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			return
+		}
+		configProfile = strings.TrimSpace(configProfile)
+	}
+
 	// Generate config content
 	var configContent string
-	shellType := getShellType(selectedProfile)
 
-	if shellType == ShellDotEnv {
+	switch shellType {
+	case ShellDotEnv:
 		configContent = generateDotEnv(provider, endpoint, apiKey, model, apiVersion)
-	} else {
+	case ShellYAML:
+		configContent, err = generateConfigYAML(provider, endpoint, apiKey, model, apiVersion, configProfile)
+		if err != nil {
+			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			return
+		}
+	default:
 		configContent = generateEnvExports(provider, endpoint, apiKey, model, apiVersion, shellType)
 	}
 
@@ -729,10 +1124,14 @@ func runSetupWizard() {
 	}
 
 	// Write to file
-	if shellType == ShellDotEnv {
+	switch shellType {
+	case ShellDotEnv:
 		// For .env, create or overwrite
 		err = os.WriteFile(selectedProfile, []byte(configContent), 0600)
-	} else {
+	case ShellYAML:
+		// For the config file, update these keys and keep the rest
+		err = writeConfigYAML(selectedProfile, configContent)
+	default:
 		// For shell profiles, append or create
 		f, err2 := os.OpenFile(selectedProfile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 		if err2 != nil {
@@ -757,6 +1156,11 @@ func runSetupWizard() {
 		reloadCmd = fmt.Sprintf("source %s", selectedProfile)
 	case ShellDotEnv:
 		reloadCmd = "(restart capycut - .env is loaded automatically)"
+	case ShellYAML:
+		reloadCmd = "(restart capycut - the config file is loaded automatically)"
+		if configProfile != "" {
+			reloadCmd = fmt.Sprintf("capycut --profile %s", configProfile)
+		}
 	default:
 		reloadCmd = fmt.Sprintf("source %s", selectedProfile)
 	}
@@ -773,6 +1177,28 @@ func runSetupWizard() {
 	fmt.Println(successStyle.Render(successBox))
 }
 
+// versionInfo is the --version --json output, for release automation
+type versionInfo struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	Date    string `json:"date"`
+	Go      string `json:"go"`
+	OS      string `json:"os"`
+	Arch    string `json:"arch"`
+}
+
+// printVersionJSON writes the build information as a single JSON object
+func printVersionJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(versionInfo{
+		Version: version,
+		Commit:  commit,
+		Date:    date,
+		Go:      runtime.Version(),
+		OS:      runtime.GOOS,
+		Arch:    runtime.GOARCH,
+	})
+}
+
 func main() {
 	// Check for subcommands before parsing flags
 	args := os.Args[1:]
@@ -781,8 +1207,37 @@ func main() {
 		runTranscribeCommand(args[1:])
 		return
 	}
+	if len(args) > 0 && args[0] == "models" {
+		profile, rest := splitProfileArg(args[1:])
+		mustLoadEnvironment(profile)
+		runModelsCommand(rest)
+		return
+	}
+	// --list-models is the models command under another name, so its
+	// --provider takes the same provider names
+	if i := slices.Index(args, "--list-models"); i >= 0 {
+		profile, rest := splitProfileArg(slices.Delete(slices.Clone(args), i, i+1))
+		mustLoadEnvironment(profile)
+		runModelsCommand(rest)
+		return
+	}
+	if len(args) > 0 && args[0] == "config" {
+		profile, rest := splitProfileArg(args[1:])
+		mustLoadEnvironment(profile)
+		runConfigCommand(rest)
+		return
+	}
+	if len(args) > 0 && args[0] == "profile" {
+		runProfileCommand(args[1:])
+		return
+	}
+	// Clipping is the default, so "clip" only needs stripping before the
+	// flags; otherwise flag parsing would stop at it and ignore the rest
+	if len(args) > 0 && args[0] == "clip" {
+		args = args[1:]
+	}
 
-	flag.Parse()
+	flag.CommandLine.Parse(args)
 
 	if helpFlag {
 		printHelp()
@@ -790,16 +1245,31 @@ func main() {
 	}
 
 	if versionFlag || shortVersionFlag {
+		if jsonFlag {
+			if err := printVersionJSON(os.Stdout); err != nil {
+				fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
 		fmt.Printf("capycut %s\n", version)
 		fmt.Printf("  commit: %s\n", commit)
 		fmt.Printf("  built:  %s\n", date)
 		fmt.Printf("  go:     %s\n", runtime.Version())
 		fmt.Printf("  os/arch: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+		if v, err := video.DetectFFmpegVersion(); err == nil {
+			fmt.Printf("  ffmpeg: %s\n", v)
+		} else if video.CheckFFmpeg() == nil {
+			fmt.Println("  ffmpeg: unknown version")
+		} else {
+			fmt.Println("  ffmpeg: not found")
+		}
 		os.Exit(0)
 	}
 
 	// Run setup wizard if requested
 	if setupFlag {
+		requireTerminal("The setup wizard")
 		runSetupWizard()
 		os.Exit(0)
 	}
@@ -813,36 +1283,92 @@ func main() {
 		os.Exit(0)
 	}
 
+	level, err := resolveVerbosity(quietFlag, verboseFlag, debugFlag)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		os.Exit(1)
+	}
+	verbosity = level
+
 	// Enable debug mode via flag
 	if debugFlag {
 		os.Setenv("CAPYCUT_DEBUG", "1")
 	}
+	if insecureFlag {
+		os.Setenv(llm.InsecureEnvVar, "1")
+	}
+	// Sampling overrides (negative = not set) reach every parser, the
+	// interactive ones included, through the environment
+	if temperatureFlag >= 0 {
+		os.Setenv(ai.TemperatureEnvVar, strconv.FormatFloat(temperatureFlag, 'g', -1, 64))
+	}
+	if topPFlag >= 0 {
+		os.Setenv(ai.TopPEnvVar, strconv.FormatFloat(topPFlag, 'g', -1, 64))
+	}
+	setOutputModeEnv("--dir-mode", dirModeFlag)
+	setOutputModeEnv("--file-mode", fileModeFlag)
+
+	// Load .env and the config files if they exist (won't error if missing)
+	mustLoadEnvironment(profileFlag)
+	warnInsecureTLS()
+
+	// Without a terminal the menus can't run, so take the clip from the
+	// environment if it's there
+	if fileFlag == "" && promptFlag == "" && !interactiveTerminal() {
+		fileFlag = os.Getenv(FileEnvVar)
+		promptFlag = os.Getenv(PromptEnvVar)
+	}
+
+	// Expand $VAR and ~ ourselves for callers that don't go through a shell;
+	// after loading .env so its variables can be used too
+	fileFlag = expandPath(fileFlag)
+	outputFlag = expandPath(outputFlag)
 
-	// Load .env file if it exists (won't error if missing)
-	_ = godotenv.Load()
+	if doctorFlag {
+		runDoctor(os.Stdout)
+		os.Exit(0)
+	}
 
 	// Set provider from flag (overrides env var)
 	if providerFlag != "" {
 		os.Setenv("LLM_PROVIDER", providerFlag)
 	}
 
+	// The clip itself goes to stdout with -o -, so everything else can't
+	if outputFlag == video.StdoutPath {
+		if err := checkStdoutOutput(fileFlag, promptFlag); err != nil {
+			fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+			os.Exit(1)
+		}
+		infoOut = os.Stderr
+	}
+
 	// Print header
-	fmt.Println(titleStyle.Render(capybaraLogo))
+	printInfo(titleStyle.Render(capybaraLogo))
 
 	// If file and prompt are provided via args, run non-interactive video mode
 	if fileFlag != "" && promptFlag != "" {
 		// Check for ffmpeg for video mode
 		if err := video.CheckFFmpeg(); err != nil {
-			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			fmt.Fprintln(infoOut, errorStyle.Render("Error: "+err.Error()))
 			os.Exit(1)
 		}
 		if err := video.CheckFFprobe(); err != nil {
-			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			fmt.Fprintln(infoOut, errorStyle.Render("Error: "+err.Error()))
 			os.Exit(1)
 		}
-		if err := ai.CheckConfig(); err != nil {
-			fmt.Println(errorStyle.Render("Error: " + err.Error()))
-			fmt.Println(infoStyle.Render(ai.GetAPIKeyHelp()))
+		// Simple prompts like "first 2 minutes" are parsed without a provider
+		if err := ai.CheckConfig(); err != nil && !ai.CanParseLocally(promptFlag) {
+			fmt.Fprintln(infoOut, errorStyle.Render("Error: "+err.Error()))
+			fmt.Fprintln(infoOut, infoStyle.Render(ai.GetAPIKeyHelp()))
+			os.Exit(1)
+		}
+		if video.IsBatchSource(fileFlag) {
+			runBatchClip(fileFlag, promptFlag, outputFlag)
+			return
+		}
+		if sinceFlag != "" || untilFlag != "" || nameTimeFlag != "" {
+			fmt.Fprintln(infoOut, errorStyle.Render("Error: --since, --until and --name-time-format need a directory or glob for --file"))
 			os.Exit(1)
 		}
 		runNonInteractive(fileFlag, promptFlag, outputFlag)
@@ -857,10 +1383,48 @@ func main() {
 	}
 
 	// Main interactive menu
+	requireTerminal("The interactive menu")
 	runMainMenu()
 }
 
-// runMainMenu displays the main menu for selecting features
+// offerFFmpegInstall asks to install ffmpeg with the detected package
+// manager and runs the install when confirmed. It reports whether ffmpeg
+// is available afterwards.
+func offerFFmpegInstall() bool {
+	cmd, ok := video.DetectFFmpegInstallCommand()
+	if !ok {
+		return false
+	}
+
+	var install bool
+	confirm := huh.NewConfirm().
+		Title("Install ffmpeg now?").
+		Description("Runs: " + cmd.String()).
+		Affirmative("Yes, install it").
+		Negative("No").
+		Value(&install)
+
+	err := huh.NewForm(huh.NewGroup(confirm)).
+		WithTheme(huh.ThemeCatppuccin()).
+		Run()
+	if err != nil || !install {
+		return false
+	}
+
+	if err := video.InstallFFmpeg(cmd); err != nil {
+		fmt.Println(errorStyle.Render("Error: install failed: " + err.Error()))
+		return false
+	}
+	if err := video.CheckFFmpeg(); err != nil {
+		fmt.Println(errorStyle.Render("Error: ffmpeg is still not on PATH after installing; open a new terminal and try again"))
+		return false
+	}
+	fmt.Println(successStyle.Render("✓ ffmpeg installed"))
+	return true
+}
+
+// runMainMenu displays the main menu for selecting features. A workflow
+// returns true to come back here and false when the user chose to quit.
 func runMainMenu() {
 	for {
 		var choice string
@@ -871,7 +1435,7 @@ func runMainMenu() {
 				huh.NewOption("📸 Transcribe images to Markdown", "transcribe"),
 				huh.NewOption("⚙️  Setup wizard", "setup"),
 				huh.NewOption("🔄 Check for updates", "update"),
-				huh.NewOption("❌ Exit", "exit"),
+				huh.NewOption("❌ Quit", "exit"),
 			).
 			Value(&choice)
 
@@ -888,7 +1452,9 @@ func runMainMenu() {
 			// Check for video clipping prerequisites
 			if err := video.CheckFFmpeg(); err != nil {
 				fmt.Println(errorStyle.Render("Error: " + err.Error()))
-				continue
+				if !offerFFmpegInstall() {
+					continue
+				}
 			}
 			if err := video.CheckFFprobe(); err != nil {
 				fmt.Println(errorStyle.Render("Error: " + err.Error()))
@@ -900,7 +1466,8 @@ func runMainMenu() {
 				continue
 			}
 			if !runClipWorkflow() {
-				continue
+				fmt.Println(subtitleStyle.Render("\n🦫 Thanks for using CapyCut! Bye bye!"))
+				return
 			}
 
 		case "transcribe":
@@ -911,7 +1478,8 @@ func runMainMenu() {
 				continue
 			}
 			if !runTranscribeWorkflow() {
-				continue
+				fmt.Println(subtitleStyle.Render("\n🦫 Thanks for using CapyCut! Bye bye!"))
+				return
 			}
 
 		case "setup":
@@ -931,16 +1499,21 @@ func runMainMenu() {
 
 // runTranscribeCommand handles the transcribe subcommand
 func runTranscribeCommand(args []string) {
-	// Enable debug mode if flag present
+	profile, args := splitProfileArg(args)
+
+	// Enable debug mode and skip TLS verification if the flags are present
 	for _, arg := range args {
-		if arg == "--debug" {
+		switch arg {
+		case "--debug":
 			os.Setenv("CAPYCUT_DEBUG", "1")
-			break
+		case "--insecure":
+			os.Setenv(llm.InsecureEnvVar, "1")
 		}
 	}
 
-	// Load .env file
-	_ = godotenv.Load()
+	// Load .env and the config files
+	mustLoadEnvironment(profile)
+	warnInsecureTLS()
 
 	// Print header
 	fmt.Println(titleStyle.Render(capybaraLogo))
@@ -948,8 +1521,15 @@ func runTranscribeCommand(args []string) {
 	// Parse arguments
 	opts, sources := parseTranscribeArgs(args)
 
+	// Re-organizing saved pages needs no provider configuration
+	if opts.FromJSON != "" {
+		runOrganizeFromJSON(opts)
+		return
+	}
+
 	// If no sources provided, run interactive mode
 	if len(sources) == 0 {
+		requireTerminal("Interactive transcription")
 		// Check config
 		if err := checkTranscribeConfig(); err != nil {
 			fmt.Println(errorStyle.Render("Error: " + err.Error()))
@@ -969,7 +1549,82 @@ func runTranscribeCommand(args []string) {
 	}
 
 	// Run non-interactive transcription
-	runNonInteractiveTranscribe(sources, opts.OutputDir, opts.Model, opts.DetectChapters, opts.CombinePages)
+	runNonInteractiveTranscribe(sources, opts)
+}
+
+// parseWithSpinner parses a clip description behind a spinner. Ctrl+C
+// cancels the request instead of quitting capycut, which a hung local model
+// would otherwise require; cancelled reports that. Unlike the TUI, Esc does
+// nothing here: huh's spinner only reacts to Ctrl+C.
+func parseWithSpinner(parser *ai.Parser, description string, duration time.Duration) (reqs []*ai.ClipRequest, cancelled bool, err error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	type parseResult struct {
+		reqs []*ai.ClipRequest
+		err  error
+	}
+	done := make(chan parseResult, 1)
+
+	err = spinner.New().
+		Title("🦫 Chomp chomp... understanding your request... (Ctrl+C to cancel)").
+		Context(ctx).
+		ActionWithErr(func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, parser.ParseTimeout(description))
+			defer cancel()
+
+			// Progress callback to update status
+			onProgress := func(update ai.ParserProgressUpdate) {
+				// The spinner doesn't support dynamic updates, so the status
+				// is only shown in debug mode
+				if os.Getenv("CAPYCUT_DEBUG") != "" {
+					fmt.Printf("\n[AI Status] %s: %s - %s\n", update.Provider, update.Status.String(), update.Message)
+				}
+			}
+
+			reqs, err := parser.ParseClipRequestsWithProgress(ctx, description, duration, onProgress)
+			done <- parseResult{reqs, err}
+			return nil
+		}).
+		Run()
+
+	// The spinner returns as soon as the context ends; the request stops
+	// with it in the background
+	if ctx.Err() != nil || errors.Is(err, tea.ErrInterrupted) {
+		return nil, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	result := <-done
+	return result.reqs, false, result.err
+}
+
+// setOutputModeEnv validates a --dir-mode or --file-mode value and passes it
+// on through the environment, where every workflow that writes output reads
+// it, taking precedence over .env
+func setOutputModeEnv(flagName, mode string) {
+	if mode == "" {
+		return
+	}
+	if _, err := fsmode.Parse(mode); err != nil {
+		fmt.Println(errorStyle.Render("Error: " + flagName + ": " + err.Error()))
+		os.Exit(1)
+	}
+	envVar := fsmode.DirEnvVar
+	if flagName == "--file-mode" {
+		envVar = fsmode.FileEnvVar
+	}
+	os.Setenv(envVar, mode)
+}
+
+// warnInsecureTLS prints a loud warning when certificate verification is off
+func warnInsecureTLS() {
+	if insecure, _ := llm.InsecureFromEnv(); !insecure {
+		return
+	}
+	fmt.Fprintln(os.Stderr, errorStyle.Render("⚠️  WARNING: TLS certificate verification is DISABLED ("+llm.InsecureEnvVar+" / --insecure)."))
+	fmt.Fprintln(os.Stderr, errorStyle.Render("   Anyone on the network can intercept your API keys and data. Use CAPYCUT_CA_CERT outside development."))
 }
 
 // getTranscribeAPIHelp returns help text for Gemini API setup
@@ -988,103 +1643,480 @@ Or create a .env file with:
 }
 
 func runNonInteractive(videoPath, clipDescription, customOutput string) {
-	// Validate video file exists
-	if _, err := os.Stat(videoPath); os.IsNotExist(err) {
-		fmt.Println(errorStyle.Render("Error: Video file not found: " + videoPath))
-		os.Exit(1)
+	// Output names come from the input path; piped input has none
+	namingPath := videoPath
+	if videoPath == video.StdinPath {
+		buffered, err := bufferStdinVideo()
+		if err != nil {
+			fmt.Fprintln(infoOut, errorStyle.Render("Error: "+err.Error()))
+			exitClip(1)
+		}
+		videoPath = buffered
+		namingPath = video.StdinFilename + filepath.Ext(buffered)
 	}
+	defer clipCleanup()
 
-	// Get video info
-	fmt.Println(infoStyle.Render("Reading video information..."))
-	videoInfo, err := video.GetVideoInfo(videoPath)
-	if err != nil {
-		fmt.Println(errorStyle.Render("Error: " + err.Error()))
-		os.Exit(1)
+	if err := clipFile(videoPath, namingPath, clipDescription, customOutput); err != nil {
+		printClipError(err)
+		exitClip(1)
 	}
+}
 
-	// Display video info
-	infoBox := boxStyle.Render(fmt.Sprintf(
-		"📹 %s\n⏱  Duration: %s",
-		videoInfo.Filename,
-		video.FormatDuration(videoInfo.Duration),
-	))
-	fmt.Println(infoBox)
-
-	// Parse with AI - show detailed status
-	parser, err := ai.NewParser()
+// runBatchClip cuts the same description from every video in a directory
+// or glob that --since/--until keep, carrying on past failures
+func runBatchClip(source, clipDescription, customOutput string) {
+	filter, err := batchTimeFilter()
 	if err != nil {
-		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		fmt.Fprintln(infoOut, errorStyle.Render("Error: "+err.Error()))
 		os.Exit(1)
 	}
-
-	// Show AI status
-	aiStatusBox := boxStyle.Render(fmt.Sprintf(
-		"🤖 AI Agent: %s\n"+
-			"   Model: %s\n"+
-			"   Status: Processing request...",
-		parser.GetProviderDisplayName(),
-		parser.GetModel(),
-	))
-	fmt.Println(aiStatusBox)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
-
-	// Progress callback
-	onProgress := func(update ai.ParserProgressUpdate) {
-		fmt.Printf("\r   Status: %s - %s", update.Status.String(), update.Message)
+	if customOutput == video.StdoutPath {
+		fmt.Fprintln(infoOut, errorStyle.Render("Error: --output - can't take clips from several videos"))
+		os.Exit(1)
+	}
+	// Several clips need a directory to go in
+	if customOutput != "" {
+		if info, err := os.Stat(customOutput); err == nil && !info.IsDir() {
+			fmt.Fprintln(infoOut, errorStyle.Render("Error: --output must be a directory when --file is a directory or glob"))
+			os.Exit(1)
+		}
+		if !strings.HasSuffix(customOutput, string(os.PathSeparator)) {
+			customOutput += string(os.PathSeparator)
+		}
 	}
 
-	clipReq, err := parser.ParseClipRequestWithProgress(ctx, clipDescription, videoInfo.Duration, onProgress)
-	fmt.Println() // New line after progress
+	videos, filtered, err := video.FindVideos(source, filter)
 	if err != nil {
-		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		fmt.Fprintln(infoOut, errorStyle.Render("Error: "+err.Error()))
 		os.Exit(1)
 	}
-
-	fmt.Println(successStyle.Render("✓ AI parsing complete"))
-
-	// Calculate clip duration
-	clipDuration, err := video.CalculateClipDuration(clipReq.StartTime, clipReq.EndTime)
-	if err != nil {
-		fmt.Println(errorStyle.Render("Error calculating duration: " + err.Error()))
+	if len(videos) == 0 {
+		msg := "Error: no videos found in " + source
+		if filtered > 0 {
+			msg = fmt.Sprintf("Error: none of the %d videos in %s are inside --since/--until", filtered, source)
+		}
+		fmt.Fprintln(infoOut, errorStyle.Render(msg))
 		os.Exit(1)
 	}
+	if filtered > 0 {
+		printInfo(infoStyle.Render(fmt.Sprintf("Skipping %d videos outside --since/--until", filtered)))
+	}
 
-	// Determine output path
-	outputPath := customOutput
-	if outputPath == "" {
-		outputPath = video.GenerateOutputPath(videoPath, clipReq.StartTime, clipReq.EndTime)
+	failed := 0
+	for i, path := range videos {
+		printInfo(titleStyle.Render(fmt.Sprintf("[%d/%d] %s", i+1, len(videos), filepath.Base(path))))
+		if err := clipFile(path, path, clipDescription, customOutput); err != nil {
+			printClipError(err)
+			failed++
+		}
 	}
 
-	// Show summary
-	summaryBox := boxStyle.Render(fmt.Sprintf(
-		"📋 Clip Summary\n\n"+
-			"Input:    %s\n"+
-			"Start:    %s\n"+
-			"End:      %s\n"+
-			"Duration: %s\n"+
-			"Output:   %s",
-		filepath.Base(videoPath),
-		clipReq.StartTime,
-		clipReq.EndTime,
-		video.FormatDuration(clipDuration),
-		filepath.Base(outputPath),
+	if failed > 0 {
+		fmt.Fprintln(infoOut, errorStyle.Render(fmt.Sprintf("Clipped %d of %d videos, %d failed", len(videos)-failed, len(videos), failed)))
+		os.Exit(1)
+	}
+	printInfo(successStyle.Render(fmt.Sprintf("✓ Clipped %d videos", len(videos))))
+}
+
+// batchTimeFilter builds the batch filter from --since, --until and
+// --name-time-format
+func batchTimeFilter() (video.TimeFilter, error) {
+	filter := video.TimeFilter{NameFormat: nameTimeFlag}
+	var err error
+	if sinceFlag != "" {
+		if filter.Since, err = video.ParseFilterTime(sinceFlag); err != nil {
+			return filter, fmt.Errorf("--since: %w", err)
+		}
+	}
+	if untilFlag != "" {
+		if filter.Until, err = video.ParseFilterTime(untilFlag); err != nil {
+			return filter, fmt.Errorf("--until: %w", err)
+		}
+	}
+	if !filter.Since.IsZero() && !filter.Until.IsZero() && !filter.Since.Before(filter.Until) {
+		return filter, fmt.Errorf("--since must be before --until")
+	}
+	if filter.NameFormat != "" && filter.IsZero() {
+		return filter, fmt.Errorf("--name-time-format needs --since or --until")
+	}
+	return filter, nil
+}
+
+// parseClipNonInteractive parses the clips a description asks for,
+// printing the AI provider's status as it goes when the description needs
+// one
+func parseClipNonInteractive(parser *ai.Parser, clipDescription string, duration time.Duration) ([]*ai.ClipRequest, error) {
+
+	parseTimeout := parser.ParseTimeout(clipDescription)
+	if os.Getenv("CAPYCUT_DEBUG") != "" {
+		fmt.Fprintf(infoOut, "[DEBUG] Parse deadline: %s\n", parseTimeout)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), parseTimeout)
+	defer cancel()
+
+	// Progress callback; the first update of a request to the provider
+	// shows the AI status
+	var asked bool
+	onProgress := func(update ai.ParserProgressUpdate) {
+		if update.Status == ai.ParserStatusConnecting && !asked {
+			asked = true
+			printInfo(boxStyle.Render(fmt.Sprintf(
+				"🤖 AI Agent: %s\n"+
+					"   Model: %s\n"+
+					"   Status: Processing request...",
+				parser.GetProviderDisplayName(),
+				parser.GetModel(),
+			)))
+		}
+		if !asked {
+			return
+		}
+		if verbosity >= VerbosityNormal {
+			fmt.Fprintf(infoOut, "\r   Status: %s - %s", update.Status.String(), update.Message)
+		}
+		printVerboseRequest(update.RequestInfo)
+		printVerboseResponse(update.ResponseInfo)
+	}
+
+	clipReqs, err := parser.ParseClipRequestsWithProgress(ctx, clipDescription, duration, onProgress)
+	if asked {
+		printInfo("") // New line after progress
+	}
+	return clipReqs, err
+}
+
+// printClipError reports a failed clip, with setup guidance for AI errors
+func printClipError(err error) {
+	fmt.Fprintln(infoOut, errorStyle.Render("Error: "+err.Error()))
+	if hint := ai.ErrorGuidance(err); hint != "" {
+		fmt.Fprintln(infoOut, infoStyle.Render(hint))
+	}
+}
+
+// clipFile parses the description against one video and cuts the clip.
+// namingPath is what output names are derived from, which differs from
+// videoPath for piped input.
+func clipFile(videoPath, namingPath, clipDescription, customOutput string) error {
+	// Validate video file exists
+	if _, err := os.Stat(videoPath); os.IsNotExist(err) {
+		return fmt.Errorf("video file not found: %s", videoPath)
+	}
+
+	hwaccel, err := video.ParseHWAccel(hwaccelFlag)
+	if err != nil {
+		return err
+	}
+	encode := video.EncodeOptions{
+		HWAccel: hwaccel,
+		CRF:     crfFlag,
+		Preset:  presetFlag,
+		Bitrate: bitrateFlag,
+	}
+	if err := encode.Validate(); err != nil {
+		return err
+	}
+	gifOpts := video.GIFOptions{FPS: gifFPSFlag, Width: gifWidthFlag}
+	if err := gifOpts.Validate(); err != nil {
+		return err
+	}
+	ext := ""
+	if gifFlag {
+		ext = video.GIFExt
+	}
+	if aspectFlag != "" {
+		if _, _, err := video.ParseAspectRatio(aspectFlag); err != nil {
+			return err
+		}
+	}
+	var audioFormat string
+	if audioOnlyFlag != "" {
+		if audioFormat, err = video.ParseAudioFormat(audioOnlyFlag); err != nil {
+			return err
+		}
+		if audioBitrateFlag != "" {
+			if err := video.ValidateAudioBitrate(audioBitrateFlag); err != nil {
+				return err
+			}
+		}
+		switch {
+		case gifFlag:
+			return fmt.Errorf("--audio-only and --gif can't be combined")
+		case aspectFlag != "", subtitlesFlag != "":
+			return fmt.Errorf("--audio-only drops the video, so --aspect and --subtitles don't apply")
+		case autoTitleFlag:
+			return fmt.Errorf("--auto-title needs video frames, so it can't be combined with --audio-only")
+		}
+		ext = video.AudioExt(audioFormat)
+	}
+
+	// Check the subtitle file up front rather than after the AI call
+	if subtitlesFlag != "" {
+		if _, err := video.DetectSubtitleFormat(subtitlesFlag); err != nil {
+			return err
+		}
+		if _, err := os.Stat(subtitlesFlag); err != nil {
+			return fmt.Errorf("subtitle file not found: %s", subtitlesFlag)
+		}
+	}
+
+	// Probe once; the parse, crop and cut steps all reuse the result
+	printInfo(infoStyle.Render("Reading video information..."))
+	videoInfo, err := video.GetVideoInfo(videoPath)
+	if err != nil {
+		return err
+	}
+
+	// Without a provider, only descriptions simple enough to parse locally work
+	parser, err := ai.NewParser()
+	if err != nil {
+		parser = ai.NewLocalOnlyParser(err)
+	}
+
+	// Display video info
+	infoBox := boxStyle.Render(fmt.Sprintf(
+		"📹 %s\n⏱  Duration: %s",
+		videoInfo.Filename,
+		video.FormatDuration(videoInfo.Duration),
 	))
-	fmt.Println(summaryBox)
+	printInfo(infoBox)
 
-	// Execute clip
-	fmt.Println(infoStyle.Render("🦫 Clipping video..."))
-	params := video.ClipParams{
-		InputPath:  videoPath,
-		StartTime:  clipReq.StartTime,
-		EndTime:    clipReq.EndTime,
-		OutputPath: outputPath,
+	if audioFormat != "" && !videoInfo.HasAudio {
+		return fmt.Errorf("%s has no audio track to extract", videoInfo.Filename)
 	}
 
-	if err := video.ClipVideo(params); err != nil {
-		fmt.Println(errorStyle.Render("Error clipping video: " + err.Error()))
-		os.Exit(1)
+	// The crop only depends on the source, so plan it once for all clips
+	var resolution string
+	if aspectFlag != "" {
+		crop, err := video.PlanAspectCrop(videoInfo.Width, videoInfo.Height, aspectFlag)
+		if err != nil {
+			return err
+		}
+		resolution = fmt.Sprintf("\nFrame:    %dx%d (%s)", crop.OutWidth, crop.OutHeight, aspectFlag)
+		if crop.IsNoop() {
+			resolution = fmt.Sprintf("\nFrame:    %dx%d (already %s)", crop.OutWidth, crop.OutHeight, aspectFlag)
+		}
+	}
+
+	clipReqs, err := parseClipNonInteractive(parser, clipDescription, videoInfo.Duration)
+	if err != nil {
+		return err
+	}
+	if clipReqs[0].Local {
+		printInfo(successStyle.Render("✓ Parsed without AI"))
+	} else {
+		printInfo(successStyle.Render("✓ AI parsing complete"))
+	}
+	multi := len(clipReqs) > 1
+	if multi {
+		printInfo(infoStyle.Render(fmt.Sprintf("The request describes %d clips", len(clipReqs))))
+	}
+
+	// Calculate clip durations, refusing empty or too-short clips before
+	// cutting any
+	minClip, err := video.MinClipDurationFromEnv()
+	if err != nil {
+		return err
+	}
+	clipDurations := make([]time.Duration, len(clipReqs))
+	for i, clipReq := range clipReqs {
+		err = clipReq.Validate(videoInfo.Duration)
+		if err == nil {
+			clipDurations[i], err = video.ValidateClipLength(clipReq.StartTime, clipReq.EndTime, minClip)
+		}
+		if err != nil {
+			if multi {
+				return fmt.Errorf("clip %d: %w", i+1, err)
+			}
+			return err
+		}
+		if clipReq.Warning != "" {
+			printInfo(infoStyle.Render("⚠️  " + clipReq.Warning))
+		}
+	}
+
+	dirMode, fileMode, err := fsmode.FromEnv()
+	if err != nil {
+		return err
+	}
+
+	// Ranges asked for in one file are joined rather than cut separately
+	if multi && !previewFlag && (concatFlag || ai.WantsOneFile(clipDescription)) {
+		switch {
+		case gifFlag, audioFormat != "":
+			return fmt.Errorf("only video clips can be joined into one file, not --gif or --audio-only clips")
+		case customOutput == video.StdoutPath:
+			return fmt.Errorf("joined clips can't stream to stdout; pass an output file or directory")
+		}
+		base := video.ClipParams{
+			SubtitlePath: subtitlesFlag,
+			AspectRatio:  aspectFlag,
+			SourceWidth:  videoInfo.Width,
+			SourceHeight: videoInfo.Height,
+			Encode:       encode,
+			FileMode:     fileMode,
+		}
+		return concatClipFile(videoPath, namingPath, customOutput, clipReqs, clipDurations, base, hwaccel, dirMode, resolution)
+	}
+
+	// Each clip gets its own generated name, so several need a directory
+	toStdout := customOutput == video.StdoutPath
+	if multi && toStdout {
+		return fmt.Errorf("the request describes %d clips, which can't all stream to stdout; pass an output directory", len(clipReqs))
+	}
+	if multi && customOutput != "" && !video.IsDirOutput(customOutput) {
+		return fmt.Errorf("the request describes %d clips; --output must be a directory (end it with /)", len(clipReqs))
+	}
+
+	for i, clipReq := range clipReqs {
+		clipDuration := clipDurations[i]
+
+		// Determine output path
+		outputPath := "stdout"
+		switch {
+		case toStdout:
+		case dryRunFlag && video.IsDirOutput(customOutput):
+			// A dry run leaves the output directory uncreated
+			generated := video.GenerateOutputPath(namingPath, clipReq.StartTime, clipReq.EndTime, ext)
+			outputPath = video.UniqueOutputPath(filepath.Join(customOutput, filepath.Base(generated)))
+		default:
+			outputPath, err = video.ResolveOutputPath(customOutput, namingPath, clipReq.StartTime, clipReq.EndTime, ext, dirMode)
+			if err != nil {
+				return err
+			}
+		}
+		if gifFlag {
+			if size := video.EstimateGIFSize(clipDuration, gifOpts); size > video.GIFSizeWarning {
+				printInfo(infoStyle.Render(fmt.Sprintf("⚠️  The GIF may be around %s; shorten the clip or lower --gif-width or --gif-fps for a smaller file", formatFileSize(size))))
+			}
+		}
+
+		// Show summary
+		title := "📋 Clip Summary"
+		if multi {
+			title = fmt.Sprintf("📋 Clip %d of %d", i+1, len(clipReqs))
+		}
+		summaryBox := boxStyle.Render(fmt.Sprintf(
+			"%s\n\n"+
+				"Input:    %s\n"+
+				"Start:    %s\n"+
+				"End:      %s\n"+
+				"Duration: %s%s\n"+
+				"Output:   %s",
+			title,
+			filepath.Base(namingPath),
+			clipReq.StartTime,
+			clipReq.EndTime,
+			video.FormatDuration(clipDuration),
+			resolution,
+			filepath.Base(outputPath),
+		))
+		printInfo(summaryBox)
+
+		if previewFlag {
+			if err := previewClip(videoPath, clipReq.StartTime, clipReq.EndTime, infoOut); err != nil {
+				return fmt.Errorf("preview failed: %w", err)
+			}
+			continue
+		}
+
+		// Execute clip, or just show how with --dry-run
+		params := video.ClipParams{
+			InputPath:    videoPath,
+			StartTime:    clipReq.StartTime,
+			EndTime:      clipReq.EndTime,
+			OutputPath:   outputPath,
+			SubtitlePath: subtitlesFlag,
+			AspectRatio:  aspectFlag,
+			AudioBitrate: audioBitrateFlag,
+			SourceWidth:  videoInfo.Width,
+			SourceHeight: videoInfo.Height,
+			Encode:       encode,
+			FileMode:     fileMode,
+		}
+		stdout := &countingWriter{w: os.Stdout}
+		if toStdout {
+			params.Output = stdout
+		}
+
+		// Only re-encoded clips use an encoder; plain cuts copy the streams
+		// and GIFs have their own
+		if (params.SubtitlePath != "" || params.AspectRatio != "") && !gifFlag {
+			params.Encode.HWAccel, err = video.ResolveHWAccel(hwaccel)
+			if err != nil {
+				printInfo(infoStyle.Render("⚠️  " + err.Error()))
+			}
+		}
+
+		if dryRunFlag {
+			if err := printDryRun(params, gifOpts, audioFormat); err != nil {
+				return err
+			}
+			continue
+		}
+
+		printInfo(infoStyle.Render("🦫 Clipping video..."))
+		clip := video.ClipVideo
+		switch {
+		case gifFlag:
+			clip = func(p video.ClipParams) error { return video.ClipToGIF(p, gifOpts) }
+		case audioFormat != "":
+			clip = func(p video.ClipParams) error { return video.ExtractAudio(p, audioFormat) }
+		}
+		if err := clip(params); err != nil {
+			if multi {
+				return fmt.Errorf("clipping video failed on clip %d: %w", i+1, err)
+			}
+			return fmt.Errorf("clipping video failed: %w", err)
+		}
+
+		if toStdout {
+			format := video.DefaultStreamFormat
+			switch {
+			case gifFlag:
+				format = "gif"
+			case audioFormat != "":
+				format = audioFormat
+			}
+			if autoTitleFlag {
+				printInfo(infoStyle.Render("⚠️  Auto-title skipped: the clip went to stdout"))
+			}
+			printInfo(successStyle.Render(boxStyle.Render(fmt.Sprintf(
+				"✅ Done!\n\n"+
+					"Streamed to stdout (%s)\n"+
+					"Size: %s",
+				format,
+				formatFileSize(stdout.n),
+			))))
+			return nil
+		}
+
+		finishClip(outputPath, customOutput, clipReq.StartTime, clipReq.EndTime, clipDuration)
+	}
+
+	if previewFlag {
+		printInfo(infoStyle.Render("Preview only, nothing was cut. Run again without --preview to cut this range."))
+	}
+	return nil
+}
+
+// finishClip names a cut clip after a suggested title with --auto-title,
+// then reports where it was saved
+func finishClip(outputPath, customOutput, startTime, endTime string, clipDuration time.Duration) {
+	// An explicit output file name always wins over a suggested title
+	if autoTitleFlag && outputPath != customOutput {
+		printInfo(infoStyle.Render("🏷  Suggesting a title..."))
+		titled, err := autoTitleClip(outputPath, startTime, endTime, clipDuration)
+		if err != nil {
+			printInfo(infoStyle.Render("⚠️  Auto-title skipped: " + err.Error()))
+		} else {
+			outputPath = titled
+		}
+	}
+
+	// Scripts just want the path
+	if verbosity == VerbosityQuiet {
+		fmt.Println(outputPath)
+		return
 	}
 
 	// Get output file info
@@ -1105,6 +2137,328 @@ func runNonInteractive(videoPath, clipDescription, customOutput string) {
 	fmt.Println(successStyle.Render(successBox))
 }
 
+// concatClipFile cuts the parsed ranges and joins them into one file, for
+// descriptions like "minutes 1-2 and 5-6 into one file" or with --concat.
+// base holds the settings every segment shares.
+func concatClipFile(videoPath, namingPath, customOutput string, clipReqs []*ai.ClipRequest, clipDurations []time.Duration, base video.ClipParams, hwaccel video.HWAccel, dirMode os.FileMode, resolution string) error {
+	first, last := clipReqs[0], clipReqs[len(clipReqs)-1]
+
+	var outputPath string
+	var err error
+	if dryRunFlag && video.IsDirOutput(customOutput) {
+		// A dry run leaves the output directory uncreated
+		generated := video.GenerateOutputPath(namingPath, first.StartTime, last.EndTime, "")
+		outputPath = video.UniqueOutputPath(filepath.Join(customOutput, filepath.Base(generated)))
+	} else {
+		outputPath, err = video.ResolveOutputPath(customOutput, namingPath, first.StartTime, last.EndTime, "", dirMode)
+		if err != nil {
+			return err
+		}
+	}
+
+	var total time.Duration
+	ranges := make([]string, len(clipReqs))
+	segments := make([]video.ClipParams, len(clipReqs))
+	for i, clipReq := range clipReqs {
+		total += clipDurations[i]
+		ranges[i] = clipReq.StartTime + "-" + clipReq.EndTime
+		segments[i] = base
+		segments[i].StartTime, segments[i].EndTime = clipReq.StartTime, clipReq.EndTime
+	}
+
+	printInfo(boxStyle.Render(fmt.Sprintf(
+		"📋 Joining %d clips\n\n"+
+			"Input:    %s\n"+
+			"Ranges:   %s\n"+
+			"Duration: %s%s\n"+
+			"Output:   %s",
+		len(clipReqs),
+		filepath.Base(namingPath),
+		strings.Join(ranges, ", "),
+		video.FormatDuration(total),
+		resolution,
+		filepath.Base(outputPath),
+	)))
+
+	// Segments whose streams don't line up are re-encoded when joined, so
+	// resolve the encoder even for plain cuts
+	encoder, err := video.ResolveHWAccel(hwaccel)
+	if err != nil {
+		printInfo(infoStyle.Render("⚠️  " + err.Error()))
+	}
+	for i := range segments {
+		segments[i].Encode.HWAccel = encoder
+	}
+
+	if dryRunFlag {
+		ext := filepath.Ext(outputPath)
+		for i, segment := range segments {
+			segment.InputPath = videoPath
+			segment.OutputPath = fmt.Sprintf("segment-%03d%s", i+1, ext)
+			args, err := video.BuildFFmpegArgs(segment)
+			if err != nil {
+				return err
+			}
+			fmt.Println(shellCommand("ffmpeg", args))
+		}
+		fmt.Println(shellCommand("ffmpeg", video.BuildConcatArgs("segments.txt", outputPath, nil)))
+		printInfo(infoStyle.Render("Note: segments.txt lists the segment files, one \"file 'segment-001" + ext + "'\" line each"))
+		return nil
+	}
+
+	printInfo(infoStyle.Render("🦫 Clipping and joining video..."))
+	if err := video.ConcatClips(videoPath, segments, outputPath); err != nil {
+		return fmt.Errorf("joining clips failed: %w", err)
+	}
+	finishClip(outputPath, customOutput, first.StartTime, last.EndTime, total)
+	return nil
+}
+
+// printDryRun prints the ffmpeg commands that would cut a clip, quoted for
+// a POSIX shell
+func printDryRun(params video.ClipParams, gifOpts video.GIFOptions, audioFormat string) error {
+	var commands [][]string
+	switch {
+	case gifFlag:
+		palettePass, renderPass, err := video.BuildGIFArgs(params, gifOpts)
+		if err != nil {
+			return err
+		}
+		commands = [][]string{palettePass, renderPass}
+	case audioFormat != "":
+		commands = [][]string{video.BuildAudioArgs(params, audioFormat)}
+	default:
+		args, err := video.BuildFFmpegArgs(params)
+		if err != nil {
+			return err
+		}
+		commands = [][]string{args}
+	}
+	for _, args := range commands {
+		fmt.Println(shellCommand("ffmpeg", args))
+	}
+	if params.SubtitlePath != "" && audioFormat == "" {
+		printInfo(infoStyle.Render("Note: a real run burns in a copy of the subtitles shifted to the clip start"))
+	}
+	return nil
+}
+
+// shellCommand joins a command line, quoting arguments a shell would split
+// or expand
+func shellCommand(name string, args []string) string {
+	quoted := []string{shellQuote(name)}
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellSafeRe matches arguments that need no quoting
+var shellSafeRe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote single-quotes s unless it is safe as is
+func shellQuote(s string) string {
+	if shellSafeRe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Env vars that stand in for --file and --prompt when capycut runs without
+// a terminal, e.g. from cron or a CI job that can't easily pass flags
+const (
+	FileEnvVar   = "CAPYCUT_FILE"
+	PromptEnvVar = "CAPYCUT_PROMPT"
+)
+
+// isTerminal reports whether f is attached to a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// interactiveTerminal reports whether the menus and TUI can run, which
+// needs a terminal on both stdin and stdout
+func interactiveTerminal() bool {
+	return isTerminal(os.Stdin) && isTerminal(os.Stdout)
+}
+
+// nonInteractiveHelp explains how to run capycut without a terminal; what
+// names the interactive feature that was asked for
+func nonInteractiveHelp(what string) string {
+	return fmt.Sprintf(`%s needs an interactive terminal, but stdin or stdout isn't one
+(running from CI, cron or another program?). Run capycut with flags instead:
+
+  capycut -f video.mp4 -p "first 30 seconds" [-o clip.mp4]
+  capycut transcribe ./scans -o ./output
+
+Or set %s and %s to clip without flags.`, what, FileEnvVar, PromptEnvVar)
+}
+
+// requireTerminal exits with nonInteractiveHelp when there is no terminal
+// for the menus, which would otherwise fail or wait for input forever
+func requireTerminal(what string) {
+	if interactiveTerminal() {
+		return
+	}
+	fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+nonInteractiveHelp(what)))
+	os.Exit(1)
+}
+
+// StdinMaxSizeEnvVar overrides video.DefaultStdinMaxSize, e.g. "512M"
+const StdinMaxSizeEnvVar = "CAPYCUT_STDIN_MAX_SIZE"
+
+// checkStdoutOutput refuses -o - where it can't work: without a video to
+// clip non-interactively, or with a terminal that would show raw video
+func checkStdoutOutput(file, prompt string) error {
+	if file == "" || prompt == "" {
+		return fmt.Errorf("--output - needs --file and --prompt")
+	}
+	if isTerminal(os.Stdout) {
+		return fmt.Errorf("--output - writes the video to stdout; pipe it into another command or pass a file name")
+	}
+	return nil
+}
+
+// countingWriter counts the bytes of a clip streamed to stdout, which has
+// no file to stat afterwards
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// clipCleanup removes the buffered copy of a piped video; exitClip runs it
+// because os.Exit skips deferred calls
+var clipCleanup = func() {}
+
+// exitClip exits after removing any buffered stdin video
+func exitClip(code int) {
+	clipCleanup()
+	os.Exit(code)
+}
+
+// bufferStdinVideo copies a piped video to a temp file for ffprobe and
+// ffmpeg, which both need seekable input, and sets clipCleanup to remove it
+func bufferStdinVideo() (string, error) {
+	if isTerminal(os.Stdin) {
+		return "", fmt.Errorf("--file - reads the video from stdin, but nothing is piped in")
+	}
+
+	maxSize := int64(video.DefaultStdinMaxSize)
+	if v := os.Getenv(StdinMaxSizeEnvVar); v != "" {
+		n, err := gemini.ParseByteSize(v)
+		if err != nil || n <= 0 {
+			return "", fmt.Errorf("invalid %s %q: expected a size like 512M or 8G", StdinMaxSizeEnvVar, v)
+		}
+		maxSize = n
+	}
+
+	printInfo(infoStyle.Render("Buffering video from stdin..."))
+	path, cleanup, err := video.BufferStdin(os.Stdin, maxSize)
+	if err != nil {
+		return "", err
+	}
+	clipCleanup = cleanup
+	return path, nil
+}
+
+// autoTitleFrames is how many frames are sampled for --auto-title
+const autoTitleFrames = 3
+
+// autoTitleClip asks the vision provider for a title describing the finished
+// clip and renames it to "<title>_clip_<start>_to_<end><ext>" in the same
+// directory. It returns the new path; on any error the clip is left as-is.
+func autoTitleClip(clipPath, startTime, endTime string, clipDuration time.Duration) (string, error) {
+	client, err := gemini.NewClientFromEnv()
+	if err != nil {
+		return "", fmt.Errorf("vision provider not configured: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "capycut-frames-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	frames, err := video.ExtractFrames(clipPath, clipDuration, autoTitleFrames, tmpDir)
+	if err != nil {
+		return "", fmt.Errorf("could not extract frames: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	title, err := client.SuggestTitle(ctx, frames)
+	if err != nil {
+		return "", err
+	}
+
+	named := filepath.Join(filepath.Dir(clipPath), gemini.SanitizeFilename(title)+filepath.Ext(clipPath))
+	newPath := video.UniqueOutputPath(video.GenerateOutputPath(named, startTime, endTime, ""))
+	if err := os.Rename(clipPath, newPath); err != nil {
+		return "", fmt.Errorf("could not rename clip: %w", err)
+	}
+	return newPath, nil
+}
+
+// previewFrames is how many frames --preview describes
+const previewFrames = 3
+
+// previewClip describes previewFrames frames spread across the clip range
+// with the vision provider and prints one line per frame, so the range a
+// vague prompt produced can be judged before anything is cut
+func previewClip(videoPath, startTime, endTime string, out io.Writer) error {
+	start, err := video.ParseTimestamp(startTime)
+	if err != nil {
+		return err
+	}
+	end, err := video.ParseTimestamp(endTime)
+	if err != nil {
+		return err
+	}
+
+	client, err := gemini.NewClientFromEnv()
+	if err != nil {
+		return fmt.Errorf("vision provider not configured: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "capycut-frames-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	times := video.FrameTimes(start, end, previewFrames)
+	frames, err := video.ExtractFramesAt(videoPath, times, tmpDir)
+	if err != nil {
+		return fmt.Errorf("could not extract frames: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	fmt.Fprintln(out, infoStyle.Render(fmt.Sprintf("🔎 Frames from the proposed range (%s):", client.GetProvider())))
+	for i, frame := range frames {
+		description, err := client.DescribeFrame(ctx, frame)
+		if err != nil {
+			description = "(no description: " + err.Error() + ")"
+		}
+		fmt.Fprintln(out, formatPreviewLine(times[i], description))
+	}
+	return nil
+}
+
+// formatPreviewLine formats one --preview line, e.g. "  00:01:05  A man walks on stage"
+func formatPreviewLine(at time.Duration, description string) string {
+	return fmt.Sprintf("  %s  %s", video.FormatTimestamp(at.Truncate(time.Second)), description)
+}
+
 func runClipWorkflow() bool {
 	// Use the new TUI by default, unless user explicitly wants the legacy UI
 	if os.Getenv("CAPYCUT_LEGACY_UI") != "1" {
@@ -1137,10 +2491,12 @@ func runClipWorkflowNew() bool {
 
 	if err != nil {
 		if err == huh.ErrUserAborted {
-			return false
+			return true // Back out to the main menu
 		}
+		// A picker that fails (an unreadable directory, say) is no reason
+		// to quit; show why and go back to the menu
 		fmt.Println(errorStyle.Render("Error: " + err.Error()))
-		return false
+		return true
 	}
 
 	// Step 2: Run the new TUI with AI transparency
@@ -1176,10 +2532,12 @@ func runClipWorkflowLegacy() bool {
 
 	if err != nil {
 		if err == huh.ErrUserAborted {
-			return false
+			return true // Back out to the main menu
 		}
+		// A picker that fails (an unreadable directory, say) is no reason
+		// to quit; show why and go back to the menu
 		fmt.Println(errorStyle.Render("Error: " + err.Error()))
-		return false
+		return true
 	}
 
 	// Get video info
@@ -1245,33 +2603,6 @@ func runClipWorkflowLegacy() bool {
 		selectedProvider = ai.Provider(providerChoice)
 	}
 
-	// Step 3: Get clip description
-	var clipDescription string
-	descInput := huh.NewText().
-		Title("🤖 What would you like to clip?").
-		Description("Describe in natural language, e.g.:\n• \"from 3 minutes to 5 minutes 30 seconds\"\n• \"first 2 minutes\"\n• \"start at 1:23, end at 4:56\"\n• \"last 45 seconds\"").
-		Placeholder("Type your clip description here...").
-		CharLimit(500).
-		Value(&clipDescription)
-
-	err = huh.NewForm(huh.NewGroup(descInput)).
-		WithTheme(huh.ThemeCatppuccin()).
-		Run()
-
-	if err != nil {
-		if err == huh.ErrUserAborted {
-			return askToContinue()
-		}
-		fmt.Println(errorStyle.Render("Error: " + err.Error()))
-		return askToContinue()
-	}
-
-	// Step 4: Parse with AI - show detailed progress
-	var clipReq *ai.ClipRequest
-	var parseErr error
-	var aiProvider string
-	var aiModel string
-
 	// Create the parser with the selected provider
 	parser, err := ai.NewParserWithProvider(selectedProvider)
 	if err != nil {
@@ -1279,95 +2610,174 @@ func runClipWorkflowLegacy() bool {
 		return askToContinue()
 	}
 
-	aiProvider = parser.GetProviderDisplayName()
-	aiModel = parser.GetModel()
-
-	// Show AI status box
-	aiStatusBox := boxStyle.Render(fmt.Sprintf(
-		"🤖 AI Agent: %s\n"+
-			"   Model: %s\n"+
-			"   Status: Initializing...",
-		aiProvider,
-		aiModel,
-	))
-	fmt.Println(aiStatusBox)
-
-	err = spinner.New().
-		Title("🦫 Chomp chomp... understanding your request...").
-		Action(func() {
-			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-			defer cancel()
+	// Steps 3 and 4: get the clip description and parse it with AI. A parse
+	// cancelled with Ctrl+C comes back to the description, which is kept.
+	var clipDescription string
+	var clipReqs []*ai.ClipRequest
+	for {
+		descInput := huh.NewText().
+			Title("🤖 What would you like to clip?").
+			Description("Describe in natural language, e.g.:\n• \"from 3 minutes to 5 minutes 30 seconds\"\n• \"first 2 minutes\"\n• \"start at 1:23, end at 4:56\"\n• \"last 45 seconds\"").
+			Placeholder("Type your clip description here...").
+			CharLimit(500).
+			Value(&clipDescription)
+
+		err = huh.NewForm(huh.NewGroup(descInput)).
+			WithTheme(huh.ThemeCatppuccin()).
+			Run()
 
-			// Progress callback to update status
-			onProgress := func(update ai.ParserProgressUpdate) {
-				// In a real TUI we'd update the display, but spinner doesn't support dynamic updates
-				// The status is shown in debug mode or can be logged
-				if os.Getenv("CAPYCUT_DEBUG") != "" {
-					fmt.Printf("\n[AI Status] %s: %s - %s\n", update.Provider, update.Status.String(), update.Message)
-				}
+		if err != nil {
+			if err == huh.ErrUserAborted {
+				return askToContinue()
 			}
+			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			return askToContinue()
+		}
 
-			clipReq, parseErr = parser.ParseClipRequestWithProgress(ctx, clipDescription, videoInfo.Duration, onProgress)
-		}).
-		Run()
-
-	if err != nil || parseErr != nil {
-		if parseErr != nil {
-			fmt.Println(errorStyle.Render("Error: " + parseErr.Error()))
-		} else {
+		// Show AI status box
+		aiStatusBox := boxStyle.Render(fmt.Sprintf(
+			"🤖 AI Agent: %s\n"+
+				"   Model: %s\n"+
+				"   Status: Initializing...",
+			parser.GetProviderDisplayName(),
+			parser.GetModel(),
+		))
+		fmt.Println(aiStatusBox)
+
+		var cancelled bool
+		clipReqs, cancelled, err = parseWithSpinner(parser, clipDescription, videoInfo.Duration)
+		if cancelled {
+			fmt.Println(infoStyle.Render("Parsing cancelled. Edit the description to try again."))
+			continue
+		}
+		if err != nil {
 			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			if hint := ai.ErrorGuidance(err); hint != "" {
+				fmt.Println(infoStyle.Render(hint))
+			}
+			return askToContinue()
 		}
-		return askToContinue()
+		break
 	}
 
 	// Show AI completion
 	fmt.Println(successStyle.Render("✓ AI parsing complete"))
 
-	// Calculate clip duration
-	clipDuration, err := video.CalculateClipDuration(clipReq.StartTime, clipReq.EndTime)
+	if len(clipReqs) > 1 {
+		fmt.Println(infoStyle.Render(fmt.Sprintf("The request describes %d clips", len(clipReqs))))
+	}
+
+	// Calculate clip durations, refusing empty or too-short clips before
+	// cutting any
+	minClip, err := video.MinClipDurationFromEnv()
 	if err != nil {
-		fmt.Println(errorStyle.Render("Error calculating duration: " + err.Error()))
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return askToContinue()
+	}
+	clipDurations := make([]time.Duration, len(clipReqs))
+	for i, clipReq := range clipReqs {
+		err = clipReq.Validate(videoInfo.Duration)
+		if err == nil {
+			clipDurations[i], err = video.ValidateClipLength(clipReq.StartTime, clipReq.EndTime, minClip)
+		}
+		if err != nil {
+			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			return askToContinue()
+		}
+		if clipReq.Warning != "" {
+			fmt.Println(infoStyle.Render("⚠️  " + clipReq.Warning))
+		}
+	}
+	_, fileMode, err := fsmode.FromEnv()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
 		return askToContinue()
 	}
 
-	// Generate output path
-	outputPath := video.GenerateOutputPath(videoPath, clipReq.StartTime, clipReq.EndTime)
+	// Steps 4 and 5 run for each clip; declining one moves on to the next,
+	// while aborting the form or a failed cut skips the rest
+	for i, clipReq := range clipReqs {
+		title := "📋 Clip Summary"
+		if len(clipReqs) > 1 {
+			title = fmt.Sprintf("📋 Clip %d of %d", i+1, len(clipReqs))
+		}
+		if !confirmAndCutClip(videoPath, videoInfo.Duration, clipReq, clipDurations[i], minClip, fileMode, title) {
+			break
+		}
+	}
 
-	// Step 4: Confirm
-	summaryBox := boxStyle.Render(fmt.Sprintf(
-		"📋 Clip Summary\n\n"+
-			"Input:    %s\n"+
-			"Start:    %s\n"+
-			"End:      %s\n"+
-			"Duration: %s\n"+
-			"Output:   %s",
-		filepath.Base(videoPath),
-		clipReq.StartTime,
-		clipReq.EndTime,
-		video.FormatDuration(clipDuration),
-		filepath.Base(outputPath),
-	))
-	fmt.Println(summaryBox)
+	return askToContinue()
+}
 
-	var proceed bool
-	confirmSelect := huh.NewConfirm().
-		Title("Proceed with this clip?").
-		Affirmative("Yes, cut it!").
-		Negative("No, cancel").
-		Value(&proceed)
+// confirmAndCutClip shows one parsed clip, lets the user adjust or preview
+// it, and cuts it. It reports false when the form was aborted or the cut
+// failed, so no more clips should be offered; a declined clip is true.
+func confirmAndCutClip(videoPath string, videoDuration time.Duration, clipReq *ai.ClipRequest, clipDuration, minClip time.Duration, fileMode os.FileMode, title string) bool {
+	// Step 4: Confirm, optionally nudging the times first
+	var outputPath string
+	for {
+		// Generate output path
+		outputPath = video.UniqueOutputPath(video.GenerateOutputPath(videoPath, clipReq.StartTime, clipReq.EndTime, ""))
+
+		summaryBox := boxStyle.Render(fmt.Sprintf(
+			"%s\n\n"+
+				"Input:    %s\n"+
+				"Start:    %s\n"+
+				"End:      %s\n"+
+				"Duration: %s\n"+
+				"Output:   %s",
+			title,
+			filepath.Base(videoPath),
+			clipReq.StartTime,
+			clipReq.EndTime,
+			video.FormatDuration(clipDuration),
+			filepath.Base(outputPath),
+		))
+		fmt.Println(summaryBox)
+
+		choice := "yes"
+		confirmSelect := huh.NewSelect[string]().
+			Title("Proceed with this clip?").
+			Options(
+				huh.NewOption("Yes, cut it!", "yes"),
+				huh.NewOption("Edit times", "edit"),
+				huh.NewOption("Preview frames (vision API calls)", "preview"),
+				huh.NewOption("No, cancel", "no"),
+			).
+			Value(&choice)
 
-	err = huh.NewForm(huh.NewGroup(confirmSelect)).
-		WithTheme(huh.ThemeCatppuccin()).
-		Run()
+		err := huh.NewForm(huh.NewGroup(confirmSelect)).
+			WithTheme(huh.ThemeCatppuccin()).
+			Run()
 
-	if err != nil || !proceed {
-		fmt.Println(infoStyle.Render("Clip cancelled."))
-		return askToContinue()
+		if err != nil {
+			fmt.Println(infoStyle.Render("Clip cancelled."))
+			return false
+		}
+		if choice == "no" {
+			fmt.Println(infoStyle.Render("Clip skipped."))
+			return true
+		}
+		if choice == "yes" {
+			break
+		}
+		if choice == "preview" {
+			if err := previewClip(videoPath, clipReq.StartTime, clipReq.EndTime, os.Stdout); err != nil {
+				fmt.Println(errorStyle.Render("Error: preview failed: " + err.Error()))
+			}
+			continue
+		}
+
+		start, end, ok := editClipTimes(clipReq.StartTime, clipReq.EndTime, videoDuration, minClip)
+		if ok {
+			clipReq.StartTime, clipReq.EndTime = start, end
+			clipDuration, _ = video.CalculateClipDuration(start, end)
+		}
 	}
 
 	// Step 5: Execute clip
 	var clipErr error
-	err = spinner.New().
+	err := spinner.New().
 		Title("🦫 Chomp chomp... clipping video...").
 		Action(func() {
 			params := video.ClipParams{
@@ -1375,6 +2785,7 @@ func runClipWorkflowLegacy() bool {
 				StartTime:  clipReq.StartTime,
 				EndTime:    clipReq.EndTime,
 				OutputPath: outputPath,
+				FileMode:   fileMode,
 			}
 			clipErr = video.ClipVideo(params)
 		}).
@@ -1386,7 +2797,7 @@ func runClipWorkflowLegacy() bool {
 		} else {
 			fmt.Println(errorStyle.Render("Error: " + err.Error()))
 		}
-		return askToContinue()
+		return false
 	}
 
 	// Get output file info
@@ -1406,7 +2817,61 @@ func runClipWorkflowLegacy() bool {
 	))
 	fmt.Println(successStyle.Render(successBox))
 
-	return askToContinue()
+	offerThumbnail(outputPath, fileMode)
+	return true
+}
+
+// offerThumbnail asks whether to save the frame at the middle of a
+// finished clip next to it, and saves it when confirmed
+func offerThumbnail(clipPath string, fileMode os.FileMode) {
+	var save bool
+	err := huh.NewForm(huh.NewGroup(huh.NewConfirm().
+		Title("Save a thumbnail of the clip too?").
+		Affirmative("Yes").
+		Negative("No").
+		Value(&save))).
+		WithTheme(huh.ThemeCatppuccin()).
+		Run()
+	if err != nil || !save {
+		return
+	}
+
+	thumbPath := video.UniqueOutputPath(video.ThumbnailPath(clipPath))
+	opts := video.ThumbOptions{Width: video.DefaultThumbWidth, FileMode: fileMode}
+	if err := video.GenerateThumbnail(clipPath, video.ThumbnailMidpoint, thumbPath, opts); err != nil {
+		fmt.Println(errorStyle.Render("Error saving thumbnail: " + err.Error()))
+		return
+	}
+	fmt.Println(successStyle.Render("✓ Thumbnail saved to " + thumbPath))
+}
+
+// editClipTimes lets the user adjust a parsed start and end before cutting.
+// It reports false when the edit is abandoned, keeping the original times.
+func editClipTimes(startTime, endTime string, videoDuration, minClip time.Duration) (string, string, bool) {
+	start, end := startTime, endTime
+	form := huh.NewForm(huh.NewGroup(
+		huh.NewInput().
+			Title("Start").
+			Description("HH:MM:SS, MM:SS or seconds, with optional .mmm").
+			Value(&start),
+		huh.NewInput().
+			Title("End").
+			Value(&end).
+			Validate(func(string) error {
+				_, _, err := video.ParseClipRange(start, end, videoDuration, minClip)
+				return err
+			}),
+	)).WithTheme(huh.ThemeCatppuccin())
+
+	if err := form.Run(); err != nil {
+		return startTime, endTime, false
+	}
+	start, end, err := video.ParseClipRange(start, end, videoDuration, minClip)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return startTime, endTime, false
+	}
+	return start, end, true
 }
 
 func askToContinue() bool {
@@ -1,10 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
+
+	"capycut/ai"
+	"capycut/gemini"
 )
 
 func TestGenerateEnvExports_LocalBashZsh(t *testing.T) {
@@ -67,6 +75,50 @@ func TestGenerateEnvExports_AzureWithoutAPIVersion(t *testing.T) {
 	}
 }
 
+func TestGenerateEnvExports_OpenAI(t *testing.T) {
+	result := generateEnvExports("openai", "", "sk-test", "gpt-4o-mini", "", ShellBashZsh)
+
+	if !strings.Contains(result, "export LLM_PROVIDER=openai") {
+		t.Error("Expected 'export LLM_PROVIDER=openai' in output")
+	}
+	if !strings.Contains(result, "export OPENAI_API_KEY=sk-test") {
+		t.Error("Expected OpenAI API key in output")
+	}
+	if !strings.Contains(result, "export OPENAI_MODEL=gpt-4o-mini") {
+		t.Error("Expected OpenAI model in output")
+	}
+	if strings.Contains(result, "OPENAI_BASE_URL") || strings.Contains(result, "AZURE_") {
+		t.Error("Should not contain OPENAI_BASE_URL when empty, or Azure settings")
+	}
+
+	result = generateDotEnv("openai", "https://gateway.example.com", "sk-test", "gpt-4o", "")
+	if !strings.Contains(result, "OPENAI_BASE_URL=https://gateway.example.com") {
+		t.Error("Expected OpenAI base URL in .env output")
+	}
+}
+
+func TestGenerateEnvExports_Anthropic(t *testing.T) {
+	result := generateEnvExports("anthropic", "", "sk-ant-test", "claude-sonnet-4-20250514", "", ShellBashZsh)
+
+	if !strings.Contains(result, "export LLM_PROVIDER=anthropic") {
+		t.Error("Expected 'export LLM_PROVIDER=anthropic' in output")
+	}
+	if !strings.Contains(result, "export ANTHROPIC_API_KEY=sk-ant-test") {
+		t.Error("Expected Anthropic API key in output")
+	}
+	if !strings.Contains(result, "export ANTHROPIC_MODEL=claude-sonnet-4-20250514") {
+		t.Error("Expected Anthropic model in output")
+	}
+	if strings.Contains(result, "ANTHROPIC_BASE_URL") || strings.Contains(result, "AZURE_") {
+		t.Error("Should not contain ANTHROPIC_BASE_URL when empty, or Azure settings")
+	}
+
+	result = generateDotEnv("anthropic", "https://gateway.example.com", "sk-ant-test", "claude-sonnet-4-20250514", "")
+	if !strings.Contains(result, "LLM_PROVIDER=anthropic") || !strings.Contains(result, "ANTHROPIC_BASE_URL=https://gateway.example.com") {
+		t.Error("Expected Anthropic provider and base URL in .env output")
+	}
+}
+
 func TestGenerateEnvExports_Fish(t *testing.T) {
 	result := generateEnvExports("local", "http://localhost:11434", "", "llama3", "", ShellFish)
 
@@ -574,6 +626,30 @@ func TestGetShellType_DotEnv(t *testing.T) {
 	}
 }
 
+func TestGetShellType_YAML(t *testing.T) {
+	for _, path := range []string{"/home/user/.config/capycut/config.yaml", "capycut.yaml", "C:\\Users\\test\\.config\\capycut\\config.YML"} {
+		if got := getShellType(path); got != ShellYAML {
+			t.Errorf("getShellType(%q) = %v, want ShellYAML", path, got)
+		}
+	}
+}
+
+func TestDetectShell_ConfigFile(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join("xdg", "config"))
+	_, profiles := detectShell()
+
+	want := filepath.Join("xdg", "config", "capycut", "config.yaml")
+	for _, p := range profiles {
+		if p.path == want {
+			if getShellType(p.path) != ShellYAML {
+				t.Errorf("config file profile %q is not ShellYAML", p.path)
+			}
+			return
+		}
+	}
+	t.Errorf("no profile for %s in %+v", want, profiles)
+}
+
 func TestGetShellType_BashZsh(t *testing.T) {
 	tests := []struct {
 		path     string
@@ -770,3 +846,762 @@ func TestGetShellType_WindowsPaths(t *testing.T) {
 		}
 	}
 }
+
+func TestResolveVerbosity(t *testing.T) {
+	tests := []struct {
+		name                  string
+		quiet, verbose, debug bool
+		want                  Verbosity
+		wantErr               bool
+	}{
+		{"default", false, false, false, VerbosityNormal, false},
+		{"quiet", true, false, false, VerbosityQuiet, false},
+		{"verbose", false, true, false, VerbosityVerbose, false},
+		{"debug", false, false, true, VerbosityDebug, false},
+		{"debug implies verbose", false, true, true, VerbosityDebug, false},
+		{"quiet with verbose", true, true, false, VerbosityNormal, true},
+		{"quiet with debug", true, false, true, VerbosityNormal, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveVerbosity(tt.quiet, tt.verbose, tt.debug)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveVerbosity() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveVerbosity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintVerboseTransparency(t *testing.T) {
+	origLevel, origOut := verbosity, verboseOut
+	defer func() { verbosity, verboseOut = origLevel, origOut }()
+
+	var buf bytes.Buffer
+	verboseOut = &buf
+
+	req := &ai.ParserRequestInfo{
+		Endpoint:   "http://localhost:1234/v1/chat/completions",
+		Method:     "POST",
+		UserInput:  "first minute",
+		Parameters: map[string]string{"model": "test", "temperature": "0.1"},
+	}
+	resp := &ai.ParserResponseInfo{
+		StatusCode:   200,
+		StatusText:   "200 OK",
+		Latency:      1500 * time.Millisecond,
+		ParsedResult: &ai.ClipRequest{StartTime: "00:00:00", EndTime: "00:01:00"},
+	}
+
+	verbosity = VerbosityNormal
+	printVerboseRequest(req)
+	printVerboseResponse(resp)
+	if buf.Len() != 0 {
+		t.Errorf("expected no verbose output at normal level, got %q", buf.String())
+	}
+
+	verbosity = VerbosityVerbose
+	printVerboseRequest(req)
+	printVerboseResponse(resp)
+	out := buf.String()
+	for _, want := range []string{
+		"[request] POST http://localhost:1234/v1/chat/completions",
+		`[request] input: "first minute"`,
+		"[request] model=test",
+		"[response] status: 200 200 OK (1.50s)",
+		"[response] parsed: start=00:00:00 end=00:01:00",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("verbose output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestPrintVersionJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := printVersionJSON(&buf); err != nil {
+		t.Fatalf("printVersionJSON() error = %v", err)
+	}
+
+	var got map[string]string
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, buf.String())
+	}
+	for _, key := range []string{"version", "commit", "date", "go", "os", "arch"} {
+		if got[key] == "" {
+			t.Errorf("%q is missing from %s", key, buf.String())
+		}
+	}
+	if got["version"] != version || got["os"] != runtime.GOOS {
+		t.Errorf("printVersionJSON() = %v", got)
+	}
+}
+
+func TestFormatReleaseNotes(t *testing.T) {
+	const url = "https://github.com/harmonyvt/capycut/releases/tag/v1.2.0"
+
+	got := formatReleaseNotes("## Changes\r\n- Faster clips\r\n", url)
+	if !strings.Contains(got, "## Changes\n- Faster clips") || !strings.Contains(got, "Release page: "+url) {
+		t.Errorf("short notes = %q", got)
+	}
+	if strings.Contains(got, "...") {
+		t.Errorf("short notes were truncated: %q", got)
+	}
+
+	if got := formatReleaseNotes("  \n", url); !strings.Contains(got, "No release notes") || !strings.Contains(got, url) {
+		t.Errorf("empty notes = %q", got)
+	}
+
+	long := strings.Repeat("- a change\n", maxReleaseNoteLines+10)
+	got = formatReleaseNotes(long, url)
+	if n := strings.Count(got, "- a change"); n != maxReleaseNoteLines {
+		t.Errorf("kept %d lines, want %d", n, maxReleaseNoteLines)
+	}
+	if !strings.Contains(got, "...") || !strings.Contains(got, "Full release notes: "+url) {
+		t.Errorf("long notes = %q, want a truncation marker and link", got)
+	}
+
+	wide := strings.Repeat("é", maxReleaseNoteChars)
+	got = formatReleaseNotes(wide, url)
+	body, _, _ := strings.Cut(got, "\n")
+	if len(body) > maxReleaseNoteChars || !utf8.ValidString(body) {
+		t.Errorf("wide notes cut to %d bytes (valid UTF-8: %v)", len(body), utf8.ValidString(body))
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("CAPYCUT_TEST_DIR", "/data/clips")
+	os.Unsetenv("CAPYCUT_TEST_UNSET")
+
+	// A file whose name really contains "$" must not be expanded again
+	literal := filepath.Join(t.TempDir(), "price$CAPYCUT_TEST_DIR.mp4")
+	if err := os.WriteFile(literal, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "empty", in: "", want: ""},
+		{name: "stdio", in: "-", want: "-"},
+		{name: "plain", in: "clips/out.mp4", want: "clips/out.mp4"},
+		{name: "dollar var", in: "$CAPYCUT_TEST_DIR/out.mp4", want: "/data/clips/out.mp4"},
+		{name: "braced var", in: "${CAPYCUT_TEST_DIR}_old/out.mp4", want: "/data/clips_old/out.mp4"},
+		{name: "unset var stays literal", in: "$CAPYCUT_TEST_UNSET/out.mp4", want: "$CAPYCUT_TEST_UNSET/out.mp4"},
+		{name: "lone dollar", in: "cost$.mp4", want: "cost$.mp4"},
+		{name: "home", in: "~", want: home},
+		{name: "home subdir", in: "~/clips/out.mp4", want: filepath.Join(home, "clips/out.mp4")},
+		{name: "other user", in: "~bob/clips", want: "~bob/clips"},
+		{name: "tilde inside", in: "clips/~draft.mp4", want: "clips/~draft.mp4"},
+		{name: "existing file kept", in: literal, want: literal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expandPath(tt.in); got != tt.want {
+				t.Errorf("expandPath(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "out.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if isTerminal(f) {
+		t.Error("isTerminal() = true for a regular file")
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if isTerminal(r) || isTerminal(w) {
+		t.Error("isTerminal() = true for a pipe")
+	}
+}
+
+func TestNonInteractiveHelp(t *testing.T) {
+	help := nonInteractiveHelp("The setup wizard")
+	for _, want := range []string{"The setup wizard needs an interactive terminal", "capycut -f", "capycut transcribe", FileEnvVar, PromptEnvVar} {
+		if !strings.Contains(help, want) {
+			t.Errorf("help missing %q:\n%s", want, help)
+		}
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	args := []string{"-i", "My Video.mp4", "-vf", "scale=w='min(480,iw)'", "it's.mp4", "out/clip_00-01-00.mp4"}
+	want := `ffmpeg -i 'My Video.mp4' -vf 'scale=w='\''min(480,iw)'\''' 'it'\''s.mp4' out/clip_00-01-00.mp4`
+	if got := shellCommand("ffmpeg", args); got != want {
+		t.Errorf("shellCommand() = %s\nwant             %s", got, want)
+	}
+	if got := shellQuote(""); got != "''" {
+		t.Errorf(`shellQuote("") = %s, want ''`, got)
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := parseConfig([]byte(`
+# comments are fine
+provider: openai
+openai_api_key: "sk-test"
+ai_timeout: 90s
+dir_mode: 0750
+gemini_concurrency: 4
+insecure: true
+debug: false
+openai_base_url:
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := cfg.Settings
+	want := map[string]string{
+		"LLM_PROVIDER":       "openai",
+		"OPENAI_API_KEY":     "sk-test",
+		"AI_TIMEOUT":         "90s",
+		"CAPYCUT_DIR_MODE":   "0750",
+		"GEMINI_CONCURRENCY": "4",
+		"CAPYCUT_INSECURE":   "1",
+		"CAPYCUT_DEBUG":      "",
+		"OPENAI_BASE_URL":    "",
+	}
+	if len(values) != len(want) {
+		t.Errorf("parseConfig() = %v, want %v", values, want)
+	}
+	for env, value := range want {
+		if got, ok := values[env]; !ok || got != value {
+			t.Errorf("%s = %q (set %v), want %q", env, got, ok, value)
+		}
+	}
+
+	for _, bad := range []string{"provder: openai\n", "provider:\n  - openai\n", "- provider\n"} {
+		if _, err := parseConfig([]byte(bad)); err == nil {
+			t.Errorf("parseConfig(%q) = nil error", bad)
+		}
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "capycut.yaml")
+	user := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(project, []byte("llm_model: project-model\ninsecure: false\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(user, []byte("llm_model: user-model\nllm_endpoint: http://user:1234\nllm_api_key: from-file\ninsecure: true\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, env := range []string{"LLM_MODEL", "LLM_ENDPOINT", "CAPYCUT_INSECURE"} {
+		t.Setenv(env, "")
+		os.Unsetenv(env)
+	}
+	t.Setenv("LLM_API_KEY", "from-env")
+	envSources = map[string]string{}
+
+	if err := applyConfig([]string{project, filepath.Join(dir, "missing.yaml"), user}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := os.Getenv("LLM_MODEL"); got != "project-model" {
+		t.Errorf("LLM_MODEL = %q, want the project file's value", got)
+	}
+	if got := os.Getenv("LLM_ENDPOINT"); got != "http://user:1234" {
+		t.Errorf("LLM_ENDPOINT = %q, want the user file's value", got)
+	}
+	if got := os.Getenv("LLM_API_KEY"); got != "from-env" {
+		t.Errorf("LLM_API_KEY = %q, want the environment to win", got)
+	}
+	if _, ok := os.LookupEnv("CAPYCUT_INSECURE"); ok {
+		t.Error("CAPYCUT_INSECURE set although the project file turns it off")
+	}
+	if envSources["LLM_MODEL"] != project || envSources["LLM_ENDPOINT"] != user || envSources["LLM_API_KEY"] != "" {
+		t.Errorf("envSources = %v", envSources)
+	}
+
+	if err := os.WriteFile(user, []byte("llm_modle: typo\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfig([]string{user}, ""); err == nil || !strings.Contains(err.Error(), user) {
+		t.Errorf("applyConfig() error = %v, want one naming %s", err, user)
+	}
+}
+
+func TestApplyConfig_Provider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config := `provider: openai
+openai_api_key: sk-test
+azure_openai_endpoint: https://test.openai.azure.com
+azure_openai_api_key: azure-key
+azure_openai_model: gpt-4o
+gemini_api_key: gm-test
+`
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, env := range []string{
+		"LLM_PROVIDER", "LLM_ENDPOINT", "IMAGE_LLM_ENDPOINT", "AZURE_ANTHROPIC_ENDPOINT", "ANTHROPIC_API_KEY",
+		"OPENAI_API_KEY", "OPENAI_BASE_URL", "AZURE_OPENAI_ENDPOINT", "AZURE_OPENAI_API_KEY", "AZURE_OPENAI_MODEL",
+		"GEMINI_API_KEY", "GOOGLE_API_KEY", "CAPYCUT_PROVIDER_FALLBACK",
+	} {
+		t.Setenv(env, "")
+		os.Unsetenv(env)
+	}
+	envSources = map[string]string{}
+
+	if err := applyConfig([]string{path}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// The provider key wins over Azure OpenAI, which is otherwise detected first
+	parser, err := ai.NewParser()
+	if err != nil {
+		t.Fatalf("ai.NewParser() unexpected error: %v", err)
+	}
+	if parser.GetProvider() != ai.ProviderOpenAI {
+		t.Errorf("ai.NewParser() provider = %s, want openai from the config file", parser.GetProvider())
+	}
+
+	// OpenAI can't transcribe, so transcription still detects Gemini
+	client, err := gemini.NewClientFromEnv()
+	if err != nil {
+		t.Fatalf("gemini.NewClientFromEnv() unexpected error: %v", err)
+	}
+	if client.GetProvider() != gemini.ProviderGemini {
+		t.Errorf("gemini.NewClientFromEnv() provider = %s, want gemini", client.GetProvider())
+	}
+}
+
+func TestGenerateConfigYAML(t *testing.T) {
+	content, err := generateConfigYAML("azure", "https://test.openai.azure.com", "secret: key", "gpt-4o", "2024-02-15", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(content, "# CapyCut configuration\n") {
+		t.Errorf("missing header comment:\n%s", content)
+	}
+
+	cfg, err := parseConfig([]byte(content))
+	if err != nil {
+		t.Fatalf("generated config doesn't parse: %v\n%s", err, content)
+	}
+	values := cfg.Settings
+	want := map[string]string{
+		"LLM_PROVIDER":             "azure",
+		"AZURE_OPENAI_ENDPOINT":    "https://test.openai.azure.com",
+		"AZURE_OPENAI_API_KEY":     "secret: key",
+		"AZURE_OPENAI_MODEL":       "gpt-4o",
+		"AZURE_OPENAI_API_VERSION": "2024-02-15",
+	}
+	for env, value := range want {
+		if values[env] != value {
+			t.Errorf("%s = %q, want %q\n%s", env, values[env], value, content)
+		}
+	}
+}
+
+func TestWriteConfigYAML_Merges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	existing := "# my settings\nprovider: local\nllm_endpoint: http://localhost:1234 # LM Studio\nai_timeout: 90s\n"
+	if err := os.WriteFile(path, []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := generateConfigYAML("openai", "", "sk-new", "gpt-4o-mini", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeConfigYAML(path, content); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := parseConfig(data)
+	if err != nil {
+		t.Fatalf("merged config doesn't parse: %v\n%s", err, data)
+	}
+	values := cfg.Settings
+	want := map[string]string{
+		"LLM_PROVIDER":   "openai",
+		"LLM_ENDPOINT":   "http://localhost:1234",
+		"AI_TIMEOUT":     "90s",
+		"OPENAI_API_KEY": "sk-new",
+		"OPENAI_MODEL":   "gpt-4o-mini",
+	}
+	for env, value := range want {
+		if values[env] != value {
+			t.Errorf("%s = %q, want %q\n%s", env, values[env], value, data)
+		}
+	}
+	for _, comment := range []string{"# my settings", "# LM Studio"} {
+		if !bytes.Contains(data, []byte(comment)) {
+			t.Errorf("comment %q lost:\n%s", comment, data)
+		}
+	}
+}
+
+func TestMaskSecret(t *testing.T) {
+	tests := map[string]string{
+		"":                  "",
+		"short":             "*****",
+		"sk-abcdefghijklmn": "sk-a****klmn",
+	}
+	for in, want := range tests {
+		if got := maskSecret(in); got != want {
+			t.Errorf("maskSecret(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestPrintConfig(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	for _, key := range configKeys {
+		t.Setenv(key.env, "")
+	}
+	t.Setenv("OPENAI_API_KEY", "sk-abcdefghijklmn")
+	t.Setenv("OPENAI_MODEL", "gpt-4o-mini")
+	envSources = map[string]string{"OPENAI_MODEL": "capycut.yaml"}
+	defer func() { envSources = map[string]string{} }()
+
+	var buf bytes.Buffer
+	if err := printConfig(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	if strings.Contains(out, "sk-abcdefghijklmn") {
+		t.Errorf("secret printed in full:\n%s", out)
+	}
+	for _, want := range []string{"sk-a****klmn", "openai_model", "gpt-4o-mini", "capycut.yaml", "environment", "not found", "Clip parser:   OpenAI"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+// profilesConfig is a user config file with a default local setup and
+// three profiles
+const profilesConfig = `
+llm_endpoint: http://localhost:1234
+llm_model: default-model
+ai_timeout: 90s
+profiles:
+  work:
+    provider: azure
+    azure_openai_endpoint: https://work.openai.azure.com
+    azure_openai_api_key: work-key
+    azure_openai_model: gpt-4o
+  draft:
+    llm_model: small-model
+  empty: {}
+`
+
+func TestParseConfig_Profiles(t *testing.T) {
+	cfg, err := parseConfig([]byte(profilesConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Profiles) != 3 {
+		t.Fatalf("got %d profiles, want 3", len(cfg.Profiles))
+	}
+	if _, ok := cfg.Settings["LLM_PROVIDER"]; ok {
+		t.Error("profile setting leaked into the top level")
+	}
+
+	tests := []struct {
+		name, provider, model string
+	}{
+		{"work", "azure", "gpt-4o"},
+		{"draft", "local", "small-model"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		p := cfg.Profiles[tt.name]
+		if p == nil {
+			t.Errorf("profile %s missing", tt.name)
+			continue
+		}
+		if got := p.Provider(); got != tt.provider {
+			t.Errorf("%s.Provider() = %q, want %q", tt.name, got, tt.provider)
+		}
+		if got := p.Model(); got != tt.model {
+			t.Errorf("%s.Model() = %q, want %q", tt.name, got, tt.model)
+		}
+	}
+
+	for _, bad := range []string{"profiles: work\n", "profiles:\n  work: azure\n", "profiles:\n  work:\n    provder: azure\n"} {
+		if _, err := parseConfig([]byte(bad)); err == nil {
+			t.Errorf("parseConfig(%q) = nil error", bad)
+		}
+	}
+}
+
+func TestResolveConfig_Profile(t *testing.T) {
+	user, err := parseConfig([]byte(profilesConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Path = "config.yaml"
+	project, err := parseConfig([]byte("profiles:\n  work:\n    azure_openai_model: gpt-4o-mini\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	project.Path = "capycut.yaml"
+	files := []*configFile{project, user}
+
+	values, sources, err := resolveConfig(files, "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The profile switches provider, so the default local endpoint must go
+	if _, ok := values["LLM_ENDPOINT"]; ok {
+		t.Errorf("LLM_ENDPOINT = %q kept from another provider's defaults", values["LLM_ENDPOINT"])
+	}
+	want := map[string]string{
+		"LLM_PROVIDER":          "azure",
+		"AZURE_OPENAI_ENDPOINT": "https://work.openai.azure.com",
+		"AZURE_OPENAI_MODEL":    "gpt-4o-mini",
+		"AI_TIMEOUT":            "90s",
+	}
+	for env, value := range want {
+		if values[env] != value {
+			t.Errorf("%s = %q, want %q", env, values[env], value)
+		}
+	}
+	if sources["AZURE_OPENAI_MODEL"] != "capycut.yaml (profile work)" || sources["AI_TIMEOUT"] != "config.yaml" {
+		t.Errorf("sources = %v", sources)
+	}
+
+	// A profile for the same provider only overrides what it sets
+	values, _, err = resolveConfig(files, "draft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["LLM_ENDPOINT"] != "http://localhost:1234" || values["LLM_MODEL"] != "small-model" {
+		t.Errorf("draft profile resolved to %v", values)
+	}
+
+	// Settings for the other role survive a profile's provider
+	withGemini, err := parseConfig([]byte("gemini_api_key: gm-test\nanthropic_api_key: sk-ant-test\n" + profilesConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, _, err = resolveConfig([]*configFile{withGemini}, "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["GEMINI_API_KEY"] != "gm-test" {
+		t.Errorf("GEMINI_API_KEY = %q, want the top-level key kept for transcription", values["GEMINI_API_KEY"])
+	}
+	if _, ok := values["ANTHROPIC_API_KEY"]; ok {
+		t.Error("ANTHROPIC_API_KEY kept although Anthropic competes with the profile's Azure clip parser")
+	}
+
+	if _, _, err := resolveConfig(files, "missing"); err == nil || !strings.Contains(err.Error(), `"missing"`) {
+		t.Errorf("resolveConfig(missing) error = %v", err)
+	}
+}
+
+func TestSettingsProvider(t *testing.T) {
+	tests := []struct {
+		settings map[string]string
+		want     string
+	}{
+		{map[string]string{"OPENAI_API_KEY": "sk", "AZURE_ANTHROPIC_ENDPOINT": "https://x"}, "azure_anthropic"},
+		{map[string]string{"ANTHROPIC_API_KEY": "sk", "OPENAI_MODEL": "gpt-4o"}, "openai"},
+		{map[string]string{"GEMINI_API_KEY": "gm", "LLM_ENDPOINT": "http://localhost:1234"}, "local"},
+		{map[string]string{"GEMINI_API_KEY": "gm"}, "gemini"},
+		{map[string]string{"LLM_PROVIDER": "anthropic", "LLM_ENDPOINT": "http://localhost:1234"}, "anthropic"},
+		{map[string]string{"AI_TIMEOUT": "90s"}, ""},
+	}
+	for _, tt := range tests {
+		if got := settingsProvider(tt.settings); got != tt.want {
+			t.Errorf("settingsProvider(%v) = %q, want %q", tt.settings, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateConfigYAML_Profile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(profilesConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := generateConfigYAML("local", "http://gpu-box:11434", "", "llama3", "", "home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeConfigYAML(path, content); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := parseConfig(data)
+	if err != nil {
+		t.Fatalf("merged config doesn't parse: %v\n%s", err, data)
+	}
+	home := cfg.Profiles["home"]
+	if home == nil || home.Settings["LLM_ENDPOINT"] != "http://gpu-box:11434" || home.Provider() != "local" {
+		t.Errorf("home profile = %+v\n%s", home, data)
+	}
+	if cfg.Profiles["work"] == nil || cfg.Profiles["draft"] == nil {
+		t.Errorf("existing profiles lost:\n%s", data)
+	}
+	if cfg.Settings["LLM_MODEL"] != "default-model" {
+		t.Errorf("default settings changed:\n%s", data)
+	}
+}
+
+func TestListProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(profilesConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := listProfiles(&buf, []string{path}, "work"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want a header and 3 profiles:\n%s", len(lines), buf.String())
+	}
+	for i, want := range [][]string{
+		{"draft", "local", "small-model"},
+		{"empty", "(default)"},
+		{"* work", "azure", "gpt-4o", path},
+	} {
+		for _, field := range want {
+			if !strings.Contains(lines[i+1], field) {
+				t.Errorf("line %q missing %q", lines[i+1], field)
+			}
+		}
+	}
+
+	buf.Reset()
+	if err := listProfiles(&buf, []string{filepath.Join(t.TempDir(), "none.yaml")}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "No profiles configured") {
+		t.Errorf("output = %q", buf.String())
+	}
+}
+
+func TestSplitProfileArg(t *testing.T) {
+	tests := []struct {
+		args        []string
+		wantProfile string
+		wantRest    []string
+	}{
+		{[]string{"-o", "out", "--profile", "work", "scan.png"}, "work", []string{"-o", "out", "scan.png"}},
+		{[]string{"--profile=home", "show"}, "home", []string{"show"}},
+		{[]string{"show", "--profile"}, "", []string{"show", "--profile"}},
+		{nil, "", nil},
+	}
+	for _, tt := range tests {
+		profile, rest := splitProfileArg(tt.args)
+		if profile != tt.wantProfile || strings.Join(rest, " ") != strings.Join(tt.wantRest, " ") {
+			t.Errorf("splitProfileArg(%q) = %q, %q; want %q, %q", tt.args, profile, rest, tt.wantProfile, tt.wantRest)
+		}
+	}
+}
+
+func TestRunDoctor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake tools are shell scripts")
+	}
+
+	// Fake ffmpeg and ffprobe first on PATH
+	bin := t.TempDir()
+	scripts := map[string]string{
+		"ffmpeg":  "#!/bin/sh\necho 'ffmpeg version 6.1.1 Copyright (c) 2000-2023 the FFmpeg developers'\n",
+		"ffprobe": "#!/bin/sh\necho 'ffprobe version 6.1.1'\n",
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin)
+
+	for _, env := range []string{
+		"LLM_PROVIDER", "IMAGE_LLM_ENDPOINT", "AZURE_ANTHROPIC_ENDPOINT", "ANTHROPIC_API_KEY",
+		"OPENAI_API_KEY", "AZURE_OPENAI_ENDPOINT", "AZURE_OPENAI_API_KEY", "AZURE_OPENAI_MODEL",
+		"GEMINI_API_KEY", "GOOGLE_API_KEY", "CAPYCUT_PROVIDER_FALLBACK", "CAPYCUT_CA_CERT",
+	} {
+		t.Setenv(env, "")
+		os.Unsetenv(env)
+	}
+	t.Setenv("LLM_ENDPOINT", "http://localhost:1234/v1")
+	t.Setenv("LLM_MODEL", "doctor-model")
+	t.Setenv("CAPYCUT_INSECURE", "1")
+
+	var out bytes.Buffer
+	runDoctor(&out)
+	got := out.String()
+
+	for _, want := range []string{
+		"  ffmpeg:        6.1.1\n",
+		"  ffprobe:       found\n",
+		"  Clip parser:   ",
+		"model doctor-model\n",
+		"  CA bundle:     system roots\n",
+		"  TLS verify:    DISABLED\n",
+		"  Proxy:         http://localhost:1234/v1 -> direct\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("runDoctor() output is missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "not configured") {
+		t.Errorf("runDoctor() reports a provider as not configured:\n%s", got)
+	}
+	if strings.Count(got, "Proxy:") != 1 {
+		t.Errorf("runDoctor() should report the shared endpoint's proxy once:\n%s", got)
+	}
+
+	// Without tools or providers, each is reported missing. The ffmpeg
+	// probe is cached for the process, so only ffprobe is looked up again.
+	t.Setenv("PATH", t.TempDir())
+	t.Setenv("LLM_ENDPOINT", "")
+	t.Setenv("CAPYCUT_INSECURE", "")
+	out.Reset()
+	runDoctor(&out)
+	got = out.String()
+	for _, want := range []string{
+		"  ffprobe:       not found\n",
+		"  Clip parser:   not configured",
+		"  Transcription: not configured",
+		"  TLS verify:    on\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("runDoctor() without a setup is missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "Proxy:") {
+		t.Errorf("runDoctor() without providers reports a proxy:\n%s", got)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// envRefRe matches $VAR and ${VAR} references
+var envRefRe = regexp.MustCompile(`\$\{[A-Za-z_][A-Za-z0-9_]*\}|\$[A-Za-z_][A-Za-z0-9_]*`)
+
+// expandPath expands $VAR, ${VAR} and a leading ~ in a path argument, so
+// paths work the same when capycut is run without a shell (e.g. via exec
+// from another program). A path that already exists is kept as-is: the
+// shell has expanded it, and a "$" left in it is part of the name.
+// Variables that aren't set stay literal rather than expanding to nothing,
+// and "-" (stdin/stdout) is never touched.
+func expandPath(path string) string {
+	if path == "" || path == "-" || !strings.ContainsAny(path, "$~") {
+		return path
+	}
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+
+	expanded := envRefRe.ReplaceAllStringFunc(path, func(ref string) string {
+		name := strings.Trim(ref, "${}")
+		if value, ok := os.LookupEnv(name); ok {
+			return value
+		}
+		return ref
+	})
+
+	return expandHome(expanded)
+}
+
+// expandHome replaces a leading "~" or "~/" with the user's home directory.
+// "~user" forms are left alone.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") && !strings.HasPrefix(path, `~\`) {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
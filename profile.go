@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"capycut/llm"
+)
+
+// ProfileEnvVar names the config profile to use when --profile isn't given
+const ProfileEnvVar = "CAPYCUT_PROFILE"
+
+// Profile is a named block of settings under a config file's profiles key.
+// Selected with --profile, it is applied over the file's top-level
+// settings, so e.g. "home" and "work" can each carry their own provider.
+type Profile struct {
+	// Name is the profile's key under profiles
+	Name string
+
+	// Settings maps environment variable names to values, like a config
+	// file's top level
+	Settings map[string]string
+
+	// Path is the config file the profile is defined in
+	Path string
+}
+
+// Provider returns the provider the profile selects: its provider key, or
+// else the provider its connection settings belong to. It is empty when
+// the profile sets neither and so keeps the default provider.
+func (p *Profile) Provider() string {
+	return settingsProvider(p.Settings)
+}
+
+// Model returns the model the profile sets for its provider, if any
+func (p *Profile) Model() string {
+	provider := p.Provider()
+	for _, key := range configKeys {
+		if key.provider == provider && strings.HasSuffix(key.env, "_MODEL") && p.Settings[key.env] != "" {
+			return p.Settings[key.env]
+		}
+	}
+	return ""
+}
+
+// settingsProvider returns the provider a block of settings selects; see
+// Profile.Provider. Providers are checked in clip parser detection order,
+// then the transcription-only ones, so a local endpoint wins as it does at
+// runtime.
+func settingsProvider(settings map[string]string) string {
+	if provider := settings[llm.ProviderEnvVar]; provider != "" {
+		return provider
+	}
+	providers := llm.RoleClip.Providers()
+	for _, p := range llm.RoleTranscription.Providers() {
+		if !llm.RoleClip.Supports(p) {
+			providers = append(providers, p)
+		}
+	}
+	for _, p := range providers {
+		for _, key := range configKeys {
+			if key.provider == string(p) && settings[key.env] != "" {
+				return key.provider
+			}
+		}
+	}
+	return ""
+}
+
+// competes reports whether two providers can fill the same role, so that
+// configuring one could make the other lose detection. Azure OpenAI for
+// clips and Gemini for transcription don't.
+func competes(a, b string) bool {
+	for _, role := range []llm.Role{llm.RoleClip, llm.RoleTranscription} {
+		if role.Supports(llm.Provider(a)) && role.Supports(llm.Provider(b)) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveConfig merges config files into environment variable values and
+// the file each came from. Earlier files win over later ones. The named
+// profile is layered over the top-level settings of every file, and when
+// it selects a provider, top-level connection settings of providers that
+// compete with it are dropped; otherwise a default local endpoint would
+// still be picked over a profile's Azure one. Those of providers for the
+// other role stay, so a top-level Gemini key still transcribes next to a
+// profile's Azure clip parser.
+func resolveConfig(files []*configFile, profile string) (values, sources map[string]string, err error) {
+	values = make(map[string]string)
+	sources = make(map[string]string)
+	add := func(settings map[string]string, source string, keep func(env string) bool) {
+		for env, value := range settings {
+			if _, ok := values[env]; ok || !keep(env) {
+				continue
+			}
+			values[env] = value
+			sources[env] = source
+		}
+	}
+	all := func(string) bool { return true }
+
+	var provider string
+	if profile != "" {
+		found := false
+		for _, f := range files {
+			if p, ok := f.Profiles[profile]; ok {
+				add(p.Settings, fmt.Sprintf("%s (profile %s)", f.Path, profile), all)
+				found = true
+			}
+		}
+		if !found {
+			return nil, nil, fmt.Errorf("profile %q is not defined in %s (see 'capycut profile list')", profile, strings.Join(configPaths(), " or "))
+		}
+		provider = settingsProvider(values)
+	}
+
+	for _, f := range files {
+		add(f.Settings, f.Path, func(env string) bool {
+			key, _ := lookupConfigEnv(env)
+			return provider == "" || key.provider == "" || key.provider == provider || !competes(key.provider, provider)
+		})
+	}
+	return values, sources, nil
+}
+
+// splitProfileArg takes --profile <name> (or --profile=<name>) out of a
+// subcommand's arguments, which are loaded with the profile before they
+// are parsed
+func splitProfileArg(args []string) (string, []string) {
+	var profile string
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--profile" && i+1 < len(args):
+			i++
+			profile = args[i]
+		case strings.HasPrefix(arg, "--profile="):
+			profile = strings.TrimPrefix(arg, "--profile=")
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return profile, rest
+}
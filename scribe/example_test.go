@@ -218,6 +218,6 @@ func Example_webhook() {
 }
 
 // Helper functions for examples
-func boolPtr(b bool) *bool     { return &b }
-func intPtr(i int) *int        { return &i }
+func boolPtr(b bool) *bool        { return &b }
+func intPtr(i int) *int           { return &i }
 func floatPtr(f float64) *float64 { return &f }
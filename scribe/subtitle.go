@@ -355,13 +355,13 @@ func splitTextIntoLines(text string, maxLength int) []string {
 
 // SubtitleStats contains statistics about subtitles
 type SubtitleStats struct {
-	TotalEntries   int
-	TotalDuration  time.Duration
+	TotalEntries    int
+	TotalDuration   time.Duration
 	AverageDuration time.Duration
-	LongestEntry   time.Duration
-	ShortestEntry  time.Duration
+	LongestEntry    time.Duration
+	ShortestEntry   time.Duration
 	TotalCharacters int
-	AverageLength  int
+	AverageLength   int
 }
 
 // GetSubtitleStats calculates statistics for subtitle entries
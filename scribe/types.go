@@ -6,9 +6,9 @@ import "time"
 
 // Model IDs for ElevenLabs Scribe API
 const (
-	ModelScribeV1            = "scribe_v1"
+	ModelScribeV1             = "scribe_v1"
 	ModelScribeV1Experimental = "scribe_v1_experimental"
-	ModelScribeV2Realtime    = "scribe_v2_realtime"
+	ModelScribeV2Realtime     = "scribe_v2_realtime"
 )
 
 // WordType represents the type of a transcribed element
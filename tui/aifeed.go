@@ -3,13 +3,25 @@ package tui
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
+	"capycut/fsmode"
+
 	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
 
+// DefaultFeedHistory caps how many messages an AIFeed keeps. It's enough for
+// every request and response of a long transcription job while keeping
+// memory bounded if a job runs away.
+const DefaultFeedHistory = 5000
+
 // AIFeedMessageType represents the type of AI feed message
 type AIFeedMessageType string
 
@@ -24,6 +36,8 @@ const (
 	MsgTypeThinking AIFeedMessageType = "thinking"
 	// MsgTypeError indicates an error occurred
 	MsgTypeError AIFeedMessageType = "error"
+	// MsgTypeWarning indicates a recoverable problem (e.g. a retry)
+	MsgTypeWarning AIFeedMessageType = "warning"
 	// MsgTypeComplete indicates successful completion
 	MsgTypeComplete AIFeedMessageType = "complete"
 )
@@ -134,15 +148,15 @@ type AIFeed struct {
 
 	// MaxMessages limits the number of messages kept (0 = unlimited)
 	MaxMessages int
+
+	// Dropped counts the oldest messages trimmed to stay under MaxMessages
+	Dropped int
 }
 
 // NewAIFeed creates a new AI feed with the given dimensions
 func NewAIFeed(width, height int) *AIFeed {
+	// Callers draw the border around the feed themselves
 	vp := viewport.New(width, height)
-	vp.Style = lipgloss.NewStyle().
-		Border(lipgloss.RoundedBorder()).
-		BorderForeground(ColorBorder).
-		Padding(0, 1)
 
 	return &AIFeed{
 		Messages:            make([]AIFeedMessage, 0),
@@ -151,7 +165,7 @@ func NewAIFeed(width, height int) *AIFeed {
 		Height:              height,
 		ShowRequestDetails:  true,
 		ShowResponseDetails: true,
-		MaxMessages:         100,
+		MaxMessages:         DefaultFeedHistory,
 	}
 }
 
@@ -165,12 +179,70 @@ func (f *AIFeed) AddMessage(msg AIFeedMessage) {
 
 	// Trim old messages if needed
 	if f.MaxMessages > 0 && len(f.Messages) > f.MaxMessages {
-		f.Messages = f.Messages[len(f.Messages)-f.MaxMessages:]
+		drop := len(f.Messages) - f.MaxMessages
+		f.Messages = f.Messages[drop:]
+		f.Dropped += drop
 	}
 
-	// Update viewport content
+	// Follow new messages unless the user has scrolled back
+	follow := f.Viewport.AtBottom()
 	f.Viewport.SetContent(f.Render())
-	f.Viewport.GotoBottom()
+	if follow {
+		f.Viewport.GotoBottom()
+	}
+}
+
+// ReplaceLast swaps the newest message for msg, e.g. to show more of an
+// answer that is still arriving; with no messages it adds msg
+func (f *AIFeed) ReplaceLast(msg AIFeedMessage) {
+	if len(f.Messages) == 0 {
+		f.AddMessage(msg)
+		return
+	}
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	f.Messages[len(f.Messages)-1] = msg
+
+	follow := f.Viewport.AtBottom()
+	f.Viewport.SetContent(f.Render())
+	if follow {
+		f.Viewport.GotoBottom()
+	}
+}
+
+// HandleKey scrolls the feed for arrow, page and home/end keys and reports
+// whether it used the key
+func (f *AIFeed) HandleKey(msg tea.KeyMsg) bool {
+	switch msg.String() {
+	case "up":
+		f.Viewport.LineUp(1)
+	case "down":
+		f.Viewport.LineDown(1)
+	case "pgup":
+		f.Viewport.ViewUp()
+	case "pgdown":
+		f.Viewport.ViewDown()
+	case "home":
+		f.Viewport.GotoTop()
+	case "end":
+		f.Viewport.GotoBottom()
+	default:
+		return false
+	}
+	return true
+}
+
+// ScrollHint describes the scroll position for a help line, e.g.
+// "lines 1-10 of 42", or "" when everything fits
+func (f *AIFeed) ScrollHint() string {
+	total := f.Viewport.TotalLineCount()
+	if total <= f.Viewport.Height {
+		return ""
+	}
+	first := f.Viewport.YOffset + 1
+	last := min(f.Viewport.YOffset+f.Viewport.Height, total)
+	return fmt.Sprintf("lines %d-%d of %d", first, last, total)
 }
 
 // AddRequest adds a request message to the feed
@@ -258,16 +330,21 @@ func (f *AIFeed) AddComplete(provider, model, title string, details ...string) {
 
 // SetSize updates the feed dimensions
 func (f *AIFeed) SetSize(width, height int) {
+	follow := f.Viewport.AtBottom()
 	f.Width = width
 	f.Height = height
 	f.Viewport.Width = width
 	f.Viewport.Height = height
 	f.Viewport.SetContent(f.Render())
+	if follow {
+		f.Viewport.GotoBottom()
+	}
 }
 
 // Clear removes all messages from the feed
 func (f *AIFeed) Clear() {
 	f.Messages = make([]AIFeedMessage, 0)
+	f.Dropped = 0
 	f.Viewport.SetContent(f.Render())
 }
 
@@ -283,6 +360,9 @@ func (f *AIFeed) Render() string {
 	}
 
 	var lines []string
+	if f.Dropped > 0 {
+		lines = append(lines, MutedStyle.Render(fmt.Sprintf("  ... %d older messages not kept", f.Dropped)))
+	}
 	for _, msg := range f.Messages {
 		line := f.renderMessageSimple(msg)
 		if line != "" {
@@ -293,6 +373,111 @@ func (f *AIFeed) Render() string {
 	return strings.Join(lines, "\n")
 }
 
+// WriteLog writes the full feed as plain text, one message per entry with
+// every request and response detail, for auditing after a job
+func (f *AIFeed) WriteLog(w io.Writer) error {
+	if f.Dropped > 0 {
+		if _, err := fmt.Fprintf(w, "(%d older messages were not kept)\n\n", f.Dropped); err != nil {
+			return err
+		}
+	}
+	for _, msg := range f.Messages {
+		if _, err := io.WriteString(w, formatLogEntry(msg)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveLog writes the feed to a timestamped capycut-ai-*.log file in dir and
+// returns its path. dirMode and fileMode work as in fsmode.MkdirAll and
+// gemini.WriteOptions, 0 keeping the defaults.
+func (f *AIFeed) SaveLog(dir string, dirMode, fileMode os.FileMode) (string, error) {
+	if err := fsmode.MkdirAll(dir, dirMode); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "capycut-ai-"+time.Now().Format("20060102-150405")+".log")
+	perm := fileMode
+	if perm == 0 {
+		perm = fsmode.DefaultFile
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return "", err
+	}
+	if err := f.WriteLog(file); err != nil {
+		file.Close()
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+	if fileMode != 0 {
+		if err := os.Chmod(path, fileMode); err != nil {
+			return "", err
+		}
+	}
+	return path, nil
+}
+
+// formatLogEntry renders one message for WriteLog
+func formatLogEntry(msg AIFeedMessage) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s [%s] %s\n", msg.Timestamp.Format("2006-01-02 15:04:05"), msg.Type, msg.Title)
+
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "    %-10s %s\n", name+":", value)
+		}
+	}
+	field("provider", msg.Provider)
+	field("model", msg.Model)
+	for _, d := range msg.Details {
+		field("detail", d)
+	}
+
+	if r := msg.RequestInfo; r != nil {
+		field("endpoint", strings.TrimSpace(r.Method+" "+r.Endpoint))
+		field("type", r.ContentType)
+		field("data", r.DataSummary)
+		if r.ImageCount > 0 {
+			field("images", fmt.Sprintf("%d", r.ImageCount))
+		}
+		if r.TotalDataSize > 0 {
+			field("size", formatDataSize(r.TotalDataSize))
+		}
+		field("prompt", r.PromptPreview)
+		keys := make([]string, 0, len(r.Parameters))
+		for k := range r.Parameters {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			field("param", k+"="+r.Parameters[k])
+		}
+	}
+
+	if r := msg.ResponseInfo; r != nil {
+		if r.StatusCode > 0 {
+			field("status", strings.TrimSpace(fmt.Sprintf("%d %s", r.StatusCode, r.StatusText)))
+		}
+		if r.Latency > 0 {
+			field("latency", r.Latency.Round(time.Millisecond).String())
+		}
+		if r.TokensTotal > 0 || r.TokensInput > 0 || r.TokensOutput > 0 {
+			field("tokens", fmt.Sprintf("%d in, %d out, %d total", r.TokensInput, r.TokensOutput, r.TokensTotal))
+		}
+		if r.ItemsProcessed > 0 {
+			field("items", fmt.Sprintf("%d", r.ItemsProcessed))
+		}
+		field("content", r.ContentPreview)
+		field("error", r.ErrorMessage)
+	}
+
+	b.WriteString("\n")
+	return b.String()
+}
+
 // renderMessageSimple renders a single message in a very simple format
 func (f *AIFeed) renderMessageSimple(msg AIFeedMessage) string {
 	// Get icon and style based on message type
@@ -353,6 +538,8 @@ func (f *AIFeed) getMessageStyle(msgType AIFeedMessageType) (string, lipgloss.St
 		return "[.]", lipgloss.NewStyle().Foreground(ColorAccent)
 	case MsgTypeError:
 		return "[!]", lipgloss.NewStyle().Foreground(ColorError)
+	case MsgTypeWarning:
+		return "[?]", lipgloss.NewStyle().Foreground(ColorWarning)
 	case MsgTypeComplete:
 		return "[x]", lipgloss.NewStyle().Foreground(ColorSuccess)
 	default:
@@ -415,3 +602,39 @@ func RenderFeedBox(feed *AIFeed, title string, width int) string {
 
 	return titleStr + "\n" + boxStyle.Render(content)
 }
+
+// renderFeedHistory renders the scrollable feed for a finished job, with
+// the scroll position and the outcome of the last save
+func renderFeedHistory(feed *AIFeed, width int, notice string) string {
+	feedStyle := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(ColorBorder).
+		Padding(0, 1).
+		Width(width - 12)
+
+	out := SubtitleStyle.Render("AI Request History") + "\n" + feedStyle.Render(feed.View())
+	if hint := feed.ScrollHint(); hint != "" {
+		out += "\n" + MutedStyle.Render("  "+hint+" (up/down, pgup/pgdn to scroll)")
+	}
+	if notice != "" {
+		out += "\n" + MutedStyle.Render("  "+notice)
+	}
+	return out
+}
+
+// saveFeedLog saves the feed under dir (the current directory when empty)
+// and returns a one-line notice for the UI
+func saveFeedLog(feed *AIFeed, dir string) string {
+	if dir == "" {
+		dir = "."
+	}
+	dirMode, fileMode, err := fsmode.FromEnv()
+	if err != nil {
+		return "Could not save AI log: " + err.Error()
+	}
+	path, err := feed.SaveLog(dir, dirMode, fileMode)
+	if err != nil {
+		return "Could not save AI log: " + err.Error()
+	}
+	return "AI log saved to " + path
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"capycut/ai"
+	"capycut/fsmode"
 	"capycut/video"
 
 	"github.com/charmbracelet/bubbles/progress"
@@ -29,6 +30,7 @@ const (
 	CStepEnterDescription
 	CStepParsing
 	CStepConfirm
+	CStepEditTimes
 	CStepClipping
 	CStepComplete
 	CStepError
@@ -56,9 +58,41 @@ type ClipModel struct {
 	// Clip description
 	clipDescription string
 
-	// Parsing result
-	clipRequest *ai.ClipRequest
-	outputPath  string
+	// parseCancel stops the running parse; parseID tells its result apart
+	// from those of parses cancelled earlier
+	parseCancel context.CancelFunc
+	parseID     int
+
+	// parseNotice is shown above the description after a cancelled parse
+	parseNotice string
+
+	// Parsing result: the clip being confirmed and, for a description of
+	// several clips, the ones still to come and its number among them
+	clipRequest  *ai.ClipRequest
+	pendingClips []*ai.ClipRequest
+	clipNumber   int
+	clipCount    int
+	outputPath   string
+
+	// savedClips lists the clips cut so far from the description
+	savedClips []string
+
+	// gif exports the clip as an animated GIF, toggled with "g" on the
+	// confirmation
+	gif bool
+
+	// aspect is the crop ratio picked with "a" on the confirmation, or ""
+	// to keep the source's frame
+	aspect string
+
+	// Timestamp editing, to nudge the parsed times before cutting
+	startInput textinput.Model
+	endInput   textinput.Model
+	editFocus  int
+	editError  string
+
+	// cutProgress is how far ffmpeg is through the clip, from 0 to 1
+	cutProgress float64
 
 	// AI Agent status tracking
 	aiProvider string
@@ -66,9 +100,19 @@ type ClipModel struct {
 	aiMessage  string
 	aiDetail   string
 
+	// aiStreaming is set while the last feed message is a streamed answer
+	// still arriving, which the next streamed update replaces
+	aiStreaming bool
+
 	// Unified AI Feed for transparency
 	aiFeed *AIFeed
 
+	// feedNotice reports the result of saving the feed with "s"
+	feedNotice string
+
+	// thumbNotice reports the result of saving a thumbnail with "t"
+	thumbNotice string
+
 	// Results
 	errorMessage string
 	startTime    time.Time
@@ -108,8 +152,9 @@ type clipVideoInfoMsg struct {
 }
 
 type clipParseResultMsg struct {
-	result *ai.ClipRequest
-	err    error
+	id      int
+	results []*ai.ClipRequest
+	err     error
 }
 
 type clipCompleteMsg struct {
@@ -118,12 +163,24 @@ type clipCompleteMsg struct {
 	err        error
 }
 
+// clipThumbnailMsg reports a thumbnail saved from the finished clip
+type clipThumbnailMsg struct {
+	path string
+	err  error
+}
+
+// clipCutProgressMsg reports ffmpeg's progress through the clip
+type clipCutProgressMsg struct {
+	fraction float64
+}
+
 type clipProgressMsg struct {
 	status       ai.ParserProgressStatus
 	provider     string
 	model        string
 	message      string
 	detail       string
+	partial      bool
 	requestInfo  *ai.ParserRequestInfo
 	responseInfo *ai.ParserResponseInfo
 }
@@ -150,6 +207,15 @@ func NewClipModel(videoPath string) ClipModel {
 		progress.WithWidth(50),
 	)
 
+	startInput := textinput.New()
+	startInput.Prompt = "Start: "
+	startInput.CharLimit = 20
+	startInput.Width = 16
+	endInput := textinput.New()
+	endInput.Prompt = "End:   "
+	endInput.CharLimit = 20
+	endInput.Width = 16
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	// Initialize unified AI feed for transparency
@@ -161,6 +227,8 @@ func NewClipModel(videoPath string) ClipModel {
 	return ClipModel{
 		step:               CStepLoadingVideo,
 		textInput:          ti,
+		startInput:         startInput,
+		endInput:           endInput,
 		spinner:            sp,
 		progress:           p,
 		videoPath:          videoPath,
@@ -173,39 +241,43 @@ func NewClipModel(videoPath string) ClipModel {
 	}
 }
 
-// getClipProviders returns available AI providers for clipping
+// getClipProviders returns the AI providers configured for clipping, in the
+// order ai.NewParser would pick them, so the first is the auto-detected one
 func getClipProviders() []clipProviderOption {
 	var providers []clipProviderOption
-
-	// Check for Local LLM endpoint
-	if os.Getenv("LLM_ENDPOINT") != "" {
-		endpoint := os.Getenv("LLM_ENDPOINT")
-		providers = append(providers, clipProviderOption{
-			name:     fmt.Sprintf("Local LLM (%s)", endpoint),
-			provider: ai.ProviderLocal,
-			desc:     "Free, runs on your machine",
-		})
-	}
-
-	// Check for Azure Anthropic
-	if os.Getenv("AZURE_ANTHROPIC_ENDPOINT") != "" && os.Getenv("AZURE_ANTHROPIC_API_KEY") != "" {
+	for i, p := range ai.GetAvailableProviders() {
+		desc := clipProviderDescription(p)
+		if parser, err := ai.NewParserWithProvider(p); err == nil && parser.GetModel() != "" {
+			desc += ", model " + parser.GetModel()
+		}
+		if i == 0 {
+			desc += " (default)"
+		}
 		providers = append(providers, clipProviderOption{
-			name:     "Azure Anthropic (Claude)",
-			provider: ai.ProviderAzureAnthropic,
-			desc:     "Claude models via Azure",
+			name:     ai.GetProviderDisplayNameStatic(p),
+			provider: p,
+			desc:     desc,
 		})
 	}
+	return providers
+}
 
-	// Check for Azure OpenAI
-	if os.Getenv("AZURE_OPENAI_ENDPOINT") != "" && os.Getenv("AZURE_OPENAI_API_KEY") != "" {
-		providers = append(providers, clipProviderOption{
-			name:     "Azure OpenAI",
-			provider: ai.ProviderAzure,
-			desc:     "GPT models via Azure",
-		})
+// clipProviderDescription returns a short note on what a provider is
+func clipProviderDescription(p ai.Provider) string {
+	switch p {
+	case ai.ProviderLocal:
+		return "Free, runs on your machine"
+	case ai.ProviderAzureAnthropic:
+		return "Claude models via Azure"
+	case ai.ProviderAnthropic:
+		return "Claude models via the Anthropic API"
+	case ai.ProviderAzure:
+		return "GPT models via Azure"
+	case ai.ProviderOpenAI:
+		return "GPT models via the OpenAI API"
+	default:
+		return string(p)
 	}
-
-	return providers
 }
 
 // Init initializes the model
@@ -231,20 +303,29 @@ func (m ClipModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.width = msg.Width
 		m.height = msg.Height
 		m.progress.Width = m.width - 20
-		m.aiFeed.SetSize(m.width-12, 8)
+		m.aiFeed.SetSize(m.width-14, 8)
 		return m, nil
 
 	case tea.KeyMsg:
 		// Global key handlers
 		switch msg.String() {
 		case "ctrl+c", "q":
+			if msg.String() == "q" && m.step == CStepEditTimes {
+				break // typed into a time field
+			}
+			if m.step == CStepParsing && msg.String() == "ctrl+c" {
+				return m.cancelParsing()
+			}
 			if m.step != CStepParsing && m.step != CStepClipping {
 				m.quitting = true
 				m.cancel()
 				return m, tea.Quit
 			}
 		case "esc":
-			if m.step == CStepParsing || m.step == CStepClipping {
+			if m.step == CStepParsing {
+				return m.cancelParsing()
+			}
+			if m.step == CStepClipping {
 				m.cancel()
 				m.errorMessage = "Cancelled by user"
 				m.step = CStepError
@@ -260,6 +341,19 @@ func (m ClipModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.spinner, cmd = m.spinner.Update(msg)
 		return m, cmd
 
+	case progress.FrameMsg:
+		progressModel, cmd := m.progress.Update(msg)
+		m.progress = progressModel.(progress.Model)
+		return m, cmd
+
+	case clipCutProgressMsg:
+		m.cutProgress = msg.fraction
+		cmd := m.progress.SetPercent(msg.fraction)
+		if clipCutProgressChan != nil && m.step == CStepClipping {
+			cmd = tea.Batch(cmd, waitForCutProgress(clipCutProgressChan))
+		}
+		return m, cmd
+
 	case clipVideoInfoMsg:
 		if msg.err != nil {
 			m.errorMessage = msg.err.Error()
@@ -267,6 +361,11 @@ func (m ClipModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 		m.videoInfo = msg.info
+		if len(m.availableProviders) == 0 {
+			m.errorMessage = "No AI providers configured\n\n" + ai.GetAPIKeyHelp()
+			m.step = CStepError
+			return m, nil
+		}
 		if len(m.availableProviders) == 1 {
 			m.selectedProvider = m.availableProviders[0].provider
 			m.step = CStepEnterDescription
@@ -309,7 +408,13 @@ func (m ClipModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 
-		m.aiFeed.AddMessage(feedMsg)
+		// A streamed answer grows in one message rather than one per piece
+		if msg.partial && m.aiStreaming {
+			m.aiFeed.ReplaceLast(feedMsg)
+		} else {
+			m.aiFeed.AddMessage(feedMsg)
+		}
+		m.aiStreaming = msg.partial
 
 		// Continue listening for more progress if not complete/error
 		if clipProgressChan != nil && msg.status != ai.ParserStatusComplete && msg.status != ai.ParserStatusError {
@@ -318,15 +423,44 @@ func (m ClipModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case clipParseResultMsg:
+		if msg.id != m.parseID || m.step != CStepParsing {
+			return m, nil // from a cancelled parse
+		}
+		m.parseCancel()
+		m.parseCancel = nil
 		if msg.err != nil {
 			m.errorMessage = msg.err.Error()
+			if hint := ai.ErrorGuidance(msg.err); hint != "" {
+				m.errorMessage += "\n\n" + hint
+			}
 			m.step = CStepError
 			return m, nil
 		}
-		m.clipRequest = msg.result
-		m.outputPath = video.GenerateOutputPath(m.videoPath, msg.result.StartTime, msg.result.EndTime)
-		m.step = CStepConfirm
-		return m, nil
+		// Nothing is cut unless every clip is valid
+		minClip, err := video.MinClipDurationFromEnv()
+		for i, clip := range msg.results {
+			if err == nil {
+				err = clip.Validate(m.videoInfo.Duration)
+			}
+			if err == nil {
+				_, err = video.ValidateClipLength(clip.StartTime, clip.EndTime, minClip)
+			}
+			if err != nil {
+				if len(msg.results) > 1 {
+					err = fmt.Errorf("clip %d: %w", i+1, err)
+				}
+				break
+			}
+		}
+		if err != nil {
+			m.errorMessage = err.Error()
+			m.step = CStepError
+			return m, nil
+		}
+		m.pendingClips = msg.results
+		m.clipNumber, m.clipCount = 0, len(msg.results)
+		m.savedClips = nil
+		return m.nextClip()
 
 	case clipCompleteMsg:
 		if msg.err != nil {
@@ -334,9 +468,16 @@ func (m ClipModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.step = CStepError
 			return m, nil
 		}
-		m.outputPath = msg.outputPath
+		m.savedClips = append(m.savedClips, msg.outputPath)
 		m.outputSize = msg.outputSize
-		m.step = CStepComplete
+		return m.nextClip()
+
+	case clipThumbnailMsg:
+		if msg.err != nil {
+			m.thumbNotice = "Thumbnail failed: " + msg.err.Error()
+		} else {
+			m.thumbNotice = "Thumbnail saved to " + msg.path
+		}
 		return m, nil
 	}
 
@@ -346,6 +487,8 @@ func (m ClipModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		var cmd tea.Cmd
 		m.textInput, cmd = m.textInput.Update(msg)
 		return m, cmd
+	case CStepEditTimes:
+		return m.updateTimeInputs(msg)
 	}
 
 	return m, nil
@@ -377,9 +520,13 @@ func (m ClipModel) handleStepInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			desc := m.textInput.Value()
 			if desc != "" {
 				m.clipDescription = desc
+				m.parseNotice = ""
 				m.step = CStepParsing
 				m.startTime = time.Now()
-				return m, m.startParsing()
+				m.parseID++
+				ctx, cancel := context.WithCancel(m.ctx)
+				m.parseCancel = cancel
+				return m, m.startParsing(ctx, m.parseID)
 			}
 		default:
 			var cmd tea.Cmd
@@ -402,17 +549,41 @@ func (m ClipModel) handleStepInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 				m.step = CStepClipping
 				return m, m.startClipping()
 			} else {
-				m.backToMenu = true
-				return m, tea.Quit
+				return m.nextClip()
 			}
 		case "y", "Y":
 			m.step = CStepClipping
 			return m, m.startClipping()
 		case "n", "N":
-			m.backToMenu = true
-			return m, tea.Quit
+			return m.nextClip()
+		case "e", "E":
+			return m.startEditingTimes()
+		case "g", "G":
+			m.gif = !m.gif
+			m.outputPath = m.clipOutputPath()
+		case "a", "A":
+			m.aspect = nextAspect(m.aspect)
+		}
+
+	case CStepEditTimes:
+		switch msg.String() {
+		case "tab", "shift+tab", "up", "down":
+			m.editFocus = 1 - m.editFocus
+			if m.editFocus == 0 {
+				m.endInput.Blur()
+				return m, m.startInput.Focus()
+			}
+			m.startInput.Blur()
+			return m, m.endInput.Focus()
+		case "enter":
+			return m.applyEditedTimes()
+		default:
+			return m.updateTimeInputs(msg)
 		}
 
+	case CStepParsing:
+		m.aiFeed.HandleKey(msg)
+
 	case CStepComplete:
 		switch msg.String() {
 		case "enter", "q":
@@ -420,6 +591,13 @@ func (m ClipModel) handleStepInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		case "a":
 			m.backToMenu = true
 			return m, tea.Quit
+		case "s":
+			m.feedNotice = saveFeedLog(m.aiFeed, filepath.Dir(m.outputPath))
+		case "t":
+			m.thumbNotice = "Saving thumbnail..."
+			return m, saveClipThumbnail(m.outputPath)
+		default:
+			m.aiFeed.HandleKey(msg)
 		}
 
 	case CStepError:
@@ -429,6 +607,10 @@ func (m ClipModel) handleStepInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			return m, tea.Quit
 		case "q":
 			return m, tea.Quit
+		case "s":
+			m.feedNotice = saveFeedLog(m.aiFeed, ".")
+		default:
+			m.aiFeed.HandleKey(msg)
 		}
 	}
 
@@ -451,7 +633,124 @@ func (m ClipModel) goBack() (tea.Model, tea.Cmd) {
 	case CStepConfirm:
 		m.step = CStepEnterDescription
 		m.textInput.Focus()
+	case CStepEditTimes:
+		// Discard the edits
+		m.step = CStepConfirm
+	}
+	return m, nil
+}
+
+// nextClip moves on to the confirmation of the next parsed clip. Once none
+// are left it shows the last clip cut, or returns to the menu when every
+// clip was declined.
+func (m ClipModel) nextClip() (tea.Model, tea.Cmd) {
+	if len(m.pendingClips) == 0 {
+		if len(m.savedClips) == 0 {
+			m.backToMenu = true
+			return m, tea.Quit
+		}
+		m.outputPath = m.savedClips[len(m.savedClips)-1]
+		m.step = CStepComplete
+		return m, nil
+	}
+	m.clipRequest, m.pendingClips = m.pendingClips[0], m.pendingClips[1:]
+	m.clipNumber++
+	m.outputPath = m.clipOutputPath()
+	m.confirmIndex = 0
+	m.step = CStepConfirm
+	return m, nil
+}
+
+// cancelParsing stops the running parse, e.g. a hung local model, and
+// returns to the description, which is kept so it can be edited and resent
+func (m ClipModel) cancelParsing() (tea.Model, tea.Cmd) {
+	if m.parseCancel != nil {
+		m.parseCancel()
+		m.parseCancel = nil
+	}
+	m.parseNotice = "Parsing cancelled. Edit the description to try again."
+	m.step = CStepEnterDescription
+	m.textInput.Focus()
+	return m, textinput.Blink
+}
+
+// startEditingTimes opens the timestamp editor with the parsed times
+func (m ClipModel) startEditingTimes() (tea.Model, tea.Cmd) {
+	m.startInput.SetValue(m.clipRequest.StartTime)
+	m.startInput.CursorEnd()
+	m.endInput.SetValue(m.clipRequest.EndTime)
+	m.endInput.CursorEnd()
+	m.endInput.Blur()
+	m.editFocus = 0
+	m.editError = ""
+	m.step = CStepEditTimes
+	return m, m.startInput.Focus()
+}
+
+// updateTimeInputs passes a message to the focused time field
+func (m ClipModel) updateTimeInputs(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	if m.editFocus == 0 {
+		m.startInput, cmd = m.startInput.Update(msg)
+	} else {
+		m.endInput, cmd = m.endInput.Update(msg)
+	}
+	return m, cmd
+}
+
+// clipOutputPath generates a free output path for the parsed clip, with a
+// .gif extension when exporting a GIF
+func (m ClipModel) clipOutputPath() string {
+	ext := ""
+	if m.gif {
+		ext = video.GIFExt
+	}
+	return video.UniqueOutputPath(video.GenerateOutputPath(m.videoPath, m.clipRequest.StartTime, m.clipRequest.EndTime, ext))
+}
+
+// nextAspect cycles the confirmation's aspect select: the source's own
+// frame, then each of video.AspectRatios
+func nextAspect(current string) string {
+	options := append([]string{""}, video.AspectRatios...)
+	for i, option := range options {
+		if option == current {
+			return options[(i+1)%len(options)]
+		}
+	}
+	return ""
+}
+
+// aspectLabel names an aspect select option
+func aspectLabel(aspect string) string {
+	if aspect == "" {
+		return "original"
+	}
+	return aspect
+}
+
+// applyEditedTimes validates the edited times and returns to the
+// confirmation with them, without calling the AI again
+func (m ClipModel) applyEditedTimes() (tea.Model, tea.Cmd) {
+	minClip, err := video.MinClipDurationFromEnv()
+	if err != nil {
+		m.editError = err.Error()
+		return m, nil
+	}
+	start, end, err := video.ParseClipRange(m.startInput.Value(), m.endInput.Value(), m.videoInfo.Duration, minClip)
+	if err != nil {
+		m.editError = err.Error()
+		return m, nil
+	}
+
+	if start != m.clipRequest.StartTime || end != m.clipRequest.EndTime {
+		edited := *m.clipRequest
+		edited.StartTime, edited.EndTime = start, end
+		edited.Warning = "" // The user chose these times
+		m.clipRequest = &edited
+		m.outputPath = m.clipOutputPath()
 	}
+	m.editError = ""
+	m.step = CStepConfirm
 	return m, nil
 }
 
@@ -469,8 +768,8 @@ func waitForClipProgress(ch chan clipProgressMsg) tea.Cmd {
 	}
 }
 
-// startParsing begins the AI parsing process
-func (m ClipModel) startParsing() tea.Cmd {
+// startParsing begins the AI parsing process; cancelling ctx stops it
+func (m ClipModel) startParsing(ctx context.Context, id int) tea.Cmd {
 	progressChan := make(chan clipProgressMsg, 100)
 	resultChan := make(chan clipParseResultMsg, 1)
 
@@ -487,7 +786,7 @@ func (m ClipModel) startParsing() tea.Cmd {
 
 		parser, err := ai.NewParserWithProvider(provider)
 		if err != nil {
-			resultChan <- clipParseResultMsg{err: err}
+			resultChan <- clipParseResultMsg{id: id, err: err}
 			return
 		}
 
@@ -499,6 +798,7 @@ func (m ClipModel) startParsing() tea.Cmd {
 				model:        update.Model,
 				message:      update.Message,
 				detail:       update.Detail,
+				partial:      update.Partial,
 				requestInfo:  update.RequestInfo,
 				responseInfo: update.ResponseInfo,
 			}:
@@ -506,11 +806,11 @@ func (m ClipModel) startParsing() tea.Cmd {
 			}
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		ctx, cancel := context.WithTimeout(ctx, parser.ParseTimeout(description))
 		defer cancel()
 
-		result, err := parser.ParseClipRequestWithProgress(ctx, description, duration, onProgress)
-		resultChan <- clipParseResultMsg{result: result, err: err}
+		results, err := parser.ParseClipRequestsWithProgress(ctx, description, duration, onProgress)
+		resultChan <- clipParseResultMsg{id: id, results: results, err: err}
 	}()
 
 	// Return commands to listen for both progress and result
@@ -522,29 +822,99 @@ func (m ClipModel) startParsing() tea.Cmd {
 	)
 }
 
-// startClipping begins the video clipping process
-func (m ClipModel) startClipping() tea.Cmd {
+// clipCutProgressChan holds the current ffmpeg progress channel
+var clipCutProgressChan chan clipCutProgressMsg
+
+// waitForCutProgress waits for the next ffmpeg progress message
+func waitForCutProgress(ch chan clipCutProgressMsg) tea.Cmd {
 	return func() tea.Msg {
-		params := video.ClipParams{
-			InputPath:  m.videoPath,
-			StartTime:  m.clipRequest.StartTime,
-			EndTime:    m.clipRequest.EndTime,
-			OutputPath: m.outputPath,
+		msg, ok := <-ch
+		if !ok {
+			return nil
 		}
+		return msg
+	}
+}
 
-		err := video.ClipVideo(params)
-		if err != nil {
-			return clipCompleteMsg{err: err}
-		}
+// startClipping begins the video clipping process, reporting ffmpeg's
+// progress for the progress bar
+func (m ClipModel) startClipping() tea.Cmd {
+	progressChan := make(chan clipCutProgressMsg, 100)
+	resultChan := make(chan clipCompleteMsg, 1)
+
+	// Store channel for continued listening
+	clipCutProgressChan = progressChan
+
+	go func() {
+		defer close(progressChan)
 
-		// Get output file info
-		info, _ := os.Stat(m.outputPath)
-		var size int64
-		if info != nil {
-			size = info.Size()
+		// Drop updates the UI hasn't caught up with rather than stall ffmpeg
+		onProgress := func(fraction float64) {
+			select {
+			case progressChan <- clipCutProgressMsg{fraction: fraction}:
+			default:
+			}
 		}
+		resultChan <- m.cutClip(onProgress)
+	}()
+
+	return tea.Batch(
+		waitForCutProgress(progressChan),
+		func() tea.Msg {
+			return <-resultChan
+		},
+	)
+}
 
-		return clipCompleteMsg{outputPath: m.outputPath, outputSize: size}
+// cutClip runs ffmpeg for the confirmed clip
+func (m ClipModel) cutClip(onProgress video.ProgressCallback) clipCompleteMsg {
+	_, fileMode, err := fsmode.FromEnv()
+	if err != nil {
+		return clipCompleteMsg{err: err}
+	}
+	params := video.ClipParams{
+		InputPath:   m.videoPath,
+		StartTime:   m.clipRequest.StartTime,
+		EndTime:     m.clipRequest.EndTime,
+		OutputPath:  m.outputPath,
+		AspectRatio: m.aspect,
+		Progress:    onProgress,
+		FileMode:    fileMode,
+	}
+
+	if m.gif {
+		err = video.ClipToGIF(params, video.GIFOptions{})
+	} else {
+		err = video.ClipVideo(params)
+	}
+	if err != nil {
+		return clipCompleteMsg{err: err}
+	}
+
+	// Get output file info
+	info, _ := os.Stat(m.outputPath)
+	var size int64
+	if info != nil {
+		size = info.Size()
+	}
+
+	return clipCompleteMsg{outputPath: m.outputPath, outputSize: size}
+}
+
+// saveClipThumbnail saves the frame at the middle of the finished clip
+// next to it
+func saveClipThumbnail(clipPath string) tea.Cmd {
+	return func() tea.Msg {
+		_, fileMode, err := fsmode.FromEnv()
+		if err != nil {
+			return clipThumbnailMsg{err: err}
+		}
+		path := video.UniqueOutputPath(video.ThumbnailPath(clipPath))
+		err = video.GenerateThumbnail(clipPath, video.ThumbnailMidpoint, path, video.ThumbOptions{
+			Width:    video.DefaultThumbWidth,
+			FileMode: fileMode,
+		})
+		return clipThumbnailMsg{path: path, err: err}
 	}
 }
 
@@ -574,6 +944,8 @@ func (m ClipModel) View() string {
 		b.WriteString(m.renderParsing())
 	case CStepConfirm:
 		b.WriteString(m.renderConfirmation())
+	case CStepEditTimes:
+		b.WriteString(m.renderEditTimes())
 	case CStepClipping:
 		b.WriteString(m.renderClipping())
 	case CStepComplete:
@@ -635,10 +1007,16 @@ func (m ClipModel) renderDescriptionInput() string {
   "start at 1:23, end at 4:56"
   "last 45 seconds"`)
 
+	notice := ""
+	if m.parseNotice != "" {
+		notice = WarningStyle.Render(m.parseNotice) + "\n\n"
+	}
+
 	return BoxStyle.Render(
 		title + "\n" +
 			videoInfo + "\n\n" +
 			examples + "\n\n" +
+			notice +
 			m.textInput.View(),
 	)
 }
@@ -664,7 +1042,10 @@ func (m ClipModel) renderParsing() string {
 		BorderForeground(ColorBorder).
 		Padding(0, 1).
 		Width(m.width - 12)
-	content.WriteString(feedStyle.Render(m.aiFeed.Render()))
+	content.WriteString(feedStyle.Render(m.aiFeed.View()))
+	if hint := m.aiFeed.ScrollHint(); hint != "" {
+		content.WriteString("\n" + MutedStyle.Render("  "+hint+" (up/down, pgup/pgdn to scroll)"))
+	}
 
 	return BoxStyle.Width(m.width - 4).Render(title + "\n\n" + content.String())
 }
@@ -675,6 +1056,12 @@ func (m ClipModel) renderConfirmation() string {
 
 	// Show AI feed summary
 	feedSummary := SubtitleStyle.Render("AI Analysis Complete")
+	if m.clipCount > 1 {
+		feedSummary = SubtitleStyle.Render(fmt.Sprintf("Clip %d of %d", m.clipNumber, m.clipCount))
+		if n := len(m.savedClips); n > 0 {
+			feedSummary += "\n" + MutedStyle.Render("Saved "+filepath.Base(m.savedClips[n-1]))
+		}
+	}
 
 	// Calculate clip duration
 	clipDuration, _ := video.CalculateClipDuration(m.clipRequest.StartTime, m.clipRequest.EndTime)
@@ -692,12 +1079,34 @@ Output:   %s`,
 		filepath.Base(m.outputPath),
 	)
 
+	var warning string
+	if m.aspect != "" {
+		crop, err := video.PlanAspectCrop(m.videoInfo.Width, m.videoInfo.Height, m.aspect)
+		switch {
+		case err != nil:
+			warning = "\n\n" + WarningStyle.Render(err.Error())
+		case crop.IsNoop():
+			summary += fmt.Sprintf("\nFrame:    %dx%d (already %s)", crop.OutWidth, crop.OutHeight, m.aspect)
+		default:
+			summary += fmt.Sprintf("\nFrame:    %dx%d (%s)", crop.OutWidth, crop.OutHeight, m.aspect)
+		}
+	}
+
 	summaryBox := lipgloss.NewStyle().
 		Border(lipgloss.RoundedBorder()).
 		BorderForeground(ColorSecondary).
 		Padding(1, 2).
 		Render(summary)
 
+	if m.clipRequest.Warning != "" {
+		warning += "\n\n" + WarningStyle.Render(m.clipRequest.Warning)
+	}
+	if m.gif {
+		if size := video.EstimateGIFSize(clipDuration, video.GIFOptions{}); size > video.GIFSizeWarning {
+			warning += "\n\n" + WarningStyle.Render("The GIF may be around "+formatClipFileSize(size)+"; consider a shorter clip")
+		}
+	}
+
 	// Buttons
 	yesStyle := BodyStyle
 	noStyle := BodyStyle
@@ -724,21 +1133,47 @@ Output:   %s`,
 			Padding(0, 2)
 	}
 
+	noLabel := "Cancel"
+	if len(m.pendingClips) > 0 {
+		noLabel = "Skip this clip"
+	}
 	buttons := lipgloss.JoinHorizontal(
 		lipgloss.Center,
 		yesStyle.Render("Yes, clip it!"),
 		"  ",
-		noStyle.Render("Cancel"),
+		noStyle.Render(noLabel),
 	)
 
-	return BoxStyle.Render(title + "\n" + feedSummary + "\n\n" + summaryBox + "\n\n" + buttons)
+	return BoxStyle.Render(title + "\n" + feedSummary + "\n\n" + summaryBox + warning + "\n\n" + buttons)
+}
+
+// renderEditTimes renders the timestamp editor
+func (m ClipModel) renderEditTimes() string {
+	title := TitleStyle.Render("Adjust Clip Times")
+
+	videoInfo := MutedStyle.Render(fmt.Sprintf("Video: %s | Duration: %s",
+		m.videoInfo.Filename,
+		video.FormatDuration(m.videoInfo.Duration)))
+
+	hint := MutedStyle.Render("HH:MM:SS, MM:SS or seconds, with optional .mmm")
+
+	content := title + "\n" + videoInfo + "\n\n" +
+		m.startInput.View() + "\n" +
+		m.endInput.View() + "\n\n" +
+		hint
+	if m.editError != "" {
+		content += "\n\n" + ErrorStyle.Render(m.editError)
+	}
+
+	return BoxStyle.Render(content)
 }
 
 // renderClipping renders the clipping progress
 func (m ClipModel) renderClipping() string {
 	title := TitleStyle.Render("Clipping Video...")
 
-	content := m.spinner.View() + " " + BodyStyle.Render("Processing with ffmpeg...")
+	content := m.spinner.View() + " " + BodyStyle.Render("Processing with ffmpeg...") +
+		"\n\n" + m.progress.View() + " " + MutedStyle.Render(fmt.Sprintf("%3.0f%%", m.cutProgress*100))
 
 	return BoxStyle.Render(title + "\n\n" + content)
 }
@@ -756,6 +1191,15 @@ Time:     %s`,
 		formatClipFileSize(m.outputSize),
 		formatDuration(elapsed),
 	)
+	if len(m.savedClips) > 1 {
+		summary = fmt.Sprintf(`Output:   %s
+Clips:    %d of %d
+Time:     %s`,
+			strings.Join(m.savedClips, "\n          "),
+			len(m.savedClips), m.clipCount,
+			formatDuration(elapsed),
+		)
+	}
 
 	summaryBox := lipgloss.NewStyle().
 		Border(lipgloss.RoundedBorder()).
@@ -763,9 +1207,13 @@ Time:     %s`,
 		Padding(1, 2).
 		Render(summary)
 
-	hint := MutedStyle.Render("\n[a] Another clip  [q] Quit")
+	if m.thumbNotice != "" {
+		summaryBox += "\n" + MutedStyle.Render(m.thumbNotice)
+	}
+
+	hint := MutedStyle.Render("\n[a] Another clip  [t] Save thumbnail  [s] Save AI log  [q] Quit")
 
-	return BoxStyle.Render(title + "\n\n" + summaryBox + hint)
+	return BoxStyle.Render(title + "\n\n" + summaryBox + "\n\n" + renderFeedHistory(m.aiFeed, m.width, m.feedNotice) + hint)
 }
 
 // renderError renders the error screen
@@ -778,9 +1226,9 @@ func (m ClipModel) renderError() string {
 		Padding(1, 2).
 		Render(m.errorMessage)
 
-	hint := MutedStyle.Render("\n[r] Retry  [q] Quit")
+	hint := MutedStyle.Render("\n[r] Retry  [s] Save AI log  [q] Quit")
 
-	return BoxStyle.Render(title + "\n\n" + errorBox + hint)
+	return BoxStyle.Render(title + "\n\n" + errorBox + "\n\n" + renderFeedHistory(m.aiFeed, m.width, m.feedNotice) + hint)
 }
 
 // renderHelp renders context-sensitive help
@@ -795,10 +1243,31 @@ func (m ClipModel) renderHelp() string {
 		keys = append(keys, "enter", "Submit")
 	case CStepConfirm:
 		keys = append(keys, "y", "Yes")
-		keys = append(keys, "n", "No")
+		if len(m.pendingClips) > 0 {
+			keys = append(keys, "n", "Skip clip")
+		} else {
+			keys = append(keys, "n", "No")
+		}
+		keys = append(keys, "e", "Edit times")
+		if m.gif {
+			keys = append(keys, "g", "Export video")
+		} else {
+			keys = append(keys, "g", "Export GIF")
+		}
+		keys = append(keys, "a", "Aspect: "+aspectLabel(m.aspect))
+	case CStepEditTimes:
+		keys = append(keys, "tab", "Switch field")
+		keys = append(keys, "enter", "Apply")
+	case CStepParsing:
+		keys = append(keys, "up/down/pgup/pgdn", "Scroll AI feed")
+		keys = append(keys, "esc/ctrl+c", "Cancel")
+	case CStepComplete, CStepError:
+		keys = append(keys, "up/down/pgup/pgdn", "Scroll AI feed")
 	}
 
-	if m.step != CStepParsing && m.step != CStepClipping && m.step != CStepComplete && m.step != CStepError {
+	if m.step == CStepEditTimes {
+		keys = append(keys, "esc", "Discard")
+	} else if m.step != CStepParsing && m.step != CStepClipping && m.step != CStepComplete && m.step != CStepError {
 		keys = append(keys, "esc", "Back")
 		keys = append(keys, "q", "Quit")
 	}
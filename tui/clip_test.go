@@ -0,0 +1,295 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"capycut/ai"
+	"capycut/video"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// TestClipModelEditTimes tests nudging the parsed times from the
+// confirmation screen without another AI call
+func TestClipModelEditTimes(t *testing.T) {
+	newConfirm := func() ClipModel {
+		m := NewClipModel("/videos/talk.mp4")
+		m.videoInfo = &video.VideoInfo{Filename: "talk.mp4", Duration: 10 * time.Minute}
+		m.clipRequest = &ai.ClipRequest{StartTime: "00:01:00", EndTime: "00:02:00"}
+		m.step = CStepConfirm
+		return m
+	}
+	press := func(m ClipModel, key tea.KeyMsg) ClipModel {
+		newModel, _ := m.Update(key)
+		return newModel.(ClipModel)
+	}
+	runes := func(s string) tea.KeyMsg {
+		return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+	}
+
+	m := press(newConfirm(), runes("e"))
+	if m.step != CStepEditTimes {
+		t.Fatalf("step = %v after e, want CStepEditTimes", m.step)
+	}
+	if m.startInput.Value() != "00:01:00" || m.endInput.Value() != "00:02:00" {
+		t.Errorf("inputs = %q, %q; want the parsed times", m.startInput.Value(), m.endInput.Value())
+	}
+
+	// Enter without changes goes straight back
+	if m = press(m, tea.KeyMsg{Type: tea.KeyEnter}); m.step != CStepConfirm || m.clipRequest.StartTime != "00:01:00" {
+		t.Errorf("step = %v, start = %s after enter; want unchanged confirm", m.step, m.clipRequest.StartTime)
+	}
+
+	// Edit the end time, which also renames the output
+	m = press(m, runes("e"))
+	m = press(m, tea.KeyMsg{Type: tea.KeyTab})
+	m.endInput.SetValue("2:01.5")
+	m = press(m, tea.KeyMsg{Type: tea.KeyEnter})
+	if m.step != CStepConfirm {
+		t.Fatalf("step = %v after applying, want CStepConfirm (error %q)", m.step, m.editError)
+	}
+	if m.clipRequest.EndTime != "00:02:01.500" {
+		t.Errorf("EndTime = %q, want 00:02:01.500", m.clipRequest.EndTime)
+	}
+	if !strings.Contains(m.outputPath, "00-02-01") {
+		t.Errorf("outputPath = %q, want it to use the new end time", m.outputPath)
+	}
+
+	// Invalid times keep the editor open with an error; q is typed, not quit
+	m = press(m, runes("e"))
+	m = press(m, runes("q"))
+	if m.quitting {
+		t.Fatal("q quit while editing times")
+	}
+	m = press(m, tea.KeyMsg{Type: tea.KeyEnter})
+	if m.step != CStepEditTimes || m.editError == "" {
+		t.Errorf("step = %v, error = %q; want the editor to stay open with an error", m.step, m.editError)
+	}
+
+	// Esc discards the edits
+	m = press(m, tea.KeyMsg{Type: tea.KeyEsc})
+	if m.step != CStepConfirm || m.clipRequest.StartTime != "00:01:00" {
+		t.Errorf("step = %v, start = %s after esc; want confirm with the previous times", m.step, m.clipRequest.StartTime)
+	}
+}
+
+func TestClipModelAspectSelect(t *testing.T) {
+	m := NewClipModel("/videos/talk.mp4")
+	m.videoInfo = &video.VideoInfo{Filename: "talk.mp4", Duration: 10 * time.Minute, Width: 1920, Height: 1080}
+	m.clipRequest = &ai.ClipRequest{StartTime: "00:01:00", EndTime: "00:02:00"}
+	m.step = CStepConfirm
+
+	var got []string
+	for range len(video.AspectRatios) + 1 {
+		newModel, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")})
+		m = newModel.(ClipModel)
+		got = append(got, m.aspect)
+	}
+	if want := append(append([]string{}, video.AspectRatios...), ""); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("aspect after each a = %q, want %q", got, want)
+	}
+
+	m.aspect = "9:16"
+	if view := m.renderConfirmation(); !strings.Contains(view, "606x1080 (9:16)") {
+		t.Errorf("confirmation doesn't show the cropped frame:\n%s", view)
+	}
+}
+
+func TestClipModelCutProgress(t *testing.T) {
+	m := NewClipModel("/videos/talk.mp4")
+	m.step = CStepClipping
+
+	newModel, cmd := m.Update(clipCutProgressMsg{fraction: 0.5})
+	m = newModel.(ClipModel)
+	if m.cutProgress != 0.5 {
+		t.Errorf("cutProgress = %v, want 0.5", m.cutProgress)
+	}
+	if cmd == nil {
+		t.Error("expected a command animating the progress bar")
+	}
+	if view := m.renderClipping(); !strings.Contains(view, "50%") {
+		t.Errorf("clipping view doesn't show the progress:\n%s", view)
+	}
+}
+
+func TestClipModelCancelParsing(t *testing.T) {
+	for _, key := range []tea.KeyMsg{{Type: tea.KeyEsc}, {Type: tea.KeyCtrlC}} {
+		t.Run(key.String(), func(t *testing.T) {
+			m := NewClipModel("/videos/talk.mp4")
+			m.videoInfo = &video.VideoInfo{Filename: "talk.mp4", Duration: 10 * time.Minute}
+			m.textInput.SetValue("the bit where they laugh")
+
+			// A parse in flight, as started from the description step
+			ctx, cancel := context.WithCancel(m.ctx)
+			m.parseCancel = cancel
+			m.parseID = 1
+			m.step = CStepParsing
+
+			newModel, _ := m.Update(key)
+			m = newModel.(ClipModel)
+			if m.step != CStepEnterDescription || m.quitting {
+				t.Fatalf("step = %v, quitting = %v; want back at the description", m.step, m.quitting)
+			}
+			if ctx.Err() == nil {
+				t.Error("the parse context was not cancelled")
+			}
+			if m.textInput.Value() != "the bit where they laugh" || m.parseNotice == "" {
+				t.Errorf("description = %q, notice = %q; want it kept with a notice", m.textInput.Value(), m.parseNotice)
+			}
+
+			// The cancelled parse reporting back is ignored
+			newModel, _ = m.Update(clipParseResultMsg{id: 1, err: context.Canceled})
+			if m = newModel.(ClipModel); m.step != CStepEnterDescription || m.errorMessage != "" {
+				t.Errorf("step = %v, error = %q after the stale result; want it ignored", m.step, m.errorMessage)
+			}
+		})
+	}
+}
+
+// TestGetClipProviders tests that the clip provider picker lists every
+// configured provider, auto-detected one first
+func TestGetClipProviders(t *testing.T) {
+	for _, key := range []string{"LLM_ENDPOINT", "LLM_MODEL", "AZURE_ANTHROPIC_ENDPOINT", "AZURE_ANTHROPIC_API_KEY", "ANTHROPIC_API_KEY", "AZURE_OPENAI_ENDPOINT", "AZURE_OPENAI_API_KEY", "AZURE_OPENAI_MODEL", "OPENAI_API_KEY"} {
+		t.Setenv(key, "")
+	}
+
+	if got := getClipProviders(); len(got) != 0 {
+		t.Fatalf("getClipProviders() = %v with nothing configured, want none", got)
+	}
+
+	t.Setenv("LLM_ENDPOINT", "http://localhost:1234")
+	t.Setenv("LLM_MODEL", "llama3.2")
+	t.Setenv("AZURE_ANTHROPIC_ENDPOINT", "https://example.services.ai.azure.com")
+	t.Setenv("AZURE_ANTHROPIC_API_KEY", "key")
+
+	got := getClipProviders()
+	if len(got) != 2 {
+		t.Fatalf("getClipProviders() returned %d providers, want 2", len(got))
+	}
+	if got[0].provider != ai.ProviderLocal || got[1].provider != ai.ProviderAzureAnthropic {
+		t.Errorf("providers = %v, %v; want local then azure_anthropic", got[0].provider, got[1].provider)
+	}
+	if !strings.Contains(got[0].desc, "llama3.2") || !strings.Contains(got[0].desc, "(default)") {
+		t.Errorf("local desc = %q, want the model and default marker", got[0].desc)
+	}
+	if strings.Contains(got[1].desc, "(default)") {
+		t.Errorf("second desc = %q, want no default marker", got[1].desc)
+	}
+
+	// Two providers stop at the picker instead of choosing one
+	m := NewClipModel("/videos/talk.mp4")
+	newModel, _ := m.Update(clipVideoInfoMsg{info: &video.VideoInfo{Filename: "talk.mp4", Duration: time.Minute}})
+	if step := newModel.(ClipModel).step; step != CStepSelectProvider {
+		t.Errorf("step = %v, want CStepSelectProvider", step)
+	}
+}
+
+func TestClipModelSaveThumbnail(t *testing.T) {
+	m := NewClipModel("/videos/talk.mp4")
+	m.outputPath = "/videos/talk_00-01-00_00-02-00.mp4"
+	m.step = CStepComplete
+
+	newModel, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("t")})
+	m = newModel.(ClipModel)
+	if cmd == nil {
+		t.Fatal("expected a command saving the thumbnail")
+	}
+	if m.step != CStepComplete || m.thumbNotice == "" {
+		t.Errorf("step = %v, notice = %q; want the complete screen to report progress", m.step, m.thumbNotice)
+	}
+
+	newModel, _ = m.Update(clipThumbnailMsg{path: "/videos/talk_00-01-00_00-02-00_thumb.jpg"})
+	m = newModel.(ClipModel)
+	if view := m.renderComplete(); !strings.Contains(view, "Thumbnail saved to /videos/talk_00-01-00_00-02-00_thumb.jpg") {
+		t.Errorf("complete screen doesn't show the thumbnail:\n%s", view)
+	}
+
+	newModel, _ = m.Update(clipThumbnailMsg{err: errors.New("ffmpeg error")})
+	m = newModel.(ClipModel)
+	if !strings.Contains(m.thumbNotice, "ffmpeg error") {
+		t.Errorf("thumbNotice = %q, want the error", m.thumbNotice)
+	}
+}
+
+// TestClipModelMultipleClips tests that a description of several clips
+// confirms each in turn, and that declining one moves on to the next
+func TestClipModelMultipleClips(t *testing.T) {
+	update := func(m ClipModel, msg tea.Msg) ClipModel {
+		newModel, _ := m.Update(msg)
+		return newModel.(ClipModel)
+	}
+	skip := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("n")}
+
+	m := NewClipModel("/videos/talk.mp4")
+	m.videoInfo = &video.VideoInfo{Filename: "talk.mp4", Duration: 10 * time.Minute}
+	m.step = CStepParsing
+	m.parseCancel = func() {}
+	m = update(m, clipParseResultMsg{id: m.parseID, results: []*ai.ClipRequest{
+		{StartTime: "00:00:00", EndTime: "00:02:00"},
+		{StartTime: "00:05:00", EndTime: "00:06:00"},
+		{StartTime: "00:09:30", EndTime: "00:10:00"},
+	}})
+	if m.step != CStepConfirm || m.clipNumber != 1 || m.clipCount != 3 || m.clipRequest.StartTime != "00:00:00" {
+		t.Fatalf("after parsing: step %v, clip %d of %d starting %s; want the first of 3 to confirm", m.step, m.clipNumber, m.clipCount, m.clipRequest.StartTime)
+	}
+	if view := m.View(); !strings.Contains(view, "Clip 1 of 3") {
+		t.Errorf("confirmation doesn't number the clip:\n%s", view)
+	}
+
+	// Declining the first clip offers the second
+	m = update(m, skip)
+	if m.step != CStepConfirm || m.clipNumber != 2 || m.clipRequest.StartTime != "00:05:00" || m.backToMenu {
+		t.Fatalf("after skipping: step %v, clip %d starting %s; want the second to confirm", m.step, m.clipNumber, m.clipRequest.StartTime)
+	}
+
+	// A finished cut moves on too, and the last decline shows what was cut
+	m.step = CStepClipping
+	m = update(m, clipCompleteMsg{outputPath: "/videos/talk_clip_2.mp4", outputSize: 1024})
+	if m.step != CStepConfirm || m.clipNumber != 3 {
+		t.Fatalf("after cutting: step %v, clip %d; want the third to confirm", m.step, m.clipNumber)
+	}
+	m = update(m, skip)
+	if m.step != CStepComplete || m.outputPath != "/videos/talk_clip_2.mp4" || m.backToMenu {
+		t.Errorf("after skipping the last: step %v, output %q; want the cut clip shown", m.step, m.outputPath)
+	}
+
+	// Invalid clips fail the whole description before any is offered
+	m = NewClipModel("/videos/talk.mp4")
+	m.videoInfo = &video.VideoInfo{Filename: "talk.mp4", Duration: 10 * time.Minute}
+	m.step = CStepParsing
+	m.parseCancel = func() {}
+	m = update(m, clipParseResultMsg{id: m.parseID, results: []*ai.ClipRequest{
+		{StartTime: "00:00:00", EndTime: "00:02:00"},
+		{StartTime: "00:11:00", EndTime: "00:12:00"},
+	}})
+	if m.step != CStepError || !strings.Contains(m.errorMessage, "clip 2") {
+		t.Errorf("step = %v, error %q; want an error naming clip 2", m.step, m.errorMessage)
+	}
+}
+
+// TestClipModelStreamedProgress tests that streamed parser updates share one feed message
+func TestClipModelStreamedProgress(t *testing.T) {
+	m := NewClipModel("video.mp4")
+	for _, msg := range []clipProgressMsg{
+		{status: ai.ParserStatusWaitingResponse, message: "Waiting for Local LLM response"},
+		{status: ai.ParserStatusWaitingResponse, message: "Receiving (5 chars)", detail: `{"sta`, partial: true},
+		{status: ai.ParserStatusWaitingResponse, message: "Receiving (12 chars)", detail: `{"start_time`, partial: true},
+		{status: ai.ParserStatusParsingResponse, message: "Response received"},
+	} {
+		updated, _ := m.Update(msg)
+		m = updated.(ClipModel)
+	}
+
+	var titles []string
+	for _, msg := range m.aiFeed.Messages {
+		titles = append(titles, msg.Title)
+	}
+	want := []string{"Waiting for Local LLM response", "Receiving (12 chars)", "Response received"}
+	if strings.Join(titles, "|") != strings.Join(want, "|") {
+		t.Errorf("feed titles = %q, want %q", titles, want)
+	}
+}
@@ -2,6 +2,7 @@ package tui
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,7 +10,9 @@ import (
 	"strings"
 	"time"
 
+	"capycut/fsmode"
 	"capycut/gemini"
+	"capycut/llm"
 
 	"github.com/charmbracelet/bubbles/progress"
 	"github.com/charmbracelet/bubbles/spinner"
@@ -34,6 +37,7 @@ const (
 	TStepSelectOptions
 	TStepConfirm
 	TStepTranscribing
+	TStepConfirmPartial
 	TStepWriting
 	TStepComplete
 	TStepError
@@ -104,6 +108,7 @@ type TranscribeModel struct {
 	currentBatch       int
 	totalBatches       int
 	statusMessage      string
+	eta                etaEstimator
 
 	// AI Agent status tracking
 	aiStatus      gemini.ProgressStatus
@@ -118,6 +123,15 @@ type TranscribeModel struct {
 	// Unified AI Feed for transparency
 	aiFeed *AIFeed
 
+	// feedNotice reports the result of saving the feed with "s"
+	feedNotice string
+
+	// Estimate for the confirm screen; estimateSeq drops results from an
+	// earlier visit when the user went back and changed a setting
+	estimate    string
+	estimateErr error
+	estimateSeq int
+
 	// Results
 	result       *gemini.TranscribeResponse
 	writeResult  *gemini.WriteResult
@@ -132,6 +146,7 @@ type TranscribeModel struct {
 	confirmed  bool
 	quitting   bool
 	backToMenu bool
+	cancelling bool // Esc pressed, waiting for in-flight batches to stop
 
 	// Menu indices
 	sourceMenuIndex int
@@ -154,6 +169,13 @@ type writeResultMsg struct {
 	err    error
 }
 
+// transcribeEstimateMsg carries the confirm screen's estimate
+type transcribeEstimateMsg struct {
+	seq     int
+	summary string
+	err     error
+}
+
 // imagesLoadedMsg is sent when images are loaded
 type imagesLoadedMsg struct {
 	images    []string
@@ -172,18 +194,19 @@ type progressMsg struct {
 
 // aiProgressMsg carries AI progress updates from the transcription goroutine
 type aiProgressMsg struct {
-	status       gemini.ProgressStatus
-	provider     string
-	model        string
-	message      string
-	detail       string
-	progress     float64
-	currentBatch int
-	totalBatches int
-	tokensUsed   int
-	elapsed      string
-	stage        int
-	totalStages  int
+	status           gemini.ProgressStatus
+	provider         string
+	model            string
+	message          string
+	detail           string
+	progress         float64
+	currentBatch     int
+	totalBatches     int
+	completedBatches int
+	tokensUsed       int
+	elapsed          string
+	stage            int
+	totalStages      int
 	// Transparency info
 	requestInfo  *gemini.AIRequestInfo
 	responseInfo *gemini.AIResponseInfo
@@ -200,6 +223,8 @@ func convertStatusToFeedType(status gemini.ProgressStatus) AIFeedMessageType {
 		return MsgTypeThinking
 	case gemini.StatusError:
 		return MsgTypeError
+	case gemini.StatusWarning:
+		return MsgTypeWarning
 	default:
 		return MsgTypeStatus
 	}
@@ -236,36 +261,33 @@ var (
 // getAvailableProviders returns a list of configured AI providers
 func getAvailableProviders() []providerOption {
 	var providers []providerOption
-
-	// Check for Local LLM endpoint
-	if os.Getenv("LLM_ENDPOINT") != "" || os.Getenv("IMAGE_LLM_ENDPOINT") != "" {
-		endpoint := os.Getenv("LLM_ENDPOINT")
-		if endpoint == "" {
-			endpoint = os.Getenv("IMAGE_LLM_ENDPOINT")
+	for _, p := range gemini.GetAvailableProviders() {
+		switch p {
+		case gemini.ProviderLocal:
+			providers = append(providers, providerOption{
+				name:     fmt.Sprintf("Local LLM (%s)", llm.FirstEnv("LLM_ENDPOINT", "IMAGE_LLM_ENDPOINT")),
+				provider: p,
+				desc:     "Free, runs on your machine",
+			})
+		case gemini.ProviderAzureAnthropic:
+			providers = append(providers, providerOption{
+				name:     "Azure Anthropic (Claude)",
+				provider: p,
+				desc:     "Claude models via Azure",
+			})
+		case gemini.ProviderAnthropic:
+			providers = append(providers, providerOption{
+				name:     "Anthropic (Claude)",
+				provider: p,
+				desc:     "Claude models via api.anthropic.com",
+			})
+		case gemini.ProviderGemini:
+			providers = append(providers, providerOption{
+				name:     "Google Gemini",
+				provider: p,
+				desc:     "Cloud API",
+			})
 		}
-		providers = append(providers, providerOption{
-			name:     fmt.Sprintf("Local LLM (%s)", endpoint),
-			provider: gemini.ProviderLocal,
-			desc:     "Free, runs on your machine",
-		})
-	}
-
-	// Check for Azure Anthropic
-	if os.Getenv("AZURE_ANTHROPIC_ENDPOINT") != "" {
-		providers = append(providers, providerOption{
-			name:     "Azure Anthropic (Claude)",
-			provider: gemini.ProviderAzureAnthropic,
-			desc:     "Claude models via Azure",
-		})
-	}
-
-	// Check for Gemini API key
-	if os.Getenv("GEMINI_API_KEY") != "" || os.Getenv("GOOGLE_API_KEY") != "" {
-		providers = append(providers, providerOption{
-			name:     "Google Gemini",
-			provider: gemini.ProviderGemini,
-			desc:     "Cloud API",
-		})
 	}
 
 	// If no providers configured, show all as unconfigured
@@ -273,6 +295,7 @@ func getAvailableProviders() []providerOption {
 		providers = []providerOption{
 			{"Local LLM (not configured)", gemini.ProviderLocal, "Set LLM_ENDPOINT"},
 			{"Azure Anthropic (not configured)", gemini.ProviderAzureAnthropic, "Set AZURE_ANTHROPIC_ENDPOINT"},
+			{"Anthropic (not configured)", gemini.ProviderAnthropic, "Set ANTHROPIC_API_KEY"},
 			{"Google Gemini (not configured)", gemini.ProviderGemini, "Set GEMINI_API_KEY"},
 		}
 	}
@@ -284,13 +307,7 @@ func getAvailableProviders() []providerOption {
 func getModelsForProvider(provider gemini.Provider) []modelOption {
 	switch provider {
 	case gemini.ProviderLocal:
-		defaultModel := os.Getenv("LLM_MODEL")
-		if defaultModel == "" {
-			defaultModel = os.Getenv("IMAGE_LLM_MODEL")
-		}
-		if defaultModel == "" {
-			defaultModel = "local-model"
-		}
+		defaultModel := gemini.DefaultModelFor(gemini.ProviderLocal)
 		models := []modelOption{
 			{fmt.Sprintf("Default (%s)", defaultModel), defaultModel, "From environment"},
 		}
@@ -310,8 +327,11 @@ func getModelsForProvider(provider gemini.Provider) []modelOption {
 		}
 		return models
 
-	case gemini.ProviderAzureAnthropic:
+	case gemini.ProviderAzureAnthropic, gemini.ProviderAnthropic:
 		envModel := os.Getenv("AZURE_ANTHROPIC_MODEL")
+		if provider == gemini.ProviderAnthropic {
+			envModel = os.Getenv("ANTHROPIC_MODEL")
+		}
 		var models []modelOption
 		if envModel != "" {
 			models = append(models, modelOption{
@@ -319,7 +339,7 @@ func getModelsForProvider(provider gemini.Provider) []modelOption {
 			})
 		}
 		models = append(models,
-			modelOption{"Claude Sonnet 4", "claude-sonnet-4-20250514", "Latest Sonnet"},
+			modelOption{"Claude Sonnet 4", gemini.DefaultAnthropicModel, "Latest Sonnet"},
 			modelOption{"Claude 3.5 Sonnet", "claude-3-5-sonnet-20241022", "Previous Sonnet"},
 			modelOption{"Claude 3 Opus", "claude-3-opus-20240229", "Most capable"},
 			modelOption{"Claude 3 Haiku", "claude-3-haiku-20240307", "Fast & light"},
@@ -329,6 +349,7 @@ func getModelsForProvider(provider gemini.Provider) []modelOption {
 	case gemini.ProviderGemini:
 		return []modelOption{
 			{"Gemini 3 Pro", gemini.ModelGemini3Pro, "Latest, most capable"},
+			{"Gemini 3 Pro Thinking", gemini.ModelGemini3ProThinking, "Reasons first; slower, thinking billed as output"},
 			{"Gemini 2.5 Flash", gemini.ModelGemini25Flash, "Fast & efficient"},
 		}
 
@@ -469,8 +490,8 @@ func loadDirectoryEntries(dir string) ([]FileEntry, error) {
 		if files[i].IsDir != files[j].IsDir {
 			return files[i].IsDir
 		}
-		// Alphabetical
-		return strings.ToLower(files[i].Name) < strings.ToLower(files[j].Name)
+		// Natural order, so page2.png comes before page10.png
+		return gemini.NaturalLess(files[i].Name, files[j].Name)
 	})
 
 	return files, nil
@@ -564,7 +585,7 @@ func (m TranscribeModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if chatHeight > 15 {
 			chatHeight = 15
 		}
-		m.aiFeed.SetSize(m.width-12, chatHeight)
+		m.aiFeed.SetSize(m.width-14, chatHeight)
 
 		return m, nil
 
@@ -578,6 +599,14 @@ func (m TranscribeModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, tea.Quit
 			}
 		case "esc":
+			if m.step == TStepTranscribing && !m.cancelling {
+				// Stop in-flight work and wait for completed pages to come back
+				m.cancel()
+				m.cancelling = true
+				m.aiMessage = "Cancelling..."
+				m.aiDetail = "Waiting for in-flight batches to stop"
+				return m, nil
+			}
 			if m.step == TStepTranscribing || m.step == TStepWriting {
 				// Cancel in progress
 				m.cancel()
@@ -617,8 +646,22 @@ func (m TranscribeModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case transcribeResultMsg:
+		if m.step != TStepTranscribing {
+			// Result arrived after the user already left the transcribing view
+			return m, nil
+		}
 		if msg.err != nil {
+			// Offer to keep pages that finished before cancellation
+			if errors.Is(msg.err, context.Canceled) && msg.response != nil && len(msg.response.Documents) > 0 {
+				m.result = msg.response
+				m.confirmIndex = 0
+				m.step = TStepConfirmPartial
+				return m, nil
+			}
 			m.errorMessage = msg.err.Error()
+			if m.cancelling {
+				m.errorMessage = "Cancelled by user"
+			}
 			m.step = TStepError
 			return m, nil
 		}
@@ -626,6 +669,12 @@ func (m TranscribeModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.step = TStepWriting
 		return m, m.writeDocuments()
 
+	case transcribeEstimateMsg:
+		if msg.seq == m.estimateSeq {
+			m.estimate, m.estimateErr = msg.summary, msg.err
+		}
+		return m, nil
+
 	case writeResultMsg:
 		if msg.err != nil {
 			m.errorMessage = msg.err.Error()
@@ -653,6 +702,7 @@ func (m TranscribeModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.currentBatch = msg.currentBatch
 		m.totalBatches = msg.totalBatches
 		m.aiTokensUsed = msg.tokensUsed
+		m.eta.observe(msg.completedBatches, time.Now())
 		m.aiStage = msg.stage
 		m.aiTotalStages = msg.totalStages
 
@@ -798,7 +848,7 @@ func (m TranscribeModel) handleStepInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			if pattern != "" {
 				m.inputPattern = pattern
 				m.step = TStepLoadingImages
-				return m, m.loadImages([]string{pattern})
+				return m, m.loadImages(gemini.SplitPatterns(pattern))
 			}
 		default:
 			// Forward all other keys to the text input for typing
@@ -887,6 +937,9 @@ func (m TranscribeModel) handleStepInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.options[m.optionIndex] = !m.options[m.optionIndex]
 		case "enter":
 			m.step = TStepConfirm
+			m.estimateSeq++
+			m.estimate, m.estimateErr = "", nil
+			return m, m.estimateTranscription()
 		}
 
 	case TStepConfirm:
@@ -905,6 +958,7 @@ func (m TranscribeModel) handleStepInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 				m.confirmed = true
 				m.step = TStepTranscribing
 				m.startTime = time.Now()
+				m.eta = newETAEstimator(m.startTime)
 				return m, m.startTranscription()
 			} else {
 				// Cancel
@@ -915,12 +969,41 @@ func (m TranscribeModel) handleStepInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.confirmed = true
 			m.step = TStepTranscribing
 			m.startTime = time.Now()
+			m.eta = newETAEstimator(m.startTime)
 			return m, m.startTranscription()
 		case "n", "N":
 			m.backToMenu = true
 			return m, tea.Quit
 		}
 
+	case TStepConfirmPartial:
+		switch msg.String() {
+		case "up", "k", "left", "h":
+			if m.confirmIndex > 0 {
+				m.confirmIndex--
+			}
+		case "down", "j", "right", "l":
+			if m.confirmIndex < 1 {
+				m.confirmIndex++
+			}
+		case "enter":
+			if m.confirmIndex == 0 {
+				m.step = TStepWriting
+				return m, m.writeDocuments()
+			}
+			m.errorMessage = "Cancelled by user"
+			m.step = TStepError
+		case "y", "Y":
+			m.step = TStepWriting
+			return m, m.writeDocuments()
+		case "n", "N":
+			m.errorMessage = "Cancelled by user"
+			m.step = TStepError
+		}
+
+	case TStepTranscribing, TStepWriting:
+		m.aiFeed.HandleKey(msg)
+
 	case TStepComplete:
 		switch msg.String() {
 		case "enter", "q":
@@ -929,6 +1012,10 @@ func (m TranscribeModel) handleStepInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			// Start another transcription
 			newModel := NewTranscribeModel()
 			return newModel, newModel.Init()
+		case "s":
+			m.feedNotice = saveFeedLog(m.aiFeed, m.outputDir)
+		default:
+			m.aiFeed.HandleKey(msg)
 		}
 
 	case TStepError:
@@ -939,6 +1026,10 @@ func (m TranscribeModel) handleStepInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			return newModel, newModel.Init()
 		case "q":
 			return m, tea.Quit
+		case "s":
+			m.feedNotice = saveFeedLog(m.aiFeed, m.outputDir)
+		default:
+			m.aiFeed.HandleKey(msg)
 		}
 	}
 
@@ -999,6 +1090,31 @@ func waitForProgress(ch chan aiProgressMsg) tea.Cmd {
 	}
 }
 
+// newProgressMsg converts a transcription progress update for the view
+func newProgressMsg(update gemini.ProgressUpdate) aiProgressMsg {
+	elapsed := ""
+	if update.Elapsed > 0 {
+		elapsed = formatDuration(update.Elapsed)
+	}
+	return aiProgressMsg{
+		status:           update.Status,
+		provider:         update.Provider,
+		model:            update.Model,
+		message:          update.Message,
+		detail:           update.Detail,
+		progress:         update.Progress,
+		currentBatch:     update.CurrentBatch,
+		totalBatches:     update.TotalBatches,
+		completedBatches: update.CompletedBatches,
+		tokensUsed:       update.TokensUsed,
+		elapsed:          elapsed,
+		stage:            update.Stage,
+		totalStages:      update.TotalStages,
+		requestInfo:      update.RequestInfo,
+		responseInfo:     update.ResponseInfo,
+	}
+}
+
 // transcribeProgressChan holds the current progress channel
 var transcribeProgressChan chan aiProgressMsg
 
@@ -1022,6 +1138,7 @@ func (m TranscribeModel) startTranscription() tea.Cmd {
 	outputDir := m.outputDir
 	orgMode := m.orgMode
 	options := m.options
+	parentCtx := m.ctx
 
 	// Start the transcription goroutine
 	go func() {
@@ -1032,6 +1149,57 @@ func (m TranscribeModel) startTranscription() tea.Cmd {
 		var err error
 
 		debug := os.Getenv("CAPYCUT_DEBUG") != ""
+		clientOpts := []gemini.ClientOption{gemini.WithDebug(debug)}
+
+		requestTimeout, err := gemini.RequestTimeoutFromEnv()
+		if err != nil {
+			resultChan <- transcribeResultMsg{err: err}
+			return
+		}
+		if requestTimeout > 0 {
+			clientOpts = append(clientOpts, gemini.WithTimeout(requestTimeout))
+		}
+		memLimit, err := gemini.MemoryLimitFromEnv()
+		if err != nil {
+			resultChan <- transcribeResultMsg{err: err}
+			return
+		}
+		if memLimit > 0 {
+			clientOpts = append(clientOpts, gemini.WithMemoryLimit(memLimit))
+		}
+		jobTimeout, err := gemini.JobTimeoutFor(len(images))
+		if err != nil {
+			resultChan <- transcribeResultMsg{err: err}
+			return
+		}
+		localResize, err := gemini.LocalResizeFromEnv()
+		if err != nil {
+			resultChan <- transcribeResultMsg{err: err}
+			return
+		}
+		thinkingBudget, err := gemini.ThinkingBudgetFromEnv()
+		if err != nil {
+			resultChan <- transcribeResultMsg{err: err}
+			return
+		}
+		concurrency, err := gemini.ConcurrencyFromEnv()
+		if err != nil {
+			resultChan <- transcribeResultMsg{err: err}
+			return
+		}
+		fallbacks, err := gemini.FallbackClientsFromEnv(provider, clientOpts...)
+		if err != nil {
+			resultChan <- transcribeResultMsg{err: err}
+			return
+		}
+		if len(fallbacks) > 0 {
+			clientOpts = append(clientOpts, gemini.WithFallback(fallbacks...))
+		}
+
+		// Never send an empty model; each provider has its own default
+		if model == "" && provider != "" {
+			model = gemini.DefaultModelFor(provider)
+		}
 
 		switch provider {
 		case gemini.ProviderLocal:
@@ -1043,7 +1211,7 @@ func (m TranscribeModel) startTranscription() tea.Cmd {
 				resultChan <- transcribeResultMsg{err: fmt.Errorf("LLM_ENDPOINT not configured")}
 				return
 			}
-			client, err = gemini.NewLocalClient(endpoint, model, gemini.WithDebug(debug))
+			client, err = gemini.NewLocalClient(endpoint, model, clientOpts...)
 
 		case gemini.ProviderAzureAnthropic:
 			endpoint := os.Getenv("AZURE_ANTHROPIC_ENDPOINT")
@@ -1052,7 +1220,18 @@ func (m TranscribeModel) startTranscription() tea.Cmd {
 				resultChan <- transcribeResultMsg{err: fmt.Errorf("Azure Anthropic not configured")}
 				return
 			}
-			client, err = gemini.NewAzureAnthropicClient(endpoint, apiKey, model, gemini.WithDebug(debug))
+			client, err = gemini.NewAzureAnthropicClient(endpoint, apiKey, model, clientOpts...)
+
+		case gemini.ProviderAnthropic:
+			apiKey := os.Getenv("ANTHROPIC_API_KEY")
+			if apiKey == "" {
+				resultChan <- transcribeResultMsg{err: fmt.Errorf("Anthropic not configured")}
+				return
+			}
+			if baseURL := os.Getenv("ANTHROPIC_BASE_URL"); baseURL != "" {
+				clientOpts = append(clientOpts, gemini.WithBaseURL(baseURL))
+			}
+			client, err = gemini.NewAnthropicClient(apiKey, model, clientOpts...)
 
 		case gemini.ProviderGemini:
 			apiKey := os.Getenv("GEMINI_API_KEY")
@@ -1063,7 +1242,7 @@ func (m TranscribeModel) startTranscription() tea.Cmd {
 				resultChan <- transcribeResultMsg{err: fmt.Errorf("Gemini API key not configured")}
 				return
 			}
-			client, err = gemini.NewClient(apiKey, gemini.WithDebug(debug))
+			client, err = gemini.NewClient(apiKey, clientOpts...)
 
 		default:
 			// Fall back to auto-detection
@@ -1075,6 +1254,11 @@ func (m TranscribeModel) startTranscription() tea.Cmd {
 			return
 		}
 
+		// Auto-detection only tells us the provider now
+		if model == "" {
+			model = gemini.DefaultModelFor(client.GetProvider())
+		}
+
 		req := &gemini.TranscribeRequest{
 			Images:                   images,
 			OutputDir:                outputDir,
@@ -1083,41 +1267,49 @@ func (m TranscribeModel) startTranscription() tea.Cmd {
 			CombinePages:             orgMode == "combine",
 			PreserveFormatting:       options[0],
 			IncludeImageDescriptions: options[1],
+			LocalResize:              &localResize,
+			ThinkingBudget:           thinkingBudget,
+			Concurrency:              concurrency,
 		}
 
-		// Progress callback that sends updates through the channel
-		onProgress := func(update gemini.ProgressUpdate) {
-			elapsed := ""
-			if update.Elapsed > 0 {
-				elapsed = formatDuration(update.Elapsed)
-			}
+		// Forward updates without blocking; the view only needs the latest
+		sendProgress := func(update gemini.ProgressUpdate) {
 			select {
-			case progressChan <- aiProgressMsg{
-				status:       update.Status,
-				provider:     update.Provider,
-				model:        update.Model,
-				message:      update.Message,
-				detail:       update.Detail,
-				progress:     update.Progress,
-				currentBatch: update.CurrentBatch,
-				totalBatches: update.TotalBatches,
-				tokensUsed:   update.TokensUsed,
-				elapsed:      elapsed,
-				stage:        update.Stage,
-				totalStages:  update.TotalStages,
-				requestInfo:  update.RequestInfo,
-				responseInfo: update.ResponseInfo,
-			}:
+			case progressChan <- newProgressMsg(update):
 			default:
 				// Don't block if channel is full
 			}
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+		// Catch a text-only local model before it garbles every page. The
+		// check has its own deadline, so a model that is slow to load
+		// doesn't eat into the job's; Esc still cancels it.
+		if gemini.PreflightEnabled() {
+			preflightCtx, cancelPreflight := context.WithTimeout(parentCtx, gemini.PreflightTimeout)
+			if result, err := client.Preflight(preflightCtx); err == nil {
+				for _, warning := range result.Warnings {
+					sendProgress(gemini.ProgressUpdate{
+						Status:   gemini.StatusWarning,
+						Provider: string(provider),
+						Model:    model,
+						Message:  "Model check",
+						Detail:   warning,
+					})
+				}
+			}
+			cancelPreflight()
+		}
+
+		// Derive from the model context so Esc cancels in-flight requests
+		ctx, cancel := context.WithTimeout(parentCtx, jobTimeout)
 		defer cancel()
 
-		resp, err := client.TranscribeImagesWithProgress(ctx, req, onProgress)
-		resultChan <- transcribeResultMsg{response: resp, err: err}
+		progress, results := client.TranscribeImagesStream(ctx, req)
+		for update := range progress {
+			sendProgress(update)
+		}
+		result := <-results
+		resultChan <- transcribeResultMsg{response: result.Response, err: result.Err}
 	}()
 
 	// Return commands to listen for both progress and result
@@ -1129,6 +1321,61 @@ func (m TranscribeModel) startTranscription() tea.Cmd {
 	)
 }
 
+// estimateTranscription forecasts the tokens, cost and time of the run for
+// the confirm screen. The client is built from the same environment as
+// startTranscription's but never contacts the provider.
+func (m TranscribeModel) estimateTranscription() tea.Cmd {
+	seq := m.estimateSeq
+	provider := m.selectedProvider
+	model := m.selectedModel
+	images := m.images
+	options := m.options
+
+	return func() tea.Msg {
+		var client *gemini.Client
+		var err error
+		if provider == "" {
+			client, err = gemini.NewClientFromEnv()
+		} else {
+			var clientOpts []gemini.ClientOption
+			if model != "" {
+				clientOpts = append(clientOpts, gemini.WithModel(model))
+			}
+			client, err = gemini.NewClientForProviderFromEnv(provider, clientOpts...)
+		}
+		if err != nil {
+			return transcribeEstimateMsg{seq: seq, err: err}
+		}
+
+		localResize, err := gemini.LocalResizeFromEnv()
+		if err != nil {
+			return transcribeEstimateMsg{seq: seq, err: err}
+		}
+		thinkingBudget, err := gemini.ThinkingBudgetFromEnv()
+		if err != nil {
+			return transcribeEstimateMsg{seq: seq, err: err}
+		}
+		concurrency, err := gemini.ConcurrencyFromEnv()
+		if err != nil {
+			return transcribeEstimateMsg{seq: seq, err: err}
+		}
+
+		estimate, err := client.EstimateTranscription(&gemini.TranscribeRequest{
+			Images:                   images,
+			Model:                    model,
+			PreserveFormatting:       options[0],
+			IncludeImageDescriptions: options[1],
+			LocalResize:              &localResize,
+			ThinkingBudget:           thinkingBudget,
+			Concurrency:              concurrency,
+		})
+		if err != nil {
+			return transcribeEstimateMsg{seq: seq, err: err}
+		}
+		return transcribeEstimateMsg{seq: seq, summary: estimate.Summary(client.GetProvider())}
+	}
+}
+
 // writeDocuments writes the transcription results
 func (m TranscribeModel) writeDocuments() tea.Cmd {
 	return func() tea.Msg {
@@ -1136,12 +1383,18 @@ func (m TranscribeModel) writeDocuments() tea.Cmd {
 			return writeResultMsg{err: fmt.Errorf("no transcription result")}
 		}
 
+		dirMode, fileMode, err := fsmode.FromEnv()
+		if err != nil {
+			return writeResultMsg{err: err}
+		}
 		result, err := gemini.WriteDocuments(m.result.Documents, gemini.WriteOptions{
 			OutputDir:          m.outputDir,
 			Overwrite:          m.options[5],
 			AddFrontMatter:     m.options[2],
 			AddTableOfContents: m.options[3],
 			CreateIndexFile:    m.options[4],
+			DirMode:            dirMode,
+			FileMode:           fileMode,
 		})
 
 		return writeResultMsg{
@@ -1199,6 +1452,8 @@ func (m TranscribeModel) View() string {
 		b.WriteString(m.renderConfirmation())
 	case TStepTranscribing:
 		b.WriteString(m.renderTranscribing())
+	case TStepConfirmPartial:
+		b.WriteString(m.renderConfirmPartial())
 	case TStepWriting:
 		b.WriteString(m.renderWriting())
 	case TStepComplete:
@@ -1339,7 +1594,7 @@ func (m TranscribeModel) renderFolderPicker() string {
 // renderPatternInput renders the pattern input
 func (m TranscribeModel) renderPatternInput() string {
 	title := TitleStyle.Render("Enter file paths or glob pattern")
-	desc := MutedStyle.Render("Examples: /path/to/images/*.png, ./scans/page_*.jpg")
+	desc := MutedStyle.Render("Examples: /path/to/images/*.png, ./scans/page_{001..010}.jpg, ./scans/{*.png,*.jpg}\nSeparate several patterns with spaces")
 
 	return BoxStyle.Render(title + "\n" + desc + "\n\n" + m.textInput.View())
 }
@@ -1470,18 +1725,28 @@ func (m TranscribeModel) renderConfirmation() string {
 		modelName = m.availableModels[m.selectedModelIndex].name
 	}
 
+	estimate := m.estimate
+	switch {
+	case m.estimateErr != nil:
+		estimate = "unavailable (" + m.estimateErr.Error() + ")"
+	case estimate == "":
+		estimate = m.spinner.View() + " calculating..."
+	}
+
 	// Summary
 	summary := fmt.Sprintf(`Images:     %d files (%.2f MB)
 Provider:   %s
 Model:      %s
 Output:     %s
-Mode:       %s`,
+Mode:       %s
+Estimate:   %s`,
 		m.imageCount,
 		float64(m.totalSize)/(1024*1024),
 		providerName,
 		modelName,
 		m.outputDir,
 		orgOptions[m.orgModeIndex].name,
+		estimate,
 	)
 
 	summaryBox := lipgloss.NewStyle().
@@ -1558,7 +1823,10 @@ func (m TranscribeModel) renderTranscribing() string {
 		BorderForeground(ColorBorder).
 		Padding(0, 1).
 		Width(m.width - 12)
-	content.WriteString(feedStyle.Render(m.aiFeed.Render()))
+	content.WriteString(feedStyle.Render(m.aiFeed.View()))
+	if hint := m.aiFeed.ScrollHint(); hint != "" {
+		content.WriteString("\n" + MutedStyle.Render("  "+hint+" (up/down, pgup/pgdn to scroll)"))
+	}
 	content.WriteString("\n\n")
 
 	// Stats line
@@ -1568,6 +1836,11 @@ func (m TranscribeModel) renderTranscribing() string {
 	}
 	elapsed := time.Since(m.startTime)
 	stats = append(stats, fmt.Sprintf("Time: %s", formatDuration(elapsed)))
+	if eta, ok := m.eta.remaining(m.totalBatches, time.Now()); ok {
+		stats = append(stats, "ETA: "+formatETA(eta))
+	} else if m.totalBatches > 1 && m.eta.completed < m.totalBatches {
+		stats = append(stats, "ETA: estimating...")
+	}
 	if m.aiTokensUsed > 0 {
 		stats = append(stats, fmt.Sprintf("Tokens: %d", m.aiTokensUsed))
 	}
@@ -1671,6 +1944,9 @@ func (m TranscribeModel) renderWriting() string {
 	if m.result != nil {
 		summaryLines = append(summaryLines, MutedStyle.Render(fmt.Sprintf("    Pages processed: %d", m.result.TotalPages)))
 		summaryLines = append(summaryLines, MutedStyle.Render(fmt.Sprintf("    Documents created: %d", len(m.result.Documents))))
+		if summary := m.result.ProviderSummary(); summary != "" {
+			summaryLines = append(summaryLines, WarningStyle.Render("    Fallback used: "+summary))
+		}
 	}
 	if m.totalBatches > 0 {
 		summaryLines = append(summaryLines, MutedStyle.Render(fmt.Sprintf("    Batches: %d", m.totalBatches)))
@@ -1685,9 +1961,9 @@ func (m TranscribeModel) renderWriting() string {
 	feedStyle := lipgloss.NewStyle().
 		Border(lipgloss.RoundedBorder()).
 		BorderForeground(ColorBorder).
-		Width(m.width - 12).
-		MaxHeight(6)
-	content.WriteString(feedStyle.Render(m.aiFeed.Render()))
+		Padding(0, 1).
+		Width(m.width - 12)
+	content.WriteString(feedStyle.Render(m.aiFeed.View()))
 	content.WriteString("\n\n")
 
 	// Writing status
@@ -1698,6 +1974,46 @@ func (m TranscribeModel) renderWriting() string {
 	return BoxStyle.Render(title + "\n\n" + content.String())
 }
 
+// renderConfirmPartial asks whether to write pages that finished before cancellation
+func (m TranscribeModel) renderConfirmPartial() string {
+	title := WarningStyle.Render("Transcription Cancelled")
+
+	completed := 0
+	total := m.imageCount
+	if m.result != nil {
+		completed = m.result.CompletedPages
+		total = m.result.TotalPages
+	}
+
+	summary := fmt.Sprintf(`%d of %d pages finished before cancelling.
+
+Write them to %s as a partial result?`,
+		completed, total, m.outputDir)
+
+	summaryBox := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(ColorWarning).
+		Padding(1, 2).
+		Render(summary)
+
+	yesStyle := lipgloss.NewStyle().Foreground(ColorSuccess).Padding(0, 2)
+	noStyle := lipgloss.NewStyle().Foreground(ColorError).Padding(0, 2)
+	if m.confirmIndex == 0 {
+		yesStyle = yesStyle.Bold(true).Foreground(lipgloss.Color("#FFFFFF")).Background(ColorSuccess)
+	} else {
+		noStyle = noStyle.Bold(true).Foreground(lipgloss.Color("#FFFFFF")).Background(ColorError)
+	}
+
+	buttons := lipgloss.JoinHorizontal(
+		lipgloss.Center,
+		yesStyle.Render("Write partial"),
+		"  ",
+		noStyle.Render("Discard"),
+	)
+
+	return BoxStyle.Render(title + "\n\n" + summaryBox + "\n\n" + buttons)
+}
+
 // renderComplete renders the completion screen
 func (m TranscribeModel) renderComplete() string {
 	title := SuccessStyle.Render("Transcription Complete!")
@@ -1725,6 +2041,11 @@ func (m TranscribeModel) renderComplete() string {
 	aiSummary.WriteString(MutedStyle.Render(fmt.Sprintf("  Tokens:      %d\n", tokensUsed)))
 	aiSummary.WriteString(MutedStyle.Render(fmt.Sprintf("  Batches:     %d\n", m.totalBatches)))
 	aiSummary.WriteString(MutedStyle.Render(fmt.Sprintf("  Images:      %d\n", m.imageCount)))
+	if m.result != nil {
+		if summary := m.result.RefinementSummary(); summary != "" {
+			aiSummary.WriteString(WarningStyle.Render("  Text refinement failed for "+summary+", using vision output") + "\n")
+		}
+	}
 
 	// Results section
 	summary := fmt.Sprintf(`Documents created: %d
@@ -1758,9 +2079,9 @@ Output: %s`,
 		}
 	}
 
-	hint := MutedStyle.Render("\n[a] Another transcription  [q] Quit")
+	hint := MutedStyle.Render("\n[a] Another transcription  [s] Save AI log  [q] Quit")
 
-	return BoxStyle.Render(title + "\n\n" + aiSummary.String() + "\n" + summaryBox + files.String() + hint)
+	return BoxStyle.Render(title + "\n\n" + aiSummary.String() + "\n" + summaryBox + files.String() + "\n" + renderFeedHistory(m.aiFeed, m.width, m.feedNotice) + hint)
 }
 
 // renderError renders the error screen
@@ -1773,9 +2094,9 @@ func (m TranscribeModel) renderError() string {
 		Padding(1, 2).
 		Render(m.errorMessage)
 
-	hint := MutedStyle.Render("\n[r] Retry  [q] Quit")
+	hint := MutedStyle.Render("\n[r] Retry  [s] Save AI log  [q] Quit")
 
-	return BoxStyle.Render(title + "\n\n" + errorBox + hint)
+	return BoxStyle.Render(title + "\n\n" + errorBox + "\n\n" + renderFeedHistory(m.aiFeed, m.width, m.feedNotice) + hint)
 }
 
 // renderHelp renders context-sensitive help
@@ -1800,9 +2121,14 @@ func (m TranscribeModel) renderHelp() string {
 		keys = append(keys, "y", "Yes")
 		keys = append(keys, "n", "No")
 		keys = append(keys, "tab", "Switch")
+	case TStepConfirmPartial:
+		keys = append(keys, "y", "Write partial")
+		keys = append(keys, "n", "Discard")
+	case TStepTranscribing, TStepWriting, TStepComplete, TStepError:
+		keys = append(keys, "up/down/pgup/pgdn", "Scroll AI feed")
 	}
 
-	if m.step != TStepTranscribing && m.step != TStepWriting && m.step != TStepComplete && m.step != TStepError {
+	if m.step != TStepTranscribing && m.step != TStepConfirmPartial && m.step != TStepWriting && m.step != TStepComplete && m.step != TStepError {
 		keys = append(keys, "esc", "Back")
 		keys = append(keys, "q", "Quit")
 	}
@@ -1839,6 +2165,67 @@ func formatDuration(d time.Duration) string {
 	return fmt.Sprintf("%dm %ds", int(d.Minutes()), int(d.Seconds())%60)
 }
 
+// etaSmoothing is the weight of the newest batch interval in the moving
+// average, low enough that one slow batch doesn't swing the estimate
+const etaSmoothing = 0.3
+
+// etaEstimator predicts remaining transcription time from batch throughput.
+// It keeps an exponential moving average of the time between batch
+// completions, which with parallel batches is the effective time per batch.
+type etaEstimator struct {
+	lastAt      time.Time // start, or when the last batch finished
+	completed   int
+	perBatch    time.Duration // smoothed time per batch; zero until one finishes
+	initialized bool
+}
+
+// newETAEstimator starts an estimate for a job that began at start
+func newETAEstimator(start time.Time) etaEstimator {
+	return etaEstimator{lastAt: start}
+}
+
+// observe records the completed batch count from a progress update
+func (e *etaEstimator) observe(completed int, now time.Time) {
+	if completed <= e.completed || e.lastAt.IsZero() {
+		return
+	}
+	sample := now.Sub(e.lastAt) / time.Duration(completed-e.completed)
+	if !e.initialized {
+		e.perBatch = sample
+		e.initialized = true
+	} else {
+		e.perBatch = time.Duration(etaSmoothing*float64(sample) + (1-etaSmoothing)*float64(e.perBatch))
+	}
+	e.completed = completed
+	e.lastAt = now
+}
+
+// remaining returns the estimated time left, counting down between batch
+// completions. ok is false until the first batch has finished (warm-up) and
+// once every batch is done.
+func (e etaEstimator) remaining(total int, now time.Time) (time.Duration, bool) {
+	if !e.initialized || e.completed >= total {
+		return 0, false
+	}
+	eta := e.perBatch*time.Duration(total-e.completed) - now.Sub(e.lastAt)
+	if eta < time.Second {
+		eta = time.Second
+	}
+	return eta, true
+}
+
+// formatETA formats a remaining time in whole seconds, e.g. "45s" or "3m 20s"
+func formatETA(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+	if d < time.Hour {
+		return fmt.Sprintf("%dm %ds", int(d.Minutes()), int(d.Seconds())%60)
+	}
+	return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
 // RunTranscribeUI runs the transcription UI and returns the result
 func RunTranscribeUI() (continueApp bool, err error) {
 	model := NewTranscribeModel()
@@ -1,7 +1,17 @@
 package tui
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
+
+	"capycut/gemini"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
@@ -167,6 +177,65 @@ func TestFormatDuration(t *testing.T) {
 	}
 }
 
+// TestETAEstimator tests the throughput-based remaining-time estimate
+func TestETAEstimator(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	e := newETAEstimator(start)
+
+	// Warm-up: nothing finished yet
+	if _, ok := e.remaining(10, start.Add(5*time.Second)); ok {
+		t.Error("remaining() gave an estimate before the first batch finished")
+	}
+
+	// First batch after 20s: 9 batches left at 20s each
+	e.observe(1, start.Add(20*time.Second))
+	if got, ok := e.remaining(10, start.Add(20*time.Second)); !ok || got != 180*time.Second {
+		t.Errorf("remaining() = %v, %v; want 3m0s", got, ok)
+	}
+
+	// Counts down between completions
+	if got, _ := e.remaining(10, start.Add(30*time.Second)); got != 170*time.Second {
+		t.Errorf("remaining() after 10s = %v, want 2m50s", got)
+	}
+
+	// A fast batch moves the average only partway: 0.3*10s + 0.7*20s = 17s
+	e.observe(2, start.Add(30*time.Second))
+	if got, _ := e.remaining(10, start.Add(30*time.Second)); got != 8*17*time.Second {
+		t.Errorf("remaining() after smoothing = %v, want %v", got, 8*17*time.Second)
+	}
+
+	// Repeated updates with the same count are ignored
+	e.observe(2, start.Add(40*time.Second))
+	if e.completed != 2 || e.lastAt != start.Add(30*time.Second) {
+		t.Errorf("observe() with an unchanged count moved the estimator: %+v", e)
+	}
+
+	// Done: no estimate
+	e.observe(10, start.Add(2*time.Minute))
+	if _, ok := e.remaining(10, start.Add(2*time.Minute)); ok {
+		t.Error("remaining() gave an estimate after all batches finished")
+	}
+}
+
+// TestFormatETA tests remaining-time formatting
+func TestFormatETA(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{1400 * time.Millisecond, "1s"},
+		{45 * time.Second, "45s"},
+		{200 * time.Second, "3m 20s"},
+		{65 * time.Minute, "1h 5m"},
+	}
+
+	for _, tt := range tests {
+		if got := formatETA(tt.d); got != tt.want {
+			t.Errorf("formatETA(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
 // TestTranscribeModelSourceSelection tests source selection
 func TestTranscribeModelSourceSelection(t *testing.T) {
 	m := NewTranscribeModel()
@@ -239,6 +308,254 @@ func TestTranscribeModelQuit(t *testing.T) {
 	}
 }
 
+// TestGetAvailableProviders_Anthropic tests that the transcription
+// provider picker offers Anthropic when ANTHROPIC_API_KEY is set
+func TestGetAvailableProviders_Anthropic(t *testing.T) {
+	for _, key := range []string{"LLM_ENDPOINT", "IMAGE_LLM_ENDPOINT", "AZURE_ANTHROPIC_ENDPOINT", "GEMINI_API_KEY", "GOOGLE_API_KEY", "ANTHROPIC_MODEL"} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-test")
+
+	got := getAvailableProviders()
+	if len(got) != 1 || got[0].provider != gemini.ProviderAnthropic {
+		t.Fatalf("getAvailableProviders() = %v, want only anthropic", got)
+	}
+
+	models := getModelsForProvider(gemini.ProviderAnthropic)
+	if len(models) == 0 || models[0].value != gemini.DefaultAnthropicModel {
+		t.Errorf("getModelsForProvider(anthropic) = %v, want the Claude models", models)
+	}
+	t.Setenv("ANTHROPIC_MODEL", "claude-opus-4-1")
+	if models := getModelsForProvider(gemini.ProviderAnthropic); models[0].value != "claude-opus-4-1" {
+		t.Errorf("getModelsForProvider(anthropic) first = %v, want ANTHROPIC_MODEL", models[0])
+	}
+}
+
+// TestTranscribeModelCancelKeepsPartial tests that Esc waits for completed pages
+// and offers to write them instead of discarding the run
+func TestTranscribeModelCancelKeepsPartial(t *testing.T) {
+	m := NewTranscribeModel()
+	m.step = TStepTranscribing
+
+	newModel, _ := m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	m = newModel.(TranscribeModel)
+
+	if m.step != TStepTranscribing || !m.cancelling {
+		t.Fatalf("Expected to stay on TStepTranscribing while cancelling, got step %v cancelling %v", m.step, m.cancelling)
+	}
+
+	partial := &gemini.TranscribeResponse{
+		Documents:      []*gemini.MarkdownDocument{{Title: "Page 1", Filename: "page_01.md"}},
+		Partial:        true,
+		CompletedPages: 1,
+		TotalPages:     3,
+	}
+	newModel, _ = m.Update(transcribeResultMsg{response: partial, err: context.Canceled})
+	m = newModel.(TranscribeModel)
+
+	if m.step != TStepConfirmPartial {
+		t.Fatalf("Expected TStepConfirmPartial, got %v", m.step)
+	}
+	if view := m.View(); !containsString(view, "1 of 3 pages") {
+		t.Error("Expected partial prompt to report completed pages")
+	}
+
+	newModel, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'n'}})
+	m = newModel.(TranscribeModel)
+
+	if m.step != TStepError || m.errorMessage != "Cancelled by user" {
+		t.Errorf("Expected discard to end in TStepError, got %v (%q)", m.step, m.errorMessage)
+	}
+}
+
+// TestTranscribeModelConfirmEstimate tests that the confirm screen shows the
+// latest estimate and drops one from an earlier visit
+func TestTranscribeModelConfirmEstimate(t *testing.T) {
+	m := NewTranscribeModel()
+	m.step = TStepSelectOptions
+	m.images = []string{"page1.png"}
+	m.imageCount = 1
+
+	newModel, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = newModel.(TranscribeModel)
+
+	if m.step != TStepConfirm || cmd == nil {
+		t.Fatalf("Expected TStepConfirm with an estimate command, got %v", m.step)
+	}
+	if view := m.View(); !containsString(view, "calculating") {
+		t.Error("Expected the estimate to show as calculating")
+	}
+
+	newModel, _ = m.Update(transcribeEstimateMsg{seq: m.estimateSeq - 1, summary: "stale"})
+	m = newModel.(TranscribeModel)
+	if m.estimate != "" {
+		t.Errorf("Expected a stale estimate to be dropped, got %q", m.estimate)
+	}
+
+	newModel, _ = m.Update(transcribeEstimateMsg{seq: m.estimateSeq, summary: "~5K tokens in 1 batch"})
+	m = newModel.(TranscribeModel)
+	if view := m.View(); !containsString(view, "~5K tokens in 1 batch") {
+		t.Error("Expected the confirm screen to show the estimate")
+	}
+
+	newModel, _ = m.Update(transcribeEstimateMsg{seq: m.estimateSeq, err: errors.New("no backend")})
+	m = newModel.(TranscribeModel)
+	if view := m.View(); !containsString(view, "unavailable (no backend)") {
+		t.Error("Expected the confirm screen to explain a missing estimate")
+	}
+}
+
+// TestTranscribeModelCancelWithoutPages tests that a cancel with nothing
+// completed reports cancellation
+func TestTranscribeModelCancelWithoutPages(t *testing.T) {
+	m := NewTranscribeModel()
+	m.step = TStepTranscribing
+
+	newModel, _ := m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	m = newModel.(TranscribeModel)
+	newModel, _ = m.Update(transcribeResultMsg{err: context.Canceled})
+	m = newModel.(TranscribeModel)
+
+	if m.step != TStepError || m.errorMessage != "Cancelled by user" {
+		t.Errorf("Expected TStepError with cancel message, got %v (%q)", m.step, m.errorMessage)
+	}
+}
+
+// TestAIFeedHistory tests that the feed trims to MaxMessages and counts what it dropped
+func TestAIFeedHistory(t *testing.T) {
+	feed := NewAIFeed(60, 5)
+	feed.MaxMessages = 10
+
+	for i := 0; i < 25; i++ {
+		feed.AddStatus("Gemini", "gemini-3-pro", fmt.Sprintf("Batch %d", i))
+	}
+
+	if len(feed.Messages) != 10 || feed.Dropped != 15 {
+		t.Fatalf("got %d messages, %d dropped; want 10 and 15", len(feed.Messages), feed.Dropped)
+	}
+	if feed.Messages[0].Title != "Batch 15" {
+		t.Errorf("oldest kept message = %q, want Batch 15", feed.Messages[0].Title)
+	}
+	if !strings.Contains(feed.Render(), "15 older messages not kept") {
+		t.Error("Render should note the dropped messages")
+	}
+
+	feed.Clear()
+	if feed.Dropped != 0 {
+		t.Errorf("Clear left Dropped = %d", feed.Dropped)
+	}
+}
+
+// TestAIFeedReplaceLast tests that a streamed answer updates one message
+func TestAIFeedReplaceLast(t *testing.T) {
+	feed := NewAIFeed(60, 5)
+	feed.ReplaceLast(AIFeedMessage{Title: "Receiving (2 chars)"})
+	feed.ReplaceLast(AIFeedMessage{Title: "Receiving (12 chars)"})
+	if len(feed.Messages) != 1 || feed.Messages[0].Title != "Receiving (12 chars)" {
+		t.Fatalf("messages = %+v, want only the latest update", feed.Messages)
+	}
+	if feed.Messages[0].Timestamp.IsZero() {
+		t.Error("ReplaceLast should stamp the message")
+	}
+	if !strings.Contains(feed.Render(), "12 chars") {
+		t.Error("Render should show the replaced message")
+	}
+}
+
+// TestAIFeedScrolling tests that the feed follows new messages until the user scrolls back
+func TestAIFeedScrolling(t *testing.T) {
+	feed := NewAIFeed(60, 3)
+	for i := 0; i < 10; i++ {
+		feed.AddStatus("Gemini", "", fmt.Sprintf("Batch %d", i))
+	}
+	if !feed.Viewport.AtBottom() {
+		t.Fatal("feed should follow new messages")
+	}
+	if hint := feed.ScrollHint(); hint != "lines 8-10 of 10" {
+		t.Errorf("ScrollHint() = %q, want lines 8-10 of 10", hint)
+	}
+
+	if !feed.HandleKey(tea.KeyMsg{Type: tea.KeyHome}) {
+		t.Fatal("HandleKey should use home")
+	}
+	if feed.Viewport.YOffset != 0 {
+		t.Fatalf("YOffset after home = %d, want 0", feed.Viewport.YOffset)
+	}
+
+	// Scrolled back: new messages don't yank the view to the bottom
+	feed.AddStatus("Gemini", "", "Batch 10")
+	if feed.Viewport.YOffset != 0 {
+		t.Errorf("YOffset after new message = %d, want 0 while scrolled back", feed.Viewport.YOffset)
+	}
+
+	feed.HandleKey(tea.KeyMsg{Type: tea.KeyEnd})
+	feed.AddStatus("Gemini", "", "Batch 11")
+	if !feed.Viewport.AtBottom() {
+		t.Error("feed should follow again after end")
+	}
+
+	if feed.HandleKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'x'}}) {
+		t.Error("HandleKey should ignore other keys")
+	}
+}
+
+// TestAIFeedSaveLog tests that the saved log carries every request and response detail
+func TestAIFeedSaveLog(t *testing.T) {
+	feed := NewAIFeed(60, 5)
+	feed.AddRequest("Gemini", "gemini-3-pro", &AIRequestInfo{
+		Endpoint:      "generateContent",
+		Method:        "POST",
+		ImageCount:    4,
+		PromptPreview: "Transcribe these pages",
+		Parameters:    map[string]string{"temperature": "0.1"},
+	})
+	feed.AddResponse("Gemini", "gemini-3-pro", &AIResponseInfo{
+		StatusCode:   200,
+		StatusText:   "OK",
+		Latency:      1500 * time.Millisecond,
+		TokensInput:  1000,
+		TokensOutput: 200,
+		TokensTotal:  1200,
+	})
+
+	dir := t.TempDir()
+	path, err := feed.SaveLog(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("SaveLog() error: %v", err)
+	}
+	if filepath.Dir(path) != dir || !strings.HasPrefix(filepath.Base(path), "capycut-ai-") {
+		t.Errorf("SaveLog() path = %q", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := string(data)
+	for _, want := range []string{"POST generateContent", "images:", "Transcribe these pages", "temperature=0.1", "200 OK", "1.5s", "1000 in, 200 out, 1200 total"} {
+		if !strings.Contains(log, want) {
+			t.Errorf("log missing %q:\n%s", want, log)
+		}
+	}
+
+	// The output modes apply to the log and a directory created for it
+	if runtime.GOOS == "windows" {
+		return
+	}
+	logDir := filepath.Join(dir, "logs")
+	path, err = feed.SaveLog(logDir, 0700, 0600)
+	if err != nil {
+		t.Fatalf("SaveLog() with modes error: %v", err)
+	}
+	for p, want := range map[string]os.FileMode{logDir: 0700, path: 0600} {
+		if info, err := os.Stat(p); err != nil {
+			t.Error(err)
+		} else if info.Mode().Perm() != want {
+			t.Errorf("%s mode = %v, want %v", filepath.Base(p), info.Mode().Perm(), want)
+		}
+	}
+}
+
 // Helper function to check if a string contains a substring
 func containsString(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > 0 && containsStringHelper(s, substr))
@@ -257,6 +574,36 @@ func containsStringHelper(s, substr string) bool {
 // PLACEHOLDER TESTS FOR FUTURE END-TO-END TESTING
 // =============================================================================
 
+// TestLoadDirectoryEntries_NaturalOrder tests that the file browser lists
+// numbered pages in page order, directories first
+func TestLoadDirectoryEntries_NaturalOrder(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"page10.png", "page2.png", "page1.png", "page02.png"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"ch10", "ch9"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := loadDirectoryEntries(dir)
+	if err != nil {
+		t.Fatalf("loadDirectoryEntries() failed: %v", err)
+	}
+
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	want := []string{"..", "ch9", "ch10", "page1.png", "page2.png", "page02.png", "page10.png"}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Errorf("loadDirectoryEntries() = %v, want %v", names, want)
+	}
+}
+
 // TestE2E_TranscribeWorkflow_SingleImage is a placeholder for end-to-end testing
 // of transcribing a single image to markdown.
 func TestE2E_TranscribeWorkflow_SingleImage(t *testing.T) {
@@ -0,0 +1,97 @@
+package video
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AspectRatios lists the presets offered for vertical and square clips
+var AspectRatios = []string{"9:16", "1:1", "4:5"}
+
+// maxCropShortSide caps the short side of an aspect-cropped clip. 1080 is
+// what shorts and reels are played at, so larger crops only cost upload
+// time.
+const maxCropShortSide = 1080
+
+// ParseAspectRatio parses a ratio such as "9:16" into its two terms
+func ParseAspectRatio(s string) (w, h int, err error) {
+	left, right, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if ok {
+		w, err = strconv.Atoi(strings.TrimSpace(left))
+		if err == nil {
+			h, err = strconv.Atoi(strings.TrimSpace(right))
+		}
+	}
+	if !ok || err != nil || w <= 0 || h <= 0 {
+		return 0, 0, fmt.Errorf("invalid aspect ratio %q (use W:H, e.g. %s)", s, strings.Join(AspectRatios, ", "))
+	}
+	return w, h, nil
+}
+
+// AspectCrop is the centered crop that gives a clip its aspect ratio,
+// followed by a downscale for large sources
+type AspectCrop struct {
+	X, Y, Width, Height int // crop rectangle in the source frame
+	OutWidth, OutHeight int // clip resolution after scaling
+}
+
+// IsNoop reports whether the source already has the ratio, so the clip
+// can be cut without re-encoding
+func (c AspectCrop) IsNoop() bool {
+	return c.X == 0 && c.Y == 0 && c.Width == c.OutWidth && c.Height == c.OutHeight
+}
+
+// filter returns the ffmpeg crop and scale filters for the crop
+func (c AspectCrop) filter() string {
+	filter := fmt.Sprintf("crop=%d:%d:%d:%d", c.Width, c.Height, c.X, c.Y)
+	if c.OutWidth != c.Width || c.OutHeight != c.Height {
+		filter += fmt.Sprintf(",scale=%d:%d", c.OutWidth, c.OutHeight)
+	}
+	return filter
+}
+
+// PlanAspectCrop centers a crop of the given ratio in a width x height
+// source. Usually the sides are cut; a source already narrower than the
+// ratio keeps its full width and loses height instead, and one that
+// already has the ratio is left alone. Sizes are even, as H.264 requires.
+func PlanAspectCrop(width, height int, aspect string) (AspectCrop, error) {
+	rw, rh, err := ParseAspectRatio(aspect)
+	if err != nil {
+		return AspectCrop{}, err
+	}
+	if width <= 0 || height <= 0 {
+		return AspectCrop{}, fmt.Errorf("can't crop to %s: the video's resolution is unknown", aspect)
+	}
+
+	cropW, cropH := width, height
+	if width*rh > height*rw {
+		cropW = even(height * rw / rh)
+	} else {
+		cropH = even(width * rh / rw)
+	}
+
+	// Odd source sizes lose a pixel to evening out; that's no crop
+	if cropW >= width-1 && cropH >= height-1 {
+		return AspectCrop{Width: width, Height: height, OutWidth: width, OutHeight: height}, nil
+	}
+
+	crop := AspectCrop{
+		X:         (width - cropW) / 2,
+		Y:         (height - cropH) / 2,
+		Width:     cropW,
+		Height:    cropH,
+		OutWidth:  cropW,
+		OutHeight: cropH,
+	}
+	if short := min(cropW, cropH); short > maxCropShortSide {
+		crop.OutWidth = even(cropW * maxCropShortSide / short)
+		crop.OutHeight = even(cropH * maxCropShortSide / short)
+	}
+	return crop, nil
+}
+
+// even rounds n down to an even number of at least 2
+func even(n int) int {
+	return max(n&^1, 2)
+}
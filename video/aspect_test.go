@@ -0,0 +1,99 @@
+package video
+
+import "testing"
+
+func TestParseAspectRatio(t *testing.T) {
+	tests := []struct {
+		input   string
+		w, h    int
+		wantErr bool
+	}{
+		{"9:16", 9, 16, false},
+		{" 4 : 5 ", 4, 5, false},
+		{"1:1", 1, 1, false},
+		{"916", 0, 0, true},
+		{"9:0", 0, 0, true},
+		{"-9:16", 0, 0, true},
+		{"wide:tall", 0, 0, true},
+		{"", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			w, h, err := ParseAspectRatio(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAspectRatio(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if w != tt.w || h != tt.h {
+				t.Errorf("ParseAspectRatio(%q) = %d:%d, want %d:%d", tt.input, w, h, tt.w, tt.h)
+			}
+		})
+	}
+}
+
+func TestPlanAspectCrop(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		aspect        string
+		want          AspectCrop
+		noop          bool
+	}{
+		{
+			name:  "landscape to vertical",
+			width: 1920, height: 1080, aspect: "9:16",
+			want: AspectCrop{X: 657, Y: 0, Width: 606, Height: 1080, OutWidth: 606, OutHeight: 1080},
+		},
+		{
+			name:  "landscape to square",
+			width: 1280, height: 720, aspect: "1:1",
+			want: AspectCrop{X: 280, Y: 0, Width: 720, Height: 720, OutWidth: 720, OutHeight: 720},
+		},
+		{
+			name:  "4K is scaled down",
+			width: 3840, height: 2160, aspect: "9:16",
+			want: AspectCrop{X: 1313, Y: 0, Width: 1214, Height: 2160, OutWidth: 1080, OutHeight: 1920},
+		},
+		{
+			name:  "narrower source loses height",
+			width: 720, height: 1600, aspect: "9:16",
+			want: AspectCrop{X: 0, Y: 160, Width: 720, Height: 1280, OutWidth: 720, OutHeight: 1280},
+		},
+		{
+			name:  "already the ratio",
+			width: 1080, height: 1920, aspect: "9:16",
+			want: AspectCrop{Width: 1080, Height: 1920, OutWidth: 1080, OutHeight: 1920},
+			noop: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PlanAspectCrop(tt.width, tt.height, tt.aspect)
+			if err != nil {
+				t.Fatalf("PlanAspectCrop() error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("PlanAspectCrop(%d, %d, %q) = %+v, want %+v", tt.width, tt.height, tt.aspect, got, tt.want)
+			}
+			if got.IsNoop() != tt.noop {
+				t.Errorf("IsNoop() = %v, want %v", got.IsNoop(), tt.noop)
+			}
+		})
+	}
+
+	if _, err := PlanAspectCrop(0, 0, "9:16"); err == nil {
+		t.Error("PlanAspectCrop() with an unknown resolution should fail")
+	}
+}
+
+func TestAspectCropFilter(t *testing.T) {
+	crop := AspectCrop{X: 1313, Width: 1214, Height: 2160, OutWidth: 1080, OutHeight: 1920}
+	if got, want := crop.filter(), "crop=1214:2160:1313:0,scale=1080:1920"; got != want {
+		t.Errorf("filter() = %q, want %q", got, want)
+	}
+	crop = AspectCrop{X: 280, Width: 720, Height: 720, OutWidth: 720, OutHeight: 720}
+	if got, want := crop.filter(), "crop=720:720:280:0"; got != want {
+		t.Errorf("filter() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,114 @@
+package video
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultAudioBitrate is the bitrate ExtractAudio encodes at unless
+// ClipParams.AudioBitrate says otherwise
+const DefaultAudioBitrate = "192k"
+
+// AudioFormats lists the formats ExtractAudio writes
+var AudioFormats = []string{"mp3", "m4a"}
+
+// audioCodecs maps each audio format to its ffmpeg encoder and muxer
+var audioCodecs = map[string]struct{ codec, muxer string }{
+	"mp3": {"libmp3lame", "mp3"},
+	"m4a": {"aac", "ipod"},
+}
+
+// ParseAudioFormat parses an --audio-only value
+func ParseAudioFormat(s string) (string, error) {
+	format := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), ".")
+	if _, ok := audioCodecs[format]; !ok {
+		return "", fmt.Errorf("unknown audio format %q (use %s)", s, strings.Join(AudioFormats, " or "))
+	}
+	return format, nil
+}
+
+// ValidateAudioBitrate checks an audio bitrate such as 128k
+func ValidateAudioBitrate(bitrate string) error {
+	if !bitrateRe.MatchString(bitrate) {
+		return fmt.Errorf("invalid audio bitrate %q (use e.g. 128k or 320k)", bitrate)
+	}
+	return nil
+}
+
+// AudioExt returns the output extension for an audio format, for
+// GenerateOutputPath
+func AudioExt(format string) string {
+	return "." + format
+}
+
+// ExtractAudio saves the audio of a clip as format, one of AudioFormats,
+// dropping the video stream. It encodes at params.AudioBitrate, or
+// DefaultAudioBitrate when that is empty. Output, FileMode and Progress
+// work as in ClipVideo; the video settings are ignored. Check
+// VideoInfo.HasAudio first to explain a silent source better than ffmpeg
+// does.
+func ExtractAudio(params ClipParams, format string) error {
+	format, err := ParseAudioFormat(format)
+	if err != nil {
+		return err
+	}
+	if params.AudioBitrate != "" {
+		if err := ValidateAudioBitrate(params.AudioBitrate); err != nil {
+			return err
+		}
+	}
+
+	duration, err := CalculateClipDuration(params.StartTime, params.EndTime)
+	if err != nil {
+		return fmt.Errorf("invalid clip range: %w", err)
+	}
+
+	args := BuildAudioArgs(params, format)
+	if params.Output != nil {
+		return runFFmpeg(args, params.Output, duration, params.Progress)
+	}
+	if err := runFFmpeg(args, nil, duration, params.Progress); err != nil {
+		return err
+	}
+
+	if params.FileMode != 0 {
+		if err := os.Chmod(params.OutputPath, params.FileMode); err != nil {
+			return fmt.Errorf("failed to set clip permissions: %w", err)
+		}
+	}
+	return nil
+}
+
+// BuildAudioArgs returns the arguments ExtractAudio runs ffmpeg with for a
+// format from ParseAudioFormat, without running anything
+func BuildAudioArgs(params ClipParams, format string) []string {
+	codec := audioCodecs[format]
+	bitrate := params.AudioBitrate
+	if bitrate == "" {
+		bitrate = DefaultAudioBitrate
+	}
+	duration, _ := CalculateClipDuration(params.StartTime, params.EndTime)
+
+	args := []string{
+		"-y",
+		"-ss", params.StartTime,
+		"-i", params.InputPath,
+		"-t", strconv.FormatFloat(duration.Seconds(), 'f', 3, 64),
+		"-vn",
+		"-c:a", codec.codec,
+		"-b:a", bitrate,
+		"-f", codec.muxer,
+	}
+
+	if params.Output != nil {
+		// An M4A normally gets its index written at the end, after seeking
+		// back; fragments let it stream
+		if codec.muxer == "ipod" {
+			args = append(args, "-movflags", "frag_keyframe+empty_moov")
+		}
+		return append(args, "pipe:1")
+	}
+	return append(args, params.OutputPath)
+}
@@ -0,0 +1,140 @@
+package video
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAudioFormat(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"mp3", "mp3", false},
+		{" M4A ", "m4a", false},
+		{".mp3", "mp3", false},
+		{"wav", "", true},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseAudioFormat(tt.input)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseAudioFormat(%q) = %q, %v; want %q, error %v", tt.input, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAudioBitrate(t *testing.T) {
+	for _, bitrate := range []string{"192k", "320K", "128000"} {
+		if err := ValidateAudioBitrate(bitrate); err != nil {
+			t.Errorf("ValidateAudioBitrate(%q) error: %v", bitrate, err)
+		}
+	}
+	for _, bitrate := range []string{"", "fast", "192 kbps"} {
+		if err := ValidateAudioBitrate(bitrate); err == nil {
+			t.Errorf("ValidateAudioBitrate(%q) should fail", bitrate)
+		}
+	}
+}
+
+func TestExtractAudio_Synthetic(t *testing.T) {
+	if err := CheckFFmpeg(); err != nil {
+		t.Skip("ffmpeg not available, skipping synthetic audio test")
+	}
+	if err := CheckFFprobe(); err != nil {
+		t.Skip("ffprobe not available, skipping synthetic audio test")
+	}
+
+	path := filepath.Join(t.TempDir(), "tone.mp4")
+	cmd := exec.Command("ffmpeg",
+		"-y",
+		"-f", "lavfi", "-i", "testsrc=duration=4:size=160x120:rate=25",
+		"-f", "lavfi", "-i", "sine=frequency=440:duration=4",
+		"-c:v", "mpeg4",
+		"-c:a", "aac",
+		"-shortest",
+		path,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to generate test video: %v\n%s", err, output)
+	}
+
+	info, err := GetVideoInfo(path)
+	if err != nil {
+		t.Fatalf("GetVideoInfo() error: %v", err)
+	}
+	if !info.HasAudio {
+		t.Fatal("HasAudio = false for a video with a sine track")
+	}
+
+	for _, format := range AudioFormats {
+		t.Run(format, func(t *testing.T) {
+			outputPath := GenerateOutputPath(path, "00:00:01", "00:00:03", AudioExt(format))
+			if filepath.Ext(outputPath) != "."+format {
+				t.Fatalf("GenerateOutputPath() = %q, want a .%s extension", outputPath, format)
+			}
+
+			err := ExtractAudio(ClipParams{
+				InputPath:    path,
+				StartTime:    "00:00:01",
+				EndTime:      "00:00:03",
+				OutputPath:   outputPath,
+				AudioBitrate: "96k",
+			}, format)
+			if err != nil {
+				t.Fatalf("ExtractAudio() error: %v", err)
+			}
+
+			out, err := GetVideoInfo(outputPath)
+			if err != nil {
+				t.Fatalf("GetVideoInfo(output) error: %v", err)
+			}
+			if !out.HasAudio || out.Width != 0 {
+				t.Errorf("output has audio %v and a %dx%d video stream, want audio only", out.HasAudio, out.Width, out.Height)
+			}
+			assertDurationNear(t, "audio duration", out.Duration, 2*time.Second)
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := ExtractAudio(ClipParams{InputPath: path, StartTime: "0", EndTime: "1", Output: &buf}, "m4a"); err != nil {
+		t.Fatalf("ExtractAudio() to writer error: %v", err)
+	}
+	if buf.Len() == 0 {
+		t.Error("ExtractAudio() wrote nothing to Output")
+	}
+}
+
+func TestExtractAudio_InvalidArgs(t *testing.T) {
+	params := ClipParams{InputPath: "in.mp4", StartTime: "0", EndTime: "1", OutputPath: filepath.Join(os.TempDir(), "out.mp3")}
+	if err := ExtractAudio(params, "wav"); err == nil {
+		t.Error("ExtractAudio() with an unknown format should fail")
+	}
+	params.AudioBitrate = "loud"
+	if err := ExtractAudio(params, "mp3"); err == nil {
+		t.Error("ExtractAudio() with an invalid bitrate should fail")
+	}
+}
+
+func TestBuildAudioArgs(t *testing.T) {
+	params := ClipParams{InputPath: "in.mp4", StartTime: "10", EndTime: "20", OutputPath: "out.mp3"}
+	if got, want := strings.Join(BuildAudioArgs(params, "mp3"), " "), "-y -ss 10 -i in.mp4 -t 10.000 -vn -c:a libmp3lame -b:a 192k -f mp3 out.mp3"; got != want {
+		t.Errorf("BuildAudioArgs(mp3) = %q, want %q", got, want)
+	}
+
+	params.AudioBitrate = "128k"
+	params.Output = &bytes.Buffer{}
+	got := strings.Join(BuildAudioArgs(params, "m4a"), " ")
+	if !strings.Contains(got, "-c:a aac -b:a 128k -f ipod -movflags frag_keyframe+empty_moov pipe:1") {
+		t.Errorf("BuildAudioArgs(m4a) to a writer = %q, want a fragmented M4A at 128k on stdout", got)
+	}
+}
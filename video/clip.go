@@ -1,36 +1,98 @@
 package video
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
 	"time"
+
+	"capycut/fsmode"
 )
 
 // ClipParams holds the parameters for clipping a video
 type ClipParams struct {
 	InputPath  string
-	StartTime  string // Format: HH:MM:SS or MM:SS or seconds
-	EndTime    string // Format: HH:MM:SS or MM:SS or seconds
+	StartTime  string // Format: HH:MM:SS[.mmm] or MM:SS[.mmm] or seconds, passed to ffmpeg as-is
+	EndTime    string // Format: HH:MM:SS[.mmm] or MM:SS[.mmm] or seconds, passed to ffmpeg as-is
 	OutputPath string
+
+	// SubtitlePath optionally burns an .srt, .vtt, .ass or .ssa file into the
+	// clip. Cue times are relative to the source video; they are shifted to
+	// the clip start. Burning subtitles re-encodes the video stream.
+	SubtitlePath string
+
+	// AspectRatio optionally center-crops the clip to a ratio such as
+	// "9:16" for shorts and reels; see PlanAspectCrop. Cropping re-encodes
+	// the video stream unless the source already has the ratio.
+	AspectRatio string
+
+	// SourceWidth and SourceHeight are the input's resolution from
+	// GetVideoInfo, which AspectRatio crops against; ClipVideo probes
+	// them when they are zero
+	SourceWidth  int
+	SourceHeight int
+
+	// AudioBitrate is the bitrate ExtractAudio encodes at, e.g. "128k";
+	// empty selects DefaultAudioBitrate
+	AudioBitrate string
+
+	// Encode controls the encoder when the clip is re-encoded; the zero
+	// value uses libx264 defaults. Run Encode.HWAccel through ResolveHWAccel
+	// first.
+	Encode EncodeOptions
+
+	// Output, when set, receives the clip instead of OutputPath, muxed as
+	// StreamFormat since a pipe can't be seeked back to finish an MP4
+	Output io.Writer
+
+	// StreamFormat is the ffmpeg muxer used with Output; empty selects
+	// DefaultStreamFormat
+	StreamFormat string
+
+	// Progress, when set, is called as ffmpeg writes the clip
+	Progress ProgressCallback
+
+	// FileMode, when set, is applied to the clip at OutputPath once it is
+	// written; otherwise ffmpeg's default permissions are kept
+	FileMode os.FileMode
 }
 
+// StdoutPath is the output argument that streams the clip to stdout
+const StdoutPath = "-"
+
+// DefaultStreamFormat is the muxer for clips written to a pipe. Matroska
+// holds any codec -c copy passes through and needs no seeking to finish.
+const DefaultStreamFormat = "matroska"
+
 // VideoInfo holds metadata about a video file
 type VideoInfo struct {
 	Duration time.Duration
 	Path     string
 	Filename string
+
+	// Width and Height are the displayed resolution of the first video
+	// stream, after any rotation; zero when the file has no video stream
+	Width  int
+	Height int
+
+	// HasAudio reports whether the file has an audio stream
+	HasAudio bool
 }
 
 // GetVideoInfo retrieves information about a video file using ffprobe
 func GetVideoInfo(path string) (*VideoInfo, error) {
 	cmd := exec.Command("ffprobe",
 		"-v", "error",
-		"-show_entries", "format=duration",
-		"-of", "default=noprint_wrappers=1:nokey=1",
+		"-show_entries", "format=duration:stream=codec_type,width,height:stream_tags=rotate:stream_side_data=rotation",
+		"-of", "json",
 		path,
 	)
 
@@ -38,72 +100,387 @@ func GetVideoInfo(path string) (*VideoInfo, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to get video info: %w", err)
 	}
+	return parseProbe(output, path)
+}
 
-	durationStr := strings.TrimSpace(string(output))
-	durationSec, err := strconv.ParseFloat(durationStr, 64)
+// parseProbe reads GetVideoInfo's ffprobe JSON
+func parseProbe(output []byte, path string) (*VideoInfo, error) {
+	var probe struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+			Width     int    `json:"width"`
+			Height    int    `json:"height"`
+			Tags      struct {
+				Rotate string `json:"rotate"`
+			} `json:"tags"`
+			SideData []struct {
+				Rotation float64 `json:"rotation"`
+			} `json:"side_data_list"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, fmt.Errorf("failed to parse video info: %w", err)
+	}
+
+	durationSec, err := strconv.ParseFloat(strings.TrimSpace(probe.Format.Duration), 64)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse duration: %w", err)
 	}
 
-	return &VideoInfo{
+	info := &VideoInfo{
 		Duration: time.Duration(durationSec * float64(time.Second)),
 		Path:     path,
 		Filename: filepath.Base(path),
-	}, nil
+	}
+	video := -1
+	for i, stream := range probe.Streams {
+		switch stream.CodecType {
+		case "audio":
+			info.HasAudio = true
+		case "video":
+			if video < 0 {
+				video = i
+			}
+		}
+	}
+	if video >= 0 {
+		stream := probe.Streams[video]
+		info.Width, info.Height = stream.Width, stream.Height
+
+		// Phones store portrait video as landscape frames plus a rotation,
+		// which ffmpeg applies when decoding
+		rotation, _ := strconv.ParseFloat(stream.Tags.Rotate, 64)
+		for _, sd := range stream.SideData {
+			if sd.Rotation != 0 {
+				rotation = sd.Rotation
+			}
+		}
+		if int(math.Abs(rotation))%180 == 90 {
+			info.Width, info.Height = info.Height, info.Width
+		}
+	}
+	return info, nil
 }
 
-// FormatDuration formats a duration as HH:MM:SS
+// FormatDuration formats a duration as HH:MM:SS (or MM:SS under an hour),
+// adding .mmm when there are milliseconds so the result parses back exactly
 func FormatDuration(d time.Duration) string {
 	h := int(d.Hours())
 	m := int(d.Minutes()) % 60
 	s := int(d.Seconds()) % 60
 
+	var out string
 	if h > 0 {
-		return fmt.Sprintf("%02d:%02d:%02d", h, m, s)
+		out = fmt.Sprintf("%02d:%02d:%02d", h, m, s)
+	} else {
+		out = fmt.Sprintf("%02d:%02d", m, s)
+	}
+	if ms := d.Milliseconds() % 1000; ms > 0 {
+		out += fmt.Sprintf(".%03d", ms)
 	}
-	return fmt.Sprintf("%02d:%02d", m, s)
+	return out
 }
 
-// GenerateOutputPath creates an output path for the clipped video
-func GenerateOutputPath(inputPath, startTime, endTime string) string {
-	ext := filepath.Ext(inputPath)
-	base := strings.TrimSuffix(filepath.Base(inputPath), ext)
+// GenerateOutputPath builds the output path for a clip. It is a pure function:
+//   - the file sits in the same directory as inputPath
+//   - the name is "<base>_clip_<start>_to_<end><ext>"
+//   - ':' and other characters unsafe in filenames become '-' in the timestamps
+//   - ext replaces the input extension (with or without the leading dot);
+//     an empty ext keeps the input's extension
+//
+// It does not look at the filesystem; use UniqueOutputPath to avoid clobbering.
+func GenerateOutputPath(inputPath, startTime, endTime, ext string) string {
+	inputExt := filepath.Ext(inputPath)
+	base := strings.TrimSuffix(filepath.Base(inputPath), inputExt)
 	dir := filepath.Dir(inputPath)
 
-	// Clean up time strings for filename
-	startClean := strings.ReplaceAll(startTime, ":", "-")
-	endClean := strings.ReplaceAll(endTime, ":", "-")
+	if ext == "" {
+		ext = inputExt
+	} else if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+
+	return filepath.Join(dir, fmt.Sprintf("%s_clip_%s_to_%s%s", base, sanitizeTimestamp(startTime), sanitizeTimestamp(endTime), ext))
+}
+
+// sanitizeTimestamp makes a timestamp safe to embed in a filename
+func sanitizeTimestamp(ts string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '/', '\\', '<', '>', '"', '|', '?', '*', ' ':
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(ts))
+}
+
+// UniqueOutputPath returns path unchanged if nothing exists there, otherwise
+// the first free "<name>_N<ext>" for N = 2, 3, ...
+func UniqueOutputPath(path string) string {
+	return uniquePath(path, func(p string) bool {
+		_, err := os.Stat(p)
+		return err == nil
+	})
+}
+
+// ResolveOutputPath decides where a clip is written. An empty output
+// auto-names the clip next to the input. An output that is an existing
+// directory or ends in a path separator is created if needed and the
+// auto-generated name is placed inside it, with dirMode when it has to be
+// created (0 = 0755). Anything else is used verbatim.
+func ResolveOutputPath(output, inputPath, startTime, endTime, ext string, dirMode os.FileMode) (string, error) {
+	generated := GenerateOutputPath(inputPath, startTime, endTime, ext)
+	if output == "" {
+		return UniqueOutputPath(generated), nil
+	}
+
+	if !IsDirOutput(output) {
+		return output, nil
+	}
+
+	if err := fsmode.MkdirAll(output, dirMode); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+	return UniqueOutputPath(filepath.Join(output, filepath.Base(generated))), nil
+}
+
+// IsDirOutput reports whether ResolveOutputPath treats output as a
+// directory: it exists as one or ends in a path separator
+func IsDirOutput(output string) bool {
+	if strings.HasSuffix(output, "/") || strings.HasSuffix(output, string(os.PathSeparator)) {
+		return true
+	}
+	info, err := os.Stat(output)
+	return err == nil && info.IsDir()
+}
 
-	return filepath.Join(dir, fmt.Sprintf("%s_clip_%s_to_%s%s", base, startClean, endClean, ext))
+// uniquePath implements UniqueOutputPath against an injectable existence check
+func uniquePath(path string, exists func(string) bool) string {
+	if !exists(path) {
+		return path
+	}
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s_%d%s", stem, n, ext)
+		if !exists(candidate) {
+			return candidate
+		}
+	}
 }
 
 // ClipVideo clips a video using ffmpeg
 func ClipVideo(params ClipParams) error {
-	// Build ffmpeg command
-	// Using -ss before -i for fast seeking, then -to for end time
+	// Input seeking resets timestamps to zero, so an output -to would be read
+	// as a length and a clip from 1:00 to 1:30 would run 1:30; pass the clip
+	// length with -t instead
+	duration, err := CalculateClipDuration(params.StartTime, params.EndTime)
+	if err != nil {
+		return fmt.Errorf("invalid clip range: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "capycut-clip-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	params, subtitles, err := prepareClip(params, tmpDir)
+	if err != nil {
+		return err
+	}
+	filters, err := clipFilters(params, subtitles)
+	if err != nil {
+		return err
+	}
+	if len(filters) > 0 {
+		if err := CheckEncodeSupport(params.Encode); err != nil {
+			return err
+		}
+	}
+
+	args, err := buildFFmpegArgs(params, subtitles)
+	if err != nil {
+		return err
+	}
+
+	if params.Output != nil {
+		// Keep ffmpeg's log apart from the clip on stdout
+		return runFFmpeg(args, params.Output, duration, params.Progress)
+	}
+
+	if err := runFFmpeg(args, nil, duration, params.Progress); err != nil {
+		return err
+	}
+
+	if params.FileMode != 0 {
+		if err := os.Chmod(params.OutputPath, params.FileMode); err != nil {
+			return fmt.Errorf("failed to set clip permissions: %w", err)
+		}
+	}
+	return nil
+}
+
+// BuildFFmpegArgs returns the arguments ClipVideo runs ffmpeg with, without
+// running anything. Subtitles are burned from SubtitlePath as given, where
+// ClipVideo uses a copy shifted to the clip start, and AspectRatio needs
+// SourceWidth and SourceHeight, which ClipVideo would probe. Progress
+// reporting arguments are left out.
+func BuildFFmpegArgs(params ClipParams) ([]string, error) {
+	return buildFFmpegArgs(params, params.SubtitlePath)
+}
+
+// buildFFmpegArgs builds ClipVideo's ffmpeg arguments, burning in the
+// subtitle file at subtitles, if any
+func buildFFmpegArgs(params ClipParams, subtitles string) ([]string, error) {
+	duration, _ := CalculateClipDuration(params.StartTime, params.EndTime)
+	filters, err := clipFilters(params, subtitles)
+	if err != nil {
+		return nil, err
+	}
+
+	// Using -ss before -i for fast seeking, then -t for the clip length
 	args := []string{
 		"-y", // Overwrite output file if it exists
 		"-ss", params.StartTime,
 		"-i", params.InputPath,
-		"-to", params.EndTime,
-		"-c", "copy", // Copy streams without re-encoding (fast!)
-		params.OutputPath,
+		"-t", strconv.FormatFloat(duration.Seconds(), 'f', 3, 64),
+	}
+
+	if len(filters) > 0 {
+		args = append(args, "-vf", strings.Join(filters, ","))
+		args = append(args, videoEncodeArgs(params.Encode)...)
+		args = append(args, "-c:a", "copy")
+	} else {
+		args = append(args, "-c", "copy") // Copy streams without re-encoding (fast!)
+	}
+
+	if params.Output != nil {
+		format := params.StreamFormat
+		if format == "" {
+			format = DefaultStreamFormat
+		}
+		return append(args, "-f", format, "pipe:1"), nil
 	}
+	return append(args, params.OutputPath), nil
+}
 
-	cmd := exec.Command("ffmpeg", args...)
+// prepareClip does what BuildFFmpegArgs leaves to the caller: it probes
+// the source's resolution for AspectRatio unless it is already known,
+// checks the crop, and writes the subtitles shifted to the clip start into
+// dir. It returns the completed params and the shifted subtitle file.
+func prepareClip(params ClipParams, dir string) (ClipParams, string, error) {
+	if params.AspectRatio != "" {
+		if params.SourceWidth == 0 || params.SourceHeight == 0 {
+			info, err := GetVideoInfo(params.InputPath)
+			if err != nil {
+				return params, "", err
+			}
+			params.SourceWidth, params.SourceHeight = info.Width, info.Height
+		}
+		if _, err := PlanAspectCrop(params.SourceWidth, params.SourceHeight, params.AspectRatio); err != nil {
+			return params, "", err
+		}
+	}
 
-	output, err := cmd.CombinedOutput()
+	if params.SubtitlePath == "" {
+		return params, "", nil
+	}
+	// The clip starts at zero after input seeking, so shift the cues by
+	// the start time before handing them to the filter
+	start, err := ParseTimestamp(params.StartTime)
+	if err != nil {
+		return params, "", fmt.Errorf("invalid clip range: %w", err)
+	}
+	subtitles, _, err := PrepareSubtitles(params.SubtitlePath, start, dir)
 	if err != nil {
-		return fmt.Errorf("ffmpeg error: %w\nOutput: %s", err, string(output))
+		return params, "", err
 	}
+	return params, subtitles, nil
+}
 
-	return nil
+// clipFilters returns the ffmpeg filters a clip needs: the aspect crop,
+// then the subtitles at subtitles, so they are laid out on the cropped
+// frame. No filters means the streams can be copied. A crop of a source
+// whose size is unknown is an error rather than a clip left uncropped.
+func clipFilters(params ClipParams, subtitles string) ([]string, error) {
+	var filters []string
+	if params.AspectRatio != "" {
+		crop, err := PlanAspectCrop(params.SourceWidth, params.SourceHeight, params.AspectRatio)
+		if err != nil {
+			return nil, err
+		}
+		if !crop.IsNoop() {
+			filters = append(filters, crop.filter())
+		}
+	}
+	if subtitles != "" {
+		format, err := DetectSubtitleFormat(subtitles)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, SubtitleFilter(subtitles, format))
+	}
+	return filters, nil
+}
+
+// ExtractFrames saves count JPEG frames evenly spaced across a video of the
+// given duration into dir and returns their paths in order
+func ExtractFrames(path string, duration time.Duration, count int, dir string) ([]string, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf("frame count must be positive")
+	}
+	if duration <= 0 {
+		return nil, fmt.Errorf("video has no duration")
+	}
+	return ExtractFramesAt(path, FrameTimes(0, duration, count), dir)
 }
 
-// CheckFFmpeg checks if ffmpeg is installed
+// FrameTimes returns count timestamps evenly spaced between start and end.
+// Each is the middle of one of count equal slices, so frames avoid the very
+// first and last instants, which are often black.
+func FrameTimes(start, end time.Duration, count int) []time.Duration {
+	if count <= 0 || end <= start {
+		return nil
+	}
+	times := make([]time.Duration, count)
+	for i := range times {
+		times[i] = start + (end-start)*time.Duration(2*i+1)/time.Duration(2*count)
+	}
+	return times
+}
+
+// ExtractFramesAt saves a JPEG frame at each timestamp into dir and returns
+// their paths in order
+func ExtractFramesAt(path string, times []time.Duration, dir string) ([]string, error) {
+	frames := make([]string, 0, len(times))
+	for i, at := range times {
+		framePath := filepath.Join(dir, fmt.Sprintf("frame_%02d.jpg", i+1))
+
+		cmd := exec.Command("ffmpeg",
+			"-y",
+			"-ss", strconv.FormatFloat(at.Seconds(), 'f', 3, 64),
+			"-i", path,
+			"-frames:v", "1",
+			"-q:v", "3",
+			framePath,
+		)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("ffmpeg error: %w\nOutput: %s", err, string(output))
+		}
+		frames = append(frames, framePath)
+	}
+
+	return frames, nil
+}
+
+// CheckFFmpeg checks if ffmpeg is installed. The probe is cached, so later
+// calls and DetectFFmpegVersion don't run ffmpeg again.
 func CheckFFmpeg() error {
-	cmd := exec.Command("ffmpeg", "-version")
-	if err := cmd.Run(); err != nil {
+	if _, err := ffmpegProbe(); err != nil {
 		return fmt.Errorf("ffmpeg not found.\n\n%s", GetFFmpegInstallHelp())
 	}
 	return nil
@@ -118,33 +495,62 @@ func CheckFFprobe() error {
 	return nil
 }
 
-// GetFFmpegInstallHelp returns platform-specific installation instructions
+// GetFFmpegInstallHelp returns platform-specific installation instructions,
+// leading with the command for the package manager found on this machine
 func GetFFmpegInstallHelp() string {
-	switch os := detectOS(); os {
+	cmd, ok := DetectFFmpegInstallCommand()
+	return installHelp(detectOS(), cmd, ok)
+}
+
+// installHelp builds the install instructions for goos, suggesting cmd
+// when a package manager was detected
+func installHelp(goos string, cmd InstallCommand, ok bool) string {
+	var b strings.Builder
+	if ok {
+		fmt.Fprintf(&b, "Install FFmpeg with %s:\n  %s\n\n", cmd.Manager, cmd)
+	}
+
+	switch goos {
 	case "darwin":
-		return `Install FFmpeg on macOS:
+		if !ok {
+			b.WriteString(`Install FFmpeg on macOS with Homebrew (https://brew.sh):
   brew install ffmpeg
 
-Or download from: https://ffmpeg.org/download.html`
+`)
+		}
+		b.WriteString(`Or download from: https://ffmpeg.org/download.html`)
 	case "linux":
-		return `Install FFmpeg on Linux:
+		if !ok {
+			b.WriteString(`Install FFmpeg on Linux:
   Ubuntu/Debian: sudo apt install ffmpeg
   Fedora:        sudo dnf install ffmpeg
   Arch:          sudo pacman -S ffmpeg
+  openSUSE:      sudo zypper install ffmpeg
+  Alpine:        sudo apk add ffmpeg
 
-Or download from: https://ffmpeg.org/download.html`
+`)
+		}
+		b.WriteString(`Or download from: https://ffmpeg.org/download.html`)
 	case "windows":
-		return `Install FFmpeg on Windows:
-  winget install ffmpeg
-  
+		if !ok {
+			b.WriteString(`Install FFmpeg on Windows:
+  winget install --id Gyan.FFmpeg -e
+
 Or with Chocolatey:
   choco install ffmpeg
 
-Or download from: https://ffmpeg.org/download.html
-Then add to PATH.`
+`)
+		}
+		b.WriteString(`Or download from: https://ffmpeg.org/download.html
+Then add to PATH.`)
 	default:
-		return `Please install FFmpeg from: https://ffmpeg.org/download.html`
+		if ok {
+			b.WriteString(`Or download from: https://ffmpeg.org/download.html`)
+		} else {
+			b.WriteString(`Please install FFmpeg from: https://ffmpeg.org/download.html`)
+		}
 	}
+	return b.String()
 }
 
 // detectOS returns the current operating system
@@ -170,7 +576,17 @@ func IsVideoFile(path string) bool {
 	return videoExts[ext]
 }
 
-// CalculateClipDuration calculates the duration between two timestamps
+// DefaultMinClipDuration is the shortest clip CapyCut will cut by default
+const DefaultMinClipDuration = 100 * time.Millisecond
+
+// MinClipDurationEnvVar overrides DefaultMinClipDuration (Go duration, e.g. 500ms)
+const MinClipDurationEnvVar = "CAPYCUT_MIN_CLIP"
+
+// ErrEmptyClip is returned when the end time is not after the start time
+var ErrEmptyClip = errors.New("end time must be after start time")
+
+// CalculateClipDuration calculates the duration between two timestamps.
+// A zero or negative result is reported as ErrEmptyClip.
 func CalculateClipDuration(startTime, endTime string) (time.Duration, error) {
 	start, err := ParseTimestamp(startTime)
 	if err != nil {
@@ -180,17 +596,86 @@ func CalculateClipDuration(startTime, endTime string) (time.Duration, error) {
 	if err != nil {
 		return 0, err
 	}
+	if end <= start {
+		return 0, fmt.Errorf("%w (start %s, end %s)", ErrEmptyClip, startTime, endTime)
+	}
 	return end - start, nil
 }
 
+// ValidateClipLength calculates the clip duration and rejects clips shorter
+// than min, asking the user for an explicit range instead
+func ValidateClipLength(startTime, endTime string, min time.Duration) (time.Duration, error) {
+	duration, err := CalculateClipDuration(startTime, endTime)
+	if errors.Is(err, ErrEmptyClip) {
+		return 0, fmt.Errorf("the clip from %s to %s is empty; please specify a range, e.g. \"from 2:00 to 2:30\"", startTime, endTime)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if duration < min {
+		return 0, fmt.Errorf("the clip from %s to %s is only %s long (minimum %s); please specify a longer range", startTime, endTime, duration, min)
+	}
+	return duration, nil
+}
+
+// ParseClipRange reads a start and end typed by the user, e.g. to nudge the
+// times the AI parsed, in any format ParseTimestamp accepts. The range has
+// to end within the video (when videoDuration is known) and be at least min
+// long. The times are returned as HH:MM:SS, with .mmm when needed.
+func ParseClipRange(startInput, endInput string, videoDuration, min time.Duration) (start, end string, err error) {
+	startAt, err := ParseTimestamp(startInput)
+	if err != nil || startAt < 0 {
+		return "", "", fmt.Errorf("invalid start time %q", strings.TrimSpace(startInput))
+	}
+	endAt, err := ParseTimestamp(endInput)
+	if err != nil || endAt < 0 {
+		return "", "", fmt.Errorf("invalid end time %q", strings.TrimSpace(endInput))
+	}
+	if videoDuration > 0 && endAt > videoDuration {
+		return "", "", fmt.Errorf("end time %s is past the end of the video (%s)", FormatTimestamp(endAt), FormatTimestamp(videoDuration))
+	}
+
+	start, end = FormatTimestamp(startAt), FormatTimestamp(endAt)
+	if _, err := ValidateClipLength(start, end, min); err != nil {
+		return "", "", err
+	}
+	return start, end, nil
+}
+
+// FormatTimestamp formats a position in the video as HH:MM:SS, adding .mmm
+// when there are milliseconds, the way the AI parser reports times
+func FormatTimestamp(d time.Duration) string {
+	h := int(d.Hours())
+	m := int(d.Minutes()) % 60
+	s := int(d.Seconds()) % 60
+	if ms := d.Milliseconds() % 1000; ms > 0 {
+		return fmt.Sprintf("%02d:%02d:%02d.%03d", h, m, s, ms)
+	}
+	return fmt.Sprintf("%02d:%02d:%02d", h, m, s)
+}
+
+// MinClipDurationFromEnv returns the minimum clip length from
+// CAPYCUT_MIN_CLIP, or DefaultMinClipDuration when unset
+func MinClipDurationFromEnv() (time.Duration, error) {
+	v := strings.TrimSpace(os.Getenv(MinClipDurationEnvVar))
+	if v == "" {
+		return DefaultMinClipDuration, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s %q: expected a non-negative duration like 500ms", MinClipDurationEnvVar, v)
+	}
+	return d, nil
+}
+
 // ParseTimestamp parses a timestamp string into a duration
-// Supports formats: HH:MM:SS, MM:SS, SS, or decimal seconds
+// Supports formats: HH:MM:SS, MM:SS, SS, or decimal seconds, each with optional .mmm
 func ParseTimestamp(ts string) (time.Duration, error) {
 	ts = strings.TrimSpace(ts)
 
 	// Try parsing as decimal seconds first
 	if secs, err := strconv.ParseFloat(ts, 64); err == nil {
-		return time.Duration(secs * float64(time.Second)), nil
+		return secondsToDuration(secs), nil
 	}
 
 	parts := strings.Split(ts, ":")
@@ -201,7 +686,7 @@ func ParseTimestamp(ts string) (time.Duration, error) {
 		if err != nil {
 			return 0, fmt.Errorf("invalid timestamp: %s", ts)
 		}
-		return time.Duration(secs * float64(time.Second)), nil
+		return secondsToDuration(secs), nil
 	case 2:
 		// MM:SS
 		mins, err := strconv.Atoi(parts[0])
@@ -212,7 +697,7 @@ func ParseTimestamp(ts string) (time.Duration, error) {
 		if err != nil {
 			return 0, fmt.Errorf("invalid seconds: %s", parts[1])
 		}
-		return time.Duration(mins)*time.Minute + time.Duration(secs*float64(time.Second)), nil
+		return time.Duration(mins)*time.Minute + secondsToDuration(secs), nil
 	case 3:
 		// HH:MM:SS
 		hours, err := strconv.Atoi(parts[0])
@@ -227,8 +712,14 @@ func ParseTimestamp(ts string) (time.Duration, error) {
 		if err != nil {
 			return 0, fmt.Errorf("invalid seconds: %s", parts[2])
 		}
-		return time.Duration(hours)*time.Hour + time.Duration(mins)*time.Minute + time.Duration(secs*float64(time.Second)), nil
+		return time.Duration(hours)*time.Hour + time.Duration(mins)*time.Minute + secondsToDuration(secs), nil
 	default:
 		return 0, fmt.Errorf("invalid timestamp format: %s", ts)
 	}
 }
+
+// secondsToDuration converts fractional seconds, rounding away float error
+// so values like 1.001 stay exactly 1s1ms
+func secondsToDuration(secs float64) time.Duration {
+	return time.Duration(math.Round(secs * float64(time.Second)))
+}
@@ -1,10 +1,385 @@
 package video
 
 import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 )
 
+// makeTestVideo renders a short testsrc pattern into a temp dir and returns its path.
+// Every frame is a keyframe so stream-copy cuts land exactly on the requested times.
+// The test is skipped when ffmpeg or ffprobe is not installed.
+func makeTestVideo(t *testing.T, seconds int) string {
+	t.Helper()
+
+	if err := CheckFFmpeg(); err != nil {
+		t.Skip("ffmpeg not available, skipping synthetic video test")
+	}
+	if err := CheckFFprobe(); err != nil {
+		t.Skip("ffprobe not available, skipping synthetic video test")
+	}
+
+	path := filepath.Join(t.TempDir(), "testsrc.mp4")
+	cmd := exec.Command("ffmpeg",
+		"-y",
+		"-f", "lavfi",
+		"-i", fmt.Sprintf("testsrc=duration=%d:size=160x120:rate=25", seconds),
+		"-c:v", "mpeg4",
+		"-g", "1",
+		path,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to generate test video: %v\n%s", err, output)
+	}
+	return path
+}
+
+// assertDurationNear fails when got is further than 100ms from want
+func assertDurationNear(t *testing.T, what string, got, want time.Duration) {
+	t.Helper()
+	diff := got - want
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > 100*time.Millisecond {
+		t.Errorf("%s = %v, want %v (±100ms)", what, got, want)
+	}
+}
+
+func TestGetVideoInfo_Synthetic(t *testing.T) {
+	path := makeTestVideo(t, 4)
+
+	info, err := GetVideoInfo(path)
+	if err != nil {
+		t.Fatalf("GetVideoInfo() error: %v", err)
+	}
+
+	assertDurationNear(t, "duration", info.Duration, 4*time.Second)
+	if info.Filename != "testsrc.mp4" {
+		t.Errorf("Filename = %q, want testsrc.mp4", info.Filename)
+	}
+	if info.Path != path {
+		t.Errorf("Path = %q, want %q", info.Path, path)
+	}
+	if info.Width != 160 || info.Height != 120 {
+		t.Errorf("resolution = %dx%d, want 160x120", info.Width, info.Height)
+	}
+	if info.HasAudio {
+		t.Error("HasAudio = true for a video without an audio stream")
+	}
+}
+
+func TestParseProbe(t *testing.T) {
+	tests := []struct {
+		name          string
+		output        string
+		width, height int
+		hasAudio      bool
+	}{
+		{"landscape", `{"streams": [{"codec_type": "video", "width": 1920, "height": 1080}], "format": {"duration": "12.500000"}}`, 1920, 1080, false},
+		{"rotate tag", `{"streams": [{"codec_type": "video", "width": 1920, "height": 1080, "tags": {"rotate": "90"}}], "format": {"duration": "12.5"}}`, 1080, 1920, false},
+		{"rotation side data", `{"streams": [{"codec_type": "video", "width": 1920, "height": 1080, "side_data_list": [{"rotation": -90}]}], "format": {"duration": "12.5"}}`, 1080, 1920, false},
+		{"upside down", `{"streams": [{"codec_type": "video", "width": 1920, "height": 1080, "side_data_list": [{"rotation": 180}]}], "format": {"duration": "12.5"}}`, 1920, 1080, false},
+		{"with audio", `{"streams": [{"codec_type": "audio"}, {"codec_type": "video", "width": 1280, "height": 720}, {"codec_type": "video", "width": 320, "height": 240}], "format": {"duration": "12.5"}}`, 1280, 720, true},
+		{"audio only", `{"streams": [{"codec_type": "audio"}], "format": {"duration": "12.5"}}`, 0, 0, true},
+		{"no streams", `{"streams": [], "format": {"duration": "12.5"}}`, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := parseProbe([]byte(tt.output), "/videos/talk.mp4")
+			if err != nil {
+				t.Fatalf("parseProbe() error: %v", err)
+			}
+			if info.Duration != 12500*time.Millisecond || info.Filename != "talk.mp4" {
+				t.Errorf("parseProbe() = %+v, want 12.5s of talk.mp4", info)
+			}
+			if info.Width != tt.width || info.Height != tt.height {
+				t.Errorf("resolution = %dx%d, want %dx%d", info.Width, info.Height, tt.width, tt.height)
+			}
+			if info.HasAudio != tt.hasAudio {
+				t.Errorf("HasAudio = %v, want %v", info.HasAudio, tt.hasAudio)
+			}
+		})
+	}
+
+	if _, err := parseProbe([]byte(`{"format": {"duration": "N/A"}}`), "x.mp4"); err == nil {
+		t.Error("parseProbe() should fail without a duration")
+	}
+}
+
+func TestClipVideo_Synthetic(t *testing.T) {
+	path := makeTestVideo(t, 5)
+
+	tests := []struct {
+		name      string
+		startTime string
+		endTime   string
+		wantName  string
+	}{
+		{"whole seconds", "00:00:01", "00:00:03", "testsrc_clip_00-00-01_to_00-00-03.mp4"},
+		{"from the start", "00:00:00", "00:00:02", "testsrc_clip_00-00-00_to_00-00-02.mp4"},
+		{"milliseconds", "00:00:01.500", "00:00:04", "testsrc_clip_00-00-01.500_to_00-00-04.mp4"},
+		// An end time passed with -to would be read as a length after the
+		// input seek and give a 4s clip here
+		{"late start", "00:00:03", "00:00:04", "testsrc_clip_00-00-03_to_00-00-04.mp4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputPath := GenerateOutputPath(path, tt.startTime, tt.endTime, "")
+			if filepath.Base(outputPath) != tt.wantName {
+				t.Errorf("GenerateOutputPath() = %q, want %q", filepath.Base(outputPath), tt.wantName)
+			}
+			if filepath.Dir(outputPath) != filepath.Dir(path) {
+				t.Errorf("output dir = %q, want alongside input in %q", filepath.Dir(outputPath), filepath.Dir(path))
+			}
+
+			var last float64
+			err := ClipVideo(ClipParams{
+				InputPath:  path,
+				StartTime:  tt.startTime,
+				EndTime:    tt.endTime,
+				OutputPath: outputPath,
+				Progress:   func(f float64) { last = f },
+			})
+			if err != nil {
+				t.Fatalf("ClipVideo() error: %v", err)
+			}
+			if last != 1 {
+				t.Errorf("last progress = %v, want 1", last)
+			}
+
+			want, err := CalculateClipDuration(tt.startTime, tt.endTime)
+			if err != nil {
+				t.Fatalf("CalculateClipDuration() error: %v", err)
+			}
+
+			info, err := GetVideoInfo(outputPath)
+			if err != nil {
+				t.Fatalf("GetVideoInfo(output) error: %v", err)
+			}
+			assertDurationNear(t, "clip duration", info.Duration, want)
+		})
+	}
+}
+
+func TestBuildFFmpegArgs(t *testing.T) {
+	base := ClipParams{InputPath: "in.mp4", StartTime: "00:01:00", EndTime: "00:01:30.500", OutputPath: "out.mp4"}
+	join := func(args []string, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("BuildFFmpegArgs() error: %v", err)
+		}
+		return strings.Join(args, " ")
+	}
+
+	if got, want := join(BuildFFmpegArgs(base)), "-y -ss 00:01:00 -i in.mp4 -t 30.500 -c copy out.mp4"; got != want {
+		t.Errorf("plain cut = %q, want %q", got, want)
+	}
+
+	streamed := base
+	streamed.Output = &bytes.Buffer{}
+	if got := join(BuildFFmpegArgs(streamed)); !strings.HasSuffix(got, "-c copy -f matroska pipe:1") {
+		t.Errorf("streamed cut = %q, want Matroska on stdout", got)
+	}
+
+	cropped := base
+	cropped.AspectRatio = "9:16"
+	cropped.SourceWidth, cropped.SourceHeight = 1920, 1080
+	cropped.Encode = EncodeOptions{CRF: 20}
+	want := "-y -ss 00:01:00 -i in.mp4 -t 30.500 -vf crop=606:1080:657:0 -c:v libx264 -preset medium -crf 20 -c:a copy out.mp4"
+	if got := join(BuildFFmpegArgs(cropped)); got != want {
+		t.Errorf("cropped cut = %q, want %q", got, want)
+	}
+
+	// A source already at the ratio is still copied
+	cropped.SourceWidth, cropped.SourceHeight = 1080, 1920
+	if got := join(BuildFFmpegArgs(cropped)); !strings.Contains(got, "-c copy") {
+		t.Errorf("cut of a 9:16 source = %q, want a stream copy", got)
+	}
+
+	subtitled := base
+	subtitled.SubtitlePath = "talk.srt"
+	if got := join(BuildFFmpegArgs(subtitled)); !strings.Contains(got, "-vf subtitles=filename=talk.srt -c:v libx264") {
+		t.Errorf("subtitled cut = %q, want the subtitles burned in", got)
+	}
+
+	// A crop without the source size fails rather than copying uncropped
+	unsized := base
+	unsized.AspectRatio = "9:16"
+	if _, err := BuildFFmpegArgs(unsized); err == nil {
+		t.Error("BuildFFmpegArgs() of a crop without the source size should fail")
+	}
+}
+
+func TestClipVideo_ToWriter(t *testing.T) {
+	path := makeTestVideo(t, 4)
+
+	var out bytes.Buffer
+	err := ClipVideo(ClipParams{
+		InputPath: path,
+		StartTime: "00:00:01",
+		EndTime:   "00:00:03",
+		Output:    &out,
+	})
+	if err != nil {
+		t.Fatalf("ClipVideo() error: %v", err)
+	}
+
+	// Matroska starts with the EBML magic number
+	if !bytes.HasPrefix(out.Bytes(), []byte{0x1A, 0x45, 0xDF, 0xA3}) {
+		t.Fatalf("streamed clip is not Matroska (%d bytes)", out.Len())
+	}
+
+	streamed := filepath.Join(t.TempDir(), "streamed.mkv")
+	if err := os.WriteFile(streamed, out.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := GetVideoInfo(streamed)
+	if err != nil {
+		t.Fatalf("GetVideoInfo(streamed) error: %v", err)
+	}
+	assertDurationNear(t, "streamed clip duration", info.Duration, 2*time.Second)
+}
+
+func TestClipVideo_InvalidRange(t *testing.T) {
+	err := ClipVideo(ClipParams{
+		InputPath:  "input.mp4",
+		StartTime:  "not-a-time",
+		EndTime:    "00:00:03",
+		OutputPath: "output.mp4",
+	})
+	if err == nil {
+		t.Error("ClipVideo() should reject an unparseable start time")
+	}
+}
+
+func TestExtractFrames_Synthetic(t *testing.T) {
+	input := makeTestVideo(t, 3)
+	dir := t.TempDir()
+
+	frames, err := ExtractFrames(input, 3*time.Second, 3, dir)
+	if err != nil {
+		t.Fatalf("ExtractFrames() failed: %v", err)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("got %d frames, want 3", len(frames))
+	}
+	for _, f := range frames {
+		if info, err := os.Stat(f); err != nil || info.Size() == 0 {
+			t.Errorf("frame %s missing or empty: %v", f, err)
+		}
+	}
+}
+
+func TestExtractFrames_InvalidArgs(t *testing.T) {
+	if _, err := ExtractFrames("input.mp4", time.Second, 0, t.TempDir()); err == nil {
+		t.Error("ExtractFrames() should reject a zero frame count")
+	}
+	if _, err := ExtractFrames("input.mp4", 0, 3, t.TempDir()); err == nil {
+		t.Error("ExtractFrames() should reject a zero duration")
+	}
+}
+
+func TestValidateClipLength(t *testing.T) {
+	tests := []struct {
+		name      string
+		startTime string
+		endTime   string
+		min       time.Duration
+		want      time.Duration
+		wantErr   bool
+	}{
+		{"normal clip", "00:01:00", "00:01:30", DefaultMinClipDuration, 30 * time.Second, false},
+		{"exactly the minimum", "00:00:01.000", "00:00:01.100", DefaultMinClipDuration, 100 * time.Millisecond, false},
+		{"below the minimum", "00:00:01.000", "00:00:01.050", DefaultMinClipDuration, 0, true},
+		{"zero length", "2:00", "2:00", DefaultMinClipDuration, 0, true},
+		{"inverted", "3:00", "2:00", DefaultMinClipDuration, 0, true},
+		{"custom minimum", "00:00:00", "00:00:02", 5 * time.Second, 0, true},
+		{"invalid timestamp", "bogus", "2:00", DefaultMinClipDuration, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidateClipLength(tt.startTime, tt.endTime, tt.min)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateClipLength() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ValidateClipLength() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseClipRange(t *testing.T) {
+	tests := []struct {
+		name               string
+		start, end         string
+		wantStart, wantEnd string
+		wantErr            string
+	}{
+		{"normalizes formats", "1:23", "125.5", "00:01:23", "00:02:05.500", ""},
+		{"keeps HH:MM:SS", "00:00:10", "00:00:20", "00:00:10", "00:00:20", ""},
+		{"bad start", "abc", "00:00:20", "", "", "invalid start time"},
+		{"bad end", "10", "1:xx", "", "", "invalid end time"},
+		{"past the end", "10", "11:00", "", "", "past the end of the video"},
+		{"empty range", "20", "10", "", "", "is empty"},
+		{"too short", "10", "10.2", "", "", "only"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, err := ParseClipRange(tt.start, tt.end, 10*time.Minute, time.Second)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseClipRange() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseClipRange() error = %v", err)
+			}
+			if start != tt.wantStart || end != tt.wantEnd {
+				t.Errorf("ParseClipRange() = %s, %s; want %s, %s", start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestMinClipDurationFromEnv(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", DefaultMinClipDuration, false},
+		{"500ms", 500 * time.Millisecond, false},
+		{"0", 0, false},
+		{"-1s", 0, true},
+		{"soon", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Setenv(MinClipDurationEnvVar, tt.value)
+		got, err := MinClipDurationFromEnv()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("MinClipDurationFromEnv(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("MinClipDurationFromEnv(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
 func TestParseTimestamp(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -42,6 +417,18 @@ func TestParseTimestamp(t *testing.T) {
 			expected: 3*time.Minute + 30*time.Second + 500*time.Millisecond,
 			wantErr:  false,
 		},
+		{
+			name:     "HH:MM:SS.mmm milliseconds",
+			input:    "00:00:01.001",
+			expected: 1*time.Second + 1*time.Millisecond,
+			wantErr:  false,
+		},
+		{
+			name:     "MM:SS.mmm milliseconds",
+			input:    "02:15.250",
+			expected: 2*time.Minute + 15*time.Second + 250*time.Millisecond,
+			wantErr:  false,
+		},
 		{
 			name:     "zero time",
 			input:    "00:00:00",
@@ -119,11 +506,24 @@ func TestFormatDuration(t *testing.T) {
 			input:    10*time.Hour + 5*time.Minute + 3*time.Second,
 			expected: "10:05:03",
 		},
+		{
+			name:     "milliseconds",
+			input:    3*time.Minute + 30*time.Second + 45*time.Millisecond,
+			expected: "03:30.045",
+		},
+		{
+			name:     "hours with milliseconds",
+			input:    1*time.Hour + 2*time.Second + 500*time.Millisecond,
+			expected: "01:00:02.500",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			result := FormatDuration(tt.input)
+			if roundTrip, err := ParseTimestamp(result); err != nil || roundTrip != tt.input.Truncate(time.Millisecond) {
+				t.Errorf("ParseTimestamp(FormatDuration(%v)) = %v, %v; want round trip", tt.input, roundTrip, err)
+			}
 			if result != tt.expected {
 				t.Errorf("FormatDuration(%v) = %q, want %q", tt.input, result, tt.expected)
 			}
@@ -160,6 +560,13 @@ func TestCalculateClipDuration(t *testing.T) {
 			expected:  30 * time.Minute,
 			wantErr:   false,
 		},
+		{
+			name:      "millisecond precision",
+			startTime: "00:00:01.250",
+			endTime:   "00:00:02.001",
+			expected:  751 * time.Millisecond,
+			wantErr:   false,
+		},
 		{
 			name:      "invalid start time",
 			startTime: "invalid",
@@ -174,6 +581,20 @@ func TestCalculateClipDuration(t *testing.T) {
 			expected:  0,
 			wantErr:   true,
 		},
+		{
+			name:      "zero length",
+			startTime: "00:02:00",
+			endTime:   "00:02:00",
+			expected:  0,
+			wantErr:   true,
+		},
+		{
+			name:      "end before start",
+			startTime: "00:05:00",
+			endTime:   "00:03:00",
+			expected:  0,
+			wantErr:   true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -251,7 +672,7 @@ func TestGenerateOutputPath(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := GenerateOutputPath(tt.inputPath, tt.startTime, tt.endTime)
+			result := GenerateOutputPath(tt.inputPath, tt.startTime, tt.endTime, "")
 			for _, substr := range tt.contains {
 				if !containsString(result, substr) {
 					t.Errorf("GenerateOutputPath() = %q, expected to contain %q", result, substr)
@@ -261,6 +682,185 @@ func TestGenerateOutputPath(t *testing.T) {
 	}
 }
 
+func TestGenerateOutputPath_Contract(t *testing.T) {
+	tests := []struct {
+		name      string
+		inputPath string
+		startTime string
+		endTime   string
+		ext       string
+		want      string
+	}{
+		{
+			name:      "colons become dashes",
+			inputPath: "/videos/talk.mp4",
+			startTime: "00:01:00",
+			endTime:   "00:02:30",
+			want:      "/videos/talk_clip_00-01-00_to_00-02-30.mp4",
+		},
+		{
+			name:      "milliseconds kept",
+			inputPath: "/videos/talk.mp4",
+			startTime: "00:00:01.250",
+			endTime:   "00:00:02",
+			want:      "/videos/talk_clip_00-00-01.250_to_00-00-02.mp4",
+		},
+		{
+			name:      "unsafe characters sanitized",
+			inputPath: "/videos/talk.mp4",
+			startTime: " 1:00 ",
+			endTime:   "2/30",
+			want:      "/videos/talk_clip_1-00_to_2-30.mp4",
+		},
+		{
+			name:      "relative directory preserved",
+			inputPath: "clips/raw/movie.mkv",
+			startTime: "01:30:00",
+			endTime:   "02:00:00",
+			want:      filepath.Join("clips", "raw", "movie_clip_01-30-00_to_02-00-00.mkv"),
+		},
+		{
+			name:      "bare filename stays in current directory",
+			inputPath: "movie.mov",
+			startTime: "00:00:05",
+			endTime:   "00:00:10",
+			want:      "movie_clip_00-00-05_to_00-00-10.mov",
+		},
+		{
+			name:      "audio extension swap",
+			inputPath: "/videos/talk.mp4",
+			startTime: "00:01:00",
+			endTime:   "00:02:00",
+			ext:       ".mp3",
+			want:      "/videos/talk_clip_00-01-00_to_00-02-00.mp3",
+		},
+		{
+			name:      "gif extension without dot",
+			inputPath: "/videos/talk.mp4",
+			startTime: "00:01:00",
+			endTime:   "00:01:05",
+			ext:       "gif",
+			want:      "/videos/talk_clip_00-01-00_to_00-01-05.gif",
+		},
+		{
+			name:      "dots in base name",
+			inputPath: "/videos/my.talk.v2.webm",
+			startTime: "00:00:00",
+			endTime:   "00:00:30",
+			want:      "/videos/my.talk.v2_clip_00-00-00_to_00-00-30.webm",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GenerateOutputPath(filepath.FromSlash(tt.inputPath), tt.startTime, tt.endTime, tt.ext)
+			if want := filepath.FromSlash(tt.want); got != want {
+				t.Errorf("GenerateOutputPath() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestUniqueOutputPath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "talk_clip_00-01-00_to_00-02-00.mp4")
+
+	if got := UniqueOutputPath(path); got != path {
+		t.Errorf("UniqueOutputPath() with no file = %q, want %q", got, path)
+	}
+
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	second := filepath.Join(dir, "talk_clip_00-01-00_to_00-02-00_2.mp4")
+	if got := UniqueOutputPath(path); got != second {
+		t.Errorf("UniqueOutputPath() with existing file = %q, want %q", got, second)
+	}
+
+	if err := os.WriteFile(second, nil, 0644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	third := filepath.Join(dir, "talk_clip_00-01-00_to_00-02-00_3.mp4")
+	if got := UniqueOutputPath(path); got != third {
+		t.Errorf("UniqueOutputPath() with two existing files = %q, want %q", got, third)
+	}
+}
+
+func TestResolveOutputPath(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "talk.mp4")
+	name := "talk_clip_00-01-00_to_00-02-00.mp4"
+
+	existing := filepath.Join(dir, "existing")
+	if err := os.Mkdir(existing, 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{"empty output names next to input", "", filepath.Join(dir, name)},
+		{"explicit file used verbatim", filepath.Join(dir, "out.mp4"), filepath.Join(dir, "out.mp4")},
+		{"existing directory", existing, filepath.Join(existing, name)},
+		{"trailing separator creates directory", filepath.Join(dir, "new", "clips") + string(os.PathSeparator), filepath.Join(dir, "new", "clips", name)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveOutputPath(tt.output, input, "00:01:00", "00:02:00", "", 0)
+			if err != nil {
+				t.Fatalf("ResolveOutputPath() error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveOutputPath() = %q, want %q", got, tt.want)
+			}
+			if info, err := os.Stat(filepath.Dir(got)); err != nil || !info.IsDir() {
+				t.Errorf("output directory %q was not created", filepath.Dir(got))
+			}
+		})
+	}
+
+	// A clip already in the directory is not clobbered
+	if err := os.WriteFile(filepath.Join(existing, name), nil, 0644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	got, err := ResolveOutputPath(existing, input, "00:01:00", "00:02:00", "", 0)
+	if err != nil {
+		t.Fatalf("ResolveOutputPath() error: %v", err)
+	}
+	if want := filepath.Join(existing, "talk_clip_00-01-00_to_00-02-00_2.mp4"); got != want {
+		t.Errorf("ResolveOutputPath() with existing clip = %q, want %q", got, want)
+	}
+
+	// A directory mode is applied to the created directory only
+	if runtime.GOOS != "windows" {
+		private := filepath.Join(dir, "private") + string(os.PathSeparator)
+		if _, err := ResolveOutputPath(private, input, "00:01:00", "00:02:00", "", 0700); err != nil {
+			t.Fatalf("ResolveOutputPath() error: %v", err)
+		}
+		if info, err := os.Stat(private); err != nil {
+			t.Error(err)
+		} else if info.Mode().Perm() != 0700 {
+			t.Errorf("output directory mode = %v, want 0700", info.Mode().Perm())
+		}
+
+		// An existing directory keeps its own
+		if err := os.Chmod(private, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ResolveOutputPath(private, input, "00:01:00", "00:02:00", "", 0700); err != nil {
+			t.Fatalf("ResolveOutputPath() error: %v", err)
+		}
+		if info, err := os.Stat(private); err != nil {
+			t.Error(err)
+		} else if info.Mode().Perm() != 0755 {
+			t.Errorf("existing output directory mode = %v, want 0755 kept", info.Mode().Perm())
+		}
+	}
+}
+
 func containsString(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > 0 && containsSubstring(s, substr))
 }
@@ -273,3 +873,298 @@ func containsSubstring(s, substr string) bool {
 	}
 	return false
 }
+
+func TestBufferStdin(t *testing.T) {
+	mp4 := append([]byte{0, 0, 0, 0x20}, []byte("ftypisom")...)
+	mp4 = append(mp4, bytes.Repeat([]byte{1}, 1000)...)
+
+	path, cleanup, err := BufferStdin(bytes.NewReader(mp4), 4096)
+	if err != nil {
+		t.Fatalf("BufferStdin() error = %v", err)
+	}
+	if filepath.Base(path) != "stdin.mp4" {
+		t.Errorf("BufferStdin() path = %s, want stdin.mp4", path)
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, mp4) {
+		t.Errorf("buffered %d bytes, want %d", len(got), len(mp4))
+	}
+	cleanup()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("cleanup left %s behind", path)
+	}
+
+	if _, _, err := BufferStdin(bytes.NewReader(mp4), int64(len(mp4))-1); err == nil {
+		t.Error("BufferStdin() accepted input over the cap")
+	}
+	if _, cleanup, err := BufferStdin(bytes.NewReader(mp4), int64(len(mp4))); err != nil {
+		t.Errorf("BufferStdin() rejected input exactly at the cap: %v", err)
+	} else {
+		cleanup()
+	}
+	if _, _, err := BufferStdin(bytes.NewReader(nil), 4096); err == nil {
+		t.Error("BufferStdin() accepted empty input")
+	}
+}
+
+func TestSniffContainer(t *testing.T) {
+	ts := make([]byte, 400)
+	ts[0], ts[188], ts[376] = 0x47, 0x47, 0x47
+
+	tests := []struct {
+		name   string
+		header []byte
+		want   string
+	}{
+		{"mp4", []byte("\x00\x00\x00\x20ftypisom"), ".mp4"},
+		{"mov", []byte("\x00\x00\x00\x14ftypqt  "), ".mov"},
+		{"mkv", []byte("\x1a\x45\xdf\xa3\x93\x42\x82\x88matroska"), ".mkv"},
+		{"webm", []byte("\x1a\x45\xdf\xa3\x9f\x42\x82\x84webm"), ".webm"},
+		{"avi", []byte("RIFF\x00\x00\x00\x00AVI LIST"), ".avi"},
+		{"flv", []byte("FLV\x01\x05"), ".flv"},
+		{"mpeg-ts", ts, ".ts"},
+		{"unknown", []byte("hello"), ".mkv"},
+	}
+
+	for _, tt := range tests {
+		if got := sniffContainer(tt.header); got != tt.want {
+			t.Errorf("sniffContainer(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDetectInstallCommand(t *testing.T) {
+	tests := []struct {
+		name   string
+		goos   string
+		onPath []string
+		isRoot bool
+		want   string
+		wantOK bool
+	}{
+		{name: "macOS brew", goos: "darwin", onPath: []string{"brew"}, want: "brew install ffmpeg", wantOK: true},
+		{name: "debian with sudo", goos: "linux", onPath: []string{"apt-get", "sudo"}, want: "sudo apt-get install -y ffmpeg", wantOK: true},
+		{name: "debian as root", goos: "linux", onPath: []string{"apt-get", "sudo"}, isRoot: true, want: "apt-get install -y ffmpeg", wantOK: true},
+		{name: "fedora without sudo", goos: "linux", onPath: []string{"dnf"}, want: "dnf install -y ffmpeg", wantOK: true},
+		{name: "apt preferred over brew", goos: "linux", onPath: []string{"brew", "apt-get", "sudo"}, want: "sudo apt-get install -y ffmpeg", wantOK: true},
+		{name: "windows winget", goos: "windows", onPath: []string{"winget", "choco"}, want: "winget install --id Gyan.FFmpeg -e", wantOK: true},
+		{name: "windows choco", goos: "windows", onPath: []string{"choco"}, want: "choco install ffmpeg -y", wantOK: true},
+		{name: "no manager", goos: "linux", onPath: []string{"sudo"}},
+		{name: "unknown OS", goos: "plan9", onPath: []string{"brew"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookPath := func(bin string) (string, error) {
+				for _, p := range tt.onPath {
+					if p == bin {
+						return "/usr/bin/" + bin, nil
+					}
+				}
+				return "", exec.ErrNotFound
+			}
+			got, ok := detectInstallCommand(tt.goos, lookPath, tt.isRoot)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if got.String() != tt.want {
+				t.Errorf("command = %q, want %q", got.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestInstallHelp(t *testing.T) {
+	detected := InstallCommand{Manager: "dnf", Args: []string{"sudo", "dnf", "install", "-y", "ffmpeg"}}
+
+	help := installHelp("linux", detected, true)
+	if !strings.HasPrefix(help, "Install FFmpeg with dnf:\n  sudo dnf install -y ffmpeg") {
+		t.Errorf("help should lead with the detected command, got:\n%s", help)
+	}
+	if strings.Contains(help, "Ubuntu/Debian") {
+		t.Errorf("help should not list other distros when a manager was detected, got:\n%s", help)
+	}
+
+	help = installHelp("linux", InstallCommand{}, false)
+	if !strings.Contains(help, "sudo pacman -S ffmpeg") {
+		t.Errorf("help without a detected manager should list the distro commands, got:\n%s", help)
+	}
+
+	if help := installHelp("windows", InstallCommand{}, false); !strings.Contains(help, "winget install") {
+		t.Errorf("windows help should mention winget, got:\n%s", help)
+	}
+}
+
+func TestFrameTimes(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end time.Duration
+		count      int
+		want       []time.Duration
+	}{
+		{name: "whole range", start: 0, end: 60 * time.Second, count: 3, want: []time.Duration{10 * time.Second, 30 * time.Second, 50 * time.Second}},
+		{name: "offset range", start: 90 * time.Second, end: 150 * time.Second, count: 3, want: []time.Duration{100 * time.Second, 120 * time.Second, 140 * time.Second}},
+		{name: "single frame", start: 10 * time.Second, end: 20 * time.Second, count: 1, want: []time.Duration{15 * time.Second}},
+		{name: "empty range", start: 20 * time.Second, end: 20 * time.Second, count: 3},
+		{name: "no frames", start: 0, end: 10 * time.Second, count: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FrameTimes(tt.start, tt.end, tt.count)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("FrameTimes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilterTime(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{"2024-01-01", time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local), false},
+		{"2024-01-01T09:30", time.Date(2024, 1, 1, 9, 30, 0, 0, time.Local), false},
+		{"2024-01-01 09:30:15", time.Date(2024, 1, 1, 9, 30, 15, 0, time.Local), false},
+		{"2024-01-01T09:30:00Z", time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC), false},
+		{"yesterday", time.Time{}, true},
+		{"2024-13-01", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseFilterTime(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseFilterTime(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseFilterTime(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTimeFromName(t *testing.T) {
+	got, ok := TimeFromName("cam1_20240105_093000.mp4", "20060102_150405")
+	if !ok || !got.Equal(time.Date(2024, 1, 5, 9, 30, 0, 0, time.Local)) {
+		t.Errorf("TimeFromName = %v, %v", got, ok)
+	}
+	if _, ok := TimeFromName("holiday.mp4", "20060102_150405"); ok {
+		t.Error("TimeFromName found a timestamp in a name without one")
+	}
+}
+
+func TestFindVideos(t *testing.T) {
+	dir := t.TempDir()
+	jan := time.Date(2024, 1, 10, 12, 0, 0, 0, time.Local)
+	mar := time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)
+	files := map[string]time.Time{
+		"cam_20231231_235900.mp4": mar,
+		"cam_20240110_120000.mp4": jan,
+		"cam_20240310_120000.mkv": jan,
+		"notes.txt":               mar,
+		"untimed.mp4":             mar,
+	}
+	for name, mtime := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub.mp4"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	until := time.Date(2024, 2, 1, 0, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name         string
+		source       string
+		filter       TimeFilter
+		want         []string
+		wantFiltered int
+	}{
+		{
+			name:   "directory, no filter",
+			source: dir,
+			want:   []string{"cam_20231231_235900.mp4", "cam_20240110_120000.mp4", "cam_20240310_120000.mkv", "untimed.mp4"},
+		},
+		{
+			name:   "glob",
+			source: filepath.Join(dir, "*.mkv"),
+			want:   []string{"cam_20240310_120000.mkv"},
+		},
+		{
+			name:         "modification time",
+			source:       dir,
+			filter:       TimeFilter{Since: since},
+			want:         []string{"cam_20231231_235900.mp4", "cam_20240110_120000.mp4", "cam_20240310_120000.mkv", "untimed.mp4"},
+			wantFiltered: 0,
+		},
+		{
+			name:         "modification time range",
+			source:       dir,
+			filter:       TimeFilter{Since: since, Until: until},
+			want:         []string{"cam_20240110_120000.mp4", "cam_20240310_120000.mkv"},
+			wantFiltered: 2,
+		},
+		{
+			name:         "name timestamp",
+			source:       dir,
+			filter:       TimeFilter{Since: since, NameFormat: "20060102_150405"},
+			want:         []string{"cam_20240110_120000.mp4", "cam_20240310_120000.mkv"},
+			wantFiltered: 2,
+		},
+		{
+			name:         "name timestamp range",
+			source:       dir,
+			filter:       TimeFilter{Since: since, Until: until, NameFormat: "20060102_150405"},
+			want:         []string{"cam_20240110_120000.mp4"},
+			wantFiltered: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			videos, filtered, err := FindVideos(tt.source, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, v := range videos {
+				got = append(got, filepath.Base(v))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("FindVideos = %v, want %v", got, tt.want)
+			}
+			if filtered != tt.wantFiltered {
+				t.Errorf("filtered = %d, want %d", filtered, tt.wantFiltered)
+			}
+		})
+	}
+}
+
+func TestIsBatchSource(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.mp4")
+	if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{dir, true},
+		{file, false},
+		{filepath.Join(dir, "*.mp4"), true},
+		{filepath.Join(dir, "missing.mp4"), false},
+		{StdinPath, false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsBatchSource(tt.path); got != tt.want {
+			t.Errorf("IsBatchSource(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
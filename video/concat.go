@@ -0,0 +1,91 @@
+package video
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ConcatClips cuts each segment of input and joins them, in order, into
+// one file at output, such as a highlight reel. Each segment is cut with
+// ClipVideo, so its subtitles, aspect and encode settings apply; its
+// InputPath and OutputPath are replaced. The pieces are joined with
+// ffmpeg's concat demuxer by stream copy, and re-encoded with the first
+// segment's Encode settings if their codecs don't line up. The first
+// segment's FileMode is applied to output. The pieces are written next to
+// output and removed afterwards.
+func ConcatClips(input string, segments []ClipParams, output string) error {
+	if len(segments) == 0 {
+		return fmt.Errorf("no segments to join")
+	}
+
+	ext := filepath.Ext(output)
+	if ext == "" {
+		ext = filepath.Ext(input)
+	}
+
+	// Beside the output rather than in the temp dir, which may be too
+	// small for long segments
+	tmpDir, err := os.MkdirTemp(filepath.Dir(output), ".capycut-concat-")
+	if err != nil {
+		return fmt.Errorf("failed to create a directory for the segments: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var total time.Duration
+	var list strings.Builder
+	for i, segment := range segments {
+		segment.InputPath = input
+		segment.OutputPath = filepath.Join(tmpDir, fmt.Sprintf("segment-%03d%s", i+1, ext))
+		segment.Output = nil
+		segment.FileMode = 0
+		if err := ClipVideo(segment); err != nil {
+			return fmt.Errorf("segment %d: %w", i+1, err)
+		}
+
+		duration, _ := CalculateClipDuration(segment.StartTime, segment.EndTime)
+		total += duration
+		fmt.Fprintf(&list, "file %s\n", concatQuote(segment.OutputPath))
+	}
+
+	listPath := filepath.Join(tmpDir, "segments.txt")
+	if err := os.WriteFile(listPath, []byte(list.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write the segment list: %w", err)
+	}
+
+	if copyErr := runFFmpeg(BuildConcatArgs(listPath, output, nil), nil, total, nil); copyErr != nil {
+		// Segments whose streams differ can't be copied into one file
+		encode := segments[0].Encode
+		if err := runFFmpeg(BuildConcatArgs(listPath, output, &encode), nil, total, nil); err != nil {
+			return fmt.Errorf("failed to join the segments: stream copy: %w; re-encode: %w", copyErr, err)
+		}
+	}
+
+	if mode := segments[0].FileMode; mode != 0 {
+		if err := os.Chmod(output, mode); err != nil {
+			return fmt.Errorf("failed to set clip permissions: %w", err)
+		}
+	}
+	return nil
+}
+
+// BuildConcatArgs returns the ffmpeg arguments that join the files named
+// in a concat demuxer list into output. A nil encode copies the streams;
+// otherwise the video is re-encoded with it and the audio as AAC.
+func BuildConcatArgs(listPath, output string, encode *EncodeOptions) []string {
+	args := []string{"-y", "-f", "concat", "-safe", "0", "-i", listPath}
+	if encode == nil {
+		args = append(args, "-c", "copy")
+	} else {
+		args = append(args, videoEncodeArgs(*encode)...)
+		args = append(args, "-c:a", "aac")
+	}
+	return append(args, output)
+}
+
+// concatQuote quotes a path for a concat demuxer list
+func concatQuote(path string) string {
+	return "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+}
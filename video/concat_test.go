@@ -0,0 +1,79 @@
+package video
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildConcatArgs(t *testing.T) {
+	got := strings.Join(BuildConcatArgs("segments.txt", "out.mp4", nil), " ")
+	if want := "-y -f concat -safe 0 -i segments.txt -c copy out.mp4"; got != want {
+		t.Errorf("BuildConcatArgs(copy) = %q, want %q", got, want)
+	}
+
+	got = strings.Join(BuildConcatArgs("segments.txt", "out.mp4", &EncodeOptions{CRF: 20}), " ")
+	for _, want := range []string{"-c:v libx264", "-crf 20", "-c:a aac"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("BuildConcatArgs(re-encode) = %q, want it to contain %q", got, want)
+		}
+	}
+	if strings.Contains(got, "-c copy") {
+		t.Errorf("BuildConcatArgs(re-encode) = %q, still copies streams", got)
+	}
+	if !strings.HasSuffix(got, " out.mp4") {
+		t.Errorf("BuildConcatArgs(re-encode) = %q, want the output last", got)
+	}
+}
+
+func TestConcatQuote(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/tmp/segment-001.mp4", `'/tmp/segment-001.mp4'`},
+		{"/tmp/it's here.mp4", `'/tmp/it'\''s here.mp4'`},
+	}
+	for _, tt := range tests {
+		if got := concatQuote(tt.path); got != tt.want {
+			t.Errorf("concatQuote(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestConcatClips_NoSegments(t *testing.T) {
+	if err := ConcatClips("in.mp4", nil, filepath.Join(t.TempDir(), "out.mp4")); err == nil {
+		t.Error("ConcatClips() with no segments succeeded, want an error")
+	}
+}
+
+func TestConcatClips_Synthetic(t *testing.T) {
+	input := makeTestVideo(t, 6)
+	dir := t.TempDir()
+	output := filepath.Join(dir, "joined.mp4")
+
+	segments := []ClipParams{
+		{StartTime: "00:00:01", EndTime: "00:00:02"},
+		{StartTime: "00:00:04", EndTime: "00:00:05.5"},
+	}
+	if err := ConcatClips(input, segments, output); err != nil {
+		t.Fatalf("ConcatClips() error = %v", err)
+	}
+
+	info, err := GetVideoInfo(output)
+	if err != nil {
+		t.Fatalf("GetVideoInfo() error = %v", err)
+	}
+	assertDurationNear(t, "joined duration", info.Duration, 2500*time.Millisecond)
+
+	// Only the joined clip is left behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("output dir has %d entries, want only the joined clip", len(entries))
+	}
+}
@@ -0,0 +1,218 @@
+package video
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// HWAccel selects the H.264 encoder used when a clip has to be re-encoded
+type HWAccel string
+
+const (
+	HWAccelNone         HWAccel = "none"
+	HWAccelNVENC        HWAccel = "nvenc"
+	HWAccelQSV          HWAccel = "qsv"
+	HWAccelVideoToolbox HWAccel = "videotoolbox"
+)
+
+// softwareEncoder is the encoder used without hardware acceleration
+const softwareEncoder = "libx264"
+
+// ParseHWAccel parses a --hwaccel value; empty means none
+func ParseHWAccel(s string) (HWAccel, error) {
+	switch h := HWAccel(strings.ToLower(strings.TrimSpace(s))); h {
+	case "", HWAccelNone:
+		return HWAccelNone, nil
+	case HWAccelNVENC, HWAccelQSV, HWAccelVideoToolbox:
+		return h, nil
+	default:
+		return HWAccelNone, fmt.Errorf("unknown hardware accelerator %q (use nvenc, qsv, videotoolbox or none)", s)
+	}
+}
+
+// Encoder returns the ffmpeg video encoder name for the accelerator
+func (h HWAccel) Encoder() string {
+	switch h {
+	case HWAccelNVENC:
+		return "h264_nvenc"
+	case HWAccelQSV:
+		return "h264_qsv"
+	case HWAccelVideoToolbox:
+		return "h264_videotoolbox"
+	default:
+		return softwareEncoder
+	}
+}
+
+// listEncoders returns the output of "ffmpeg -encoders"; replaced in tests
+var listEncoders = func() (string, error) {
+	output, err := exec.Command("ffmpeg", "-hide_banner", "-encoders").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to list ffmpeg encoders: %w", err)
+	}
+	return string(output), nil
+}
+
+// ResolveHWAccel checks that ffmpeg was built with the accelerator's encoder.
+// When it wasn't, it returns HWAccelNone together with an error explaining
+// the fallback to libx264, which callers should show as a warning.
+func ResolveHWAccel(h HWAccel) (HWAccel, error) {
+	if h == HWAccelNone || h == "" {
+		return HWAccelNone, nil
+	}
+
+	encoders, err := listEncoders()
+	if err != nil {
+		return HWAccelNone, fmt.Errorf("%w; falling back to %s", err, softwareEncoder)
+	}
+	if !hasEncoder(encoders, h.Encoder()) {
+		return HWAccelNone, fmt.Errorf("ffmpeg has no %s encoder; falling back to %s", h.Encoder(), softwareEncoder)
+	}
+	return h, nil
+}
+
+// hasEncoder reports whether an "ffmpeg -encoders" listing includes name.
+// Each encoder line looks like " V....D h264_nvenc  NVIDIA NVENC H.264 encoder".
+func hasEncoder(listing, name string) bool {
+	for _, line := range strings.Split(listing, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[1] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultCRF and DefaultPreset match libx264's own defaults
+const (
+	DefaultCRF    = 23
+	DefaultPreset = "medium"
+)
+
+// x264Presets lists the libx264 presets from fastest to slowest
+var x264Presets = []string{"ultrafast", "superfast", "veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow"}
+
+// bitrateRe matches ffmpeg bitrates such as 2500k, 4M or 800000
+var bitrateRe = regexp.MustCompile(`^\d+(\.\d+)?[kKmM]?$`)
+
+// EncodeOptions controls how a clip is re-encoded. The zero value uses
+// libx264 at DefaultCRF and DefaultPreset. Bitrate, when set, replaces the
+// CRF with a target bitrate for users aiming at a file size.
+type EncodeOptions struct {
+	HWAccel HWAccel
+	CRF     int    // 1-51, lower is better; 0 selects DefaultCRF
+	Preset  string // libx264 preset name; mapped for hardware encoders
+	Bitrate string // e.g. "2500k" or "4M"
+}
+
+// Validate checks the options before any work is done
+func (o EncodeOptions) Validate() error {
+	if o.CRF < 0 || o.CRF > 51 {
+		return fmt.Errorf("crf must be between 1 and 51, got %d", o.CRF)
+	}
+	if o.Preset != "" && presetIndex(o.Preset) < 0 {
+		return fmt.Errorf("unknown preset %q (use %s)", o.Preset, strings.Join(x264Presets, ", "))
+	}
+	if o.Bitrate != "" {
+		if !bitrateRe.MatchString(o.Bitrate) {
+			return fmt.Errorf("invalid bitrate %q (use e.g. 2500k or 4M)", o.Bitrate)
+		}
+		if o.CRF != 0 {
+			return fmt.Errorf("crf and bitrate are alternatives; set only one")
+		}
+	}
+	return nil
+}
+
+// presetIndex returns the position of a preset in x264Presets, or -1
+func presetIndex(preset string) int {
+	for i, p := range x264Presets {
+		if p == preset {
+			return i
+		}
+	}
+	return -1
+}
+
+// videoEncodeArgs returns the ffmpeg arguments that select and tune the
+// video encoder for a re-encoded clip. libx264's CRF and preset are mapped
+// to each hardware encoder's closest equivalent.
+func videoEncodeArgs(o EncodeOptions) []string {
+	crf := o.CRF
+	if crf == 0 {
+		crf = DefaultCRF
+	}
+	preset := o.Preset
+	if preset == "" {
+		preset = DefaultPreset
+	}
+
+	args := []string{"-c:v", o.HWAccel.Encoder()}
+
+	switch o.HWAccel {
+	case HWAccelNVENC:
+		// NVENC presets run p1 (fastest) to p7 (slowest); medium is p4
+		args = append(args, "-preset", nvencPreset(preset))
+		if o.Bitrate == "" {
+			args = append(args, "-rc", "vbr", "-cq", strconv.Itoa(crf), "-b:v", "0")
+		}
+	case HWAccelQSV:
+		// QSV has no ultrafast/superfast; veryfast is its quickest preset
+		if presetIndex(preset) < presetIndex("veryfast") {
+			preset = "veryfast"
+		}
+		args = append(args, "-preset", preset)
+		if o.Bitrate == "" {
+			args = append(args, "-global_quality", strconv.Itoa(crf))
+		}
+	case HWAccelVideoToolbox:
+		// VideoToolbox has no presets and takes quality as 1-100, higher
+		// is better; scale the CRF range onto it
+		if o.Bitrate == "" {
+			args = append(args, "-q:v", strconv.Itoa(videoToolboxQuality(crf)))
+		}
+	default:
+		args = append(args, "-preset", preset)
+		if o.Bitrate == "" {
+			args = append(args, "-crf", strconv.Itoa(crf))
+		}
+	}
+
+	if o.Bitrate != "" {
+		args = append(args, "-b:v", o.Bitrate)
+	}
+	return args
+}
+
+// nvencPreset maps a libx264 preset to NVENC's p1-p7 scale
+func nvencPreset(preset string) string {
+	switch preset {
+	case "ultrafast", "superfast":
+		return "p1"
+	case "veryfast":
+		return "p2"
+	case "faster", "fast":
+		return "p3"
+	case "slow":
+		return "p5"
+	case "slower":
+		return "p6"
+	case "veryslow":
+		return "p7"
+	default:
+		return "p4"
+	}
+}
+
+// videoToolboxQuality maps a CRF (1-51, lower is better) to VideoToolbox's
+// -q:v (1-100, higher is better)
+func videoToolboxQuality(crf int) int {
+	q := 100 - crf*2
+	if q < 1 {
+		q = 1
+	}
+	return q
+}
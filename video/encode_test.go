@@ -0,0 +1,212 @@
+package video
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const sampleEncoders = `Encoders:
+ V..... = Video
+ ------
+ V....D libx264              libx264 H.264 / AVC / MPEG-4 AVC / MPEG-4 part 10 (codec h264)
+ V....D h264_nvenc           NVIDIA NVENC H.264 encoder (codec h264)
+ A....D aac                  AAC (Advanced Audio Coding)
+`
+
+func TestParseHWAccel(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    HWAccel
+		wantErr bool
+	}{
+		{"", HWAccelNone, false},
+		{"none", HWAccelNone, false},
+		{"NVENC", HWAccelNVENC, false},
+		{"qsv", HWAccelQSV, false},
+		{" videotoolbox ", HWAccelVideoToolbox, false},
+		{"cuda", HWAccelNone, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseHWAccel(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseHWAccel(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseHWAccel(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestHWAccelEncoder(t *testing.T) {
+	tests := []struct {
+		accel HWAccel
+		want  string
+	}{
+		{HWAccelNone, "libx264"},
+		{"", "libx264"},
+		{HWAccelNVENC, "h264_nvenc"},
+		{HWAccelQSV, "h264_qsv"},
+		{HWAccelVideoToolbox, "h264_videotoolbox"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.accel.Encoder(); got != tt.want {
+			t.Errorf("%q.Encoder() = %q, want %q", tt.accel, got, tt.want)
+		}
+	}
+}
+
+func TestResolveHWAccel(t *testing.T) {
+	orig := listEncoders
+	defer func() { listEncoders = orig }()
+
+	listEncoders = func() (string, error) { return sampleEncoders, nil }
+
+	tests := []struct {
+		accel   HWAccel
+		want    HWAccel
+		wantErr bool
+	}{
+		{HWAccelNone, HWAccelNone, false},
+		{HWAccelNVENC, HWAccelNVENC, false},
+		{HWAccelQSV, HWAccelNone, true},
+		{HWAccelVideoToolbox, HWAccelNone, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ResolveHWAccel(tt.accel)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ResolveHWAccel(%q) error = %v, wantErr %v", tt.accel, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("ResolveHWAccel(%q) = %q, want %q", tt.accel, got, tt.want)
+		}
+	}
+
+	listEncoders = func() (string, error) { return "", errors.New("ffmpeg missing") }
+	if got, err := ResolveHWAccel(HWAccelNVENC); err == nil || got != HWAccelNone {
+		t.Errorf("ResolveHWAccel() without ffmpeg = %q, %v; want none with an error", got, err)
+	}
+}
+
+func TestEncodeOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    EncodeOptions
+		wantErr bool
+	}{
+		{"defaults", EncodeOptions{}, false},
+		{"crf and preset", EncodeOptions{CRF: 18, Preset: "slow"}, false},
+		{"bitrate", EncodeOptions{Bitrate: "2500k"}, false},
+		{"crf too high", EncodeOptions{CRF: 52}, true},
+		{"negative crf", EncodeOptions{CRF: -1}, true},
+		{"unknown preset", EncodeOptions{Preset: "warp"}, true},
+		{"bad bitrate", EncodeOptions{Bitrate: "fast"}, true},
+		{"crf with bitrate", EncodeOptions{CRF: 20, Bitrate: "4M"}, true},
+	}
+
+	for _, tt := range tests {
+		if err := tt.opts.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestVideoEncodeArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		opts EncodeOptions
+		want []string
+	}{
+		{"libx264 defaults", EncodeOptions{}, []string{"-c:v", "libx264", "-preset", "medium", "-crf", "23"}},
+		{"libx264 tuned", EncodeOptions{CRF: 18, Preset: "veryslow"}, []string{"-c:v", "libx264", "-preset", "veryslow", "-crf", "18"}},
+		{"libx264 bitrate", EncodeOptions{Bitrate: "4M"}, []string{"-c:v", "libx264", "-preset", "medium", "-b:v", "4M"}},
+		{"nvenc", EncodeOptions{HWAccel: HWAccelNVENC, Preset: "fast"}, []string{"-c:v", "h264_nvenc", "-preset", "p3", "-rc", "vbr", "-cq", "23", "-b:v", "0"}},
+		{"nvenc bitrate", EncodeOptions{HWAccel: HWAccelNVENC, Bitrate: "2500k"}, []string{"-c:v", "h264_nvenc", "-preset", "p4", "-b:v", "2500k"}},
+		{"qsv clamps preset", EncodeOptions{HWAccel: HWAccelQSV, CRF: 20, Preset: "ultrafast"}, []string{"-c:v", "h264_qsv", "-preset", "veryfast", "-global_quality", "20"}},
+		{"videotoolbox", EncodeOptions{HWAccel: HWAccelVideoToolbox, CRF: 20}, []string{"-c:v", "h264_videotoolbox", "-q:v", "60"}},
+	}
+
+	for _, tt := range tests {
+		got := videoEncodeArgs(tt.opts)
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%s: videoEncodeArgs() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseFFmpegVersion(t *testing.T) {
+	tests := []struct {
+		output  string
+		want    FFmpegVersion
+		wantErr bool
+	}{
+		{
+			output: "ffmpeg version 6.1.1-3ubuntu5 Copyright (c) 2000-2023 the FFmpeg developers\nbuilt with gcc 13",
+			want:   FFmpegVersion{Major: 6, Minor: 1, Patch: 1, Raw: "6.1.1-3ubuntu5"},
+		},
+		{
+			output: "ffmpeg version n7.0 Copyright (c) 2000-2024 the FFmpeg developers",
+			want:   FFmpegVersion{Major: 7, Minor: 0, Raw: "n7.0"},
+		},
+		{
+			output: "ffmpeg version 4.2.7-0ubuntu0.1 Copyright (c) 2000-2022",
+			want:   FFmpegVersion{Major: 4, Minor: 2, Patch: 7, Raw: "4.2.7-0ubuntu0.1"},
+		},
+		{
+			output: "ffmpeg version N-112345-gabcdef0 Copyright (c) 2000-2024",
+			want:   FFmpegVersion{Git: true, Raw: "N-112345-gabcdef0"},
+		},
+		{output: "ffprobe version 6.0", wantErr: true},
+		{output: "ffmpeg version git-2024-01-01", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseFFmpegVersion(tt.output)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseFFmpegVersion(%q) error = %v, wantErr %v", tt.output, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseFFmpegVersion(%q) = %+v, want %+v", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestCheckEncodeSupport(t *testing.T) {
+	v42 := FFmpegVersion{Major: 4, Minor: 2, Raw: "4.2"}
+	v43 := FFmpegVersion{Major: 4, Minor: 3, Raw: "4.3"}
+	v6 := FFmpegVersion{Major: 6, Minor: 0, Raw: "6.0"}
+	git := FFmpegVersion{Git: true, Raw: "N-1"}
+
+	tests := []struct {
+		name    string
+		opts    EncodeOptions
+		version FFmpegVersion
+		wantErr string
+	}{
+		{"libx264 on old ffmpeg", EncodeOptions{}, v42, ""},
+		{"nvenc too old", EncodeOptions{HWAccel: HWAccelNVENC}, v42, "requires ffmpeg >= 4.3, found 4.2"},
+		{"nvenc new enough", EncodeOptions{HWAccel: HWAccelNVENC}, v43, ""},
+		{"videotoolbox quality too old", EncodeOptions{HWAccel: HWAccelVideoToolbox}, v43, "requires ffmpeg >= 4.4"},
+		{"videotoolbox bitrate", EncodeOptions{HWAccel: HWAccelVideoToolbox, Bitrate: "4M"}, v43, ""},
+		{"videotoolbox quality", EncodeOptions{HWAccel: HWAccelVideoToolbox}, v6, ""},
+		{"git build", EncodeOptions{HWAccel: HWAccelNVENC}, git, ""},
+	}
+
+	for _, tt := range tests {
+		err := checkEncodeSupport(tt.opts, tt.version)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: checkEncodeSupport() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: checkEncodeSupport() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
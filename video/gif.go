@@ -0,0 +1,174 @@
+package video
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GIFExt is the output extension for clips exported with ClipToGIF
+const GIFExt = ".gif"
+
+// GIF defaults keep a short clip small enough to share in a chat
+const (
+	DefaultGIFFPS   = 12
+	DefaultGIFWidth = 480
+
+	// MaxGIFFPS and MaxGIFWidth reject settings that only make huge files;
+	// browsers play GIFs at 50 fps at most anyway
+	MaxGIFFPS   = 50
+	MaxGIFWidth = 1920
+)
+
+// GIFSizeWarning is the estimated size above which callers should warn
+// that the GIF will be unwieldy
+const GIFSizeWarning = 50 << 20
+
+// gifBytesPerPixel is roughly what a paletted, dithered video frame
+// compresses to; EstimateGIFSize only needs the order of magnitude
+const gifBytesPerPixel = 0.5
+
+// GIFOptions controls how ClipToGIF renders a clip. The zero value uses
+// DefaultGIFFPS and DefaultGIFWidth and loops forever.
+type GIFOptions struct {
+	FPS   int // frames per second; 0 selects DefaultGIFFPS
+	Width int // width in pixels, height keeps the aspect ratio; 0 selects DefaultGIFWidth
+
+	// LoopCount is how many times the GIF repeats after playing once: 0
+	// loops forever and -1 plays it once
+	LoopCount int
+}
+
+// Validate checks the options before any work is done
+func (o GIFOptions) Validate() error {
+	if o.FPS < 0 || o.FPS > MaxGIFFPS {
+		return fmt.Errorf("gif fps must be 0 (the default) to %d, got %d", MaxGIFFPS, o.FPS)
+	}
+	if o.Width < 0 || o.Width > MaxGIFWidth {
+		return fmt.Errorf("gif width must be 0 (the default) to %d pixels, got %d", MaxGIFWidth, o.Width)
+	}
+	if o.LoopCount < -1 {
+		return fmt.Errorf("gif loop count must be -1 (play once), 0 (forever) or more, got %d", o.LoopCount)
+	}
+	return nil
+}
+
+// withDefaults fills in the zero-value fields
+func (o GIFOptions) withDefaults() GIFOptions {
+	if o.FPS == 0 {
+		o.FPS = DefaultGIFFPS
+	}
+	if o.Width == 0 {
+		o.Width = DefaultGIFWidth
+	}
+	return o
+}
+
+// EstimateGIFSize guesses the size in bytes of a GIF of the given length.
+// The source's height isn't known up front, so a 16:9 frame is assumed.
+func EstimateGIFSize(duration time.Duration, opts GIFOptions) int64 {
+	opts = opts.withDefaults()
+	height := opts.Width * 9 / 16
+	frames := duration.Seconds() * float64(opts.FPS)
+	return int64(frames * float64(opts.Width*height) * gifBytesPerPixel)
+}
+
+// gifFilter returns the filter chain shared by both passes, after the
+// clip's own filters from clipFilters. Sources narrower than the width
+// are never scaled up.
+func gifFilter(opts GIFOptions, filters []string) string {
+	return strings.Join(append(filters, fmt.Sprintf("fps=%d,scale=w='min(%d,iw)':h=-1:flags=lanczos", opts.FPS, opts.Width)), ",")
+}
+
+// ClipToGIF exports a clip as an animated GIF. It runs ffmpeg twice: the
+// first pass builds a 256-color palette from the clip and the second maps
+// the frames onto it, which looks far better than ffmpeg's generic palette.
+// AspectRatio, SubtitlePath, Output, FileMode and Progress work as in
+// ClipVideo, with Progress following the second pass; Encode is ignored.
+func ClipToGIF(params ClipParams, opts GIFOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	duration, err := CalculateClipDuration(params.StartTime, params.EndTime)
+	if err != nil {
+		return fmt.Errorf("invalid clip range: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "capycut-gif-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	params, subtitles, err := prepareClip(params, tmpDir)
+	if err != nil {
+		return err
+	}
+
+	palettePass, renderPass, err := buildGIFArgs(params, opts, subtitles, filepath.Join(tmpDir, "palette.png"))
+	if err != nil {
+		return err
+	}
+	if err := runFFmpeg(palettePass, nil, duration, nil); err != nil {
+		return fmt.Errorf("palette pass: %w", err)
+	}
+
+	if params.Output != nil {
+		return runFFmpeg(renderPass, params.Output, duration, params.Progress)
+	}
+	if err := runFFmpeg(renderPass, nil, duration, params.Progress); err != nil {
+		return err
+	}
+
+	if params.FileMode != 0 {
+		if err := os.Chmod(params.OutputPath, params.FileMode); err != nil {
+			return fmt.Errorf("failed to set clip permissions: %w", err)
+		}
+	}
+	return nil
+}
+
+// BuildGIFArgs returns the arguments of ClipToGIF's two ffmpeg passes,
+// with the caveats of BuildFFmpegArgs. The palette is written to
+// palette.png in the working directory, where ClipToGIF uses a temp dir.
+func BuildGIFArgs(params ClipParams, opts GIFOptions) (palettePass, renderPass []string, err error) {
+	return buildGIFArgs(params, opts, params.SubtitlePath, "palette.png")
+}
+
+// buildGIFArgs builds ClipToGIF's passes, burning in the subtitle file at
+// subtitles and passing the palette through the file at palette. The
+// length is an output option after the last -i; before an -i it would
+// only cut that input, the palette in the render pass.
+func buildGIFArgs(params ClipParams, opts GIFOptions, subtitles, palette string) (palettePass, renderPass []string, err error) {
+	opts = opts.withDefaults()
+	duration, _ := CalculateClipDuration(params.StartTime, params.EndTime)
+	filters, err := clipFilters(params, subtitles)
+	if err != nil {
+		return nil, nil, err
+	}
+	filter := gifFilter(opts, filters)
+
+	input := []string{
+		"-y",
+		"-ss", params.StartTime,
+		"-i", params.InputPath,
+	}
+	length := []string{"-t", strconv.FormatFloat(duration.Seconds(), 'f', 3, 64)}
+
+	palettePass = append(append(append([]string{}, input...), length...), "-vf", filter+",palettegen", palette)
+
+	renderPass = append(append(append([]string{}, input...), "-i", palette), length...)
+	renderPass = append(renderPass,
+		"-lavfi", filter+"[x];[x][1:v]paletteuse",
+		"-loop", strconv.Itoa(opts.LoopCount),
+		"-f", "gif",
+	)
+	if params.Output != nil {
+		return palettePass, append(renderPass, "pipe:1"), nil
+	}
+	return palettePass, append(renderPass, params.OutputPath), nil
+}
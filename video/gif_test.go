@@ -0,0 +1,139 @@
+package video
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGIFOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    GIFOptions
+		wantErr bool
+	}{
+		{"defaults", GIFOptions{}, false},
+		{"custom", GIFOptions{FPS: 24, Width: 640, LoopCount: 3}, false},
+		{"play once", GIFOptions{LoopCount: -1}, false},
+		{"negative fps", GIFOptions{FPS: -1}, true},
+		{"fps too high", GIFOptions{FPS: MaxGIFFPS + 1}, true},
+		{"width too large", GIFOptions{Width: 3840}, true},
+		{"bad loop count", GIFOptions{LoopCount: -2}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEstimateGIFSize(t *testing.T) {
+	short := EstimateGIFSize(5*time.Second, GIFOptions{})
+	if short <= 0 || short > GIFSizeWarning {
+		t.Errorf("EstimateGIFSize(5s, defaults) = %d, want a size under the warning", short)
+	}
+	if got := EstimateGIFSize(10*time.Second, GIFOptions{}); got != 2*short {
+		t.Errorf("EstimateGIFSize(10s) = %d, want twice the 5s estimate %d", got, short)
+	}
+	if got := EstimateGIFSize(5*time.Second, GIFOptions{FPS: DefaultGIFFPS, Width: DefaultGIFWidth}); got != short {
+		t.Errorf("explicit defaults = %d, want %d", got, short)
+	}
+
+	// A few minutes at full HD is what the warning is for
+	if got := EstimateGIFSize(3*time.Minute, GIFOptions{FPS: 30, Width: 1920}); got <= GIFSizeWarning {
+		t.Errorf("EstimateGIFSize(3m, 1920px at 30fps) = %d, want over the warning", got)
+	}
+}
+
+func TestGIFFilter(t *testing.T) {
+	opts := GIFOptions{FPS: 10, Width: 320}
+	if got, want := gifFilter(opts, nil), "fps=10,scale=w='min(320,iw)':h=-1:flags=lanczos"; got != want {
+		t.Errorf("gifFilter() = %q, want %q", got, want)
+	}
+	if got := gifFilter(opts, []string{"crop=90:160:35:0", "subtitles=subs.srt"}); !strings.HasPrefix(got, "crop=90:160:35:0,subtitles=subs.srt,fps=10,") {
+		t.Errorf("gifFilter() with clip filters = %q, want them applied first", got)
+	}
+}
+
+func TestBuildGIFArgs(t *testing.T) {
+	params := ClipParams{InputPath: "in.mp4", StartTime: "5", EndTime: "8", OutputPath: "out.gif"}
+	palettePass, renderPass, err := BuildGIFArgs(params, GIFOptions{LoopCount: -1})
+	if err != nil {
+		t.Fatalf("BuildGIFArgs() error: %v", err)
+	}
+
+	filter := "fps=12,scale=w='min(480,iw)':h=-1:flags=lanczos"
+	if got, want := strings.Join(palettePass, " "), "-y -ss 5 -i in.mp4 -t 3.000 -vf "+filter+",palettegen palette.png"; got != want {
+		t.Errorf("palette pass = %q, want %q", got, want)
+	}
+	if got, want := strings.Join(renderPass, " "), "-y -ss 5 -i in.mp4 -i palette.png -t 3.000 -lavfi "+filter+"[x];[x][1:v]paletteuse -loop -1 -f gif out.gif"; got != want {
+		t.Errorf("render pass = %q, want %q", got, want)
+	}
+
+	params.AspectRatio = "1:1"
+	if _, _, err := BuildGIFArgs(params, GIFOptions{}); err == nil {
+		t.Error("BuildGIFArgs() of a crop without the source size should fail")
+	}
+}
+
+func TestClipToGIF_Synthetic(t *testing.T) {
+	path := makeTestVideo(t, 3)
+
+	outputPath := GenerateOutputPath(path, "00:00:01", "00:00:02", GIFExt)
+	if filepath.Ext(outputPath) != GIFExt {
+		t.Fatalf("GenerateOutputPath() = %q, want a %s extension", outputPath, GIFExt)
+	}
+
+	err := ClipToGIF(ClipParams{
+		InputPath:  path,
+		StartTime:  "00:00:01",
+		EndTime:    "00:00:02",
+		OutputPath: outputPath,
+		FileMode:   0o600,
+	}, GIFOptions{FPS: 5, Width: 80})
+	if err != nil {
+		t.Fatalf("ClipToGIF() error: %v", err)
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("reading GIF: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte("GIF89a")) {
+		t.Errorf("output starts with %q, want a GIF89a header", data[:min(len(data), 6)])
+	}
+	if info, err := os.Stat(outputPath); err == nil && info.Mode().Perm() != 0o600 {
+		t.Errorf("GIF mode = %v, want 0600", info.Mode().Perm())
+	}
+	// The GIF covers the clip, not the rest of the video after its start
+	info, err := GetVideoInfo(outputPath)
+	if err != nil {
+		t.Fatalf("GetVideoInfo() on the GIF: %v", err)
+	}
+	if info.Duration < 800*time.Millisecond || info.Duration > 1300*time.Millisecond {
+		t.Errorf("GIF duration = %v, want about 1s", info.Duration)
+	}
+
+	var buf bytes.Buffer
+	err = ClipToGIF(ClipParams{InputPath: path, StartTime: "0", EndTime: "1", Output: &buf}, GIFOptions{Width: 80})
+	if err != nil {
+		t.Fatalf("ClipToGIF() to writer error: %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("GIF89a")) {
+		t.Error("GIF written to Output lacks a GIF89a header")
+	}
+}
+
+func TestClipToGIF_InvalidOptions(t *testing.T) {
+	err := ClipToGIF(ClipParams{InputPath: "in.mp4", StartTime: "0", EndTime: "1", OutputPath: "out.gif"}, GIFOptions{Width: 10000})
+	if err == nil || !strings.Contains(err.Error(), "width") {
+		t.Errorf("ClipToGIF() error = %v, want a width error before running ffmpeg", err)
+	}
+}
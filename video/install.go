@@ -0,0 +1,95 @@
+package video
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// InstallCommand is a package manager invocation that installs ffmpeg
+type InstallCommand struct {
+	// Manager names the package manager, e.g. "brew" or "apt"
+	Manager string
+
+	// Args is the command to run, starting with the executable
+	Args []string
+}
+
+// String returns the command as it would be typed in a shell
+func (c InstallCommand) String() string {
+	return strings.Join(c.Args, " ")
+}
+
+// packageManager is a way to install ffmpeg on one platform
+type packageManager struct {
+	name string
+	bin  string
+	args []string
+
+	// root is set for managers that need root, which get a sudo prefix
+	// when capycut isn't already running as root
+	root bool
+}
+
+// packageManagers lists install commands per GOOS in order of preference;
+// the first manager found on PATH wins
+var packageManagers = map[string][]packageManager{
+	"darwin": {
+		{name: "brew", bin: "brew", args: []string{"install", "ffmpeg"}},
+		{name: "port", bin: "port", args: []string{"install", "ffmpeg"}, root: true},
+	},
+	"linux": {
+		{name: "apt", bin: "apt-get", args: []string{"install", "-y", "ffmpeg"}, root: true},
+		{name: "dnf", bin: "dnf", args: []string{"install", "-y", "ffmpeg"}, root: true},
+		{name: "pacman", bin: "pacman", args: []string{"-S", "--noconfirm", "ffmpeg"}, root: true},
+		{name: "zypper", bin: "zypper", args: []string{"install", "-y", "ffmpeg"}, root: true},
+		{name: "apk", bin: "apk", args: []string{"add", "ffmpeg"}, root: true},
+		{name: "brew", bin: "brew", args: []string{"install", "ffmpeg"}},
+	},
+	"freebsd": {
+		{name: "pkg", bin: "pkg", args: []string{"install", "-y", "ffmpeg"}, root: true},
+	},
+	"windows": {
+		{name: "winget", bin: "winget", args: []string{"install", "--id", "Gyan.FFmpeg", "-e"}},
+		{name: "choco", bin: "choco", args: []string{"install", "ffmpeg", "-y"}},
+		{name: "scoop", bin: "scoop", args: []string{"install", "ffmpeg"}},
+	},
+}
+
+// DetectFFmpegInstallCommand returns the command that installs ffmpeg with
+// a package manager found on this machine. ok is false when none of the
+// managers capycut knows about is installed.
+func DetectFFmpegInstallCommand() (cmd InstallCommand, ok bool) {
+	return detectInstallCommand(runtime.GOOS, exec.LookPath, os.Geteuid() == 0)
+}
+
+// detectInstallCommand picks the first manager for goos that lookPath finds
+func detectInstallCommand(goos string, lookPath func(string) (string, error), isRoot bool) (InstallCommand, bool) {
+	for _, pm := range packageManagers[goos] {
+		if _, err := lookPath(pm.bin); err != nil {
+			continue
+		}
+		args := append([]string{pm.bin}, pm.args...)
+		if pm.root && !isRoot {
+			if _, err := lookPath("sudo"); err == nil {
+				args = append([]string{"sudo"}, args...)
+			}
+		}
+		return InstallCommand{Manager: pm.name, Args: args}, true
+	}
+	return InstallCommand{}, false
+}
+
+// InstallFFmpeg runs the install command attached to the terminal, so
+// package manager prompts and sudo's password prompt reach the user. The
+// cached ffmpeg probe is reset afterwards so CheckFFmpeg sees the result.
+func InstallFFmpeg(c InstallCommand) error {
+	cmd := exec.Command(c.Args[0], c.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	resetFFmpegProbe()
+	return err
+}
@@ -0,0 +1,112 @@
+package video
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// ProgressCallback receives how much of a clip ffmpeg has written, from 0
+// to 1. It is called on ffmpeg's output goroutine, so it must not block;
+// ffmpeg stalls until it returns.
+type ProgressCallback func(fraction float64)
+
+// progressLineRe matches the key=value lines of ffmpeg's -progress output,
+// telling them apart from log lines when both share stderr
+var progressLineRe = regexp.MustCompile(`^([a-z0-9_]+)=(\S*)$`)
+
+// runFFmpeg runs ffmpeg, writing its stdout to out when set, and returns
+// its log with any error. With onProgress set, ffmpeg reports its position
+// on stdout, or on stderr when stdout carries the clip, and onProgress is
+// called as it advances through duration.
+func runFFmpeg(args []string, out io.Writer, duration time.Duration, onProgress ProgressCallback) error {
+	var log bytes.Buffer
+	if onProgress == nil {
+		cmd := exec.Command("ffmpeg", args...)
+		cmd.Stdout = out
+		if out == nil {
+			cmd.Stdout = &log
+		}
+		cmd.Stderr = &log
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("ffmpeg error: %w\nOutput: %s", err, log.String())
+		}
+		return nil
+	}
+
+	target := "pipe:1"
+	if out != nil {
+		target = "pipe:2"
+	}
+	cmd := exec.Command("ffmpeg", append([]string{"-progress", target, "-nostats"}, args...)...)
+
+	var progress io.ReadCloser
+	var err error
+	if out == nil {
+		cmd.Stderr = &log
+		progress, err = cmd.StdoutPipe()
+	} else {
+		cmd.Stdout = out
+		progress, err = cmd.StderrPipe()
+	}
+	if err != nil {
+		return fmt.Errorf("ffmpeg error: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("ffmpeg error: %w", err)
+	}
+
+	// The pipe closes when ffmpeg exits, early or not, so this returns
+	readProgress(progress, duration, onProgress, &log)
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("ffmpeg error: %w\nOutput: %s", err, log.String())
+	}
+	return nil
+}
+
+// readProgress parses ffmpeg -progress output from r until it closes,
+// reporting out_time against duration. Other lines go to log. Values
+// ffmpeg hasn't worked out yet read N/A and are skipped.
+func readProgress(r io.Reader, duration time.Duration, onProgress ProgressCallback, log io.Writer) {
+	var haveUS bool
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		m := progressLineRe.FindStringSubmatch(line)
+		if m == nil {
+			fmt.Fprintln(log, line)
+			continue
+		}
+
+		switch m[1] {
+		// out_time_ms is in microseconds too, despite its name; older
+		// ffmpeg versions only write that one
+		case "out_time_us", "out_time_ms":
+			if m[1] == "out_time_us" {
+				haveUS = true
+			} else if haveUS {
+				continue
+			}
+			us, err := strconv.ParseInt(m[2], 10, 64)
+			if err != nil || duration <= 0 {
+				continue
+			}
+			fraction := float64(us) * float64(time.Microsecond) / float64(duration)
+			onProgress(min(max(fraction, 0), 1))
+		case "progress":
+			if m[2] == "end" {
+				onProgress(1)
+			}
+		}
+	}
+
+	// Keep draining after an overlong line so ffmpeg never blocks on a
+	// full pipe
+	io.Copy(log, r)
+}
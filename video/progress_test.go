@@ -0,0 +1,63 @@
+package video
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadProgress(t *testing.T) {
+	output := strings.Join([]string{
+		"frame=0",
+		"out_time_us=N/A",
+		"out_time_ms=N/A",
+		"out_time=N/A",
+		"progress=continue",
+		"[mp4 @ 0x1] Non-monotonic DTS; previous: 10, current: 9",
+		"out_time_us=2500000",
+		"out_time_ms=2500000",
+		"progress=continue",
+		"out_time_us=12000000",
+		"progress=end",
+	}, "\n")
+
+	var got []float64
+	var log bytes.Buffer
+	readProgress(strings.NewReader(output), 10*time.Second, func(f float64) { got = append(got, f) }, &log)
+
+	want := []float64{0.25, 1, 1}
+	if len(got) != len(want) {
+		t.Fatalf("progress = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("progress[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+	if !strings.Contains(log.String(), "Non-monotonic DTS") || strings.Contains(log.String(), "out_time") {
+		t.Errorf("log = %q, want only the ffmpeg log lines", log.String())
+	}
+}
+
+func TestReadProgress_OldFFmpeg(t *testing.T) {
+	var got []float64
+	readProgress(strings.NewReader("out_time_ms=1000000\nout_time_ms=3000000\n"), 4*time.Second, func(f float64) { got = append(got, f) }, &bytes.Buffer{})
+	if len(got) != 2 || got[0] != 0.25 || got[1] != 0.75 {
+		t.Errorf("progress = %v, want [0.25 0.75] from out_time_ms alone", got)
+	}
+}
+
+func TestReadProgress_DrainsOverlongLines(t *testing.T) {
+	// A line past the scanner's buffer stops parsing but must not leave
+	// ffmpeg blocked on the rest of its output
+	r := strings.NewReader("out_time_us=1000000\n" + strings.Repeat("x", 100_000) + "\nout_time_us=2000000\n")
+	var got []float64
+	readProgress(r, 4*time.Second, func(f float64) { got = append(got, f) }, &bytes.Buffer{})
+	if r.Len() != 0 {
+		t.Errorf("%d bytes left unread", r.Len())
+	}
+	if len(got) == 0 || got[0] != 0.25 {
+		t.Errorf("progress = %v, want the updates before the long line", got)
+	}
+}
@@ -0,0 +1,148 @@
+package video
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// filterTimeLayouts are the forms --since and --until accept, tried in order
+var filterTimeLayouts = []string{
+	"2006-01-02",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+// ParseFilterTime parses a --since/--until value: a date, a date and time,
+// or RFC 3339. Values without a zone are local time.
+func ParseFilterTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range filterTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use 2006-01-02, 2006-01-02T15:04 or RFC 3339)", s)
+}
+
+// TimeFilter selects batch inputs by when they were recorded. The time is
+// the file's modification time, or a timestamp found in its name when
+// NameFormat is set.
+type TimeFilter struct {
+	Since time.Time // Keep files from this time on; zero means no bound
+	Until time.Time // Keep files before this time; zero means no bound
+
+	// NameFormat is a Go time layout, e.g. "20060102_150405", matched
+	// anywhere in the base name. Files without a match are left out.
+	NameFormat string
+}
+
+// IsZero reports whether the filter keeps every file
+func (f TimeFilter) IsZero() bool {
+	return f.Since.IsZero() && f.Until.IsZero()
+}
+
+// Match reports whether the file at path falls inside the filter's range
+func (f TimeFilter) Match(path string) (bool, error) {
+	if f.IsZero() {
+		return true, nil
+	}
+	t, err := f.fileTime(path)
+	if err != nil {
+		return false, err
+	}
+	if !f.Since.IsZero() && t.Before(f.Since) {
+		return false, nil
+	}
+	if !f.Until.IsZero() && !t.Before(f.Until) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// fileTime returns the time the filter compares for path
+func (f TimeFilter) fileTime(path string) (time.Time, error) {
+	if f.NameFormat != "" {
+		if t, ok := TimeFromName(filepath.Base(path), f.NameFormat); ok {
+			return t, nil
+		}
+		return time.Time{}, fmt.Errorf("no %s timestamp in %s", f.NameFormat, filepath.Base(path))
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// TimeFromName finds the first timestamp in name that parses with layout,
+// e.g. "20240101_093000" in "cam1_20240101_093000.mp4". The name is
+// scanned with a window the length of the layout, so layouts whose values
+// vary in length (month names, unpadded numbers) may not be found.
+func TimeFromName(name, layout string) (time.Time, bool) {
+	n := len(layout)
+	for i := 0; i+n <= len(name); i++ {
+		if t, err := time.ParseInLocation(layout, name[i:i+n], time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// IsBatchSource reports whether path names several videos: an existing
+// directory, or a glob pattern that isn't itself an existing file
+func IsBatchSource(path string) bool {
+	if path == "" || path == StdinPath {
+		return false
+	}
+	if info, err := os.Stat(path); err == nil {
+		return info.IsDir()
+	}
+	return strings.ContainsAny(path, "*?[")
+}
+
+// FindVideos lists the videos in a directory (not recursively) or matching
+// a glob, sorted by path, keeping those filter matches. filtered counts the
+// videos the filter left out.
+func FindVideos(source string, filter TimeFilter) (videos []string, filtered int, err error) {
+	var candidates []string
+	if info, statErr := os.Stat(source); statErr == nil && info.IsDir() {
+		entries, err := os.ReadDir(source)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read directory: %w", err)
+		}
+		for _, entry := range entries {
+			candidates = append(candidates, filepath.Join(source, entry.Name()))
+		}
+	} else {
+		candidates, err = filepath.Glob(source)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid pattern %q: %w", source, err)
+		}
+	}
+	sort.Strings(candidates)
+
+	for _, path := range candidates {
+		if !IsVideoFile(path) {
+			continue
+		}
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			continue
+		}
+		ok, err := filter.Match(path)
+		if err != nil || !ok {
+			filtered++
+			continue
+		}
+		videos = append(videos, path)
+	}
+	return videos, filtered, nil
+}
@@ -0,0 +1,93 @@
+package video
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// StdinPath is the file argument that reads the video from standard input
+const StdinPath = "-"
+
+// DefaultStdinMaxSize caps how much of stdin is buffered to disk, so a
+// runaway pipe can't fill the temp directory
+const DefaultStdinMaxSize = 4 << 30
+
+// StdinFilename is the name stdin input goes by in output names and
+// summaries, e.g. "stdin_clip_00-00-00_to_00-00-10.mp4"
+const StdinFilename = "stdin"
+
+// BufferStdin copies r to a temp file, since ffprobe has to scan the input
+// and ffmpeg's -ss needs to seek in it. The file is named with an extension
+// matching its container so clips keep the same format. Input larger than
+// maxSize is rejected. Call cleanup once the file is no longer needed.
+func BufferStdin(r io.Reader, maxSize int64) (path string, cleanup func(), err error) {
+	dir, err := os.MkdirTemp("", "capycut-stdin-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+
+	// Read the header first to pick the extension
+	header := make([]byte, 512)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		cleanup()
+		if err == io.EOF {
+			return "", nil, fmt.Errorf("no video data on stdin")
+		}
+		return "", nil, fmt.Errorf("failed to read stdin: %w", err)
+	}
+	header = header[:n]
+
+	path = filepath.Join(dir, StdinFilename+sniffContainer(header))
+	f, err := os.Create(path)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	// Copy one byte past the cap to tell "exactly maxSize" from "too big"
+	written, err := io.Copy(f, io.LimitReader(io.MultiReader(bytes.NewReader(header), r), maxSize+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to buffer stdin: %w", err)
+	}
+	if written > maxSize {
+		cleanup()
+		return "", nil, fmt.Errorf("stdin input is larger than the %d MB limit; raise it with CAPYCUT_STDIN_MAX_SIZE or pass a file", maxSize>>20)
+	}
+
+	return path, cleanup, nil
+}
+
+// sniffContainer guesses a video container from its first bytes and
+// returns the matching extension. Unknown input gets .mkv, which can hold
+// nearly any codec that -c copy passes through.
+func sniffContainer(header []byte) string {
+	switch {
+	case len(header) >= 12 && string(header[4:8]) == "ftyp":
+		if string(header[8:10]) == "qt" {
+			return ".mov"
+		}
+		return ".mp4"
+	case bytes.HasPrefix(header, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		if bytes.Contains(header, []byte("webm")) {
+			return ".webm"
+		}
+		return ".mkv"
+	case len(header) >= 12 && string(header[0:4]) == "RIFF" && string(header[8:12]) == "AVI ":
+		return ".avi"
+	case bytes.HasPrefix(header, []byte("FLV")):
+		return ".flv"
+	case len(header) > 188 && header[0] == 0x47 && header[188] == 0x47:
+		return ".ts"
+	default:
+		return ".mkv"
+	}
+}
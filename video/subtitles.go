@@ -0,0 +1,244 @@
+package video
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SubtitleFormat identifies a subtitle file format
+type SubtitleFormat string
+
+const (
+	SubtitleSRT SubtitleFormat = "srt"
+	SubtitleVTT SubtitleFormat = "vtt"
+	SubtitleASS SubtitleFormat = "ass"
+)
+
+// DetectSubtitleFormat picks the format from the file extension
+func DetectSubtitleFormat(path string) (SubtitleFormat, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".srt":
+		return SubtitleSRT, nil
+	case ".vtt":
+		return SubtitleVTT, nil
+	case ".ass", ".ssa":
+		return SubtitleASS, nil
+	default:
+		return "", fmt.Errorf("unsupported subtitle format %q (use .srt, .vtt, .ass or .ssa)", filepath.Ext(path))
+	}
+}
+
+// cueTimingRe matches an SRT or WebVTT timing line; WebVTT allows the hour
+// to be omitted and may have cue settings after the end time
+var cueTimingRe = regexp.MustCompile(`^\s*((?:\d+:)?\d{1,2}:\d{2}[.,]\d{1,3})\s*-->\s*((?:\d+:)?\d{1,2}:\d{2}[.,]\d{1,3})(.*)$`)
+
+// ShiftSubtitles moves every cue earlier by offset, the clip start, so the
+// subtitles line up with a clip that begins at zero. Cues that end before
+// the clip are dropped and cues that straddle the start are trimmed to it.
+// WebVTT input is converted to SRT, which every ffmpeg build can burn in,
+// so the returned format may differ from the input format.
+func ShiftSubtitles(content string, format SubtitleFormat, offset time.Duration) (string, SubtitleFormat, error) {
+	content = strings.ReplaceAll(strings.TrimPrefix(content, "\ufeff"), "\r\n", "\n")
+	switch format {
+	case SubtitleSRT, SubtitleVTT:
+		out, err := shiftCueBlocks(content, format, offset)
+		return out, SubtitleSRT, err
+	case SubtitleASS:
+		out, err := shiftASS(content, offset)
+		return out, SubtitleASS, err
+	default:
+		return "", "", fmt.Errorf("unsupported subtitle format %q", format)
+	}
+}
+
+// shiftCueBlocks shifts SRT/WebVTT cues and writes them back out as SRT
+func shiftCueBlocks(content string, format SubtitleFormat, offset time.Duration) (string, error) {
+	if format == SubtitleVTT && !strings.HasPrefix(content, "WEBVTT") {
+		return "", fmt.Errorf("not a WebVTT file: missing WEBVTT header")
+	}
+
+	var out strings.Builder
+	index := 0
+
+	for _, block := range strings.Split(content, "\n\n") {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+
+		// Find the timing line; blocks without one are WebVTT headers,
+		// NOTE/STYLE/REGION blocks, or blank
+		timing := -1
+		for i, line := range lines {
+			if cueTimingRe.MatchString(line) {
+				timing = i
+				break
+			}
+		}
+		if timing < 0 {
+			continue
+		}
+
+		m := cueTimingRe.FindStringSubmatch(lines[timing])
+		start, err := parseCueTimestamp(m[1])
+		if err != nil {
+			return "", err
+		}
+		end, err := parseCueTimestamp(m[2])
+		if err != nil {
+			return "", err
+		}
+
+		start, end, keep := shiftCue(start, end, offset)
+		if !keep {
+			continue
+		}
+
+		index++
+		fmt.Fprintf(&out, "%d\n%s --> %s\n", index, formatSRTTime(start), formatSRTTime(end))
+		for _, text := range lines[timing+1:] {
+			out.WriteString(text + "\n")
+		}
+		out.WriteString("\n")
+	}
+
+	return out.String(), nil
+}
+
+// shiftASS shifts the start and end fields of every Dialogue line
+func shiftASS(content string, offset time.Duration) (string, error) {
+	var out strings.Builder
+
+	for _, line := range strings.Split(content, "\n") {
+		if !strings.HasPrefix(line, "Dialogue:") {
+			out.WriteString(line + "\n")
+			continue
+		}
+
+		// Dialogue: Layer,Start,End,Style,... — only the first three
+		// commas are structural; the text field may contain more
+		fields := strings.SplitN(strings.TrimPrefix(line, "Dialogue:"), ",", 4)
+		if len(fields) < 4 {
+			return "", fmt.Errorf("malformed ASS dialogue line: %q", line)
+		}
+		start, err := parseASSTime(fields[1])
+		if err != nil {
+			return "", err
+		}
+		end, err := parseASSTime(fields[2])
+		if err != nil {
+			return "", err
+		}
+
+		start, end, keep := shiftCue(start, end, offset)
+		if !keep {
+			continue
+		}
+		fmt.Fprintf(&out, "Dialogue:%s,%s,%s,%s\n", fields[0], formatASSTime(start), formatASSTime(end), fields[3])
+	}
+
+	return strings.TrimSuffix(out.String(), "\n"), nil
+}
+
+// shiftCue applies the offset to one cue and reports whether it is still visible
+func shiftCue(start, end, offset time.Duration) (time.Duration, time.Duration, bool) {
+	start -= offset
+	end -= offset
+	if end <= 0 {
+		return 0, 0, false
+	}
+	if start < 0 {
+		start = 0
+	}
+	return start, end, true
+}
+
+// parseCueTimestamp parses SRT ("00:01:02,500") and WebVTT ("01:02.500") times
+func parseCueTimestamp(ts string) (time.Duration, error) {
+	d, err := ParseTimestamp(strings.Replace(ts, ",", ".", 1))
+	if err != nil {
+		return 0, fmt.Errorf("invalid cue timestamp %q: %w", ts, err)
+	}
+	return d, nil
+}
+
+// parseASSTime parses ASS times, which are H:MM:SS.cc (centiseconds)
+func parseASSTime(ts string) (time.Duration, error) {
+	ts = strings.TrimSpace(ts)
+	d, err := ParseTimestamp(ts)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ASS timestamp %q: %w", ts, err)
+	}
+	return d, nil
+}
+
+// formatSRTTime formats a duration as HH:MM:SS,mmm
+func formatSRTTime(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3600000, (ms/60000)%60, (ms/1000)%60, ms%1000)
+}
+
+// formatASSTime formats a duration as H:MM:SS.cc
+func formatASSTime(d time.Duration) string {
+	cs := d.Milliseconds() / 10
+	return fmt.Sprintf("%d:%02d:%02d.%02d", cs/360000, (cs/6000)%60, (cs/100)%60, cs%100)
+}
+
+// PrepareSubtitles reads a subtitle file, shifts it by the clip start and
+// writes the result into dir. It returns the path of the shifted file and
+// the ffmpeg -vf filter that burns it in.
+func PrepareSubtitles(path string, offset time.Duration, dir string) (string, string, error) {
+	format, err := DetectSubtitleFormat(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read subtitles: %w", err)
+	}
+
+	shifted, outFormat, err := ShiftSubtitles(string(data), format, offset)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to shift subtitles: %w", err)
+	}
+
+	outPath := filepath.Join(dir, "subtitles."+string(outFormat))
+	if err := os.WriteFile(outPath, []byte(shifted), 0644); err != nil {
+		return "", "", fmt.Errorf("failed to write shifted subtitles: %w", err)
+	}
+
+	return outPath, SubtitleFilter(outPath, outFormat), nil
+}
+
+// SubtitleFilter returns the ffmpeg video filter that burns in a subtitle
+// file: "ass" keeps ASS/SSA styling, "subtitles" handles SRT
+func SubtitleFilter(path string, format SubtitleFormat) string {
+	name := "subtitles"
+	if format == SubtitleASS {
+		name = "ass"
+	}
+	return name + "=filename=" + escapeFilterValue(path)
+}
+
+// escapeFilterValue escapes a filter option value for use inside -vf. ffmpeg
+// unescapes twice: once for the option value and once for the filtergraph.
+func escapeFilterValue(v string) string {
+	var value strings.Builder
+	for _, r := range v {
+		if r == '\\' || r == '\'' || r == ':' {
+			value.WriteRune('\\')
+		}
+		value.WriteRune(r)
+	}
+
+	var graph strings.Builder
+	for _, r := range value.String() {
+		if strings.ContainsRune(`\'[],;`, r) {
+			graph.WriteRune('\\')
+		}
+		graph.WriteRune(r)
+	}
+	return graph.String()
+}
@@ -0,0 +1,169 @@
+package video
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetectSubtitleFormat(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    SubtitleFormat
+		wantErr bool
+	}{
+		{"captions.srt", SubtitleSRT, false},
+		{"captions.VTT", SubtitleVTT, false},
+		{"captions.ass", SubtitleASS, false},
+		{"captions.ssa", SubtitleASS, false},
+		{"captions.txt", "", true},
+		{"captions", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := DetectSubtitleFormat(tt.path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("DetectSubtitleFormat(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("DetectSubtitleFormat(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestShiftSubtitles(t *testing.T) {
+	tests := []struct {
+		name       string
+		format     SubtitleFormat
+		input      string
+		offset     time.Duration
+		want       string
+		wantFormat SubtitleFormat
+	}{
+		{
+			name:   "srt shift drops earlier cues and trims straddling ones",
+			format: SubtitleSRT,
+			input: "1\r\n00:00:01,000 --> 00:00:05,000\r\nBefore the clip\r\n\r\n" +
+				"2\r\n00:00:09,500 --> 00:00:11,000\r\nStraddles the start\r\n\r\n" +
+				"3\r\n00:01:10,250 --> 00:01:12,000\r\nInside\r\nTwo lines\r\n",
+			offset: 10 * time.Second,
+			want: "1\n00:00:00,000 --> 00:00:01,000\nStraddles the start\n\n" +
+				"2\n00:01:00,250 --> 00:01:02,000\nInside\nTwo lines\n\n",
+			wantFormat: SubtitleSRT,
+		},
+		{
+			name:   "vtt converts to srt and skips header and notes",
+			format: SubtitleVTT,
+			input: "WEBVTT\n\nNOTE written by hand\n\n" +
+				"intro\n00:15.000 --> 00:17.500 align:start\nHello\n\n" +
+				"01:00:02.000 --> 01:00:03.000\nLater\n",
+			offset: 5 * time.Second,
+			want: "1\n00:00:10,000 --> 00:00:12,500\nHello\n\n" +
+				"2\n00:59:57,000 --> 00:59:58,000\nLater\n\n",
+			wantFormat: SubtitleSRT,
+		},
+		{
+			name:   "ass shifts dialogue and keeps styling",
+			format: SubtitleASS,
+			input: "[Script Info]\nTitle: Test\n\n[Events]\n" +
+				"Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n" +
+				"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,Gone\n" +
+				"Dialogue: 0,0:01:30.50,0:01:32.25,Default,,0,0,0,,{\\i1}Hi, there{\\i0}\n",
+			offset: time.Minute,
+			want: "[Script Info]\nTitle: Test\n\n[Events]\n" +
+				"Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n" +
+				"Dialogue: 0,0:00:30.50,0:00:32.25,Default,,0,0,0,,{\\i1}Hi, there{\\i0}\n",
+			wantFormat: SubtitleASS,
+		},
+		{
+			name:       "zero offset keeps srt unchanged",
+			format:     SubtitleSRT,
+			input:      "1\n00:00:01,000 --> 00:00:02,000\nHi\n",
+			offset:     0,
+			want:       "1\n00:00:01,000 --> 00:00:02,000\nHi\n\n",
+			wantFormat: SubtitleSRT,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, format, err := ShiftSubtitles(tt.input, tt.format, tt.offset)
+			if err != nil {
+				t.Fatalf("ShiftSubtitles() error: %v", err)
+			}
+			if format != tt.wantFormat {
+				t.Errorf("format = %q, want %q", format, tt.wantFormat)
+			}
+			if got != tt.want {
+				t.Errorf("ShiftSubtitles() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShiftSubtitles_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		format SubtitleFormat
+		input  string
+	}{
+		{"vtt without header", SubtitleVTT, "00:01.000 --> 00:02.000\nHi\n"},
+		{"ass short dialogue", SubtitleASS, "Dialogue: 0,0:00:01.00\n"},
+		{"ass bad time", SubtitleASS, "Dialogue: 0,soon,0:00:02.00,Default,,0,0,0,,Hi\n"},
+		{"unknown format", SubtitleFormat("sub"), "anything"},
+	}
+
+	for _, tt := range tests {
+		if _, _, err := ShiftSubtitles(tt.input, tt.format, 0); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestPrepareSubtitles(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "in.vtt")
+	if err := os.WriteFile(src, []byte("WEBVTT\n\n00:00:03.000 --> 00:00:04.000\nHi\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, filter, err := PrepareSubtitles(src, 2*time.Second, dir)
+	if err != nil {
+		t.Fatalf("PrepareSubtitles() error: %v", err)
+	}
+	if filepath.Ext(out) != ".srt" {
+		t.Errorf("shifted file = %s, want an .srt", out)
+	}
+	if !strings.HasPrefix(filter, "subtitles=filename=") {
+		t.Errorf("filter = %q, want the subtitles filter", filter)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "00:00:01,000 --> 00:00:02,000") {
+		t.Errorf("shifted subtitles = %q", data)
+	}
+}
+
+func TestSubtitleFilter(t *testing.T) {
+	tests := []struct {
+		path   string
+		format SubtitleFormat
+		want   string
+	}{
+		{"/tmp/subs.srt", SubtitleSRT, "subtitles=filename=/tmp/subs.srt"},
+		{"/tmp/subs.ass", SubtitleASS, "ass=filename=/tmp/subs.ass"},
+		{`C:\Temp\subs.srt`, SubtitleSRT, `subtitles=filename=C\\:\\\\Temp\\\\subs.srt`},
+		{"/tmp/it's [x].srt", SubtitleSRT, `subtitles=filename=/tmp/it\\\'s \[x\].srt`},
+	}
+
+	for _, tt := range tests {
+		if got := SubtitleFilter(tt.path, tt.format); got != tt.want {
+			t.Errorf("SubtitleFilter(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package video
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ThumbnailMidpoint asks GenerateThumbnail for the frame halfway through
+// the video, which is more telling than the often black first frame
+const ThumbnailMidpoint time.Duration = -1
+
+// Thumbnail widths: DefaultThumbWidth is what capycut saves next to a clip,
+// large enough for a poster frame; MaxThumbWidth rejects widths beyond any
+// source capycut is likely to see
+const (
+	DefaultThumbWidth = 640
+	MaxThumbWidth     = 3840
+)
+
+// thumbEndMargin keeps a clamped timestamp this far before the end, where
+// ffmpeg still finds a frame to decode
+const thumbEndMargin = 100 * time.Millisecond
+
+// ThumbOptions controls how GenerateThumbnail renders the frame. The zero
+// value keeps the source width.
+type ThumbOptions struct {
+	// Width is the width in pixels, height keeps the aspect ratio; 0 keeps
+	// the source width, and narrower sources are never scaled up
+	Width int
+
+	// FileMode is applied to the written image when set, as in ClipParams
+	FileMode os.FileMode
+}
+
+// Validate checks the options before any work is done
+func (o ThumbOptions) Validate() error {
+	if o.Width < 0 || o.Width > MaxThumbWidth {
+		return fmt.Errorf("thumbnail width must be 0 (the source width) to %d pixels, got %d", MaxThumbWidth, o.Width)
+	}
+	return nil
+}
+
+// ThumbnailPath names the thumbnail of a clip alongside it, e.g.
+// "talk_00-01-00.mp4" becomes "talk_00-01-00_thumb.jpg"
+func ThumbnailPath(clipPath string) string {
+	stem := strings.TrimSuffix(clipPath, filepath.Ext(clipPath))
+	return stem + "_thumb.jpg"
+}
+
+// GenerateThumbnail saves the frame at at from input as a single image,
+// JPEG or PNG by output's extension. ThumbnailMidpoint picks the middle of
+// the video, and a time past the end is clamped to the last frame, using
+// the duration from GetVideoInfo.
+func GenerateThumbnail(input string, at time.Duration, output string, opts ThumbOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if _, err := thumbnailCodecArgs(output); err != nil {
+		return err
+	}
+
+	info, err := GetVideoInfo(input)
+	if err != nil {
+		return err
+	}
+	at = thumbnailTime(at, info.Duration)
+
+	cmd := exec.Command("ffmpeg", BuildThumbnailArgs(input, at, output, opts)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ffmpeg error: %w\nOutput: %s", err, string(out))
+	}
+
+	// A seek past the last decodable frame exits cleanly without output
+	if _, err := os.Stat(output); err != nil {
+		return fmt.Errorf("no frame found at %s", FormatTimestamp(at))
+	}
+
+	if opts.FileMode != 0 {
+		if err := os.Chmod(output, opts.FileMode); err != nil {
+			return fmt.Errorf("failed to set thumbnail permissions: %w", err)
+		}
+	}
+	return nil
+}
+
+// thumbnailTime resolves ThumbnailMidpoint and clamps at to a video of the
+// given duration. An unknown (zero) duration leaves at alone, or gives the
+// first frame for the midpoint.
+func thumbnailTime(at, duration time.Duration) time.Duration {
+	if at < 0 {
+		return duration / 2
+	}
+	if duration > 0 && at >= duration {
+		return max(duration-thumbEndMargin, 0)
+	}
+	return at
+}
+
+// BuildThumbnailArgs returns the ffmpeg arguments GenerateThumbnail runs
+// for a frame at at, which must already be resolved and clamped
+func BuildThumbnailArgs(input string, at time.Duration, output string, opts ThumbOptions) []string {
+	args := []string{
+		"-y",
+		"-ss", strconv.FormatFloat(at.Seconds(), 'f', 3, 64),
+		"-i", input,
+		"-frames:v", "1",
+	}
+	if opts.Width > 0 {
+		args = append(args, "-vf", fmt.Sprintf("scale=w='min(%d,iw)':h=-2:flags=lanczos", opts.Width))
+	}
+	codec, _ := thumbnailCodecArgs(output)
+	return append(append(args, codec...), output)
+}
+
+// thumbnailCodecArgs returns the encoder arguments for an image path,
+// rejecting extensions other than .jpg, .jpeg and .png
+func thumbnailCodecArgs(output string) ([]string, error) {
+	switch strings.ToLower(filepath.Ext(output)) {
+	case ".jpg", ".jpeg":
+		return []string{"-q:v", "2"}, nil
+	case ".png":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("thumbnail must be a .jpg or .png file, got %q", filepath.Base(output))
+	}
+}
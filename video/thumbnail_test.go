@@ -0,0 +1,103 @@
+package video
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThumbnailTime(t *testing.T) {
+	tests := []struct {
+		name         string
+		at, duration time.Duration
+		want         time.Duration
+	}{
+		{"midpoint", ThumbnailMidpoint, 10 * time.Second, 5 * time.Second},
+		{"explicit", 2 * time.Second, 10 * time.Second, 2 * time.Second},
+		{"start", 0, 10 * time.Second, 0},
+		{"past the end", time.Minute, 10 * time.Second, 10*time.Second - thumbEndMargin},
+		{"at the end", 10 * time.Second, 10 * time.Second, 10*time.Second - thumbEndMargin},
+		{"shorter than the margin", time.Second, 50 * time.Millisecond, 0},
+		{"unknown duration", 3 * time.Second, 0, 3 * time.Second},
+		{"midpoint of unknown duration", ThumbnailMidpoint, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := thumbnailTime(tt.at, tt.duration); got != tt.want {
+				t.Errorf("thumbnailTime(%v, %v) = %v, want %v", tt.at, tt.duration, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThumbnailPath(t *testing.T) {
+	tests := map[string]string{
+		"talk_00-01-00_00-02-00.mp4":   "talk_00-01-00_00-02-00_thumb.jpg",
+		"/clips/intro.gif":             "/clips/intro_thumb.jpg",
+		filepath.Join("out", "v.webm"): filepath.Join("out", "v_thumb.jpg"),
+	}
+	for in, want := range tests {
+		if got := ThumbnailPath(in); got != want {
+			t.Errorf("ThumbnailPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestBuildThumbnailArgs(t *testing.T) {
+	got := strings.Join(BuildThumbnailArgs("in.mp4", 1500*time.Millisecond, "thumb.jpg", ThumbOptions{Width: 320}), " ")
+	want := "-y -ss 1.500 -i in.mp4 -frames:v 1 -vf scale=w='min(320,iw)':h=-2:flags=lanczos -q:v 2 thumb.jpg"
+	if got != want {
+		t.Errorf("BuildThumbnailArgs() = %q, want %q", got, want)
+	}
+
+	got = strings.Join(BuildThumbnailArgs("in.mp4", 0, "thumb.PNG", ThumbOptions{}), " ")
+	if want := "-y -ss 0.000 -i in.mp4 -frames:v 1 thumb.PNG"; got != want {
+		t.Errorf("BuildThumbnailArgs() for a full-size PNG = %q, want %q", got, want)
+	}
+}
+
+func TestGenerateThumbnail_InvalidOptions(t *testing.T) {
+	if err := GenerateThumbnail("in.mp4", 0, "thumb.jpg", ThumbOptions{Width: -1}); err == nil || !strings.Contains(err.Error(), "width") {
+		t.Errorf("GenerateThumbnail() error = %v, want a width error", err)
+	}
+	if err := GenerateThumbnail("in.mp4", 0, "thumb.webp", ThumbOptions{}); err == nil || !strings.Contains(err.Error(), ".jpg or .png") {
+		t.Errorf("GenerateThumbnail() error = %v, want a format error", err)
+	}
+}
+
+func TestGenerateThumbnail_Synthetic(t *testing.T) {
+	path := makeTestVideo(t, 2)
+	dir := t.TempDir()
+
+	jpg := filepath.Join(dir, "mid.jpg")
+	if err := GenerateThumbnail(path, ThumbnailMidpoint, jpg, ThumbOptions{Width: 80, FileMode: 0o600}); err != nil {
+		t.Fatalf("GenerateThumbnail() error: %v", err)
+	}
+	data, err := os.ReadFile(jpg)
+	if err != nil {
+		t.Fatalf("reading thumbnail: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte{0xFF, 0xD8}) {
+		t.Error("thumbnail lacks a JPEG header")
+	}
+	if info, err := os.Stat(jpg); err == nil && info.Mode().Perm() != 0o600 {
+		t.Errorf("thumbnail mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// Past the end is clamped rather than producing nothing
+	png := filepath.Join(dir, "end.png")
+	if err := GenerateThumbnail(path, time.Hour, png, ThumbOptions{}); err != nil {
+		t.Fatalf("GenerateThumbnail() past the end error: %v", err)
+	}
+	data, err = os.ReadFile(png)
+	if err != nil {
+		t.Fatalf("reading thumbnail: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte("\x89PNG")) {
+		t.Error("thumbnail lacks a PNG header")
+	}
+}
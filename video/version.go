@@ -0,0 +1,157 @@
+package video
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FFmpegVersion is the release an "ffmpeg -version" banner reports. Git
+// builds ("N-112345-g...") carry no release number and are treated as
+// newer than any release.
+type FFmpegVersion struct {
+	Major, Minor, Patch int
+
+	// Git is set for builds from ffmpeg's master branch
+	Git bool
+
+	// Raw is the version token as printed, e.g. "6.1.1-3ubuntu5"
+	Raw string
+}
+
+// String returns the version as printed by ffmpeg
+func (v FFmpegVersion) String() string {
+	return v.Raw
+}
+
+// AtLeast reports whether v is major.minor or newer
+func (v FFmpegVersion) AtLeast(major, minor int) bool {
+	if v.Git {
+		return true
+	}
+	if v.Major != major {
+		return v.Major > major
+	}
+	return v.Minor >= minor
+}
+
+// ffmpegVersionRe matches the first banner line, e.g. "ffmpeg version
+// 6.1.1-3ubuntu5 Copyright ..." or "ffmpeg version n7.0 ..."
+var ffmpegVersionRe = regexp.MustCompile(`^ffmpeg version (\S+)`)
+
+// releaseRe picks the release number out of a version token, allowing the
+// "n" prefix of tarball builds
+var releaseRe = regexp.MustCompile(`^n?(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// ParseFFmpegVersion reads the version from "ffmpeg -version" output
+func ParseFFmpegVersion(output string) (FFmpegVersion, error) {
+	firstLine, _, _ := strings.Cut(strings.TrimSpace(output), "\n")
+	m := ffmpegVersionRe.FindStringSubmatch(firstLine)
+	if m == nil {
+		return FFmpegVersion{}, fmt.Errorf("unrecognized ffmpeg version output %q", firstLine)
+	}
+
+	v := FFmpegVersion{Raw: m[1]}
+	if strings.HasPrefix(v.Raw, "N-") {
+		v.Git = true
+		return v, nil
+	}
+
+	r := releaseRe.FindStringSubmatch(v.Raw)
+	if r == nil {
+		return FFmpegVersion{}, fmt.Errorf("unrecognized ffmpeg version %q", v.Raw)
+	}
+	v.Major, _ = strconv.Atoi(r[1])
+	v.Minor, _ = strconv.Atoi(r[2])
+	if r[3] != "" {
+		v.Patch, _ = strconv.Atoi(r[3])
+	}
+	return v, nil
+}
+
+// ffmpegProbe runs "ffmpeg -version" once and caches the output; the
+// binary on PATH only changes while capycut runs when InstallFFmpeg
+// installs it, which resets the cache
+var ffmpegProbe = newFFmpegProbe()
+
+func newFFmpegProbe() func() (string, error) {
+	return sync.OnceValues(func() (string, error) {
+		output, err := exec.Command("ffmpeg", "-version").Output()
+		return string(output), err
+	})
+}
+
+// resetFFmpegProbe makes the next probe run ffmpeg again
+func resetFFmpegProbe() {
+	ffmpegProbe = newFFmpegProbe()
+}
+
+// DetectFFmpegVersion returns the installed ffmpeg's version. ffmpeg is only
+// run once per process.
+func DetectFFmpegVersion() (FFmpegVersion, error) {
+	output, err := ffmpegProbe()
+	if err != nil {
+		return FFmpegVersion{}, fmt.Errorf("ffmpeg not found: %w", err)
+	}
+	return ParseFFmpegVersion(output)
+}
+
+// ffmpegRequirement is the oldest ffmpeg release that supports a feature
+type ffmpegRequirement struct {
+	feature      string
+	major, minor int
+}
+
+var (
+	// NVENC's p1-p7 presets arrived with the SDK 10 update in 4.3
+	nvencPresetRequirement = ffmpegRequirement{"NVENC p1-p7 presets", 4, 3}
+
+	// h264_videotoolbox accepts -q:v constant quality from 4.4
+	videoToolboxQualityRequirement = ffmpegRequirement{"VideoToolbox constant quality (-q:v)", 4, 4}
+)
+
+// check returns a "requires ffmpeg >= N" error when v is too old
+func (r ffmpegRequirement) check(v FFmpegVersion) error {
+	if v.AtLeast(r.major, r.minor) {
+		return nil
+	}
+	return fmt.Errorf("%s requires ffmpeg >= %d.%d, found %s; upgrade ffmpeg or use --hwaccel none", r.feature, r.major, r.minor, v)
+}
+
+// encodeRequirements lists the ffmpeg features the options rely on
+func encodeRequirements(o EncodeOptions) []ffmpegRequirement {
+	switch o.HWAccel {
+	case HWAccelNVENC:
+		return []ffmpegRequirement{nvencPresetRequirement}
+	case HWAccelVideoToolbox:
+		if o.Bitrate == "" {
+			return []ffmpegRequirement{videoToolboxQualityRequirement}
+		}
+	}
+	return nil
+}
+
+// checkEncodeSupport checks the options against version before ffmpeg runs,
+// so an old build fails with a clear message rather than an option error
+func checkEncodeSupport(o EncodeOptions, version FFmpegVersion) error {
+	for _, r := range encodeRequirements(o) {
+		if err := r.check(version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckEncodeSupport checks that the installed ffmpeg can re-encode with the
+// options. A version that can't be detected passes; ffmpeg reports any
+// problem itself.
+func CheckEncodeSupport(o EncodeOptions) error {
+	version, err := DetectFFmpegVersion()
+	if err != nil {
+		return nil
+	}
+	return checkEncodeSupport(o, version)
+}